@@ -0,0 +1,47 @@
+--- Env library.
+-- This library is preloaded and available as global, it can also be required:
+--   local env = require("env")
+-- It exposes the parts of the environment a definition declares in its permissions
+-- and a clock that can be pinned for reproducible output with `rpack run --timestamp`
+-- or SOURCE_DATE_EPOCH. Everything else about the host stays hidden from the script.
+--
+-- @module env
+local env = {}
+
+---
+-- Returns the value of an environment variable declared in permissions.env.
+-- Reading a variable that is not declared fails the script.
+--
+-- @param name string The name of the variable.
+-- @param default string|nil Returned if the variable is unset.
+-- @return string|nil The value, or default if the variable is unset.
+function env.get(name, default)
+    -- actual implementation in Go backend
+end
+
+---
+-- Returns the host name, the definition needs permissions.hostname.
+--
+-- @return string The host name.
+function env.hostname()
+    -- actual implementation in Go backend
+end
+
+---
+-- Returns the time of the run in Unix seconds, the pinned timestamp if given.
+--
+-- @return number Seconds since 1970-01-01 00:00:00 UTC.
+function env.now()
+    -- actual implementation in Go backend
+end
+
+---
+-- Formats the time of the run in UTC.
+--
+-- @param layout string|nil A Go time layout such as "2006-01-02", RFC 3339 by default.
+-- @return string The formatted time.
+function env.date(layout)
+    -- actual implementation in Go backend
+end
+
+return env
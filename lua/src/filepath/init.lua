@@ -3,6 +3,8 @@
 --   local filepath = require("filepath")
 -- It's exposing a large portion of Golang's "path/filepath" module functionality.
 -- Source: https://pkg.go.dev/path/filepath
+-- Paths are slash separated on all platforms, backslashes are accepted as separators,
+-- so scripts produce the same paths on Linux, macOS and Windows.
 --
 -- @module filepath
 local filepath = {}
@@ -117,7 +119,7 @@ end
 -- It accepts paths like `map:inputdir` and returns "map", "inputdir".
 --
 -- For paths without a given location specifier such as "map:" it will return "target"
--- as the location.
+-- as the location. A drive letter such as `C:` is no location specifier.
 --
 -- @param path string The path string potentially containing a location specifier.
 -- @return string The location specifier such as "map", or "target" if none is found.
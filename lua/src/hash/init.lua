@@ -0,0 +1,57 @@
+--- Hash library.
+-- This library is preloaded and available as global, it can also be required:
+--   local hash = require("hash")
+-- It's exposing Golang's hash functions to embed content digests into generated files,
+-- e.g. for cache busting or integrity manifests. All functions hash the bytes of the
+-- string and return the digest as lower case hex string.
+-- Source: https://pkg.go.dev/crypto
+--
+-- @module hash
+local hash = {}
+
+---
+-- Calculates the SHA-256 digest.
+--
+-- @param str string The content to hash.
+-- @return string Hex digest with 64 characters.
+function hash.sha256(str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Calculates the SHA-512 digest.
+--
+-- @param str string The content to hash.
+-- @return string Hex digest with 128 characters.
+function hash.sha512(str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Calculates the SHA-1, not suitable for security purposes digest.
+--
+-- @param str string The content to hash.
+-- @return string Hex digest with 40 characters.
+function hash.sha1(str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Calculates the MD5, not suitable for security purposes digest.
+--
+-- @param str string The content to hash.
+-- @return string Hex digest with 32 characters.
+function hash.md5(str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Calculates the CRC-32 (IEEE) checksum digest.
+--
+-- @param str string The content to hash.
+-- @return string Hex digest with 8 characters.
+function hash.crc32(str)
+    -- actual implementation in Go backend
+end
+
+return hash
@@ -0,0 +1,101 @@
+--- Regex library.
+-- This library is preloaded and available as global, it can also be required:
+--   local regex = require("regex")
+-- It's exposing Golang's "regexp" module, patterns use RE2 syntax.
+-- Source: https://pkg.go.dev/regexp/syntax
+--
+-- @module regex
+local regex = {}
+
+---
+-- Reports whether the string contains any match of the pattern.
+--
+-- @param pattern string The regular expression.
+-- @param str string The string to search.
+-- @return boolean True if the pattern matches.
+function regex.match(pattern, str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Returns the leftmost match of the pattern.
+--
+-- @param pattern string The regular expression.
+-- @param str string The string to search.
+-- @return string|nil The matched text or nil if there is no match.
+function regex.find(pattern, str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Returns all successive matches of the pattern.
+--
+-- @param pattern string The regular expression.
+-- @param str string The string to search.
+-- @param[opt] n number Maximum number of matches, all if omitted.
+-- @return table List of matched texts.
+function regex.find_all(pattern, str, n)
+    -- actual implementation in Go backend
+end
+
+---
+-- Returns the leftmost match including its capture groups.
+--
+-- The returned table holds the whole match at index 0 and the capture
+-- groups at 1..n. Named groups (?P<name>...) are also available by name.
+-- Groups that did not participate in the match are empty strings.
+--
+-- @param pattern string The regular expression.
+-- @param str string The string to search.
+-- @return table|nil The capture table or nil if there is no match.
+function regex.capture(pattern, str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Returns capture tables of all successive matches.
+--
+-- @param pattern string The regular expression.
+-- @param str string The string to search.
+-- @param[opt] n number Maximum number of matches, all if omitted.
+-- @return table List of capture tables, see regex.capture.
+function regex.capture_all(pattern, str, n)
+    -- actual implementation in Go backend
+end
+
+---
+-- Replaces all matches of the pattern.
+--
+-- If repl is a string, $1 or ${name} are expanded to the capture groups.
+-- If repl is a function, it's called with the capture table of each
+-- match and must return the replacement string.
+--
+-- @param pattern string The regular expression.
+-- @param str string The string to rewrite.
+-- @param repl string|function The replacement.
+-- @return string The rewritten string.
+function regex.replace(pattern, str, repl)
+    -- actual implementation in Go backend
+end
+
+---
+-- Splits the string into substrings separated by the pattern.
+--
+-- @param pattern string The regular expression.
+-- @param str string The string to split.
+-- @param[opt] n number Maximum number of substrings, all if omitted.
+-- @return table List of substrings.
+function regex.split(pattern, str, n)
+    -- actual implementation in Go backend
+end
+
+---
+-- Escapes all regular expression metacharacters in the string.
+--
+-- @param str string The literal text.
+-- @return string A pattern matching the literal text.
+function regex.quote(str)
+    -- actual implementation in Go backend
+end
+
+return regex
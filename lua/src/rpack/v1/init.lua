@@ -9,9 +9,32 @@
 
 local rpack = {}
 
+--- Error raised by failing file operations such as rpack.read and rpack.write.
+--- `tostring(err)` returns the message.
+--- @class rpack.FileError
+--- @field op string The operation, e.g. "read" or "write".
+--- @field path string The path given to the function.
+--- @field kind string One of "not_found", "denied", "invalid_path", "exists" or "io".
+--- @field cause string The underlying error.
+--- @field message string The message including the script location.
+
+--- External data passed to the script.
+--- Each key is a function returning the data, `rpack.values()` and `rpack.inputs()` are aliases
+--- of `rpack.data.values()` and `rpack.data.inputs()`.
+rpack.data = {}
+
+--- User configured values, see `rpack.values`.
+--- @treturn table User supplied configuration values.
+function rpack.data.values() end
+
+--- User configured input names, see `rpack.inputs`.
+--- @return result Array of user supplied inputs names.
+function rpack.data.inputs() end
+
 --- User configured inputs.
---- Not all inputs specified in RPackDef must be configured by the user.
+--- Optional inputs specified in RPackDef may be missing, inputs with a default are included if the default exists.
 --- Can be prefixed with `map:` to use as a file handle, e.g. input: my-file -> map:my-file
+--- The table is additionally keyed by name with the handle, missing inputs are nil: rpack.inputs()["my-file"] -> map:my-file
 --- @return result Array of user supplied inputs names.
 function rpack.rpack.inputs() end
 
@@ -33,8 +56,9 @@ function rpack.from_yaml(str) end
 
 --- Convert table to yaml
 --- @param tbl table The table to convert into yaml str
+--- @param opts? table Options: indent (number, 2 to 9, default 2), sort_keys (boolean, default true; false keeps the order keys were set), trailing_newline (boolean, default true)
 --- @return string Serialized yaml string.
-function rpack.to_yaml(tbl) end
+function rpack.to_yaml(tbl, opts) end
 
 --- Convert json to table
 --- @param str string The json in string format
@@ -46,13 +70,105 @@ function rpack.from_json(file) end
 --- @return string Serialized json string.
 function rpack.to_json(tbl) end
 
+--- Convert xml to table.
+--- Elements become tables keyed by child element name, repeated elements become arrays.
+--- Attributes are stored with the attribute prefix, text of elements with attributes or children
+--- is stored under the text key. Elements without attributes and children become strings.
+--- @param str string The xml in string format
+--- @param[opt] opts table Options: attr_prefix (default "@"), text_key (default "#text")
+--- @return table Deserialized xml structure, keyed by root element name.
+function rpack.from_xml(str, opts) end
+
+--- Convert table to xml.
+--- The table needs exactly one key, the root element name. Keys are written in sorted order.
+--- @param tbl table The table to convert into xml str
+--- @param[opt] opts table Options: attr_prefix (default "@"), text_key (default "#text"),
+--- indent (string or number of spaces, default 2), header (bool, default true)
+--- @return string Serialized xml string.
+function rpack.to_xml(tbl, opts) end
+
+--- Convert java .properties to table.
+--- Supports comments, line continuations, `=`, `:` and whitespace separators
+--- and backslash escapes including \uXXXX. All values are strings.
+--- @param str string The properties in string format
+--- @return table Flat table of keys and values.
+function rpack.from_properties(str) end
+
+--- Convert table to java .properties.
+--- The table must be flat, keys are written in sorted order and escaped as needed.
+--- @param tbl table The flat table to convert into properties str
+--- @param[opt] opts table Options: separator (default "="),
+--- ascii (bool, escape non-ASCII characters as \uXXXX, default true)
+--- @return string Serialized properties string.
+function rpack.to_properties(tbl, opts) end
+
+--- Convert csv to a list of rows.
+--- With header the first record names the columns and each row is a table keyed by column name,
+--- otherwise each row is a list of fields. All fields are strings.
+--- @param str string The csv in string format
+--- @param[opt] opts table Options: delimiter (default ","), header (bool, default true),
+--- comment (character starting ignored lines), lazy_quotes (bool, default false)
+--- @return table List of rows.
+--- @return table|nil Header columns in document order, nil without header.
+function rpack.from_csv(str, opts) end
+
+--- Convert a list of rows to csv.
+--- Rows are lists of fields or tables keyed by column name, fields are strings, numbers or booleans.
+--- The columns of keyed rows keep the header order of rows returned by from_csv,
+--- other columns are sorted unless given by the columns option.
+--- @param rows table The rows to convert into csv str
+--- @param[opt] opts table Options: delimiter (default ","), header (bool, default true),
+--- columns (list of column names), crlf (bool, default false)
+--- @return string Serialized csv string.
+function rpack.to_csv(rows, opts) end
+
 --- Read lines from file and returns a list of lines.
 --- It preserves the information about the line separator used
 --- and if the last line is terminated.
+--- Files with BOM or in UTF-16/UTF-32 are decoded to UTF-8, lines are split on any
+--- line ending and separator is the most common one.
 --- @param file string The file to read from.
---- @return table {lines: []string, separator: string, finalNewLine: bool}
+--- @return table {lines: []string, separator: string, finalNewline: bool,
+--- mixedLineEndings: bool, encoding: string, bom: bool}
 function rpack.read_lines(file) end
 
+--- Iterate over the lines of a file without reading it into memory at once.
+--- Suited for huge line-based inputs. Line endings and a leading UTF-8 BOM are
+--- stripped, the content is not decoded otherwise.
+--- @usage for line, n in rpack.lines_iter("map:big.txt") do ... end
+--- @param file string The file to read from.
+--- @return function Iterator returning the line and its line number.
+function rpack.lines_iter(file) end
+
+--- Detect encoding, byte order mark and line endings of a file.
+--- Encoding is one of utf-8, utf-16le, utf-16be, utf-32le, utf-32be or unknown
+--- for content that is not valid UTF-8, e.g. legacy single byte encodings.
+--- @param file string The file to inspect.
+--- @return table {encoding: string, bom: bool, line_ending: string (lf, crlf, cr, mixed, none),
+--- line_endings: {lf: number, crlf: number, cr: number}, mixed: bool}
+function rpack.detect_encoding(file) end
+
+--- Report a non-fatal finding about the target.
+--- Warnings are printed in the run summary and included in meta.json and plan files.
+--- @param msg string The warning message.
+function rpack.warn(msg) end
+
+--- Report a non-fatal finding about a file of the target.
+--- Annotations are printed in the run summary and included in meta.json and plan files.
+--- @usage rpack.annotate("./deploy/app.yaml", "replicas are overridden manually")
+--- @param path string The target file the finding refers to.
+--- @param msg string The annotation message.
+function rpack.annotate(path, msg) end
+
+--- Remove a temp file or a target file written in this run
+--- @param file string The file to remove.
+function rpack.remove(file) end
+
+--- Move a temp file or a target file written in this run, replacing the destination
+--- @param from string The file to move.
+--- @param to string The new location.
+function rpack.rename(from, to) end
+
 --- Write lines to file
 --- @param file string The file to write to.
 --- @param obj table The lines to write to the file
@@ -66,11 +182,56 @@ function rpack.write_lines(file, obj, lineSep, finalNl) end
 --- @return string Contents of file.
 function rpack.read(file) end
 
+--- Check if a file or directory exists
+--- @param path string The file or directory to check.
+--- @return boolean True if it exists.
+function rpack.exists(path) end
+
+--- Check if a directory exists
+--- @param path string The directory to check.
+--- @return boolean True if it exists and is a directory.
+function rpack.is_dir(path) end
+
 --- Write a string to a file
 --- @param file string The file to write to.
 --- @param str string The string to write.
 function rpack.write(file, str) end
 
+--- Write a table to a file as json
+--- @param file string The file to write to.
+--- @param tbl table The table to write.
+--- @param opts? table Options: indent (number, 0 to 9, default 2; 0 writes compact json), sort_keys (boolean, default true), trailing_newline (boolean, default true)
+function rpack.write_json(file, tbl, opts) end
+
+--- Write a table to a file as yaml
+--- @param file string The file to write to.
+--- @param tbl table The table to write.
+--- @param opts? table Options as for rpack.to_yaml.
+function rpack.write_yaml(file, tbl, opts) end
+
+--- Append a string to a file.
+--- Extends content written during this run and creates the file if needed,
+--- the existing target file is never read.
+--- @param file string The file to append to.
+--- @param str string The string to append.
+function rpack.append(file, str) end
+
+--- Apply a unified diff to a file written during this run.
+--- File headers are optional, hunks may be offset but their context has to match.
+--- @usage rpack.patch("./Makefile", rpack.read("rpack:files/lint.patch"))
+--- @param file string The file to patch.
+--- @param diff string The unified diff.
+function rpack.patch(file, diff) end
+
+--- Write only a block of a target file, delimited by "BEGIN rpack <marker>" and "END rpack <marker>" comment lines.
+--- The rest of the file is kept, so packs can share files with hand-maintained content.
+--- A missing block is appended to the file. Files written with managed_block must not be written otherwise.
+--- @usage rpack.managed_block("./Makefile", "lint", "lint:\n\tgolangci-lint run\n")
+--- @param file string The target file.
+--- @param marker string The name of the block, a single word.
+--- @param content string The content of the block.
+function rpack.managed_block(file, marker, content) end
+
 --- Template string contents with data.
 --- It uses golangs text/template functionality, see [Go text template](https://pkg.go.dev/text/template).
 --- The sprig function rpack.library is also availble [Sprig Functions](https://masterminds.github.io/sprig/).
@@ -0,0 +1,244 @@
+--- Strings library.
+-- This library is preloaded and available as global, it can also be required:
+--   local strings = require("strings")
+-- It's exposing Golang's "strings" module. Unlike Lua's string library it
+-- works on plain text instead of patterns, lengths and padding count characters.
+-- Source: https://pkg.go.dev/strings
+--
+-- @module strings
+local strings = {}
+
+---
+-- Splits the string around each occurrence of sep.
+--
+-- @param str string The string to split.
+-- @param sep string The separator.
+-- @param[opt] n number Maximum number of parts, all if omitted.
+-- @return table List of substrings.
+function strings.split(str, sep, n)
+    -- actual implementation in Go backend
+end
+
+---
+-- Concatenates the elements of a list with sep in between.
+--
+-- @param list table List of strings or numbers.
+-- @param[opt] sep string The separator, empty if omitted.
+-- @return string The joined string.
+function strings.join(list, sep)
+    -- actual implementation in Go backend
+end
+
+---
+-- Splits the string around runs of whitespace.
+--
+-- @param str string The string to split.
+-- @return table List of non-empty substrings.
+function strings.fields(str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Splits the string into lines on \n and \r\n.
+-- A final line ending does not add an empty line.
+--
+-- @param str string The string to split.
+-- @return table List of lines without line endings.
+function strings.lines(str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Slices the string around the first occurrence of sep.
+--
+-- @param str string The string to cut.
+-- @param sep string The separator.
+-- @return string The text before sep, the whole string if sep is not found.
+-- @return string The text after sep.
+-- @return boolean True if sep was found.
+function strings.cut(str, sep)
+    -- actual implementation in Go backend
+end
+
+---
+-- Removes leading and trailing characters.
+--
+-- @param str string The string to trim.
+-- @param[opt] cutset string Characters to remove, whitespace if omitted.
+-- @return string The trimmed string.
+function strings.trim(str, cutset)
+    -- actual implementation in Go backend
+end
+
+---
+-- Removes leading characters.
+--
+-- @param str string The string to trim.
+-- @param[opt] cutset string Characters to remove, whitespace if omitted.
+-- @return string The trimmed string.
+function strings.trim_left(str, cutset)
+    -- actual implementation in Go backend
+end
+
+---
+-- Removes trailing characters.
+--
+-- @param str string The string to trim.
+-- @param[opt] cutset string Characters to remove, whitespace if omitted.
+-- @return string The trimmed string.
+function strings.trim_right(str, cutset)
+    -- actual implementation in Go backend
+end
+
+---
+-- Removes a leading prefix, the string is returned unchanged if it does not start with it.
+--
+-- @param str string The string to trim.
+-- @param prefix string The prefix to remove.
+-- @return string The trimmed string.
+function strings.trim_prefix(str, prefix)
+    -- actual implementation in Go backend
+end
+
+---
+-- Removes a trailing suffix, the string is returned unchanged if it does not end with it.
+--
+-- @param str string The string to trim.
+-- @param suffix string The suffix to remove.
+-- @return string The trimmed string.
+function strings.trim_suffix(str, suffix)
+    -- actual implementation in Go backend
+end
+
+---
+-- Reports whether the string starts with prefix.
+--
+-- @param str string The string to check.
+-- @param prefix string The prefix.
+-- @return boolean True if str starts with prefix.
+function strings.has_prefix(str, prefix)
+    -- actual implementation in Go backend
+end
+
+---
+-- Reports whether the string ends with suffix.
+--
+-- @param str string The string to check.
+-- @param suffix string The suffix.
+-- @return boolean True if str ends with suffix.
+function strings.has_suffix(str, suffix)
+    -- actual implementation in Go backend
+end
+
+---
+-- Reports whether substr is within the string.
+--
+-- @param str string The string to search.
+-- @param substr string The text to find.
+-- @return boolean True if substr is found.
+function strings.contains(str, substr)
+    -- actual implementation in Go backend
+end
+
+---
+-- Returns the position of the first occurrence of substr.
+--
+-- @param str string The string to search.
+-- @param substr string The text to find.
+-- @return number|nil The 1-based byte position like string.find, nil if not found.
+function strings.index(str, substr)
+    -- actual implementation in Go backend
+end
+
+---
+-- Counts the non-overlapping occurrences of substr.
+--
+-- @param str string The string to search.
+-- @param substr string The text to count.
+-- @return number The number of occurrences.
+function strings.count(str, substr)
+    -- actual implementation in Go backend
+end
+
+---
+-- Replaces occurrences of old with new.
+--
+-- @param str string The string to change.
+-- @param old string The text to replace.
+-- @param new string The replacement.
+-- @param[opt] n number Maximum number of replacements, all if omitted.
+-- @return string The changed string.
+function strings.replace(str, old, new, n)
+    -- actual implementation in Go backend
+end
+
+---
+-- Converts all letters to upper case.
+--
+-- @param str string The string to convert.
+-- @return string The upper case string.
+function strings.upper(str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Converts all letters to lower case.
+--
+-- @param str string The string to convert.
+-- @return string The lower case string.
+function strings.lower(str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Upper cases the first letter of each word. Words are separated by
+-- whitespace, '-' and '_', the other letters are kept as they are.
+--
+-- @param str string The string to convert.
+-- @return string The title case string.
+function strings.title(str)
+    -- actual implementation in Go backend
+end
+
+---
+-- Reports whether the strings are equal ignoring case.
+--
+-- @param a string The first string.
+-- @param b string The second string.
+-- @return boolean True if both are equal ignoring case.
+function strings.equal_fold(a, b)
+    -- actual implementation in Go backend
+end
+
+---
+-- Pads the string on the left to width characters.
+--
+-- @param str string The string to pad.
+-- @param width number The minimum number of characters.
+-- @param[opt] pad string A single character, space if omitted.
+-- @return string The padded string.
+function strings.pad_left(str, width, pad)
+    -- actual implementation in Go backend
+end
+
+---
+-- Pads the string on the right to width characters.
+--
+-- @param str string The string to pad.
+-- @param width number The minimum number of characters.
+-- @param[opt] pad string A single character, space if omitted.
+-- @return string The padded string.
+function strings.pad_right(str, width, pad)
+    -- actual implementation in Go backend
+end
+
+---
+-- Counts the characters of the string, unlike # which counts bytes.
+--
+-- @param str string The string to count.
+-- @return number The number of characters.
+function strings.len(str)
+    -- actual implementation in Go backend
+end
+
+return strings
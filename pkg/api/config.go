@@ -0,0 +1,87 @@
+package api
+
+// ConfigSchemaVersion is the schema version of configs and lockfiles described by this package.
+const ConfigSchemaVersion = "v1"
+
+// Config is a config file (*.rpack.yaml) using one or more rpacks.
+type Config struct {
+	SchemaVersion string `json:"@schema_version"`
+	// Source of the rpack definition, mutually exclusive with Packs
+	Source string `json:"source,omitempty"`
+	// Config holds values and inputs of the single source
+	Config *ConfigValues `json:"config,omitempty"`
+	// Script selects the entry script of the single source, script.lua if empty
+	Script string `json:"script,omitempty"`
+	// Packs declares multiple packs executed from a single config file
+	Packs []*ConfigPack `json:"packs,omitempty"`
+	// SemanticUnchanged lists target path patterns of JSON and YAML files that are kept
+	// as they are if they parse to the same structure as the generated content.
+	SemanticUnchanged []string `json:"semantic_unchanged,omitempty"`
+	// Protected lists target path patterns rpack never overwrites or removes
+	Protected []string `json:"protected,omitempty"`
+	// GitAttributes applies the eol policy of the target's .gitattributes to generated text files
+	GitAttributes bool `json:"gitattributes,omitempty"`
+	// ChecksumAlgorithm of the lockfile checksums, defaults to sha256
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+	// Verify lists commands run after the apply, a failure rolls back the apply
+	Verify []*ConfigVerify `json:"verify,omitempty"`
+	// PostApply lists commands run after a successful apply, e.g. formatters
+	PostApply []*ConfigPostApply `json:"post_apply,omitempty"`
+	// Notify sends the run report to a webhook after a successful apply
+	Notify *ConfigNotify `json:"notify,omitempty"`
+	// Secrets declares credentials scripts can read with the secret: prefix
+	Secrets map[string]*ConfigSecret `json:"secrets,omitempty"`
+	// Extra maps names to read-only dirs and files outside the target, scripts read them with the extra: prefix
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// ConfigSecret is the source of a secret, either Env or SOPS and Key are set.
+type ConfigSecret struct {
+	// Env is the name of the environment variable holding the secret
+	Env string `json:"env,omitempty"`
+	// SOPS is the path of a SOPS encrypted file relative to the config
+	SOPS string `json:"sops,omitempty"`
+	// Key is the dot separated path of the secret in the SOPS file
+	Key string `json:"key,omitempty"`
+}
+
+// ConfigVerify is a command verifying the applied files.
+type ConfigVerify struct {
+	Name    string   `json:"name,omitempty"`
+	Command []string `json:"command"`
+	// Timeout is a Go duration
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ConfigPostApply is a command run after a successful apply.
+type ConfigPostApply struct {
+	Name    string   `json:"name,omitempty"`
+	Command []string `json:"command"`
+	// Timeout is a Go duration
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ConfigNotify is the webhook the run report is posted to after a successful apply.
+type ConfigNotify struct {
+	Webhook string `json:"webhook"`
+	// Timeout is a Go duration
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ConfigPack is a single pack entry of a multi-pack config.
+type ConfigPack struct {
+	Name   string        `json:"name"`
+	Source string        `json:"source"`
+	Config *ConfigValues `json:"config,omitempty"`
+	// DependsOn lists names of packs that need to be executed before this pack
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Script selects the entry script declared by the definition, script.lua if empty
+	Script string `json:"script,omitempty"`
+}
+
+// ConfigValues holds the inputs and values passed to an rpack.
+type ConfigValues struct {
+	// Inputs maps input names of the definition to paths relative to the config
+	Inputs map[string]string `json:"inputs"`
+	Values map[string]any    `json:"values"`
+}
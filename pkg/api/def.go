@@ -0,0 +1,86 @@
+package api
+
+// Def is an rpack definition (rpack.yaml).
+type Def struct {
+	SchemaVersion string `json:"@schema_version"`
+	Name          string `json:"name"`
+	// Description tells users what the definition generates
+	Description string `json:"description,omitempty"`
+	// Version of the definition, optional
+	Version string `json:"version,omitempty"`
+	// Inputs are files and dirs outside the definition the script may read
+	Inputs []*DefInput `json:"inputs"`
+	// Extra are read-only dirs and files outside the target the config maps
+	Extra []*DefExtra `json:"extra,omitempty"`
+	// AllowTargetRead lists target path patterns the script may read
+	AllowTargetRead []string `json:"allow_target_read,omitempty"`
+	// SensitiveValues lists dot separated paths of values holding secrets
+	SensitiveValues []string `json:"sensitive_values,omitempty"`
+	// Permissions declares capabilities beyond the default sandbox
+	Permissions *DefPermissions `json:"permissions,omitempty"`
+	// Template sets the defaults of rpack.template
+	Template *DefTemplate `json:"template,omitempty"`
+	// Scripts are named entry scripts besides script.lua
+	Scripts []*DefScript `json:"scripts,omitempty"`
+	// Dependencies are definitions executed before this one
+	Dependencies []*DefDependency `json:"dependencies,omitempty"`
+}
+
+// DefDependency is a definition another definition builds on.
+type DefDependency struct {
+	Name   string         `json:"name"`
+	Source string         `json:"source"`
+	Values map[string]any `json:"values,omitempty"`
+	Script string         `json:"script,omitempty"`
+}
+
+// DefScript is a named entry script of a definition.
+type DefScript struct {
+	Name string `json:"name"`
+	// File is the slash separated path relative to the definition
+	File        string `json:"file"`
+	Description string `json:"description,omitempty"`
+}
+
+// DefTemplate sets the defaults of rpack.template.
+type DefTemplate struct {
+	// MissingKey is default, zero or error
+	MissingKey string `json:"missingkey,omitempty"`
+	// Escape is text or html
+	Escape string `json:"escape,omitempty"`
+}
+
+// DefPermissions declares the capabilities a definition needs, anything not declared is denied.
+type DefPermissions struct {
+	// ReadInputs allows reading the mapped inputs and extras
+	ReadInputs bool `json:"read_inputs,omitempty"`
+	// WriteTarget allows writing files to the target
+	WriteTarget bool `json:"write_target,omitempty"`
+	// TargetReadPaths lists target path patterns the script may read
+	TargetReadPaths []string `json:"target_read_paths,omitempty"`
+	// HTTP lists URLs the script may fetch, entries ending with a slash allow all URLs below
+	HTTP []string `json:"http,omitempty"`
+	// Env lists the environment variables the script may read
+	Env []string `json:"env,omitempty"`
+	// Hostname allows the script to read the host name
+	Hostname bool `json:"hostname,omitempty"`
+}
+
+// DefInput declares an input of a definition.
+type DefInput struct {
+	// Type is either file or dir
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Description tells users what to map to the input
+	Description string `json:"description,omitempty"`
+}
+
+// DefExtra is a read-only dir or file outside the target the definition expects the config to map.
+type DefExtra struct {
+	// Type is either file or dir
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Description tells users what to map to the extra
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
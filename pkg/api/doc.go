@@ -0,0 +1,8 @@
+// Package api contains the types external tools use to integrate with rpack:
+// configs, definitions, lockfiles, plans, integrity reports and run options and results.
+//
+// The package follows semantic versioning independent of the internal packages.
+// Within a major version fields and types are only added, never removed or changed,
+// and the JSON encoding stays compatible with the file formats of the same schema version.
+// The package has no dependencies besides the standard library.
+package api
@@ -0,0 +1,33 @@
+package api
+
+// LockFile tracks the files written by a config (*.rpack.lock.yaml).
+type LockFile struct {
+	SchemaVersion string          `json:"@schema_version"`
+	Files         []*LockFileFile `json:"files"`
+}
+
+// LockFileFile is a file managed by rpack.
+type LockFileFile struct {
+	// Path relative to the lockfile directory
+	Path string `json:"path"`
+	// Sha is the checksum of the written content
+	Sha string `json:"sha"`
+	// Algorithm of Sha, empty for sha256
+	Algorithm string `json:"algorithm,omitempty"`
+	// Pack that wrote the file, only set for multi-pack configs
+	Pack string `json:"pack,omitempty"`
+	// Blocks are the markers of the managed blocks of a file only partly managed by rpack,
+	// Sha is the checksum of the blocks then
+	Blocks []string `json:"blocks,omitempty"`
+}
+
+// IntegrityReport lists managed files changed outside of rpack.
+type IntegrityReport struct {
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// Clean reports if no managed file was modified or removed.
+func (r *IntegrityReport) Clean() bool {
+	return len(r.Modified) == 0 && len(r.Removed) == 0
+}
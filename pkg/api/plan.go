@@ -0,0 +1,58 @@
+package api
+
+// PlanSchemaVersion is the schema version of plans described by this package.
+const PlanSchemaVersion = "v1"
+
+// PlanAction describes what an apply would do with a target file.
+type PlanAction string
+
+// Plan actions.
+const (
+	PlanActionAdd       PlanAction = "add"
+	PlanActionModify    PlanAction = "modify"
+	PlanActionUnchanged PlanAction = "unchanged"
+	PlanActionRemove    PlanAction = "remove"
+)
+
+// Plan describes the changes an apply would perform on the target,
+// it is written by rpack run --dry-run --plan.
+type Plan struct {
+	SchemaVersion string        `json:"@schema_version"`
+	Files         []*PlanFile   `json:"files"`
+	Annotations   []*Annotation `json:"annotations,omitempty"`
+	// Protected lists paths the packs wrote or would remove that are protected by the config
+	Protected []string `json:"protected,omitempty"`
+}
+
+// PlanFile is a single planned change of a target file.
+type PlanFile struct {
+	Path   string     `json:"path"`
+	Pack   string     `json:"pack,omitempty"`
+	Action PlanAction `json:"action"`
+	// Managed reports if the existing file is tracked by the lockfile
+	Managed bool   `json:"managed"`
+	OldSha  string `json:"old_sha,omitempty"`
+	NewSha  string `json:"new_sha,omitempty"`
+	Binary  bool   `json:"binary,omitempty"`
+	// FormattingOnly marks unchanged files whose content differs
+	// only in ways ignored by the diff options
+	FormattingOnly bool   `json:"formatting_only,omitempty"`
+	Diff           string `json:"diff,omitempty"`
+}
+
+// Changed reports if applying the plan modifies the target.
+func (p *Plan) Changed() bool {
+	for _, f := range p.Files {
+		if f.Action != PlanActionUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// Annotation is a warning or file annotation reported by a script.
+type Annotation struct {
+	Pack    string `json:"pack,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"io/fs"
+	"log/slog"
+	"time"
+)
+
+// RunOptions configures a run of a config.
+type RunOptions struct {
+	// ConfigFile is the path of the *.rpack.yaml file to run
+	ConfigFile string
+	// Config is the content of the config, read from ConfigFile if nil.
+	// ConfigFile still locates the config: the lockfile, the cache and relative paths are next to it
+	Config []byte
+	// Sources maps sources of packs, as written in the config, to filesystems the definition
+	// is read from instead of fetching it, e.g. an embed.FS shipping definitions with a tool
+	Sources map[string]fs.FS
+	// Hooks are called during the run, optional
+	Hooks *RunHooks
+	// Logger receives the logs of the run instead of slog.Default(), optional.
+	// Script output is tagged with the pack name for configs with several packs
+	Logger *slog.Logger
+	// ExecPath overrides the target directory, defaults to the directory of the config
+	ExecPath string
+	// OutputDir writes the generated files to this directory instead of the target
+	OutputDir string
+	// DryRun computes the changes without modifying the target,
+	// the result contains the plan
+	DryRun bool
+	// Force overwrites and removes files modified outside of rpack
+	Force bool
+	// Merge merges modifications of managed files into the generated content instead of failing,
+	// conflicts are applied with conflict markers
+	Merge bool
+	// AllowVerify lists the programs verify commands of the config may run
+	AllowVerify []string
+	// NoVerify skips the verify commands of the config
+	NoVerify bool
+	// AllowPostApply lists the programs post-apply commands of the config may run
+	AllowPostApply []string
+	// NoPostApply skips the post-apply commands of the config
+	NoPostApply bool
+	// AllowNotify lists the hosts the notify webhook of the config may post to
+	AllowNotify []string
+	// VerifyIdempotent runs each script twice and fails if the outputs differ
+	VerifyIdempotent bool
+	// NoGitIgnore does not add rpack internals to the .gitignore file of the target
+	NoGitIgnore bool
+	// Strict fails on ambiguous script behavior instead of warning, e.g. conflicting writes
+	Strict bool
+	// Lenient ignores unknown fields in the config, definitions and lockfile instead of failing
+	Lenient bool
+	// LintTemplates fails templates referencing missing data and warns about unused data
+	LintTemplates bool
+	// Timestamp pins the clock of scripts for reproducible output, the current time if zero
+	Timestamp time.Time
+	// Reproducible pins the clock to Timestamp or the Unix epoch, seeds math.random
+	// and hides the host name, so scripts produce the same output on every run
+	Reproducible bool
+	// Parallel is the number of packs executed at once, packs run one after another if it is below 2
+	Parallel int
+	// MaxFileSize is the maximum size in bytes of a file a script writes, 0 for no limit
+	MaxFileSize int64
+	// MaxTotalSize is the maximum size in bytes of all files the script of a pack writes, 0 for no limit
+	MaxTotalSize int64
+	// GitDirty warns ("warn") or fails ("fail") if the apply would overwrite or remove files
+	// with uncommitted changes in git, empty disables the check
+	GitDirty string
+	// DefCacheDir is the directory of the definition cache shared across targets, empty disables it
+	DefCacheDir string
+	// DefCacheTTL reuses cached definitions of sources that are not pinned if fetched within the TTL
+	DefCacheTTL time.Duration
+	// NotifyWebhooks are posted the run report after a successful apply, in addition to the webhook of the config
+	NotifyWebhooks []string
+	// NotifyCommand is run with the run report on stdin after a successful apply, without a shell
+	NotifyCommand []string
+	// Script selects the entry script of a single source config, overriding the script of the config
+	Script string
+}
+
+// RunHooks are called synchronously and never concurrently, all hooks are optional.
+// With Parallel they are called from the goroutines executing the packs.
+type RunHooks struct {
+	// FileAccess is called before a script accesses a file, an error denies the access and fails the run
+	FileAccess func(access *FileAccess) error
+	// Progress receives the progress of fetching, executing, checksumming and transferring,
+	// like rpack run --progress
+	Progress func(event *ProgressEvent)
+}
+
+// FileAccess is a file access of a script, like a record of the audit log.
+type FileAccess struct {
+	// Pack is the name of the pack, empty for single source configs
+	Pack string `json:"pack,omitempty"`
+	// Access is one of read, write, stat, readdir and remove, a rename is a remove followed by a write
+	Access       string `json:"access"`
+	Resolver     string `json:"resolver"`
+	FriendlyPath string `json:"friendly_path"`
+	// Path is the absolute path the friendly path resolved to,
+	// for target files the path in the target directory
+	Path string `json:"path"`
+}
+
+// ProgressEvent is the progress of a phase of a run.
+type ProgressEvent struct {
+	// Phase is one of fetch, exec, checksum and transfer
+	Phase string `json:"phase"`
+	// Pack is the name of the pack, empty for single source configs and phases covering all packs
+	Pack string `json:"pack,omitempty"`
+	// Current is the number of processed items
+	Current int `json:"current"`
+	// Total is the number of items, 0 if unknown
+	Total int `json:"total"`
+	// Item is the source or file being processed, optional
+	Item string `json:"item,omitempty"`
+	// Done is set on the last event of a phase
+	Done bool `json:"done,omitempty"`
+}
+
+// RunResult describes a completed run.
+type RunResult struct {
+	// Files written to the target, or that would be written on dry-run, sorted
+	Files []string `json:"files"`
+	// Added and Removed list the changes of the managed files compared to the lockfile
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	// Kept lists files left unchanged because they are semantically equal
+	Kept []string `json:"kept,omitempty"`
+	// Protected lists files left untouched because the config protects them
+	Protected []string `json:"protected,omitempty"`
+	// Merged lists files whose local modifications were merged into the generated content,
+	// Conflicts the merged files holding conflict markers
+	Merged      []string      `json:"merged,omitempty"`
+	Conflicts   []string      `json:"conflicts,omitempty"`
+	Annotations []*Annotation `json:"annotations,omitempty"`
+	// PostApply holds the results of the post-apply commands run, up to the first failure
+	PostApply []*CommandResult `json:"post_apply,omitempty"`
+	// Plan is set on dry-run
+	Plan *Plan `json:"plan,omitempty"`
+	// Timings are the durations of the phases of the run in the order they finished
+	Timings []*PhaseTiming `json:"timings,omitempty"`
+}
+
+// PhaseTiming is the duration of a phase of a run.
+type PhaseTiming struct {
+	// Phase is one of fetch, validate, exec, checksum and apply
+	Phase string `json:"phase"`
+	// Pack is the name of the pack, empty for single source configs and phases covering all packs
+	Pack       string `json:"pack,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// CommandResult is the outcome of a command run by rpack.
+type CommandResult struct {
+	Name string `json:"name"`
+	// Output holds stdout and stderr of the command
+	Output     string `json:"output"`
+	DurationMs int64  `json:"duration_ms"`
+	// Error describes the failure of the command, empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,88 @@
+// Package cmd implements the bisect command.
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// bisectCmd represents the bisect command
+var bisectCmd = &cobra.Command{
+	Use:   "bisect <config-file> --good <ref> --file <path> [--bad <ref>] [--match <glob|string>]",
+	Short: "Find the pack source revision that changed a generated file",
+	Long: `Bisect walks the git revisions of a pack source between a good and a bad ref,
+renders each tested revision like a dry-run and reports the first revision
+where the target file changed.
+
+Without --match every change of the file compared to the good revision counts.
+With --match a revision is bad if a line of the file matches the glob
+(* and ? wildcards) or the file contains the string.
+
+  rpack bisect ./app.rpack.yaml --good v1.2.0 --bad v1.3.0 --file config/app.yaml --match 'timeout: *'`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var opts rpack.BisectOptions
+		var err error
+		if opts.Good, err = cmd.Flags().GetString("good"); err != nil {
+			return err
+		}
+		if opts.Bad, err = cmd.Flags().GetString("bad"); err != nil {
+			return err
+		}
+		if opts.File, err = cmd.Flags().GetString("file"); err != nil {
+			return err
+		}
+		if opts.Match, err = cmd.Flags().GetString("match"); err != nil {
+			return err
+		}
+		if opts.Pack, err = cmd.Flags().GetString("pack"); err != nil {
+			return err
+		}
+		if opts.Good == "" || opts.File == "" {
+			return fmt.Errorf("--good and --file are required")
+		}
+
+		e := &rpack.Executor{}
+		if e.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
+		flagWD, err := cmd.Flags().GetString("working-dir")
+		if err != nil {
+			return err
+		}
+		if flagWD != "" {
+			e.OverrideExecPath = flagWD
+		}
+
+		res, err := e.Bisect(cmd.Context(), args[0], opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "First bad revision: %s\n", res.Revision)
+		fmt.Fprintf(os.Stdout, "    %s\n", res.Subject)
+		fmt.Fprintf(os.Stdout, "    Author: %s\n", res.Author)
+		fmt.Fprintf(os.Stdout, "    Date:   %s\n", res.Date)
+		fmt.Fprintf(os.Stdout, "Last good revision: %s\n", res.LastGood)
+		fmt.Fprintf(os.Stdout, "Rendered %d of %d revisions.\n", res.Tested, res.Candidates+1)
+		if res.Diff != "" {
+			fmt.Fprintf(os.Stdout, "\n%s", rpack.RedactSecrets(res.Diff))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bisectCmd)
+
+	bisectCmd.Flags().StringP("good", "", "", "Revision rendering the file as expected (required)")
+	bisectCmd.Flags().StringP("bad", "", "", "Revision showing the change, defaults to the ref of the source or HEAD")
+	bisectCmd.Flags().StringP("file", "", "", "Target file to inspect, relative to the working directory (required)")
+	bisectCmd.Flags().StringP("match", "", "", "Glob or string a line of the file matches at bad revisions")
+	bisectCmd.Flags().StringP("pack", "", "", "Pack to bisect in a multi-pack config")
+	bisectCmd.Flags().StringP("working-dir", "w", "", "Override working directory")
+}
@@ -0,0 +1,176 @@
+// Package cmd implements the cache command.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and clean the .rpack.d cache",
+	Long: `Every source gets a cache entry below .rpack.d/<sha256 of source>/ holding the fetched
+definition and the run and temp dirs of the configs using it. Entries of sources that are
+no longer used by any config are not removed automatically.
+
+Entries are referenced if a *.rpack.yaml in the working dir, or one of the configs passed
+with --config, uses their source.
+
+Gc and purge also clean the definition cache shared by all targets, see --def-cache-dir.`,
+}
+
+// cacheListCmd lists the cache entries.
+var cacheListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List cache entries, most recently used first",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		wd, configs, err := cacheFlags(cmd)
+		if err != nil {
+			return err
+		}
+		lenient, err := cmd.Flags().GetBool("lenient")
+		if err != nil {
+			return err
+		}
+		entries, err := rpack.Loader{Lenient: lenient}.ListCache(wd, configs)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			source := e.Source
+			if !e.Referenced() {
+				source = "(unreferenced)"
+			}
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\n", e.Key[:12], formatSize(e.Size), e.LastUsed.Format(time.DateTime), source)
+		}
+		return nil
+	},
+}
+
+// cacheGCCmd removes unreferenced and expired cache entries.
+var cacheGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove unreferenced and expired cache entries",
+	Long: `Gc removes cache entries whose source is not used by any config, and entries not
+used for longer than --ttl. Removed entries are fetched again when needed.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		opts := rpack.CacheGCOptions{}
+		var err error
+		if opts.Dir, opts.ConfigFiles, err = cacheFlags(cmd); err != nil {
+			return err
+		}
+		if opts.TTL, err = cmd.Flags().GetDuration("ttl"); err != nil {
+			return err
+		}
+		if opts.DryRun, err = cmd.Flags().GetBool("dry-run"); err != nil {
+			return err
+		}
+		if opts.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
+		removed, err := rpack.GCCache(opts)
+		if err != nil {
+			printRemovedCacheEntries(removed, opts.DryRun)
+			return err
+		}
+		defCacheDir, err := cmd.Flags().GetString("def-cache-dir")
+		if err != nil {
+			return err
+		}
+		if defCacheDir != "" {
+			defRemoved, defErr := rpack.GCDefCache(defCacheDir, opts.TTL, opts.DryRun)
+			removed, err = append(removed, defRemoved...), defErr
+		}
+		printRemovedCacheEntries(removed, opts.DryRun)
+		return err
+	},
+}
+
+// cachePurgeCmd removes all cache entries.
+var cachePurgeCmd = &cobra.Command{
+	Use:          "purge",
+	Short:        "Remove all cache entries, run reports are kept",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		wd, _, err := cacheFlags(cmd)
+		if err != nil {
+			return err
+		}
+		removed, err := rpack.PurgeCache(wd)
+		if err != nil {
+			printRemovedCacheEntries(removed, false)
+			return err
+		}
+		defCacheDir, err := cmd.Flags().GetString("def-cache-dir")
+		if err != nil {
+			return err
+		}
+		if defCacheDir != "" {
+			defRemoved, defErr := rpack.PurgeDefCache(defCacheDir)
+			removed, err = append(removed, defRemoved...), defErr
+		}
+		printRemovedCacheEntries(removed, false)
+		return err
+	},
+}
+
+func cacheFlags(cmd *cobra.Command) (wd string, configs []string, err error) {
+	if wd, err = cmd.Flags().GetString("working-dir"); err != nil {
+		return "", nil, err
+	}
+	if configs, err = cmd.Flags().GetStringArray("config"); err != nil {
+		return "", nil, err
+	}
+	return wd, configs, nil
+}
+
+func printRemovedCacheEntries(removed []*rpack.CacheEntry, dryRun bool) {
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	var size int64
+	for _, e := range removed {
+		size += e.Size
+		fmt.Fprintf(os.Stdout, "%s %s\t%s\n", verb, e.Key[:12], formatSize(e.Size))
+	}
+	fmt.Fprintf(os.Stdout, "%s %d entries, %s\n", verb, len(removed), formatSize(size))
+}
+
+// formatSize formats a size in bytes using binary units.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cacheGCCmd)
+	cacheCmd.AddCommand(cachePurgeCmd)
+
+	cacheCmd.PersistentFlags().StringP("working-dir", "w", ".", "Directory containing the .rpack.d cache")
+	cacheCmd.PersistentFlags().StringArrayP("config", "c", nil, "Config using the cache outside the working dir, can be repeated")
+	cacheCmd.PersistentFlags().StringP("def-cache-dir", "", rpack.DefaultDefCacheDir(), "Directory of the definition cache shared by all targets, empty leaves it alone, see "+rpack.DefCacheDirEnv)
+	cacheGCCmd.Flags().DurationP("ttl", "", 30*24*time.Hour, "Remove entries not used for longer, 0 disables expiry")
+	cacheGCCmd.Flags().BoolP("dry-run", "", false, "Only print the entries that would be removed")
+}
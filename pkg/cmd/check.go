@@ -3,6 +3,7 @@ package cmd
 
 import (
 	"context"
+	"os"
 
 	"github.com/spf13/cobra"
 
@@ -22,10 +23,24 @@ var checkCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if c.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
 		if flagWD != "" {
 			c.OverrideExecPath = flagWD
 		}
 
+		flagDiff, err := cmd.Flags().GetBool("diff")
+		if err != nil {
+			return err
+		}
+		if flagDiff {
+			c.DiffOutput = os.Stdout
+		}
+		if c.Strict, err = cmd.Flags().GetBool("strict"); err != nil {
+			return err
+		}
+
 		err = c.CheckIntegrity(context.TODO(), args[0])
 		if err != nil {
 			return err
@@ -37,5 +52,7 @@ var checkCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(checkCmd)
 
+	checkCmd.Flags().BoolP("diff", "", false, "Print the diffs of modified files against the content rpack generated")
+	checkCmd.Flags().BoolP("strict", "", false, "Also execute the config as dry-run and fail if the target is out of date relative to the definition")
 	checkCmd.PersistentFlags().StringP("working-dir", "w", "", "Override working dir, defaults to location of rpack file")
 }
@@ -0,0 +1,208 @@
+// Package cmd implements the ci command.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// ciCmd represents the ci command
+var ciCmd = &cobra.Command{
+	Use:   "ci [--mode auto|check|apply] [<config-file|dir>...]",
+	Short: "Check or apply the configs of a workspace in CI",
+	Long: `CI runs every config below the given directories, the current directory by default,
+as a single CI step.
+
+In check mode, for pull requests, files modified outside of rpack and target files
+differing from the generated content are reported as annotations with their diffs.
+The command fails with exit code 10 if the target drifted, 4 if managed files were modified.
+
+In apply mode the configs are applied and the changes committed, with --push
+they are pushed to the branch of the job.
+
+--mode auto detects the job from the environment of GitHub Actions and GitLab CI:
+pull and merge requests are checked, pushes to the branches of --apply-branch are applied,
+everything else is checked.
+
+  rpack ci
+  rpack ci --mode apply --push ./deploy`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flagMode, err := cmd.Flags().GetString("mode")
+		if err != nil {
+			return err
+		}
+		applyBranches, err := cmd.Flags().GetStringSlice("apply-branch")
+		if err != nil {
+			return err
+		}
+		flagAnnotations, err := cmd.Flags().GetString("annotations")
+		if err != nil {
+			return err
+		}
+		env := rpack.DetectCIEnv(os.Getenv)
+		mode := rpack.CIMode(flagMode)
+		switch flagMode {
+		case "auto":
+			mode = env.Mode(applyBranches)
+		case string(rpack.CIModeCheck), string(rpack.CIModeApply):
+		default:
+			return fmt.Errorf("invalid mode %q, expected auto, check or apply", flagMode)
+		}
+		annotations := flagAnnotations
+		if annotations == "auto" {
+			annotations = "plain"
+			if env.Provider == rpack.CIProviderGitHub {
+				annotations = "github"
+			}
+		}
+		if annotations != "github" && annotations != "plain" {
+			return fmt.Errorf("invalid annotations %q, expected auto, github or plain", flagAnnotations)
+		}
+
+		configs, err := ciConfigs(args)
+		if err != nil {
+			return err
+		}
+		slog.Info("Running rpack ci", "mode", mode, "provider", env.Provider, "branch", env.Branch, "configs", len(configs))
+
+		e := &rpack.Executor{}
+		if e.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
+		if e.AllowVerify, err = cmd.Flags().GetStringSlice("allow-verify"); err != nil {
+			return err
+		}
+		if e.AllowPostApply, err = cmd.Flags().GetStringSlice("allow-post-apply"); err != nil {
+			return err
+		}
+		if e.AllowNotify, err = cmd.Flags().GetStringSlice("allow-notify"); err != nil {
+			return err
+		}
+		if mode == rpack.CIModeCheck {
+			findings, err := e.CICheck(cmd.Context(), configs)
+			printCIFindings(os.Stdout, annotations, findings)
+			return err
+		}
+
+		noCommit, err := cmd.Flags().GetBool("no-commit")
+		if err != nil {
+			return err
+		}
+		var commit *rpack.CICommit
+		if !noCommit {
+			commit = &rpack.CICommit{Dir: ".", Branch: env.Branch}
+			if commit.Message, err = cmd.Flags().GetString("commit-message"); err != nil {
+				return err
+			}
+			if commit.Push, err = cmd.Flags().GetBool("push"); err != nil {
+				return err
+			}
+		}
+		rev, err := e.CIApply(cmd.Context(), configs, commit)
+		if err != nil {
+			return err
+		}
+		if rev != "" {
+			fmt.Println(rev)
+		}
+		return nil
+	},
+}
+
+// ciConfigs resolves the arguments of rpack ci to config files, directories are searched recursively.
+func ciConfigs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var configs []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			configs = append(configs, arg)
+			continue
+		}
+		found, err := rpack.FindRPackConfigs(arg)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, found...)
+	}
+	return configs, nil
+}
+
+// printCIFindings writes the findings as GitHub workflow commands or plain lines, followed by their diffs.
+// Paths are relative to the working directory, the root of the repository in CI.
+func printCIFindings(w io.Writer, format string, findings []*rpack.CIFinding) {
+	wd, _ := os.Getwd()
+	for _, f := range findings {
+		path := f.Path
+		if path == "" {
+			path = f.Config
+		}
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		path = filepath.ToSlash(path)
+		level := "error"
+		if f.Warning {
+			level = "warning"
+		}
+		// Generated content may hold secrets read by the scripts
+		diff := rpack.RedactSecrets(f.Diff)
+		if format == "github" {
+			_, _ = fmt.Fprintf(w, "::%s file=%s,title=rpack::%s\n", level, escapeGitHubProperty(path), escapeGitHubData(f.Message))
+			if diff != "" {
+				_, _ = fmt.Fprintf(w, "::group::diff %s\n%s::endgroup::\n", escapeGitHubData(path), ensureNewline(diff))
+			}
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s: %s: %s\n", path, level, f.Message)
+		if diff != "" {
+			_, _ = fmt.Fprint(w, ensureNewline(diff))
+		}
+	}
+}
+
+// escapeGitHubData escapes the message of a workflow command.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a property value of a workflow command.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(escapeGitHubData(s))
+}
+
+// ensureNewline appends a newline to s unless it ends with one.
+func ensureNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
+
+func init() {
+	rootCmd.AddCommand(ciCmd)
+
+	ciCmd.Flags().StringP("mode", "", "auto", "check, apply or auto to detect the mode from the CI environment")
+	ciCmd.Flags().StringSliceP("apply-branch", "", []string{"main", "master"}, "Branches applied by --mode auto")
+	ciCmd.Flags().StringP("annotations", "", "auto", "Format of check findings: github, plain or auto")
+	ciCmd.Flags().StringSliceP("allow-verify", "", nil, "Allow the verify commands of the configs to run this program (repeatable)")
+	ciCmd.Flags().StringSliceP("allow-post-apply", "", nil, "Allow the post-apply commands of the configs to run this program (repeatable)")
+	ciCmd.Flags().StringSliceP("allow-notify", "", nil, "Allow the notify webhooks of the configs to post to this host (repeatable)")
+	ciCmd.Flags().BoolP("no-commit", "", false, "Apply without committing the changes")
+	ciCmd.Flags().StringP("commit-message", "", "Apply rpack changes", "Message of the commit of the applied changes")
+	ciCmd.Flags().BoolP("push", "", false, "Push the commit of the applied changes to the branch of the job")
+}
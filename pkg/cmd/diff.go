@@ -0,0 +1,86 @@
+// Package cmd implements the diff command.
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [--tool <cmd>] <config-file>",
+	Short: "Show the changes a run would apply",
+	Long: `Diff executes the rpack like a dry-run and shows the changes of every
+target file as unified diff.
+
+With --tool each changed file is passed to an external diff tool instead.
+The paths of the current and the generated content are appended to the command,
+for added or removed files /dev/null is passed:
+
+  rpack diff --tool delta ./app.rpack.yaml
+  rpack diff --tool "difft --color=always" ./app.rpack.yaml
+
+Formatting differences can be ignored with --ignore-trailing-whitespace,
+--ignore-eol and --semantic, which compares JSON and YAML files by structure.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tool, err := cmd.Flags().GetString("tool")
+		if err != nil {
+			return err
+		}
+		e := &rpack.Executor{DryRun: true}
+		if e.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
+		if e.DiffOptions, err = diffOptionsFromFlags(cmd); err != nil {
+			return err
+		}
+		if tool != "" {
+			e.DiffRenderer = &rpack.ExternalDiffRenderer{Command: tool}
+		} else {
+			e.DiffRenderer = &rpack.UnifiedDiffRenderer{}
+		}
+
+		flagWD, err := cmd.Flags().GetString("working-dir")
+		if err != nil {
+			return err
+		}
+		if flagWD != "" {
+			e.OverrideExecPath = flagWD
+		}
+		return e.ExecRPack(cmd.Context(), args[0])
+	},
+}
+
+// addDiffOptionFlags registers the flags controlling which differences count as changes.
+func addDiffOptionFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("ignore-trailing-whitespace", "", false, "Ignore whitespace at the end of lines")
+	cmd.Flags().BoolP("ignore-eol", "", false, "Ignore line ending differences (CRLF/LF, final newline)")
+	cmd.Flags().BoolP("semantic", "", false, "Compare JSON and YAML files by their parsed structure")
+}
+
+// diffOptionsFromFlags reads the flags registered by addDiffOptionFlags.
+func diffOptionsFromFlags(cmd *cobra.Command) (rpack.DiffOptions, error) {
+	var opts rpack.DiffOptions
+	var err error
+	if opts.IgnoreTrailingWhitespace, err = cmd.Flags().GetBool("ignore-trailing-whitespace"); err != nil {
+		return opts, err
+	}
+	if opts.IgnoreEOL, err = cmd.Flags().GetBool("ignore-eol"); err != nil {
+		return opts, err
+	}
+	if opts.Semantic, err = cmd.Flags().GetBool("semantic"); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringP("tool", "", "", "External diff tool, e.g. delta or difft")
+	diffCmd.Flags().StringP("working-dir", "w", "", "Override working dir, defaults to location of rpack file")
+	addDiffOptionFlags(diffCmd)
+}
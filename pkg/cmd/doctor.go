@@ -0,0 +1,58 @@
+// Package cmd implements the doctor command.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [<config-file>]",
+	Short: "Diagnose problems of the environment",
+	Long: `Doctor checks the environment rpack runs in and prints fixes for the problems found:
+cache and temp directory writability, git availability, filesystem case sensitivity
+and path length limits.
+
+With a config file the schema versions of the config, lockfile and fetched definitions
+are checked, as well as support for the protocols of its sources.
+
+Doctor exits with an error if any check failed, warnings do not fail.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var opts rpack.DoctorOptions
+		var err error
+		if opts.Dir, err = cmd.Flags().GetString("working-dir"); err != nil {
+			return err
+		}
+		if opts.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
+		if len(args) > 0 {
+			opts.ConfigFile = args[0]
+		}
+
+		checks := rpack.RunDoctor(cmd.Context(), opts)
+		failed := 0
+		for _, c := range checks {
+			fmt.Println(c)
+			if c.Status == rpack.DoctorFail {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringP("working-dir", "w", "", "Override working dir, defaults to location of rpack file")
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// Exit codes of the CLI, scripts can branch on the cause of a failure.
+const (
+	ExitOK = 0
+	// ExitError is any failure without a more specific code
+	ExitError = 1
+	// ExitCrash is a panic or internal error, a crash report was written
+	ExitCrash = 2
+	// ExitValidation is an invalid config, definition, lockfile, values or inputs
+	ExitValidation = 3
+	// ExitLockModified is a file tracked by the lockfile that was modified or removed outside of rpack
+	ExitLockModified = 4
+	// ExitPurityViolation is a script that accessed files it did not declare
+	ExitPurityViolation = 5
+	// ExitSourceFetch is a definition source that could not be fetched
+	ExitSourceFetch = 6
+	// ExitVerifyFailed is a failed verify command, the apply was rolled back
+	ExitVerifyFailed = 7
+	// ExitInputChanged is an input file modified by another process while rpack was running
+	ExitInputChanged = 8
+	// ExitMergeConflict is a merged file with conflict markers, see run --merge
+	ExitMergeConflict = 9
+	// ExitDrift is a target differing from the generated files, see rpack ci and rpack check --strict
+	ExitDrift = 10
+	// ExitGitDirty is a target file with uncommitted changes the apply would overwrite, see run --git-dirty
+	ExitGitDirty = 11
+	// ExitCanceled is a run interrupted by SIGINT or SIGTERM, changes to the target were rolled back
+	ExitCanceled = 12
+)
+
+// exitCode maps err to the exit code of the CLI.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, context.Canceled):
+		return ExitCanceled
+	case errors.Is(err, rpack.ErrLockModified):
+		return ExitLockModified
+	case errors.Is(err, rpack.ErrPurityViolation):
+		return ExitPurityViolation
+	case errors.Is(err, rpack.ErrValidation):
+		return ExitValidation
+	case errors.Is(err, rpack.ErrSourceFetch):
+		return ExitSourceFetch
+	case errors.Is(err, rpack.ErrVerifyFailed):
+		return ExitVerifyFailed
+	case errors.Is(err, rpack.ErrInputChanged):
+		return ExitInputChanged
+	case errors.Is(err, rpack.ErrMergeConflict):
+		return ExitMergeConflict
+	case errors.Is(err, rpack.ErrDrift):
+		return ExitDrift
+	case errors.Is(err, rpack.ErrGitDirty):
+		return ExitGitDirty
+	}
+	return ExitError
+}
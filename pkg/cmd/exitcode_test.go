@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+func TestExitCode(t *testing.T) {
+	tcs := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: ExitOK},
+		{name: "generic", err: errors.New("boom"), want: ExitError},
+		{name: "lua", err: fmt.Errorf("run: %w", rpack.ErrLuaExecution), want: ExitError},
+		{name: "validation", err: fmt.Errorf("config: %w", rpack.ErrValidation), want: ExitValidation},
+		{name: "schema", err: fmt.Errorf("values: %w: details", rpack.ErrSchemaValidation), want: ExitValidation},
+		{name: "input", err: fmt.Errorf("inputs: %w", rpack.ErrInputValidation), want: ExitValidation},
+		{name: "lock", err: fmt.Errorf("check: %w", rpack.ErrLockModified), want: ExitLockModified},
+		{name: "purity", err: fmt.Errorf("exec: %w", rpack.ErrPurityViolation), want: ExitPurityViolation},
+		{name: "not idempotent", err: fmt.Errorf("exec: %w", rpack.ErrNotIdempotent), want: ExitPurityViolation},
+		{name: "fetch", err: fmt.Errorf("load: %w", rpack.ErrSourceFetch), want: ExitSourceFetch},
+		{name: "verify", err: fmt.Errorf("apply: %w", rpack.ErrVerifyFailed), want: ExitVerifyFailed},
+		{name: "input changed", err: fmt.Errorf("apply: %w", rpack.ErrInputChanged), want: ExitInputChanged},
+		{name: "merge conflict", err: fmt.Errorf("apply: %w", rpack.ErrMergeConflict), want: ExitMergeConflict},
+		{name: "drift", err: fmt.Errorf("ci: %w", rpack.ErrDrift), want: ExitDrift},
+		{name: "git dirty", err: fmt.Errorf("apply: %w", rpack.ErrGitDirty), want: ExitGitDirty},
+		{name: "canceled", err: errors.Join(fmt.Errorf("apply: %w", context.Canceled), rpack.ErrVerifyFailed), want: ExitCanceled},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.err); got != tc.want {
+				t.Errorf("Expected exit code %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
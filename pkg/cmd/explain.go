@@ -0,0 +1,53 @@
+// Package cmd implements the explain command.
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain [--diff] <file>",
+	Short: "Show which rpack config manages a file",
+	Long: `Explain looks up a file in the lockfiles of the configs in its directory
+and the parent directories up to the repository root. For each config managing
+the file it prints the config, the pack and source of the definition, the
+checksum recorded in the lockfile and whether the file was modified or removed
+outside of rpack.
+
+Explain fails if no lockfile manages the file.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flagDiff, err := cmd.Flags().GetBool("diff")
+		if err != nil {
+			return err
+		}
+		lenient, err := cmd.Flags().GetBool("lenient")
+		if err != nil {
+			return err
+		}
+		exs, err := rpack.Loader{Lenient: lenient}.Explain(args[0])
+		if err != nil {
+			return err
+		}
+		for _, ex := range exs {
+			fmt.Fprint(os.Stdout, ex)
+			if flagDiff && ex.Diff != "" {
+				fmt.Fprintf(os.Stdout, "\n%s", rpack.RedactSecrets(ex.Diff))
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+
+	explainCmd.Flags().BoolP("diff", "", false, "Print the diff of a drifted file against the content rpack generated")
+}
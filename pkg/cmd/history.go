@@ -0,0 +1,99 @@
+// Package cmd implements the history command.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// historyDigestLen is the number of characters of the source digests printed.
+const historyDigestLen = 12
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history [<config-file>]",
+	Short: "Show the history of runs against the target",
+	Long: `Every run against the target, failed runs included, appends a summary to
+.rpack.d/history/<config>.jsonl: the time, the digest of each definition, the
+number of added, changed and removed files and the error of a failed run.
+Without a config file the history of all configs in the working directory is shown.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		wd, err := cmd.Flags().GetString("working-dir")
+		if err != nil {
+			return err
+		}
+		limit, err := cmd.Flags().GetInt("limit")
+		if err != nil {
+			return err
+		}
+		var configs []string
+		if len(args) > 0 {
+			if !cmd.Flags().Changed("working-dir") {
+				wd = filepath.Dir(args[0])
+			}
+			configs = []string{rpack.HistoryConfigName(args[0])}
+		} else if configs, err = rpack.HistoryConfigs(wd); err != nil {
+			return err
+		}
+		for i, config := range configs {
+			entries, err := rpack.LoadHistory(wd, config)
+			if err != nil {
+				return fmt.Errorf("could not read history of %s: %w", config, err)
+			}
+			if len(configs) > 1 {
+				if i > 0 {
+					fmt.Fprintln(os.Stdout)
+				}
+				fmt.Fprintf(os.Stdout, "%s:\n", config)
+			}
+			if limit > 0 && len(entries) > limit {
+				entries = entries[len(entries)-limit:]
+			}
+			for _, entry := range entries {
+				fmt.Fprintln(os.Stdout, formatHistoryEntry(entry))
+			}
+		}
+		return nil
+	},
+}
+
+// formatHistoryEntry formats a run as a single line.
+func formatHistoryEntry(entry *rpack.HistoryEntry) string {
+	status := "ok"
+	if !entry.Success {
+		status = "failed"
+	}
+	sources := make([]string, len(entry.Packs))
+	for i, p := range entry.Packs {
+		digest := p.SourceDigest
+		if len(digest) > historyDigestLen {
+			digest = digest[:historyDigestLen]
+		}
+		if p.Name != "" {
+			digest = p.Name + "=" + digest
+		}
+		sources[i] = digest
+	}
+	line := fmt.Sprintf("%s\t%s\t+%d ~%d -%d\t%dms\t%s", entry.Time.Local().Format(time.DateTime), status,
+		entry.Added, entry.Changed, entry.Removed, entry.DurationMs, strings.Join(sources, ","))
+	if entry.Error != "" {
+		line += "\t" + strings.ReplaceAll(entry.Error, "\n", " ")
+	}
+	return line
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().StringP("working-dir", "w", ".", "Directory containing the .rpack.d state")
+	historyCmd.Flags().IntP("limit", "n", 20, "Show only the most recent runs of each config, 0 shows all")
+}
@@ -0,0 +1,64 @@
+// Package cmd implements the lint command.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// lintCmd represents the lint command.
+var lintCmd = &cobra.Command{
+	Use:   "lint --def <dir>",
+	Short: "Statically check an rpack definition",
+	Long: `Lint checks a definition directory without executing it and reports all issues:
+
+- rpack.yaml is validated against the schema
+- schema.cue or schema.json is compiled
+- script.lua is parsed for syntax errors and reads of inputs not declared in rpack.yaml
+- the definition and its inputs have descriptions (warning)
+
+Inputs are found by constant names, like rpack.read("map:name/file") or
+rpack.inputs().name, names built at runtime are not checked.
+
+Exits non-zero if any error is found, warnings do not fail unless --strict is set.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		defDir, err := cmd.Flags().GetString("def")
+		if err != nil {
+			return err
+		}
+		if defDir == "" {
+			return cmd.Usage()
+		}
+		strict, err := cmd.Flags().GetBool("strict")
+		if err != nil {
+			return err
+		}
+		errs, warnings := 0, 0
+		for _, issue := range rpack.LintRPackDef(defDir) {
+			fmt.Println(issue)
+			if issue.Severity == rpack.LintError {
+				errs++
+			} else {
+				warnings++
+			}
+		}
+		if errs > 0 || (strict && warnings > 0) {
+			return fmt.Errorf("%d errors, %d warnings: %w", errs, warnings, rpack.ErrValidation)
+		}
+		if warnings == 0 {
+			fmt.Println("No issues found.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+	lintCmd.Flags().StringP("def", "d", "", "Path to rpack definition directory")
+	lintCmd.Flags().BoolP("strict", "", false, "Fail on warnings as well")
+}
@@ -0,0 +1,93 @@
+// Package cmd implements the preview command.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// previewCmd represents the preview command
+var previewCmd = &cobra.Command{
+	Use:   "preview [--addr <host:port>] <config-file>",
+	Short: "Serve the files a run would generate for review",
+	Long: `Preview executes the rpack like a dry-run and serves the generated files
+over a local HTTP server until interrupted.
+
+The index lists every file with its planned action. Generated files are served
+under /files/ with their content type, so relative links of generated sites and
+documentation work. Each file has a diff view against the current target.
+
+  rpack preview ./docs.rpack.yaml
+  rpack preview --addr 127.0.0.1:9000 ./docs.rpack.yaml`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, err := cmd.Flags().GetString("addr")
+		if err != nil {
+			return err
+		}
+		preview := &rpack.Preview{}
+		e := &rpack.Executor{DryRun: true, DiffRenderer: preview}
+		if e.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
+		if e.DiffOptions, err = diffOptionsFromFlags(cmd); err != nil {
+			return err
+		}
+		flagWD, err := cmd.Flags().GetString("working-dir")
+		if err != nil {
+			return err
+		}
+		if flagWD != "" {
+			e.OverrideExecPath = flagWD
+		}
+		if err = e.ExecRPack(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+		return servePreview(ctx, addr, preview)
+	},
+}
+
+// servePreview serves the preview on addr until ctx is done.
+func servePreview(ctx context.Context, addr string, h http.Handler) error {
+	ln, err := (&net.ListenConfig{}).Listen(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", addr, err)
+	}
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Failed to stop preview server", "error", err)
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "Serving preview on http://%s/, press Ctrl+C to stop\n", ln.Addr())
+	if err = srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(previewCmd)
+
+	previewCmd.Flags().StringP("addr", "", "127.0.0.1:8080", "Address to serve the preview on")
+	previewCmd.Flags().StringP("working-dir", "w", "", "Override working dir, defaults to location of rpack file")
+	addDiffOptionFlags(previewCmd)
+}
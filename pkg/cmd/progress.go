@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// progressInterval throttles redraws of the progress bar.
+const progressInterval = 100 * time.Millisecond
+
+// progressBarWidth is the number of characters of the bar itself.
+const progressBarWidth = 30
+
+// progressItemWidth limits the length of the item, longer items keep their end.
+const progressItemWidth = 50
+
+// progressBar renders the progress of a run as a single line redrawn in place.
+// Without a terminal only the final line of each phase is written.
+type progressBar struct {
+	w        io.Writer
+	terminal bool
+	last     time.Time
+	drawn    bool
+}
+
+// Check progressBar satisfies ProgressReporter interface
+var _ = rpack.ProgressReporter(&progressBar{})
+
+// newProgressBar creates a progress bar writing to stderr.
+func newProgressBar() *progressBar {
+	return &progressBar{w: os.Stderr, terminal: isTerminal(os.Stderr)}
+}
+
+// isTerminal reports if f is a character device.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Progress draws ev, intermediate events are throttled.
+func (p *progressBar) Progress(ev rpack.ProgressEvent) {
+	if !ev.Done && (!p.terminal || time.Since(p.last) < progressInterval) {
+		return
+	}
+	p.last = time.Now()
+	line := formatProgress(ev)
+	if !p.terminal {
+		_, _ = fmt.Fprintln(p.w, line)
+		return
+	}
+	// Clear the line, the previous one may be longer
+	_, _ = fmt.Fprintf(p.w, "\r\033[K%s", line)
+	p.drawn = !ev.Done
+	if ev.Done {
+		_, _ = fmt.Fprintln(p.w)
+	}
+}
+
+// Finish clears an unfinished line, e.g. after a run failed.
+func (p *progressBar) Finish() {
+	if p.drawn {
+		_, _ = fmt.Fprint(p.w, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// formatProgress renders ev as a single line.
+func formatProgress(ev rpack.ProgressEvent) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-8s", ev.Phase)
+	if ev.Pack != "" {
+		fmt.Fprintf(&sb, " %s", ev.Pack)
+	}
+	if ev.Total > 0 {
+		filled := progressBarWidth * ev.Current / ev.Total
+		fmt.Fprintf(&sb, " [%s%s] %3d%% %d/%d", strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled), 100*ev.Current/ev.Total, ev.Current, ev.Total)
+	} else if ev.Phase == rpack.ProgressPhaseExec {
+		fmt.Fprintf(&sb, " %d writes", ev.Current)
+	}
+	if ev.Done {
+		sb.WriteString(" done")
+	} else if item := ev.Item; item != "" {
+		if len(item) > progressItemWidth {
+			item = "..." + item[len(item)-progressItemWidth+3:]
+		}
+		sb.WriteString(" " + item)
+	}
+	return sb.String()
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+func TestFormatProgress(t *testing.T) {
+	tests := []struct {
+		ev   rpack.ProgressEvent
+		want string
+	}{
+		{rpack.ProgressEvent{Phase: rpack.ProgressPhaseChecksum, Current: 5, Total: 10, Item: "a.txt"}, "checksum [===============               ]  50% 5/10 a.txt"},
+		{rpack.ProgressEvent{Phase: rpack.ProgressPhaseExec, Pack: "app", Current: 7, Item: "b.txt"}, "exec     app 7 writes b.txt"},
+		{rpack.ProgressEvent{Phase: rpack.ProgressPhaseFetch, Current: 1, Total: 1, Done: true}, "fetch    [==============================] 100% 1/1 done"},
+		{rpack.ProgressEvent{Phase: rpack.ProgressPhaseTransfer, Total: 2, Item: strings.Repeat("d/", 40) + "file.txt"}, "transfer [                              ]   0% 0/2 ..." + strings.Repeat("/d", 19) + "/file.txt"},
+	}
+	for _, tt := range tests {
+		if got := formatProgress(tt.ev); got != tt.want {
+			t.Errorf("formatProgress(%+v) = %q, want %q", tt.ev, got, tt.want)
+		}
+	}
+}
+
+func TestProgressBarWithoutTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	p := &progressBar{w: &buf}
+	p.Progress(rpack.ProgressEvent{Phase: rpack.ProgressPhaseChecksum, Current: 1, Total: 2})
+	p.Progress(rpack.ProgressEvent{Phase: rpack.ProgressPhaseChecksum, Current: 2, Total: 2, Done: true})
+	p.Finish()
+	if got := buf.String(); got != "checksum [==============================] 100% 2/2 done\n" {
+		t.Errorf("Expected only the final line, got %q", got)
+	}
+}
@@ -0,0 +1,58 @@
+// Package cmd implements the prune command.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune [--dry-run] [--force] <config-file>",
+	Short: "Remove tracked files the packs no longer generate",
+	Long: `Prune executes the rpack like a dry-run and removes the files tracked by the
+lockfile that are no longer generated, e.g. after files were dropped from a definition.
+Changed and new files are not written, the lockfile only loses the pruned files.
+
+Files modified outside of rpack are only removed with --force,
+--dry-run lists the files that would be pruned:
+
+  rpack prune --dry-run ./app.rpack.yaml`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		e := &rpack.Executor{}
+		var err error
+		if e.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
+		if e.DryRun, err = cmd.Flags().GetBool("dry-run"); err != nil {
+			return err
+		}
+		if e.Force, err = cmd.Flags().GetBool("force"); err != nil {
+			return err
+		}
+		if e.OverrideExecPath, err = cmd.Flags().GetString("working-dir"); err != nil {
+			return err
+		}
+		pruned, err := e.Prune(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		for _, p := range pruned {
+			fmt.Println(p)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().StringP("working-dir", "w", "", "Override working dir, defaults to location of rpack file")
+	pruneCmd.Flags().BoolP("force", "f", false, "Remove files modified outside of rpack")
+	pruneCmd.Flags().BoolP("dry-run", "", false, "Only list the files that would be pruned")
+}
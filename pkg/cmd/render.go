@@ -0,0 +1,58 @@
+// Package cmd implements the render command.
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// renderCmd represents the render command
+var renderCmd = &cobra.Command{
+	Use:   "render [--config <config-file>] <path>",
+	Short: "Print the generated content of a single file",
+	Long: `Render executes the rpack like a dry-run and prints the generated content of
+one output file to stdout, handy while iterating on templates. The target is not
+modified.
+
+Without --config the config file is searched in the directory of the file and
+its parents up to the repository root:
+  rpack render config/app.yaml
+  rpack render --config ./app.rpack.yaml config/app.yaml`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, err := cmd.Flags().GetString("config")
+		if err != nil {
+			return err
+		}
+		if configFile == "" {
+			if configFile, err = rpack.FindRPackConfig(filepath.Dir(args[0])); err != nil {
+				return err
+			}
+		}
+		e := &rpack.Executor{}
+		if e.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
+		if e.OverrideExecPath, err = cmd.Flags().GetString("working-dir"); err != nil {
+			return err
+		}
+		content, err := e.RenderFile(cmd.Context(), configFile, args[0])
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(content)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+
+	renderCmd.Flags().StringP("config", "c", "", "Config file generating the file, searched from the directory of the file if empty")
+	renderCmd.Flags().StringP("working-dir", "w", "", "Override working dir, defaults to location of rpack file")
+}
@@ -0,0 +1,88 @@
+// Package cmd implements the report command.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Inspect reports of previous runs",
+	Long: `Every apply stores a normalized run report below .rpack.d/reports/<config>/
+containing digests of the definition, values, inputs and written files as well as timings.`,
+}
+
+// reportListCmd lists stored run reports.
+var reportListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List stored run reports, oldest first",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		wd, err := cmd.Flags().GetString("working-dir")
+		if err != nil {
+			return err
+		}
+		reports, err := rpack.ListRunReports(wd)
+		if err != nil {
+			return err
+		}
+		for _, name := range reports {
+			r, err := rpack.LoadRunReport(name)
+			if err != nil {
+				return err
+			}
+			outputs := 0
+			for _, p := range r.Packs {
+				outputs += len(p.Outputs)
+			}
+			fmt.Fprintf(os.Stdout, "%s\t%s\tpacks=%d\tfiles=%d\t%dms\n", r.ID, r.Config, len(r.Packs), outputs, r.DurationMs)
+		}
+		return nil
+	},
+}
+
+// reportDiffCmd explains the differences between two runs.
+var reportDiffCmd = &cobra.Command{
+	Use:   "diff <runA> <runB>",
+	Short: "Explain what changed between two runs",
+	Long: `Diff compares two run reports and explains changes of the definition, values,
+inputs and written files. Runs are referenced by a unique prefix of their id
+(see 'rpack report list') or by the path to a report file.`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		wd, err := cmd.Flags().GetString("working-dir")
+		if err != nil {
+			return err
+		}
+		wd, err = filepath.Abs(wd)
+		if err != nil {
+			return err
+		}
+		a, err := rpack.FindRunReport(wd, args[0])
+		if err != nil {
+			return err
+		}
+		b, err := rpack.FindRunReport(wd, args[1])
+		if err != nil {
+			return err
+		}
+		return rpack.DiffRunReports(a, b).Format(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportListCmd)
+	reportCmd.AddCommand(reportDiffCmd)
+
+	reportCmd.PersistentFlags().StringP("working-dir", "w", ".", "Directory containing the .rpack.d state")
+}
@@ -1,12 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
 
 	"log/slog"
 
 	"github.com/golang-cz/devslog"
 	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -25,12 +32,50 @@ var rootCmd = &cobra.Command{
 	},
 }
 
-// Execute runs the root command.
+// Execute runs the root command and exits with the code of the failure, see exitCode.
+// Panics and internal errors are written to a local crash report.
 func Execute() {
-	err := rootCmd.Execute()
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "rpack crashed: %v\n", r)
+			writeCrashReport(r, string(debug.Stack()))
+			os.Exit(ExitCrash)
+		}
+	}()
+	// SIGINT and SIGTERM cancel the run, which rolls back the changes to the target.
+	// A second signal terminates rpack immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	ctx, shutdownTracing := setupTracing(ctx)
+	err := rootCmd.ExecuteContext(ctx)
+	shutdownTracing()
+	if err != nil {
+		if cause, stack, ok := rpack.InternalError(err); ok {
+			writeCrashReport(cause, stack)
+			os.Exit(ExitCrash)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// writeCrashReport writes a crash report and points the user at it.
+// Only the command name is recorded, arguments may contain values.
+func writeCrashReport(cause any, stack string) {
+	command := rootCmd.Name()
+	if c, _, err := rootCmd.Find(os.Args[1:]); err == nil {
+		command = c.CommandPath()
+	}
+	report := rpack.NewCrashReport(BuildVersion, command, cause, stack)
+	name, err := report.Write(rpack.CrashReportDir())
 	if err != nil {
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Could not write crash report: %s\n%s", err, report)
+		return
 	}
+	fmt.Fprintf(os.Stderr, "This is a bug in rpack. A crash report was written to %s\n"+
+		"Please attach it to a bug report, it contains no file contents.\n", name)
 }
 
 func setupLogger(lvl slog.Level) {
@@ -49,10 +94,11 @@ func setupLogger(lvl slog.Level) {
 		StringerFormatter: true,
 	}
 
-	logger := slog.New(devslog.NewHandler(os.Stderr, opts))
+	logger := slog.New(rpack.NewRedactingHandler(devslog.NewHandler(os.Stderr, opts)))
 	slog.SetDefault(logger)
 }
 
 func init() {
 	rootCmd.PersistentFlags().BoolP("debug", "", false, "Enable verbose logging")
+	rootCmd.PersistentFlags().BoolP("lenient", "", false, "Ignore unknown fields in configs, definitions and lockfiles instead of failing")
 }
@@ -3,8 +3,11 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -13,7 +16,7 @@ import (
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
-	Use:   "run [--def <dir>] [flags] [<config-file>]",
+	Use:   "run [--def <dir>] [--auto] [flags] [<config-file>]",
 	Short: "Run an rpack file or definition directory",
 	Args:  cobra.MaximumNArgs(1),
 	Long: `Execute an rpack from a user config file or a local definition directory.
@@ -21,6 +24,10 @@ var runCmd = &cobra.Command{
 With a config file:
   rpack run ./app.rpack.yaml
 
+Without arguments the config file is searched in the current directory and its
+parents up to the repository root:
+  rpack run
+
 With a local definition directory (--def mode):
   rpack run --def ./my-rpack --set author=test --dry-run`,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -29,13 +36,17 @@ With a local definition directory (--def mode):
 			return err
 		}
 		hasConfigFile := len(args) > 0
+		flagAuto, err := cmd.Flags().GetBool("auto")
+		if err != nil {
+			return err
+		}
 
 		// Validate flag combinations
 		if defDir != "" && hasConfigFile {
 			return fmt.Errorf("--def and config file argument are mutually exclusive")
 		}
-		if defDir == "" && !hasConfigFile {
-			return fmt.Errorf("either --def or a config file argument is required")
+		if flagAuto && (defDir != "" || hasConfigFile) {
+			return fmt.Errorf("--auto is mutually exclusive with --def and config file argument")
 		}
 
 		// Parse --set flags (only valid with --def)
@@ -71,12 +82,28 @@ With a local definition directory (--def mode):
 			return fmt.Errorf("--output-dir and --dry-run are mutually exclusive")
 		}
 
+		planFile, err := cmd.Flags().GetString("plan-file")
+		if err != nil {
+			return err
+		}
+		if planFile != "" && !flagDryRun {
+			return fmt.Errorf("--plan-file requires --dry-run")
+		}
+
+		auditLog, err := cmd.Flags().GetString("audit-log")
+		if err != nil {
+			return err
+		}
+
 		e := &rpack.Executor{}
 
 		flagWD, err := cmd.Flags().GetString("working-dir")
 		if err != nil {
 			return err
 		}
+		if e.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
 		if flagWD != "" {
 			e.OverrideExecPath = flagWD
 		}
@@ -86,9 +113,91 @@ With a local definition directory (--def mode):
 			return err
 		}
 		e.Force = flagForce
+		if e.Merge, err = cmd.Flags().GetBool("merge"); err != nil {
+			return err
+		}
 
 		e.DryRun = flagDryRun
 		e.OutputDir = outputDir
+		e.PlanFile = planFile
+		e.AuditLog = auditLog
+		if e.AllowVerify, err = cmd.Flags().GetStringSlice("allow-verify"); err != nil {
+			return err
+		}
+		if e.NoVerify, err = cmd.Flags().GetBool("no-verify"); err != nil {
+			return err
+		}
+		if e.AllowPostApply, err = cmd.Flags().GetStringSlice("allow-post-apply"); err != nil {
+			return err
+		}
+		if e.NoPostApply, err = cmd.Flags().GetBool("no-post-apply"); err != nil {
+			return err
+		}
+		if e.AllowNotify, err = cmd.Flags().GetStringSlice("allow-notify"); err != nil {
+			return err
+		}
+		if e.VerifyIdempotent, err = cmd.Flags().GetBool("verify-idempotent"); err != nil {
+			return err
+		}
+		if e.Strict, err = cmd.Flags().GetBool("strict"); err != nil {
+			return err
+		}
+		if e.NoGitIgnore, err = cmd.Flags().GetBool("no-gitignore"); err != nil {
+			return err
+		}
+		if e.LintTemplates, err = lintTemplatesFromFlags(cmd); err != nil {
+			return err
+		}
+		if e.Timestamp, err = timestampFromFlags(cmd); err != nil {
+			return err
+		}
+		if e.Reproducible, err = cmd.Flags().GetBool("reproducible"); err != nil {
+			return err
+		}
+		if e.Parallel, err = cmd.Flags().GetInt("parallel"); err != nil {
+			return err
+		}
+		if e.MaxFileSize, err = byteSizeFromFlags(cmd, "max-file-size"); err != nil {
+			return err
+		}
+		if e.MaxTotalSize, err = byteSizeFromFlags(cmd, "max-total-size"); err != nil {
+			return err
+		}
+		if e.GitDirty, err = cmd.Flags().GetString("git-dirty"); err != nil {
+			return err
+		}
+		if err = rpack.ValidateGitDirtyMode(e.GitDirty); err != nil {
+			return err
+		}
+		if e.DefCacheDir, err = cmd.Flags().GetString("def-cache-dir"); err != nil {
+			return err
+		}
+		if e.DefCacheTTL, err = cmd.Flags().GetDuration("def-cache-ttl"); err != nil {
+			return err
+		}
+		if e.Script, err = cmd.Flags().GetString("script"); err != nil {
+			return err
+		}
+		if e.NotifyWebhooks, err = cmd.Flags().GetStringArray("notify-webhook"); err != nil {
+			return err
+		}
+		flagNotifyCommand, err := cmd.Flags().GetString("notify-command")
+		if err != nil {
+			return err
+		}
+		e.NotifyCommand = strings.Fields(flagNotifyCommand)
+		flagProgress, err := cmd.Flags().GetBool("progress")
+		if err != nil {
+			return err
+		}
+		if flagProgress {
+			bar := newProgressBar()
+			defer bar.Finish()
+			e.Progress = bar
+		}
+		if e.DiffOptions, err = diffOptionsFromFlags(cmd); err != nil {
+			return err
+		}
 
 		if defDir != "" {
 			// --def mode
@@ -106,7 +215,16 @@ With a local definition directory (--def mode):
 		}
 
 		// Normal mode (config file)
-		if err := e.ExecRPack(cmd.Context(), args[0]); err != nil {
+		configFile := ""
+		if hasConfigFile {
+			configFile = args[0]
+		} else {
+			if configFile, err = rpack.FindRPackConfig("."); err != nil {
+				return err
+			}
+			slog.Info("Using rpack config file", "path", configFile)
+		}
+		if err := e.ExecRPack(cmd.Context(), configFile); err != nil {
 			return err
 		}
 		return nil
@@ -118,9 +236,36 @@ func init() {
 
 	// Run-specific flags (new --def mode)
 	runCmd.Flags().StringP("def", "", "", "Use local definition directory (mutually exclusive with config file)")
+	runCmd.Flags().BoolP("auto", "", false, "Search the config file in the current directory and its parents (default without arguments)")
 	runCmd.Flags().StringSliceP("set", "", nil, "Set a config value (key=value, repeatable)")
 	runCmd.Flags().StringSliceP("set-input", "", nil, "Map an input name to a local file (name=path, repeatable)")
 	runCmd.Flags().StringP("output-dir", "", "", "Write output files to this directory")
+	runCmd.Flags().StringP("plan-file", "", "", "Write a JSON change plan to this path (requires --dry-run)")
+	runCmd.Flags().BoolP("progress", "", false, "Show the progress of fetching, executing, checksumming and transferring files on stderr")
+	runCmd.Flags().StringP("audit-log", "", "", "Write a JSON log of all filesystem interactions to this path")
+	runCmd.Flags().StringSliceP("allow-verify", "", nil, "Allow verify commands of the config to run this program (repeatable)")
+	runCmd.Flags().BoolP("no-verify", "", false, "Skip the verify commands of the config")
+	runCmd.Flags().StringSliceP("allow-post-apply", "", nil, "Allow post-apply commands of the config to run this program (repeatable)")
+	runCmd.Flags().BoolP("no-post-apply", "", false, "Skip the post-apply commands of the config")
+	runCmd.Flags().StringSliceP("allow-notify", "", nil, "Allow the notify webhook of the config to post to this host (repeatable)")
+	runCmd.Flags().BoolP("verify-idempotent", "", false, "Run each script twice and fail if the second run produces different files")
+	runCmd.Flags().BoolP("no-gitignore", "", false, "Do not add rpack internals like .rpack.d to the .gitignore file of the target")
+	runCmd.Flags().BoolP("merge", "", false, "Merge modifications of managed files into the generated content, conflicts are written with conflict markers")
+	runCmd.Flags().StringP("timestamp", "", "", "Pin the clock of scripts for reproducible output (RFC 3339 or Unix seconds), defaults to "+rpack.SourceDateEpochEnv)
+	runCmd.Flags().IntP("parallel", "", 1, "Number of packs of a multi-pack config executed at once, packs wait for the packs they depend on")
+	runCmd.Flags().StringP("max-file-size", "", "", "Fail if a script writes a file larger than this size, e.g. 100MiB")
+	runCmd.Flags().StringP("max-total-size", "", "", "Fail if the script of a pack writes more than this size in total, e.g. 1GiB")
+	runCmd.Flags().StringP("git-dirty", "", "", "Check the files the apply overwrites or removes for uncommitted changes in git: warn or fail")
+	runCmd.Flags().StringP("def-cache-dir", "", rpack.DefaultDefCacheDir(), "Directory of the definition cache shared by all targets, empty disables it, see "+rpack.DefCacheDirEnv)
+	runCmd.Flags().StringP("script", "", "", "Entry script declared by the definition to run instead of script.lua or the script of the config")
+	runCmd.Flags().StringArrayP("notify-webhook", "", nil, "Post the JSON run report to this URL after a successful apply (repeatable)")
+	runCmd.Flags().StringP("notify-command", "", "", "Run this command with the JSON run report on stdin after a successful apply, split at spaces without a shell")
+	runCmd.Flags().DurationP("def-cache-ttl", "", 0, "Reuse cached definitions of sources not pinned to a commit, digest or checksum if fetched within this duration")
+	runCmd.Flags().BoolP("reproducible", "", false, "Produce the same output on every run: pin the clock to --timestamp or the Unix epoch, seed math.random and hide the host name")
+	runCmd.Flags().BoolP("strict", "", false, "Fail instead of warning if a script writes a target file more than once with different content")
+	// rpack test --lint-templates enables linting for the runs of the test scripts
+	runCmd.Flags().BoolP("lint-templates", "", false, "Fail templates referencing missing data and warn about unused data, see "+lintTemplatesEnv)
+	addDiffOptionFlags(runCmd)
 
 	// General execution flags (persistent for future subcommand compatibility)
 	runCmd.PersistentFlags().StringP("working-dir", "w", "", "Override working dir, defaults to location of rpack file")
@@ -128,6 +273,41 @@ func init() {
 	runCmd.PersistentFlags().BoolP("dry-run", "", false, "Dry run execution")
 }
 
+// timestampFromFlags returns the time of --timestamp or of SOURCE_DATE_EPOCH, zero if neither is set.
+func timestampFromFlags(cmd *cobra.Command) (time.Time, error) {
+	ts, err := cmd.Flags().GetString("timestamp")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ts == "" {
+		if ts = os.Getenv(rpack.SourceDateEpochEnv); ts == "" {
+			return time.Time{}, nil
+		}
+	}
+	return rpack.ParseTimestamp(ts)
+}
+
+// lintTemplatesFromFlags returns --lint-templates if it is set, otherwise whether lintTemplatesEnv is set.
+func lintTemplatesFromFlags(cmd *cobra.Command) (bool, error) {
+	if cmd.Flags().Changed("lint-templates") {
+		return cmd.Flags().GetBool("lint-templates")
+	}
+	return os.Getenv(lintTemplatesEnv) != "", nil
+}
+
+// byteSizeFromFlags returns the size of the flag name in bytes, 0 if it is not set.
+func byteSizeFromFlags(cmd *cobra.Command, name string) (int64, error) {
+	s, err := cmd.Flags().GetString(name)
+	if err != nil || s == "" {
+		return 0, err
+	}
+	size, err := rpack.ParseByteSize(s)
+	if err != nil {
+		return 0, fmt.Errorf("--%s: %w", name, err)
+	}
+	return size, nil
+}
+
 // parseSetFlags parses --set key=value flags into a map[string]any.
 // Supports type coercion (int, bool, float, string), dot-notation nesting,
 // and array indexing.
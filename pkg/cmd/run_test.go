@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLintTemplatesFromFlags(t *testing.T) {
+	tcs := []struct { //nolint:govet // fieldalignment is not critical in table-driven tests
+		name  string
+		env   string
+		flags []string
+		want  bool
+	}{
+		{name: "unset", want: false},
+		{name: "env", env: "1", want: true},
+		{name: "flag", flags: []string{"--lint-templates"}, want: true},
+		{name: "flag overrides env", env: "1", flags: []string{"--lint-templates=false"}, want: false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(lintTemplatesEnv, tc.env)
+			cmd := &cobra.Command{}
+			cmd.Flags().Bool("lint-templates", false, "")
+			if err := cmd.Flags().Parse(tc.flags); err != nil {
+				t.Fatal(err)
+			}
+			got, err := lintTemplatesFromFlags(cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Package cmd implements the support-bundle command.
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// supportBundleCmd represents the support-bundle command
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle <config-file>",
+	Short: "Collect diagnostics of a config into an archive for bug reports",
+	Long: `Support-bundle collects everything needed to reproduce a problem into a .tar.gz file
+that can be attached to an issue:
+
+  - the config with sensitive values redacted
+  - the fetched definitions and the lockfile
+  - the most recent run reports and the run history
+  - the results of rpack doctor and recent crash reports
+
+Values listed in sensitive_values of a definition, and values whose name suggests a secret
+(password, token, secret, ...), are replaced by [REDACTED]. Input files are not included.
+Review the archive before sharing it.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := rpack.SupportBundleOptions{
+			ConfigFile: args[0],
+			Version:    BuildVersion,
+		}
+		var err error
+		if opts.Output, err = cmd.Flags().GetString("output"); err != nil {
+			return err
+		}
+		if opts.Output == "" {
+			opts.Output = "rpack-support-" + time.Now().UTC().Format("20060102T150405") + ".tar.gz"
+		}
+		if opts.Reports, err = cmd.Flags().GetInt("reports"); err != nil {
+			return err
+		}
+		if opts.Lenient, err = cmd.Flags().GetBool("lenient"); err != nil {
+			return err
+		}
+		if opts.Reports < 0 {
+			return fmt.Errorf("--reports must not be negative: %d", opts.Reports)
+		}
+
+		files, err := rpack.WriteSupportBundle(cmd.Context(), opts)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			fmt.Printf("  %s\n", f)
+		}
+		fmt.Printf("Support bundle written to %s\n", opts.Output)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(supportBundleCmd)
+
+	supportBundleCmd.Flags().StringP("output", "o", "", "Output archive path, defaults to rpack-support-<time>.tar.gz")
+	supportBundleCmd.Flags().IntP("reports", "", 5, "Number of most recent run reports to include")
+}
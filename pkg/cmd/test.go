@@ -2,6 +2,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,6 +11,8 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
 )
 
 const testScriptTemplate = `#!/bin/bash
@@ -37,16 +40,39 @@ fi
 # test ! -f "$OUTDIR/unwanted.txt" || { echo "FAIL: ..."; exit 1; }
 `
 
+// lintTemplatesEnv enables template linting of rpack run, set for test scripts by rpack test --lint-templates.
+const lintTemplatesEnv = "RPACK_LINT_TEMPLATES"
+
+const goldenTestTemplate = `# Values and inputs of the run, input paths are relative to this directory.
+# The output is compared with the files in golden/.
+values: {}
+inputs: {}
+`
+
 var testCmd = &cobra.Command{
-	Use:   "test --def <dir> [--filter <name>] [--init <name>]",
+	Use:   "test --def <dir> [--filter <name>] [--update] [--init <name> [--golden]]",
 	Short: "Run rpack definition tests",
-	Long: `Discover and run test scripts in a definition's tests/ directory.
+	Long: `Discover and run the tests in a definition's tests/ directory.
 
 Each test is a subdirectory of tests/ containing an executable script
 (run.sh, run.py, or run). The script receives two arguments:
   $1 = path to the definition directory
   $2 = path to a temp output directory
-Exit 0 for pass, non-zero for fail.`,
+Exit 0 for pass, non-zero for fail.
+
+A subdirectory without script but with test.yaml is a golden test. The
+definition runs with the values and inputs of test.yaml, input paths are
+relative to the test directory, and the output must match the files in
+golden/. --update regenerates golden/ from the output.
+
+  values:
+    name: example
+  inputs:
+    users.yaml: fixtures/users.yaml
+
+With --lint-templates the test scripts run with ` + lintTemplatesEnv + ` set, which
+makes rpack run lint templates: fields missing from the template data fail the
+run, data keys never referenced are reported as warnings.`,
 	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		defDir, err := cmd.Flags().GetString("def")
@@ -57,14 +83,36 @@ Exit 0 for pass, non-zero for fail.`,
 			return cmd.Usage()
 		}
 
-		filter, _ := cmd.Flags().GetString("filter")
-		initName, _ := cmd.Flags().GetString("init")
+		filter, err := cmd.Flags().GetString("filter")
+		if err != nil {
+			return err
+		}
+		initName, err := cmd.Flags().GetString("init")
+		if err != nil {
+			return err
+		}
+		golden, err := cmd.Flags().GetBool("golden")
+		if err != nil {
+			return err
+		}
+		update, err := cmd.Flags().GetBool("update")
+		if err != nil {
+			return err
+		}
 
 		if initName != "" {
-			return initTest(defDir, initName)
+			return initTest(defDir, initName, golden)
 		}
 
-		return runTests(defDir, filter)
+		lint, err := cmd.Flags().GetBool("lint-templates")
+		if err != nil {
+			return err
+		}
+		lenient, err := cmd.Flags().GetBool("lenient")
+		if err != nil {
+			return err
+		}
+		return runTests(cmd.Context(), defDir, filter, lint, update, lenient)
 	},
 }
 
@@ -73,10 +121,13 @@ func init() {
 	testCmd.Flags().StringP("def", "d", "", "Path to rpack definition directory (required)")
 	testCmd.Flags().StringP("filter", "", "", "Run only tests whose name contains this substring")
 	testCmd.Flags().StringP("init", "", "", "Scaffold a new test directory")
+	testCmd.Flags().BoolP("lint-templates", "", false, "Lint the templates rendered by the test runs")
+	testCmd.Flags().BoolP("update", "", false, "Regenerate the golden files of golden tests from the output")
+	testCmd.Flags().BoolP("golden", "", false, "Scaffold a golden test with --init")
 }
 
-// runTests discovers and executes all test scripts in tests/*/.
-func runTests(defDir, filter string) error { //nolint:gocognit // test orchestration requires sequential setup and execution
+// runTests discovers and executes all test scripts and golden tests in tests/*/.
+func runTests(ctx context.Context, defDir, filter string, lintTemplates, update, lenient bool) error { //nolint:gocognit // test orchestration requires sequential setup and execution
 	// Convert defDir to absolute path so test scripts receive a stable path
 	// regardless of their working directory
 	absDefDir, err := filepath.Abs(defDir)
@@ -94,6 +145,8 @@ func runTests(defDir, filter string) error { //nolint:gocognit // test orchestra
 	type testCase struct {
 		name   string
 		script string
+		// golden tests have no script but a test.yaml
+		golden bool
 	}
 	var tests []testCase
 
@@ -107,6 +160,9 @@ func runTests(defDir, filter string) error { //nolint:gocognit // test orchestra
 		}
 		script := findScript(filepath.Join(testsDir, name))
 		if script == "" {
+			if _, statErr := os.Stat(filepath.Join(testsDir, name, rpack.GoldenTestFilename)); statErr == nil {
+				tests = append(tests, testCase{name: name, golden: true})
+			}
 			continue
 		}
 		tests = append(tests, testCase{name: name, script: script})
@@ -121,30 +177,28 @@ func runTests(defDir, filter string) error { //nolint:gocognit // test orchestra
 	failed := 0
 
 	for _, tc := range tests {
-		outDir, tmpErr := os.MkdirTemp("", "rpack-test-*")
-		if tmpErr != nil {
-			fmt.Fprintf(os.Stderr, "FAIL  %s (could not create temp dir: %v)\n", tc.name, tmpErr)
-			failed++
-			continue
-		}
-
 		start := time.Now()
-		cmd := exec.Command(tc.script, absDefDir, outDir) //nolint:gosec // script path from trusted test discovery, absDefDir/outDir from CLI
-		cmd.Dir = filepath.Join(testsDir, tc.name)
-		output, runErr := cmd.CombinedOutput()
+		var output string
+		var runErr error
+		if tc.golden {
+			output, runErr = runGoldenTest(ctx, absDefDir, filepath.Join(testsDir, tc.name), lintTemplates, update, lenient)
+		} else {
+			output, runErr = runTestScript(absDefDir, filepath.Join(testsDir, tc.name), tc.script, lintTemplates)
+		}
 		elapsed := time.Since(start)
 
-		_ = os.RemoveAll(outDir)
-
 		if runErr != nil {
 			fmt.Printf("FAIL  %-40s (%s)\n", tc.name, elapsed.Round(time.Millisecond))
-			if len(output) > 0 {
-				outStr := strings.TrimSpace(string(output))
-				fmt.Printf("      %s\n", strings.ReplaceAll(outStr, "\n", "\n      "))
+			if output != "" {
+				fmt.Printf("      %s\n", strings.ReplaceAll(output, "\n", "\n      "))
 			}
 			failed++
 		} else {
-			fmt.Printf("PASS  %-40s (%s)\n", tc.name, elapsed.Round(time.Millisecond))
+			note := ""
+			if tc.golden && update {
+				note = ", golden files updated"
+			}
+			fmt.Printf("PASS  %-40s (%s%s)\n", tc.name, elapsed.Round(time.Millisecond), note)
 			passed++
 		}
 	}
@@ -158,6 +212,41 @@ func runTests(defDir, filter string) error { //nolint:gocognit // test orchestra
 	return nil
 }
 
+// runTestScript runs the test script with a temp output directory, returning its trimmed output.
+func runTestScript(absDefDir, testDir, script string, lintTemplates bool) (string, error) {
+	outDir, err := os.MkdirTemp("", "rpack-test-*")
+	if err != nil {
+		return "", fmt.Errorf("could not create temp dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(outDir) }()
+
+	cmd := exec.Command(script, absDefDir, outDir) //nolint:gosec // script path from trusted test discovery, absDefDir/outDir from CLI
+	cmd.Dir = testDir
+	if lintTemplates {
+		cmd.Env = append(os.Environ(), lintTemplatesEnv+"=1")
+	}
+	output, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
+
+// runGoldenTest runs the golden test in testDir, returning the diffs of mismatching files.
+func runGoldenTest(ctx context.Context, absDefDir, testDir string, lintTemplates, update, lenient bool) (string, error) {
+	e := &rpack.Executor{LintTemplates: lintTemplates, Lenient: lenient}
+	mismatches, err := e.RunGoldenTest(ctx, absDefDir, testDir, update)
+	if err != nil {
+		return err.Error(), err
+	}
+	if len(mismatches) == 0 {
+		return "", nil
+	}
+	var diffs []string
+	for _, m := range mismatches {
+		diffs = append(diffs, strings.TrimSuffix(m.Diff, "\n"))
+	}
+	diffs = append(diffs, "run with --update to accept the output as golden files")
+	return strings.Join(diffs, "\n"), fmt.Errorf("%d files differ from golden files", len(mismatches))
+}
+
 // findScript finds an executable test script in a directory.
 // Tries run, run.sh, run.py in order.
 func findScript(dir string) string {
@@ -174,8 +263,8 @@ func findScript(dir string) string {
 	return ""
 }
 
-// initTest scaffolds a new test directory with a template run.sh.
-func initTest(defDir, name string) error {
+// initTest scaffolds a new test directory with a template run.sh, or a test.yaml for golden tests.
+func initTest(defDir, name string, golden bool) error {
 	testsDir := filepath.Join(defDir, "tests")
 	testDir := filepath.Join(testsDir, name)
 
@@ -183,6 +272,15 @@ func initTest(defDir, name string) error {
 		return fmt.Errorf("could not create test directory: %w", err)
 	}
 
+	if golden {
+		testPath := filepath.Join(testDir, rpack.GoldenTestFilename)
+		if err := os.WriteFile(testPath, []byte(goldenTestTemplate), 0o644); err != nil { //nolint:gosec // standard permissions
+			return fmt.Errorf("could not write test file: %w", err)
+		}
+		fmt.Printf("Created %s, generate the golden files with --update\n", testPath)
+		return nil
+	}
+
 	scriptPath := filepath.Join(testDir, "run.sh")
 	content := fmt.Sprintf(testScriptTemplate, name)
 	if err := os.WriteFile(scriptPath, []byte(content), 0o755); err != nil { //nolint:gosec // executable script
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracingShutdownTimeout bounds flushing the spans on exit, an unreachable collector must not block rpack.
+const tracingShutdownTimeout = 5 * time.Second
+
+// tracingEnabled reports if the OpenTelemetry environment configures an OTLP trace endpoint.
+// OTEL_TRACES_EXPORTER=none and OTEL_SDK_DISABLED=true turn tracing off.
+func tracingEnabled() bool {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// setupTracing exports the spans of rpack with OTLP over gRPC if tracingEnabled. The exporter reads
+// the endpoint, headers and TLS settings from the standard OTEL_EXPORTER_OTLP_* variables.
+// Spans continue the trace of a parent process passed in TRACEPARENT and TRACESTATE.
+// The returned function flushes the spans and must be called before exiting.
+func setupTracing(ctx context.Context) (context.Context, func()) {
+	if !tracingEnabled() {
+		return ctx, func() {}
+	}
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		rootCmd.PrintErrf("Tracing disabled, could not create the OTLP exporter: %s\n", err)
+		return ctx, func() {}
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "rpack"), attribute.String("service.version", BuildVersion)),
+		// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		res = resource.Default()
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	propagator := propagation.TraceContext{}
+	otel.SetTextMapPropagator(propagator)
+	ctx = propagator.Extract(ctx, propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	})
+	return ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			rootCmd.PrintErrf("Could not export traces: %s\n", err)
+		}
+	}
+}
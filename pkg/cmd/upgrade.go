@@ -0,0 +1,104 @@
+// Package cmd implements the upgrade command.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blang/rpack/pkg/rpack"
+)
+
+// upgradeCmd represents the upgrade command
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [--pack <name>] [--pre] [--diff] [--dry-run] <config-file>",
+	Short: "Bump git source pins to the latest tag",
+	Long: `Upgrade checks git sources pinned to a semver tag via ?ref= for newer tags
+on the remote and rewrites the pin in the config file.
+Comments and formatting of the config file are preserved.
+
+Prerelease tags are only considered with --pre.
+With --diff the changes of the new version are shown like rpack diff
+before the config is updated, --dry-run only reports available upgrades:
+
+  rpack upgrade --dry-run ./app.rpack.yaml
+  rpack upgrade --diff --pack api ./app.rpack.yaml`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var opts rpack.UpgradeOptions
+		var err error
+		if opts.Pack, err = cmd.Flags().GetString("pack"); err != nil {
+			return err
+		}
+		if opts.Prerelease, err = cmd.Flags().GetBool("pre"); err != nil {
+			return err
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		showDiff, err := cmd.Flags().GetBool("diff")
+		if err != nil {
+			return err
+		}
+		flagWD, err := cmd.Flags().GetString("working-dir")
+		if err != nil {
+			return err
+		}
+
+		lenient, err := cmd.Flags().GetBool("lenient")
+		if err != nil {
+			return err
+		}
+		ci, err := rpack.Loader{Lenient: lenient}.LoadRPackConfig(args[0])
+		if err != nil {
+			return err
+		}
+		upgrades, err := rpack.FindSourceUpgrades(cmd.Context(), ci, opts)
+		if err != nil {
+			return err
+		}
+		if len(upgrades) == 0 {
+			fmt.Println("All sources are up to date")
+			return nil
+		}
+		for _, u := range upgrades {
+			label := u.Pack
+			if label == "" {
+				label = "source"
+			}
+			fmt.Printf("%s: %s -> %s\n", label, u.OldRef, u.NewRef)
+		}
+
+		if showDiff {
+			e := &rpack.Executor{
+				DryRun:           true,
+				DiffRenderer:     &rpack.UnifiedDiffRenderer{},
+				OverrideExecPath: flagWD,
+				Lenient:          lenient,
+			}
+			if err = e.ExecRPackConfig(cmd.Context(), rpack.UpgradedConfig(ci, upgrades)); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return nil
+		}
+		if err = rpack.WriteSourceUpgrades(ci, upgrades); err != nil {
+			return err
+		}
+		fmt.Printf("Updated %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+
+	upgradeCmd.Flags().StringP("pack", "", "", "Only upgrade the source of this pack")
+	upgradeCmd.Flags().BoolP("pre", "", false, "Consider prerelease tags")
+	upgradeCmd.Flags().BoolP("diff", "", false, "Show the changes of the new version before updating")
+	upgradeCmd.Flags().BoolP("dry-run", "", false, "Only report available upgrades, do not update the config")
+	upgradeCmd.Flags().StringP("working-dir", "w", "", "Override working dir, defaults to location of rpack file")
+}
@@ -17,7 +17,9 @@ var validateCmd = &cobra.Command{
 
 - rpack.yaml with valid schema (name, inputs)
 - script.lua (present and readable)
-- schema.cue (if present, valid CUE syntax)
+- schema.cue or schema.json (if present, valid CUE syntax or JSON Schema)
+
+Prints the permissions of the script for review.
 
 Exits 0 if the definition is valid, non-zero with an error message otherwise.`,
 	Args: cobra.NoArgs,
@@ -29,11 +31,24 @@ Exits 0 if the definition is valid, non-zero with an error message otherwise.`,
 		if defDir == "" {
 			return cmd.Usage()
 		}
-		_, err = rpack.ValidateRPackDef(defDir)
+		lenient, err := cmd.Flags().GetBool("lenient")
+		if err != nil {
+			return err
+		}
+		def, err := rpack.Loader{Lenient: lenient}.ValidateRPackDef(defDir)
 		if err != nil {
 			return fmt.Errorf("invalid definition: %w", err)
 		}
 		fmt.Println("Definition is valid.")
+		perms := def.EffectivePermissions().Describe()
+		if len(perms) == 0 {
+			fmt.Println("The script has no permissions beyond reading its own files.")
+			return nil
+		}
+		fmt.Println("The script may:")
+		for _, p := range perms {
+			fmt.Printf("  - %s\n", p)
+		}
 		return nil
 	},
 }
@@ -0,0 +1,71 @@
+package lockfile
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Names of the built-in checksum algorithms. Both are FIPS-approved.
+const (
+	// SHA256 is the default algorithm and the one of entries without an algorithm
+	SHA256 = "sha256"
+	// SHA512 is faster than SHA256 on 64-bit CPUs without SHA extensions
+	SHA512 = "sha512"
+)
+
+// Algorithm computes the checksums of lockfile entries.
+// Entries record the name of the algorithm, so lockfiles can mix algorithms while migrating.
+type Algorithm interface {
+	// Name is recorded in the algorithm field of lockfile entries
+	Name() string
+	// New returns a hash computing the checksum
+	New() hash.Hash
+}
+
+// NewAlgorithm returns an Algorithm using newHash, e.g. to Register a faster non-cryptographic hash.
+func NewAlgorithm(name string, newHash func() hash.Hash) Algorithm {
+	return &hashAlgorithm{name: name, newHash: newHash}
+}
+
+type hashAlgorithm struct {
+	name    string
+	newHash func() hash.Hash
+}
+
+func (a *hashAlgorithm) Name() string   { return a.name }
+func (a *hashAlgorithm) New() hash.Hash { return a.newHash() }
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = map[string]Algorithm{
+		SHA256: NewAlgorithm(SHA256, sha256.New),
+		SHA512: NewAlgorithm(SHA512, sha512.New),
+	}
+)
+
+// Register makes an algorithm available to lockfiles, replacing one of the same name.
+// Tools reading lockfiles written with an algorithm rpack registers itself need to register it too.
+func Register(a Algorithm) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	algorithms[a.Name()] = a
+}
+
+// LookupAlgorithm returns the registered algorithm name, SHA256 if name is empty.
+func LookupAlgorithm(name string) (Algorithm, error) {
+	if name == "" {
+		name = SHA256
+	}
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	a, ok := algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown checksum algorithm %q, supported %v", name, slices.Sorted(maps.Keys(algorithms)))
+	}
+	return a, nil
+}
@@ -0,0 +1,72 @@
+package lockfile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// Keywords of the marker lines of managed blocks, e.g. "# BEGIN rpack deps" and "# END rpack deps".
+// The comment syntax around the keywords depends on the file.
+const (
+	BlockBegin = "BEGIN"
+	BlockEnd   = "END"
+)
+
+// IsBlockMarker reports if line is the begin or end marker, see BlockBegin and BlockEnd,
+// of the managed block named marker.
+func IsBlockMarker(line, kind, marker string) bool {
+	fields := strings.Fields(line)
+	for i := 0; i+2 < len(fields); i++ {
+		if fields[i] == kind && fields[i+1] == "rpack" && fields[i+2] == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractBlocks returns the managed blocks named markers of content, including their marker lines,
+// in the order of markers. Line endings are normalized to LF, blocks without end marker are left out.
+func ExtractBlocks(content []byte, markers []string) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	var out bytes.Buffer
+	for _, marker := range markers {
+		start := -1
+		for i, line := range lines {
+			if start < 0 && IsBlockMarker(line, BlockBegin, marker) {
+				start = i
+			} else if start >= 0 && IsBlockMarker(line, BlockEnd, marker) {
+				for _, l := range lines[start : i+1] {
+					out.WriteString(l)
+					out.WriteByte('\n')
+				}
+				break
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// ChecksumBlocks returns the checksum of the managed blocks named markers of the file name with algorithm,
+// the checksum of files only partly managed by rpack. Changes outside of the blocks do not change it.
+func ChecksumBlocks(algorithm, name string, markers []string) (string, error) {
+	a, err := LookupAlgorithm(algorithm)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", errIsDir
+	}
+	content, err := os.ReadFile(name) //nolint:gosec // intentional: path comes from caller
+	if err != nil {
+		return "", err
+	}
+	h := a.New()
+	_, _ = h.Write(ExtractBlocks(content, markers))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,167 @@
+// Package lockfile reads, writes and verifies rpack lockfiles (*.rpack.lock.yaml).
+//
+// It only depends on the standard library, pkg/api and a YAML decoder, so tools
+// like bots and linters can consume lockfiles without the rpack runtime.
+package lockfile
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// Suffix is the file name suffix of lockfiles, the config app.rpack.yaml uses app.rpack.lock.yaml.
+const Suffix = ".rpack.lock.yaml"
+
+// New returns an empty lockfile of the current schema version.
+func New() *api.LockFile {
+	return &api.LockFile{SchemaVersion: api.ConfigSchemaVersion, Files: []*api.LockFileFile{}}
+}
+
+// Validate checks that the lockfile uses a supported schema version.
+func Validate(f *api.LockFile) error {
+	if f.SchemaVersion != api.ConfigSchemaVersion {
+		return fmt.Errorf("unsupported lockfile schema version %q, supported %q", f.SchemaVersion, api.ConfigSchemaVersion)
+	}
+	return nil
+}
+
+// Parse decodes and validates a lockfile, unknown fields are ignored.
+func Parse(b []byte) (*api.LockFile, error) {
+	return parse(b, yaml.Unmarshal)
+}
+
+// ParseStrict is like Parse but fails on unknown fields and duplicate keys.
+func ParseStrict(b []byte) (*api.LockFile, error) {
+	return parse(b, yaml.UnmarshalStrict)
+}
+
+func parse(b []byte, unmarshal func([]byte, any, ...yaml.JSONOpt) error) (*api.LockFile, error) {
+	var f api.LockFile
+	if err := unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lockfile: %w", err)
+	}
+	if err := Validate(&f); err != nil {
+		return nil, err
+	}
+	if f.Files == nil {
+		f.Files = []*api.LockFileFile{}
+	}
+	return &f, nil
+}
+
+// Read reads and parses the lockfile name.
+func Read(name string) (*api.LockFile, error) {
+	return read(name, Parse)
+}
+
+// ReadStrict reads and parses the lockfile name, failing on unknown fields and duplicate keys.
+func ReadStrict(name string) (*api.LockFile, error) {
+	return read(name, ParseStrict)
+}
+
+func read(name string, parse func([]byte) (*api.LockFile, error)) (*api.LockFile, error) {
+	b, err := os.ReadFile(name) //nolint:gosec // intentional: path comes from caller
+	if err != nil {
+		return nil, err
+	}
+	f, err := parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return f, nil
+}
+
+// Marshal encodes a lockfile as YAML.
+func Marshal(f *api.LockFile) ([]byte, error) {
+	b, err := yaml.Marshal(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lockfile: %w", err)
+	}
+	return b, nil
+}
+
+// Write writes the lockfile to name.
+func Write(name string, f *api.LockFile) error {
+	b, err := Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(name, b, 0o666); err != nil { //nolint:gosec // intentional: standard file permissions for package manager output
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	return nil
+}
+
+// CheckIntegrity reports the managed files below dir that were modified or removed
+// since rpack wrote them. dir is the directory of the lockfile.
+// Every entry is checked with its own algorithm, it fails on unknown algorithms.
+func CheckIntegrity(f *api.LockFile, dir string) (*api.IntegrityReport, error) {
+	res := &api.IntegrityReport{}
+	cleanBase := filepath.Clean(dir)
+	for _, file := range f.Files {
+		name := filepath.Join(cleanBase, file.Path)
+		var sum string
+		var err error
+		if len(file.Blocks) > 0 {
+			sum, err = ChecksumBlocks(file.Algorithm, name, file.Blocks)
+		} else {
+			sum, err = ChecksumWith(file.Algorithm, name)
+		}
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errIsDir) {
+			res.Removed = append(res.Removed, file.Path)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not calculate checksum for %s: %s: %w", file.Path, name, err)
+		}
+		if file.Sha != sum {
+			res.Modified = append(res.Modified, file.Path)
+		}
+	}
+	return res, nil
+}
+
+var errIsDir = errors.New("is a directory")
+
+// Checksum returns the checksum of a file as stored in lockfiles, the hex encoded SHA256 of its content.
+func Checksum(name string) (string, error) {
+	return ChecksumWith(SHA256, name)
+}
+
+// ChecksumWith returns the hex encoded checksum of a file with the registered algorithm,
+// SHA256 if algorithm is empty.
+func ChecksumWith(algorithm, name string) (sum string, err error) {
+	a, err := LookupAlgorithm(algorithm)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(name) //nolint:gosec // intentional: path comes from caller
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = closeErr
+		}
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", errIsDir
+	}
+	h := a.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
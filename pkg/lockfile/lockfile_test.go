@@ -0,0 +1,149 @@
+package lockfile
+
+import (
+	"hash"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestParseAndWrite(t *testing.T) {
+	f, err := Parse([]byte(`"@schema_version": v1
+files:
+- path: out.txt
+  sha: abc
+- path: b/c.txt
+  sha: def
+  pack: app
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*api.LockFileFile{{Path: "out.txt", Sha: "abc"}, {Path: "b/c.txt", Sha: "def", Pack: "app"}}
+	if !reflect.DeepEqual(f.Files, want) {
+		t.Errorf("Unexpected files %+v", f.Files)
+	}
+
+	name := filepath.Join(t.TempDir(), "app"+Suffix)
+	if err = Write(name, f); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, f) {
+		t.Errorf("Round trip changed lockfile: %+v", read)
+	}
+
+	if _, err = Parse([]byte(`"@schema_version": v2`)); err == nil {
+		t.Error("Expected error for unsupported schema version")
+	}
+	if empty, err := Parse([]byte(`"@schema_version": v1`)); err != nil || empty.Files == nil {
+		t.Errorf("Expected empty file list, got %v, %v", empty, err)
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	b := []byte(`"@schema_version": v1
+files:
+- path: out.txt
+  sah: abc
+`)
+	if _, err := Parse(b); err != nil {
+		t.Errorf("Expected Parse to ignore unknown fields, got %v", err)
+	}
+	if _, err := ParseStrict(b); err == nil {
+		t.Error("Expected ParseStrict to fail on unknown field")
+	}
+	if _, err := ParseStrict([]byte(`"@schema_version": v1
+files: []
+files: []
+`)); err == nil {
+		t.Error("Expected ParseStrict to fail on duplicate key")
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"same.txt": "same", "changed.txt": "new"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := Checksum(filepath.Join(dir, "same.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != "0967115f2813a3541eaef77de9d9d5773f1c0c04314b0bbfe4ff3b3b1c55b5d5" {
+		t.Errorf("Unexpected checksum %s", sum)
+	}
+	f := New()
+	f.Files = []*api.LockFileFile{
+		{Path: "same.txt", Sha: sum},
+		{Path: "changed.txt", Sha: sum},
+		{Path: "missing.txt", Sha: sum},
+		{Path: "dir", Sha: sum},
+	}
+	report, err := CheckIntegrity(f, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Modified, []string{"changed.txt"}) || !reflect.DeepEqual(report.Removed, []string{"missing.txt", "dir"}) {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.Clean() {
+		t.Error("Expected report not to be clean")
+	}
+}
+
+func TestCheckIntegrityMixedAlgorithms(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"old.txt": "old", "new.txt": "new", "custom.txt": "custom"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Register(NewAlgorithm("fnv64a", func() hash.Hash { return fnv.New64a() }))
+	oldSum, err := Checksum(filepath.Join(dir, "old.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSum, err := ChecksumWith(SHA512, filepath.Join(dir, "new.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	customSum, err := ChecksumWith("fnv64a", filepath.Join(dir, "custom.txt"))
+	if err != nil || len(customSum) != 16 {
+		t.Fatalf("Unexpected fnv64a checksum %s: %v", customSum, err)
+	}
+
+	f := New()
+	f.Files = []*api.LockFileFile{
+		{Path: "old.txt", Sha: oldSum},
+		{Path: "new.txt", Sha: newSum, Algorithm: SHA512},
+		{Path: "custom.txt", Sha: customSum, Algorithm: "fnv64a"},
+	}
+	report, err := CheckIntegrity(f, dir)
+	if err != nil || !report.Clean() {
+		t.Fatalf("Expected clean report with mixed algorithms, got %+v, %v", report, err)
+	}
+
+	// The checksum of another algorithm does not match
+	f.Files[0].Algorithm = SHA512
+	if report, err = CheckIntegrity(f, dir); err != nil || !reflect.DeepEqual(report.Modified, []string{"old.txt"}) {
+		t.Errorf("Expected old.txt to be modified, got %+v, %v", report, err)
+	}
+	f.Files[0].Algorithm = "unknown"
+	if _, err = CheckIntegrity(f, dir); err == nil || !strings.Contains(err.Error(), `unknown checksum algorithm "unknown"`) {
+		t.Errorf("Expected unknown algorithm error, got %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package rpack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// API converts the config to the stable API type.
+func (c *RPackConfig) API() *api.Config {
+	out := &api.Config{
+		SchemaVersion:     c.SchemaVersion,
+		Source:            c.Source,
+		Config:            c.Config.api(),
+		Script:            c.Script,
+		SemanticUnchanged: c.SemanticUnchanged,
+		Protected:         c.Protected,
+		GitAttributes:     c.GitAttributes,
+		ChecksumAlgorithm: c.ChecksumAlgorithm,
+		Extra:             c.Extra,
+	}
+	for _, v := range c.Verify {
+		out.Verify = append(out.Verify, &api.ConfigVerify{Name: v.Name, Command: v.Command, Timeout: v.Timeout})
+	}
+	for _, p := range c.PostApply {
+		out.PostApply = append(out.PostApply, &api.ConfigPostApply{Name: p.Name, Command: p.Command, Timeout: p.Timeout})
+	}
+	if c.Notify != nil {
+		out.Notify = &api.ConfigNotify{Webhook: c.Notify.Webhook, Timeout: c.Notify.Timeout}
+	}
+	for name, s := range c.Secrets {
+		if out.Secrets == nil {
+			out.Secrets = make(map[string]*api.ConfigSecret, len(c.Secrets))
+		}
+		out.Secrets[name] = &api.ConfigSecret{Env: s.Env, SOPS: s.SOPS, Key: s.Key}
+	}
+	for _, p := range c.Packs {
+		out.Packs = append(out.Packs, &api.ConfigPack{
+			Name:      p.Name,
+			Source:    p.Source,
+			Config:    p.Config.api(),
+			DependsOn: p.DependsOn,
+			Script:    p.Script,
+		})
+	}
+	return out
+}
+
+func (c *RPackConfigConfig) api() *api.ConfigValues {
+	if c == nil {
+		return nil
+	}
+	return &api.ConfigValues{Inputs: c.Inputs, Values: c.Values}
+}
+
+// RPackConfigFromAPI converts an API config, e.g. built by an external tool,
+// to a config that can be validated and executed.
+func RPackConfigFromAPI(c *api.Config) *RPackConfig {
+	configFromAPI := func(v *api.ConfigValues) *RPackConfigConfig {
+		if v == nil {
+			return nil
+		}
+		return &RPackConfigConfig{Inputs: v.Inputs, Values: v.Values}
+	}
+	out := &RPackConfig{
+		SchemaVersion:     c.SchemaVersion,
+		Source:            c.Source,
+		Config:            configFromAPI(c.Config),
+		Script:            c.Script,
+		SemanticUnchanged: c.SemanticUnchanged,
+		Protected:         c.Protected,
+		GitAttributes:     c.GitAttributes,
+		ChecksumAlgorithm: c.ChecksumAlgorithm,
+		Extra:             c.Extra,
+	}
+	for _, v := range c.Verify {
+		out.Verify = append(out.Verify, &RPackConfigVerify{Name: v.Name, Command: v.Command, Timeout: v.Timeout})
+	}
+	for _, p := range c.PostApply {
+		out.PostApply = append(out.PostApply, &RPackConfigPostApply{Name: p.Name, Command: p.Command, Timeout: p.Timeout})
+	}
+	if c.Notify != nil {
+		out.Notify = &RPackConfigNotify{Webhook: c.Notify.Webhook, Timeout: c.Notify.Timeout}
+	}
+	for name, s := range c.Secrets {
+		if out.Secrets == nil {
+			out.Secrets = make(map[string]*RPackConfigSecret, len(c.Secrets))
+		}
+		out.Secrets[name] = &RPackConfigSecret{Env: s.Env, SOPS: s.SOPS, Key: s.Key}
+	}
+	for _, p := range c.Packs {
+		out.Packs = append(out.Packs, &RPackConfigPack{
+			Name:      p.Name,
+			Source:    p.Source,
+			Config:    configFromAPI(p.Config),
+			DependsOn: p.DependsOn,
+			Script:    p.Script,
+		})
+	}
+	return out
+}
+
+// API converts the definition to the stable API type.
+func (def *RPackDef) API() *api.Def {
+	out := &api.Def{
+		SchemaVersion:   def.SchemaVersion,
+		Name:            def.Name,
+		Description:     def.Description,
+		Version:         def.Version,
+		AllowTargetRead: def.AllowTargetRead,
+		SensitiveValues: def.SensitiveValues,
+	}
+	if def.Permissions != nil {
+		p := def.Permissions
+		out.Permissions = &api.DefPermissions{ReadInputs: p.ReadInputs, WriteTarget: p.WriteTarget, TargetReadPaths: p.TargetReadPaths, HTTP: p.HTTP,
+			Env: p.Env, Hostname: p.Hostname}
+	}
+	if def.Template != nil {
+		out.Template = &api.DefTemplate{MissingKey: def.Template.MissingKey, Escape: def.Template.Escape}
+	}
+	for _, in := range def.Inputs {
+		out.Inputs = append(out.Inputs, &api.DefInput{Type: in.Type, Name: in.Name, Description: in.Description})
+	}
+	for _, extra := range def.Extra {
+		out.Extra = append(out.Extra, &api.DefExtra{Type: extra.Type, Name: extra.Name, Description: extra.Description, Required: extra.Required})
+	}
+	for _, s := range def.Scripts {
+		out.Scripts = append(out.Scripts, &api.DefScript{Name: s.Name, File: s.File, Description: s.Description})
+	}
+	for _, d := range def.Dependencies {
+		out.Dependencies = append(out.Dependencies, &api.DefDependency{Name: d.Name, Source: d.Source, Values: d.Values, Script: d.Script})
+	}
+	return out
+}
+
+// API converts the lockfile to the stable API type.
+func (f *RPackLockFile) API() *api.LockFile {
+	out := &api.LockFile{SchemaVersion: f.SchemaVersion, Files: []*api.LockFileFile{}}
+	for _, file := range f.Files {
+		out.Files = append(out.Files, &api.LockFileFile{Path: file.Path, Sha: file.Sha, Pack: file.Pack, Algorithm: file.Algorithm, Blocks: file.Blocks})
+	}
+	return out
+}
+
+// RPackLockFileFromAPI converts an API lockfile.
+func RPackLockFileFromAPI(f *api.LockFile) *RPackLockFile {
+	out := &RPackLockFile{SchemaVersion: f.SchemaVersion, Files: []*RPackLockFileFile{}}
+	for _, file := range f.Files {
+		out.Files = append(out.Files, &RPackLockFileFile{Path: file.Path, Sha: file.Sha, Pack: file.Pack, Algorithm: file.Algorithm, Blocks: file.Blocks})
+	}
+	return out
+}
+
+// API converts the integrity check result to the stable API type.
+func (i *RPackLockFileIntegrity) API() *api.IntegrityReport {
+	return &api.IntegrityReport{Modified: i.Modified, Removed: i.Removed}
+}
+
+// API converts the plan to the stable API type.
+func (p *Plan) API() *api.Plan {
+	out := &api.Plan{SchemaVersion: p.SchemaVersion, Files: []*api.PlanFile{}, Annotations: annotationsToAPI(p.Annotations), Protected: p.Protected}
+	for _, f := range p.Files {
+		out.Files = append(out.Files, &api.PlanFile{
+			Path:           f.Path,
+			Pack:           f.Pack,
+			Action:         api.PlanAction(f.Action),
+			Managed:        f.Managed,
+			OldSha:         f.OldSha,
+			NewSha:         f.NewSha,
+			Binary:         f.Binary,
+			FormattingOnly: f.FormattingOnly,
+			Diff:           f.Diff,
+		})
+	}
+	return out
+}
+
+func annotationsToAPI(annotations []*Annotation) []*api.Annotation {
+	var out []*api.Annotation
+	for _, a := range annotations {
+		out = append(out, &api.Annotation{Pack: a.Pack, Path: a.Path, Message: a.Message})
+	}
+	return out
+}
+
+// Run executes a config for embedding rpack in other Go tools.
+// On dry-run the target is not modified and the result contains the plan
+// instead of printing the generated files.
+func Run(ctx context.Context, opts api.RunOptions) (*api.RunResult, error) {
+	log := opts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	ci, err := Loader{Lenient: opts.Lenient}.loadRPackConfig(opts.ConfigFile, opts.Config, log)
+	if err != nil {
+		return nil, fmt.Errorf("could not load rpack config: %s: %w", opts.ConfigFile, err)
+	}
+	e := &Executor{
+		OutputDir:        opts.OutputDir,
+		OverrideExecPath: opts.ExecPath,
+		DryRun:           opts.DryRun,
+		Force:            opts.Force,
+		Merge:            opts.Merge,
+		AllowVerify:      opts.AllowVerify,
+		NoVerify:         opts.NoVerify,
+		AllowPostApply:   opts.AllowPostApply,
+		NoPostApply:      opts.NoPostApply,
+		AllowNotify:      opts.AllowNotify,
+		VerifyIdempotent: opts.VerifyIdempotent,
+		NoGitIgnore:      opts.NoGitIgnore,
+		Strict:           opts.Strict,
+		LintTemplates:    opts.LintTemplates,
+		Timestamp:        opts.Timestamp,
+		Reproducible:     opts.Reproducible,
+		Parallel:         opts.Parallel,
+		MaxFileSize:      opts.MaxFileSize,
+		MaxTotalSize:     opts.MaxTotalSize,
+		GitDirty:         opts.GitDirty,
+		DefCacheDir:      opts.DefCacheDir,
+		DefCacheTTL:      opts.DefCacheTTL,
+		NotifyWebhooks:   opts.NotifyWebhooks,
+		NotifyCommand:    opts.NotifyCommand,
+		Script:           opts.Script,
+		Sources:          opts.Sources,
+		Logger:           opts.Logger,
+		Lenient:          opts.Lenient,
+		collectPlan:      true,
+	}
+	if opts.Hooks != nil {
+		e.FileAccess = opts.Hooks.FileAccess
+		if opts.Hooks.Progress != nil {
+			e.Progress = progressHook(opts.Hooks.Progress)
+		}
+	}
+	return e.runConfig(ctx, ci)
+}
+
+// progressHook passes progress events to the Progress hook of the run options.
+type progressHook func(event *api.ProgressEvent)
+
+// Progress converts ev to the API type.
+func (h progressHook) Progress(ev ProgressEvent) {
+	h(&api.ProgressEvent{
+		Phase:   string(ev.Phase),
+		Pack:    ev.Pack,
+		Current: ev.Current,
+		Total:   ev.Total,
+		Item:    ev.Item,
+		Done:    ev.Done,
+	})
+}
+
+// fileAccessFSHook passes the file accesses of a pack to the FileAccess hook of the run options.
+type fileAccessFSHook struct {
+	fn   func(access *api.FileAccess) error
+	pack string
+}
+
+// Check fileAccessFSHook satisfies FSAccessHook interface
+var _ = FSAccessHook(&fileAccessFSHook{})
+
+func (h *fileAccessFSHook) Read(handle FSHandle) error {
+	return h.call(FSAccessTypeRead, handle)
+}
+
+func (h *fileAccessFSHook) Write(handle FSHandle) error {
+	return h.call(FSAccessTypeWrite, handle)
+}
+
+func (h *fileAccessFSHook) ReadDir(handle FSHandle) error {
+	return h.call(FSAccessTypeReadDir, handle)
+}
+
+func (h *fileAccessFSHook) Stat(handle FSHandle) error {
+	return h.call(FSAccessTypeStat, handle)
+}
+
+func (h *fileAccessFSHook) Remove(handle FSHandle) error {
+	return h.call(FSAccessTypeRemove, handle)
+}
+
+func (h *fileAccessFSHook) call(typ FSAccessType, handle FSHandle) error {
+	err := h.fn(&api.FileAccess{
+		Pack:         h.pack,
+		Access:       typ.String(),
+		Resolver:     handle.Resolver(),
+		FriendlyPath: handle.FriendlyPath(),
+		Path:         handleAbsPath(handle),
+	})
+	if err != nil {
+		return fmt.Errorf("%s access to %s denied: %w", typ, handle.FriendlyPath(), err)
+	}
+	return nil
+}
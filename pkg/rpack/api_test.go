@@ -0,0 +1,220 @@
+package rpack
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// assertSameJSON checks that internal and API types encode the same, so the
+// API types keep describing the file formats.
+func assertSameJSON(t *testing.T, internal, public any) {
+	t.Helper()
+	a, err := json.Marshal(internal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var av, bv any
+	if err = json.Unmarshal(a, &av); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(b, &bv); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(av, bv) {
+		t.Errorf("JSON encodings differ:\ninternal: %s\napi:      %s", a, b)
+	}
+}
+
+func TestAPITypes(t *testing.T) {
+	config := &RPackConfig{
+		SchemaVersion: "v1",
+		Packs: []*RPackConfigPack{
+			{Name: "base", Source: "./base", Config: &RPackConfigConfig{Values: map[string]any{"a": "b"}, Inputs: map[string]string{"in": "x"}}},
+			{Name: "app", Source: "./app", DependsOn: []string{"base"}},
+		},
+		SemanticUnchanged: []string{"*.yaml"},
+	}
+	assertSameJSON(t, config, config.API())
+	assertSameJSON(t, config, RPackConfigFromAPI(config.API()))
+
+	single := &RPackConfig{SchemaVersion: "v1", Source: "./def", Config: &RPackConfigConfig{Values: map[string]any{"n": 1}}}
+	assertSameJSON(t, single, single.API())
+
+	def := &RPackDef{SchemaVersion: "v1", Name: "app", Inputs: []*RPackDefInput{{Type: "dir", Name: "src"}}, AllowTargetRead: []string{"Makefile"}, SensitiveValues: []string{"token"}}
+	assertSameJSON(t, def, def.API())
+
+	lock := NewRPackLockFile()
+	lock.AddPackFile("app", "out.txt", "abc")
+	assertSameJSON(t, lock, lock.API())
+	assertSameJSON(t, lock, RPackLockFileFromAPI(lock.API()))
+
+	plan := &Plan{
+		SchemaVersion: PlanCurrentSchemaVersion,
+		Files:         []*PlanFile{{Path: "a", Action: PlanActionModify, Managed: true, OldSha: "1", NewSha: "2", Diff: "-a\n+b\n"}},
+		Annotations:   []*Annotation{{Path: "a", Message: "note"}},
+	}
+	assertSameJSON(t, plan, plan.API())
+	if !plan.API().Changed() {
+		t.Error("Expected changed plan")
+	}
+}
+
+// setupRunConfig creates a definition running script and a config using it in a separate work dir.
+// extra is appended to the config.
+func setupRunConfig(t *testing.T, script, extra string) (config, workDir string) {
+	t.Helper()
+	dir := t.TempDir()
+	defDir := filepath.Join(dir, "def")
+	if err := os.MkdirAll(defDir, 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"rpack.yaml": "\"@schema_version\": \"v1\"\nname: \"app\"\n",
+		"script.lua": "local rpack = require(\"rpack.v1\")\n" + script,
+	} {
+		if err := os.WriteFile(filepath.Join(defDir, name), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	workDir = filepath.Join(dir, "work")
+	if err := os.MkdirAll(workDir, 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	config = filepath.Join(workDir, "app.rpack.yaml")
+	if err := os.WriteFile(config, []byte("\"@schema_version\": \"v1\"\nsource: \""+filepath.ToSlash(defDir)+"\"\n"+extra), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	return config, workDir
+}
+
+func TestRun(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"hello\\n\")\nrpack.warn(\"careful\")\n", "")
+
+	res, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Plan == nil || len(res.Plan.Files) != 1 || res.Plan.Files[0].Action != api.PlanActionAdd {
+		t.Fatalf("Expected plan adding out.txt, got %+v", res.Plan)
+	}
+	if len(res.Annotations) != 1 || res.Annotations[0].Message != "careful" {
+		t.Errorf("Expected annotation, got %+v", res.Annotations)
+	}
+	if _, err = os.Stat(filepath.Join(workDir, "out.txt")); !os.IsNotExist(err) {
+		t.Error("Dry-run must not write to the target directory")
+	}
+
+	res, err = Run(t.Context(), api.RunOptions{ConfigFile: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Files) != 1 || res.Files[0] != "out.txt" || len(res.Added) != 1 || res.Plan != nil {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "hello\n" { //nolint:gosec // test file
+		t.Errorf("Unexpected content %q", b)
+	}
+}
+
+func TestRunEmbedded(t *testing.T) {
+	workDir := t.TempDir()
+	sources := map[string]fs.FS{"./rpackdef": fstest.MapFS{
+		"rpack.yaml": {Data: []byte("\"@schema_version\": \"v1\"\nname: \"app\"\n")},
+		"script.lua": {Data: []byte("local rpack = require(\"rpack.v1\")\nrpack.write(\"out.txt\", rpack.values().greeting)\nrpack.write(\"denied.txt\", \"x\")\n")},
+	}}
+	config := []byte("\"@schema_version\": \"v1\"\nsource: \"./rpackdef\"\nconfig:\n  values:\n    greeting: hello\n")
+
+	var accesses []string
+	var phases []string
+	opts := api.RunOptions{
+		ConfigFile: filepath.Join(workDir, "app.rpack.yaml"),
+		Config:     config,
+		Sources:    sources,
+		Hooks: &api.RunHooks{
+			FileAccess: func(access *api.FileAccess) error {
+				accesses = append(accesses, access.Access+" "+access.FriendlyPath)
+				if access.FriendlyPath == "denied.txt" {
+					return errors.New("not allowed")
+				}
+				return nil
+			},
+			Progress: func(event *api.ProgressEvent) {
+				if event.Done {
+					phases = append(phases, event.Phase)
+				}
+			},
+		},
+	}
+	_, err := Run(t.Context(), opts)
+	if err == nil || !strings.Contains(err.Error(), "write access to denied.txt denied: not allowed") {
+		t.Fatalf("Expected denied access, got %v", err)
+	}
+	if !slices.Equal(accesses, []string{"write out.txt", "write denied.txt"}) {
+		t.Errorf("Unexpected accesses %v", accesses)
+	}
+
+	opts.Hooks.FileAccess = nil
+	res, err := Run(t.Context(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Files) != 2 {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "hello" { //nolint:gosec // test file
+		t.Errorf("Unexpected content %q", b)
+	}
+	if _, err = os.Stat(filepath.Join(workDir, "app.rpack.lock.yaml")); err != nil {
+		t.Errorf("Expected lockfile next to the config: %v", err)
+	}
+	if !slices.Contains(phases, "exec") || !slices.Contains(phases, "transfer") {
+		t.Errorf("Expected progress of exec and transfer, got %v", phases)
+	}
+}
+
+func TestRunLogger(t *testing.T) {
+	workDir := t.TempDir()
+	def := func(name string) fs.FS {
+		return fstest.MapFS{
+			"rpack.yaml": {Data: []byte("\"@schema_version\": \"v1\"\nname: \"" + name + "\"\n")},
+			"script.lua": {Data: []byte("print(\"hello from " + name + "\")\n")},
+		}
+	}
+	config := []byte("\"@schema_version\": \"v1\"\npacks:\n  - name: web\n    source: \"./web\"\n  - name: db\n    source: \"./db\"\n")
+	var buf strings.Builder
+	_, err := Run(t.Context(), api.RunOptions{
+		ConfigFile: filepath.Join(workDir, "app.rpack.yaml"),
+		Config:     config,
+		Sources:    map[string]fs.FS{"./web": def("web"), "./db": def("db")},
+		Logger:     slog.New(slog.NewTextHandler(&buf, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`level=INFO msg="Script: hello from web" pack=web`,
+		`level=INFO msg="Script: hello from db" pack=db`,
+		`level=INFO msg="Lockfile does not exist"`,
+		`level=INFO msg="Run summary" packs=2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in log:\n%s", want, out)
+		}
+	}
+}
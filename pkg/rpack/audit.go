@@ -0,0 +1,89 @@
+package rpack
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AuditLogCurrentSchemaVersion is the schema version of audit logs.
+const AuditLogCurrentSchemaVersion = "v1"
+
+// AuditLog lists every filesystem interaction of the packs of a run,
+// in the order they happened, for reviewing what a pack touched.
+// Interactions denied by access control are listed with the reason, they did not happen.
+type AuditLog struct {
+	SchemaVersion string         `json:"@schema_version"`
+	Records       []*AuditRecord `json:"records"`
+}
+
+// AuditRecord is a single filesystem interaction.
+type AuditRecord struct {
+	// Pack is the name of the pack, empty for single source configs
+	Pack string `json:"pack,omitempty"`
+	// Access is one of read, write, stat and readdir
+	Access       string `json:"access"`
+	Resolver     string `json:"resolver"`
+	FriendlyPath string `json:"friendly_path"`
+	// Path is the absolute path the friendly path resolved to,
+	// for target files the path in the target directory
+	Path string `json:"path"`
+	// Denied is the reason access control denied the interaction, empty if it happened
+	Denied string `json:"denied,omitempty"`
+}
+
+// handleAbsPath returns the absolute path of the file of h, empty if it is not file-backed.
+func handleAbsPath(h FSHandle) string {
+	p := h.AbsPath()
+	if abs, err := filepath.Abs(p); p != "" && err == nil {
+		p = abs
+	}
+	return p
+}
+
+// NewAuditLog creates an empty audit log.
+func NewAuditLog() *AuditLog {
+	return &AuditLog{
+		SchemaVersion: AuditLogCurrentSchemaVersion,
+		Records:       []*AuditRecord{},
+	}
+}
+
+// add appends the interactions recorded by fs for pack.
+// The log may be nil if auditing is disabled, fs may be nil if the pack did not run.
+func (l *AuditLog) add(pack string, fs *RPackFS) {
+	if l == nil || fs == nil {
+		return
+	}
+	for _, record := range fs.Recorder().AllRecords() {
+		r := &AuditRecord{
+			Pack:         pack,
+			Access:       record.Typ.String(),
+			Resolver:     record.Handle.Resolver(),
+			FriendlyPath: record.Handle.FriendlyPath(),
+			Path:         handleAbsPath(record.Handle),
+		}
+		if record.Denied != nil {
+			r.Denied = RedactSecrets(record.Denied.Error())
+		}
+		l.Records = append(l.Records, r)
+	}
+}
+
+// WriteFile writes the audit log as JSON to path.
+func (l *AuditLog) WriteFile(path string) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit log: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err = os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec // standard permissions
+			return fmt.Errorf("could not create audit log directory: %s: %w", dir, err)
+		}
+	}
+	if err = os.WriteFile(path, append(b, '\n'), 0o644); err != nil { //nolint:gosec // intentional: path comes from user
+		return fmt.Errorf("failed to write audit log: %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package rpack
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readAuditLog(t *testing.T, name string) *AuditLog {
+	t.Helper()
+	b, err := os.ReadFile(name) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	var l AuditLog
+	if err = json.Unmarshal(b, &l); err != nil {
+		t.Fatal(err)
+	}
+	return &l
+}
+
+func TestAuditLog(t *testing.T) {
+	script := `local def = rpack.read("rpack:rpack.yaml")
+rpack.write("./out.txt", def)
+`
+	config, workDir := setupRunConfig(t, script, "")
+	ci, err := LoadRPackConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditFile := filepath.Join(t.TempDir(), "audit", "log.json")
+	e := &Executor{AuditLog: auditFile}
+	if err = e.ExecRPackConfig(t.Context(), ci); err != nil {
+		t.Fatal(err)
+	}
+
+	l := readAuditLog(t, auditFile)
+	if l.SchemaVersion != AuditLogCurrentSchemaVersion || len(l.Records) != 2 {
+		t.Fatalf("Unexpected audit log %+v", l)
+	}
+	read, write := l.Records[0], l.Records[1]
+	if read.Access != "read" || read.Resolver != RPackResolver || read.FriendlyPath != "rpack:rpack.yaml" || filepath.Base(read.Path) != "rpack.yaml" {
+		t.Errorf("Unexpected read record %+v", read)
+	}
+	if write.Access != "write" || write.Resolver != TargetResolver || write.Path != filepath.Join(workDir, "out.txt") {
+		t.Errorf("Unexpected write record %+v", write)
+	}
+}
+
+func TestAuditLogFailedRun(t *testing.T) {
+	script := `rpack.write("./out.txt", "hello")
+error("boom")
+`
+	config, _ := setupRunConfig(t, script, "")
+	ci, err := LoadRPackConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditFile := filepath.Join(t.TempDir(), "log.json")
+	e := &Executor{AuditLog: auditFile}
+	if err = e.ExecRPackConfig(t.Context(), ci); err == nil {
+		t.Fatal("Expected run to fail")
+	}
+
+	l := readAuditLog(t, auditFile)
+	if len(l.Records) != 1 || l.Records[0].Access != "write" || l.Records[0].FriendlyPath != "out.txt" {
+		t.Errorf("Expected the write before the failure, got %+v", l.Records)
+	}
+}
+
+func TestAuditLogDenied(t *testing.T) {
+	script := `pcall(rpack.write, ".git/config", "[core]")
+rpack.write("./out.txt", "hello")
+`
+	config, _ := setupRunConfig(t, script, "")
+	ci, err := LoadRPackConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditFile := filepath.Join(t.TempDir(), "log.json")
+	e := &Executor{AuditLog: auditFile}
+	_ = e.ExecRPackConfig(t.Context(), ci)
+
+	l := readAuditLog(t, auditFile)
+	if len(l.Records) != 2 {
+		t.Fatalf("Expected the denied and the allowed write, got %+v", l.Records)
+	}
+	denied, write := l.Records[0], l.Records[1]
+	if denied.Access != "write" || denied.FriendlyPath != ".git/config" || !strings.Contains(denied.Denied, "not allowed to write") {
+		t.Errorf("Unexpected denied record %+v", denied)
+	}
+	if write.FriendlyPath != "out.txt" || write.Denied != "" {
+		t.Errorf("Unexpected write record %+v", write)
+	}
+}
@@ -0,0 +1,304 @@
+package rpack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blang/rpack/pkg/lockfile"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// RPackCacheDirBaseline is the directory below RPackCacheDir the generated content of the applied files
+// is stored in. It is the base of three-way merges and diffs of files modified outside of rpack.
+const RPackCacheDirBaseline = "baseline"
+
+// Directories of the baseline store.
+const (
+	// baselineObjectsDir holds the gzip compressed content, addressed by the lockfile checksum:
+	// objects/<algorithm>/<first two hex digits>/<checksum>.gz
+	baselineObjectsDir = "objects"
+	// baselineRefsDir holds a file per config listing the objects its lockfile references,
+	// after a header line with the path of the config
+	baselineRefsDir = "refs"
+	// baselineRefsConfigHeader starts the header line of a refs file
+	baselineRefsConfigHeader = "# config: "
+)
+
+// baselineStore is the content-addressed store of the generated content of the applied files.
+// Identical content of several files and configs is stored once.
+type baselineStore struct {
+	dir string
+}
+
+// newBaselineStore returns the baseline store of the target execPath.
+func newBaselineStore(execPath string) *baselineStore {
+	return &baselineStore{dir: filepath.Join(execPath, RPackCacheDir, RPackCacheDirBaseline)}
+}
+
+// objectKey returns the slash separated key of the object with the content of the lockfile entry.
+// Checksums are validated, so a modified lockfile can not address files outside the store.
+func objectKey(entry *RPackLockFileFile) (string, error) {
+	algorithm := entry.Algorithm
+	if algorithm == "" {
+		algorithm = lockfile.SHA256
+	}
+	if _, err := lockfile.LookupAlgorithm(algorithm); err != nil {
+		return "", err
+	}
+	if _, err := hex.DecodeString(entry.Sha); err != nil || len(entry.Sha) < 4 {
+		return "", fmt.Errorf("invalid checksum of: %s: %q", entry.Path, entry.Sha)
+	}
+	return algorithm + "/" + entry.Sha[:2] + "/" + entry.Sha + ".gz", nil
+}
+
+// objectPath returns the path of the object with key.
+func (s *baselineStore) objectPath(key string) string {
+	return util.LongPath(filepath.Join(s.dir, baselineObjectsDir, filepath.FromSlash(key)))
+}
+
+// read returns the stored generated content of the lockfile entry, ok is false if there is none
+// or it does not match the checksum of the entry.
+func (s *baselineStore) read(entry *RPackLockFileFile) (content []byte, ok bool, err error) {
+	key, err := objectKey(entry)
+	if err != nil {
+		return nil, false, err
+	}
+	f, err := os.Open(s.objectPath(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read baseline of: %s: %w", entry.Path, err)
+	}
+	defer func() { _ = f.Close() }()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read baseline of: %s: %w", entry.Path, err)
+	}
+	if content, err = io.ReadAll(zr); err != nil {
+		return nil, false, fmt.Errorf("failed to read baseline of: %s: %w", entry.Path, err)
+	}
+	if sum, err := checksumBytes(entry.Algorithm, content); err != nil || sum != entry.Sha {
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+// store saves the generated content of the files of lock, taken from generated for merged files
+// and from the target files below execPath otherwise. Content not matching the checksum of its entry,
+// e.g. of files kept because they are semantically equal, is not stored.
+// The objects referenced by no config any more are removed afterwards, see gc.
+func (s *baselineStore) store(log *slog.Logger, configFile string, lock *RPackLockFile, execPath string, generated map[string][]byte) error {
+	keys := make([]string, 0, len(lock.Files))
+	for _, entry := range lock.Files {
+		key, err := objectKey(entry)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		name := s.objectPath(key)
+		if exists, _ := util.FileExists(name); exists {
+			continue
+		}
+		content, ok := generated[entry.Path]
+		if !ok {
+			if content, err = os.ReadFile(util.LongPath(filepath.Join(execPath, entry.Path))); err != nil { //nolint:gosec // path constructed from exec path
+				return fmt.Errorf("failed to read applied file: %s: %w", entry.Path, err)
+			}
+		}
+		if sum, err := checksumBytes(entry.Algorithm, content); err != nil || sum != entry.Sha {
+			log.Debug("Not storing baseline of file differing from lockfile", "file", entry.Path)
+			continue
+		}
+		if err = s.writeObject(name, content); err != nil {
+			return fmt.Errorf("failed to store baseline of: %s: %w", entry.Path, err)
+		}
+	}
+	slices.Sort(keys)
+	refsDir := filepath.Join(s.dir, baselineRefsDir)
+	if err := os.MkdirAll(refsDir, 0o755); err != nil { //nolint:gosec // standard permissions
+		return fmt.Errorf("failed to store baseline refs: %w", err)
+	}
+	configName := strings.TrimSuffix(filepath.Base(configFile), RPackFileSuffix)
+	refs := baselineRefsConfigHeader + configFile + "\n" + strings.Join(slices.Compact(keys), "\n")
+	if err := os.WriteFile(filepath.Join(refsDir, configName), []byte(refs), 0o644); err != nil { //nolint:gosec // cache file
+		return fmt.Errorf("failed to store baseline refs: %w", err)
+	}
+	return s.gc(configName)
+}
+
+// writeObject compresses content into a temp file renamed to name, readers never see partial objects.
+func (s *baselineStore) writeObject(name string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil { //nolint:gosec // standard permissions
+		return err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// gc removes the refs of configs that were deleted or renamed and the objects not listed in the refs
+// of any config. The refs of the config current were just written and are kept.
+func (s *baselineStore) gc(current string) error {
+	refsDir := filepath.Join(s.dir, baselineRefsDir)
+	refFiles, err := os.ReadDir(refsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read baseline refs: %w", err)
+	}
+	referenced := make(map[string]struct{})
+	for _, ref := range refFiles {
+		name := filepath.Join(refsDir, ref.Name())
+		b, err := os.ReadFile(name) //nolint:gosec // cache file
+		if err != nil {
+			return fmt.Errorf("failed to read baseline refs: %w", err)
+		}
+		if ref.Name() != current && !s.refsConfigExists(ref.Name(), string(b)) {
+			if err = os.Remove(name); err != nil {
+				return fmt.Errorf("failed to remove baseline refs: %w", err)
+			}
+			continue
+		}
+		for key := range strings.Lines(string(b)) {
+			referenced[strings.TrimSpace(key)] = struct{}{}
+		}
+	}
+	objectsDir := filepath.Join(s.dir, baselineObjectsDir)
+	err = filepath.WalkDir(objectsDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(objectsDir, name)
+		if err != nil {
+			return err
+		}
+		if _, ok := referenced[filepath.ToSlash(rel)]; ok {
+			return nil
+		}
+		return os.Remove(name)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove unreferenced baselines: %w", err)
+	}
+	return nil
+}
+
+// refsConfigExists reports if the config of the refs file name with content refs still exists.
+// Refs files without header belong to a config next to the target.
+func (s *baselineStore) refsConfigExists(name, refs string) bool {
+	configFile := filepath.Join(filepath.Dir(filepath.Dir(s.dir)), name+RPackFileSuffix)
+	if header, _, _ := strings.Cut(refs, "\n"); strings.HasPrefix(header, baselineRefsConfigHeader) {
+		configFile = strings.TrimPrefix(header, baselineRefsConfigHeader)
+	}
+	exists, err := util.FileExists(configFile)
+	return exists || err != nil
+}
+
+// baselineDiffs returns the unified diffs from the stored baselines to the target files of the
+// lockfile entries with paths, e.g. the files modified outside of rpack.
+// Files without baseline are left out, binary files get a short note.
+func baselineDiffs(store *baselineStore, execPath string, lock *RPackLockFile, paths []string) (map[string]string, error) {
+	diffs := make(map[string]string)
+	for _, entry := range lock.Files {
+		if !slices.Contains(paths, entry.Path) {
+			continue
+		}
+		base, ok, err := store.read(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		local, exists, err := readTargetFile(filepath.Join(execPath, entry.Path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read modified file: %s: %w", entry.Path, err)
+		}
+		oldName, newName := "a/"+entry.Path, "b/"+entry.Path
+		if !exists {
+			newName = "/dev/null"
+		}
+		if isBinary(base) || isBinary(local) {
+			diffs[entry.Path] = fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+			continue
+		}
+		diffs[entry.Path] = UnifiedDiff(oldName, newName, base, local)
+	}
+	return diffs, nil
+}
+
+// mergeModified merges the changes of target files modified outside of rpack into the generated files
+// of the run directories, see Merge3. The base is the stored baseline of the lockfile entry.
+// Files that can not be merged are returned in unmerged: files no longer generated, files without baseline
+// and binary files. generated holds the generated content of the merged files.
+func mergeModified(log *slog.Logger, store *baselineStore, execPath string, modified []string, files []*packTargetFile, lock *RPackLockFile) (generated map[string][]byte, conflicts, unmerged []string, err error) {
+	generated = make(map[string][]byte)
+	for _, p := range modified {
+		fileIdx := slices.IndexFunc(files, func(f *packTargetFile) bool { return f.Path == p })
+		entryIdx := slices.IndexFunc(lock.Files, func(f *RPackLockFileFile) bool { return f.Path == p })
+		if fileIdx < 0 || entryIdx < 0 {
+			unmerged = append(unmerged, p)
+			continue
+		}
+		f := files[fileIdx]
+		base, ok, err := store.read(lock.Files[entryIdx])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if !ok {
+			log.Warn("No baseline of modified file to merge", "file", p)
+			unmerged = append(unmerged, p)
+			continue
+		}
+		local, err := os.ReadFile(util.LongPath(filepath.Join(execPath, p))) //nolint:gosec // path constructed from exec path
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read modified file: %s: %w", p, err)
+		}
+		gen, err := os.ReadFile(util.LongPath(f.AbsPath))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read generated file: %s: %w", p, err)
+		}
+		if isBinary(base) || isBinary(local) || isBinary(gen) {
+			log.Warn("Binary file can not be merged", "file", p)
+			unmerged = append(unmerged, p)
+			continue
+		}
+		merged, n := Merge3(base, local, gen)
+		if err = writeFileUnlinked(util.LongPath(f.AbsPath), merged, generatedFilePerm); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to write merged file: %s: %w", p, err)
+		}
+		generated[p] = gen
+		if n > 0 {
+			conflicts = append(conflicts, p)
+		}
+	}
+	return generated, conflicts, unmerged, nil
+}
@@ -0,0 +1,107 @@
+package rpack
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBaselineStore(t *testing.T) {
+	execPath := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "same\n", "b.txt": "same\n", "c.txt": "other\n", "app.rpack.yaml": ""} {
+		if err := os.WriteFile(filepath.Join(execPath, name), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	lock := NewRPackLockFile()
+	lock.AddPackFile("", "a.txt", sha256Hex([]byte("same\n")))
+	lock.AddPackFile("", "b.txt", sha256Hex([]byte("same\n")))
+	lock.AddPackFile("", "c.txt", sha256Hex([]byte("generated\n")))
+	store := newBaselineStore(execPath)
+	log := slog.New(slog.DiscardHandler)
+	if err := store.store(log, filepath.Join(execPath, "app.rpack.yaml"), lock, execPath, map[string][]byte{"c.txt": []byte("generated\n")}); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, _ := filepath.Glob(filepath.Join(execPath, RPackCacheDir, RPackCacheDirBaseline, baselineObjectsDir, "sha256", "*", "*.gz"))
+	if len(objects) != 2 {
+		t.Fatalf("Expected identical content to be stored once, got %v", objects)
+	}
+	for _, entry := range lock.Files {
+		content, ok, err := store.read(entry)
+		if err != nil || !ok {
+			t.Fatalf("Expected baseline of %s, got %v, %v", entry.Path, ok, err)
+		}
+		if sha256Hex(content) != entry.Sha {
+			t.Errorf("Unexpected baseline of %s: %q", entry.Path, content)
+		}
+	}
+
+	// Modified files are diffed against their baseline
+	diffs, err := baselineDiffs(store, execPath, lock, []string{"c.txt"})
+	if err != nil || !strings.Contains(diffs["c.txt"], "-generated\n+other\n") {
+		t.Fatalf("Unexpected diff: %q, %v", diffs["c.txt"], err)
+	}
+
+	// Corrupted objects are no baseline
+	if err = os.WriteFile(objects[0], []byte("garbage"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	var corrupted int
+	for _, entry := range lock.Files {
+		if _, ok, _ := store.read(entry); !ok {
+			corrupted++
+		}
+	}
+	if corrupted == 0 {
+		t.Error("Expected corrupted object to be rejected")
+	}
+
+	// Objects no config references are removed
+	lock.Files = lock.Files[2:]
+	if err = store.store(log, filepath.Join(execPath, "app.rpack.yaml"), lock, execPath, map[string][]byte{"c.txt": []byte("generated\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if objects, _ = filepath.Glob(filepath.Join(execPath, RPackCacheDir, RPackCacheDirBaseline, baselineObjectsDir, "sha256", "*", "*.gz")); len(objects) != 1 {
+		t.Errorf("Expected unreferenced objects to be removed, got %v", objects)
+	}
+
+	// The refs of deleted or renamed configs are removed with their objects
+	other := NewRPackLockFile()
+	other.AddPackFile("", "a.txt", sha256Hex([]byte("same\n")))
+	if err = store.store(log, filepath.Join(execPath, "old.rpack.yaml"), other, execPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if objects, _ = filepath.Glob(filepath.Join(execPath, RPackCacheDir, RPackCacheDirBaseline, baselineObjectsDir, "sha256", "*", "*.gz")); len(objects) != 2 {
+		t.Fatalf("Expected the objects of both configs, got %v", objects)
+	}
+	if err = store.store(log, filepath.Join(execPath, "app.rpack.yaml"), lock, execPath, map[string][]byte{"c.txt": []byte("generated\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(execPath, RPackCacheDir, RPackCacheDirBaseline, baselineRefsDir, "old")); !os.IsNotExist(err) {
+		t.Errorf("Expected refs of the deleted config to be removed, got %v", err)
+	}
+	if objects, _ = filepath.Glob(filepath.Join(execPath, RPackCacheDir, RPackCacheDirBaseline, baselineObjectsDir, "sha256", "*", "*.gz")); len(objects) != 1 {
+		t.Errorf("Expected the objects of the deleted config to be removed, got %v", objects)
+	}
+}
+
+func TestCheckerDiffOutput(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"generated\\n\")\n", "")
+	if err := (&Executor{}).ExecRPack(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "out.txt"), []byte("local\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := (&Checker{DiffOutput: &out}).CheckIntegrity(t.Context(), config); err == nil {
+		t.Fatal("Expected modified file to fail the check")
+	}
+	if !strings.Contains(out.String(), "--- a/out.txt\n+++ b/out.txt\n") || !strings.Contains(out.String(), "-generated\n+local\n") {
+		t.Errorf("Unexpected diff:\n%s", out.String())
+	}
+}
@@ -0,0 +1,327 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+
+	"github.com/blang/rpack/pkg/rpack/getsource"
+)
+
+// BisectOptions configures a bisect over the git revisions of a pack source.
+type BisectOptions struct {
+	// Pack selects the pack of a multi-pack config, optional for single source configs
+	Pack string
+
+	// Good is a revision known to render the file as expected
+	Good string
+
+	// Bad is a revision showing the change, defaults to the ref of the source or HEAD
+	Bad string
+
+	// File is the target file to inspect, relative to the execution path
+	File string
+
+	// Match is a string or glob (with * and ?) a line of the rendered file
+	// has to contain/match for a revision to be bad.
+	// If empty, every change of the file compared to the good revision is bad.
+	Match string
+}
+
+// BisectResult describes the first bad revision found.
+type BisectResult struct {
+	Revision string
+	Subject  string
+	Author   string
+	Date     string
+
+	// LastGood is the revision preceding Revision
+	LastGood string
+
+	// Number of revisions between good and bad, and how many were rendered
+	Candidates int
+	Tested     int
+
+	// Diff of the file between LastGood and Revision
+	Diff string
+}
+
+// gitSource is a git source address split into its parts.
+type gitSource struct {
+	Repo   string
+	SubDir string
+	Ref    string
+}
+
+// parseGitSource extracts repository, subdirectory and ref of a git source.
+func parseGitSource(src string) (*gitSource, error) {
+	result, err := getsource.NormalizeSource(src)
+	if err != nil {
+		return nil, fmt.Errorf("source detection failed: %w", err)
+	}
+	repo, ok := strings.CutPrefix(result, "git::")
+	if !ok {
+		return nil, fmt.Errorf("bisect requires a git source, got %q", src)
+	}
+	repo, subDir := getsource.SplitSourceSubdir(repo)
+	gs := &gitSource{SubDir: subDir}
+	repo, rawQuery, _ := strings.Cut(repo, "?")
+	gs.Repo = repo
+	if rawQuery != "" {
+		q, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source query %q: %w", rawQuery, err)
+		}
+		gs.Ref = q.Get("ref")
+	}
+	return gs, nil
+}
+
+// runGit runs git in dir and returns the trimmed stdout.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...) //nolint:gosec // intentional: git arguments from config and CLI
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// resolveRevision resolves a ref of a fresh clone to a commit hash,
+// branches are looked up on the origin remote as well.
+func resolveRevision(ctx context.Context, repoDir, ref string) (string, error) {
+	for _, candidate := range []string{ref, "origin/" + ref} {
+		if rev, err := runGit(ctx, repoDir, "rev-parse", "--verify", "--quiet", candidate+"^{commit}"); err == nil {
+			return rev, nil
+		}
+	}
+	return "", fmt.Errorf("unknown revision %q", ref)
+}
+
+// newContentMatcher returns a function reporting if content matches the pattern.
+// Patterns containing * or ? are matched against each line, others are substrings.
+func newContentMatcher(pattern string) func([]byte) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return func(b []byte) bool { return bytes.Contains(b, []byte(pattern)) }
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	re := regexp.MustCompile(sb.String())
+	return func(b []byte) bool {
+		for _, line := range splitLines(string(b)) {
+			if re.MatchString(strings.TrimRight(line, "\r\n")) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// renderedFile is the content of the target file rendered at a revision.
+type renderedFile struct {
+	Content []byte
+	Exists  bool
+}
+
+// Bisect searches the first revision of a git pack source between
+// opts.Good and opts.Bad that changes the rendered target file.
+// Revisions are rendered like a dry-run, the target directory is not modified.
+//
+//nolint:gocognit,gocyclo // intentional: bisect orchestration
+func (e *Executor) Bisect(ctx context.Context, name string, opts BisectOptions) (*BisectResult, error) {
+	ci, err := e.loader().LoadRPackConfig(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not load rpack config: %s: %w", name, err)
+	}
+	execPath := ci.ConfigPath
+	if e.OverrideExecPath != "" {
+		execPath = e.OverrideExecPath
+	}
+
+	packs := ci.Config.PackList()
+	var pack *RPackConfigPack
+	switch {
+	case opts.Pack != "":
+		pack, _ = lo.Find(packs, func(p *RPackConfigPack) bool { return p.Name == opts.Pack })
+		if pack == nil {
+			return nil, fmt.Errorf("pack %q not found in config", opts.Pack)
+		}
+	case len(packs) > 1:
+		return nil, fmt.Errorf("config declares multiple packs, select one to bisect")
+	default:
+		pack = packs[0]
+	}
+
+	file := filepath.Clean(opts.File)
+	if !filepath.IsLocal(file) {
+		return nil, fmt.Errorf("target file %s is not local", opts.File)
+	}
+	if opts.Good == "" {
+		return nil, fmt.Errorf("good revision is required")
+	}
+
+	src, err := parseGitSource(pack.Source)
+	if err != nil {
+		return nil, err
+	}
+	bad := opts.Bad
+	if bad == "" {
+		bad = lo.Ternary(src.Ref != "", src.Ref, "HEAD")
+	}
+
+	workDir, err := os.MkdirTemp("", "rpack-bisect-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create bisect directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(workDir) }()
+
+	repoDir := filepath.Join(workDir, "repo")
+	e.log().Info("Cloning source repository", "repo", src.Repo)
+	if _, err = runGit(ctx, workDir, "clone", "--quiet", "--no-checkout", "--", src.Repo, repoDir); err != nil {
+		return nil, fmt.Errorf("could not clone source: %w", err)
+	}
+
+	goodRev, err := resolveRevision(ctx, repoDir, opts.Good)
+	if err != nil {
+		return nil, fmt.Errorf("invalid good revision: %w", err)
+	}
+	badRev, err := resolveRevision(ctx, repoDir, bad)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bad revision: %w", err)
+	}
+	if _, err = runGit(ctx, repoDir, "merge-base", "--is-ancestor", goodRev, badRev); err != nil {
+		return nil, fmt.Errorf("good revision %s is not an ancestor of bad revision %s", opts.Good, bad)
+	}
+	list, err := runGit(ctx, repoDir, "rev-list", "--reverse", "--first-parent", "--ancestry-path", goodRev+".."+badRev)
+	if err != nil {
+		return nil, fmt.Errorf("could not list revisions: %w", err)
+	}
+	if list == "" {
+		return nil, fmt.Errorf("no revisions between good and bad")
+	}
+	revs := append([]string{goodRev}, strings.Split(list, "\n")...)
+
+	rendered := make(map[string]*renderedFile)
+	render := func(rev string) (*renderedFile, error) {
+		if r, ok := rendered[rev]; ok {
+			return r, nil
+		}
+		e.log().Info("Rendering revision", "revision", rev)
+		r, renderErr := e.renderAtRevision(ctx, ci, pack, repoDir, src.SubDir, rev, execPath, file)
+		if renderErr != nil {
+			return nil, fmt.Errorf("revision %s: %w", rev, renderErr)
+		}
+		rendered[rev] = r
+		return r, nil
+	}
+
+	good, err := render(goodRev)
+	if err != nil {
+		return nil, err
+	}
+	isBad := func(r *renderedFile) bool {
+		return r.Exists != good.Exists || !bytes.Equal(r.Content, good.Content)
+	}
+	if opts.Match != "" {
+		match := newContentMatcher(opts.Match)
+		if good.Exists && match(good.Content) {
+			return nil, fmt.Errorf("good revision %s already matches %q", opts.Good, opts.Match)
+		}
+		isBad = func(r *renderedFile) bool { return r.Exists && match(r.Content) }
+	}
+
+	goodIdx, badIdx := 0, len(revs)-1
+	r, err := render(revs[badIdx])
+	if err != nil {
+		return nil, err
+	}
+	if !isBad(r) {
+		return nil, fmt.Errorf("bad revision %s does not show the change", bad)
+	}
+	for badIdx-goodIdx > 1 {
+		mid := (goodIdx + badIdx) / 2
+		if r, err = render(revs[mid]); err != nil {
+			return nil, err
+		}
+		if isBad(r) {
+			badIdx = mid
+		} else {
+			goodIdx = mid
+		}
+	}
+
+	info, err := runGit(ctx, repoDir, "log", "-1", "--format=%s%x00%an <%ae>%x00%aI", revs[badIdx])
+	if err != nil {
+		return nil, fmt.Errorf("could not read revision info: %w", err)
+	}
+	parts := strings.SplitN(info, "\x00", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return &BisectResult{
+		Revision:   revs[badIdx],
+		Subject:    parts[0],
+		Author:     parts[1],
+		Date:       parts[2],
+		LastGood:   revs[goodIdx],
+		Candidates: len(revs) - 1,
+		Tested:     len(rendered),
+		Diff:       UnifiedDiff("a/"+file, "b/"+file, rendered[revs[goodIdx]].Content, rendered[revs[badIdx]].Content),
+	}, nil
+}
+
+// renderAtRevision checks out a revision of the source repository and executes the pack,
+// returning the rendered target file. Cache directories of the revision are removed afterwards.
+func (e *Executor) renderAtRevision(ctx context.Context, ci *RPackConfigInstance, pack *RPackConfigPack, repoDir, subDir, rev, execPath, file string) (*renderedFile, error) {
+	treeDir := filepath.Join(filepath.Dir(repoDir), rev)
+	if _, err := runGit(ctx, repoDir, "worktree", "add", "--quiet", "--detach", treeDir, rev); err != nil {
+		return nil, fmt.Errorf("could not check out revision: %w", err)
+	}
+	defer func() {
+		if _, err := runGit(context.WithoutCancel(ctx), repoDir, "worktree", "remove", "--force", treeDir); err != nil {
+			e.log().Warn("Failed to remove worktree", "dir", treeDir, "error", err)
+		}
+	}()
+
+	revPack := *pack
+	revPack.Source = filepath.Join(treeDir, subDir)
+	pi, err := LoadRPackPack(ci, &revPack, execPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load rpack: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(pi.CachePath) }()
+
+	packConfig := pack.ConfigOrEmpty()
+	if _, _, err = e.execCore(ctx, pack.Name, newPackMeta(ci, pack.Source, execPath), pi.SourcePath, pack.Script, pi.RunPath, pi.TempPath, pi.ExecPath, pi.ResolvedInputs, packConfig.Values, slices.Sorted(maps.Keys(packConfig.Inputs)), packConfig.Values); err != nil {
+		return nil, err
+	}
+	content, exists, err := readTargetFile(filepath.Join(pi.RunPath, file))
+	if err != nil {
+		return nil, err
+	}
+	return &renderedFile{Content: content, Exists: exists}, nil
+}
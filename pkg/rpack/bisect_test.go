@@ -0,0 +1,119 @@
+package rpack
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupBisectRepo creates a git repository with a definition below def/
+// and one commit per content of the rendered out.txt.
+func setupBisectRepo(t *testing.T, contents []string) (repo string, revs []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo = t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := runGit(t.Context(), repo, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		return out
+	}
+	git("init", "--quiet", "--initial-branch=main")
+	defDir := filepath.Join(repo, "def")
+	if err := os.MkdirAll(defDir, 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(defDir, "rpack.yaml"), []byte("\"@schema_version\": \"v1\"\nname: \"bisect\"\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	for i, content := range contents {
+		script := "local rpack = require(\"rpack.v1\")\nrpack.write(\"./out.txt\", " + `"` + content + `\n"` + ")\n"
+		if err := os.WriteFile(filepath.Join(defDir, "script.lua"), []byte(script), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+		git("add", "-A")
+		git("commit", "--quiet", "--allow-empty", "-m", "commit "+string(rune('a'+i)))
+		revs = append(revs, git("rev-parse", "HEAD"))
+	}
+	return repo, revs
+}
+
+func TestBisect(t *testing.T) {
+	repo, revs := setupBisectRepo(t, []string{"port: 80", "port: 80", "port: 80", "port: 8080", "port: 8080", "port: 9090"})
+	workDir := t.TempDir()
+	config := filepath.Join(workDir, "app.rpack.yaml")
+	source := "git::file://" + filepath.ToSlash(repo) + "//def"
+	if err := os.WriteFile(config, []byte("\"@schema_version\": \"v1\"\nsource: \""+source+"\"\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	e := &Executor{}
+	res, err := e.Bisect(t.Context(), config, BisectOptions{Good: revs[0], Bad: "main", File: "out.txt"})
+	if err != nil {
+		t.Fatalf("Bisect failed: %s", err)
+	}
+	if res.Revision != revs[3] || res.LastGood != revs[2] || res.Subject != "commit d" {
+		t.Errorf("Expected first change at %s, got %s (%s)", revs[3], res.Revision, res.Subject)
+	}
+	if !strings.Contains(res.Diff, "-port: 80\n+port: 8080") {
+		t.Errorf("Unexpected diff:\n%s", res.Diff)
+	}
+	if res.Candidates != 5 || res.Tested >= 6 {
+		t.Errorf("Expected a binary search over 5 revisions, tested %d of %d", res.Tested, res.Candidates)
+	}
+
+	res, err = e.Bisect(t.Context(), config, BisectOptions{Good: revs[0], File: "out.txt", Match: "port: 9*"})
+	if err != nil {
+		t.Fatalf("Bisect with glob failed: %s", err)
+	}
+	if res.Revision != revs[5] {
+		t.Errorf("Expected glob match at %s, got %s", revs[5], res.Revision)
+	}
+
+	if _, err = e.Bisect(t.Context(), config, BisectOptions{Good: revs[0], Bad: revs[2], File: "out.txt"}); err == nil || !strings.Contains(err.Error(), "does not show the change") {
+		t.Errorf("Expected error for unchanged bad revision, got %v", err)
+	}
+	if _, err = e.Bisect(t.Context(), config, BisectOptions{Good: revs[3], File: "out.txt", Match: "8080"}); err == nil || !strings.Contains(err.Error(), "already matches") {
+		t.Errorf("Expected error for matching good revision, got %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(workDir, RPackCacheDir)); len(entries) != 0 {
+		t.Errorf("Expected revision caches to be removed, got %d entries", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "out.txt")); !os.IsNotExist(err) {
+		t.Errorf("Bisect must not write to the target directory")
+	}
+}
+
+func TestParseGitSource(t *testing.T) {
+	gs, err := parseGitSource("git::https://example.com/org/repo.git//packs/app?ref=v1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gs.Repo != "https://example.com/org/repo.git" || gs.SubDir != "packs/app" || gs.Ref != "v1.2.0" {
+		t.Errorf("Unexpected git source %+v", gs)
+	}
+	if _, err := parseGitSource("/some/local/dir"); err == nil {
+		t.Errorf("Expected error for non-git source")
+	}
+}
+
+func TestContentMatcher(t *testing.T) {
+	content := []byte("name: app\ntimeout: 30s\n")
+	for pattern, want := range map[string]bool{
+		"timeout: 30":  true,
+		"timeout: *":   true,
+		"timeout: 3?s": true,
+		"time*: 1*":    false,
+		"retries":      false,
+	} {
+		if got := newContentMatcher(pattern)(content); got != want {
+			t.Errorf("Pattern %q: expected %t, got %t", pattern, want, got)
+		}
+	}
+}
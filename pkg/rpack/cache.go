@@ -0,0 +1,198 @@
+package rpack
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// CacheEntry is a cached definition with the run and temp dirs of the configs using it,
+// stored in .rpack.d/<sha256 of source>.
+type CacheEntry struct {
+	// Key is the name of the entry directory
+	Key  string
+	Path string
+	// Source of the config referencing the entry, empty if unreferenced
+	Source string
+	// Size of the entry in bytes, symlinks to local sources are not followed
+	Size int64
+	// LastUsed is the time the entry was last fetched or run
+	LastUsed time.Time
+}
+
+// Referenced reports if a config uses the entry.
+func (e *CacheEntry) Referenced() bool {
+	return e.Source != ""
+}
+
+// CacheGCOptions configures which cache entries are removed.
+type CacheGCOptions struct {
+	// Dir is the directory containing the .rpack.d cache
+	Dir string
+	// ConfigFiles using the cache in addition to the configs in Dir, for runs with --working-dir
+	ConfigFiles []string
+	// TTL removes entries not used for longer, 0 keeps referenced entries regardless of age
+	TTL time.Duration
+	// DryRun only reports the entries that would be removed
+	DryRun bool
+	// Lenient ignores unknown fields in the configs instead of failing
+	Lenient bool
+}
+
+// isCacheKey reports if name is the directory name of a cache entry.
+func isCacheKey(name string) bool {
+	b, err := hex.DecodeString(name)
+	return err == nil && len(b) == 32
+}
+
+// cacheSources returns the sources used by the configs in dir and configFiles, keyed by cache key.
+// The sources of the dependencies of cached definitions are used as well, see RPackDef.Dependencies.
+func (l Loader) cacheSources(dir string, configFiles []string) (map[string]string, error) {
+	found, err := filepath.Glob(filepath.Join(dir, "*"+RPackFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]string)
+	var packs []*RPackConfigPack
+	for _, name := range append(found, configFiles...) {
+		config, err := l.loadRPackFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not load rpack config %s, fix or move it before collecting garbage: %w", name, err)
+		}
+		packs = append(packs, config.PackList()...)
+	}
+	for len(packs) > 0 {
+		pack := packs[0]
+		packs = packs[1:]
+		key := util.Sha256String(pack.Source)
+		if _, ok := sources[key]; ok {
+			continue
+		}
+		sources[key] = pack.Source
+		// Definitions that were not fetched yet have no cached dependencies
+		defDir, err := cachedDefDir(dir, pack)
+		if err != nil {
+			continue
+		}
+		def, err := l.LoadRPackDef(filepath.Join(defDir, RPackDefDefaultFilename))
+		if err != nil {
+			continue
+		}
+		for _, dep := range def.Dependencies {
+			if source, err := defDependencySource(pack.Source, dep.Source); err == nil && dep.Source != "" {
+				packs = append(packs, &RPackConfigPack{Name: dep.Name, Source: source})
+			}
+		}
+	}
+	return sources, nil
+}
+
+// ListCache lists the entries of the cache in dir, most recently used first.
+// Entries are referenced if a config in dir or one of configFiles uses their source.
+func ListCache(dir string, configFiles []string) ([]*CacheEntry, error) {
+	return Loader{}.ListCache(dir, configFiles)
+}
+
+// ListCache is ListCache decoding the configs with the options of l.
+func (l Loader) ListCache(dir string, configFiles []string) ([]*CacheEntry, error) {
+	sources, err := l.cacheSources(dir, configFiles)
+	if err != nil {
+		return nil, err
+	}
+	return listCacheEntries(dir, sources)
+}
+
+// listCacheEntries lists the entries of the cache in dir, using sources to mark referenced entries.
+func listCacheEntries(dir string, sources map[string]string) ([]*CacheEntry, error) {
+	cacheDir := filepath.Join(dir, RPackCacheDir)
+	dirEntries, err := os.ReadDir(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read cache: %w", err)
+	}
+	var entries []*CacheEntry
+	for _, d := range dirEntries {
+		if !d.IsDir() || !isCacheKey(d.Name()) {
+			continue
+		}
+		e := &CacheEntry{Key: d.Name(), Path: filepath.Join(cacheDir, d.Name()), Source: sources[d.Name()]}
+		if err = e.scan(); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastUsed.After(entries[j].LastUsed) })
+	return entries, nil
+}
+
+// scan computes size and last use of the entry.
+// The last use is the newest modification of the entry, its source and run dirs,
+// which are recreated on every fetch and run.
+func (e *CacheEntry) scan() error {
+	root := util.LongPath(e.Path)
+	return filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			e.Size += info.Size()
+		}
+		depth := strings.Count(strings.TrimPrefix(name, root), string(filepath.Separator))
+		if depth <= 2 && info.ModTime().After(e.LastUsed) {
+			e.LastUsed = info.ModTime()
+		}
+		return nil
+	})
+}
+
+// GCCache removes cache entries not referenced by any config and,
+// if a TTL is set, entries not used within the TTL. It returns the removed entries.
+func GCCache(opts CacheGCOptions) ([]*CacheEntry, error) {
+	entries, err := Loader{Lenient: opts.Lenient}.ListCache(opts.Dir, opts.ConfigFiles)
+	if err != nil {
+		return nil, err
+	}
+	var removed []*CacheEntry
+	for _, e := range entries {
+		expired := opts.TTL > 0 && time.Since(e.LastUsed) > opts.TTL
+		if e.Referenced() && !expired {
+			continue
+		}
+		if !opts.DryRun {
+			if err = os.RemoveAll(util.LongPath(e.Path)); err != nil {
+				return removed, fmt.Errorf("could not remove cache entry %s: %w", e.Key, err)
+			}
+		}
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
+
+// PurgeCache removes all cache entries of dir, they are fetched again on the next run.
+// Run reports are kept.
+func PurgeCache(dir string) ([]*CacheEntry, error) {
+	entries, err := listCacheEntries(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if err = os.RemoveAll(util.LongPath(e.Path)); err != nil {
+			return entries[:i], fmt.Errorf("could not remove cache entry %s: %w", e.Key, err)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,103 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// setupCacheEntry creates a cache entry for source with a fetched definition and a run dir.
+func setupCacheEntry(t *testing.T, dir, source string, lastUsed time.Time) string {
+	t.Helper()
+	entry := filepath.Join(dir, RPackCacheDir, util.Sha256String(source))
+	for _, sub := range []string{RPackCacheDirSource, filepath.Join("abc", RPackCacheDirRun)} {
+		if err := os.MkdirAll(filepath.Join(entry, sub), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(entry, RPackCacheDirSource, RPackDefDefaultFilename), []byte("0123456789"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		filepath.Join(entry, RPackCacheDirSource, RPackDefDefaultFilename),
+		filepath.Join(entry, RPackCacheDirSource),
+		filepath.Join(entry, "abc", RPackCacheDirRun),
+		filepath.Join(entry, "abc"),
+		entry,
+	} {
+		if err := os.Chtimes(name, lastUsed, lastUsed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return entry
+}
+
+func TestCacheGC(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.rpack.yaml"), []byte("\"@schema_version\": \"v1\"\nsource: \"./def\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(t.TempDir(), "other.rpack.yaml")
+	if err := os.WriteFile(other, []byte("\"@schema_version\": \"v1\"\nsource: \"./other\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	used := setupCacheEntry(t, dir, "./def", now)
+	stale := setupCacheEntry(t, dir, "./removed", now)
+	expired := setupCacheEntry(t, dir, "./other", now.Add(-48*time.Hour))
+	if err := os.MkdirAll(filepath.Join(dir, RPackCacheDir, RPackCacheDirReports, "app"), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+
+	entries, err := ListCache(dir, []string{other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if entries[2].Path != expired || entries[2].Source != "./other" || entries[2].Size != 10 {
+		t.Errorf("Expected expired entry last, got %+v", entries[2])
+	}
+
+	removed, err := GCCache(CacheGCOptions{Dir: dir, ConfigFiles: []string{other}, TTL: 24 * time.Hour, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("Expected 2 entries to remove, got %d", len(removed))
+	}
+	if _, err = os.Stat(stale); err != nil {
+		t.Error("Dry-run must not remove entries")
+	}
+
+	removed, err = GCCache(CacheGCOptions{Dir: dir, ConfigFiles: []string{other}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Path != stale {
+		t.Fatalf("Expected only the unreferenced entry to be removed, got %+v", removed)
+	}
+	if _, err = os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Expected unreferenced entry to be removed")
+	}
+
+	removed, err = PurgeCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("Expected purge to remove 2 entries, got %d", len(removed))
+	}
+	for _, p := range []string{used, expired} {
+		if _, err = os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be purged", p)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, RPackCacheDir, RPackCacheDirReports)); err != nil {
+		t.Error("Purge must keep run reports")
+	}
+}
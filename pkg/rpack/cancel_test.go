@@ -0,0 +1,53 @@
+package rpack
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestRunCanceled(t *testing.T) {
+	tests := []struct {
+		name string
+		// phase cancels the run once an event of the phase with Current set to at is reported
+		phase string
+		at    int
+	}{
+		{name: "checksum", phase: string(ProgressPhaseChecksum), at: 1},
+		{name: "apply", phase: string(ProgressPhaseTransfer), at: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config, workDir := setupRunConfig(t, "rpack.write(\"./a.txt\", \"a\\n\")\nrpack.write(\"./b.txt\", \"b\\n\")\nrpack.write(\"./c.txt\", \"c\\n\")\n", "")
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			_, err := Run(ctx, api.RunOptions{ConfigFile: config, Hooks: &api.RunHooks{Progress: func(event *api.ProgressEvent) {
+				if event.Phase == tc.phase && event.Current == tc.at && !event.Done {
+					cancel()
+				}
+			}}})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Expected the run canceled, got %v", err)
+			}
+			for _, name := range []string{"a.txt", "b.txt", "c.txt", "app.rpack.lock.yaml"} {
+				if _, err := os.Stat(filepath.Join(workDir, name)); !os.IsNotExist(err) {
+					t.Errorf("Expected %s rolled back, got %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunCanceledScript(t *testing.T) {
+	config, _ := setupRunConfig(t, "while true do end\n", "")
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err := Run(ctx, api.RunOptions{ConfigFile: config})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrLuaExecution) {
+		t.Fatalf("Expected the run canceled, got %v", err)
+	}
+}
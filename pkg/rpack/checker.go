@@ -2,10 +2,13 @@ package rpack
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"strings"
 
 	"fmt"
+
+	"github.com/blang/rpack/pkg/api"
 )
 
 // Checker checks certain aspects of an rpack
@@ -13,11 +16,35 @@ type Checker struct {
 	// Override for the execution path, optional
 	// Must be absolute
 	OverrideExecPath string
+
+	// DiffOutput receives the unified diffs of modified files against the content rpack generated, optional.
+	// Files without stored baseline are left out.
+	// With Strict it also receives the diffs of the target files against the newly generated content.
+	DiffOutput io.Writer
+
+	// Strict also executes the config as dry-run and fails with ErrDrift
+	// if the target is out of date relative to the definition
+	Strict bool
+
+	// Logger receives the logs of the check, slog.Default() if nil.
+	Logger *slog.Logger
+
+	// Lenient ignores unknown fields in the config, definitions and lockfile instead of failing
+	Lenient bool
+}
+
+// log returns the logger of the check.
+func (c *Checker) log() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
 }
 
 // CheckIntegrity verifies the integrity of an rpack installation.
 func (c *Checker) CheckIntegrity(ctx context.Context, name string) error {
-	ci, err := LoadRPackConfig(name)
+	log := c.log()
+	ci, err := Loader{Lenient: c.Lenient}.loadRPackConfig(name, nil, log)
 	if err != nil {
 		return fmt.Errorf("could not load rpack config: %s: %w", name, err)
 	}
@@ -33,14 +60,51 @@ func (c *Checker) CheckIntegrity(ctx context.Context, name string) error {
 	// Require force flag if files were modified that should be controlled by lockfile
 	if len(oldLockIntegrity.Modified) > 0 {
 		modFilesStr := strings.Join(oldLockIntegrity.Modified, ",")
-		slog.Warn("Some files in lockfile were modified outside of rpack", "files", modFilesStr)
-		return fmt.Errorf("some locked files were modified outside of rpack, use force flag to ignore: %s", modFilesStr)
+		log.Warn("Some files in lockfile were modified outside of rpack", "files", modFilesStr)
+		if c.DiffOutput != nil {
+			diffs, err := baselineDiffs(newBaselineStore(execPath), execPath, ci.LockFile, oldLockIntegrity.Modified)
+			if err != nil {
+				return err
+			}
+			for _, p := range oldLockIntegrity.Modified {
+				_, _ = io.WriteString(c.DiffOutput, RedactSecrets(diffs[p]))
+			}
+		}
+		return fmt.Errorf("some locked files were modified outside of rpack, use force flag to ignore: %s: %w", modFilesStr, ErrLockModified)
 	}
 
 	// Warn about files that are removed but still in the lockfile
 	if len(oldLockIntegrity.Removed) > 0 {
-		slog.Warn("Some files in lockfile were removed outside of rpack", "files", strings.Join(oldLockIntegrity.Removed, ","))
-		return fmt.Errorf("some files in lockfile were removed: %s", strings.Join(oldLockIntegrity.Removed, ","))
+		log.Warn("Some files in lockfile were removed outside of rpack", "files", strings.Join(oldLockIntegrity.Removed, ","))
+		return fmt.Errorf("some files in lockfile were removed: %s: %w", strings.Join(oldLockIntegrity.Removed, ","), ErrLockModified)
+	}
+	if c.Strict {
+		return c.checkGenerated(ctx, ci)
+	}
+	return nil
+}
+
+// checkGenerated executes the config as dry-run and compares the generated content against the target files.
+func (c *Checker) checkGenerated(ctx context.Context, ci *RPackConfigInstance) error {
+	log := c.log()
+	e := &Executor{DryRun: true, OverrideExecPath: c.OverrideExecPath, collectPlan: true, Logger: log, Lenient: c.Lenient}
+	res, err := e.runConfig(ctx, ci)
+	if err != nil {
+		return fmt.Errorf("failed to run rpack config: %s: %w", ci.ConfigFile, err)
+	}
+	var drifted []string
+	for _, f := range res.Plan.Files {
+		if f.Action == api.PlanActionUnchanged {
+			continue
+		}
+		drifted = append(drifted, f.Path)
+		log.Warn("Target file is out of date", "path", f.Path, "action", f.Action)
+		if c.DiffOutput != nil {
+			_, _ = io.WriteString(c.DiffOutput, RedactSecrets(f.Diff))
+		}
+	}
+	if len(drifted) > 0 {
+		return fmt.Errorf("target files are out of date, run rpack and commit the changes: %s: %w", strings.Join(drifted, ","), ErrDrift)
 	}
 	return nil
 }
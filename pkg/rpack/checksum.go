@@ -0,0 +1,81 @@
+package rpack
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path/filepath"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/blang/rpack/pkg/lockfile"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// ChecksumXXH64 is the xxHash64 lockfile checksum algorithm. It is a lot faster than sha256
+// on big trees but not cryptographic, it only detects accidental modifications.
+const ChecksumXXH64 = "xxh64"
+
+func init() {
+	lockfile.Register(lockfile.NewAlgorithm(ChecksumXXH64, func() hash.Hash { return xxhash.New() }))
+}
+
+// rehash replaces the sha256 checksums of the lockfile entries with the ones of algorithm.
+// Fully managed files use the checksum in sums recorded while writing if there is one,
+// the others are calculated from the files below dir. Files in generated are hashed from their
+// generated content instead, the target holds their merged content. Nothing changes for the default sha256.
+func (f *RPackLockFile) rehash(ctx context.Context, algorithm, dir string, generated map[string][]byte, sums map[string]string) error {
+	if algorithm == "" || algorithm == lockfile.SHA256 {
+		return nil
+	}
+	for _, file := range f.Files {
+		if err := checkCanceled(ctx); err != nil {
+			return err
+		}
+		if content, ok := generated[file.Path]; ok {
+			sum, err := checksumBytes(algorithm, content)
+			if err != nil {
+				return err
+			}
+			file.Sha, file.Algorithm = sum, algorithm
+			continue
+		}
+		if sum, ok := sums[file.Path]; ok && len(file.Blocks) == 0 {
+			file.Sha, file.Algorithm = sum, algorithm
+			continue
+		}
+		name := util.LongPath(filepath.Join(dir, file.Path))
+		var sum string
+		var err error
+		if len(file.Blocks) > 0 {
+			sum, err = lockfile.ChecksumBlocks(algorithm, name, file.Blocks)
+		} else {
+			sum, err = lockfile.ChecksumWith(algorithm, name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to calculate %s checksum of: %s: %w", algorithm, file.Path, err)
+		}
+		file.Sha, file.Algorithm = sum, algorithm
+	}
+	return nil
+}
+
+// checksumBytes returns the hex checksum of b with the lockfile checksum algorithm, sha256 if empty.
+func checksumBytes(algorithm string, b []byte) (string, error) {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	_, _ = h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newChecksumHash returns a new hash of the lockfile checksum algorithm, sha256 if empty.
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	a, err := lockfile.LookupAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return a.New(), nil
+}
@@ -0,0 +1,272 @@
+package rpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// CIMode selects what rpack ci does with the configs of a workspace.
+type CIMode string
+
+// CI modes.
+const (
+	// CIModeCheck fails if the targets differ from the generated files, for pull requests
+	CIModeCheck CIMode = "check"
+	// CIModeApply applies the configs and commits the changes, for the main branch
+	CIModeApply CIMode = "apply"
+)
+
+// CI providers detected by DetectCIEnv.
+const (
+	CIProviderGitHub = "github"
+	CIProviderGitLab = "gitlab"
+)
+
+// CIEnv describes the CI job rpack ci runs in, see DetectCIEnv.
+type CIEnv struct {
+	// Provider is CIProviderGitHub, CIProviderGitLab or empty for other CI systems
+	Provider string
+	// PullRequest is set for jobs of pull and merge requests
+	PullRequest bool
+	// Branch the job runs for, empty if unknown
+	Branch string
+}
+
+// DetectCIEnv detects the CI job from the environment variables of GitHub Actions and GitLab CI.
+func DetectCIEnv(getenv func(string) string) CIEnv {
+	switch {
+	case getenv("GITHUB_ACTIONS") == "true":
+		env := CIEnv{Provider: CIProviderGitHub, Branch: getenv("GITHUB_REF_NAME")}
+		switch getenv("GITHUB_EVENT_NAME") {
+		case "pull_request", "pull_request_target", "merge_group":
+			env.PullRequest = true
+			env.Branch = getenv("GITHUB_HEAD_REF")
+		}
+		return env
+	case getenv("GITLAB_CI") == "true":
+		if getenv("CI_MERGE_REQUEST_IID") != "" {
+			return CIEnv{Provider: CIProviderGitLab, PullRequest: true, Branch: getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME")}
+		}
+		return CIEnv{Provider: CIProviderGitLab, Branch: getenv("CI_COMMIT_BRANCH")}
+	}
+	return CIEnv{}
+}
+
+// Mode returns the mode of the job: apply on the branches of applyBranches, check otherwise.
+// Pull requests are always checked.
+func (env CIEnv) Mode(applyBranches []string) CIMode {
+	if !env.PullRequest && env.Branch != "" && slices.Contains(applyBranches, env.Branch) {
+		return CIModeApply
+	}
+	return CIModeCheck
+}
+
+// CIFinding is a problem rpack ci found in a target.
+type CIFinding struct {
+	// Config is the path of the config file
+	Config string
+	// Path is the absolute path of the target file, empty if the finding is not about a file
+	Path string
+	// Message describes the finding
+	Message string
+	// Diff is the unified diff from the target file to the generated content,
+	// or from the generated content to a file modified outside of rpack, optional
+	Diff string
+	// Warning marks findings that do not fail the check, like script warnings
+	Warning bool
+}
+
+// FindRPackConfigs returns the config files below root, sorted.
+// Hidden directories like .git and .rpack.d are skipped.
+func FindRPackConfigs(root string) ([]string, error) {
+	var configs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), RPackFileSuffix) {
+			configs = append(configs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not search for rpack config files in %s: %w", root, err)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrConfigNotFound, root)
+	}
+	return configs, nil
+}
+
+// CICheck checks the configs like rpack check and rpack diff together: files modified outside of rpack
+// and target files differing from the generated content are findings. The error wraps ErrLockModified
+// or ErrDrift if a finding fails the check, script warnings are only reported.
+func (e *Executor) CICheck(ctx context.Context, configs []string) ([]*CIFinding, error) {
+	var findings []*CIFinding
+	var modified, drifted bool
+	for _, name := range configs {
+		ci, err := e.loader().LoadRPackConfig(name)
+		if err != nil {
+			return findings, fmt.Errorf("could not load rpack config: %s: %w", name, err)
+		}
+		integrity, err := ci.LockFile.CheckIntegrity(ci.ConfigPath)
+		if err != nil {
+			return findings, fmt.Errorf("failed to check lockfile integrity: %s: %w", name, err)
+		}
+		diffs, err := baselineDiffs(newBaselineStore(ci.ConfigPath), ci.ConfigPath, ci.LockFile, integrity.Modified)
+		if err != nil {
+			return findings, err
+		}
+		for _, p := range integrity.Modified {
+			findings = append(findings, &CIFinding{Config: name, Path: filepath.Join(ci.ConfigPath, p), Message: "file managed by rpack was modified outside of rpack", Diff: diffs[p]})
+		}
+		for _, p := range integrity.Removed {
+			findings = append(findings, &CIFinding{Config: name, Path: filepath.Join(ci.ConfigPath, p), Message: "file managed by rpack was removed outside of rpack"})
+		}
+		modified = modified || len(integrity.Modified) > 0 || len(integrity.Removed) > 0
+
+		run := *e
+		run.DryRun = true
+		run.collectPlan = true
+		run.OverrideExecPath = ""
+		res, err := run.runConfig(ctx, ci)
+		if err != nil {
+			return findings, fmt.Errorf("failed to run rpack config: %s: %w", name, err)
+		}
+		for _, f := range res.Plan.Files {
+			if f.Action == api.PlanActionUnchanged {
+				continue
+			}
+			drifted = true
+			findings = append(findings, &CIFinding{Config: name, Path: filepath.Join(ci.ConfigPath, f.Path), Message: ciDriftMessage(f.Action), Diff: f.Diff})
+		}
+		for _, a := range res.Plan.Annotations {
+			finding := &CIFinding{Config: name, Message: a.Message, Warning: true}
+			if a.Path != "" {
+				finding.Path = filepath.Join(ci.ConfigPath, a.Path)
+			}
+			findings = append(findings, finding)
+		}
+	}
+	switch {
+	case modified:
+		return findings, fmt.Errorf("files managed by rpack were modified outside of rpack: %w", ErrLockModified)
+	case drifted:
+		return findings, fmt.Errorf("run rpack and commit the changes: %w", ErrDrift)
+	}
+	return findings, nil
+}
+
+// ciDriftMessage describes a planned action as finding.
+func ciDriftMessage(action api.PlanAction) string {
+	switch action {
+	case api.PlanActionAdd:
+		return "file is generated by rpack but missing"
+	case api.PlanActionRemove:
+		return "file is no longer generated by rpack but still present"
+	}
+	return "file differs from the content generated by rpack"
+}
+
+// CICommit describes the commit of the changes applied by CIApply.
+type CICommit struct {
+	// Dir is the git working tree
+	Dir string
+	// Message of the commit
+	Message string
+	// Push the commit to origin, to Branch if set
+	Push   bool
+	Branch string
+}
+
+// CIApply applies the configs and commits the changes if commit is set.
+// Only the files written or removed by the apply, the lockfiles and the managed .gitignore are committed.
+// It returns the hash of the commit, empty if nothing changed.
+func (e *Executor) CIApply(ctx context.Context, configs []string, commit *CICommit) (string, error) {
+	var paths []string
+	for _, name := range configs {
+		ci, err := e.loader().LoadRPackConfig(name)
+		if err != nil {
+			return "", fmt.Errorf("could not load rpack config: %s: %w", name, err)
+		}
+		run := *e
+		run.OverrideExecPath = ""
+		res, err := run.runConfig(ctx, ci)
+		if err != nil {
+			return "", err
+		}
+		for _, p := range slices.Concat(res.Files, res.Removed, []string{GitIgnoreFile}) {
+			paths = append(paths, filepath.Join(ci.ConfigPath, filepath.FromSlash(p)))
+		}
+		paths = append(paths, ci.LockFilePath)
+	}
+	if commit == nil || e.DryRun {
+		return "", nil
+	}
+	return commitCIChanges(ctx, commit, slices.Compact(slices.Sorted(slices.Values(paths))))
+}
+
+// commitCIChanges commits the changes of paths, other changes of the working tree and the index are left alone.
+// Paths git does not know and cannot add, like missing or ignored files, are skipped.
+func commitCIChanges(ctx context.Context, commit *CICommit, paths []string) (string, error) {
+	pathspecs := make([]string, 0, len(paths))
+	for _, p := range paths {
+		pathspecs = append(pathspecs, ":(literal)"+p)
+	}
+	known, err := runGit(ctx, commit.Dir, append([]string{"ls-files", "-z", "--cached", "--others", "--exclude-standard", "--"}, pathspecs...)...)
+	if err != nil {
+		return "", err
+	}
+	if known == "" {
+		return "", nil
+	}
+	pathspecs = pathspecs[:0]
+	for p := range strings.SplitSeq(strings.TrimSuffix(known, "\x00"), "\x00") {
+		pathspecs = append(pathspecs, ":(literal)"+p)
+	}
+	if _, err = runGit(ctx, commit.Dir, append([]string{"add", "--all", "--"}, pathspecs...)...); err != nil {
+		return "", err
+	}
+	staged, err := runGit(ctx, commit.Dir, append([]string{"diff", "--cached", "--name-only", "--"}, pathspecs...)...)
+	if err != nil {
+		return "", err
+	}
+	if staged == "" {
+		return "", nil
+	}
+	var args []string
+	// CI checkouts often lack an identity
+	if _, err = runGit(ctx, commit.Dir, "config", "user.email"); err != nil {
+		args = append(args, "-c", "user.name=rpack", "-c", "user.email=rpack@localhost")
+	}
+	if _, err = runGit(ctx, commit.Dir, slices.Concat(args, []string{"commit", "--quiet", "--only", "--message", commit.Message, "--"}, pathspecs)...); err != nil {
+		return "", err
+	}
+	rev, err := runGit(ctx, commit.Dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if commit.Push {
+		ref := "HEAD"
+		if commit.Branch != "" {
+			ref = "HEAD:refs/heads/" + commit.Branch
+		}
+		if _, err = runGit(ctx, commit.Dir, "push", "origin", ref); err != nil {
+			return rev, errors.Join(fmt.Errorf("could not push commit %s", rev), err)
+		}
+	}
+	return rev, nil
+}
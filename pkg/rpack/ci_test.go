@@ -0,0 +1,109 @@
+package rpack
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectCIEnv(t *testing.T) {
+	tcs := []struct {
+		name string
+		env  map[string]string
+		want CIEnv
+		mode CIMode
+	}{
+		{name: "unknown", env: map[string]string{}, want: CIEnv{}, mode: CIModeCheck},
+		{name: "github push", env: map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_EVENT_NAME": "push", "GITHUB_REF_NAME": "main"},
+			want: CIEnv{Provider: CIProviderGitHub, Branch: "main"}, mode: CIModeApply},
+		{name: "github pull request", env: map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_EVENT_NAME": "pull_request", "GITHUB_REF_NAME": "1/merge", "GITHUB_HEAD_REF": "feature"},
+			want: CIEnv{Provider: CIProviderGitHub, PullRequest: true, Branch: "feature"}, mode: CIModeCheck},
+		{name: "github other branch", env: map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_EVENT_NAME": "push", "GITHUB_REF_NAME": "feature"},
+			want: CIEnv{Provider: CIProviderGitHub, Branch: "feature"}, mode: CIModeCheck},
+		{name: "gitlab merge request", env: map[string]string{"GITLAB_CI": "true", "CI_MERGE_REQUEST_IID": "3", "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME": "feature"},
+			want: CIEnv{Provider: CIProviderGitLab, PullRequest: true, Branch: "feature"}, mode: CIModeCheck},
+		{name: "gitlab branch", env: map[string]string{"GITLAB_CI": "true", "CI_COMMIT_BRANCH": "master"},
+			want: CIEnv{Provider: CIProviderGitLab, Branch: "master"}, mode: CIModeApply},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			env := DetectCIEnv(func(key string) string { return tc.env[key] })
+			if env != tc.want {
+				t.Errorf("DetectCIEnv() = %+v, want %+v", env, tc.want)
+			}
+			if mode := env.Mode([]string{"main", "master"}); mode != tc.mode {
+				t.Errorf("Mode() = %s, want %s", mode, tc.mode)
+			}
+		})
+	}
+}
+
+func TestCICheckAndApply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"out\\n\")\n", "")
+	if _, err := runGit(t.Context(), workDir, "init", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	configs, err := FindRPackConfigs(workDir)
+	if err != nil || len(configs) != 1 || configs[0] != config {
+		t.Fatalf("Expected to find %s, got %v, %v", config, configs, err)
+	}
+
+	e := &Executor{}
+	findings, err := e.CICheck(t.Context(), configs)
+	if !errors.Is(err, ErrDrift) {
+		t.Fatalf("Expected ErrDrift, got %v", err)
+	}
+	if len(findings) != 1 || findings[0].Path != filepath.Join(workDir, "out.txt") || findings[0].Diff == "" {
+		t.Fatalf("Expected a finding with diff for out.txt, got %+v", findings)
+	}
+
+	// Unrelated changes of the working tree and the index must not be committed
+	for _, name := range []string{"notes.txt", "staged.txt"} {
+		if err = os.WriteFile(filepath.Join(workDir, name), []byte("mine\n"), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	if _, err = runGit(t.Context(), workDir, "add", "staged.txt"); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := e.CIApply(t.Context(), configs, &CICommit{Dir: workDir, Message: "Apply rpack changes"})
+	if err != nil || rev == "" {
+		t.Fatalf("Expected a commit, got %q, %v", rev, err)
+	}
+	if files, _ := runGit(t.Context(), workDir, "show", "--name-only", "--format=", rev); files != ".gitignore\napp.rpack.lock.yaml\nout.txt" {
+		t.Errorf("Unexpected committed files:\n%s", files)
+	}
+	if status, _ := runGit(t.Context(), workDir, "status", "--porcelain"); status != "A  staged.txt\n?? app.rpack.yaml\n?? notes.txt" {
+		t.Errorf("Unexpected working tree status:\n%s", status)
+	}
+	if findings, err = e.CICheck(t.Context(), configs); err != nil || len(findings) != 0 {
+		t.Fatalf("Expected no findings after apply, got %+v, %v", findings, err)
+	}
+	if rev, err = e.CIApply(t.Context(), configs, &CICommit{Dir: workDir, Message: "Apply rpack changes"}); err != nil || rev != "" {
+		t.Fatalf("Expected no commit without changes, got %q, %v", rev, err)
+	}
+
+	// Files no longer generated are removed in the commit
+	script := filepath.Join(filepath.Dir(workDir), "def", "script.lua")
+	if err = os.WriteFile(script, []byte("local rpack = require(\"rpack.v1\")\nrpack.write(\"./other.txt\", \"out\\n\")\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if rev, err = e.CIApply(t.Context(), configs, &CICommit{Dir: workDir, Message: "Apply rpack changes"}); err != nil || rev == "" {
+		t.Fatalf("Expected a commit, got %q, %v", rev, err)
+	}
+	if files, _ := runGit(t.Context(), workDir, "show", "--name-status", "--no-renames", "--format=", rev); files != "M\tapp.rpack.lock.yaml\nA\tother.txt\nD\tout.txt" {
+		t.Errorf("Unexpected committed files:\n%s", files)
+	}
+
+	if err = os.WriteFile(filepath.Join(workDir, "other.txt"), []byte("mine\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err = e.CICheck(t.Context(), configs); !errors.Is(err, ErrLockModified) {
+		t.Fatalf("Expected ErrLockModified, got %v", err)
+	}
+}
@@ -10,17 +10,87 @@ import (
 	"fmt"
 
 	"sigs.k8s.io/yaml"
+
+	"github.com/blang/rpack/pkg/lockfile"
+	"github.com/blang/rpack/pkg/rpack/util"
 )
 
 // RPack file extensions and suffixes.
 const (
 	RPackFileSuffix     = ".rpack.yaml"
-	RPackLockFileSuffix = ".rpack.lock.yaml"
+	RPackLockFileSuffix = lockfile.Suffix
 )
 
+// ErrConfigNotFound is returned by FindRPackConfig if no config file was found.
+var ErrConfigNotFound = errors.New("no rpack config file found")
+
+// FindRPackConfig searches dir and its parents for a config file, like git discovers .git.
+// The search stops at the root of the repository containing dir.
+// A directory with several config files is ambiguous and returns an error.
+func FindRPackConfig(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("could not construct absolute path for directory %s: %w", dir, err)
+	}
+	for d := absDir; ; {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			return "", fmt.Errorf("could not search for rpack config file: %w", err)
+		}
+		var found []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), RPackFileSuffix) {
+				found = append(found, filepath.Join(d, entry.Name()))
+			}
+		}
+		switch {
+		case len(found) == 1:
+			slog.Debug("Found rpack config file", "path", found[0])
+			return found[0], nil
+		case len(found) > 1:
+			return "", fmt.Errorf("found multiple rpack config files in %s, specify one: %s", d, strings.Join(found, ", "))
+		}
+		if exists, _ := util.FileExists(filepath.Join(d, ".git")); exists {
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	return "", fmt.Errorf("%w in %s or its parent directories", ErrConfigNotFound, absDir)
+}
+
+// Loader loads configs, definitions and lockfiles. The zero value decodes strictly,
+// unknown fields and duplicate keys are errors so typos like vaules: fail.
+type Loader struct {
+	// Lenient ignores unknown fields instead of failing, e.g. while migrating files between rpack versions
+	Lenient bool
+}
+
 // LoadRPackConfig creates a RPackConfigInstance by loading the RPackConfig and RPackLockFile from a file.
 // It does not perform validation of user supplied config, but validate the whole file against a schema.
 func LoadRPackConfig(name string) (*RPackConfigInstance, error) {
+	return Loader{}.LoadRPackConfig(name)
+}
+
+// LoadRPackConfig is LoadRPackConfig decoding with the options of l.
+func (l Loader) LoadRPackConfig(name string) (*RPackConfigInstance, error) {
+	return l.loadRPackConfig(name, nil, slog.Default())
+}
+
+// LoadRPackConfigData creates a RPackConfigInstance like LoadRPackConfig with the config content b
+// instead of the content of the file name. The lockfile is still loaded from the directory of name.
+func LoadRPackConfigData(name string, b []byte) (*RPackConfigInstance, error) {
+	if b == nil {
+		b = []byte{}
+	}
+	return Loader{}.loadRPackConfig(name, b, slog.Default())
+}
+
+// loadRPackConfig loads the config name, with content b if not nil.
+func (l Loader) loadRPackConfig(name string, b []byte, log *slog.Logger) (*RPackConfigInstance, error) {
 	absPath, err := filepath.Abs(name)
 	if err != nil {
 		return nil, fmt.Errorf("could not construct absolute path for file %s: %w", name, err)
@@ -36,12 +106,20 @@ func LoadRPackConfig(name string) (*RPackConfigInstance, error) {
 	configPath := filepath.Dir(absPath)
 
 	// Load RPackConfig from file
-	config, err := loadRPackFile(absPath)
+	var config *RPackConfig
+	if b != nil {
+		config, err = l.parseRPackFile(absPath, b)
+	} else {
+		config, err = l.loadRPackFile(absPath)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("could not load rpack file: %s: %w", absPath, err)
 	}
 
-	if err := config.Validate(); err != nil {
+	report := &ValidationReport{}
+	report.add(ValidationStepConfig, "", config.Validate())
+	report.locate(absPath, nil, 0)
+	if err := report.err(); err != nil {
 		return nil, fmt.Errorf("validating rpack file against schema: %s: %w", absPath, err)
 	}
 
@@ -53,63 +131,92 @@ func LoadRPackConfig(name string) (*RPackConfigInstance, error) {
 	lockFileName += RPackLockFileSuffix
 	lockFilePath := filepath.Join(configPath, lockFileName)
 
-	var lockFile *RPackLockFile
-	if _, err := os.Stat(lockFilePath); errors.Is(err, os.ErrNotExist) {
-		slog.Info("Lockfile does not exist", "path", lockFilePath)
-		lockFile = NewRPackLockFile()
-	} else {
-		lockFile, err = loadRPackLockFile(lockFilePath)
-		if err != nil {
-			return nil, fmt.Errorf("could not load lockfile %s: %w", lockFilePath, err)
-		}
-	}
-	if err := lockFile.Validate(); err != nil {
-		return nil, fmt.Errorf("lockfile validation failed: %s: %w", lockFilePath, err)
+	lockFile, err := l.loadRPackLockFileOrNew(lockFilePath, log)
+	if err != nil {
+		return nil, err
 	}
 
 	return &RPackConfigInstance{
 		ConfigPath:   configPath,
+		ConfigFile:   absPath,
 		Config:       config,
 		LockFile:     lockFile,
 		LockFilePath: lockFilePath,
 	}, nil
 }
 
-func loadRPackFile(name string) (*RPackConfig, error) {
+// loadRPackLockFileOrNew loads and validates the lockfile name, an empty lockfile if it does not exist.
+func (l Loader) loadRPackLockFileOrNew(name string, log *slog.Logger) (*RPackLockFile, error) {
+	var lockFile *RPackLockFile
+	if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+		log.Info("Lockfile does not exist", "path", name)
+		lockFile = NewRPackLockFile()
+	} else {
+		lockFile, err = l.loadRPackLockFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not load lockfile %s: %w", name, err)
+		}
+	}
+	if err := lockFile.Validate(); err != nil {
+		return nil, fmt.Errorf("lockfile validation failed: %s: %w: %w", name, ErrValidation, err)
+	}
+	return lockFile, nil
+}
+
+func (l Loader) loadRPackFile(name string) (*RPackConfig, error) {
 	b, err := os.ReadFile(name) //nolint:gosec // intentional: path comes from user config
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %s: %w", name, err)
 	}
+	return l.parseRPackFile(name, b)
+}
+
+// parseRPackFile parses the content b of the config file name.
+func (l Loader) parseRPackFile(name string, b []byte) (*RPackConfig, error) {
 	var c RPackConfig
-	err = yaml.Unmarshal(b, &c)
+	err := l.unmarshalYAML(b, &c)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal yaml in file: %s: %w", name, err)
+		return nil, fmt.Errorf("failed to unmarshal yaml in file: %s: %w: %w", name, ErrValidation, annotateYAMLError(name, err))
 	}
 	return &c, nil
 }
 
-func loadRPackLockFile(name string) (*RPackLockFile, error) {
-	b, err := os.ReadFile(name) //nolint:gosec // intentional: path comes from user config
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %s: %w", name, err)
+// unmarshalYAML decodes b into v, failing on unknown fields and duplicate keys unless Lenient is set.
+func (l Loader) unmarshalYAML(b []byte, v any) error {
+	if l.Lenient {
+		return yaml.Unmarshal(b, v)
 	}
-	var c RPackLockFile
-	err = yaml.Unmarshal(b, &c)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal yaml in file: %s: %w", name, err)
+	err := yaml.UnmarshalStrict(b, v)
+	if err != nil && strings.Contains(err.Error(), "unknown field") {
+		return fmt.Errorf("%w (use --lenient to ignore unknown fields)", err)
 	}
-	return &c, nil
+	return err
 }
 
-// WriteFile writes the lock file content to the given path.
-func (l *RPackLockFile) WriteFile(name string) error {
-	b, err := yaml.Marshal(l)
-	if err != nil {
-		return fmt.Errorf("failed to marshal lockfile: %w", err)
+func (l Loader) loadRPackLockFile(name string) (*RPackLockFile, error) {
+	read := lockfile.ReadStrict
+	if l.Lenient {
+		read = lockfile.Read
 	}
-	err = os.WriteFile(name, b, 0o666) //nolint:gosec // intentional: standard file permissions for package manager output
+	f, err := read(name)
 	if err != nil {
-		return fmt.Errorf("failed to write lockfile: %w", err)
+		return nil, err
 	}
-	return nil
+	lockFile := RPackLockFileFromAPI(f)
+	lockFile.normalizePaths()
+	return lockFile, nil
+}
+
+// normalizePaths converts the paths of lockfiles written with backslashes, e.g. by older versions on Windows,
+// to slashes. Otherwise their entries would not match the paths written and be removed after the apply.
+// Scripts use backslashes as separators on all platforms, so target paths never contain one.
+func (l *RPackLockFile) normalizePaths() {
+	for _, f := range l.Files {
+		f.Path = toScriptSlash(filepath.ToSlash(f.Path))
+	}
+}
+
+// WriteFile writes the lock file content to the given path.
+func (l *RPackLockFile) WriteFile(name string) error {
+	return lockfile.Write(name, l.API())
 }
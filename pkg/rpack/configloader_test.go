@@ -0,0 +1,75 @@
+package rpack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestFindRPackConfig(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	deep := filepath.Join(repo, "app", "src", "handlers")
+	for _, dir := range []string{filepath.Join(repo, ".git"), deep, filepath.Join(root, "multi")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"outside.rpack.yaml", "repo/app/app.rpack.yaml", "repo/app/app.rpack.lock.yaml", "multi/a.rpack.yaml", "multi/b.rpack.yaml"} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte("{}\n"), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+
+	got, err := FindRPackConfig(deep)
+	if err != nil || got != filepath.Join(repo, "app", "app.rpack.yaml") {
+		t.Errorf("Expected config of parent directory, got %q: %v", got, err)
+	}
+
+	// The search stops at the repository root, the config above it is not found
+	if _, err = FindRPackConfig(repo); !errors.Is(err, ErrConfigNotFound) {
+		t.Errorf("Expected ErrConfigNotFound, got %v", err)
+	}
+
+	if _, err = FindRPackConfig(filepath.Join(root, "multi")); err == nil || !strings.Contains(err.Error(), "multiple") {
+		t.Errorf("Expected ambiguous config error, got %v", err)
+	}
+}
+
+func TestLoadRPackLockFileBackslashes(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./dir/b.txt\", \"b\\n\")\n", "")
+	if err := os.MkdirAll(filepath.Join(workDir, "dir"), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "dir", "b.txt"), []byte("b\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	// Written by an older version on Windows
+	lock := "\"@schema_version\": v1\nfiles:\n  - path: dir\\b.txt\n    sha: " + sha256Hex([]byte("b\n")) + "\n"
+	lockPath := filepath.Join(workDir, "app.rpack.lock.yaml")
+	if err := os.WriteFile(lockPath, []byte(lock), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	lockFile, err := Loader{}.loadRPackLockFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lockFile.Files) != 1 || lockFile.Files[0].Path != "dir/b.txt" {
+		t.Fatalf("Expected slash separated path, got %+v", lockFile.Files)
+	}
+
+	res, err := Run(t.Context(), api.RunOptions{ConfigFile: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Removed) != 0 || len(res.Added) != 0 {
+		t.Errorf("Expected no changes, got added %v, removed %v", res.Added, res.Removed)
+	}
+	if b, err := os.ReadFile(filepath.Join(workDir, "dir", "b.txt")); err != nil || string(b) != "b\n" { //nolint:gosec // test file
+		t.Errorf("Expected dir/b.txt kept, got %q, %v", b, err)
+	}
+}
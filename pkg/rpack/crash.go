@@ -0,0 +1,142 @@
+package rpack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Execution phases recorded for crash reports.
+const (
+	CrashPhaseLoad  = "load"
+	CrashPhaseExec  = "exec"
+	CrashPhasePlan  = "plan"
+	CrashPhaseApply = "apply"
+)
+
+// crashContext records what rpack is doing, so crash reports can name
+// the phase and pack without carrying file contents.
+var crashContext struct {
+	mu     sync.Mutex
+	phase  string
+	pack   string
+	source string
+}
+
+// setCrashContext records the current phase and pack, pack may be nil.
+func setCrashContext(phase string, pack *RPackConfigPack) {
+	crashContext.mu.Lock()
+	defer crashContext.mu.Unlock()
+	crashContext.phase = phase
+	crashContext.pack, crashContext.source = "", ""
+	if pack != nil {
+		crashContext.pack = pack.Name
+		// Sources may carry credentials, e.g. tokens in git URLs
+		crashContext.source = stripSourceCredentials(pack.Source)
+	}
+}
+
+// CrashReport describes a panic or internal error.
+// It contains the stack and run context but no file contents or values.
+type CrashReport struct {
+	Time      time.Time
+	Version   string
+	GoVersion string
+	OS        string
+	Arch      string
+	// Command is the rpack command that was run, without arguments
+	Command string
+	Phase   string
+	Pack    string
+	Source  string
+	// Cause is the panic value or internal error message
+	Cause string
+	Stack string
+}
+
+// NewCrashReport creates a report for cause using the recorded run context.
+func NewCrashReport(version, command string, cause any, stack string) *CrashReport {
+	crashContext.mu.Lock()
+	defer crashContext.mu.Unlock()
+	return &CrashReport{
+		Time:      time.Now(),
+		Version:   version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Command:   command,
+		Phase:     crashContext.phase,
+		Pack:      crashContext.pack,
+		Source:    crashContext.source,
+		Cause:     RedactSecrets(fmt.Sprint(cause)),
+		Stack:     stack,
+	}
+}
+
+// InternalError reports if err is caused by a panic in Go code called from Lua
+// and returns the panic value and recorded stack. Such panics are bugs of rpack, not of the pack.
+func InternalError(err error) (cause, stack string, ok bool) {
+	var apiErr *lua.ApiError
+	if !errors.As(err, &apiErr) || apiErr.Type != lua.ApiErrorPanic {
+		return "", "", false
+	}
+	return apiErr.Object.String(), apiErr.StackTrace, true
+}
+
+// CrashReportDir returns the directory crash reports are written to,
+// the rpack directory of the user cache or the temp directory as fallback.
+func CrashReportDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "rpack", "crash")
+	}
+	return filepath.Join(os.TempDir(), "rpack-crash")
+}
+
+// String renders the report as plain text.
+func (r *CrashReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "rpack crash report\n\n")
+	for _, kv := range [][2]string{
+		{"time", r.Time.UTC().Format(time.RFC3339)},
+		{"version", r.Version},
+		{"go", r.GoVersion},
+		{"platform", r.OS + "/" + r.Arch},
+		{"command", r.Command},
+		{"phase", r.Phase},
+		{"pack", r.Pack},
+		{"source", r.Source},
+	} {
+		if kv[1] == "" {
+			kv[1] = "-"
+		}
+		fmt.Fprintf(&sb, "%-9s %s\n", kv[0]+":", kv[1])
+	}
+	fmt.Fprintf(&sb, "\ncause:\n%s\n\nstack:\n%s\n", r.Cause, strings.TrimSpace(r.Stack))
+	return sb.String()
+}
+
+// Write writes the report to a new file in dir and returns its path.
+func (r *CrashReport) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("could not create crash report directory: %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, "crash-"+r.Time.UTC().Format("20060102T150405")+"-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("could not create crash report: %w", err)
+	}
+	if _, err = f.WriteString(r.String()); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("could not write crash report: %s: %w", f.Name(), err)
+	}
+	if err = f.Close(); err != nil {
+		return "", fmt.Errorf("could not write crash report: %s: %w", f.Name(), err)
+	}
+	return f.Name(), nil
+}
@@ -1,10 +1,58 @@
+// Keep def_schema.json in sync, it is used by builds without CUE.
+
 #Schema: {
 	"@schema_version"!: "v1"
 	name!:              string & =~"^[a-zA-Z0-9-_]{1,64}$"
+	description?:       string
+	version?:           string & !=""
 	inputs?: [...#Input]
+	extra?: [...#Extra]
+	allow_target_read?: [...string & !=""]
+	sensitive_values?: [...string & !=""]
+	permissions?: #Permissions
+	template?:    #Template
+	scripts?: [...#Script]
+	dependencies?: [...#Dependency]
+}
+
+#Dependency: {
+	name!:   string & =~"^[a-zA-Z0-9-_]{1,64}$"
+	source!: string & !=""
+	values?: {...}
+	script?: string & =~"^[a-zA-Z0-9-_]{1,64}$"
+}
+
+#Script: {
+	name!:        string & =~"^[a-zA-Z0-9-_]{1,64}$"
+	file!:        string & =~"\\.lua$"
+	description?: string
+}
+
+#Template: {
+	missingkey?: "default" | "zero" | "error"
+	escape?:     "text" | "html"
+}
+
+#Permissions: {
+	read_inputs?:  bool
+	write_target?: bool
+	target_read_paths?: [...string & !=""]
+	http?: [...string & =~"^https?://"]
+	env?: [...string & =~"^[A-Za-z_][A-Za-z0-9_]*$"]
+	hostname?: bool
 }
 
 #Input: {
-	type!: "file" | "dir"
-	name!: string & =~"^[a-zA-Z0-9-_\\.]{1,64}$"
+	type!:        "file" | "dir"
+	name!:        string & =~"^[a-zA-Z0-9-_\\.]{1,64}$"
+	description?: string
+	required?:    bool
+	default?:     string & !=""
+}
+
+#Extra: {
+	type!:        "file" | "dir"
+	name!:        string & =~"^[a-zA-Z0-9-_\\.]{1,64}$"
+	description?: string
+	required?:    bool
 }
@@ -0,0 +1,405 @@
+package rpack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/blang/rpack/pkg/rpack/getsource"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// DefCacheDirEnv overrides the directory of the shared definition cache, see DefaultDefCacheDir.
+const DefCacheDirEnv = "RPACK_DEF_CACHE_DIR"
+
+// Directories of the shared definition cache.
+const (
+	defCacheDirContent = "content"
+	defCacheDirSources = "sources"
+	defCacheDirTemp    = "tmp"
+)
+
+// defCacheTempMaxAge is the age after which the temp dir of a fetch is assumed to be left by a crashed run.
+const defCacheTempMaxAge = 24 * time.Hour
+
+// DefaultDefCacheDir returns the directory of the definition cache shared by all targets of the user,
+// $RPACK_DEF_CACHE_DIR or rpack/defs below the user cache directory. It is empty if neither is available.
+func DefaultDefCacheDir() string {
+	if dir := os.Getenv(DefCacheDirEnv); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "rpack", "defs")
+}
+
+// defCache stores fetched remote definitions once per user instead of once per target.
+// Definitions are stored in content/<digest> by the digest of their files, sources/<sha256 of address>.json
+// maps a source address to the digest it resolved to. The source directory of a pack in .rpack.d
+// links to the stored definition, so targets using the same definition share a single copy.
+type defCache struct {
+	dir string
+	// ttl reuses definitions of sources that are not pinned if they were fetched within the ttl,
+	// 0 fetches them on every run. Pinned sources are never fetched again
+	ttl   time.Duration
+	fetch func(ctx context.Context, destDir, sourceAddr string) error
+	log   *slog.Logger
+}
+
+// newDefCache returns the cache in dir, nil if dir is empty.
+func newDefCache(dir string, ttl time.Duration, log *slog.Logger) *defCache {
+	if dir == "" {
+		return nil
+	}
+	return &defCache{dir: dir, ttl: ttl, fetch: getsource.DefaultFetcher().Fetch, log: log}
+}
+
+// defCacheSource is the last resolution of a source address.
+type defCacheSource struct {
+	Source    string    `json:"source"`
+	Digest    string    `json:"digest"`
+	FetchedAt time.Time `json:"fetched_at"`
+
+	// file the resolution is stored in, set by defCacheSources
+	file string
+}
+
+// cacheable reports if the definition at the normalized package address is stored in the cache.
+// Local sources are linked by the fetcher and never stored.
+func (c *defCache) cacheable(packageAddr string) bool {
+	return c != nil && getsource.SourceProtocol(packageAddr) != "file"
+}
+
+// load provides the definition at packageAddr in dst, fetching it only if the cache
+// has no current copy. A stored copy not matching its digest is fetched again. dst must not exist.
+func (c *defCache) load(ctx context.Context, packageAddr, dst string) error {
+	digest, ok := c.lookup(packageAddr)
+	if ok {
+		if err := c.verify(digest); err != nil {
+			c.log.Warn("Cached definition was modified, fetching it again", "source", packageAddr, "error", err)
+			ok = false
+		} else {
+			c.log.Debug("Use cached definition", "source", packageAddr, "digest", digest)
+		}
+	}
+	if !ok {
+		var err error
+		if digest, err = c.store(ctx, packageAddr); err != nil {
+			return err
+		}
+	}
+	return linkDefDir(c.contentDir(digest), dst)
+}
+
+func (c *defCache) contentDir(digest string) string {
+	return filepath.Join(c.dir, defCacheDirContent, digest)
+}
+
+func (c *defCache) sourceFile(packageAddr string) string {
+	return filepath.Join(c.dir, defCacheDirSources, util.Sha256String(packageAddr)+".json")
+}
+
+// lookup returns the digest of the stored definition of packageAddr if it can be used without fetching.
+func (c *defCache) lookup(packageAddr string) (string, bool) {
+	b, err := os.ReadFile(util.LongPath(c.sourceFile(packageAddr)))
+	if err != nil {
+		return "", false
+	}
+	var src defCacheSource
+	if err = json.Unmarshal(b, &src); err != nil || src.Source != packageAddr || !isCacheKey(src.Digest) {
+		return "", false
+	}
+	if !getsource.PinnedSource(packageAddr) && (c.ttl <= 0 || time.Since(src.FetchedAt) > c.ttl) {
+		return "", false
+	}
+	if _, err = os.Stat(util.LongPath(c.contentDir(src.Digest))); err != nil {
+		return "", false
+	}
+	return src.Digest, true
+}
+
+// verify checks that the stored definition matches digest, a modified copy is removed.
+// The last use of a matching copy is recorded for GCDefCache.
+func (c *defCache) verify(digest string) error {
+	content := c.contentDir(digest)
+	actual, err := defContentDigest(content)
+	if err == nil && actual != digest {
+		err = fmt.Errorf("digest %s does not match the stored %s", actual, digest)
+	}
+	if err != nil {
+		return errors.Join(err, os.RemoveAll(util.LongPath(content)))
+	}
+	now := time.Now()
+	_ = os.Chtimes(util.LongPath(content), now, now)
+	return nil
+}
+
+// store fetches packageAddr and stores it by its digest, an identical definition is stored once.
+func (c *defCache) store(ctx context.Context, packageAddr string) (string, error) {
+	tempRoot := filepath.Join(c.dir, defCacheDirTemp)
+	if err := os.MkdirAll(util.LongPath(tempRoot), 0o755); err != nil { //nolint:gosec // intentional: standard directory permissions
+		return "", fmt.Errorf("could not setup definition cache %s: %w", c.dir, err)
+	}
+	if _, err := removeDefCacheTemp(c.dir, defCacheTempMaxAge); err != nil {
+		c.log.Debug("Could not remove temp dirs of earlier fetches", "error", err)
+	}
+	tempDir, err := os.MkdirTemp(util.LongPath(tempRoot), "fetch-")
+	if err != nil {
+		return "", fmt.Errorf("could not setup definition cache %s: %w", c.dir, err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	fetched := filepath.Join(tempDir, "source")
+	if err = c.fetch(ctx, fetched, packageAddr); err != nil {
+		return "", err
+	}
+	digest, err := defContentDigest(fetched)
+	if err != nil {
+		return "", fmt.Errorf("could not digest fetched definition: %w", err)
+	}
+	content := c.contentDir(digest)
+	if err = os.MkdirAll(util.LongPath(filepath.Dir(content)), 0o755); err != nil { //nolint:gosec // intentional: standard directory permissions
+		return "", fmt.Errorf("could not setup definition cache %s: %w", c.dir, err)
+	}
+	// Another run may have stored the same definition meanwhile, its copy is kept
+	if err = os.Rename(util.LongPath(fetched), util.LongPath(content)); err != nil {
+		if _, statErr := os.Stat(util.LongPath(content)); statErr != nil {
+			return "", fmt.Errorf("could not store definition in cache: %w", err)
+		}
+	}
+	c.log.Debug("Stored definition in cache", "source", packageAddr, "digest", digest)
+	if err = c.writeSource(&defCacheSource{Source: packageAddr, Digest: digest, FetchedAt: time.Now().UTC()}); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// writeSource records the resolution of a source address, replacing the file so readers never see partial content.
+func (c *defCache) writeSource(src *defCacheSource) error {
+	name := c.sourceFile(src.Source)
+	if err := os.MkdirAll(util.LongPath(filepath.Dir(name)), 0o755); err != nil { //nolint:gosec // intentional: standard directory permissions
+		return fmt.Errorf("could not setup definition cache %s: %w", c.dir, err)
+	}
+	b, err := json.MarshalIndent(src, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp := name + "." + newRunID()
+	if err = os.WriteFile(util.LongPath(temp), b, 0o644); err != nil { //nolint:gosec // intentional: standard file permissions
+		return fmt.Errorf("could not write definition cache index: %w", err)
+	}
+	if err = os.Rename(util.LongPath(temp), util.LongPath(name)); err != nil {
+		_ = os.Remove(util.LongPath(temp))
+		return fmt.Errorf("could not write definition cache index: %w", err)
+	}
+	return nil
+}
+
+// defContentDigest returns the sha256 over the paths and contents of the files below dir.
+// Version control directories are skipped, two clones of the same commit have the same digest.
+func defContentDigest(dir string) (string, error) {
+	hasher := sha256.New()
+	err := filepath.WalkDir(util.LongPath(dir), func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(util.LongPath(dir), name)
+		if err != nil {
+			return err
+		}
+		sum, err := util.Sha256File(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hasher, "%s\x00%s\n", filepath.ToSlash(rel), sum)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// removeDefCacheTemp removes the temp dirs of fetches in the definition cache dir older than maxAge,
+// fetches of crashed runs leave them behind. It returns the removed dirs.
+func removeDefCacheTemp(dir string, maxAge time.Duration) ([]string, error) {
+	tempRoot := filepath.Join(dir, defCacheDirTemp)
+	entries, err := os.ReadDir(util.LongPath(tempRoot))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var removed []string
+	var errs []error
+	for _, d := range entries {
+		info, err := d.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		name := filepath.Join(tempRoot, d.Name())
+		if err = os.RemoveAll(util.LongPath(name)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, name)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// ListDefCache lists the definitions of the shared definition cache in dir, most recently used first.
+// Definitions are referenced if a source address last resolved to them.
+func ListDefCache(dir string) ([]*CacheEntry, error) {
+	contentRoot := filepath.Join(dir, defCacheDirContent)
+	contents, err := os.ReadDir(util.LongPath(contentRoot))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read definition cache: %w", err)
+	}
+	sources, err := defCacheSources(dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*CacheEntry
+	for _, d := range contents {
+		if !d.IsDir() || !isCacheKey(d.Name()) {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil, fmt.Errorf("could not read definition cache: %w", err)
+		}
+		e := &CacheEntry{Key: d.Name(), Path: filepath.Join(contentRoot, d.Name()), LastUsed: info.ModTime()}
+		if srcs := sources[d.Name()]; len(srcs) > 0 {
+			e.Source = srcs[0].Source
+		}
+		if e.Size, err = defDirSize(e.Path); err != nil {
+			return nil, fmt.Errorf("could not read definition cache: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastUsed.After(entries[j].LastUsed) })
+	return entries, nil
+}
+
+// defDirSize returns the size of the files below dir.
+func defDirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(util.LongPath(dir), func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// defCacheSources returns the resolutions of the source addresses in the definition cache dir by digest.
+func defCacheSources(dir string) (map[string][]*defCacheSource, error) {
+	names, err := filepath.Glob(filepath.Join(dir, defCacheDirSources, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string][]*defCacheSource)
+	for _, name := range names {
+		b, err := os.ReadFile(util.LongPath(name)) //nolint:gosec // cache file
+		if err != nil {
+			return nil, fmt.Errorf("could not read definition cache index: %w", err)
+		}
+		var src defCacheSource
+		if json.Unmarshal(b, &src) != nil || !isCacheKey(src.Digest) {
+			continue
+		}
+		src.file = name
+		sources[src.Digest] = append(sources[src.Digest], &src)
+	}
+	return sources, nil
+}
+
+// GCDefCache removes the definitions of the shared definition cache in dir no source resolves to and,
+// if a TTL is set, definitions not used within the TTL, as well as the temp dirs of fetches of crashed runs.
+// It returns the removed definitions, they are fetched again when needed.
+func GCDefCache(dir string, ttl time.Duration, dryRun bool) ([]*CacheEntry, error) {
+	entries, err := ListDefCache(dir)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := defCacheSources(dir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []*CacheEntry
+	for _, e := range entries {
+		expired := ttl > 0 && time.Since(e.LastUsed) > ttl
+		if e.Referenced() && !expired {
+			continue
+		}
+		if !dryRun {
+			// The index goes first, a source must never resolve to a removed definition
+			for _, src := range sources[e.Key] {
+				if err = os.Remove(util.LongPath(src.file)); err != nil && !os.IsNotExist(err) {
+					return removed, fmt.Errorf("could not remove cached definition %s: %w", e.Key, err)
+				}
+			}
+			if err = os.RemoveAll(util.LongPath(e.Path)); err != nil {
+				return removed, fmt.Errorf("could not remove cached definition %s: %w", e.Key, err)
+			}
+		}
+		removed = append(removed, e)
+	}
+	if !dryRun {
+		if _, err = removeDefCacheTemp(dir, defCacheTempMaxAge); err != nil {
+			return removed, fmt.Errorf("could not remove temp dirs of the definition cache: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+// PurgeDefCache removes all definitions of the shared definition cache in dir.
+func PurgeDefCache(dir string) ([]*CacheEntry, error) {
+	entries, err := ListDefCache(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range []string{defCacheDirSources, defCacheDirContent, defCacheDirTemp} {
+		if err = os.RemoveAll(util.LongPath(filepath.Join(dir, sub))); err != nil {
+			return nil, fmt.Errorf("could not purge definition cache: %w", err)
+		}
+	}
+	return entries, nil
+}
+
+// linkDefDir links dst to the stored definition in src, like the fetcher links local sources.
+// Where symbolic links are not available, the definition is copied.
+func linkDefDir(src, dst string) error {
+	err := os.Symlink(src, util.LongPath(dst))
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("could not link cached definition: %w", err)
+	}
+	return copySourceFS(os.DirFS(util.LongPath(src)), dst)
+}
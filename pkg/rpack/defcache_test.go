@@ -0,0 +1,136 @@
+package rpack
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+func TestDefCache(t *testing.T) {
+	fetches := 0
+	c := &defCache{dir: t.TempDir(), log: slog.Default(), fetch: func(_ context.Context, destDir, _ string) error {
+		fetches++
+		if err := os.MkdirAll(filepath.Join(destDir, ".git"), 0o755); err != nil { //nolint:gosec // test dir
+			return err
+		}
+		// Clones differ in their version control data only
+		if err := os.WriteFile(filepath.Join(destDir, ".git", "index"), []byte(time.Now().String()), 0o644); err != nil { //nolint:gosec // test file
+			return err
+		}
+		return os.WriteFile(filepath.Join(destDir, "rpack.yaml"), []byte("name: app\n"), 0o644) //nolint:gosec // test file
+	}}
+	load := func(addr string) {
+		t.Helper()
+		dst := filepath.Join(t.TempDir(), RPackCacheDir, "source")
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		if err := c.load(t.Context(), addr, dst); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := os.ReadFile(filepath.Join(dst, "rpack.yaml")); err != nil || string(b) != "name: app\n" { //nolint:gosec // test file
+			t.Fatalf("Expected the definition in the source dir, got %q, %v", b, err)
+		}
+	}
+
+	// Pinned sources are fetched once for all targets
+	pinned := "git::https://example.com/def.git?ref=0123456789abcdef0123456789abcdef01234567"
+	load(pinned)
+	load(pinned)
+	if fetches != 1 {
+		t.Errorf("Expected a pinned source fetched once, got %d fetches", fetches)
+	}
+
+	// Other sources are fetched on every run, identical content is stored once
+	branch := "git::https://example.com/def.git?ref=main"
+	load(branch)
+	load(branch)
+	if fetches != 3 {
+		t.Errorf("Expected a branch fetched on every run, got %d fetches", fetches)
+	}
+	if entries, err := os.ReadDir(filepath.Join(c.dir, defCacheDirContent)); err != nil || len(entries) != 1 {
+		t.Errorf("Expected identical definitions stored once, got %v, %v", entries, err)
+	}
+
+	// Within the TTL, cached definitions of other sources are reused
+	c.ttl = time.Hour
+	load(branch)
+	if fetches != 3 {
+		t.Errorf("Expected a branch reused within the TTL, got %d fetches", fetches)
+	}
+	if c.cacheable("file:///tmp/def") || (*defCache)(nil).cacheable(branch) {
+		t.Error("Expected local sources and a disabled cache to bypass the cache")
+	}
+
+	// A modified copy is not linked but fetched again
+	digest, _ := c.lookup(pinned)
+	if err := os.WriteFile(filepath.Join(c.contentDir(digest), "rpack.yaml"), []byte("name: evil\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	load(pinned)
+	if fetches != 4 {
+		t.Errorf("Expected a modified definition fetched again, got %d fetches", fetches)
+	}
+}
+
+func TestGCDefCache(t *testing.T) {
+	c := &defCache{dir: t.TempDir(), log: slog.Default(), fetch: func(_ context.Context, destDir, sourceAddr string) error {
+		if err := os.MkdirAll(destDir, 0o755); err != nil { //nolint:gosec // test dir
+			return err
+		}
+		return os.WriteFile(filepath.Join(destDir, "rpack.yaml"), []byte("source: "+sourceAddr+"\n"), 0o644) //nolint:gosec // test file
+	}}
+	used, err := c.store(t.Context(), "git::https://example.com/used.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := c.store(t.Context(), "git::https://example.com/old.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	if err = os.Chtimes(c.contentDir(old), past, past); err != nil {
+		t.Fatal(err)
+	}
+	// Definitions no source resolves to and temp dirs of crashed fetches
+	orphan := c.contentDir(util.Sha256String("orphan"))
+	crashed := filepath.Join(c.dir, defCacheDirTemp, "fetch-1")
+	for _, dir := range []string{orphan, crashed} {
+		if err = os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+	}
+	if err = os.Chtimes(crashed, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ListDefCache(c.dir)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("Expected 3 cached definitions, got %+v, %v", entries, err)
+	}
+	removed, err := GCDefCache(c.dir, 0, false)
+	if err != nil || len(removed) != 1 || removed[0].Path != orphan {
+		t.Fatalf("Expected the unreferenced definition removed, got %+v, %v", removed, err)
+	}
+	if _, err = os.Stat(crashed); !os.IsNotExist(err) {
+		t.Errorf("Expected the temp dir of a crashed fetch removed, got %v", err)
+	}
+	if removed, err = GCDefCache(c.dir, 24*time.Hour, false); err != nil || len(removed) != 1 || removed[0].Key != old {
+		t.Fatalf("Expected the expired definition removed, got %+v, %v", removed, err)
+	}
+	if _, ok := c.lookup("git::https://example.com/old.git"); ok {
+		t.Error("Expected the source of the expired definition removed")
+	}
+
+	if removed, err = PurgeDefCache(c.dir); err != nil || len(removed) != 1 || removed[0].Key != used {
+		t.Fatalf("Expected the remaining definition purged, got %+v, %v", removed, err)
+	}
+	if _, err = os.Stat(filepath.Join(c.dir, defCacheDirSources)); !os.IsNotExist(err) {
+		t.Errorf("Expected the sources purged, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package rpack
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/blang/rpack/pkg/rpack/getsource"
+)
+
+// defDependencySource resolves the source of a dependency declared by the definition of the source parent.
+// Sources with a ./ or ../ prefix are relative to the declaring definition, others are used as is.
+func defDependencySource(parent, source string) (string, error) {
+	if !strings.HasPrefix(source, "./") && !strings.HasPrefix(source, "../") {
+		return source, nil
+	}
+	normalized, err := getsource.NormalizeSource(parent)
+	if err != nil {
+		return "", fmt.Errorf("source detection failed: %s: %w", parent, err)
+	}
+	packageAddr, subDir := getsource.SplitSourceSubdir(normalized)
+	if local, ok := strings.CutPrefix(packageAddr, "file://"); ok {
+		return filepath.Join(filepath.FromSlash(local), subDir, filepath.FromSlash(source)), nil
+	}
+
+	// The dependency has to be part of the fetched package, it is addressed by its subdirectory
+	addr, query, _ := strings.Cut(packageAddr, "?")
+	dir := path.Join(filepath.ToSlash(subDir), source)
+	if !filepath.IsLocal(filepath.FromSlash(dir)) {
+		return "", fmt.Errorf("relative source %s leaves the package %s, use an absolute source", source, addr)
+	}
+	resolved := addr
+	if dir != "." {
+		resolved += "//" + dir
+	}
+	if query != "" {
+		resolved += "?" + query
+	}
+	return resolved, nil
+}
+
+// sameSource reports if the sources a and b address the same definition.
+func sameSource(a, b string) bool {
+	if a == b {
+		return true
+	}
+	na, errA := getsource.NormalizeSource(a)
+	nb, errB := getsource.NormalizeSource(b)
+	return errA == nil && errB == nil && na == nb
+}
+
+// defDependencyOrigin locates the declaration of a dependency, see RPackDef.Dependencies.
+type defDependencyOrigin struct {
+	// file is the rpack.yaml declaring the dependency
+	file string
+	// index of the dependency in the file
+	index int
+}
+
+// defDependencies tracks the packs of a run including the packs added for the dependencies of their definitions.
+type defDependencies struct {
+	// packs of the run in the order they were added
+	packs []*RPackConfigPack
+	// byName holds the packs of the run by name
+	byName map[string]*RPackConfigPack
+	// instances holds the loaded packs by name
+	instances map[string]*RPackInstance
+	// declared holds the names of the dependencies declared by the definition of a pack
+	declared map[string][]string
+	// origins locates the packs added for a dependency
+	origins map[string]defDependencyOrigin
+	loader  Loader
+}
+
+func newDefDependencies(packs []*RPackConfigPack, loader Loader) *defDependencies {
+	d := &defDependencies{
+		loader:    loader,
+		packs:     slices.Clone(packs),
+		byName:    make(map[string]*RPackConfigPack, len(packs)),
+		instances: make(map[string]*RPackInstance, len(packs)),
+		declared:  make(map[string][]string),
+		origins:   make(map[string]defDependencyOrigin),
+	}
+	for _, p := range packs {
+		d.byName[p.Name] = p
+	}
+	return d
+}
+
+// add records the loaded pack pi and adds a pack for each dependency of its definition.
+// A pack of the config with the same name and source is used instead, the pack of pi then depends on
+// the packs of its dependencies. It returns the added packs, they need to be loaded as well.
+// Definitions failing to load are skipped, the validation reports them.
+func (d *defDependencies) add(pi *RPackInstance) ([]*RPackConfigPack, error) {
+	pack := pi.Pack
+	d.instances[pack.Name] = pi
+	defFile := filepath.Join(pi.SourcePath, RPackDefDefaultFilename)
+	def, err := d.loader.LoadRPackDef(defFile)
+	if err != nil || len(def.Dependencies) == 0 {
+		return nil, nil
+	}
+
+	with := *pack
+	with.DependsOn = slices.Clone(pack.DependsOn)
+	var added []*RPackConfigPack
+	for idx, dep := range def.Dependencies {
+		if dep.Name == "" || dep.Source == "" {
+			continue
+		}
+		source, err := defDependencySource(pack.Source, dep.Source)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: %w", dep.Name, err)
+		}
+		depPack := &RPackConfigPack{Name: dep.Name, Source: source, Script: dep.Script}
+		if dep.Values != nil {
+			depPack.Config = &RPackConfigConfig{Values: dep.Values}
+		}
+		if existing, ok := d.byName[dep.Name]; ok {
+			if !sameSource(existing.Source, source) {
+				return nil, fmt.Errorf("dependency %s of source %s conflicts with pack %s of source %s: %w", dep.Name, source, existing.Name, existing.Source, ErrValidation)
+			}
+			if _, isDep := d.origins[dep.Name]; isDep && (existing.Script != depPack.Script || !reflect.DeepEqual(existing.ConfigOrEmpty().Values, depPack.ConfigOrEmpty().Values)) {
+				return nil, fmt.Errorf("dependency %s is declared with different values or script by several definitions: %w", dep.Name, ErrValidation)
+			}
+		} else {
+			d.byName[dep.Name] = depPack
+			d.origins[dep.Name] = defDependencyOrigin{file: defFile, index: idx}
+			d.packs = append(d.packs, depPack)
+			added = append(added, depPack)
+		}
+		if !slices.Contains(with.DependsOn, dep.Name) {
+			with.DependsOn = append(with.DependsOn, dep.Name)
+		}
+		d.declared[pack.Name] = append(d.declared[pack.Name], dep.Name)
+	}
+	d.byName[pack.Name] = &with
+	d.packs[slices.Index(d.packs, pack)] = &with
+	pi.Pack = &with
+	return added, nil
+}
+
+// executor returns the executor of the named pack, which reads the outputs of the dependencies of its definition.
+func (d *defDependencies) executor(e *Executor, pack string) *Executor {
+	names := d.declared[pack]
+	if len(names) == 0 {
+		return e
+	}
+	withDeps := *e
+	withDeps.depOutputs = make(map[string]string, len(names))
+	for _, name := range names {
+		withDeps.depOutputs[name] = d.instances[name].RunPath
+	}
+	return &withDeps
+}
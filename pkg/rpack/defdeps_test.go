@@ -0,0 +1,112 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestDefDependencySource(t *testing.T) {
+	for _, tc := range []struct {
+		parent, source, want string
+	}{
+		{"github.com/org/defs//app?ref=v1", "../base", "git::https://github.com/org/defs.git//base?ref=v1"},
+		{"github.com/org/defs//app", "./lib", "git::https://github.com/org/defs.git//app/lib"},
+		{"github.com/org/defs//app", "github.com/org/other", "github.com/org/other"},
+	} {
+		got, err := defDependencySource(tc.parent, tc.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("defDependencySource(%q, %q) = %q, want %q", tc.parent, tc.source, got, tc.want)
+		}
+	}
+	if _, err := defDependencySource("github.com/org/defs//app", "../../base"); err == nil {
+		t.Fatal("Expected an error for a source outside of the package")
+	}
+	got, err := defDependencySource("/defs/app", "../base")
+	if err != nil || got != filepath.FromSlash("/defs/base") {
+		t.Fatalf("Expected the local source resolved, got %q, %v", got, err)
+	}
+}
+
+func TestRunDefDependencies(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"base/rpack.yaml": "\"@schema_version\": \"v1\"\nname: \"base\"\n",
+		"base/script.lua": "local rpack = require(\"rpack.v1\")\nrpack.write(\"./base.txt\", rpack.values().greeting .. \"\\n\")\n",
+		"app/rpack.yaml": "\"@schema_version\": \"v1\"\nname: \"app\"\ndependencies:\n" +
+			"  - name: base\n    source: ../base\n    values:\n      greeting: hello\n",
+		"app/script.lua":   "local rpack = require(\"rpack.v1\")\nrpack.write(\"./app.txt\", \"app: \" .. rpack.read(\"dep:base/base.txt\"))\n",
+		"other/rpack.yaml": "\"@schema_version\": \"v1\"\nname: \"other\"\ndependencies:\n  - name: base\n    source: ../base\n    values:\n      greeting: hi\n",
+		"other/script.lua": "local rpack = require(\"rpack.v1\")\nrpack.write(\"dep:base/base.txt\", \"changed\")\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	workDir := filepath.Join(dir, "work")
+	if err := os.MkdirAll(workDir, 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	config := filepath.Join(workDir, "app.rpack.yaml")
+	if err := os.WriteFile(config, []byte("\"@schema_version\": \"v1\"\nsource: \""+filepath.ToSlash(filepath.Join(dir, "app"))+"\"\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"base.txt": "hello\n", "app.txt": "app: hello\n"} {
+		b, err := os.ReadFile(filepath.Join(workDir, name)) //nolint:gosec // test file
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("Expected %s to be %q, got %q", name, want, b)
+		}
+	}
+	lock, err := os.ReadFile(filepath.Join(workDir, "app.rpack.lock.yaml")) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(lock), "pack: base") {
+		t.Errorf("Expected the outputs of the dependency tracked by its pack, got %s", lock)
+	}
+
+	// The cached dependency is referenced through the definition, cache gc keeps it
+	entries, err := ListCache(workDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected cache entries of app and base, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if !entry.Referenced() {
+			t.Errorf("Expected cache entry %s to be referenced", entry.Path)
+		}
+	}
+
+	// Outputs of dependencies are read-only
+	if err = os.WriteFile(config, []byte("\"@schema_version\": \"v1\"\nsource: \""+filepath.ToSlash(filepath.Join(dir, "other"))+"\"\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	_, err = Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true})
+	if err == nil || !strings.Contains(err.Error(), "outputs of dependencies are read-only") {
+		t.Fatalf("Expected writing outputs of a dependency denied, got %v", err)
+	}
+
+	// A definition with dependencies needs a config to run them
+	if err = (&Executor{DryRun: true, OverrideExecPath: workDir}).ExecRPackDirect(t.Context(), filepath.Join(dir, "app"), nil, nil); err == nil || !strings.Contains(err.Error(), "outputs of dependency base are missing") {
+		t.Fatalf("Expected missing dependency outputs, got %v", err)
+	}
+}
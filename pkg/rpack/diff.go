@@ -0,0 +1,410 @@
+package rpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DiffOpKind is the kind of a line in a diff.
+type DiffOpKind byte
+
+// Diff operation kinds, matching the unified diff line prefixes.
+const (
+	DiffOpEqual  DiffOpKind = ' '
+	DiffOpDelete DiffOpKind = '-'
+	DiffOpInsert DiffOpKind = '+'
+)
+
+// DiffOp is a single line of an edit script.
+type DiffOp struct {
+	Kind DiffOpKind
+	// Line including its line terminator, if any
+	Line string
+}
+
+// diffContextLines is the number of unchanged lines around changes in unified diffs.
+const diffContextLines = 3
+
+// splitLines splits content into lines keeping the line terminators.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// DiffLines computes the shortest edit script between two lists of lines
+// using the Myers algorithm.
+func DiffLines(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	maxD := n + m
+	if maxD == 0 {
+		return nil
+	}
+	off := maxD
+	v := make([]int, 2*maxD+2)
+	var trace [][]int
+
+search:
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+off] < v[k+1+off]) {
+				x = v[k+1+off]
+			} else {
+				x = v[k-1+off] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+off] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Backtrack through the recorded frontiers to build the edit script
+	ops := make([]DiffOp, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		tv := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && tv[k-1+off] < tv[k+1+off]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := tv[prevK+off]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, DiffOp{Kind: DiffOpEqual, Line: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, DiffOp{Kind: DiffOpInsert, Line: b[y-1]})
+				y--
+			} else {
+				ops = append(ops, DiffOp{Kind: DiffOpDelete, Line: a[x-1]})
+				x--
+			}
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// UnifiedDiff returns a unified diff between the old and new content
+// or an empty string if both are equal.
+func UnifiedDiff(oldName, newName string, oldContent, newContent []byte) string {
+	ops := DiffLines(splitLines(string(oldContent)), splitLines(string(newContent)))
+	return formatUnifiedDiff(oldName, newName, ops)
+}
+
+// DiffOptions control which differences are considered changes.
+type DiffOptions struct {
+	// IgnoreTrailingWhitespace ignores spaces and tabs at the end of lines
+	IgnoreTrailingWhitespace bool
+
+	// IgnoreEOL ignores line ending differences, e.g. CRLF vs LF or a missing final newline
+	IgnoreEOL bool
+
+	// Semantic compares JSON and YAML files by their parsed structure
+	Semantic bool
+
+	// SemanticPaths enables Semantic for target paths matching one of the patterns.
+	// Patterns without a slash match the file name in any directory.
+	SemanticPaths []string
+}
+
+// semantic reports if the file is compared by structure.
+func (o DiffOptions) semantic(name string) bool {
+	return o.Semantic || matchPathPattern(o.SemanticPaths, name)
+}
+
+// matchPathPattern reports if the target path matches one of the glob patterns.
+// Patterns without a slash are matched against the file name, like in .gitignore.
+// A ** segment matches any number of directories.
+func matchPathPattern(patterns []string, name string) bool {
+	name = filepath.ToSlash(filepath.Clean(name))
+	for _, pattern := range patterns {
+		target := name
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(name)
+		}
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(target, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments using path.Match,
+// ** matches zero or more segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// textual reports if line based normalization is enabled.
+func (o DiffOptions) textual() bool {
+	return o.IgnoreTrailingWhitespace || o.IgnoreEOL
+}
+
+// normalizeLine returns the line as compared under the options.
+func (o DiffOptions) normalizeLine(line string) string {
+	if !o.textual() {
+		return line
+	}
+	body := strings.TrimRight(line, "\r\n")
+	eol := line[len(body):]
+	if o.IgnoreTrailingWhitespace {
+		body = strings.TrimRight(body, " \t")
+	}
+	if o.IgnoreEOL {
+		return body
+	}
+	return body + eol
+}
+
+// diffLinesWithOptions computes the edit script comparing normalized lines.
+// The ops carry the original lines, equal lines are shown with their new content.
+func diffLinesWithOptions(a, b []string, opts DiffOptions) []DiffOp {
+	if !opts.textual() {
+		return DiffLines(a, b)
+	}
+	na := make([]string, len(a))
+	for i, l := range a {
+		na[i] = opts.normalizeLine(l)
+	}
+	nb := make([]string, len(b))
+	for i, l := range b {
+		nb[i] = opts.normalizeLine(l)
+	}
+	ops := DiffLines(na, nb)
+	i, j := 0, 0
+	for k := range ops {
+		switch ops[k].Kind {
+		case DiffOpEqual:
+			ops[k].Line = b[j]
+			i++
+			j++
+		case DiffOpDelete:
+			ops[k].Line = a[i]
+			i++
+		case DiffOpInsert:
+			ops[k].Line = b[j]
+			j++
+		}
+	}
+	return ops
+}
+
+// UnifiedDiffWithOptions returns a unified diff ignoring the differences
+// disabled by opts, or an empty string if the content is equal under opts.
+func UnifiedDiffWithOptions(name, oldName, newName string, oldContent, newContent []byte, opts DiffOptions) string {
+	if ContentEqual(name, oldContent, newContent, opts) {
+		return ""
+	}
+	ops := diffLinesWithOptions(splitLines(string(oldContent)), splitLines(string(newContent)), opts)
+	return formatUnifiedDiff(oldName, newName, ops)
+}
+
+// ContentEqual reports if two versions of the file name are equal under opts.
+// Semantic comparison applies to .json, .yaml and .yml files that parse successfully.
+func ContentEqual(name string, a, b []byte, opts DiffOptions) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	if opts.semantic(name) {
+		if equal, ok := semanticEqual(name, a, b); ok {
+			return equal
+		}
+	}
+	if !opts.textual() {
+		return false
+	}
+	la, lb := splitLines(string(a)), splitLines(string(b))
+	if len(la) != len(lb) {
+		return false
+	}
+	for i := range la {
+		if opts.normalizeLine(la[i]) != opts.normalizeLine(lb[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// semanticEqual compares JSON and YAML documents by structure,
+// ok is false if the file type is not supported or parsing fails.
+func semanticEqual(name string, a, b []byte) (equal, ok bool) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+	default:
+		return false, false
+	}
+	da, err := parseStructuredDocs(a)
+	if err != nil {
+		return false, false
+	}
+	db, err := parseStructuredDocs(b)
+	if err != nil {
+		return false, false
+	}
+	return reflect.DeepEqual(da, db), true
+}
+
+// parseStructuredDocs parses all YAML documents of content, which includes JSON.
+// Values are normalized through JSON so numbers compare equal regardless of notation.
+func parseStructuredDocs(content []byte) ([]any, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	var docs []any
+	for {
+		var doc any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(stringifyKeys(doc))
+		if err != nil {
+			return nil, err
+		}
+		var normalized any
+		if err = json.Unmarshal(b, &normalized); err != nil {
+			return nil, err
+		}
+		docs = append(docs, normalized)
+	}
+}
+
+// stringifyKeys converts maps with non-string keys to be JSON encodable.
+func stringifyKeys(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			t[k] = stringifyKeys(val)
+		}
+		return t
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = stringifyKeys(val)
+		}
+		return m
+	case []any:
+		for i, val := range t {
+			t[i] = stringifyKeys(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// formatUnifiedDiff renders an edit script in unified diff format.
+//
+//nolint:gocognit // intentional: hunk grouping
+func formatUnifiedDiff(oldName, newName string, ops []DiffOp) string {
+	var changes []int
+	for i, op := range ops {
+		if op.Kind != DiffOpEqual {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	writeHunk := func(start, end int) {
+		oldStart, newStart := 1, 1
+		for _, op := range ops[:start] {
+			if op.Kind != DiffOpInsert {
+				oldStart++
+			}
+			if op.Kind != DiffOpDelete {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.Kind != DiffOpInsert {
+				oldCount++
+			}
+			if op.Kind != DiffOpDelete {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, op := range ops[start:end] {
+			sb.WriteByte(byte(op.Kind))
+			sb.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	start := max(0, changes[0]-diffContextLines)
+	end := min(len(ops), changes[0]+1+diffContextLines)
+	for _, c := range changes[1:] {
+		if c-diffContextLines <= end {
+			end = min(len(ops), c+1+diffContextLines)
+			continue
+		}
+		writeHunk(start, end)
+		start = c - diffContextLines
+		end = min(len(ops), c+1+diffContextLines)
+	}
+	writeHunk(start, end)
+	return sb.String()
+}
@@ -0,0 +1,155 @@
+package rpack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	render := func(ops []DiffOp) string {
+		parts := make([]string, 0, len(ops))
+		for _, op := range ops {
+			parts = append(parts, string(op.Kind)+strings.TrimSuffix(op.Line, "\n"))
+		}
+		return strings.Join(parts, " ")
+	}
+	tcs := []struct {
+		a, b     string
+		expected string
+	}{
+		{"", "", ""},
+		{"a\n", "a\n", " a"},
+		{"", "a\nb\n", "+a +b"},
+		{"a\nb\n", "", "-a -b"},
+		{"a\nb\nc\n", "a\nc\n", " a -b  c"},
+		{"a\nc\n", "a\nb\nc\n", " a +b  c"},
+		{"a\nb\n", "a\nc\n", " a -b +c"},
+	}
+	for _, tc := range tcs {
+		got := render(DiffLines(splitLines(tc.a), splitLines(tc.b)))
+		if got != tc.expected {
+			t.Errorf("Diff of %q and %q: expected %q, got %q", tc.a, tc.b, tc.expected, got)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Run("equal", func(t *testing.T) {
+		if d := UnifiedDiff("a", "b", []byte("x\n"), []byte("x\n")); d != "" {
+			t.Errorf("Expected empty diff, got %q", d)
+		}
+	})
+
+	t.Run("hunks", func(t *testing.T) {
+		var oldLines, newLines []string
+		for i := 1; i <= 20; i++ {
+			line := string(rune('a' + i - 1))
+			oldLines = append(oldLines, line)
+			switch i {
+			case 2:
+				newLines = append(newLines, "B")
+			case 18:
+				// removed
+			default:
+				newLines = append(newLines, line)
+			}
+		}
+		oldContent := strings.Join(oldLines, "\n") + "\n"
+		newContent := strings.Join(newLines, "\n") + "\n"
+		expected := `--- a/f
++++ b/f
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -15,6 +15,5 @@
+ o
+ p
+ q
+-r
+ s
+ t
+`
+		if d := UnifiedDiff("a/f", "b/f", []byte(oldContent), []byte(newContent)); d != expected {
+			t.Errorf("Unexpected diff:\n%s", d)
+		}
+	})
+
+	t.Run("new file without final newline", func(t *testing.T) {
+		expected := "--- /dev/null\n+++ b/f\n@@ -0,0 +1,1 @@\n+x\n\\ No newline at end of file\n"
+		if d := UnifiedDiff("/dev/null", "b/f", nil, []byte("x")); d != expected {
+			t.Errorf("Unexpected diff:\n%q", d)
+		}
+	})
+}
+
+func TestContentEqual(t *testing.T) {
+	tcs := []struct {
+		name     string
+		a, b     string
+		opts     DiffOptions
+		expected bool
+	}{
+		{"a.txt", "x \ny\n", "x\ny\n", DiffOptions{}, false},
+		{"a.txt", "x \ny\t\n", "x\ny\n", DiffOptions{IgnoreTrailingWhitespace: true}, true},
+		{"a.txt", " x\n", "x\n", DiffOptions{IgnoreTrailingWhitespace: true}, false},
+		{"a.txt", "x\r\ny\r\n", "x\ny\n", DiffOptions{}, false},
+		{"a.txt", "x\r\ny\r\n", "x\ny", DiffOptions{IgnoreEOL: true}, true},
+		{"a.txt", "x\r\ny\r\n", "x\ny\nz\n", DiffOptions{IgnoreEOL: true}, false},
+		{"a.json", `{"a": 1, "b": [1, 2]}`, "{\n  \"b\": [1, 2],\n  \"a\": 1.0\n}\n", DiffOptions{Semantic: true}, true},
+		{"a.json", `{"a": 1}`, `{"a": 2}`, DiffOptions{Semantic: true}, false},
+		{"a.yaml", "a: 1\nb: {c: x}\n", "# comment\nb:\n  c: \"x\"\na: 1\n", DiffOptions{Semantic: true}, true},
+		{"a.yml", "a: 1\n---\nb: 2\n", "a: 1\n---\nb: 3\n", DiffOptions{Semantic: true}, false},
+		{"a.yaml", "a: 1\n", "a: 1 \n", DiffOptions{}, false},
+		{"a.txt", "a: 1\n", "a:   1\n", DiffOptions{Semantic: true}, false},
+		// Unparseable content falls back to the text comparison
+		{"a.json", "{ \n", "{\n", DiffOptions{Semantic: true, IgnoreTrailingWhitespace: true}, true},
+	}
+	for _, tc := range tcs {
+		if got := ContentEqual(tc.name, []byte(tc.a), []byte(tc.b), tc.opts); got != tc.expected {
+			t.Errorf("ContentEqual(%s, %q, %q, %+v) = %t, expected %t", tc.name, tc.a, tc.b, tc.opts, got, tc.expected)
+		}
+	}
+}
+
+func TestUnifiedDiffWithOptions(t *testing.T) {
+	opts := DiffOptions{IgnoreTrailingWhitespace: true, IgnoreEOL: true}
+	got := UnifiedDiffWithOptions("f", "a/f", "b/f", []byte("a \r\nb\r\nc\r\n"), []byte("a\nB\nc\n"), opts)
+	expected := "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\r\n+B\n c\n"
+	if got != expected {
+		t.Errorf("Expected:\n%q\ngot:\n%q", expected, got)
+	}
+	if got := UnifiedDiffWithOptions("f", "a/f", "b/f", []byte("a \n"), []byte("a\n"), opts); got != "" {
+		t.Errorf("Expected no diff, got:\n%s", got)
+	}
+}
+
+func TestMatchPathPattern(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{[]string{"*.yaml"}, "values.yaml", true},
+		{[]string{"*.yaml"}, "deploy/values.yaml", true},
+		{[]string{"deploy/*.json"}, "deploy/a.json", true},
+		{[]string{"deploy/*.json"}, "other/deploy/a.json", false},
+		{[]string{"*.json", "*.yml"}, "a.yaml", false},
+		{nil, "a.yaml", false},
+		{[]string{"docs/**"}, "docs/a/b.md", true},
+		{[]string{"docs/**"}, "docs/a.md", true},
+		{[]string{"docs/**"}, "docsx/a.md", false},
+		{[]string{"**/gen/*.go"}, "gen/a.go", true},
+		{[]string{"**/gen/*.go"}, "pkg/x/gen/a.go", true},
+		{[]string{"a/**/b"}, "a/b", true},
+		{[]string{"a/**/b"}, "a/x/y/c", false},
+	}
+	for _, tt := range tests {
+		if got := matchPathPattern(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("matchPathPattern(%v, %q) = %t, expected %t", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DiffFile is the before and after content of a target file of a dry-run.
+type DiffFile struct {
+	// Path relative to the target directory
+	Path string
+	// Pack that writes the file, only set for multi-pack configs
+	Pack   string
+	Action PlanAction
+	// Managed reports if the existing file is tracked by the lockfile
+	Managed bool
+	// Old is the current content of the target file, nil for additions
+	Old []byte
+	// New is the generated content, nil for removals
+	New []byte
+	// FormattingOnly is set for unchanged files whose content differs
+	// only in ways ignored by the diff options
+	FormattingOnly bool
+
+	opts DiffOptions
+}
+
+// Binary reports if either side looks like binary data.
+func (d *DiffFile) Binary() bool {
+	return isBinary(d.Old) || isBinary(d.New)
+}
+
+// OldName returns the name of the before side in diffs, /dev/null for additions.
+func (d *DiffFile) OldName() string {
+	if d.Action == PlanActionAdd {
+		return "/dev/null"
+	}
+	return "a/" + d.Path
+}
+
+// NewName returns the name of the after side in diffs, /dev/null for removals.
+func (d *DiffFile) NewName() string {
+	if d.Action == PlanActionRemove {
+		return "/dev/null"
+	}
+	return "b/" + d.Path
+}
+
+// UnifiedDiff returns the unified diff of the file, empty if unchanged.
+func (d *DiffFile) UnifiedDiff() string {
+	return UnifiedDiffWithOptions(d.Path, d.OldName(), d.NewName(), d.Old, d.New, d.opts)
+}
+
+// collectDiffFiles pairs the generated files with the current target in execPath.
+// Files tracked by oldLock that are no longer generated are reported as removals,
+// opts decide which modifications are ignored. The result is sorted by path.
+func collectDiffFiles(execPath string, files []*packTargetFile, oldLock *RPackLockFile, opts DiffOptions) ([]*DiffFile, error) {
+	managed := make(map[string]struct{})
+	for _, f := range oldLock.Files {
+		managed[f.Path] = struct{}{}
+	}
+	generated := make(map[string]struct{})
+	var diffs []*DiffFile
+
+	for _, f := range files {
+		generated[f.Path] = struct{}{}
+		newContent, err := os.ReadFile(f.AbsPath) //nolint:gosec // path constructed from run directory
+		if err != nil {
+			return nil, fmt.Errorf("failed to read generated file: %s: %w", f.Path, err)
+		}
+		oldContent, exists, err := readTargetFile(filepath.Join(execPath, f.Path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read target file: %s: %w", f.Path, err)
+		}
+		_, isManaged := managed[f.Path]
+		d := &DiffFile{
+			Path:    f.Path,
+			Pack:    f.Pack,
+			Managed: isManaged,
+			Old:     oldContent,
+			New:     newContent,
+			opts:    opts,
+		}
+		switch {
+		case !exists:
+			d.Action = PlanActionAdd
+		case ContentEqual(f.Path, oldContent, newContent, opts):
+			d.Action = PlanActionUnchanged
+			d.FormattingOnly = !bytes.Equal(oldContent, newContent)
+		default:
+			d.Action = PlanActionModify
+		}
+		diffs = append(diffs, d)
+	}
+
+	for _, f := range oldLock.Files {
+		if _, ok := generated[f.Path]; ok {
+			continue
+		}
+		oldContent, exists, err := readTargetFile(filepath.Join(execPath, f.Path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read target file: %s: %w", f.Path, err)
+		}
+		if !exists {
+			// Already gone, nothing to remove
+			continue
+		}
+		if len(f.Blocks) > 0 {
+			// Only the managed blocks of partly managed files are removed
+			if newContent := stripManagedBlocks(oldContent, f.Blocks); len(bytes.TrimSpace(newContent)) > 0 {
+				diffs = append(diffs, &DiffFile{Path: f.Path, Pack: f.Pack, Action: PlanActionModify, Managed: true, Old: oldContent, New: newContent, opts: opts})
+				continue
+			}
+		}
+		diffs = append(diffs, &DiffFile{
+			Path:    f.Path,
+			Pack:    f.Pack,
+			Action:  PlanActionRemove,
+			Managed: true,
+			Old:     oldContent,
+			opts:    opts,
+		})
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs, nil
+}
+
+// DiffRenderer presents the change of a single target file.
+// Embedders can implement it to customize the output of dry-runs.
+type DiffRenderer interface {
+	Render(ctx context.Context, w io.Writer, f *DiffFile) error
+}
+
+// unchangedRenderer is implemented by renderers that present unchanged files as well.
+type unchangedRenderer interface {
+	rendersUnchanged() bool
+}
+
+// UnifiedDiffRenderer renders changes as unified diffs.
+type UnifiedDiffRenderer struct{}
+
+// Check UnifiedDiffRenderer satisfies DiffRenderer interface
+var _ = DiffRenderer(&UnifiedDiffRenderer{})
+
+// Render writes the unified diff of the file, binary files are only named.
+func (r *UnifiedDiffRenderer) Render(_ context.Context, w io.Writer, f *DiffFile) error {
+	if f.Binary() {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", f.OldName(), f.NewName())
+		return err
+	}
+	_, err := io.WriteString(w, f.UnifiedDiff())
+	return err
+}
+
+// ExternalDiffRenderer pipes each changed file to an external diff tool
+// like delta or difftastic.
+// The before and after content are written to temporary files
+// whose paths are appended to the command.
+type ExternalDiffRenderer struct {
+	// Command to run, split on whitespace, e.g. "difft --color=always"
+	Command string
+}
+
+// Check ExternalDiffRenderer satisfies DiffRenderer interface
+var _ = DiffRenderer(&ExternalDiffRenderer{})
+
+// Render runs the diff tool for the file.
+// Exit code 1 is not an error as diff tools use it to signal differences.
+func (r *ExternalDiffRenderer) Render(ctx context.Context, w io.Writer, f *DiffFile) error {
+	args := strings.Fields(r.Command)
+	if len(args) == 0 {
+		return fmt.Errorf("diff tool command is empty")
+	}
+	dir, err := os.MkdirTemp("", "rpack-diff-*")
+	if err != nil {
+		return fmt.Errorf("could not create diff directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// Keep the file name so tools can detect the language
+	oldPath, newPath := os.DevNull, os.DevNull
+	if f.Action != PlanActionAdd {
+		oldPath = filepath.Join(dir, "a", filepath.FromSlash(f.Path))
+		if err = writeDiffSide(oldPath, f.Old); err != nil {
+			return err
+		}
+	}
+	if f.Action != PlanActionRemove {
+		newPath = filepath.Join(dir, "b", filepath.FromSlash(f.Path))
+		if err = writeDiffSide(newPath, f.New); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], oldPath, newPath)...) //nolint:gosec // intentional: diff tool chosen by the user
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("diff tool failed for %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+// writeDiffSide writes one side of a diff to a temporary file.
+func writeDiffSide(name string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil { //nolint:gosec // standard permissions
+		return fmt.Errorf("could not create diff directory: %w", err)
+	}
+	if err := os.WriteFile(name, content, 0o600); err != nil {
+		return fmt.Errorf("could not write diff file: %w", err)
+	}
+	return nil
+}
+
+// redactDiffFile returns d with the secrets read by the scripts redacted from its content.
+func redactDiffFile(d *DiffFile) *DiffFile {
+	if !hasRevealedSecrets() {
+		return d
+	}
+	redact := func(b []byte) []byte {
+		if b == nil {
+			return nil
+		}
+		return []byte(RedactSecrets(string(b)))
+	}
+	redacted := *d
+	redacted.Old, redacted.New = redact(d.Old), redact(d.New)
+	return &redacted
+}
+
+// renderDiffs renders all changed files of a dry-run to stdout,
+// renderers implementing unchangedRenderer get the unchanged files as well.
+func renderDiffs(ctx context.Context, r DiffRenderer, execPath string, files []*packTargetFile, oldLock *RPackLockFile, opts DiffOptions) error {
+	diffs, err := collectDiffFiles(execPath, files, oldLock, opts)
+	if err != nil {
+		return err
+	}
+	u, ok := r.(unchangedRenderer)
+	allFiles := ok && u.rendersUnchanged()
+	changed := 0
+	for _, d := range diffs {
+		if d.Action != PlanActionUnchanged {
+			changed++
+		} else if !allFiles {
+			continue
+		}
+		if err = r.Render(ctx, os.Stdout, redactDiffFile(d)); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d files changed\n", changed, len(diffs))
+	return nil
+}
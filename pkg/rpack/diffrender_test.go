@@ -0,0 +1,105 @@
+package rpack
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectDiffFiles(t *testing.T) {
+	execPath := t.TempDir()
+	runPath := t.TempDir()
+	write := func(dir, name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	write(execPath, "same.txt", "same\n")
+	write(execPath, "mod.txt", "old\n")
+	write(execPath, "gone.txt", "gone\n")
+	write(runPath, "same.txt", "same\n")
+	write(runPath, "mod.txt", "new\n")
+	write(runPath, "new.txt", "added\n")
+
+	var files []*packTargetFile
+	for _, name := range []string{"same.txt", "mod.txt", "new.txt"} {
+		files = append(files, &packTargetFile{ControlledFile: &ControlledFile{Path: name, AbsPath: filepath.Join(runPath, name)}})
+	}
+	lock := NewRPackLockFile()
+	lock.AddPackFile("", "gone.txt", "x")
+	lock.AddPackFile("", "mod.txt", "x")
+
+	diffs, err := collectDiffFiles(execPath, files, lock, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make(map[string]PlanAction)
+	for _, d := range diffs {
+		actions[d.Path] = d.Action
+	}
+	expected := map[string]PlanAction{
+		"gone.txt": PlanActionRemove,
+		"mod.txt":  PlanActionModify,
+		"new.txt":  PlanActionAdd,
+		"same.txt": PlanActionUnchanged,
+	}
+	for path, action := range expected {
+		if actions[path] != action {
+			t.Errorf("Expected %s for %s, got %s", action, path, actions[path])
+		}
+	}
+	if diffs[0].Path != "gone.txt" || diffs[0].NewName() != "/dev/null" || diffs[2].OldName() != "/dev/null" {
+		t.Errorf("Unexpected order or names: %s %s", diffs[0].Path, diffs[2].Path)
+	}
+}
+
+func TestUnifiedDiffRenderer(t *testing.T) {
+	r := &UnifiedDiffRenderer{}
+	var sb strings.Builder
+	if err := r.Render(t.Context(), &sb, &DiffFile{Path: "a.txt", Action: PlanActionModify, Old: []byte("x\n"), New: []byte("y\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "--- a/a.txt\n+++ b/a.txt\n") || !strings.Contains(sb.String(), "-x\n+y\n") {
+		t.Errorf("Unexpected diff:\n%s", sb.String())
+	}
+	sb.Reset()
+	if err := r.Render(t.Context(), &sb, &DiffFile{Path: "bin", Action: PlanActionAdd, New: []byte{0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != "Binary files /dev/null and b/bin differ\n" {
+		t.Errorf("Unexpected binary output: %q", sb.String())
+	}
+}
+
+func TestExternalDiffRenderer(t *testing.T) {
+	if _, err := exec.LookPath("diff"); err != nil {
+		t.Skip("diff not available")
+	}
+	var sb strings.Builder
+	r := &ExternalDiffRenderer{Command: "diff -u"}
+	if err := r.Render(t.Context(), &sb, &DiffFile{Path: "dir/a.txt", Action: PlanActionModify, Old: []byte("x\n"), New: []byte("y\n")}); err != nil {
+		t.Fatalf("Render failed: %s", err)
+	}
+	out := sb.String()
+	if !strings.Contains(out, "-x\n+y\n") || !strings.Contains(out, filepath.Join("a", "dir", "a.txt")) {
+		t.Errorf("Unexpected tool output:\n%s", out)
+	}
+
+	sb.Reset()
+	if err := r.Render(t.Context(), &sb, &DiffFile{Path: "a.txt", Action: PlanActionAdd, New: []byte("y\n")}); err != nil {
+		t.Fatalf("Render of added file failed: %s", err)
+	}
+	if !strings.Contains(sb.String(), "+y") {
+		t.Errorf("Unexpected tool output:\n%s", sb.String())
+	}
+
+	if err := (&ExternalDiffRenderer{Command: "diff --no-such-flag"}).Render(t.Context(), &sb, &DiffFile{Path: "a.txt", Action: PlanActionModify}); err == nil {
+		t.Errorf("Expected error for failing tool")
+	}
+	if err := (&ExternalDiffRenderer{}).Render(t.Context(), &sb, &DiffFile{Path: "a.txt"}); err == nil {
+		t.Errorf("Expected error for empty command")
+	}
+}
@@ -0,0 +1,309 @@
+package rpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/blang/rpack/pkg/rpack/getsource"
+)
+
+// DoctorStatus is the outcome of a doctor check.
+type DoctorStatus string
+
+// Doctor check outcomes.
+const (
+	DoctorOK   DoctorStatus = "ok"
+	DoctorWarn DoctorStatus = "warn"
+	DoctorFail DoctorStatus = "fail"
+)
+
+// DoctorCheck is the result of a single environment check.
+type DoctorCheck struct {
+	Name    string
+	Status  DoctorStatus
+	Message string
+	// Fix describes how to resolve a warning or failure
+	Fix string
+}
+
+// DoctorOptions configures the environment checks.
+type DoctorOptions struct {
+	// Dir is the working directory rpack runs in, defaults to the config location or "."
+	Dir string
+	// ConfigFile to check sources and schema versions of, optional
+	ConfigFile string
+	// Lenient ignores unknown fields in the config, definitions and lockfile instead of failing
+	Lenient bool
+}
+
+// doctorPathLength is the path length that needs to be supported below the working directory.
+// Cache paths alone add two sha256 directories.
+const doctorPathLength = 300
+
+// RunDoctor checks the environment for common problems.
+// It never fails itself, problems are reported as checks with status warn or fail.
+func RunDoctor(ctx context.Context, opts DoctorOptions) []*DoctorCheck {
+	dir := opts.Dir
+	if dir == "" && opts.ConfigFile != "" {
+		dir = filepath.Dir(opts.ConfigFile)
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	var protocols []string
+	checks := []*DoctorCheck{checkCacheWritable(dir), checkTempWritable()}
+	if opts.ConfigFile != "" {
+		var configChecks []*DoctorCheck
+		configChecks, protocols = checkConfig(Loader{Lenient: opts.Lenient}, opts.ConfigFile, dir)
+		checks = append(checks, configChecks...)
+	}
+	checks = append(checks, checkGit(ctx, slices.Contains(protocols, "git")), checkFeatures())
+	checks = append(checks, checkFilesystem(dir)...)
+	return checks
+}
+
+// String renders the check as a status line followed by the fix, if any.
+func (c *DoctorCheck) String() string {
+	s := fmt.Sprintf("[%-4s] %s: %s", c.Status, c.Name, c.Message)
+	if c.Fix != "" {
+		s += "\n       fix: " + c.Fix
+	}
+	return s
+}
+
+// DoctorFailed reports if any check failed.
+func DoctorFailed(checks []*DoctorCheck) bool {
+	return slices.ContainsFunc(checks, func(c *DoctorCheck) bool {
+		return c.Status == DoctorFail
+	})
+}
+
+// checkCacheWritable checks that the .rpack.d cache can be written.
+func checkCacheWritable(dir string) *DoctorCheck {
+	c := &DoctorCheck{Name: "cache"}
+	cacheDir := filepath.Join(dir, RPackCacheDir)
+	probeDir := cacheDir
+	if _, err := os.Stat(cacheDir); errors.Is(err, os.ErrNotExist) {
+		probeDir = dir
+	}
+	f, err := os.CreateTemp(probeDir, ".rpack-doctor-*")
+	if err != nil {
+		c.Status = DoctorFail
+		c.Message = fmt.Sprintf("%s is not writable: %s", cacheDir, err)
+		c.Fix = fmt.Sprintf("Fix the permissions of %s or use a writable working directory with -w", probeDir)
+		return c
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	c.Status = DoctorOK
+	c.Message = cacheDir + " is writable"
+	return c
+}
+
+// checkTempWritable checks that run and temp directories can be created.
+func checkTempWritable() *DoctorCheck {
+	c := &DoctorCheck{Name: "temp"}
+	dir, err := os.MkdirTemp("", "rpack-doctor-*")
+	if err != nil {
+		c.Status = DoctorFail
+		c.Message = fmt.Sprintf("could not create temporary directory in %s: %s", os.TempDir(), err)
+		c.Fix = "Set TMPDIR (TEMP on Windows) to a writable directory"
+		return c
+	}
+	_ = os.RemoveAll(dir)
+	c.Status = DoctorOK
+	c.Message = os.TempDir() + " is writable"
+	return c
+}
+
+// checkGit checks that git is installed, it is required if the config uses git sources.
+func checkGit(ctx context.Context, required bool) *DoctorCheck {
+	c := &DoctorCheck{Name: "git"}
+	out, err := runGit(ctx, "", "--version")
+	if err != nil {
+		c.Status = DoctorWarn
+		c.Message = "git is not available, git sources, rpack bisect and rpack upgrade do not work"
+		if required {
+			c.Status = DoctorFail
+			c.Message = "git is not available but required by the git sources of the config"
+		}
+		c.Fix = "Install git and make sure it is on PATH"
+		return c
+	}
+	c.Status = DoctorOK
+	c.Message = out
+	return c
+}
+
+// checkConfig checks the schema versions and sources of a config and its lockfile.
+// It returns the protocols used by the sources.
+func checkConfig(loader Loader, name, dir string) ([]*DoctorCheck, []string) {
+	versions := &DoctorCheck{Name: "config"}
+	b, err := os.ReadFile(name) //nolint:gosec // intentional: path comes from user
+	if err != nil {
+		versions.Status = DoctorFail
+		versions.Message = err.Error()
+		versions.Fix = "Pass the path of an existing *" + RPackFileSuffix + " file"
+		return []*DoctorCheck{versions}, nil
+	}
+	var header struct {
+		SchemaVersion string `json:"@schema_version"`
+	}
+	if err = yaml.Unmarshal(b, &header); err != nil || header.SchemaVersion != RPackConfigCurrentSchemaVersion {
+		versions.Status = DoctorFail
+		versions.Message = fmt.Sprintf("unsupported config schema version %q, supported %q", header.SchemaVersion, RPackConfigCurrentSchemaVersion)
+		versions.Fix = fmt.Sprintf("Set \"@schema_version\": %q or upgrade rpack", RPackConfigCurrentSchemaVersion)
+		return []*DoctorCheck{versions}, nil
+	}
+	ci, err := loader.LoadRPackConfig(name)
+	if err != nil {
+		versions.Status = DoctorFail
+		versions.Message = err.Error()
+		if strings.Contains(err.Error(), "lockfile") {
+			versions.Fix = "Upgrade rpack or remove the lockfile and re-run with --force"
+		} else {
+			versions.Fix = "Fix the config file, see the error for the invalid field"
+		}
+		return []*DoctorCheck{versions}, nil
+	}
+	versions.Status = DoctorOK
+	versions.Message = fmt.Sprintf("config and lockfile use schema version %s", RPackConfigCurrentSchemaVersion)
+
+	sources := &DoctorCheck{Name: "sources", Status: DoctorOK}
+	supported := getsource.Protocols()
+	var used, problems []string
+	for _, pack := range ci.Config.PackList() {
+		normalized, err := getsource.NormalizeSource(pack.Source)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", pack.Source, err))
+			continue
+		}
+		protocol := getsource.SourceProtocol(normalized)
+		if err = checkSourceFeature(normalized); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", pack.Source, err))
+			continue
+		}
+		if !slices.Contains(supported, protocol) {
+			problems = append(problems, fmt.Sprintf("%s: unsupported protocol %q", pack.Source, protocol))
+			continue
+		}
+		if !slices.Contains(used, protocol) {
+			used = append(used, protocol)
+		}
+	}
+	slices.Sort(used)
+	if len(problems) > 0 {
+		sources.Status = DoctorFail
+		sources.Message = strings.Join(problems, "; ")
+		sources.Fix = "Use one of the supported protocols: " + strings.Join(supported, ", ")
+	} else {
+		sources.Message = "protocols in use: " + strings.Join(used, ", ")
+	}
+	return []*DoctorCheck{versions, sources, checkCachedDefinitions(loader, dir, ci.Config.PackList())}, used
+}
+
+// checkCachedDefinitions checks the schema versions of the fetched definitions of the packs.
+func checkCachedDefinitions(loader Loader, dir string, packs []*RPackConfigPack) *DoctorCheck {
+	c := &DoctorCheck{Name: "definitions", Status: DoctorOK}
+	var problems []string
+	cached := 0
+	for _, pack := range packs {
+		defDir, err := cachedDefDir(dir, pack)
+		if err != nil {
+			continue
+		}
+		name := filepath.Join(defDir, RPackDefDefaultFilename)
+		if _, err = os.Stat(name); err != nil {
+			continue
+		}
+		cached++
+		def, err := loader.LoadRPackDef(name)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if def.SchemaVersion != RPackConfigCurrentSchemaVersion {
+			problems = append(problems, fmt.Sprintf("%s uses unsupported schema version %q", pack.Source, def.SchemaVersion))
+		}
+		if _, err = os.Stat(filepath.Join(defDir, RPackDefSchemaFilename)); err == nil && !slices.Contains(Features(), FeatureCUE) {
+			problems = append(problems, fmt.Sprintf("%s uses %s, this build does not support CUE", pack.Source, RPackDefSchemaFilename))
+		}
+	}
+	if len(problems) > 0 {
+		c.Status = DoctorWarn
+		c.Message = strings.Join(problems, "; ")
+		c.Fix = "Upgrade rpack or pin the source to a definition version it supports"
+		return c
+	}
+	c.Message = fmt.Sprintf("%d of %d definitions fetched, all use supported schema versions", cached, len(packs))
+	return c
+}
+
+// checkFeatures lists the optional features included in the build.
+func checkFeatures() *DoctorCheck {
+	c := &DoctorCheck{Name: "features", Status: DoctorOK}
+	included := Features()
+	if len(included) == 0 {
+		included = []string{"none"}
+	}
+	c.Message = "included: " + strings.Join(included, ", ")
+	if disabled := DisabledFeatures(); len(disabled) > 0 {
+		c.Message += "; left out by build tags: " + strings.Join(disabled, ", ")
+	}
+	return c
+}
+
+// checkFilesystem probes case sensitivity and path length limits of the working directory.
+func checkFilesystem(dir string) []*DoctorCheck {
+	caseCheck := &DoctorCheck{Name: "case sensitivity"}
+	lengthCheck := &DoctorCheck{Name: "path length"}
+	probe, err := os.MkdirTemp(dir, ".rpack-doctor-*")
+	if err != nil {
+		for _, c := range []*DoctorCheck{caseCheck, lengthCheck} {
+			c.Status = DoctorWarn
+			c.Message = fmt.Sprintf("could not probe %s: %s", dir, err)
+			c.Fix = "Make the working directory writable"
+		}
+		return []*DoctorCheck{caseCheck, lengthCheck}
+	}
+	defer func() { _ = os.RemoveAll(probe) }()
+
+	if err = os.WriteFile(filepath.Join(probe, "probe"), nil, 0o600); err != nil {
+		caseCheck.Status = DoctorWarn
+		caseCheck.Message = err.Error()
+	} else if _, err = os.Stat(filepath.Join(probe, "PROBE")); err == nil {
+		caseCheck.Status = DoctorWarn
+		caseCheck.Message = "filesystem is case-insensitive, target files differing only in case overwrite each other"
+		caseCheck.Fix = "Avoid generating paths that differ only in case, e.g. README.md and Readme.md"
+	} else {
+		caseCheck.Status = DoctorOK
+		caseCheck.Message = "filesystem is case-sensitive"
+	}
+
+	abs, _ := filepath.Abs(probe)
+	long := abs
+	for len(long) < doctorPathLength {
+		long = filepath.Join(long, strings.Repeat("d", 40))
+	}
+	if err = os.MkdirAll(long, 0o700); err != nil {
+		lengthCheck.Status = DoctorWarn
+		lengthCheck.Message = fmt.Sprintf("paths with %d characters can not be created: %s", len(long), err)
+		lengthCheck.Fix = "Use a shorter working directory"
+		if runtime.GOOS == "windows" {
+			lengthCheck.Fix = "Enable long paths (LongPathsEnabled registry key and git config core.longpaths true) or use a shorter working directory"
+		}
+	} else {
+		lengthCheck.Status = DoctorOK
+		lengthCheck.Message = fmt.Sprintf("paths with %d characters are supported", len(long))
+	}
+	return []*DoctorCheck{caseCheck, lengthCheck}
+}
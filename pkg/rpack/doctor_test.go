@@ -0,0 +1,72 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunDoctor(t *testing.T) {
+	dir := t.TempDir()
+	checks := RunDoctor(t.Context(), DoctorOptions{Dir: dir})
+	byName := make(map[string]*DoctorCheck)
+	for _, c := range checks {
+		byName[c.Name] = c
+	}
+	for _, name := range []string{"cache", "temp", "git", "case sensitivity", "path length"} {
+		if byName[name] == nil {
+			t.Errorf("Missing check %s", name)
+		}
+	}
+	if c := byName["cache"]; c.Status != DoctorOK {
+		t.Errorf("Expected writable cache: %+v", c)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected probes to be removed, found %d entries", len(entries))
+	}
+	if _, ok := byName["config"]; ok {
+		t.Errorf("Expected no config checks without config")
+	}
+}
+
+func TestRunDoctorConfig(t *testing.T) {
+	dir := t.TempDir()
+	defDir := filepath.Join(dir, "def")
+	if err := os.MkdirAll(defDir, 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "app.rpack.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(config, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	find := func(checks []*DoctorCheck, name string) *DoctorCheck {
+		for _, c := range checks {
+			if c.Name == name {
+				return c
+			}
+		}
+		t.Fatalf("Missing check %s", name)
+		return nil
+	}
+
+	write("\"@schema_version\": \"v2\"\nsource: \"" + defDir + "\"\n")
+	checks := RunDoctor(t.Context(), DoctorOptions{ConfigFile: config})
+	if c := find(checks, "config"); c.Status != DoctorFail || c.Fix == "" {
+		t.Errorf("Expected failed version check with fix: %+v", c)
+	}
+	if !DoctorFailed(checks) {
+		t.Errorf("Expected doctor to fail")
+	}
+
+	write("\"@schema_version\": \"v1\"\nsource: \"" + defDir + "\"\n")
+	checks = RunDoctor(t.Context(), DoctorOptions{ConfigFile: config})
+	if c := find(checks, "sources"); c.Status != DoctorOK || c.Message != "protocols in use: file" {
+		t.Errorf("Unexpected sources check: %+v", c)
+	}
+	if DoctorFailed(checks) {
+		t.Errorf("Expected doctor to pass: %+v", checks)
+	}
+}
@@ -0,0 +1,223 @@
+package rpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Text encodings reported by detectTextEncoding.
+const (
+	TextEncodingUTF8    = "utf-8"
+	TextEncodingUTF16LE = "utf-16le"
+	TextEncodingUTF16BE = "utf-16be"
+	TextEncodingUTF32LE = "utf-32le"
+	TextEncodingUTF32BE = "utf-32be"
+	// TextEncodingUnknown is reported for content that is neither valid UTF-8
+	// nor has a BOM, e.g. legacy single byte encodings or binary data.
+	TextEncodingUnknown = "unknown"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+	bomUTF32LE = []byte{0xFF, 0xFE, 0x00, 0x00}
+	bomUTF32BE = []byte{0x00, 0x00, 0xFE, 0xFF}
+)
+
+// textEncodingReport describes the encoding and line endings of a text file.
+type textEncodingReport struct {
+	Encoding string
+	BOM      bool
+	// Line ending counts
+	LF   int
+	CRLF int
+	CR   int
+}
+
+// Mixed reports if more than one kind of line ending is used.
+func (r *textEncodingReport) Mixed() bool {
+	kinds := 0
+	for _, n := range []int{r.LF, r.CRLF, r.CR} {
+		if n > 0 {
+			kinds++
+		}
+	}
+	return kinds > 1
+}
+
+// Separator returns the most common line ending, CRLF wins ties.
+// Defaults to "\n" if the content has no line endings.
+func (r *textEncodingReport) Separator() string {
+	switch {
+	case r.CRLF > 0 && r.CRLF >= r.LF && r.CRLF >= r.CR:
+		return "\r\n"
+	case r.CR > r.LF:
+		return "\r"
+	default:
+		return "\n"
+	}
+}
+
+// LineEnding returns a short name of the line endings: lf, crlf, cr, mixed or none.
+func (r *textEncodingReport) LineEnding() string {
+	switch {
+	case r.Mixed():
+		return "mixed"
+	case r.CRLF > 0:
+		return "crlf"
+	case r.CR > 0:
+		return "cr"
+	case r.LF > 0:
+		return "lf"
+	default:
+		return "none"
+	}
+}
+
+// detectBOM returns the encoding indicated by a byte order mark and its length.
+// UTF-32LE is checked before UTF-16LE as its BOM starts with the UTF-16LE BOM.
+func detectBOM(b []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		return TextEncodingUTF8, len(bomUTF8)
+	case bytes.HasPrefix(b, bomUTF32LE):
+		return TextEncodingUTF32LE, len(bomUTF32LE)
+	case bytes.HasPrefix(b, bomUTF32BE):
+		return TextEncodingUTF32BE, len(bomUTF32BE)
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return TextEncodingUTF16LE, len(bomUTF16LE)
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return TextEncodingUTF16BE, len(bomUTF16BE)
+	}
+	return "", 0
+}
+
+// guessUTF16 detects UTF-16 without BOM from the typical NUL byte pattern
+// of mostly ASCII text.
+func guessUTF16(b []byte) string {
+	if len(b) < 4 || len(b)%2 != 0 {
+		return ""
+	}
+	var evenNUL, oddNUL int
+	for i := 0; i < len(b); i += 2 {
+		if b[i] == 0 {
+			evenNUL++
+		}
+		if b[i+1] == 0 {
+			oddNUL++
+		}
+	}
+	units := len(b) / 2
+	switch {
+	case oddNUL*2 > units && evenNUL == 0:
+		return TextEncodingUTF16LE
+	case evenNUL*2 > units && oddNUL == 0:
+		return TextEncodingUTF16BE
+	}
+	return ""
+}
+
+// decodeText converts content to UTF-8, stripping any byte order mark.
+// Content with unknown encoding is returned unchanged.
+func decodeText(b []byte) (string, *textEncodingReport, error) {
+	report := &textEncodingReport{}
+	enc, n := detectBOM(b)
+	if n > 0 {
+		report.BOM = true
+		b = b[n:]
+	} else {
+		enc = guessUTF16(b)
+	}
+	if enc == "" {
+		enc = TextEncodingUnknown
+		if utf8.Valid(b) {
+			enc = TextEncodingUTF8
+		}
+	}
+	report.Encoding = enc
+
+	var text string
+	switch enc {
+	case TextEncodingUTF16LE, TextEncodingUTF16BE:
+		if len(b)%2 != 0 {
+			return "", report, fmt.Errorf("invalid %s content: odd number of bytes", enc)
+		}
+		var order binary.ByteOrder = binary.LittleEndian
+		if enc == TextEncodingUTF16BE {
+			order = binary.BigEndian
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[2*i:])
+		}
+		text = string(utf16.Decode(units))
+	case TextEncodingUTF32LE, TextEncodingUTF32BE:
+		if len(b)%4 != 0 {
+			return "", report, fmt.Errorf("invalid %s content: length not a multiple of 4", enc)
+		}
+		var order binary.ByteOrder = binary.LittleEndian
+		if enc == TextEncodingUTF32BE {
+			order = binary.BigEndian
+		}
+		runes := make([]rune, len(b)/4)
+		for i := range runes {
+			runes[i] = rune(order.Uint32(b[4*i:])) //nolint:gosec // invalid code points are replaced by string conversion
+		}
+		text = string(runes)
+	default:
+		text = string(b)
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			report.LF++
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				report.CRLF++
+				i++
+			} else {
+				report.CR++
+			}
+		}
+	}
+	return text, report, nil
+}
+
+// detectTextEncoding reports encoding, BOM and line endings of content.
+func detectTextEncoding(b []byte) (*textEncodingReport, error) {
+	_, report, err := decodeText(b)
+	return report, err
+}
+
+// splitTextLines splits text on any line ending.
+// A trailing line ending does not produce an empty last line,
+// empty text is a single empty line.
+func splitTextLines(text string) (lines []string, finalNewline bool) {
+	if text == "" {
+		return []string{""}, false
+	}
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			lines = append(lines, text[start:i])
+			start = i + 1
+		case '\r':
+			lines = append(lines, text[start:i])
+			if i+1 < len(text) && text[i+1] == '\n' {
+				i++
+			}
+			start = i + 1
+		}
+	}
+	if start < len(text) {
+		lines = append(lines, text[start:])
+		return lines, false
+	}
+	return lines, true
+}
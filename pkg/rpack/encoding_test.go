@@ -0,0 +1,104 @@
+package rpack
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16LE(s string, bom bool) []byte {
+	var b []byte
+	if bom {
+		b = append(b, bomUTF16LE...)
+	}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func TestDecodeText(t *testing.T) {
+	tcs := []struct {
+		name       string
+		input      []byte
+		text       string
+		encoding   string
+		bom        bool
+		lineEnding string
+	}{
+		{"plain", []byte("a\nb\n"), "a\nb\n", TextEncodingUTF8, false, "lf"},
+		{"utf-8 bom", append(append([]byte{}, bomUTF8...), "a\r\nb"...), "a\r\nb", TextEncodingUTF8, true, "crlf"},
+		{"utf-16le bom", utf16LE("grüße\r\nx\r\n", true), "grüße\r\nx\r\n", TextEncodingUTF16LE, true, "crlf"},
+		{"utf-16le without bom", utf16LE("abc\n", false), "abc\n", TextEncodingUTF16LE, false, "lf"},
+		{"utf-16be bom", []byte{0xFE, 0xFF, 0x00, 'h', 0x00, 'i'}, "hi", TextEncodingUTF16BE, true, "none"},
+		{"utf-32le bom", []byte{0xFF, 0xFE, 0x00, 0x00, 'x', 0, 0, 0, '\r', 0, 0, 0}, "x\r", TextEncodingUTF32LE, true, "cr"},
+		{"mixed", []byte("a\r\nb\nc\rd"), "a\r\nb\nc\rd", TextEncodingUTF8, false, "mixed"},
+		{"latin1", []byte{'f', 0xFC, 'r'}, "f\xFCr", TextEncodingUnknown, false, "none"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			text, report, err := decodeText(tc.input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if text != tc.text {
+				t.Errorf("Expected text %q, got %q", tc.text, text)
+			}
+			if report.Encoding != tc.encoding || report.BOM != tc.bom || report.LineEnding() != tc.lineEnding {
+				t.Errorf("Expected %s (bom %t, %s), got %s (bom %t, %s)",
+					tc.encoding, tc.bom, tc.lineEnding, report.Encoding, report.BOM, report.LineEnding())
+			}
+		})
+	}
+
+	if _, _, err := decodeText([]byte{0xFF, 0xFE, 'a'}); err == nil {
+		t.Errorf("Expected error for truncated UTF-16")
+	}
+}
+
+func TestSplitTextLines(t *testing.T) {
+	tcs := []struct {
+		input        string
+		lines        []string
+		finalNewline bool
+	}{
+		{"", []string{""}, false},
+		{"a", []string{"a"}, false},
+		{"a\n", []string{"a"}, true},
+		{"a\r\nb\nc\r", []string{"a", "b", "c"}, true},
+		{"a\n\nb", []string{"a", "", "b"}, false},
+	}
+	for _, tc := range tcs {
+		lines, final := splitTextLines(tc.input)
+		if !reflect.DeepEqual(lines, tc.lines) || final != tc.finalNewline {
+			t.Errorf("Split %q: expected %q (%t), got %q (%t)", tc.input, tc.lines, tc.finalNewline, lines, final)
+		}
+	}
+}
+
+func TestLuaDetectEncoding(t *testing.T) {
+	fs := NewInMemoryFS()
+	if err := fs.Write("legacy.txt", utf16LE("one\r\ntwo\nthree", true)); err != nil {
+		t.Fatalf("Could not write to fs: %s", err)
+	}
+	script := `
+		local rpack = require("rpack.v1")
+		local enc = rpack.detect_encoding("legacy.txt")
+		assert(enc.encoding == "utf-16le", enc.encoding)
+		assert(enc.bom == true)
+		assert(enc.mixed == true)
+		assert(enc.line_ending == "mixed")
+		assert(enc.line_endings.crlf == 1 and enc.line_endings.lf == 1 and enc.line_endings.cr == 0)
+
+		local res = rpack.read_lines("legacy.txt")
+		assert(#res.lines == 3)
+		assert(res.lines[1] == "one" and res.lines[2] == "two" and res.lines[3] == "three")
+		assert(res.encoding == "utf-16le")
+		assert(res.bom == true)
+		assert(res.mixedLineEndings == true)
+		assert(res.finalNewline == false)
+	`
+	if err := ExecuteLuaWithData(t.Context(), script, fs, nil); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
@@ -5,24 +5,66 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/blang/rpack/pkg/api"
+	"github.com/blang/rpack/pkg/lockfile"
 	"github.com/blang/rpack/pkg/rpack/util"
 )
 
-// Sentinel errors for execution phases.
-// These are used by classifyError to categorize failures.
+// Sentinel errors returned by Executor and Checker, check them with errors.Is.
+// They are used by classifyError to categorize failures and by the CLI to choose the exit code.
 var (
-	ErrSchemaValidation = errors.New("schema validation failed")
-	ErrInputValidation  = errors.New("input validation failed")
-	ErrLuaExecution     = errors.New("lua execution failed")
-	ErrPurityCheck      = errors.New("purity check failed")
+	// ErrValidation is returned if a config, definition or the values and inputs are invalid
+	ErrValidation = errors.New("validation failed")
+	// ErrSchemaValidation is an ErrValidation of the config values against the definition schema
+	ErrSchemaValidation = fmt.Errorf("schema %w", ErrValidation)
+	// ErrInputValidation is an ErrValidation of the inputs against the definition
+	ErrInputValidation = fmt.Errorf("input %w", ErrValidation)
+	ErrLuaExecution    = errors.New("lua execution failed")
+	// ErrPurityViolation is returned if a script accessed files it did not declare
+	ErrPurityViolation = errors.New("purity check failed")
+	// ErrPurityCheck is the former name of ErrPurityViolation.
+	//
+	// Deprecated: use ErrPurityViolation.
+	ErrPurityCheck = ErrPurityViolation
+	// ErrLockModified is returned if files tracked by the lockfile were modified or removed outside of rpack
+	ErrLockModified = errors.New("locked files were modified outside of rpack")
+	// ErrSourceFetch is returned if the source of a definition could not be fetched
+	ErrSourceFetch = errors.New("could not fetch source")
+	// ErrVerifyFailed is returned if a verify command failed and the apply was rolled back
+	ErrVerifyFailed = errors.New("verify command failed")
+	// ErrInputChanged is returned if an input file read by a script was modified before the apply
+	ErrInputChanged = errors.New("input changed during run")
+	// ErrMergeConflict is returned if merged local modifications conflict with the generated content,
+	// the files were applied with conflict markers
+	ErrMergeConflict = errors.New("merge conflict")
+	// ErrDrift is returned by CICheck if target files differ from the content generated by rpack
+	ErrDrift = errors.New("target differs from generated files")
+	// ErrGitDirty is returned if the apply would overwrite or remove files with uncommitted changes in git,
+	// see Executor.GitDirty
+	ErrGitDirty = errors.New("target files have uncommitted changes")
+	// ErrWriteLimit is returned if a script wrote more than the size limits allow,
+	// see Executor.MaxFileSize and Executor.MaxTotalSize
+	ErrWriteLimit = errors.New("write size limit exceeded")
+	// ErrNotIdempotent is an ErrPurityViolation of a script producing different files when run twice
+	ErrNotIdempotent = fmt.Errorf("script is not idempotent: %w", ErrPurityViolation)
+	// ErrConflictingWrites is an ErrLuaExecution of a script writing a target file more than once
+	// with different content in strict mode
+	ErrConflictingWrites = fmt.Errorf("conflicting writes: %w", ErrLuaExecution)
 )
 
 // Executor runs rpack operations.
@@ -36,9 +78,171 @@ type Executor struct {
 	// Do not copy files at the end
 	DryRun bool
 
+	// collectPlan builds the plan of a dry-run for the result instead of printing the output
+	collectPlan bool
+
+	// prune removes the files the packs no longer generate instead of applying, see Prune
+	prune bool
+
+	// history receives the summary of a run against the target, see recordHistory
+	history *HistoryEntry
+
+	// timings receives the durations of the phases of the run, optional
+	timings *runTimings
+
+	// secrets are the secrets declared by the config of the run, nil if there are none
+	secrets *secretStore
+	// extras are the extra paths declared by the config of the run, see RPackConfig.Extra
+	extras []*RPackResolvedInput
+	// depOutputs are the run directories of the dependencies of the definition by name, see RPackDef.Dependencies
+	depOutputs map[string]string
+	// checksumAlgorithm is the lockfile checksum algorithm of the config of the run, see RPackConfig.ChecksumAlgorithm
+	checksumAlgorithm string
+
+	// PlanFile is the path a JSON change plan is written to during dry-run, optional
+	PlanFile string
+
+	// DiffRenderer renders the changes of a dry-run instead of printing
+	// the generated files, optional
+	DiffRenderer DiffRenderer
+
+	// DiffOptions control which differences plans and diffs report as changes
+	DiffOptions DiffOptions
+
 	// Force the overwrite or removal of modified file
 	// based on tracking using the lockfile
 	Force bool
+
+	// Merge merges modifications of files tracked by the lockfile into the generated content
+	// instead of failing, see Merge3. Conflicting changes are applied with conflict markers.
+	Merge bool
+
+	// AuditLog is the path a JSON log of all filesystem interactions is written to, optional
+	AuditLog string
+
+	// Progress receives the progress of fetching, executing, checksumming and transferring, optional
+	Progress ProgressReporter
+
+	// AllowVerify lists the programs the verify commands of a config may run.
+	// A config with a verify command whose program is not listed fails before the apply.
+	AllowVerify []string
+
+	// NoVerify skips the verify commands of the config
+	NoVerify bool
+
+	// AllowPostApply lists the programs the post-apply commands of a config may run.
+	// A config with a post-apply command whose program is not listed fails before the apply.
+	AllowPostApply []string
+
+	// NoPostApply skips the post-apply commands of the config
+	NoPostApply bool
+
+	// VerifyIdempotent runs the script of each pack twice and fails
+	// if the second run writes different files to the target
+	VerifyIdempotent bool
+
+	// NoGitIgnore leaves the .gitignore file of the target alone,
+	// by default rpack internals like .rpack.d are added to it in a managed block
+	NoGitIgnore bool
+
+	// Strict turns warnings about ambiguous script behavior into errors,
+	// e.g. a target file written more than once with different content
+	Strict bool
+
+	// LintTemplates fails templates referencing fields missing from their data
+	// and warns about data keys templates never reference
+	LintTemplates bool
+
+	// Timestamp pins the clock of the env module and of templates for reproducible output, the current time if zero
+	Timestamp time.Time
+
+	// Reproducible makes scripts produce the same output on every run and machine:
+	// the clock is pinned to Timestamp or the Unix epoch, math.random is seeded with a fixed seed
+	// and the host name is not available
+	Reproducible bool
+
+	// MaxFileSize is the maximum size in bytes of a file a script writes, 0 for no limit.
+	// Exceeding it fails the run with ErrWriteLimit
+	MaxFileSize int64
+
+	// MaxTotalSize is the maximum size in bytes of all files the script of a pack writes,
+	// temp files included, 0 for no limit. Exceeding it fails the run with ErrWriteLimit
+	MaxTotalSize int64
+
+	// Parallel is the number of packs executed at once, packs run one after another if it is below 2.
+	// A pack starts once the packs it depends on are done.
+	Parallel int
+
+	// GitDirty checks the target files the apply overwrites or removes for uncommitted changes in git:
+	// GitDirtyWarn logs them, GitDirtyFail refuses to apply unless Force is set. Empty disables the check
+	GitDirty string
+
+	// DefCacheDir is the directory of the definition cache shared by all targets, see DefaultDefCacheDir.
+	// Remote definitions are fetched once and stored by their digest, empty disables the cache
+	DefCacheDir string
+
+	// DefCacheTTL reuses cached definitions of sources that are not pinned to a commit, digest or checksum
+	// if they were fetched within the TTL. 0 fetches them on every run, pinned sources are fetched once
+	DefCacheTTL time.Duration
+
+	// NotifyWebhooks are posted the JSON run report after a successful apply,
+	// in addition to the webhook of the config. Failures are logged, the apply is kept
+	NotifyWebhooks []string
+
+	// AllowNotify lists the hosts the webhook of a config may post to, with or without port.
+	// A config with a webhook whose host is not listed fails before the apply.
+	AllowNotify []string
+
+	// NotifyCommand is run without a shell with the JSON run report on stdin after a successful apply
+	NotifyCommand []string
+
+	// Script selects the entry script declared by the definition, overriding the script of the config.
+	// Multi-pack configs select the scripts per pack instead
+	Script string
+
+	// Sources maps sources of packs to filesystems the definitions are copied from instead of fetching them, optional
+	Sources map[string]fs.FS
+
+	// FileAccess is called before a script accesses a file, an error denies the access, optional
+	FileAccess func(access *api.FileAccess) error
+
+	// Logger receives the logs of the run, slog.Default() if nil.
+	// Script output is tagged with the pack.
+	Logger *slog.Logger
+
+	// Lenient ignores unknown fields in configs, definitions and lockfiles instead of failing, see Loader
+	Lenient bool
+}
+
+// loader returns the loader of configs, definitions and lockfiles of the run.
+func (e *Executor) loader() Loader {
+	return Loader{Lenient: e.Lenient}
+}
+
+// log returns the logger of the run.
+func (e *Executor) log() *slog.Logger {
+	if e.Logger == nil {
+		return slog.Default()
+	}
+	return e.Logger
+}
+
+// luaEnv returns the environment of the env module for a definition with perms.
+func (e *Executor) luaEnv(perms *RPackDefPermissions) *LuaEnv {
+	now := e.Timestamp
+	if e.Reproducible && now.IsZero() {
+		now = time.Unix(0, 0)
+	}
+	env := NewLuaEnv(perms, now)
+	env.Reproducible = e.Reproducible
+	return env
+}
+
+// quiet returns a copy of the executor without progress reporting, e.g. for repeated executions.
+func (e *Executor) quiet() *Executor {
+	c := *e
+	c.Progress = nil
+	return &c
 }
 
 // execResult holds metadata about a completed execution.
@@ -46,6 +250,16 @@ type execResult struct {
 	FilesRead    []string
 	FilesWritten []string
 	InputsUsed   []string
+	Annotations  []*Annotation
+}
+
+// checkCanceled returns an error if ctx is done, so loops over many files abort early on Ctrl-C or a timeout.
+// The error wraps context.Canceled or context.DeadlineExceeded.
+func checkCanceled(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("run canceled: %w", err)
+	}
+	return nil
 }
 
 // classifyError determines the execution phase from an error.
@@ -60,7 +274,7 @@ func classifyError(err error) string {
 	if errors.Is(err, ErrInputValidation) {
 		return "input_validation"
 	}
-	if errors.Is(err, ErrPurityCheck) {
+	if errors.Is(err, ErrPurityViolation) {
 		return "purity_check"
 	}
 	if errors.Is(err, ErrLuaExecution) {
@@ -69,24 +283,32 @@ func classifyError(err error) string {
 	return "unknown"
 }
 
-// execCore runs the shared validation→execution→checks pipeline.
-// It returns the RPackFS so the caller can access TargetWriteHandles()
-// for file relocation and drain the recorder for metadata.
-//
-//nolint:gocognit,gocyclo // intentional: complex orchestration logic
-func (e *Executor) execCore(ctx context.Context,
-	defDir string,
-	runDir string,
-	tempDir string,
+// validatePackConfig validates the values and inputs of a pack against its definition and adds
+// all issues to report. It returns the values with the schema defaults filled in, and the
+// resolved inputs with their sorted names including the defaults of optional inputs.
+func validatePackConfig(report *ValidationReport,
+	log *slog.Logger,
+	pack string,
+	definst *RPackDefInstance,
+	execPath string,
 	resolvedInputs []*RPackResolvedInput,
-	values map[string]any,
 	inputNames []string,
+	values map[string]any,
 	configValues map[string]any,
-) (*RPackFS, *execResult, error) {
-	definst, err := SetupRPackDefInstance(defDir)
+) (map[string]any, []*RPackResolvedInput, []string) {
+	// Optional inputs the user did not map fall back to their defaults
+	numUserInputs := len(resolvedInputs)
+	withDefaults, err := resolveRPackDefaultInputs(resolvedInputs, definst.Def.Inputs, execPath, log)
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not setup RPackDef: %w", err)
+		report.add(ValidationStepInputs, pack, err)
+	} else {
+		resolvedInputs = withDefaults
 	}
+	inputNames = slices.Clone(inputNames)
+	for _, in := range resolvedInputs[numUserInputs:] {
+		inputNames = append(inputNames, in.Name)
+	}
+	slices.Sort(inputNames)
 
 	// Validate config values against schema.cue if present.
 	// Note: For direct execution (--def mode), we construct a synthetic config
@@ -101,48 +323,162 @@ func (e *Executor) execCore(ctx context.Context,
 	for _, name := range inputNames {
 		config.Config.Inputs[name] = name // Synthetic: actual paths are in resolvedInputs
 	}
-	err = definst.ValidateConfig(config)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to validate config values against definition schema: %w: %w", ErrSchemaValidation, err)
+	if err := definst.ValidateConfig(config); err != nil {
+		report.add(ValidationStepValues, pack, err)
+	} else {
+		// Fill in defaults declared in schema.cue, user values take precedence.
+		values, err = definst.ConfigValuesWithDefaults(&RPackConfig{
+			Config: &RPackConfigConfig{Values: values, Inputs: config.Config.Inputs},
+		})
+		report.add(ValidationStepValues, pack, err)
 	}
 
-	// Validate inputs
-	err = ValidateRPackInputs(resolvedInputs, definst.Def.Inputs)
+	for _, err := range validateRPackInputs(resolvedInputs, definst.Def.Inputs) {
+		report.add(ValidationStepInputs, pack, err)
+	}
+	return values, resolvedInputs, inputNames
+}
+
+// execCore runs the shared validation→execution→checks pipeline.
+// It returns the RPackFS so the caller can access TargetWriteHandles()
+// for file relocation and drain the recorder for metadata.
+//
+//nolint:gocognit,gocyclo // intentional: complex orchestration logic
+func (e *Executor) execCore(ctx context.Context,
+	pack string,
+	meta packMeta,
+	defDir string,
+	script string,
+	runDir string,
+	tempDir string,
+	execPath string,
+	resolvedInputs []*RPackResolvedInput,
+	values map[string]any,
+	inputNames []string,
+	configValues map[string]any,
+) (*RPackFS, *execResult, error) {
+	log := e.log()
+	if pack != "" {
+		log = log.With("pack", pack)
+	}
+	definst, err := e.loader().SetupRPackDefInstance(defDir)
 	if err != nil {
-		return nil, nil, fmt.Errorf("validation of inputs failed: %w: %w", ErrInputValidation, err)
+		return nil, nil, fmt.Errorf("could not setup RPackDef: %w", err)
+	}
+	if err = definst.SelectScript(script); err != nil {
+		return nil, nil, err
+	}
+	report := &ValidationReport{}
+	values, resolvedInputs, inputNames = validatePackConfig(report, log, pack, definst, execPath, resolvedInputs, inputNames, values, configValues)
+	extras, extraErrs := validateRPackExtras(e.extras, definst.Def.Extra)
+	for _, err := range extraErrs {
+		report.add(ValidationStepInputs, pack, err)
+	}
+	if err := report.err(); err != nil {
+		return nil, nil, err
 	}
 
 	// Setup filesystem for file access.
-	fs := NewRPackFS(true, defDir, runDir, tempDir, "", resolvedInputs)
+	fs := NewRPackFSWithPermissions(true, defDir, runDir, tempDir, execPath, resolvedInputs, definst.Def.EffectivePermissions())
+	fs.setLogger(log)
+	fs.setChecksumAlgorithm(e.checksumAlgorithm)
+	// URLs would otherwise resolve to target paths, the resolver rejects the ones not declared
+	fs.Resolvers = slices.Insert(fs.Resolvers, 0, FSResolver(newHTTPFSResolver(ctx, HTTPResolver, newHTTPFetcher(definst.Def.HTTPAllowed()))))
+	// Like URLs, extras not declared by the definition must not resolve to target paths
+	fs.Resolvers = slices.Insert(fs.Resolvers, 0, FSResolver(NewMapFSResolver(ExtraResolver, ExtraFSResolverPrefix, extras)))
+	if e.secrets != nil {
+		fs.Resolvers = slices.Insert(fs.Resolvers, 0, FSResolver(newSecretFSResolver(ctx, SecretResolver, SecretFSResolverPrefix, e.secrets)))
+	}
+	for _, dep := range definst.Def.Dependencies {
+		runPath, ok := e.depOutputs[dep.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("outputs of dependency %s are missing, run the definition with a config: %w", dep.Name, ErrValidation)
+		}
+		fs.Resolvers = slices.Insert(fs.Resolvers, 0, FSResolver(NewFileBackedFSResolver(DepResolver, DepResolver+":"+dep.Name+"/", runPath)))
+	}
+	if e.FileAccess != nil {
+		// Called first, so the recorder and purity checks never take denied accesses as made
+		fs.Hooks = slices.Insert(fs.Hooks, 0, FSAccessHook(&fileAccessFSHook{fn: e.FileAccess, pack: pack}))
+	}
+	var writeLimit *WriteLimitFSHook
+	if e.MaxFileSize > 0 || e.MaxTotalSize > 0 {
+		writeLimit = &WriteLimitFSHook{MaxFileSize: e.MaxFileSize, MaxTotalSize: e.MaxTotalSize}
+		fs.Hooks = append(fs.Hooks, writeLimit)
+	}
+	progress := &progressFSHook{reporter: e.Progress, pack: pack}
+	if e.Progress != nil {
+		fs.Hooks = append(fs.Hooks, progress)
+	}
 
 	// Setup external data
 	externalData := make(map[string]any)
 	externalData["values"] = values
-	externalData["inputs"] = inputNames
+	inputs := luaInputTable{names: inputNames, globs: make(map[string][]string)}
+	for _, in := range resolvedInputs {
+		if in.Type == RPackInputTypeGlob {
+			inputs.globs[in.Name] = in.Matches
+		}
+	}
+	externalData["inputs"] = inputs
+	externalData["meta"] = meta.table(pack, definst.Def)
 
 	// Read script file to string
 	scriptBytes, err := os.ReadFile(definst.ScriptPath) //nolint:gosec // path comes from rpack definition
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open script file: %s: %w", definst.ScriptPath, err)
 	}
+	// Entry scripts other than script.lua are named in errors
+	var scriptName string
+	if script != "" {
+		scriptName, _ = definst.Def.ScriptFile(script)
+	}
 	// Execute lua in context and capture changed files
-	err = ExecuteLuaWithData(ctx, string(scriptBytes), fs, externalData)
+	reportProgress(e.Progress, ProgressEvent{Phase: ProgressPhaseExec, Pack: pack})
+	luaResult, err := ExecuteLuaWithOptions(ctx, string(scriptBytes), fs, externalData, LuaOptions{
+		LintTemplates:    e.LintTemplates,
+		TemplateDefaults: definst.Def.Template,
+		Logger:           log,
+		Env:              e.luaEnv(definst.Def.EffectivePermissions()),
+		Reproducible:     e.Reproducible,
+		ScriptName:       scriptName,
+	})
+	reportProgress(e.Progress, ProgressEvent{Phase: ProgressPhaseExec, Pack: pack, Current: progress.writes, Total: progress.writes, Done: true})
+	if writeLimit != nil {
+		err = writeLimit.scriptError(err)
+	}
 	if err != nil {
-		return fs, nil, fmt.Errorf("failed to execute script: %w: %w", ErrLuaExecution, err)
+		var partial *execResult
+		if luaResult != nil {
+			partial = &execResult{Annotations: luaResult.Annotations}
+		}
+		// The script was stopped, it did not fail by itself
+		if ctxErr := checkCanceled(ctx); ctxErr != nil {
+			return fs, partial, ctxErr
+		}
+		return fs, partial, fmt.Errorf("failed to execute script: %w: %w", ErrLuaExecution, err)
+	}
+	log.Debug("Script execution successful")
+
+	if e.Strict {
+		if err := multiWriteError(luaResult.MultiWrites); err != nil {
+			return fs, &execResult{Annotations: luaResult.Annotations}, err
+		}
+	}
+	for _, m := range luaResult.MultiWrites {
+		luaResult.Annotations = append(luaResult.Annotations, &Annotation{Path: m.Path, Message: m.message()})
 	}
-	slog.Debug("Script execution successful")
 
 	err = fs.Check()
 	if err != nil {
-		return fs, nil, fmt.Errorf("file access check failed: %w: %w", ErrPurityCheck, err)
+		return fs, nil, fmt.Errorf("file access check failed: %w: %w", ErrPurityViolation, err)
 	}
 
 	// Drain recorder into result
-	result := &execResult{}
+	result := &execResult{Annotations: luaResult.Annotations}
 	fsRecords := fs.Recorder().Records()
 
 	// Log filesystem interactions
-	if slog.Default().Enabled(ctx, slog.LevelInfo) {
+	if log.Enabled(ctx, slog.LevelInfo) {
 		type userRecord struct {
 			Typ          string
 			Resolver     string
@@ -156,7 +492,7 @@ func (e *Executor) execCore(ctx context.Context,
 				FriendlyPath: record.Handle.FriendlyPath(),
 			})
 		}
-		slog.Info("Filesystem interactions:", "count", len(fsRecords), "records", userRecords)
+		log.Info("Filesystem interactions:", "count", len(fsRecords), "records", userRecords)
 	}
 
 	seenReads := make(map[string]struct{})
@@ -244,7 +580,11 @@ func writeMetaJSON(outputDir string, result *execResult, execErr error) error {
 	filesRead := []string{}
 	filesWritten := []string{}
 	inputsUsed := []string{}
+	annotations := []*Annotation{}
 	if result != nil {
+		if result.Annotations != nil {
+			annotations = result.Annotations
+		}
 		if result.FilesRead != nil {
 			filesRead = result.FilesRead
 		}
@@ -262,6 +602,7 @@ func writeMetaJSON(outputDir string, result *execResult, execErr error) error {
 		"files_read":    filesRead,
 		"files_written": filesWritten,
 		"inputs_used":   inputsUsed,
+		"annotations":   annotations,
 	}
 	if execErr != nil {
 		meta["error"] = execErr.Error()
@@ -281,211 +622,901 @@ func writeMetaJSON(outputDir string, result *execResult, execErr error) error {
 
 // copyDir copies all files from src to dst, creating directories as needed.
 func copyDir(src, dst string) error {
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+	root := util.LongPath(src)
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		relPath, relErr := filepath.Rel(src, path)
+		relPath, relErr := filepath.Rel(root, path)
 		if relErr != nil {
 			return relErr
 		}
 		targetPath := filepath.Join(dst, relPath)
 
 		if info.IsDir() {
-			return os.MkdirAll(targetPath, 0o755) //nolint:gosec // standard permissions
+			return os.MkdirAll(util.LongPath(targetPath), 0o755) //nolint:gosec // standard permissions
 		}
 
 		content, rdErr := os.ReadFile(path) //nolint:gosec // path from Walk, trusted source
 		if rdErr != nil {
 			return fmt.Errorf("failed to read: %s: %w", path, rdErr)
 		}
-		if mkErr := os.MkdirAll(filepath.Dir(targetPath), 0o755); mkErr != nil { //nolint:gosec // standard permissions
+		if mkErr := os.MkdirAll(util.LongPath(filepath.Dir(targetPath)), 0o755); mkErr != nil { //nolint:gosec // standard permissions
 			return fmt.Errorf("failed to create dir: %s: %w", filepath.Dir(targetPath), mkErr)
 		}
-		if wrErr := os.WriteFile(targetPath, content, 0o644); wrErr != nil { //nolint:gosec // standard permissions
+		if wrErr := writeFileUnlinked(util.LongPath(targetPath), content, generatedFilePerm); wrErr != nil {
 			return fmt.Errorf("failed to write: %s: %w", targetPath, wrErr)
 		}
 		return nil
 	})
 }
 
+// reloadLockFile returns ci with its lockfile loaded again if it changed since ci was loaded.
+func reloadLockFile(ci *RPackConfigInstance, loader Loader, log *slog.Logger) (*RPackConfigInstance, error) {
+	lockFile, err := loader.loadRPackLockFileOrNew(ci.LockFilePath, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return nil, err
+	}
+	if reflect.DeepEqual(lockFile, ci.LockFile) {
+		return ci, nil
+	}
+	log.Info("Lockfile was changed by another run, using the new version", "path", ci.LockFilePath)
+	reloaded := *ci
+	reloaded.LockFile = lockFile
+	return &reloaded, nil
+}
+
+// packRun holds the state of a single executed pack of a config.
+type packRun struct {
+	Instance *RPackInstance
+	FS       *RPackFS
+	Result   *execResult
+}
+
+// packTargetFile is a file written to the target by a pack.
+type packTargetFile struct {
+	*ControlledFile
+	Pack string
+	Sha  string
+	// Sum is the checksum with the lockfile checksum algorithm recorded while writing, empty if none was recorded
+	Sum string
+	// Blocks are the markers of the managed blocks of a file only partly managed by rpack
+	Blocks []string
+}
+
+// mergeExecResults combines the results of all executed packs.
+func mergeExecResults(runs []*packRun) *execResult {
+	merged := &execResult{}
+	seenInputs := make(map[string]struct{})
+	for _, run := range runs {
+		if run.Result == nil {
+			continue
+		}
+		merged.FilesRead = append(merged.FilesRead, run.Result.FilesRead...)
+		merged.FilesWritten = append(merged.FilesWritten, run.Result.FilesWritten...)
+		for _, a := range run.Result.Annotations {
+			annotation := *a
+			annotation.Pack = run.Instance.Pack.Name
+			merged.Annotations = append(merged.Annotations, &annotation)
+		}
+		for _, in := range run.Result.InputsUsed {
+			if _, ok := seenInputs[in]; !ok {
+				merged.InputsUsed = append(merged.InputsUsed, in)
+				seenInputs[in] = struct{}{}
+			}
+		}
+	}
+	return merged
+}
+
+// collectTargetFiles gathers the files written to the target by all packs
+// with the checksums recorded while writing, reporting the progress to progress, optional.
+// Files without a recorded checksum are hashed from the run directory.
+// Files written by several packs are reported before, see packWriteConflicts.
+func collectTargetFiles(ctx context.Context, log *slog.Logger, runs []*packRun, progress ProgressReporter) ([]*packTargetFile, error) {
+	var files []*packTargetFile
+	total := 0
+	for _, run := range runs {
+		total += len(run.FS.TargetWriteHandles())
+	}
+	for _, run := range runs {
+		packName := run.Instance.Pack.Name
+		visitedPaths := make(map[string]struct{})
+		sums := run.FS.TargetWriteChecksums()
+		algorithmSums := run.FS.targetAlgorithmChecksums()
+		for _, handle := range run.FS.TargetWriteHandles() {
+			relPath := handle.IndirectTargetPath()
+			absPath := filepath.Clean(filepath.Join(run.Instance.RunPath, relPath))
+
+			if _, ok := visitedPaths[absPath]; ok {
+				log.Debug("File was already moved, but written multiple times, skipping", "path", handle.FriendlyPath())
+				continue
+			}
+			visitedPaths[absPath] = struct{}{}
+
+			if err := checkCanceled(ctx); err != nil {
+				return nil, err
+			}
+			reportProgress(progress, ProgressEvent{Phase: ProgressPhaseChecksum, Current: len(files), Total: total, Item: relPath})
+			chsum, ok := sums[relPath]
+			if !ok {
+				var err error
+				if chsum, err = util.Sha256File(absPath); err != nil {
+					return nil, fmt.Errorf("failed to calculate checksum of: %s: %w", absPath, err)
+				}
+			}
+			files = append(files, &packTargetFile{
+				ControlledFile: &ControlledFile{
+					Path:    relPath,
+					AbsPath: absPath,
+				},
+				Pack:   packName,
+				Sha:    chsum,
+				Sum:    algorithmSums[relPath],
+				Blocks: run.FS.ManagedBlocks()[relPath],
+			})
+		}
+	}
+	reportProgress(progress, ProgressEvent{Phase: ProgressPhaseChecksum, Current: len(files), Total: len(files), Done: true})
+	return files, nil
+}
+
+// keepSemanticallyEqual finds generated files matching the semantic_unchanged patterns
+// whose target parses to the same structure. Their checksum is replaced by the one of the
+// existing file, which is kept as is. It returns the paths of the kept files.
+func keepSemanticallyEqual(ctx context.Context, execPath string, files []*packTargetFile, patterns []string) (map[string]struct{}, error) {
+	kept := make(map[string]struct{})
+	if len(patterns) == 0 {
+		return kept, nil
+	}
+	opts := DiffOptions{SemanticPaths: patterns}
+	for _, f := range files {
+		// Partly managed files already keep the content outside of their blocks
+		if !matchPathPattern(patterns, f.Path) || len(f.Blocks) > 0 {
+			continue
+		}
+		if err := checkCanceled(ctx); err != nil {
+			return nil, err
+		}
+		targetFile := filepath.Join(execPath, f.Path)
+		oldContent, exists, err := readTargetFile(targetFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read target file: %s: %w", f.Path, err)
+		}
+		if !exists {
+			continue
+		}
+		newContent, err := os.ReadFile(f.AbsPath) //nolint:gosec // path constructed from run directory
+		if err != nil {
+			return nil, fmt.Errorf("failed to read generated file: %s: %w", f.Path, err)
+		}
+		if !ContentEqual(f.Path, oldContent, newContent, opts) {
+			continue
+		}
+		if f.Sha, err = util.Sha256File(targetFile); err != nil {
+			return nil, fmt.Errorf("failed to calculate checksum of: %s: %w", targetFile, err)
+		}
+		f.Sum = ""
+		kept[f.Path] = struct{}{}
+	}
+	return kept, nil
+}
+
+// identicalTargetFiles finds generated files whose target already has the same content and
+// permissions. They are not moved, so timestamps and VCS status are not churned. Files in skip
+// are ignored. It returns the paths of the identical files.
+func identicalTargetFiles(ctx context.Context, execPath string, files []*packTargetFile, skip map[string]struct{}) (map[string]struct{}, error) {
+	identical := make(map[string]struct{})
+	for _, f := range files {
+		if _, ok := skip[f.Path]; ok {
+			continue
+		}
+		if err := checkCanceled(ctx); err != nil {
+			return nil, err
+		}
+		targetFile := util.LongPath(filepath.Join(execPath, f.Path))
+		targetInfo, err := os.Stat(targetFile)
+		if os.IsNotExist(err) || (err == nil && !targetInfo.Mode().IsRegular()) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to access target file: %s: %w", f.Path, err)
+		}
+		genInfo, err := os.Stat(util.LongPath(f.AbsPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to access generated file: %s: %w", f.Path, err)
+		}
+		if targetInfo.Size() != genInfo.Size() || targetInfo.Mode().Perm() != genInfo.Mode().Perm() {
+			continue
+		}
+		sha, err := util.Sha256File(targetFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate checksum of: %s: %w", f.Path, err)
+		}
+		if sha == f.Sha {
+			identical[f.Path] = struct{}{}
+		}
+	}
+	return identical, nil
+}
+
+// applyProtected removes target files matching the protected patterns from files and lock.
+// Protected files are neither written nor removed and are no longer tracked by the lockfile.
+// It returns the remaining files, the lockfile to compare against and the sorted protected paths
+// the packs wrote or that would have been removed.
+func applyProtected(files []*packTargetFile, lock *RPackLockFile, patterns []string) ([]*packTargetFile, *RPackLockFile, []string) {
+	if len(patterns) == 0 {
+		return files, lock, nil
+	}
+	touched := make(map[string]struct{})
+	var kept []*packTargetFile
+	for _, f := range files {
+		if matchPathPattern(patterns, f.Path) {
+			touched[f.Path] = struct{}{}
+			continue
+		}
+		kept = append(kept, f)
+	}
+	filtered := &RPackLockFile{SchemaVersion: lock.SchemaVersion, Files: []*RPackLockFileFile{}}
+	for _, f := range lock.Files {
+		if matchPathPattern(patterns, f.Path) {
+			touched[f.Path] = struct{}{}
+			continue
+		}
+		filtered.Files = append(filtered.Files, f)
+	}
+	return kept, filtered, slices.Sorted(maps.Keys(touched))
+}
+
+// logAnnotations prints the warnings and annotations reported by scripts.
+func logAnnotations(log *slog.Logger, annotations []*Annotation) {
+	for _, a := range annotations {
+		var attrs []any
+		if a.Pack != "" {
+			attrs = append(attrs, "pack", a.Pack)
+		}
+		if a.Path != "" {
+			attrs = append(attrs, "path", a.Path)
+		}
+		log.Warn(fmt.Sprintf("Script: %s", a.Message), attrs...)
+	}
+}
+
+// packErr prefixes errors of named packs with the pack name.
+func packErr(pack *RPackConfigPack, err error) error {
+	if pack.Name == "" {
+		return err
+	}
+	return fmt.Errorf("pack %s: %w", pack.Name, err)
+}
+
+// validatePacks validates the definitions, values and inputs of all loaded packs.
+// Issues of values are annotated with their position in the config file, or in the definition
+// declaring the dependency for the packs in origins.
+func validatePacks(log *slog.Logger, loader Loader, ci *RPackConfigInstance, packs []*RPackConfigPack, instances []*RPackInstance, extras []*RPackResolvedInput, origins map[string]defDependencyOrigin) error {
+	report := &ValidationReport{}
+	for i, pack := range packs {
+		pi := instances[i]
+		from := len(report.Issues)
+		definst, err := loader.SetupRPackDefInstance(pi.SourcePath)
+		if err != nil {
+			report.add(ValidationStepDefinition, pack.Name, err)
+			report.locate(filepath.Join(pi.SourcePath, RPackDefDefaultFilename), nil, from)
+			continue
+		}
+		packConfig := pack.ConfigOrEmpty()
+		validatePackConfig(report, log, pack.Name, definst, pi.ExecPath, pi.ResolvedInputs, slices.Sorted(maps.Keys(packConfig.Inputs)), packConfig.Values, packConfig.Values)
+		_, extraErrs := validateRPackExtras(extras, definst.Def.Extra)
+		for _, err := range extraErrs {
+			report.add(ValidationStepInputs, pack.Name, err)
+		}
+		if origin, ok := origins[pack.Name]; ok {
+			report.locate(origin.file, []string{"dependencies", strconv.Itoa(origin.index), "values"}, from)
+			continue
+		}
+		prefix := []string{"config"}
+		if idx := slices.IndexFunc(ci.Config.Packs, func(p *RPackConfigPack) bool { return p.Name == pack.Name }); idx >= 0 {
+			prefix = []string{"packs", strconv.Itoa(idx), "config"}
+		}
+		report.locate(ci.ConfigFile, prefix, from)
+	}
+	return report.err()
+}
+
 // ExecRPack loads and executes an rpack from the
 // source file specified in `name`.
-//
-//nolint:gocognit,gocyclo // intentional: complex orchestration logic
+// Configs declaring multiple packs are executed in dependency order
+// and applied together using a single lockfile.
 func (e *Executor) ExecRPack(ctx context.Context, name string) error {
-	ci, err := LoadRPackConfig(name)
+	ci, err := e.loader().LoadRPackConfig(name)
 	if err != nil {
 		return fmt.Errorf("could not load rpack config: %s: %w", name, err)
 	}
+	return e.ExecRPackConfig(ctx, ci)
+}
+
+// ExecRPackConfig executes an already loaded config, see ExecRPack.
+// It allows callers to adjust the config in memory before execution.
+func (e *Executor) ExecRPackConfig(ctx context.Context, ci *RPackConfigInstance) error {
+	_, err := e.runConfig(ctx, ci)
+	return err
+}
+
+// runConfig executes a loaded config and describes the outcome in the API types.
+// The audit log and the history of runs against the target are written even if the run fails,
+// runs that could not acquire the run lock are not recorded in the history.
+func (e *Executor) runConfig(ctx context.Context, ci *RPackConfigInstance) (*api.RunResult, error) {
+	if err := ValidateGitDirtyMode(e.GitDirty); err != nil {
+		return nil, err
+	}
+	run := *e
+	run.timings = &runTimings{}
+	if !e.DryRun && e.OutputDir == "" {
+		run.history = &HistoryEntry{Time: time.Now().UTC()}
+	}
+	var audit *AuditLog
+	if e.AuditLog != "" {
+		audit = NewAuditLog()
+	}
+	ctx, span := tracer.Start(ctx, "rpack.run", trace.WithAttributes(
+		attribute.String("rpack.config", ci.ConfigFile),
+		attribute.Bool("rpack.dry_run", e.DryRun),
+	))
+	res, err := run.runPacks(ctx, ci, audit)
+	endSpan(span, err)
+	run.timings.log(e.log())
+	if res != nil {
+		res.Timings = run.timings.list()
+	}
+	if audit != nil {
+		if auditErr := audit.WriteFile(e.AuditLog); auditErr != nil {
+			err = errors.Join(err, auditErr)
+		}
+	}
+	return res, err
+}
 
+// runPacks executes the packs of a loaded config, recording their filesystem interactions in audit, optional.
+// The run is recorded in the history while the run lock is held.
+//
+//nolint:gocognit,gocyclo // intentional: complex orchestration logic
+func (e *Executor) runPacks(ctx context.Context, ci *RPackConfigInstance, audit *AuditLog) (res *api.RunResult, err error) {
+	name := ci.ConfigFile
 	execPath := ci.ConfigPath
 	if e.OverrideExecPath != "" {
 		execPath = e.OverrideExecPath
 	}
-	pi, loadErr := LoadRPack(ci, execPath)
-	if loadErr != nil {
-		return fmt.Errorf("could not load rpack: %s: %w", name, loadErr)
+
+	// Runs on the target are serialized, dry-runs included: the scripts of all runs
+	// read the definitions from the shared source directories below execPath
+	lock, err := acquireRunLock(ctx, e.log(), execPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lock.release() }()
+	// Concurrent runs would drop each other's entries when trimming the history
+	if e.history != nil {
+		defer func() { e.recordHistory(ci, e.history, res, err) }()
 	}
 
-	values := pi.ConfigInstance.Config.Config.Values
-	inputNames := lo.Keys(pi.ConfigInstance.Config.Config.Inputs)
-	configValues := pi.ConfigInstance.Config.Config.Values
+	extras, err := resolveRPackExtras(ci.Config.Extra, ci.ConfigPath, execPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve extras: %w", err)
+	}
+	if secrets := newSecretStore(ci.ConfigPath, ci.Config.Secrets); secrets != nil || len(extras) > 0 || ci.Config.ChecksumAlgorithm != "" {
+		withConfig := *e
+		withConfig.secrets = secrets
+		withConfig.extras = extras
+		withConfig.checksumAlgorithm = ci.Config.ChecksumAlgorithm
+		e = &withConfig
+	}
 
-	fs, result, execErr := e.execCore(ctx, pi.SourcePath, pi.RunPath, pi.TempPath, pi.ResolvedInputs, values, inputNames, configValues)
+	packs, err := OrderRPackConfigPacks(ci.Config.PackList())
+	if err != nil {
+		return nil, fmt.Errorf("could not order packs: %s: %w", name, err)
+	}
+	if e.Script != "" && len(ci.Config.Packs) > 0 {
+		return nil, fmt.Errorf("a script can not be selected for all packs of %s, set script of the packs in the config: %w", name, ErrValidation)
+	}
 
-	if execErr != nil {
+	// No other run is active, all run directories are leftovers of crashed runs
+	if err = removeStaleRunDirs(execPath); err != nil {
+		e.log().Debug("Could not remove stale run directories", "error", err)
+	}
+	if !e.DryRun {
+		// Another run may have changed the lockfile while waiting
+		if ci, err = reloadLockFile(ci, e.loader(), e.log()); err != nil {
+			return nil, err
+		}
+	}
+
+	startedAt := time.Now()
+	var runs []*packRun
+	var timings []packReportTimings
+	var loaded []*RPackInstance
+	defer func() {
+		for _, pi := range loaded {
+			if err := pi.RemoveRunDir(); err != nil {
+				e.log().Debug("Could not remove run directory", "dir", pi.RunDir, "error", err)
+			}
+		}
+	}()
+	loadDurations := make(map[string]time.Duration, len(packs))
+	runID := newRunID()
+	defCache := newDefCache(e.DefCacheDir, e.DefCacheTTL, e.log())
+	// Dependencies of the definitions are loaded like the packs of the config
+	deps := newDefDependencies(packs, e.loader())
+	for queue := packs; len(queue) > 0; {
+		pack := queue[0]
+		queue = queue[1:]
+		setCrashContext(CrashPhaseLoad, pack)
+		_, endFetch := e.startPhase(ctx, TimingPhaseFetch, pack.Name)
+		reportProgress(e.Progress, ProgressEvent{Phase: ProgressPhaseFetch, Pack: pack.Name, Total: 1, Item: pack.Source})
+		pi, loadErr := loadRPackPack(ctx, ci, pack, execPath, &packLoadOptions{source: e.Sources[pack.Source], runID: runID, defCache: defCache, log: e.log()})
+		loadDurations[pack.Name] = endFetch()
+		reportProgress(e.Progress, ProgressEvent{Phase: ProgressPhaseFetch, Pack: pack.Name, Current: 1, Total: 1, Item: pack.Source, Done: true})
+		if loadErr != nil {
+			return nil, packErr(pack, fmt.Errorf("could not load rpack: %s: %w", name, loadErr))
+		}
+		loaded = append(loaded, pi)
+		added, err := deps.add(pi)
+		if err != nil {
+			return nil, packErr(pack, fmt.Errorf("could not load dependencies: %s: %w", name, err))
+		}
+		queue = append(queue, added...)
+	}
+	if len(deps.origins) > 0 {
+		if packs, err = OrderRPackConfigPacks(deps.packs); err != nil {
+			return nil, fmt.Errorf("could not order packs with dependencies of definitions: %s: %w", name, err)
+		}
+	}
+	instances := make([]*RPackInstance, len(packs))
+	for i, pack := range packs {
+		instances[i] = deps.instances[pack.Name]
+	}
+	if e.history != nil {
+		e.history.recordPacks(instances)
+	}
+	// Report the issues of all packs at once, before any of them is executed
+	_, endValidate := e.startPhase(ctx, TimingPhaseValidate, "")
+	err = validatePacks(e.log(), e.loader(), ci, packs, instances, e.extras, deps.origins)
+	endValidate()
+	if err != nil {
+		return nil, fmt.Errorf("could not validate rpack: %s: %w", name, err)
+	}
+
+	results := e.execPacks(ctx, packs, func(ctx context.Context, e *Executor, i int) *packExec {
+		pack, pi := packs[i], instances[i]
+		e = deps.executor(e, pack.Name)
+		if pack.Name != "" {
+			e.log().Info("Executing pack", "pack", pack.Name, "source", pack.Source)
+		}
+		packConfig := pack.ConfigOrEmpty()
+		values := packConfig.Values
+		inputNames := slices.Sorted(maps.Keys(packConfig.Inputs))
+		configValues := packConfig.Values
+		script := pack.Script
+		if e.Script != "" {
+			script = e.Script
+		}
+		meta := newPackMeta(ci, pack.Source, pi.ExecPath)
+
+		setCrashContext(CrashPhaseExec, pack)
+		execCtx, endExec := e.startPhase(ctx, TimingPhaseExec, pack.Name)
+		fs, result, execErr := e.execCore(execCtx, pack.Name, meta, pi.SourcePath, script, pi.RunPath, pi.TempPath, pi.ExecPath, pi.ResolvedInputs, values, inputNames, configValues)
+		packTimings := packReportTimings{Load: loadDurations[pack.Name], Exec: endExec()}
+		if execErr == nil && e.VerifyIdempotent {
+			execErr = verifyIdempotent(ctx, e.log(), fs, pi.RunPath, func(ctx context.Context, runDir, tempDir string) (*RPackFS, error) {
+				rerun := e.quiet()
+				fs, _, err := rerun.execCore(ctx, pack.Name, meta, pi.SourcePath, script, runDir, tempDir, pi.ExecPath, pi.ResolvedInputs, values, inputNames, configValues)
+				return fs, err
+			})
+		}
+		return &packExec{run: &packRun{Instance: pi, FS: fs, Result: result}, fs: fs, timings: packTimings, err: execErr}
+	})
+	for i, res := range results {
+		if res != nil {
+			audit.add(packs[i].Name, res.fs)
+		}
+	}
+	if i, execErr := packExecError(results); execErr != nil {
 		if e.OutputDir != "" {
 			if mkErr := os.MkdirAll(e.OutputDir, 0o755); mkErr != nil { //nolint:gosec // standard permissions
-				slog.Warn("Failed to create output directory for meta.json", "dir", e.OutputDir, "error", mkErr)
-			} else if metaErr := writeMetaJSON(e.OutputDir, result, execErr); metaErr != nil {
-				slog.Warn("Failed to write meta.json", "dir", e.OutputDir, "error", metaErr)
+				e.log().Warn("Failed to create output directory for meta.json", "dir", e.OutputDir, "error", mkErr)
+			} else if metaErr := writeMetaJSON(e.OutputDir, results[i].run.Result, execErr); metaErr != nil {
+				e.log().Warn("Failed to write meta.json", "dir", e.OutputDir, "error", metaErr)
 			}
 		}
-		return execErr
+		return nil, packErr(packs[i], execErr)
+	}
+	for _, res := range results {
+		runs = append(runs, res.run)
+		timings = append(timings, res.timings)
+	}
+	// Packs write to their own run directories, report all files written by several packs at once
+	if err := packWriteConflicts(runs); err != nil {
+		return nil, err
+	}
+
+	result := mergeExecResults(runs)
+	if err := applyManagedBlocks(e.log(), execPath, runs); err != nil {
+		return nil, err
+	}
+	if ci.Config.GitAttributes {
+		if err := applyGitAttributes(ctx, e.log(), execPath, runs); err != nil {
+			return nil, err
+		}
+	}
+	_, endChecksum := e.startPhase(ctx, TimingPhaseChecksum, "")
+	filesToMove, err := collectTargetFiles(ctx, e.log(), runs, e.Progress)
+	endChecksum()
+	if err != nil {
+		return nil, err
+	}
+	diffOpts := e.DiffOptions
+	diffOpts.SemanticPaths = append(slices.Clone(diffOpts.SemanticPaths), ci.Config.SemanticUnchanged...)
+
+	filesToMove, oldLock, protected := applyProtected(filesToMove, ci.LockFile, ci.Config.Protected)
+	if len(protected) > 0 {
+		e.log().Warn("Protected files are not changed", "files", protected)
+	}
+
+	res = &api.RunResult{Annotations: annotationsToAPI(result.Annotations), Protected: protected}
+	for _, f := range filesToMove {
+		res.Files = append(res.Files, f.Path)
+	}
+	sort.Strings(res.Files)
+
+	fss := make([]*RPackFS, len(runs))
+	for i, run := range runs {
+		fss[i] = run.FS
+	}
+	if err = e.checkInputsUnchanged(fss...); err != nil {
+		return nil, err
+	}
+	if e.prune {
+		return e.pruneFiles(ci, execPath, filesToMove, oldLock, res)
 	}
 
 	if e.DryRun {
+		setCrashContext(CrashPhasePlan, nil)
+		if e.PlanFile != "" || e.collectPlan {
+			plan, planErr := BuildPlan(execPath, filesToMove, oldLock, diffOpts)
+			if planErr != nil {
+				return nil, fmt.Errorf("failed to build plan: %w", planErr)
+			}
+			plan.Annotations = result.Annotations
+			plan.Protected = protected
+			if e.PlanFile != "" {
+				if planErr = plan.WriteFile(e.PlanFile); planErr != nil {
+					return nil, planErr
+				}
+			}
+			res.Plan = plan.API()
+		}
 		if e.OutputDir != "" {
-			if cpErr := copyDir(pi.RunPath, e.OutputDir); cpErr != nil {
-				return fmt.Errorf("failed to copy files to output directory: %w", cpErr)
+			for _, run := range runs {
+				if cpErr := copyDir(run.Instance.RunPath, e.OutputDir); cpErr != nil {
+					return nil, fmt.Errorf("failed to copy files to output directory: %w", cpErr)
+				}
 			}
 			if metaErr := writeMetaJSON(e.OutputDir, result, nil); metaErr != nil {
-				return metaErr
+				return nil, metaErr
 			}
 		}
-		return printDryRunOutput(pi.RunPath)
+		if e.collectPlan {
+			// Embedders get the plan instead of output on stdout
+			return res, nil
+		}
+		if e.DiffRenderer != nil {
+			if err = renderDiffs(ctx, e.DiffRenderer, execPath, filesToMove, oldLock, diffOpts); err != nil {
+				return nil, err
+			}
+			logAnnotations(e.log(), result.Annotations)
+			return res, nil
+		}
+		for _, run := range runs {
+			if err = printDryRunOutput(run.Instance.RunPath); err != nil {
+				return nil, packErr(run.Instance.Pack, err)
+			}
+		}
+		logAnnotations(e.log(), result.Annotations)
+		return res, nil
 	}
 
+	setCrashContext(CrashPhaseApply, nil)
+	_, endApply := e.startPhase(ctx, TimingPhaseApply, "")
+	defer endApply()
 	if e.OutputDir != "" {
 		if !e.Force {
 			entries, rdErr := os.ReadDir(e.OutputDir)
 			if rdErr == nil && len(entries) > 0 {
-				return fmt.Errorf("output directory %s is not empty, use --force to overwrite", e.OutputDir)
+				return nil, fmt.Errorf("output directory %s is not empty, use --force to overwrite", e.OutputDir)
 			}
 		}
 		if mkErr := os.MkdirAll(e.OutputDir, 0o755); mkErr != nil { //nolint:gosec // standard permissions
-			return fmt.Errorf("could not create output directory: %s: %w", e.OutputDir, mkErr)
-		}
-		if cpErr := copyDir(pi.RunPath, e.OutputDir); cpErr != nil {
-			return fmt.Errorf("failed to copy files to output directory: %w", cpErr)
-		}
-		return writeMetaJSON(e.OutputDir, result, nil)
-	}
-
-	// Copy/Rename files from run directory to execPath
-	visitedPaths := make(map[string]struct{})
-	checksums := make(map[string]string)
-	var filesToMove []*ControlledFile
-	for _, handle := range fs.TargetWriteHandles() {
-		relPath := handle.IndirectTargetPath()
-		absPath := filepath.Clean(filepath.Join(pi.RunPath, relPath))
-		c := &ControlledFile{
-			Path:    relPath,
-			AbsPath: absPath,
+			return nil, fmt.Errorf("could not create output directory: %s: %w", e.OutputDir, mkErr)
 		}
-
-		if _, ok := visitedPaths[absPath]; ok {
-			slog.Debug("File was already moved, but written multiple times, skipping", "path", handle.FriendlyPath())
-			continue
+		for _, run := range runs {
+			if cpErr := copyDir(run.Instance.RunPath, e.OutputDir); cpErr != nil {
+				return nil, fmt.Errorf("failed to copy files to output directory: %w", cpErr)
+			}
 		}
-
-		var chsum string
-		chsum, err = util.Sha256File(absPath)
-		if err != nil {
-			return fmt.Errorf("failed to calculate checksum of: %s: %w", absPath, err)
+		logAnnotations(e.log(), result.Annotations)
+		if err = writeMetaJSON(e.OutputDir, result, nil); err != nil {
+			return nil, err
 		}
-		checksums[absPath] = chsum
+		endApply()
+		return res, nil
+	}
 
-		filesToMove = append(filesToMove, c)
-		visitedPaths[absPath] = struct{}{}
+	verify := ci.Config.Verify
+	if e.NoVerify {
+		verify = nil
+	}
+	if err = checkVerifyCommands(verify, e.AllowVerify); err != nil {
+		return nil, err
+	}
+	postApply := ci.Config.PostApply
+	if e.NoPostApply {
+		postApply = nil
+	}
+	if err = checkPostApplyCommands(postApply, e.AllowPostApply); err != nil {
+		return nil, err
+	}
+	if err = checkNotifyWebhook(ci.Config.Notify, e.AllowNotify); err != nil {
+		return nil, err
 	}
 
-	oldLock := ci.LockFile
 	oldLockIntegrity, err := oldLock.CheckIntegrity(execPath)
 	if err != nil {
-		return fmt.Errorf("failed to check lockfile integrity: %w", err)
+		return nil, fmt.Errorf("failed to check lockfile integrity: %w", err)
+	}
+	// Local modifications are merged into the generated files, only the files that can not be merged remain modified
+	var generated map[string][]byte
+	var conflicts []string
+	if e.Merge && len(oldLockIntegrity.Modified) > 0 {
+		generated, conflicts, oldLockIntegrity.Modified, err = mergeModified(e.log(), newBaselineStore(execPath), execPath, oldLockIntegrity.Modified, filesToMove, oldLock)
+		if err != nil {
+			return nil, err
+		}
+		res.Merged = slices.Sorted(maps.Keys(generated))
+		res.Conflicts = conflicts
+		if len(res.Merged) > 0 {
+			e.log().Info("Merged local modifications into generated files", "files", res.Merged)
+		}
 	}
 	if len(oldLockIntegrity.Modified) > 0 {
 		modFilesStr := strings.Join(oldLockIntegrity.Modified, ",")
-		slog.Warn("Some files in lockfile were modified outside of rpack", "files", modFilesStr)
+		e.log().Warn("Some files in lockfile were modified outside of rpack", "files", modFilesStr)
 		if !e.Force {
-			return fmt.Errorf("some locked files were modified outside of rpack, use force flag to ignore: %s", modFilesStr)
+			return nil, fmt.Errorf("some locked files were modified outside of rpack, use force flag to ignore: %s: %w", modFilesStr, ErrLockModified)
 		}
 	}
 
 	if len(oldLockIntegrity.Removed) > 0 {
-		slog.Warn("Some files in lockfile were removed outside of rpack", "files", strings.Join(oldLockIntegrity.Removed, ","))
+		e.log().Warn("Some files in lockfile were removed outside of rpack", "files", strings.Join(oldLockIntegrity.Removed, ","))
+	}
+
+	kept, err := keepSemanticallyEqual(ctx, execPath, filesToMove, ci.Config.SemanticUnchanged)
+	if err != nil {
+		return nil, err
+	}
+	if len(kept) > 0 {
+		res.Kept = slices.Sorted(maps.Keys(kept))
+		e.log().Info("Keeping files with semantically equal content", "files", res.Kept)
+	}
+
+	identical, err := identicalTargetFiles(ctx, execPath, filesToMove, kept)
+	if err != nil {
+		return nil, err
+	}
+	if len(identical) > 0 {
+		e.log().Debug("Skipping files with identical content", "files", slices.Sorted(maps.Keys(identical)))
 	}
 
 	newLockfile := NewRPackLockFile()
 	for _, wFile := range filesToMove {
-		chsum, ok := checksums[wFile.AbsPath]
-		if !ok {
-			panic("Can't find checksum for file")
+		if len(wFile.Blocks) == 0 {
+			newLockfile.AddPackFile(wFile.Pack, wFile.Path, wFile.Sha)
+			continue
+		}
+		// Only the managed blocks of the file are tracked
+		sum, blocksErr := lockfile.ChecksumBlocks(lockfile.SHA256, util.LongPath(wFile.AbsPath), wFile.Blocks)
+		if blocksErr != nil {
+			return nil, fmt.Errorf("failed to calculate checksum of: %s: %w", wFile.Path, blocksErr)
 		}
-		newLockfile.AddFile(wFile.Path, chsum)
+		newLockfile.Files = append(newLockfile.Files, &RPackLockFileFile{Path: wFile.Path, Sha: sum, Pack: wFile.Pack, Blocks: wFile.Blocks})
 	}
 
 	changes := newLockfile.Changes(oldLock)
-	slog.Info("New files in lockfile", "files", changes.Added)
-	slog.Info("Files no longer maintained by rpack, removing", "files", changes.Removed)
+	res.Added, res.Removed = changes.Added, changes.Removed
+	e.log().Info("New files in lockfile", "files", changes.Added)
+	e.log().Info("Files no longer maintained by rpack, removing", "files", changes.Removed)
 
 	for _, added := range changes.Added {
+		_, isKept := kept[added]
+		_, isIdentical := identical[added]
+		isBlocks := slices.ContainsFunc(filesToMove, func(f *packTargetFile) bool { return f.Path == added && len(f.Blocks) > 0 })
+		if isKept || isIdentical || isBlocks {
+			// Content is not overwritten, the file is only adopted
+			continue
+		}
 		targetFile := filepath.Clean(filepath.Join(execPath, added))
 		var exists bool
-		exists, err = util.FileExists(targetFile)
+		exists, err = util.FileExists(util.LongPath(targetFile))
 		if exists {
-			slog.Warn("File is not managed by rdef but will be overwritten", "file", added)
+			e.log().Warn("File is not managed by rdef but will be overwritten", "file", added)
 			if !e.Force {
-				return fmt.Errorf("existing file would need to be overwritten, use force flag to ignore: %s", added)
+				return nil, fmt.Errorf("existing file would need to be overwritten, use force flag to ignore: %s", added)
 			}
 		} else if err != nil {
-			return fmt.Errorf("failed to check file exists: %s: %w", added, err)
+			return nil, fmt.Errorf("failed to check file exists: %s: %w", added, err)
 		}
 	}
 
+	var overwritten []string
 	for _, wFile := range filesToMove {
-		targetFile := filepath.Clean(filepath.Join(execPath, wFile.Path))
-		if err = os.MkdirAll(filepath.Dir(targetFile), 0o755); err != nil { //nolint:gosec // standard permissions
-			return fmt.Errorf("failed to create dirs for: %s: %w", targetFile, err)
+		_, isKept := kept[wFile.Path]
+		_, isIdentical := identical[wFile.Path]
+		_, isMerged := generated[wFile.Path]
+		if !isKept && !isIdentical && !isMerged {
+			overwritten = append(overwritten, wFile.Path)
 		}
-		err = os.Rename(wFile.AbsPath, targetFile)
-		if err != nil {
-			return fmt.Errorf("failed to move file %s to exec path %s: %w", wFile.Path, execPath, err)
+	}
+	if err = e.checkGitDirty(ctx, execPath, append(overwritten, changes.Removed...)); err != nil {
+		return nil, err
+	}
+
+	// Changes to the target are rolled back if the apply or a verify command fails
+	tx, err := newApplyTransaction(execPath, e.log())
+	if err != nil {
+		return nil, err
+	}
+	rollback := func(err error) (*api.RunResult, error) {
+		return nil, errors.Join(err, tx.rollback())
+	}
+
+	for i, wFile := range filesToMove {
+		reportProgress(e.Progress, ProgressEvent{Phase: ProgressPhaseTransfer, Current: i, Total: len(filesToMove), Item: wFile.Path})
+		_, isKept := kept[wFile.Path]
+		_, isIdentical := identical[wFile.Path]
+		if isKept || isIdentical {
+			continue
+		}
+		if err = checkCanceled(ctx); err != nil {
+			return rollback(err)
+		}
+		if err = tx.put(wFile.AbsPath, wFile.Path); err != nil {
+			return rollback(err)
 		}
 	}
 
+	reportProgress(e.Progress, ProgressEvent{Phase: ProgressPhaseTransfer, Current: len(filesToMove), Total: len(filesToMove), Done: true})
+
 	for _, removedFile := range changes.Removed {
-		p := filepath.Join(execPath, removedFile)
+		if err = checkCanceled(ctx); err != nil {
+			return rollback(err)
+		}
+		p := util.LongPath(filepath.Join(execPath, removedFile))
 		var exists bool
 		exists, err = util.FileExists(p)
 		if err != nil {
-			return fmt.Errorf("could not check deprecated file: %s: %w", removedFile, err)
+			return rollback(fmt.Errorf("could not check deprecated file: %s: %w", removedFile, err))
 		}
-		if exists {
-			err = os.Remove(p)
-			if err != nil {
-				return fmt.Errorf("could not remove deprecated file: %s: %w", removedFile, err)
+		blocks := oldLock.fileBlocks(removedFile)
+		switch {
+		case exists && len(blocks) > 0:
+			// The rest of partly managed files is kept
+			if err = tx.removeBlocks(removedFile, blocks); err != nil {
+				return rollback(err)
+			}
+		case exists:
+			if err = tx.remove(removedFile); err != nil {
+				return rollback(err)
 			}
-		} else {
-			slog.Warn("File managed by rpack but marked for removal, does no longer exist, ignoring", "file", removedFile)
+		default:
+			e.log().Warn("File managed by rpack but marked for removal, does no longer exist, ignoring", "file", removedFile)
 		}
 	}
 
+	// The lockfile checksums were calculated with sha256, other algorithms use the checksums
+	// recorded while writing and only hash the applied files without one
+	sums := make(map[string]string)
+	for _, wFile := range filesToMove {
+		if wFile.Sum != "" {
+			sums[wFile.Path] = wFile.Sum
+		}
+	}
+	if err = newLockfile.rehash(ctx, ci.Config.ChecksumAlgorithm, execPath, generated, sums); err != nil {
+		return rollback(err)
+	}
+
+	if err = runVerifyCommands(ctx, e.log(), verify, execPath); err != nil {
+		return rollback(err)
+	}
+
 	err = newLockfile.WriteFile(ci.LockFilePath)
 	if err != nil {
-		return fmt.Errorf("could not write lockfile to %s: %w", ci.LockFilePath, err)
+		return rollback(fmt.Errorf("could not write lockfile to %s: %w", ci.LockFilePath, err))
+	}
+	if err = tx.commit(); err != nil {
+		e.log().Warn("Failed to remove backups of the apply", "error", err)
+	}
+	endApply()
+	if e.history != nil {
+		for _, wFile := range filesToMove {
+			_, isKept := kept[wFile.Path]
+			_, isIdentical := identical[wFile.Path]
+			if !isKept && !isIdentical && !slices.Contains(changes.Added, wFile.Path) {
+				e.history.Changed++
+			}
+		}
 	}
 
-	return nil
+	// Post-apply commands run on the committed apply, a failure is reported after the bookkeeping
+	var postApplyErr error
+	if len(postApply) > 0 {
+		postApplyErr = e.runPostApply(ctx, postApply, execPath, ci.LockFilePath, newLockfile, generated, res)
+	}
+
+	// Baselines are only needed for later merges and diffs, failing to store them does not fail the apply
+	if err = newBaselineStore(execPath).store(e.log(), ci.ConfigFile, newLockfile, execPath, generated); err != nil {
+		e.log().Warn("Failed to store baselines", "error", err)
+	}
+
+	// A .gitignore generated by a pack is managed by the lockfile and must not be changed
+	generatesGitIgnore := slices.ContainsFunc(filesToMove, func(f *packTargetFile) bool { return f.Path == GitIgnoreFile })
+	if !e.NoGitIgnore && !generatesGitIgnore {
+		if changed, err := ensureGitIgnore(execPath); err != nil {
+			e.log().Warn("Failed to add rpack internals to .gitignore", "error", err)
+		} else if changed {
+			e.log().Info("Added rpack internals to .gitignore", "file", filepath.Join(execPath, GitIgnoreFile))
+		}
+	}
+
+	// The report is informational, failing to write it does not fail the apply
+	report, err := writeRunReport(ci, execPath, startedAt, runs, filesToMove, timings, e.timings.list())
+	if err != nil {
+		e.log().Warn("Failed to write run report", "error", err)
+	}
+	// Notifications are informational as well, the apply is done
+	if report != nil {
+		if err = e.notifyApply(ctx, ci.Config.Notify, report); err != nil {
+			e.log().Warn("Failed to send notifications", "error", err)
+		}
+	}
+
+	logAnnotations(e.log(), result.Annotations)
+	e.log().Info("Run summary", "packs", len(runs), "files", len(filesToMove), "added", len(changes.Added), "removed", len(changes.Removed), "protected", len(protected), "warnings", len(result.Annotations), "post_apply", len(res.PostApply))
+	if postApplyErr != nil {
+		return res, postApplyErr
+	}
+	if len(conflicts) > 0 {
+		return res, fmt.Errorf("resolve the conflict markers in: %s: %w", strings.Join(conflicts, ","), ErrMergeConflict)
+	}
+	return res, nil
 }
 
 // ExecRPackDirect runs an rpack from a local definition directory
-// with programmatically supplied values and inputs.
+// with programmatically supplied values and inputs. Files are written to OutputDir if set,
+// otherwise to OverrideExecPath or the working directory.
+func (e *Executor) ExecRPackDirect(ctx context.Context, defDir string, values map[string]any, inputs map[string]string) error {
+	if e.AuditLog == "" {
+		return e.execDirect(ctx, defDir, values, inputs, nil)
+	}
+	audit := NewAuditLog()
+	err := e.execDirect(ctx, defDir, values, inputs, audit)
+	if auditErr := audit.WriteFile(e.AuditLog); auditErr != nil {
+		return errors.Join(err, auditErr)
+	}
+	return err
+}
+
+// execDirect implements ExecRPackDirect, recording filesystem interactions in audit, optional.
 //
 //nolint:gocognit,gocyclo // intentional: orchestration logic
-func (e *Executor) ExecRPackDirect(ctx context.Context, defDir string, values map[string]any, inputs map[string]string) error {
+func (e *Executor) execDirect(ctx context.Context, defDir string, values map[string]any, inputs map[string]string, audit *AuditLog) error {
+	setCrashContext(CrashPhaseExec, nil)
 	absDefDir, err := filepath.Abs(defDir)
 	if err != nil {
 		return fmt.Errorf("could not resolve definition directory: %s: %w", defDir, err)
@@ -531,9 +1562,20 @@ func (e *Executor) ExecRPackDirect(ctx context.Context, defDir string, values ma
 		})
 	}
 
-	inputNames := lo.Keys(inputs)
+	inputNames := slices.Sorted(maps.Keys(inputs))
 	configValues := values
 
+	// Files are copied to the output directory or the execution path, allowed target reads see its content
+	execPath := "."
+	if e.OverrideExecPath != "" {
+		execPath = e.OverrideExecPath
+	}
+	targetDir := execPath
+	if !e.DryRun && e.OutputDir != "" {
+		targetDir = e.OutputDir
+	}
+
+	var fs *RPackFS
 	var result *execResult
 	var execErr error
 
@@ -543,21 +1585,66 @@ func (e *Executor) ExecRPackDirect(ctx context.Context, defDir string, values ma
 				execErr = fmt.Errorf("lua execution panicked: %v", r)
 			}
 		}()
-		_, result, execErr = e.execCore(ctx, absDefDir, runDir, tempDir, resolvedInputs, values, inputNames, configValues)
+		fs, result, execErr = e.execCore(ctx, "", packMeta{}, absDefDir, e.Script, runDir, tempDir, targetDir, resolvedInputs, values, inputNames, configValues)
 	}()
+	audit.add("", fs)
+	if execErr == nil && e.VerifyIdempotent {
+		execErr = verifyIdempotent(ctx, e.log(), fs, runDir, func(ctx context.Context, runDir, tempDir string) (*RPackFS, error) {
+			rerun := e.quiet()
+			fs, _, err := rerun.execCore(ctx, "", packMeta{}, absDefDir, e.Script, runDir, tempDir, targetDir, resolvedInputs, values, inputNames, configValues)
+			return fs, err
+		})
+	}
 
 	if execErr != nil {
 		if e.OutputDir != "" {
 			if mkErr := os.MkdirAll(e.OutputDir, 0o755); mkErr != nil { //nolint:gosec // standard permissions
-				slog.Warn("Failed to create output directory for meta.json", "dir", e.OutputDir, "error", mkErr)
+				e.log().Warn("Failed to create output directory for meta.json", "dir", e.OutputDir, "error", mkErr)
 			} else if metaErr := writeMetaJSON(e.OutputDir, result, execErr); metaErr != nil {
-				slog.Warn("Failed to write meta.json", "dir", e.OutputDir, "error", metaErr)
+				e.log().Warn("Failed to write meta.json", "dir", e.OutputDir, "error", metaErr)
 			}
 		}
 		return execErr
 	}
+	if err = e.checkInputsUnchanged(fs); err != nil {
+		return err
+	}
+	// Findings are printed after the dry-run output and copied files
+	defer logAnnotations(e.log(), result.Annotations)
+
+	// Without a config there is no lockfile, compare against the execution path.
+	// Managed blocks are merged into the target files before they are copied anywhere,
+	// the run directory only holds the blocks otherwise.
+	run := &packRun{
+		Instance: &RPackInstance{RunPath: runDir, Pack: &RPackConfigPack{}},
+		FS:       fs,
+		Result:   result,
+	}
+	if err = applyManagedBlocks(e.log(), execPath, []*packRun{run}); err != nil {
+		return err
+	}
 
 	if e.DryRun {
+		if e.PlanFile == "" && e.DiffRenderer == nil {
+			return printDryRunOutput(runDir)
+		}
+		files, collectErr := collectTargetFiles(ctx, e.log(), []*packRun{run}, e.Progress)
+		if collectErr != nil {
+			return collectErr
+		}
+		if e.PlanFile != "" {
+			plan, planErr := BuildPlan(execPath, files, NewRPackLockFile(), e.DiffOptions)
+			if planErr != nil {
+				return fmt.Errorf("failed to build plan: %w", planErr)
+			}
+			plan.Annotations = result.Annotations
+			if planErr = plan.WriteFile(e.PlanFile); planErr != nil {
+				return planErr
+			}
+		}
+		if e.DiffRenderer != nil {
+			return renderDiffs(ctx, e.DiffRenderer, execPath, files, NewRPackLockFile(), e.DiffOptions)
+		}
 		return printDryRunOutput(runDir)
 	}
 
@@ -577,9 +1664,9 @@ func (e *Executor) ExecRPackDirect(ctx context.Context, defDir string, values ma
 		return writeMetaJSON(e.OutputDir, result, nil)
 	}
 
-	// No --output-dir and no --dry-run: write files to CWD.
-	if cpErr := copyDir(runDir, "."); cpErr != nil {
-		return fmt.Errorf("failed to copy files to working directory: %w", cpErr)
+	// No --output-dir and no --dry-run: write files to the execution path.
+	if cpErr := copyDir(runDir, execPath); cpErr != nil {
+		return fmt.Errorf("failed to copy files to %s: %w", execPath, cpErr)
 	}
 
 	return nil
@@ -0,0 +1,723 @@
+package rpack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestKeepSemanticallyEqual(t *testing.T) {
+	execPath := t.TempDir()
+	runPath := t.TempDir()
+	write := func(dir, name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	write(execPath, "app/values.yaml", "b: 'x'\na: 1\n")
+	write(runPath, "app/values.yaml", "a: 1\nb: x\n")
+	write(execPath, "changed.yaml", "a: 1\n")
+	write(runPath, "changed.yaml", "a: 2\n")
+	write(execPath, "other.json", "{\"a\":1}")
+	write(runPath, "other.json", "{\"a\": 1}")
+	write(runPath, "new.yaml", "a: 1\n")
+
+	var files []*packTargetFile
+	for _, name := range []string{"app/values.yaml", "changed.yaml", "other.json", "new.yaml"} {
+		files = append(files, &packTargetFile{ControlledFile: &ControlledFile{Path: name, AbsPath: filepath.Join(runPath, name)}, Sha: "generated"})
+	}
+
+	kept, err := keepSemanticallyEqual(t.Context(), execPath, files, []string{"*.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 {
+		t.Fatalf("Expected only app/values.yaml to be kept, got %v", kept)
+	}
+	if _, ok := kept["app/values.yaml"]; !ok || files[0].Sha == "generated" {
+		t.Errorf("Expected app/values.yaml kept with checksum of existing file: %v %s", kept, files[0].Sha)
+	}
+	for _, f := range files[1:] {
+		if f.Sha != "generated" {
+			t.Errorf("Expected checksum of %s unchanged, got %s", f.Path, f.Sha)
+		}
+	}
+}
+
+func TestRunProtected(t *testing.T) {
+	script := `rpack.write("./out.txt", "out\n")
+rpack.write("./README.md", "generated\n")
+rpack.write("./docs/guide/a.md", "generated\n")
+`
+	config, workDir := setupRunConfig(t, script, "protected: [\"README.md\", \"docs/**\"]\n")
+	readme := filepath.Join(workDir, "README.md")
+	if err := os.WriteFile(readme, []byte("mine\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Plan.Files) != 1 || res.Plan.Files[0].Path != "out.txt" {
+		t.Errorf("Expected plan to only contain out.txt, got %+v", res.Plan.Files)
+	}
+	if !reflect.DeepEqual(res.Plan.Protected, []string{"README.md", "docs/guide/a.md"}) {
+		t.Errorf("Unexpected protected paths in plan %v", res.Plan.Protected)
+	}
+
+	res, err = Run(t.Context(), api.RunOptions{ConfigFile: config, Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Protected, []string{"README.md", "docs/guide/a.md"}) || !reflect.DeepEqual(res.Files, []string{"out.txt"}) {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	if b, _ := os.ReadFile(readme); string(b) != "mine\n" { //nolint:gosec // test file
+		t.Errorf("Protected file was overwritten: %q", b)
+	}
+	if _, err = os.Stat(filepath.Join(workDir, "docs")); !os.IsNotExist(err) {
+		t.Error("Protected directory was written")
+	}
+	lock, err := Loader{}.loadRPackLockFile(filepath.Join(workDir, "app"+RPackLockFileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Files) != 1 || lock.Files[0].Path != "out.txt" {
+		t.Errorf("Expected only out.txt to be tracked, got %+v", lock.Files)
+	}
+}
+
+func TestApplyProtected(t *testing.T) {
+	lock := NewRPackLockFile()
+	lock.AddFile("keep.txt", "1")
+	lock.AddFile("docs/old.md", "2")
+	files := []*packTargetFile{
+		{ControlledFile: &ControlledFile{Path: "keep.txt"}},
+		{ControlledFile: &ControlledFile{Path: "docs/new.md"}},
+	}
+	kept, filtered, protected := applyProtected(files, lock, []string{"docs/**"})
+	if len(kept) != 1 || kept[0].Path != "keep.txt" {
+		t.Errorf("Unexpected files %+v", kept)
+	}
+	if len(filtered.Files) != 1 || filtered.Files[0].Path != "keep.txt" || len(lock.Files) != 2 {
+		t.Errorf("Unexpected lockfile %+v", filtered.Files)
+	}
+	if !reflect.DeepEqual(protected, []string{"docs/new.md", "docs/old.md"}) {
+		t.Errorf("Unexpected protected paths %v", protected)
+	}
+}
+
+func TestRunLongPaths(t *testing.T) {
+	// Deeper than MAX_PATH on Windows, even before adding the cache directories
+	rel := strings.Repeat("nested-directory/", 16) + "file.txt"
+	config, workDir := setupRunConfig(t, "rpack.write(\"./"+rel+"\", \"deep\\n\")\n", "")
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(workDir, filepath.FromSlash(rel))) //nolint:gosec // test file
+	if err != nil || string(b) != "deep\n" {
+		t.Fatalf("Expected deep file to be written, got %q: %v", b, err)
+	}
+
+	// Without the write the file is removed
+	if err = os.WriteFile(filepath.Join(filepath.Dir(workDir), "def", "script.lua"), []byte("local rpack = require(\"rpack.v1\")\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(workDir, filepath.FromSlash(rel))); !os.IsNotExist(err) {
+		t.Errorf("Expected deep file to be removed, got %v", err)
+	}
+}
+
+func TestRunTypedErrors(t *testing.T) {
+	t.Run("lock modified", func(t *testing.T) {
+		config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"hello\\n\")\n", "")
+		if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(workDir, "out.txt"), []byte("edited\n"), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+		if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); !errors.Is(err, ErrLockModified) {
+			t.Errorf("Expected ErrLockModified from run, got %v", err)
+		}
+		if err := (&Checker{}).CheckIntegrity(t.Context(), config); !errors.Is(err, ErrLockModified) {
+			t.Errorf("Expected ErrLockModified from check, got %v", err)
+		}
+	})
+	t.Run("invalid config", func(t *testing.T) {
+		config, _ := setupRunConfig(t, "", "protected: [\"\"]\n")
+		if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); !errors.Is(err, ErrValidation) {
+			t.Errorf("Expected ErrValidation, got %v", err)
+		}
+	})
+	t.Run("missing source", func(t *testing.T) {
+		config, workDir := setupRunConfig(t, "", "")
+		missing := filepath.ToSlash(filepath.Join(workDir, "missing"))
+		if err := os.WriteFile(config, []byte("\"@schema_version\": \"v1\"\nsource: \""+missing+"\"\n"), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+		_, err := Run(t.Context(), api.RunOptions{ConfigFile: config})
+		if !errors.Is(err, ErrSourceFetch) || errors.Is(err, ErrValidation) {
+			t.Errorf("Expected ErrSourceFetch, got %v", err)
+		}
+	})
+}
+
+func TestRunSkipsIdenticalFiles(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./same.txt\", \"same\\n\")\nrpack.write(\"./adopted.txt\", \"adopted\\n\")\n", "")
+	// An unmanaged file with the generated content is adopted without --force
+	if err := os.WriteFile(filepath.Join(workDir, "adopted.txt"), []byte("adopted\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{"same.txt", "adopted.txt"} {
+		if err := os.Chtimes(filepath.Join(workDir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"same.txt", "adopted.txt"} {
+		info, err := os.Stat(filepath.Join(workDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(old) {
+			t.Errorf("Expected identical %s not to be rewritten, modified at %s", name, info.ModTime())
+		}
+	}
+	lock, err := os.ReadFile(filepath.Join(workDir, "app.rpack.lock.yaml")) //nolint:gosec // test file
+	if err != nil || !strings.Contains(string(lock), "same.txt") || !strings.Contains(string(lock), "adopted.txt") {
+		t.Errorf("Expected lockfile to keep the entries, got %s: %v", lock, err)
+	}
+}
+
+func TestRunVerifyIdempotent(t *testing.T) {
+	config, _ := setupRunConfig(t, "rpack.write(\"./stable.txt\", \"stable\\n\")\n", "")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true, VerifyIdempotent: true}); err != nil {
+		t.Fatalf("Expected deterministic script to pass, got %v", err)
+	}
+
+	config, workDir := setupRunConfig(t, "rpack.write(\"./stable.txt\", \"stable\\n\")\nrpack.write(\"./random.txt\", tostring(math.random()))\n", "")
+	_, err := Run(t.Context(), api.RunOptions{ConfigFile: config, VerifyIdempotent: true})
+	if !errors.Is(err, ErrNotIdempotent) || !errors.Is(err, ErrPurityViolation) || !strings.Contains(err.Error(), "random.txt (content differs)") {
+		t.Fatalf("Expected ErrNotIdempotent for random.txt, got %v", err)
+	}
+	if strings.Contains(err.Error(), "stable.txt") {
+		t.Errorf("Expected only random.txt to differ, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(workDir, "random.txt")); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be applied")
+	}
+}
+
+func TestRunStrictDecoding(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"hello\\n\")\n", "config:\n  vaules:\n    a: 1\n")
+	_, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true})
+	if err == nil || !strings.Contains(err.Error(), "vaules") || !strings.Contains(err.Error(), "--lenient") {
+		t.Fatalf("Expected unknown field to fail, got %v", err)
+	}
+
+	lock := "\"@schema_version\": v1\nfiles: []\nextra: true\n"
+	if err = os.WriteFile(filepath.Join(workDir, "app.rpack.lock.yaml"), []byte(lock), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true, Lenient: true}); err != nil {
+		t.Fatalf("Expected lenient decoding to ignore unknown fields, got %v", err)
+	}
+	if err = (&Checker{Lenient: true}).CheckIntegrity(t.Context(), config); err != nil {
+		t.Fatalf("Expected the lenient check to ignore unknown fields, got %v", err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true}); err == nil {
+		t.Fatal("Expected unknown fields in config and lockfile to fail")
+	}
+}
+
+func TestRunOptionalInputs(t *testing.T) {
+	script := `local inputs = rpack.inputs()
+assert(#inputs == 2 and inputs[1] == "defaulted" and inputs[2] == "mapped")
+assert(inputs.missing == nil and inputs.absent == nil)
+rpack.write("./out.txt", rpack.read(inputs.mapped) .. rpack.read(inputs.defaulted))
+`
+	config, workDir := setupRunConfig(t, script, "config:\n  inputs:\n    mapped: mapped.txt\n")
+	defFile := filepath.Join(filepath.Dir(workDir), "def", "rpack.yaml")
+	def := `"@schema_version": "v1"
+name: "app"
+inputs:
+  - {name: mapped, type: file, required: true}
+  - {name: defaulted, type: file, default: conf/default.txt}
+  - {name: absent, type: file, default: conf/absent.txt}
+  - {name: missing, type: file}
+`
+	if err := os.WriteFile(defFile, []byte(def), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(workDir, "conf"), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"mapped.txt": "a\n", "conf/default.txt": "b\n"} {
+		if err := os.WriteFile(filepath.Join(workDir, filepath.FromSlash(name)), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(workDir, "out.txt")); err != nil || string(b) != "a\nb\n" { //nolint:gosec // test file
+		t.Errorf("Expected mapped and defaulted input content, got %q: %v", b, err)
+	}
+
+	// The required input is not mapped anymore
+	if err := os.WriteFile(config, []byte("\"@schema_version\": \"v1\"\nsource: \""+filepath.ToSlash(filepath.Dir(defFile))+"\"\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); !errors.Is(err, ErrInputValidation) {
+		t.Errorf("Expected ErrInputValidation for missing required input, got %v", err)
+	}
+}
+
+func TestRunValidationReport(t *testing.T) {
+	dir := t.TempDir()
+	defs := map[string]map[string]string{
+		"web": {
+			"rpack.yaml":  "\"@schema_version\": \"v1\"\nname: \"web\"\n",
+			"schema.json": `{"type": "object", "properties": {"values": {"type": "object", "properties": {"port": {"type": "integer"}, "name": {"type": "string"}}}}}`,
+			"script.lua":  "rpack.write(\"./web.txt\", \"web\\n\")\n",
+		},
+		"db": {
+			"rpack.yaml": "\"@schema_version\": \"v1\"\nname: \"db\"\ninputs:\n  - {name: dump, type: file, required: true}\n",
+			"script.lua": "rpack.write(\"./db.txt\", \"db\\n\")\n",
+		},
+	}
+	for def, files := range defs {
+		if err := os.MkdirAll(filepath.Join(dir, def), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, def, name), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+				t.Fatal(err)
+			}
+		}
+	}
+	config := filepath.Join(dir, "app.rpack.yaml")
+	content := `"@schema_version": "v1"
+packs:
+  - name: web
+    source: "` + filepath.ToSlash(filepath.Join(dir, "web")) + `"
+    config:
+      values:
+        port: "8080"
+        name: 1
+  - name: db
+    source: "` + filepath.ToSlash(filepath.Join(dir, "db")) + `"
+`
+	if err := os.WriteFile(config, []byte(content), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	_, err := Run(t.Context(), api.RunOptions{ConfigFile: config})
+	var report *ValidationReport
+	if !errors.As(err, &report) {
+		t.Fatalf("Expected validation report, got %v", err)
+	}
+	if len(report.Issues) != 3 {
+		t.Fatalf("Expected issues of both packs, got %v", err)
+	}
+	if !errors.Is(err, ErrSchemaValidation) || !errors.Is(err, ErrInputValidation) {
+		t.Errorf("Expected schema and input validation errors, got %v", err)
+	}
+	var yamlErr *YAMLError
+	if issue := report.Issues[0]; issue.Pack != "web" || issue.Step != ValidationStepValues || !errors.As(issue, &yamlErr) || yamlErr.Line != 8 {
+		t.Errorf("Expected values issue of web at line 8, got %v", issue)
+	}
+	if issue := report.Issues[2]; issue.Pack != "db" || issue.Step != ValidationStepInputs {
+		t.Errorf("Expected inputs issue of db, got %v", issue)
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, "web.txt")); !os.IsNotExist(statErr) {
+		t.Error("Expected no pack to be applied")
+	}
+}
+
+func TestRunGlobInput(t *testing.T) {
+	script := `local files = rpack.inputs().services
+assert(#files == 2 and files[1] == "map:services/a/config.yaml", files[1])
+local out = {}
+for _, f in ipairs(files) do
+  table.insert(out, rpack.read(f))
+end
+assert(not pcall(rpack.read, "map:services"))
+assert(not pcall(rpack.read, "map:services/a/other.yaml"))
+rpack.write("./all.txt", table.concat(out))
+`
+	config, workDir := setupRunConfig(t, script, "config:\n  inputs:\n    services: \"services/*/config.yaml\"\n")
+	defFile := filepath.Join(filepath.Dir(workDir), "def", "rpack.yaml")
+	if err := os.WriteFile(defFile, []byte("\"@schema_version\": \"v1\"\nname: \"app\"\ninputs:\n  - {name: services, type: file}\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"services/a/config.yaml": "a\n", "services/b/config.yaml": "b\n", "services/a/other.yaml": "x\n"} {
+		p := filepath.Join(workDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(workDir, "all.txt")); err != nil || string(b) != "a\nb\n" { //nolint:gosec // test file
+		t.Errorf("Expected content of matched files, got %q: %v", b, err)
+	}
+}
+
+func TestRunMultiWrite(t *testing.T) {
+	script := `rpack.write("./same.txt", "a\n")
+rpack.write("./same.txt", "a\n")
+rpack.write("./out.txt", "first\n")
+rpack.write_lines("./out.txt", {"second"})
+`
+	config, workDir := setupRunConfig(t, script, "")
+	res, err := Run(t.Context(), api.RunOptions{ConfigFile: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Annotations) != 1 || res.Annotations[0].Path != "out.txt" || !strings.Contains(res.Annotations[0].Message, "script.lua:4, script.lua:5") {
+		t.Errorf("Expected a warning for out.txt only, got %+v", res.Annotations)
+	}
+	if b, err := os.ReadFile(filepath.Join(workDir, "out.txt")); err != nil || string(b) != "second\n" { //nolint:gosec // test file
+		t.Errorf("Expected the last write to win, got %q: %v", b, err)
+	}
+
+	_, err = Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true, Strict: true})
+	if !errors.Is(err, ErrConflictingWrites) || !errors.Is(err, ErrLuaExecution) || !strings.Contains(err.Error(), "out.txt") {
+		t.Fatalf("Expected ErrConflictingWrites for out.txt, got %v", err)
+	}
+}
+
+func TestRunInputChanged(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", rpack.read(rpack.inputs().mapped))\n", "config:\n  inputs:\n    mapped: mapped.txt\n")
+	defFile := filepath.Join(filepath.Dir(workDir), "def", "rpack.yaml")
+	if err := os.WriteFile(defFile, []byte("\"@schema_version\": \"v1\"\nname: \"app\"\ninputs:\n  - {name: mapped, type: file, required: true}\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	input := filepath.Join(workDir, "mapped.txt")
+	if err := os.WriteFile(input, []byte("a\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	// Another process modifies the input after the script read it
+	modified := 0
+	modifyInput := &api.RunHooks{Progress: func(ev *api.ProgressEvent) {
+		if ev.Phase == string(ProgressPhaseChecksum) && !ev.Done {
+			modified++
+			_ = os.WriteFile(input, []byte(strings.Repeat("b", modified)), 0o644) //nolint:gosec // test file
+		}
+	}}
+
+	_, err := Run(t.Context(), api.RunOptions{ConfigFile: config, Hooks: modifyInput})
+	if !errors.Is(err, ErrInputChanged) || !strings.Contains(err.Error(), "map:mapped") {
+		t.Fatalf("Expected ErrInputChanged naming the input, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(workDir, "out.txt")); !os.IsNotExist(err) {
+		t.Error("Changed inputs must not be applied")
+	}
+
+	// Unchanged inputs and forced runs apply
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config, Hooks: modifyInput, Force: true}); err != nil {
+		t.Fatalf("Expected forced run to only warn, got %v", err)
+	}
+}
+
+func TestRunMerge(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"a\\nb\\nc\\n\")\n", "")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(workDir, "out.txt")
+	script := filepath.Join(filepath.Dir(workDir), "def", "script.lua")
+	setScript := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(script, []byte("local rpack = require(\"rpack.v1\")\nrpack.write(\"./out.txt\", \""+content+"\")\n"), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(out, []byte("local\nb\nc\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	setScript("a\\nb\\ngenerated\\n")
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); !errors.Is(err, ErrLockModified) {
+		t.Fatalf("Expected ErrLockModified without merge, got %v", err)
+	}
+	res, err := Run(t.Context(), api.RunOptions{ConfigFile: config, Merge: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(res.Merged, []string{"out.txt"}) || len(res.Conflicts) != 0 {
+		t.Errorf("Expected merged file without conflicts, got %+v", res)
+	}
+	if b, _ := os.ReadFile(out); string(b) != "local\nb\ngenerated\n" { //nolint:gosec // test file
+		t.Errorf("Unexpected merge result: %q", b)
+	}
+
+	// Both sides changing the same line conflict
+	setScript("other\\nb\\ngenerated\\n")
+	res, err = Run(t.Context(), api.RunOptions{ConfigFile: config, Merge: true})
+	if !errors.Is(err, ErrMergeConflict) || !slices.Equal(res.Conflicts, []string{"out.txt"}) {
+		t.Fatalf("Expected ErrMergeConflict, got %v, %+v", err, res)
+	}
+	if b, _ := os.ReadFile(out); string(b) != "<<<<<<< local\nlocal\n=======\nother\n>>>>>>> generated\nb\ngenerated\n" { //nolint:gosec // test file
+		t.Errorf("Unexpected conflict markers: %q", b)
+	}
+}
+
+func TestRunChecksumAlgorithm(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"out\\n\")\n", "")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(workDir, "app"+RPackLockFileSuffix)
+	lock, err := Loader{}.loadRPackLockFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Files[0].Algorithm != "" || lock.Files[0].Sha != sha256Hex([]byte("out\n")) {
+		t.Fatalf("Expected sha256 entry without algorithm, got %+v", lock.Files[0])
+	}
+
+	// Switching the algorithm migrates the sha256 entries on the next run
+	b, err := os.ReadFile(config) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(config, append(b, "checksum_algorithm: xxh64\n"...), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if lock, err = (Loader{}).loadRPackLockFile(lockPath); err != nil {
+		t.Fatal(err)
+	}
+	if sum, _ := checksumBytes(ChecksumXXH64, []byte("out\n")); lock.Files[0].Algorithm != ChecksumXXH64 || lock.Files[0].Sha != sum {
+		t.Fatalf("Expected xxh64 entry, got %+v", lock.Files[0])
+	}
+	if err = (&Checker{}).CheckIntegrity(t.Context(), config); err != nil {
+		t.Errorf("Expected xxh64 lockfile to verify, got %v", err)
+	}
+	if err = os.WriteFile(filepath.Join(workDir, "out.txt"), []byte("mine\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if err = (&Checker{}).CheckIntegrity(t.Context(), config); !errors.Is(err, ErrLockModified) {
+		t.Errorf("Expected ErrLockModified, got %v", err)
+	}
+
+	if err = os.WriteFile(config, append(b, "checksum_algorithm: crc7\n"...), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected ErrValidation for unknown algorithm, got %v", err)
+	}
+}
+
+func TestRunRemoveRename(t *testing.T) {
+	script := `rpack.write("./a.txt", "a\n")
+rpack.write("./draft.txt", "b\n")
+rpack.rename("./draft.txt", "./docs/b.txt")
+rpack.write("./draft.txt", "other\n")
+rpack.remove("./draft.txt")
+rpack.managed_block("./old.cfg", "lint", "x\n")
+rpack.rename("./old.cfg", "./new.cfg")
+rpack.remove("./a.txt")
+`
+	config, workDir := setupRunConfig(t, script, "")
+	res, err := Run(t.Context(), api.RunOptions{ConfigFile: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Annotations) != 0 {
+		t.Errorf("Expected no multi-write warnings, got %+v", res.Annotations)
+	}
+	for name, want := range map[string]string{"docs/b.txt": "b\n", "new.cfg": "# BEGIN rpack lint\nx\n# END rpack lint\n"} {
+		if b, err := os.ReadFile(filepath.Join(workDir, filepath.FromSlash(name))); err != nil || string(b) != want { //nolint:gosec // test file
+			t.Errorf("Unexpected %s: %q, %v", name, b, err)
+		}
+	}
+	for _, name := range []string{"a.txt", "draft.txt", "old.cfg"} {
+		if _, err := os.Stat(filepath.Join(workDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be generated, got %v", name, err)
+		}
+	}
+	lock, err := Loader{}.loadRPackLockFile(filepath.Join(workDir, "app"+RPackLockFileSuffix))
+	if err != nil || len(lock.Files) != 2 {
+		t.Fatalf("Expected lockfile with the renamed files, got %+v, %v", lock, err)
+	}
+}
+
+func TestCheckerStrict(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"v1\\n\")\n", "")
+	if err := (&Executor{}).ExecRPack(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Checker{Strict: true}).CheckIntegrity(t.Context(), config); err != nil {
+		t.Fatalf("Expected an up to date target to pass, got %v", err)
+	}
+
+	// The definition changed, the lockfile still matches the target
+	script := filepath.Join(filepath.Dir(workDir), "def", "script.lua")
+	if err := os.WriteFile(script, []byte("local rpack = require(\"rpack.v1\")\nrpack.write(\"./out.txt\", \"v2\\n\")\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if err := (&Checker{}).CheckIntegrity(t.Context(), config); err != nil {
+		t.Fatalf("Expected the integrity check to pass, got %v", err)
+	}
+	var out strings.Builder
+	err := (&Checker{Strict: true, DiffOutput: &out}).CheckIntegrity(t.Context(), config)
+	if !errors.Is(err, ErrDrift) || !strings.Contains(err.Error(), "out.txt") {
+		t.Fatalf("Expected ErrDrift, got %v", err)
+	}
+	if !strings.Contains(out.String(), "-v1\n+v2\n") {
+		t.Errorf("Expected the diff against the generated content, got:\n%s", out.String())
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "v1\n" { //nolint:gosec // test file
+		t.Errorf("Expected the target to be untouched, got %q", b)
+	}
+}
+
+func TestRunEntryScripts(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"default\\n\")\n", "script: migrate\n")
+	defDir := filepath.Join(filepath.Dir(workDir), "def")
+	for name, content := range map[string]string{
+		"rpack.yaml":        "\"@schema_version\": \"v1\"\nname: \"app\"\nscripts:\n  - name: migrate\n    file: tasks/migrate.lua\n",
+		"tasks/migrate.lua": "local rpack = require(\"rpack.v1\")\nrpack.write(\"./out.txt\", \"migrated\\n\")\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(defDir, name)), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(defDir, name), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	read := func() string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(workDir, "out.txt")) //nolint:gosec // test file
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != "migrated\n" {
+		t.Errorf("Expected the script of the config to run, got %q", got)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, Script: "other"}); !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), "available: migrate") {
+		t.Errorf("Expected an undeclared script to fail, got %v", err)
+	}
+
+	// script.lua is optional once scripts are declared, but then a script needs to be selected
+	if err := os.Remove(filepath.Join(defDir, "script.lua")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config, []byte("\"@schema_version\": \"v1\"\nsource: \""+filepath.ToSlash(defDir)+"\"\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), "--script") {
+		t.Errorf("Expected a missing selection to fail, got %v", err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, Script: "migrate"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors name the file of the script
+	if err := os.WriteFile(filepath.Join(defDir, "tasks", "migrate.lua"), []byte("\nerror(\"boom\")\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, Script: "migrate"}); err == nil || !strings.Contains(err.Error(), "tasks/migrate.lua:2") {
+		t.Errorf("Expected the error to name the script, got %v", err)
+	}
+}
+
+func TestExecRPackDirectExecPath(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"new\\n\")\n", "")
+	defDir := filepath.Join(filepath.Dir(filepath.Dir(config)), "def")
+	if err := os.WriteFile(filepath.Join(workDir, "out.txt"), []byte("old\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+	e := &Executor{DryRun: true, OverrideExecPath: workDir, PlanFile: planFile, Logger: slog.New(slog.DiscardHandler)}
+	if err := e.ExecRPackDirect(t.Context(), defDir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(planFile) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan Plan
+	if err = json.Unmarshal(b, &plan); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 1 || plan.Files[0].Action != PlanActionModify {
+		t.Fatalf("Expected the plan to modify out.txt of the execution path, got %s", b)
+	}
+
+	renderer := &recordingDiffRenderer{}
+	e = &Executor{DryRun: true, OverrideExecPath: workDir, DiffRenderer: renderer, Logger: slog.New(slog.DiscardHandler)}
+	if err = e.ExecRPackDirect(t.Context(), defDir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(renderer.files) != 1 || renderer.files[0].Action != PlanActionModify || string(renderer.files[0].Old) != "old\n" {
+		t.Fatalf("Expected the diff against out.txt of the execution path, got %+v", renderer.files)
+	}
+
+	e = &Executor{OverrideExecPath: workDir, Logger: slog.New(slog.DiscardHandler)}
+	if err = e.ExecRPackDirect(t.Context(), defDir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = os.ReadFile(filepath.Join(workDir, "out.txt")); err != nil || string(b) != "new\n" { //nolint:gosec // test file
+		t.Errorf("Expected out.txt written to the execution path, got %q, %v", b, err)
+	}
+}
+
+// recordingDiffRenderer records the rendered files.
+type recordingDiffRenderer struct {
+	files []*DiffFile
+}
+
+func (r *recordingDiffRenderer) Render(_ context.Context, _ io.Writer, f *DiffFile) error {
+	r.files = append(r.files, f)
+	return nil
+}
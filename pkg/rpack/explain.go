@@ -0,0 +1,177 @@
+package rpack
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/blang/rpack/pkg/lockfile"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// ExplainStatus is the state of a managed file compared to its lockfile entry.
+type ExplainStatus string
+
+// States of managed files.
+const (
+	// ExplainUnchanged is a file matching the recorded checksum
+	ExplainUnchanged ExplainStatus = "unchanged"
+	// ExplainModified is a file modified outside of rpack
+	ExplainModified ExplainStatus = "modified"
+	// ExplainMissing is a file removed outside of rpack
+	ExplainMissing ExplainStatus = "missing"
+)
+
+// Explanation describes the config managing a target file.
+type Explanation struct {
+	// Path of the file relative to the config, slash separated like in the lockfile
+	Path       string
+	ConfigFile string
+	LockFile   string
+	// Pack that wrote the file, empty for single source configs
+	Pack string
+	// Source of the definition generating the file, empty if the config no longer has the pack
+	Source string
+	// Checksum recorded in the lockfile and its algorithm
+	Checksum  string
+	Algorithm string
+	// Blocks are the markers of the managed blocks if rpack manages only parts of the file
+	Blocks []string
+	Status ExplainStatus
+	// Diff from the content rpack generated to the file if it drifted and the baseline is stored, optional
+	Diff string
+}
+
+// Explain finds the configs whose lockfiles manage the file name. The directory of the file and its
+// parents up to the repository root are searched, a file managed by several configs has several explanations.
+// Explain fails if no lockfile manages the file.
+func Explain(name string) ([]*Explanation, error) {
+	return Loader{}.Explain(name)
+}
+
+// Explain is Explain decoding configs and lockfiles with the options of l.
+func (l Loader) Explain(name string) ([]*Explanation, error) {
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not construct absolute path for file %s: %w", name, err)
+	}
+	var explanations []*Explanation
+	for d := filepath.Dir(absName); ; {
+		configs, err := filepath.Glob(filepath.Join(d, "*"+RPackFileSuffix))
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(d, absName)
+		if err != nil {
+			return nil, err
+		}
+		for _, config := range configs {
+			ex, err := l.explainConfig(config, filepath.ToSlash(rel))
+			if err != nil {
+				return nil, err
+			}
+			if ex != nil {
+				explanations = append(explanations, ex)
+			}
+		}
+		if exists, _ := util.FileExists(filepath.Join(d, ".git")); exists {
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	if len(explanations) == 0 {
+		return nil, fmt.Errorf("%s is not managed by an rpack config in its directory or the parent directories", name)
+	}
+	return explanations, nil
+}
+
+// explainConfig explains relPath with the lockfile of the config, nil if the lockfile does not manage it.
+// Only configs managing the file are loaded, invalid configs elsewhere in the tree do not matter.
+func (l Loader) explainConfig(configFile, relPath string) (*Explanation, error) {
+	dir := filepath.Dir(configFile)
+	lockFile := filepath.Join(dir, strings.TrimSuffix(filepath.Base(configFile), RPackFileSuffix)+RPackLockFileSuffix)
+	if exists, _ := util.FileExists(lockFile); !exists {
+		return nil, nil
+	}
+	lock, err := l.loadRPackLockFileOrNew(lockFile, slog.Default())
+	if err != nil {
+		return nil, err
+	}
+	var entry *RPackLockFileFile
+	for _, f := range lock.Files {
+		if f.Path == relPath {
+			entry = f
+			break
+		}
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	ex := &Explanation{
+		Path:       relPath,
+		ConfigFile: configFile,
+		LockFile:   lockFile,
+		Pack:       entry.Pack,
+		Checksum:   entry.Sha,
+		Algorithm:  entry.Algorithm,
+		Blocks:     entry.Blocks,
+		Status:     ExplainUnchanged,
+	}
+	if ex.Algorithm == "" {
+		ex.Algorithm = lockfile.SHA256
+	}
+	config, err := l.loadRPackFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load rpack config %s managing %s: %w", configFile, relPath, err)
+	}
+	for _, pack := range config.PackList() {
+		if pack.Name == entry.Pack {
+			ex.Source = pack.Source
+		}
+	}
+
+	single := &RPackLockFile{SchemaVersion: lock.SchemaVersion, Files: []*RPackLockFileFile{entry}}
+	integrity, err := single.CheckIntegrity(dir)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(integrity.Removed) > 0:
+		ex.Status = ExplainMissing
+	case len(integrity.Modified) > 0:
+		ex.Status = ExplainModified
+	default:
+		return ex, nil
+	}
+	diffs, err := baselineDiffs(newBaselineStore(dir), dir, single, []string{relPath})
+	if err != nil {
+		return nil, err
+	}
+	ex.Diff = diffs[relPath]
+	return ex, nil
+}
+
+// String formats the explanation for the CLI, without the diff.
+func (ex *Explanation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s is managed by %s\n", ex.Path, ex.ConfigFile)
+	if ex.Pack != "" {
+		fmt.Fprintf(&sb, "  pack:     %s\n", ex.Pack)
+	}
+	if ex.Source != "" {
+		fmt.Fprintf(&sb, "  source:   %s\n", ex.Source)
+	}
+	fmt.Fprintf(&sb, "  lockfile: %s\n", ex.LockFile)
+	fmt.Fprintf(&sb, "  checksum: %s:%s\n", ex.Algorithm, ex.Checksum)
+	if len(ex.Blocks) > 0 {
+		fmt.Fprintf(&sb, "  blocks:   %s\n", strings.Join(ex.Blocks, ", "))
+	}
+	fmt.Fprintf(&sb, "  status:   %s\n", ex.Status)
+	return sb.String()
+}
@@ -0,0 +1,46 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestExplain(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./sub/out.txt\", \"hello\\n\")\n", "")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(workDir, "sub", "out.txt")
+	exs, err := Explain(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exs) != 1 || exs[0].Path != "sub/out.txt" || exs[0].ConfigFile != config || exs[0].Status != ExplainUnchanged || exs[0].Algorithm != "sha256" {
+		t.Fatalf("Unexpected explanation: %+v", exs)
+	}
+	if !strings.Contains(exs[0].String(), "source:   "+filepath.ToSlash(filepath.Join(filepath.Dir(workDir), "def"))) {
+		t.Errorf("Expected the source of the definition, got:\n%s", exs[0])
+	}
+
+	// Drift is reported with the diff to the generated content
+	if err = os.WriteFile(out, []byte("changed\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if exs, err = Explain(out); err != nil || exs[0].Status != ExplainModified || !strings.Contains(exs[0].Diff, "-hello\n+changed\n") {
+		t.Fatalf("Expected modified file with diff, got %+v, %v", exs, err)
+	}
+	if err = os.Remove(out); err != nil {
+		t.Fatal(err)
+	}
+	if exs, err = Explain(out); err != nil || exs[0].Status != ExplainMissing {
+		t.Fatalf("Expected missing file, got %+v, %v", exs, err)
+	}
+
+	if _, err = Explain(config); err == nil || !strings.Contains(err.Error(), "is not managed") {
+		t.Errorf("Expected unmanaged file to fail, got %v", err)
+	}
+}
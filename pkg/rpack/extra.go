@@ -0,0 +1,102 @@
+package rpack
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// ExtraFSResolverPrefix is the prefix for reading the extra directories and files mapped by the config.
+const ExtraFSResolverPrefix = "extra:"
+
+// resolveRPackExtras resolves the extra paths of a config in configPath to absolute paths, see RPackConfig.Extra.
+// Extras whose path does not exist are returned without a type, they only fail the packs requiring them.
+// Extras must not overlap the target execPath, scripts could read target files past allow_target_read otherwise.
+func resolveRPackExtras(configExtras map[string]string, configPath, execPath string) ([]*RPackResolvedInput, error) {
+	absExecPath, err := filepath.Abs(execPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve target directory: %s: %w", execPath, err)
+	}
+	var extras []*RPackResolvedInput
+	for _, name := range slices.Sorted(maps.Keys(configExtras)) {
+		userPath := configExtras[name]
+		absPath, err := extraAbsPath(userPath, configPath)
+		if err != nil {
+			return nil, fmt.Errorf("extra %s=%s: %w", name, userPath, err)
+		}
+		if abs, err := filepath.Abs(absPath); err == nil && (pathContains(absExecPath, abs) || pathContains(abs, absExecPath)) {
+			return nil, fmt.Errorf("extra %s=%s overlaps the target directory, map paths inside the target as inputs: %w", name, userPath, ErrValidation)
+		}
+		extra := &RPackResolvedInput{Name: name, UserPath: userPath, ResolvedPath: absPath}
+		if isDir, err := util.CheckFileOrDirExists(absPath); err == nil {
+			extra.Type = RPackInputTypeFile
+			if isDir {
+				extra.Type = RPackInputTypeDirectory
+			}
+		}
+		extras = append(extras, extra)
+	}
+	return extras, nil
+}
+
+// extraAbsPath returns the absolute path of an extra, relative paths are relative to configPath
+// and a leading ~/ is the home directory of the user.
+func extraAbsPath(userPath, configPath string) (string, error) {
+	p := filepath.FromSlash(userPath)
+	if userPath == "~" || strings.HasPrefix(userPath, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine the home directory: %w", err)
+		}
+		p = filepath.Join(home, filepath.FromSlash(strings.TrimPrefix(userPath[1:], "/")))
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(configPath, p)
+	}
+	return filepath.Clean(p), nil
+}
+
+// pathContains reports if the absolute path p is dir or below dir.
+func pathContains(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// validateRPackExtras checks the extras of the config against the ones declared by the definition.
+// It returns the extras the script may read, optional extras the config does not map or whose path
+// does not exist are left out. Extras of the config the definition does not declare are ignored,
+// the config shares them between all packs.
+func validateRPackExtras(extras []*RPackResolvedInput, defExtras []*RPackDefExtra) ([]*RPackResolvedInput, []error) {
+	var declared []*RPackResolvedInput
+	var errs []error
+	for _, defExtra := range defExtras {
+		idx := slices.IndexFunc(extras, func(extra *RPackResolvedInput) bool { return extra.Name == defExtra.Name })
+		if idx < 0 {
+			if defExtra.Required {
+				errs = append(errs, fmt.Errorf("required extra %s is not mapped by the config: %w", defExtra.Name, ErrInputValidation))
+			}
+			continue
+		}
+		extra := extras[idx]
+		switch {
+		case extra.Type == "":
+			if defExtra.Required {
+				errs = append(errs, fmt.Errorf("required extra %s=%s does not exist: %w", extra.Name, extra.UserPath, ErrInputValidation))
+			}
+			continue
+		case defExtra.Type == RPackDefInputTypeFile && extra.Type != RPackInputTypeFile:
+			errs = append(errs, fmt.Errorf("definition for extra %s requires type file, but found directory: %w", extra.Name, ErrInputValidation))
+			continue
+		case defExtra.Type == RPackDefInputTypeDirectory && extra.Type != RPackInputTypeDirectory:
+			errs = append(errs, fmt.Errorf("definition for extra %s requires type directory, but found file: %w", extra.Name, ErrInputValidation))
+			continue
+		}
+		declared = append(declared, extra)
+	}
+	return declared, errs
+}
@@ -0,0 +1,123 @@
+package rpack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// setupExtraConfig sets up a config mapping the extras in configExtra, the definition declares defExtra.
+func setupExtraConfig(t *testing.T, script, defExtra, configExtra string) (config, workDir string) {
+	t.Helper()
+	config, workDir = setupRunConfig(t, script, configExtra)
+	def := "\"@schema_version\": \"v1\"\nname: \"app\"\n" + defExtra
+	if err := os.WriteFile(filepath.Join(filepath.Dir(workDir), "def", "rpack.yaml"), []byte(def), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	shared := filepath.Join(filepath.Dir(workDir), "shared")
+	if err := os.MkdirAll(filepath.Join(shared, "license"), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(shared, "license", "MIT.txt"), []byte("MIT License\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	return config, workDir
+}
+
+func TestRunExtra(t *testing.T) {
+	defExtra := "extra:\n  - name: templates\n    type: dir\n    required: true\n"
+	t.Run("read", func(t *testing.T) {
+		config, workDir := setupExtraConfig(t, "rpack.write(\"./LICENSE\", rpack.read(\"extra:templates/license/MIT.txt\"))\n", defExtra, "extra:\n  templates: ../shared\n")
+		if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(filepath.Join(workDir, "LICENSE"))
+		if err != nil || string(b) != "MIT License\n" {
+			t.Errorf("Expected the extra copied to the target, got %q, %v", b, err)
+		}
+	})
+	t.Run("absolute path", func(t *testing.T) {
+		config, workDir := setupExtraConfig(t, "rpack.write(\"./LICENSE\", rpack.read(\"extra:templates/license/MIT.txt\"))\n", defExtra, "")
+		shared := filepath.ToSlash(filepath.Join(filepath.Dir(workDir), "shared"))
+		f, err := os.OpenFile(config, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.WriteString("extra:\n  templates: \"" + shared + "\"\n"); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+		if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	for _, tc := range []struct {
+		name, script, configExtra, wantErr string
+	}{
+		{name: "write", script: "rpack.write(\"extra:templates/x.txt\", \"x\")\n", configExtra: "extra:\n  templates: ../shared\n", wantErr: "extras are read-only"},
+		{name: "undeclared", script: "rpack.read(\"extra:other/x.txt\")\n", configExtra: "extra:\n  templates: ../shared\n  other: ../shared\n", wantErr: "extra other of extra:other/x.txt is not declared by the definition"},
+		{name: "escape", script: "rpack.read(\"extra:templates/../../work/app.rpack.yaml\")\n", configExtra: "extra:\n  templates: ../shared\n", wantErr: "extra:templates/../../work/app.rpack.yaml"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, _ := setupExtraConfig(t, tc.script, defExtra, tc.configExtra)
+			_, err := Run(t.Context(), api.RunOptions{ConfigFile: config})
+			if !errors.Is(err, ErrLuaExecution) || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Expected script error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRunExtraValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name, defExtra, configExtra, wantErr string
+	}{
+		{name: "not mapped", defExtra: "extra:\n  - name: templates\n    type: dir\n    required: true\n", wantErr: "required extra templates is not mapped"},
+		{name: "missing path", defExtra: "extra:\n  - name: templates\n    type: dir\n    required: true\n", configExtra: "extra:\n  templates: ../nope\n", wantErr: "required extra templates=../nope does not exist"},
+		{name: "type", defExtra: "extra:\n  - name: templates\n    type: file\n", configExtra: "extra:\n  templates: ../shared\n", wantErr: "requires type file, but found directory"},
+		{name: "target", defExtra: "extra:\n  - name: templates\n    type: dir\n", configExtra: "extra:\n  templates: .\n", wantErr: "extra templates=. overlaps the target directory"},
+		{name: "target parent", defExtra: "extra:\n  - name: templates\n    type: dir\n", configExtra: "extra:\n  templates: ..\n", wantErr: "extra templates=.. overlaps the target directory"},
+		{name: "permissions", defExtra: "extra:\n  - name: templates\n    type: dir\npermissions:\n  write_target: true\n", configExtra: "extra:\n  templates: ../shared\n", wantErr: "extra needs permissions.read_inputs"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, _ := setupExtraConfig(t, "", tc.defExtra, tc.configExtra)
+			_, err := Run(t.Context(), api.RunOptions{ConfigFile: config})
+			if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Expected validation error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("optional missing", func(t *testing.T) {
+		config, _ := setupExtraConfig(t, "assert(not pcall(rpack.read, \"extra:templates/license/MIT.txt\"))\n",
+			"extra:\n  - name: templates\n    type: dir\n", "extra:\n  templates: ../nope\n")
+		if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestExtraAbsPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	configPath := filepath.FromSlash("/work/repo")
+	tests := map[string]string{
+		"../shared":         filepath.FromSlash("/work/shared"),
+		"templates":         filepath.FromSlash("/work/repo/templates"),
+		"~/templates/go":    filepath.Join(home, "templates", "go"),
+		"~":                 home,
+		filepath.Join(home): home,
+	}
+	for userPath, want := range tests {
+		got, err := extraAbsPath(userPath, configPath)
+		if err != nil || got != want {
+			t.Errorf("extraAbsPath(%q) = %q, %v, expected %q", userPath, got, err, want)
+		}
+	}
+}
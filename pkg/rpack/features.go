@@ -0,0 +1,79 @@
+package rpack
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/blang/rpack/pkg/rpack/getsource"
+)
+
+// Optional features with heavyweight dependencies. Each is compiled in by default
+// and can be left out with the build tag rpack_no<feature>, e.g. -tags rpack_nocue,rpack_nojq,
+// to build a slim binary or embed rpack without the dependencies.
+const (
+	// FeatureCUE supports schema.cue in definitions, without it internal schemas use JSON Schema
+	FeatureCUE = "cue"
+	// FeatureJQ provides rpack.jq
+	FeatureJQ = "jq"
+	// FeatureGCS fetches sources from Google Cloud Storage
+	FeatureGCS = "gcs"
+	// FeatureS3 fetches sources from Amazon S3
+	FeatureS3 = "s3"
+)
+
+// optionalFeatures lists all optional features.
+var optionalFeatures = []string{FeatureCUE, FeatureJQ, FeatureGCS, FeatureS3}
+
+// sourceFeatures are the optional features named after the source protocol they fetch,
+// getsource registers their getters depending on the same build tags.
+var sourceFeatures = []string{FeatureGCS, FeatureS3}
+
+func init() {
+	for _, f := range sourceFeatures {
+		if slices.Contains(getsource.Protocols(), f) {
+			registerFeature(f)
+		}
+	}
+}
+
+// ErrFeatureDisabled is returned when using a feature the binary was built without.
+var ErrFeatureDisabled = errors.New("feature not included in this build")
+
+// features lists the optional features compiled in, registered by the init functions of the feature files.
+var features []string
+
+func registerFeature(name string) {
+	features = append(features, name)
+}
+
+// featureDisabledError describes the build tag that removed feature.
+func featureDisabledError(feature string) error {
+	return fmt.Errorf("%w: %s, rpack was built with the rpack_no%s tag", ErrFeatureDisabled, feature, feature)
+}
+
+// checkSourceFeature fails if the protocol of a normalized source is an optional feature left out of this build.
+func checkSourceFeature(normalized string) error {
+	protocol := getsource.SourceProtocol(normalized)
+	if slices.Contains(sourceFeatures, protocol) && !slices.Contains(features, protocol) {
+		return featureDisabledError(protocol)
+	}
+	return nil
+}
+
+// Features returns the sorted optional features included in this build.
+func Features() []string {
+	return slices.Sorted(slices.Values(features))
+}
+
+// DisabledFeatures returns the sorted optional features left out of this build.
+func DisabledFeatures() []string {
+	var disabled []string
+	for _, f := range optionalFeatures {
+		if !slices.Contains(features, f) {
+			disabled = append(disabled, f)
+		}
+	}
+	slices.Sort(disabled)
+	return disabled
+}
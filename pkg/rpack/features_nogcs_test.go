@@ -0,0 +1,17 @@
+//go:build rpack_nogcs
+
+package rpack
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSourceFeatureDisabledGCS(t *testing.T) {
+	if err := checkSourceFeature("gcs::https://www.googleapis.com/storage/v1/bucket/def.tgz"); !errors.Is(err, ErrFeatureDisabled) {
+		t.Errorf("Expected ErrFeatureDisabled, got %v", err)
+	}
+	if err := checkSourceFeature("git::https://github.com/blang/rpack.git"); err != nil {
+		t.Errorf("Expected git sources to be available, got %v", err)
+	}
+}
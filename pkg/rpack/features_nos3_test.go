@@ -0,0 +1,17 @@
+//go:build rpack_nos3
+
+package rpack
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSourceFeatureDisabledS3(t *testing.T) {
+	if err := checkSourceFeature("s3::https://s3.amazonaws.com/bucket/def.tgz"); !errors.Is(err, ErrFeatureDisabled) {
+		t.Errorf("Expected ErrFeatureDisabled, got %v", err)
+	}
+	if err := checkSourceFeature("git::https://github.com/blang/rpack.git"); err != nil {
+		t.Errorf("Expected git sources to be available, got %v", err)
+	}
+}
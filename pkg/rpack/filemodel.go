@@ -1,14 +1,21 @@
 package rpack
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"log/slog"
 
 	"github.com/oleiade/lane/v2"
+
+	"github.com/blang/rpack/pkg/lockfile"
 )
 
 // Filesystem resolver names.
@@ -16,8 +23,16 @@ const (
 	RPackResolver string = "rpack"
 	TempResolver  string = "temp"
 	MapResolver   string = "map"
+	// SecretResolver reads the secrets declared by the config
+	SecretResolver string = "secret"
+	// HTTPResolver fetches URLs the definition declares in permissions.http
+	HTTPResolver string = "http"
 	// TargetResolver maps to the rpack target
 	TargetResolver string = "target"
+	// DepResolver reads the outputs of the dependencies of a definition
+	DepResolver string = "dep"
+	// ExtraResolver reads the extra directories and files mapped by the config
+	ExtraResolver string = "extra"
 )
 
 // RPackFS represents the rpack filesystem.
@@ -27,6 +42,13 @@ type RPackFS struct {
 	*BaseFS
 	PureCheck *EnsurePure
 	recorder  *FSRecorder
+	inputs    *inputSnapshot
+	// rewritten are the checksums of target files changed after the script, e.g. by the line ending conversion
+	rewritten map[string]string
+	// blocks are the markers of the managed blocks written to target files, see WriteBlock
+	blocks map[string][]string
+	// binary are the target files written with WriteBinary, their content is kept exactly
+	binary map[string]struct{}
 }
 
 // Check if RPackFS satisfies FS interface
@@ -44,13 +66,21 @@ var TargetTransferHandleFilterFn = HandleFilterFn(func(typ FSAccessType, h FSHan
 })
 
 // NewRPackFS creates a new RPackFS instance.
-// TODO: execPath not used
-func NewRPackFS(enforcePure bool, defSourcePath, runPath, tempPath, execPath string, resolvedInputs []*RPackResolvedInput) *RPackFS {
+// Target paths matching allowTargetRead can be read from execPath,
+// all other target access is limited to writes into runPath.
+func NewRPackFS(enforcePure bool, defSourcePath, runPath, tempPath, execPath string, resolvedInputs []*RPackResolvedInput, allowTargetRead []string) *RPackFS {
+	perms := &RPackDefPermissions{ReadInputs: true, WriteTarget: true, TargetReadPaths: allowTargetRead}
+	return NewRPackFSWithPermissions(enforcePure, defSourcePath, runPath, tempPath, execPath, resolvedInputs, perms)
+}
+
+// NewRPackFSWithPermissions creates a new RPackFS instance limited to the permissions of a definition,
+// see RPackDef.EffectivePermissions.
+func NewRPackFSWithPermissions(enforcePure bool, defSourcePath, runPath, tempPath, execPath string, resolvedInputs []*RPackResolvedInput, perms *RPackDefPermissions) *RPackFS {
 	resolvers := []FSResolver{
 		NewFileBackedFSResolver(RPackResolver, "rpack:", defSourcePath),
 		NewFileBackedFSResolver(TempResolver, "temp:", tempPath),
 		NewMapFSResolver(MapResolver, MapFSResolverPrefix, resolvedInputs),
-		NewFileBackedFSResolver(TargetResolver, "", runPath),
+		NewTargetFSResolver(TargetResolver, "", runPath, execPath),
 	}
 
 	var pureCheck *EnsurePure
@@ -59,10 +89,13 @@ func NewRPackFS(enforcePure bool, defSourcePath, runPath, tempPath, execPath str
 	}
 
 	recorder := NewFSRecorder(nil)
+	inputs := newInputSnapshot()
 	hooks := []FSAccessHook{
-		&RPackAccessControlFSHook{},
+		&RPackPermissionFSHook{Permissions: perms},
+		&RPackAccessControlFSHook{AllowTargetRead: perms.TargetReadPaths},
 		pureCheck,
 		recorder,
+		inputs,
 	}
 
 	return &RPackFS{
@@ -72,6 +105,7 @@ func NewRPackFS(enforcePure bool, defSourcePath, runPath, tempPath, execPath str
 		},
 		PureCheck: pureCheck,
 		recorder:  recorder,
+		inputs:    inputs,
 	}
 }
 
@@ -79,38 +113,197 @@ func NewRPackFS(enforcePure bool, defSourcePath, runPath, tempPath, execPath str
 func (fs *RPackFS) Check() error {
 	if fs.PureCheck != nil {
 		if err := fs.PureCheck.CheckConflicts(); err != nil {
-			return fmt.Errorf("pure fileaccess check failed: %w: %w", ErrPurityCheck, err)
+			return fmt.Errorf("pure fileaccess check failed: %w: %w", ErrPurityViolation, err)
 		}
 	}
 	return nil
 }
 
+// setLogger passes log to the resolvers logging, see TargetFSResolver.Logger.
+func (fs *RPackFS) setLogger(log *slog.Logger) {
+	for _, r := range fs.Resolvers {
+		if t, ok := r.(*TargetFSResolver); ok {
+			t.Logger = log
+		}
+	}
+}
+
+// setChecksumAlgorithm makes target handles record checksums with the lockfile checksum
+// algorithm while writing, see targetAlgorithmChecksums. Nothing is recorded for sha256.
+func (fs *RPackFS) setChecksumAlgorithm(algorithm string) {
+	if algorithm == lockfile.SHA256 {
+		algorithm = ""
+	}
+	for _, r := range fs.Resolvers {
+		if t, ok := r.(*TargetFSResolver); ok {
+			t.algorithm = algorithm
+		}
+	}
+}
+
 // Recorder returns the filesystem recorder.
 func (fs *RPackFS) Recorder() *FSRecorder {
 	return fs.recorder
 }
 
+// ChangedInputs returns the input files whose content changed since the script read them, sorted.
+func (fs *RPackFS) ChangedInputs() []string {
+	return fs.inputs.changed()
+}
+
 // TargetWriteHandles return all FSHandles that were written
-// in the process to the target.
+// in the process to the target. Writes of files removed or renamed afterwards are left out.
 func (fs *RPackFS) TargetWriteHandles() []FSHandle {
 	var handles []FSHandle
 	for _, record := range fs.recorder.Records() {
 		if TargetTransferHandleFilterFn(record.Typ, record.Handle) {
 			handles = append(handles, record.Handle)
 		}
+		if record.Typ == FSAccessTypeRemove && record.Handle.Resolver() == TargetResolver {
+			removed := record.Handle.IndirectTargetPath()
+			handles = slices.DeleteFunc(handles, func(h FSHandle) bool {
+				return h.IndirectTargetPath() == removed
+			})
+		}
 	}
 	return handles
 }
 
+// Write writes a file, a target file written with WriteBinary before is text again.
+func (fs *RPackFS) Write(name string, b []byte) error {
+	if err := fs.BaseFS.Write(name, b); err != nil {
+		return err
+	}
+	if len(fs.binary) > 0 {
+		if relPath, ok := fs.TargetPath(name); ok {
+			delete(fs.binary, relPath)
+		}
+	}
+	return nil
+}
+
+// WriteBinary writes a file like Write. Target files keep the content exactly,
+// line endings are not converted according to .gitattributes.
+func (fs *RPackFS) WriteBinary(name string, b []byte) error {
+	if err := fs.BaseFS.Write(name, b); err != nil {
+		return err
+	}
+	if relPath, ok := fs.TargetPath(name); ok {
+		if fs.binary == nil {
+			fs.binary = make(map[string]struct{})
+		}
+		fs.binary[relPath] = struct{}{}
+	}
+	return nil
+}
+
+// binaryTarget reports if the target file relPath was written with WriteBinary.
+func (fs *RPackFS) binaryTarget(relPath string) bool {
+	_, ok := fs.binary[relPath]
+	return ok
+}
+
+// Remove removes a file, the managed blocks of a removed target file are forgotten.
+func (fs *RPackFS) Remove(name string) error {
+	if err := fs.BaseFS.Remove(name); err != nil {
+		return err
+	}
+	if relPath, ok := fs.TargetPath(name); ok {
+		delete(fs.blocks, relPath)
+		delete(fs.binary, relPath)
+	}
+	return nil
+}
+
+// Rename moves a file, the managed blocks and the binary mark of a target file move along.
+func (fs *RPackFS) Rename(from, to string) error {
+	if err := fs.BaseFS.Rename(from, to); err != nil {
+		return err
+	}
+	src, ok := fs.TargetPath(from)
+	if !ok {
+		return nil
+	}
+	dst, isTarget := fs.TargetPath(to)
+	if markers, ok := fs.blocks[src]; ok {
+		delete(fs.blocks, src)
+		if isTarget {
+			fs.blocks[dst] = markers
+		}
+	}
+	if fs.binaryTarget(src) {
+		delete(fs.binary, src)
+		if isTarget {
+			fs.binary[dst] = struct{}{}
+		}
+	} else if isTarget {
+		delete(fs.binary, dst)
+	}
+	return nil
+}
+
+// TargetWriteChecksums returns the checksums of the target files recorded while writing,
+// keyed by their indirect target path. The last write of a file counts, files whose
+// last write recorded no checksum are left out and have to be hashed from the run directory.
+func (fs *RPackFS) TargetWriteChecksums() map[string]string {
+	sums := make(map[string]string)
+	for _, handle := range fs.TargetWriteHandles() {
+		relPath := handle.IndirectTargetPath()
+		if sha, ok := handle.Checksum(); ok {
+			sums[relPath] = sha
+		} else {
+			delete(sums, relPath)
+		}
+	}
+	for relPath, sha := range fs.rewritten {
+		sums[relPath] = sha
+	}
+	return sums
+}
+
+// targetAlgorithmChecksums returns the checksums with the algorithm of setChecksumAlgorithm
+// recorded while writing, keyed by their indirect target path. Like TargetWriteChecksums files
+// without one are left out, as are linked files and files rewritten after the script.
+func (fs *RPackFS) targetAlgorithmChecksums() map[string]string {
+	sums := make(map[string]string)
+	for _, handle := range fs.TargetWriteHandles() {
+		relPath := handle.IndirectTargetPath()
+		if h, ok := handle.(interface{ algorithmChecksum() (string, bool) }); ok {
+			if sum, ok := h.algorithmChecksum(); ok {
+				sums[relPath] = sum
+				continue
+			}
+		}
+		delete(sums, relPath)
+	}
+	for relPath := range fs.rewritten {
+		delete(sums, relPath)
+	}
+	return sums
+}
+
+// setRewrittenChecksum records the checksum of a target file rewritten after the script.
+func (fs *RPackFS) setRewrittenChecksum(relPath, sha string) {
+	if fs.rewritten == nil {
+		fs.rewritten = make(map[string]string)
+	}
+	fs.rewritten[relPath] = sha
+}
+
 // FS represents a filesystem and all operations on individual files
 // are abstracted through this FS object.
 // TODO: Probably needs something like os.Open or os.OpenFile that returns a io.Reader or Writer to implement file copy efficiently
 type FS interface {
 	Write(name string, b []byte) error
+	Append(name string, b []byte) error
+	Patch(name string, diff string) error
 	Read(name string) ([]byte, error)
+	Open(name string) (io.ReadCloser, error)
 	Stat(name string) (exists, dir bool, err error)
 	ReadDir(name string) (_files, _dirs []string, _err error)
 	ReadDirAll(name string) (_files, _dirs []string, _err error)
+	Remove(name string) error
+	Rename(from, to string) error
 }
 
 // InMemoryFS is used for debugging purposes only.
@@ -151,6 +344,26 @@ func (fs *InMemoryFS) Write(name string, b []byte) error {
 	copy(entry.Content, b)
 	return nil
 }
+
+// Append appends to a file, creating it if it does not exist.
+func (fs *InMemoryFS) Append(name string, b []byte) error {
+	old, _ := fs.Read(name)
+	return fs.Write(name, append(old, b...))
+}
+
+// Patch applies a unified diff to a file.
+func (fs *InMemoryFS) Patch(name string, diff string) error {
+	old, err := fs.Read(name)
+	if err != nil {
+		return err
+	}
+	b, err := ApplyUnifiedDiff(old, diff)
+	if err != nil {
+		return fmt.Errorf("could not patch %s: %w", name, err)
+	}
+	return fs.Write(name, b)
+}
+
 func (fs *InMemoryFS) Read(name string) ([]byte, error) {
 	if _, ok := fs.Tree[name]; !ok {
 		return nil, fmt.Errorf("file %s does not exist: %w", name, os.ErrNotExist)
@@ -164,6 +377,43 @@ func (fs *InMemoryFS) Read(name string) ([]byte, error) {
 	return b, nil
 }
 
+// Remove removes a file.
+func (fs *InMemoryFS) Remove(name string) error {
+	entry, ok := fs.Tree[name]
+	if !ok {
+		return fmt.Errorf("file %s does not exist: %w", name, os.ErrNotExist)
+	}
+	if entry.IsDir {
+		return fmt.Errorf("%s is directory", name)
+	}
+	delete(fs.Tree, name)
+	return nil
+}
+
+// Rename moves a file, replacing the file at to.
+func (fs *InMemoryFS) Rename(from, to string) error {
+	b, err := fs.Read(from)
+	if err != nil {
+		return err
+	}
+	if err = fs.Write(to, b); err != nil {
+		return err
+	}
+	if from != to {
+		delete(fs.Tree, from)
+	}
+	return nil
+}
+
+// Open returns a reader over a copy of the file content.
+func (fs *InMemoryFS) Open(name string) (io.ReadCloser, error) {
+	b, err := fs.Read(name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
 // Stat returns file existence and directory status.
 func (fs *InMemoryFS) Stat(name string) (exists, dir bool, err error) {
 	if _, ok := fs.Tree[name]; !ok {
@@ -209,30 +459,140 @@ func (fs *BaseFS) resolve(name string) (FSHandle, error) {
 	return nil, fmt.Errorf("could not resolve filename %q", name)
 }
 
+// TargetPath returns the path of name relative to the target, false if name is not a target file.
+func (fs *BaseFS) TargetPath(name string) (string, bool) {
+	handle, err := fs.resolve(name)
+	if err != nil || handle.Resolver() != TargetResolver {
+		return "", false
+	}
+	return handle.IndirectTargetPath(), true
+}
+
 func (fs *BaseFS) Write(name string, b []byte) error {
 	handle, err := fs.resolve(name)
 	if err != nil {
 		return err
 	}
-	for _, hook := range fs.Hooks {
-		if err := hook.Write(handle); err != nil {
-			return err
-		}
+	if err := fs.checkAccess(FSAccessTypeWrite, handle); err != nil {
+		return err
+	}
+	if err := fs.writeSize(handle, int64(len(b))); err != nil {
+		return err
 	}
 	return handle.Write(b)
 }
 
+// Append appends to a file written before, creating it if it does not exist.
+// Access is checked like Write, target files are not read from the target directory.
+func (fs *BaseFS) Append(name string, b []byte) error {
+	return fs.update(name, func(content []byte, _ bool) ([]byte, error) {
+		return append(content, b...), nil
+	})
+}
+
+// Patch applies a unified diff to a file written before.
+// Access is checked like Write, target files are not read from the target directory.
+func (fs *BaseFS) Patch(name string, diff string) error {
+	return fs.update(name, func(content []byte, exists bool) ([]byte, error) {
+		if !exists {
+			return nil, fmt.Errorf("file was not written before: %w", os.ErrNotExist)
+		}
+		return ApplyUnifiedDiff(content, diff)
+	})
+}
+
+// update rewrites a file through the write hooks with the result of fn.
+func (fs *BaseFS) update(name string, fn func(content []byte, exists bool) ([]byte, error)) error {
+	handle, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if err := fs.checkAccess(FSAccessTypeWrite, handle); err != nil {
+		return err
+	}
+	if !fs.hasSizeHooks() {
+		return handle.Update(fn)
+	}
+	return handle.Update(func(content []byte, exists bool) ([]byte, error) {
+		b, err := fn(content, exists)
+		if err != nil {
+			return nil, err
+		}
+		return b, fs.writeSize(handle, int64(len(b)))
+	})
+}
+
 func (fs *BaseFS) Read(name string) ([]byte, error) {
 	handle, err := fs.resolve(name)
 	if err != nil {
 		return nil, err
 	}
+	if err := fs.checkAccess(FSAccessTypeRead, handle); err != nil {
+		return nil, err
+	}
+	return handle.Read()
+}
+
+// Open opens a file for streaming reads, access is checked like Read.
+func (fs *BaseFS) Open(name string) (io.ReadCloser, error) {
+	handle, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.checkAccess(FSAccessTypeRead, handle); err != nil {
+		return nil, err
+	}
+	return handle.Open()
+}
+
+// Remove removes a file, only hooks allowing Remove let it through.
+func (fs *BaseFS) Remove(name string) error {
+	handle, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if err := fs.checkAccess(FSAccessTypeRemove, handle); err != nil {
+		return err
+	}
+	if err := handle.Remove(); err != nil {
+		return err
+	}
 	for _, hook := range fs.Hooks {
-		if err := hook.Read(handle); err != nil {
-			return nil, err
+		if s, ok := hook.(FSSizeHook); ok {
+			s.Removed(handle)
 		}
 	}
-	return handle.Read()
+	return nil
+}
+
+// Rename moves a file, replacing the file at to.
+// The hooks see the removal of from followed by a write of to.
+func (fs *BaseFS) Rename(from, to string) error {
+	src, err := fs.resolve(from)
+	if err != nil {
+		return err
+	}
+	dst, err := fs.resolve(to)
+	if err != nil {
+		return err
+	}
+	// All hooks check the removal before the write, a denied write denies the recorded removal as well
+	if err := fs.checkAccess(FSAccessTypeRemove, src); err != nil {
+		return err
+	}
+	if err := fs.checkAccess(FSAccessTypeWrite, dst); err != nil {
+		fs.denied(FSAccessTypeRemove, src, err)
+		return err
+	}
+	if err := src.Rename(dst); err != nil {
+		return err
+	}
+	for _, hook := range fs.Hooks {
+		if s, ok := hook.(FSSizeHook); ok {
+			s.Renamed(src, dst)
+		}
+	}
+	return nil
 }
 
 // Stat returns file existence and directory status.
@@ -241,15 +601,41 @@ func (fs *BaseFS) Stat(name string) (exists, dir bool, err error) {
 	if err != nil {
 		return false, false, err
 	}
-	for _, hook := range fs.Hooks {
-		if err := hook.Stat(handle); err != nil {
-			return false, false, err
-		}
+	if err := fs.checkAccess(FSAccessTypeStat, handle); err != nil {
+		return false, false, err
 	}
 	return handle.Stat()
 }
 
-// Copy needs to be implemented on user side with read and write calls
+// Copy copies the file src to dst, access is checked like Read of src and Write of dst.
+// Unchanged target files are linked instead of copied where possible, see targetFSHandle.linkFrom.
+// It returns the hex sha256 of the content.
+func (fs *BaseFS) Copy(src, dst string) (string, error) {
+	srcHandle, err := fs.resolve(src)
+	if err != nil {
+		return "", err
+	}
+	if err := fs.checkAccess(FSAccessTypeRead, srcHandle); err != nil {
+		return "", err
+	}
+	dstHandle, err := fs.resolve(dst)
+	if err != nil {
+		return "", err
+	}
+	if err := fs.checkAccess(FSAccessTypeWrite, dstHandle); err != nil {
+		return "", err
+	}
+	if fs.hasSizeHooks() {
+		size, err := copySize(srcHandle)
+		if err != nil {
+			return "", err
+		}
+		if err := fs.writeSize(dstHandle, size); err != nil {
+			return "", err
+		}
+	}
+	return copyHandle(srcHandle, dstHandle)
+}
 
 // ReadDir reads a directory and returns the files and directories inside this directory or an error.
 // The returned list of dirs does not contain the directory itself.
@@ -260,29 +646,23 @@ func (fs *BaseFS) ReadDir(name string) (_files, _dirs []string, _err error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	for _, hook := range fs.Hooks {
-		err = hook.Stat(handle)
-		if err != nil {
-			return nil, nil, err
-		}
+	if err = fs.checkAccess(FSAccessTypeStat, handle); err != nil {
+		return nil, nil, err
 	}
 	exists, dir, err := handle.Stat()
 	if err != nil {
 		return nil, nil, err
 	}
 	if !exists {
-		return nil, nil, fmt.Errorf("path does not exist: %s", name)
+		return nil, nil, &markedError{msg: "path does not exist: " + name, mark: os.ErrNotExist}
 	}
 	if !dir {
 		return nil, nil, fmt.Errorf("path is not a directory: %s", name)
 	}
 
 	// Call ReadDir
-	for _, hook := range fs.Hooks {
-		err = hook.ReadDir(handle)
-		if err != nil {
-			return nil, nil, err
-		}
+	if err = fs.checkAccess(FSAccessTypeReadDir, handle); err != nil {
+		return nil, nil, err
 	}
 	files, dirs, err := handle.ReadDir()
 	if err != nil {
@@ -291,19 +671,15 @@ func (fs *BaseFS) ReadDir(name string) (_files, _dirs []string, _err error) {
 	var namesFile []string
 	var namesDir []string
 	for _, handle := range files {
-		for _, hook := range fs.Hooks {
-			if err := hook.Stat(handle); err != nil {
-				return nil, nil, err
-			}
+		if err := fs.checkAccess(FSAccessTypeStat, handle); err != nil {
+			return nil, nil, err
 		}
 		// Implicitly already called stat due to ReadDir, not doing it extra
 		namesFile = append(namesFile, handle.FriendlyPath())
 	}
 	for _, handle := range dirs {
-		for _, hook := range fs.Hooks {
-			if err := hook.Stat(handle); err != nil {
-				return nil, nil, err
-			}
+		if err := fs.checkAccess(FSAccessTypeStat, handle); err != nil {
+			return nil, nil, err
 		}
 		// Implicitly already called stat due to ReadDir, not doing it extra
 		namesDir = append(namesDir, handle.FriendlyPath())
@@ -348,6 +724,46 @@ type FSAccessHook interface {
 	Write(FSHandle) error
 	ReadDir(FSHandle) error
 	Stat(FSHandle) error
+	Remove(FSHandle) error
+}
+
+// FSDeniedHook is implemented by access hooks that want to see the accesses another hook denied, see FSRecorder.
+type FSDeniedHook interface {
+	// Denied is called after a hook denied the access of typ to h with err
+	Denied(typ FSAccessType, h FSHandle, err error)
+}
+
+// checkAccess calls the access hooks for an access of typ to h, the first error denies the access.
+func (fs *BaseFS) checkAccess(typ FSAccessType, h FSHandle) error {
+	for _, hook := range fs.Hooks {
+		var err error
+		switch typ {
+		case FSAccessTypeRead:
+			err = hook.Read(h)
+		case FSAccessTypeWrite:
+			err = hook.Write(h)
+		case FSAccessTypeStat:
+			err = hook.Stat(h)
+		case FSAccessTypeReadDir:
+			err = hook.ReadDir(h)
+		case FSAccessTypeRemove:
+			err = hook.Remove(h)
+		}
+		if err != nil {
+			fs.denied(typ, h, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// denied passes an access a hook denied to the hooks implementing FSDeniedHook.
+func (fs *BaseFS) denied(typ FSAccessType, h FSHandle, err error) {
+	for _, hook := range fs.Hooks {
+		if d, ok := hook.(FSDeniedHook); ok {
+			d.Denied(typ, h, err)
+		}
+	}
 }
 
 // FSResolver resolves a friendly name such as prefix:path to a FSHandle.
@@ -364,6 +780,8 @@ type FileBackedFSResolver struct {
 	name    string
 	prefix  string
 	baseDir string
+	// algorithm is the lockfile checksum algorithm handles record while writing besides sha256, optional
+	algorithm string
 }
 
 // Check FileBackedFSResolver satisfies FSResolver interface
@@ -385,17 +803,104 @@ func (r *FileBackedFSResolver) Resolve(name string) (FSHandle, bool, error) {
 		return nil, false, nil // Do not match
 	}
 
-	cleanPath := filepath.Clean(suffix)
-	if filepath.IsAbs(cleanPath) {
-		return nil, true, fmt.Errorf("path %q needs to be relative", name)
-	}
-	if !filepath.IsLocal(cleanPath) {
-		return nil, true, fmt.Errorf("path %q needs to be local", name)
+	// Paths are slash separated on all platforms, so friendly names and lockfile paths do not depend on the OS
+	cleanPath, err := cleanScriptPath(suffix)
+	if err != nil {
+		return nil, true, fmt.Errorf("path %q %w", name, err)
 	}
-	absPath := filepath.Join(r.baseDir, cleanPath)
+	absPath := filepath.Join(r.baseDir, filepath.FromSlash(cleanPath))
 	friendlyPath := r.prefix + cleanPath
 	indirectTargetPath := cleanPath
-	return NewFileBackedFSHandle(absPath, friendlyPath, r.name, indirectTargetPath), true, nil
+	h := NewFileBackedFSHandle(absPath, friendlyPath, r.name, indirectTargetPath)
+	h.algorithm = r.algorithm
+	return h, true, nil
+}
+
+// TargetFSResolver resolves target paths like FileBackedFSResolver.
+// Writes go to the run directory while reads are served from readDir,
+// the target as it was before the run. Access to reads is controlled by RPackAccessControlFSHook.
+type TargetFSResolver struct {
+	*FileBackedFSResolver
+	readDir string
+	// Logger receives how staged files were linked, slog.Default() if nil
+	Logger *slog.Logger
+}
+
+// Check TargetFSResolver satisfies FSResolver interface
+var _ = FSResolver(&TargetFSResolver{})
+
+// NewTargetFSResolver creates a target resolver writing to baseDir and reading from readDir.
+// If readDir is empty reads are served from baseDir.
+func NewTargetFSResolver(name, prefix, baseDir, readDir string) *TargetFSResolver {
+	return &TargetFSResolver{
+		FileBackedFSResolver: NewFileBackedFSResolver(name, prefix, baseDir),
+		readDir:              readDir,
+	}
+}
+
+// Resolve resolves a name to a handle writing to the run directory and reading from the target.
+func (r *TargetFSResolver) Resolve(name string) (FSHandle, bool, error) {
+	h, matched, err := r.FileBackedFSResolver.Resolve(name)
+	if !matched || err != nil || r.readDir == "" {
+		return h, matched, err
+	}
+	source := NewFileBackedFSHandle(filepath.Join(r.readDir, h.IndirectTargetPath()), h.FriendlyPath(), r.name, h.IndirectTargetPath())
+	log := r.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	return &targetFSHandle{FSHandle: h, source: source, log: log}, true, nil
+}
+
+// targetFSHandle writes through the embedded handle and reads from source.
+type targetFSHandle struct {
+	FSHandle
+	source FSHandle
+	// sha is the hex sha256 of content linked by linkFrom, it bypasses the embedded handle
+	sha string
+	log *slog.Logger
+}
+
+// Checksum returns the hex sha256 of the content written or linked through the handle.
+func (h *targetFSHandle) Checksum() (string, bool) {
+	if h.sha != "" {
+		return h.sha, true
+	}
+	return h.FSHandle.Checksum()
+}
+
+// algorithmChecksum returns the checksum with the lockfile checksum algorithm recorded by the
+// embedded handle, there is none for linked content.
+func (h *targetFSHandle) algorithmChecksum() (string, bool) {
+	w, ok := h.FSHandle.(*FileBackedFSHandle)
+	if h.sha != "" || !ok {
+		return "", false
+	}
+	return w.algorithmChecksum()
+}
+
+// AbsPath returns the path of the file in the target directory.
+func (h *targetFSHandle) AbsPath() string {
+	return h.source.AbsPath()
+}
+
+func (h *targetFSHandle) Read() ([]byte, error) {
+	return h.source.Read()
+}
+
+// Open opens the target file for streaming reads.
+func (h *targetFSHandle) Open() (io.ReadCloser, error) {
+	return h.source.Open()
+}
+
+// Stat returns file existence and directory status of the target file.
+func (h *targetFSHandle) Stat() (exists, dir bool, err error) {
+	return h.source.Stat()
+}
+
+// ReadDir returns the entries of the target directory.
+func (h *targetFSHandle) ReadDir() (files, dirs []FSHandle, err error) {
+	return h.source.ReadDir()
 }
 
 // MapFSResolverPrefix is the prefix for map-based resolver lookups.
@@ -427,15 +932,13 @@ func (r *MapFSResolver) Resolve(name string) (FSHandle, bool, error) {
 		return nil, false, nil // Do not match
 	}
 
-	cleanPath := filepath.Clean(suffix)
-	if filepath.IsAbs(cleanPath) {
-		return nil, true, fmt.Errorf("path %q needs to be relative", name)
-	}
-	if !filepath.IsLocal(cleanPath) {
-		return nil, true, fmt.Errorf("path %q needs to be local", name)
+	cleanPath, err := cleanScriptPath(suffix)
+	if err != nil {
+		return nil, true, fmt.Errorf("path %q %w", name, err)
 	}
 
-	base, nextPath, found := strings.Cut(suffix, "/")
+	// Cut the input name after normalizing, map:dir\file names the same file as map:dir/file
+	base, nextPath, found := strings.Cut(toScriptSlash(suffix), "/")
 	// Resolve prefix first, it is always given
 	var resolvedInput *RPackResolvedInput
 	for _, ri := range r.resolvedInputs {
@@ -445,6 +948,9 @@ func (r *MapFSResolver) Resolve(name string) (FSHandle, bool, error) {
 		}
 	}
 	if resolvedInput == nil {
+		if r.name == ExtraResolver {
+			return nil, true, fmt.Errorf("extra %s of %s is not declared by the definition or not mapped by the config", base, name)
+		}
 		return nil, true, fmt.Errorf("could not find mapped input %s", name)
 	}
 
@@ -453,22 +959,29 @@ func (r *MapFSResolver) Resolve(name string) (FSHandle, bool, error) {
 	relPath := resolvedInput.UserPath
 	// TODO: CleanPath is already full path, maybe we want to build it by hand and only create short clean Name first
 	cleanFriendlyName := r.prefix + cleanPath
-	if found {
+	if resolvedInput.Type == RPackInputTypeGlob {
+		// Only the matched files of a glob are accessible
+		if !found {
+			return nil, true, fmt.Errorf("map path %q is a collection of files, use the paths listed by rpack.inputs()", name)
+		}
+		match := path.Clean(nextPath)
+		if !slices.Contains(resolvedInput.Matches, match) {
+			return nil, true, fmt.Errorf("map path %q is not matched by %s", name, resolvedInput.UserPath)
+		}
+		p = filepath.Join(p, filepath.FromSlash(match))
+		relPath = filepath.Join(filepath.FromSlash(globBase(resolvedInput.UserPath)), filepath.FromSlash(match))
+	} else if found {
 		if resolvedInput.Type != RPackInputTypeDirectory {
 			return nil, true, fmt.Errorf("map path %q is not a directory", name)
 		}
-		cleanNextPath := filepath.Clean(nextPath)
-		if filepath.IsAbs(cleanNextPath) {
-			return nil, true, fmt.Errorf("map path %q needs to be relative", name)
-		}
-		if !filepath.IsLocal(cleanNextPath) {
-			return nil, true, fmt.Errorf("map path %q needs to be local", name)
+		cleanNextPath, err := cleanScriptPath(nextPath)
+		if err != nil {
+			return nil, true, fmt.Errorf("map path %q %w", name, err)
 		}
-		p = filepath.Join(p, cleanNextPath)
-		relPath = filepath.Join(relPath, cleanNextPath)
+		p = filepath.Join(p, filepath.FromSlash(cleanNextPath))
+		relPath = filepath.Join(relPath, filepath.FromSlash(cleanNextPath))
 	}
 
-	slog.Debug("MapFSResolver: Create new fshandle", "friendlyname", cleanFriendlyName, "resolver", r.name, "relPath", relPath, "absPath", p)
 	return NewFileBackedFSHandle(p, cleanFriendlyName, r.name, relPath), true, nil
 }
 
@@ -481,6 +994,7 @@ const (
 	FSAccessTypeWrite   FSAccessType = "write"
 	FSAccessTypeStat    FSAccessType = "stat"
 	FSAccessTypeReadDir FSAccessType = "readdir"
+	FSAccessTypeRemove  FSAccessType = "remove"
 )
 
 func (t FSAccessType) String() string {
@@ -492,14 +1006,18 @@ type HandleFilterFn func(FSAccessType, FSHandle) bool
 
 // FSRecorder records all filesystem access
 // passing a filter function and makes the results
-// available through Records().
+// available through Records(). Denied accesses are only listed by AllRecords().
 type FSRecorder struct {
 	filterFn HandleFilterFn
 	records  []FSRecorderRecord
+	denied   int
 }
 
-// Check FSRecorder satisfies FSAccessHook interface
-var _ = FSAccessHook(&FSRecorder{})
+// Check FSRecorder satisfies FSAccessHook and FSDeniedHook interface
+var (
+	_ = FSAccessHook(&FSRecorder{})
+	_ = FSDeniedHook(&FSRecorder{})
+)
 
 // NewFSRecorder creates a new FSRecorder capturing all file interactions.
 // If filterFn is nil, all interactions are recorded.
@@ -513,13 +1031,40 @@ func NewFSRecorder(filterFn HandleFilterFn) *FSRecorder {
 type FSRecorderRecord struct {
 	Handle FSHandle
 	Typ    FSAccessType
+	// Denied is the error of the hook denying the access, nil if it happened
+	Denied error
 }
 
 // Records returns the recorded filesystem access events.
 func (f *FSRecorder) Records() []FSRecorderRecord {
+	if f.denied == 0 {
+		return f.records
+	}
+	return slices.DeleteFunc(slices.Clone(f.records), func(r FSRecorderRecord) bool { return r.Denied != nil })
+}
+
+// AllRecords returns the recorded filesystem access events including the denied ones, in order.
+func (f *FSRecorder) AllRecords() []FSRecorderRecord {
 	return f.records
 }
 
+// Denied records an access another hook denied. An access recorded before a later hook
+// or the size hooks denied it is marked as denied instead, handles are resolved per access,
+// so the record of h is the one of the denied access.
+func (f *FSRecorder) Denied(typ FSAccessType, h FSHandle, err error) {
+	if f.filterFn != nil && !f.filterFn(typ, h) {
+		return
+	}
+	f.denied++
+	for i := len(f.records) - 1; i >= 0; i-- {
+		if r := &f.records[i]; r.Denied == nil && r.Typ == typ && r.Handle == h {
+			r.Denied = err
+			return
+		}
+	}
+	f.records = append(f.records, FSRecorderRecord{Typ: typ, Handle: h, Denied: err})
+}
+
 func (f *FSRecorder) filterRecord(typ FSAccessType, h FSHandle) {
 	if f.filterFn == nil || f.filterFn(typ, h) {
 		f.records = append(f.records, FSRecorderRecord{Typ: typ, Handle: h})
@@ -547,23 +1092,74 @@ func (f *FSRecorder) Stat(h FSHandle) error {
 	return nil
 }
 
+// Remove records a remove event.
+func (f *FSRecorder) Remove(h FSHandle) error {
+	f.filterRecord(FSAccessTypeRemove, h)
+	return nil
+}
+
 ////
 
+// deniedTargetWrites are target path patterns no pack is allowed to write,
+// they hold version control internals and rpack's own configuration and state.
+var deniedTargetWrites = []string{
+	"**/.git/**",
+	"**/" + RPackCacheDir + "/**",
+	"*" + RPackFileSuffix,
+	"*" + RPackLockFileSuffix,
+}
+
+// deniedTargetWrite reports if the target path p matches deniedTargetWrites, ignoring case
+// so .GIT/config is protected on case-insensitive filesystems too.
+func deniedTargetWrite(p string) bool {
+	return matchPathPattern(deniedTargetWrites, strings.ToLower(p))
+}
+
 // RPackAccessControlFSHook controls the access to specific file locations.
 // It performs the following rules:
 // - Prevents writes to rpackdef and map
-// - Prevents reads to target
+// - Prevents writes to target paths matching deniedTargetWrites
+// - Prevents reads to target, except for paths matching AllowTargetRead
 //
 //nolint:revive // intentional: RPack prefix is the domain convention
-type RPackAccessControlFSHook struct{}
+type RPackAccessControlFSHook struct {
+	// AllowTargetRead are the allow_target_read patterns of the definition
+	AllowTargetRead []string
+}
 
 // Check EnsurePure satisfies FSAccessHook interface
 var _ = FSAccessHook(&RPackAccessControlFSHook{})
 
+// errAccessDenied matches the errors of accesses the hooks or permissions deny.
+var errAccessDenied = errors.New("access denied")
+
+// markedError is an error message matching the sentinel mark without wrapping its message.
+type markedError struct {
+	msg  string
+	mark error
+}
+
+func (e *markedError) Error() string {
+	return e.msg
+}
+
+func (e *markedError) Is(target error) bool {
+	return target == e.mark
+}
+
+// accessDenied returns a denied access error formatted like fmt.Errorf, without wrapping.
+func accessDenied(format string, args ...any) error {
+	return &markedError{msg: fmt.Sprintf(format, args...), mark: errAccessDenied}
+}
+
+// targetAccessAllowed reports if a read-like access to the handle is allowed.
+func (f *RPackAccessControlFSHook) targetAccessAllowed(h FSHandle) bool {
+	return h.Resolver() != TargetResolver || matchPathPattern(f.AllowTargetRead, h.IndirectTargetPath())
+}
+
 func (f *RPackAccessControlFSHook) Read(h FSHandle) error {
-	resolver := h.Resolver()
-	if resolver == TargetResolver {
-		return fmt.Errorf("not allowed to read %s (no access to read from target directory, use 'rpack:' instead)", h.FriendlyPath())
+	if !f.targetAccessAllowed(h) {
+		return accessDenied("not allowed to read %s (no access to read from target directory, use 'rpack:' instead or add it to allow_target_read)", h.FriendlyPath())
 	}
 	return nil
 }
@@ -571,31 +1167,101 @@ func (f *RPackAccessControlFSHook) Write(h FSHandle) error {
 	resolver := h.Resolver()
 	switch resolver {
 	case RPackResolver:
-		return fmt.Errorf("not allowed to write %s, use `temp` instead", h.FriendlyPath())
+		return accessDenied("not allowed to write %s, use `temp` instead", h.FriendlyPath())
 	case MapResolver:
-		return fmt.Errorf("not allowed to write %s, use `target` instead", h.FriendlyPath())
+		return accessDenied("not allowed to write %s, use `target` instead", h.FriendlyPath())
+	case SecretResolver:
+		return accessDenied("not allowed to write %s, secrets are read-only", h.FriendlyPath())
+	case HTTPResolver:
+		return accessDenied("not allowed to write %s, URLs are read-only", h.FriendlyPath())
+	case DepResolver:
+		return accessDenied("not allowed to write %s, outputs of dependencies are read-only", h.FriendlyPath())
+	case ExtraResolver:
+		return accessDenied("not allowed to write %s, extras are read-only", h.FriendlyPath())
+	case TargetResolver:
+		if deniedTargetWrite(h.IndirectTargetPath()) {
+			return accessDenied("not allowed to write %s (version control and rpack metadata are protected)", h.FriendlyPath())
+		}
 	}
 	return nil
 }
 
+// Remove allows removing temp files and the target files a pack may write.
+func (f *RPackAccessControlFSHook) Remove(h FSHandle) error {
+	switch h.Resolver() {
+	case TempResolver:
+		return nil
+	case TargetResolver:
+		if deniedTargetWrite(h.IndirectTargetPath()) {
+			return accessDenied("not allowed to remove %s (version control and rpack metadata are protected)", h.FriendlyPath())
+		}
+		return nil
+	default:
+		return accessDenied("not allowed to remove %s, only temp and target files can be removed", h.FriendlyPath())
+	}
+}
+
 // ReadDir records a directory read access check.
 func (f *RPackAccessControlFSHook) ReadDir(h FSHandle) error {
-	resolver := h.Resolver()
-	if resolver == TargetResolver {
-		return fmt.Errorf("not allowed to readdir %s (no access to read from target directory, use 'rpack:' instead)", h.FriendlyPath())
+	if !f.targetAccessAllowed(h) {
+		return accessDenied("not allowed to readdir %s (no access to read from target directory, use 'rpack:' instead or add it to allow_target_read)", h.FriendlyPath())
 	}
 	return nil
 }
 
 // Stat records a stat access check.
 func (f *RPackAccessControlFSHook) Stat(h FSHandle) error {
-	resolver := h.Resolver()
-	if resolver == TargetResolver {
-		return fmt.Errorf("not allowed to stat %s (no access to read from target directory, use 'rpack:' instead)", h.FriendlyPath())
+	if !f.targetAccessAllowed(h) {
+		return accessDenied("not allowed to stat %s (no access to read from target directory, use 'rpack:' instead or add it to allow_target_read)", h.FriendlyPath())
+	}
+	return nil
+}
+
+// RPackPermissionFSHook denies the accesses a definition did not declare in its permissions.
+// Target reads are limited by the RPackAccessControlFSHook, URLs by the HTTPFSResolver.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackPermissionFSHook struct {
+	Permissions *RPackDefPermissions
+}
+
+// Check RPackPermissionFSHook satisfies FSAccessHook interface
+var _ = FSAccessHook(&RPackPermissionFSHook{})
+
+// readAllowed denies read-like accesses to inputs and extras without read_inputs.
+func (f *RPackPermissionFSHook) readAllowed(op string, h FSHandle) error {
+	if (h.Resolver() == MapResolver || h.Resolver() == ExtraResolver) && !f.Permissions.ReadInputs {
+		return accessDenied("not allowed to %s %s (the definition does not declare permissions.read_inputs)", op, h.FriendlyPath())
 	}
 	return nil
 }
 
+func (f *RPackPermissionFSHook) Read(h FSHandle) error {
+	return f.readAllowed("read", h)
+}
+
+func (f *RPackPermissionFSHook) Write(h FSHandle) error {
+	if h.Resolver() == TargetResolver && !f.Permissions.WriteTarget {
+		return accessDenied("not allowed to write %s (the definition does not declare permissions.write_target)", h.FriendlyPath())
+	}
+	return nil
+}
+
+func (f *RPackPermissionFSHook) Remove(h FSHandle) error {
+	if h.Resolver() == TargetResolver && !f.Permissions.WriteTarget {
+		return accessDenied("not allowed to remove %s (the definition does not declare permissions.write_target)", h.FriendlyPath())
+	}
+	return nil
+}
+
+func (f *RPackPermissionFSHook) ReadDir(h FSHandle) error {
+	return f.readAllowed("readdir", h)
+}
+
+func (f *RPackPermissionFSHook) Stat(h FSHandle) error {
+	return f.readAllowed("stat", h)
+}
+
 // EnsurePure enforces that operations are pure, meaning side-effect free.
 // This specifically means it is not allowed to write to a file that was read before.
 // Since this would lead to a second execution not being idempotent.
@@ -606,6 +1272,8 @@ func (f *RPackAccessControlFSHook) Stat(h FSHandle) error {
 // It is not important in which order the read and write happens, since the first run could execute the write, while the second does the read.
 // Example wrong order:
 // - Same file: The user writes ./mylist.yaml, afterwards it reads map:mylist.yaml. On the second run it reads what was previously written
+// Reads and stats of target paths opted in via allow_target_read are explicit merges and not checked,
+// the script is responsible for merging idempotently. Listing a target directory the script writes into is still a conflict.
 type EnsurePure struct {
 	ReadHandles    []FSHandle
 	ReadDirHandles []FSHandle
@@ -654,8 +1322,20 @@ func (f *EnsurePure) CheckConflicts() error {
 	return nil
 }
 
-// Check EnsurePure satisfies FSAccessHook interface
-var _ = FSAccessHook(&EnsurePure{})
+// Check EnsurePure satisfies FSAccessHook and FSDeniedHook interface
+var (
+	_ = FSAccessHook(&EnsurePure{})
+	_ = FSDeniedHook(&EnsurePure{})
+)
+
+// Denied forgets h, a denied access does not conflict with other accesses.
+func (f *EnsurePure) Denied(_ FSAccessType, h FSHandle, _ error) {
+	isHandle := func(other FSHandle) bool { return other == h }
+	f.ReadHandles = slices.DeleteFunc(f.ReadHandles, isHandle)
+	f.ReadDirHandles = slices.DeleteFunc(f.ReadDirHandles, isHandle)
+	f.StatHandles = slices.DeleteFunc(f.StatHandles, isHandle)
+	f.WriteHandles = slices.DeleteFunc(f.WriteHandles, isHandle)
+}
 
 func (f *EnsurePure) Read(h FSHandle) error {
 	resolver := h.Resolver()
@@ -672,10 +1352,15 @@ func (f *EnsurePure) Write(h FSHandle) error {
 	return nil
 }
 
+// Remove checks removal purity, removing a target file is a write.
+func (f *EnsurePure) Remove(h FSHandle) error {
+	return f.Write(h)
+}
+
 // ReadDir checks directory read purity.
 func (f *EnsurePure) ReadDir(h FSHandle) error {
 	resolver := h.Resolver()
-	if resolver == MapResolver {
+	if resolver == MapResolver || resolver == TargetResolver {
 		f.ReadDirHandles = append(f.ReadDirHandles, h)
 	}
 	return nil
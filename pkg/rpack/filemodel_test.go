@@ -2,6 +2,12 @@ package rpack
 
 import (
 	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -15,14 +21,24 @@ type mockFSHandle struct {
 func (m *mockFSHandle) Resolver() string           { return m.resolver }
 func (m *mockFSHandle) FriendlyPath() string       { return m.friendlyPath }
 func (m *mockFSHandle) IndirectTargetPath() string { return m.indirectTargetPath }
+func (m *mockFSHandle) AbsPath() string            { return "" }
 func (m *mockFSHandle) Read() ([]byte, error)      { return nil, nil }
-func (m *mockFSHandle) Write([]byte) error         { return nil }
+func (m *mockFSHandle) Open() (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("")), nil
+}
+func (m *mockFSHandle) Write([]byte) error { return nil }
+func (m *mockFSHandle) Update(func([]byte, bool) ([]byte, error)) error {
+	return nil
+}
+func (m *mockFSHandle) Checksum() (string, bool) { return "", false }
 func (m *mockFSHandle) Stat() (exists, dir bool, err error) {
 	return false, false, nil
 }
 func (m *mockFSHandle) ReadDir() (files, dirs []FSHandle, err error) {
 	return nil, nil, nil
 }
+func (m *mockFSHandle) Remove() error         { return nil }
+func (m *mockFSHandle) Rename(FSHandle) error { return nil }
 func (m *mockFSHandle) Transfer(string) error { return nil }
 
 // TestRPackFSCheck tests the RPackFS.Check() method.
@@ -302,3 +318,318 @@ func TestEnsurePureCheckConflicts(t *testing.T) {
 		})
 	}
 }
+
+func TestRPackFSAllowTargetRead(t *testing.T) {
+	execDir := t.TempDir()
+	runDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(execDir, "conf"), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(execDir, "Makefile"), []byte("all:\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	fs := NewRPackFS(true, t.TempDir(), runDir, t.TempDir(), execDir, nil, []string{"Makefile", "conf"})
+
+	b, err := fs.Read("Makefile")
+	if err != nil || string(b) != "all:\n" {
+		t.Fatalf("Expected allowed read of target, got %q, %v", b, err)
+	}
+	if err = fs.Write("Makefile", []byte("all:\nlint:\n")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = fs.Read("Makefile"); err != nil || string(b) != "all:\n" {
+		t.Errorf("Expected reads to see the target before the run, got %q, %v", b, err)
+	}
+	if b, err = os.ReadFile(filepath.Join(runDir, "Makefile")); err != nil || string(b) != "all:\nlint:\n" { //nolint:gosec // test file
+		t.Errorf("Expected write to run directory, got %q, %v", b, err)
+	}
+	if err = fs.Check(); err != nil {
+		t.Errorf("Expected merge into allowed target file to pass purity check: %s", err)
+	}
+
+	if _, err = fs.Read("README.md"); err == nil || !strings.Contains(err.Error(), "allow_target_read") {
+		t.Errorf("Expected read of other target file to fail, got %v", err)
+	}
+
+	if _, _, err = fs.ReadDir("conf"); err != nil {
+		t.Fatalf("Expected allowed readdir: %s", err)
+	}
+	if err = fs.Write("conf/new.yaml", []byte("a: 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Check(); err == nil {
+		t.Errorf("Expected purity error for write into listed target directory")
+	}
+}
+
+func TestRPackFSAllowTargetReadRecursive(t *testing.T) {
+	execDir := t.TempDir()
+	for _, name := range []string{"deploy/app.yaml", "deploy/prod/eu/app.yaml", "deploy/prod/app.json"} {
+		if err := os.MkdirAll(filepath.Join(execDir, filepath.Dir(name)), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(execDir, name), []byte(name), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	fs := NewRPackFS(true, t.TempDir(), t.TempDir(), t.TempDir(), execDir, nil, []string{"deploy/**/*.yaml"})
+
+	for _, name := range []string{"deploy/app.yaml", "deploy/prod/eu/app.yaml"} {
+		if b, err := fs.Read(name); err != nil || string(b) != name {
+			t.Errorf("Expected allowed read of %s, got %q, %v", name, b, err)
+		}
+	}
+	if _, err := fs.Read("deploy/prod/app.json"); !errors.Is(err, errAccessDenied) {
+		t.Errorf("Expected read of unmatched target file to be denied, got %v", err)
+	}
+}
+
+func TestRPackFSAppendAndPatch(t *testing.T) {
+	execDir := t.TempDir()
+	runDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(execDir, "notes.txt"), []byte("existing\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	fs := NewRPackFS(true, t.TempDir(), runDir, t.TempDir(), execDir, nil, nil)
+
+	if err := fs.Write("notes.txt", []byte("generated\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Append("notes.txt", []byte("appended\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Patch("notes.txt", "@@ -1,2 +1,2 @@\n-generated\n+patched\n appended\n"); err != nil {
+		t.Fatalf("Patch failed: %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "notes.txt")) //nolint:gosec // test file
+	if err != nil || string(b) != "patched\nappended\n" {
+		t.Errorf("Unexpected run content %q, %v", b, err)
+	}
+	if handles := fs.TargetWriteHandles(); len(handles) != 3 {
+		t.Errorf("Expected write, append and patch to be recorded, got %d", len(handles))
+	}
+	if err = fs.Patch("other.txt", "@@ -1 +1 @@\n-a\n+b\n"); err == nil {
+		t.Errorf("Expected error patching a file that was not written")
+	}
+	if err = fs.Append("rpack:files/x", []byte("x")); err == nil {
+		t.Errorf("Expected append to rpack: to be denied")
+	}
+}
+
+func TestRPackFSDeniedTargetWrites(t *testing.T) {
+	fs := NewRPackFS(true, t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir(), nil, nil)
+	for _, name := range []string{
+		".git/config",
+		".git",
+		"sub/.git/hooks/pre-commit",
+		".GIT/config",
+		"sub/.Git/hooks/pre-commit",
+		".rpack.d/source/x",
+		".RPACK.D/source/x",
+		"app.rpack.yaml",
+		"App.RPack.yaml",
+		"sub/app.rpack.lock.yaml",
+	} {
+		if err := fs.Write(name, []byte("x")); err == nil || !strings.Contains(err.Error(), "not allowed to write") {
+			t.Errorf("%s: expected write to be denied, got %v", name, err)
+		}
+	}
+	for _, name := range []string{".gitignore", ".github/workflows/ci.yaml", "docs/rpack.yaml.md", "my.git/file"} {
+		if err := fs.Write(name, []byte("x")); err != nil {
+			t.Errorf("%s: expected write to be allowed, got %v", name, err)
+		}
+	}
+}
+
+func TestRPackFSPermissions(t *testing.T) {
+	inputDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(inputDir, "in.txt"), []byte("in"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	inputs := []*RPackResolvedInput{{Name: "in", Type: RPackInputTypeFile, ResolvedPath: filepath.Join(inputDir, "in.txt"), UserPath: "in.txt"}}
+	execDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(execDir, "Makefile"), []byte("all:"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	fs := NewRPackFSWithPermissions(true, t.TempDir(), t.TempDir(), t.TempDir(), execDir, inputs, &RPackDefPermissions{})
+	if _, err := fs.Read("map:in"); err == nil || !strings.Contains(err.Error(), "permissions.read_inputs") {
+		t.Errorf("Expected input read to be denied, got %v", err)
+	}
+	if _, _, err := fs.Stat("map:in"); err == nil {
+		t.Error("Expected input stat to be denied")
+	}
+	if err := fs.Write("out.txt", []byte("x")); err == nil || !strings.Contains(err.Error(), "permissions.write_target") {
+		t.Errorf("Expected target write to be denied, got %v", err)
+	}
+	if err := fs.Write("temp:scratch", []byte("x")); err != nil {
+		t.Errorf("Expected temp write to be allowed, got %v", err)
+	}
+	if _, err := fs.Read("Makefile"); err == nil {
+		t.Error("Expected target read to be denied")
+	}
+
+	fs = NewRPackFSWithPermissions(true, t.TempDir(), t.TempDir(), t.TempDir(), execDir, inputs, &RPackDefPermissions{ReadInputs: true, WriteTarget: true, TargetReadPaths: []string{"Makefile"}})
+	if b, err := fs.Read("map:in"); err != nil || string(b) != "in" {
+		t.Errorf("Expected input read, got %q: %v", b, err)
+	}
+	if b, err := fs.Read("Makefile"); err != nil || string(b) != "all:" {
+		t.Errorf("Expected target read, got %q: %v", b, err)
+	}
+	if err := fs.Write("out.txt", []byte("x")); err != nil {
+		t.Errorf("Expected target write to be allowed, got %v", err)
+	}
+}
+
+func TestRPackFSTargetWriteChecksums(t *testing.T) {
+	runDir := t.TempDir()
+	fs := NewRPackFS(true, t.TempDir(), runDir, t.TempDir(), t.TempDir(), nil, nil)
+	if err := fs.Write("a.txt", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Append("a.txt", []byte(" second")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Write("dir/b.txt", []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Write("temp:c.txt", []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Copy("temp:c.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	sums := fs.TargetWriteChecksums()
+	want := map[string]string{
+		"a.txt":     sha256Hex([]byte("first second")),
+		"dir/b.txt": sha256Hex([]byte("b")),
+		"c.txt":     sha256Hex([]byte("c")),
+	}
+	if len(sums) != len(want) {
+		t.Fatalf("unexpected checksums: %v", sums)
+	}
+	for p, sha := range want {
+		if sums[p] != sha {
+			t.Errorf("checksum of %s: got %s, want %s", p, sums[p], sha)
+		}
+	}
+
+	// The lockfile checksums come from the recorded hashes, the run directory is not read again
+	if err := os.WriteFile(filepath.Join(runDir, "a.txt"), []byte("changed"), 0o644); err != nil { //nolint:gosec // test files
+		t.Fatal(err)
+	}
+	run := &packRun{Instance: &RPackInstance{RunPath: runDir, Pack: &RPackConfigPack{Name: "p"}}, FS: fs}
+	files, err := collectTargetFiles(t.Context(), slog.New(slog.DiscardHandler), []*packRun{run}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files[0].Path != "a.txt" || files[0].Sha != want["a.txt"] {
+		t.Errorf("unexpected target files: %+v", files[0])
+	}
+
+	fs.setRewrittenChecksum("a.txt", sha256Hex([]byte("changed")))
+	if sha := fs.TargetWriteChecksums()["a.txt"]; sha != sha256Hex([]byte("changed")) {
+		t.Errorf("rewritten checksum not used: %s", sha)
+	}
+}
+
+func TestRPackFSTargetAlgorithmChecksums(t *testing.T) {
+	fs := NewRPackFS(true, t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir(), nil, nil)
+	fs.setChecksumAlgorithm(ChecksumXXH64)
+	if err := fs.Write("a.txt", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Write("temp:c.txt", []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Copy("temp:c.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Write("d.txt", []byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("d.txt", "dir/d.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Write("e.txt", []byte("e")); err != nil {
+		t.Fatal(err)
+	}
+	fs.setRewrittenChecksum("e.txt", sha256Hex([]byte("rewritten")))
+
+	sums := fs.targetAlgorithmChecksums()
+	// Renamed and rewritten files are hashed from the run directory
+	for p, content := range map[string]string{"a.txt": "a", "c.txt": "c"} {
+		want, err := checksumBytes(ChecksumXXH64, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sums[p] != want {
+			t.Errorf("checksum of %s: got %q, want %s", p, sums[p], want)
+		}
+	}
+	if len(sums) != 2 {
+		t.Errorf("unexpected checksums: %v", sums)
+	}
+}
+
+func TestRPackFSRemoveRename(t *testing.T) {
+	runDir, tempDir := t.TempDir(), t.TempDir()
+	fs := NewRPackFS(true, t.TempDir(), runDir, tempDir, t.TempDir(), nil, nil)
+	for _, name := range []string{"a.txt", "b.txt", "temp:c.txt"} {
+		if err := fs.Write(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.Rename("b.txt", "dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("temp:c.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	var written []string
+	for _, h := range fs.TargetWriteHandles() {
+		written = append(written, h.IndirectTargetPath())
+	}
+	if !slices.Equal(written, []string{"dir/b.txt", "c.txt"}) {
+		t.Errorf("Expected renamed files written only, got %v", written)
+	}
+	if b, err := os.ReadFile(filepath.Join(runDir, "dir", "b.txt")); err != nil || string(b) != "b.txt" { //nolint:gosec // test file
+		t.Errorf("Expected renamed file in the run directory, got %q: %v", b, err)
+	}
+	for _, name := range []string{filepath.Join(runDir, "a.txt"), filepath.Join(runDir, "b.txt"), filepath.Join(tempDir, "c.txt")} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be gone, got %v", name, err)
+		}
+	}
+
+	// Only temp and written target files can be removed
+	if err := fs.Remove("rpack:rpack.yaml"); !errors.Is(err, errAccessDenied) {
+		t.Errorf("Expected removing a definition file to be denied, got %v", err)
+	}
+	if err := fs.Rename("c.txt", ".git/config"); !errors.Is(err, errAccessDenied) {
+		t.Errorf("Expected renaming to a protected path to be denied, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "c.txt")); err != nil {
+		t.Errorf("Expected a denied rename to keep its source, got %v", err)
+	}
+	// The removal passed access control and was recorded before the write was denied
+	if records := fs.recorder.AllRecords(); records[len(records)-2].Typ != FSAccessTypeRemove || records[len(records)-2].Denied == nil {
+		t.Errorf("Expected the removal of a denied rename to be recorded as denied, got %+v", records[len(records)-2])
+	}
+	if err := fs.Remove("missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected removing a file not written to fail, got %v", err)
+	}
+	var removes int
+	for _, r := range fs.Recorder().Records() {
+		if r.Typ == FSAccessTypeRemove {
+			removes++
+		}
+	}
+	if removes != 4 {
+		t.Errorf("Expected 2 renames and 2 removes passing access control recorded, got %d", removes)
+	}
+}
@@ -121,7 +121,7 @@ func NewFileResolver(defSourcePath, runPath, tempPath, execPath string, resolved
 
 // ResolveInput resolves user defined file paths from script to absolute paths mapping to different locations.
 func (r *FileResolver) ResolveInput(name string) (*ControlledFile, error) {
-	prefix, suffix, found := strings.Cut(name, ":")
+	prefix, suffix, found := splitPrefix(name)
 	if !found {
 		return nil, fmt.Errorf("input path needs to use map:, rpack:, or temp: prefix")
 	}
@@ -141,7 +141,7 @@ func (r *FileResolver) ResolveInput(name string) (*ControlledFile, error) {
 }
 
 func (r *FileResolver) resolveMapInput(name string) (*ControlledFile, error) {
-	prefix, suffix, found := strings.Cut(name, "/")
+	prefix, suffix, found := strings.Cut(toScriptSlash(name), "/")
 	// Resolve prefix first, it is always given
 	var resolvedInput *RPackResolvedInput
 	for _, ri := range r.resolvedInputs {
@@ -161,15 +161,12 @@ func (r *FileResolver) resolveMapInput(name string) (*ControlledFile, error) {
 		if resolvedInput.Type != RPackInputTypeDirectory {
 			return nil, fmt.Errorf("map path %q is not a directory", name)
 		}
-		cleanSuffix := filepath.Clean(suffix)
-		if filepath.IsAbs(cleanSuffix) {
-			return nil, fmt.Errorf("map path %q needs to be relative", name)
+		cleanSuffix, err := cleanScriptPath(suffix)
+		if err != nil {
+			return nil, fmt.Errorf("map path %q %w", name, err)
 		}
-		if !filepath.IsLocal(cleanSuffix) {
-			return nil, fmt.Errorf("map path %q needs to be local", name)
-		}
-		p = filepath.Join(p, cleanSuffix)
-		relPath = filepath.Join(relPath, cleanSuffix)
+		p = filepath.Join(p, filepath.FromSlash(cleanSuffix))
+		relPath = filepath.Join(relPath, filepath.FromSlash(cleanSuffix))
 	}
 	return &ControlledFile{
 		MapName:  resolvedInput.Name,
@@ -180,31 +177,25 @@ func (r *FileResolver) resolveMapInput(name string) (*ControlledFile, error) {
 }
 
 func (r *FileResolver) resolveRPackPath(name string) (*ControlledFile, error) {
-	cleanPath := filepath.Clean(name)
-	if filepath.IsAbs(cleanPath) {
-		return nil, fmt.Errorf("rPack path %q needs to be relative", name)
-	}
-	if !filepath.IsLocal(cleanPath) {
-		return nil, fmt.Errorf("rPack path %q needs to be local", name)
+	cleanPath, err := cleanScriptPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("rPack path %q %w", name, err)
 	}
 
 	return &ControlledFile{
-		AbsPath:  filepath.Join(r.defSourcePath, cleanPath),
+		AbsPath:  filepath.Join(r.defSourcePath, filepath.FromSlash(cleanPath)),
 		Path:     cleanPath,
 		Location: FileResolverLocationRPack,
 	}, nil
 }
 
 func (r *FileResolver) resolveTempPath(name string) (*ControlledFile, error) {
-	cleanPath := filepath.Clean(name)
-	if filepath.IsAbs(cleanPath) {
-		return nil, fmt.Errorf("temp path %q needs to be relative", name)
-	}
-	if !filepath.IsLocal(cleanPath) {
-		return nil, fmt.Errorf("temp input %q needs to be local", name)
+	cleanPath, err := cleanScriptPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("temp path %q %w", name, err)
 	}
 	return &ControlledFile{
-		AbsPath:  filepath.Join(r.tempPath, cleanPath),
+		AbsPath:  filepath.Join(r.tempPath, filepath.FromSlash(cleanPath)),
 		Path:     cleanPath,
 		Location: FileResolverLocationTemp,
 	}, nil
@@ -212,7 +203,7 @@ func (r *FileResolver) resolveTempPath(name string) (*ControlledFile, error) {
 
 // ResolveOutput resolves user defined file paths from script to absolute paths mapping to different locations.
 func (r *FileResolver) ResolveOutput(name string) (*ControlledFile, error) {
-	prefix, suffix, found := strings.Cut(name, ":")
+	prefix, suffix, found := splitPrefix(name)
 	if found {
 		if prefix == "temp" {
 			// Resolve file to the temp directory
@@ -221,15 +212,12 @@ func (r *FileResolver) ResolveOutput(name string) (*ControlledFile, error) {
 		return nil, fmt.Errorf("output path needs to use temp: prefix or no prefix at all")
 	}
 
-	cleanPath := filepath.Clean(prefix)
-	if filepath.IsAbs(cleanPath) {
-		return nil, fmt.Errorf("output path %q needs to be relative", name)
-	}
-	if !filepath.IsLocal(cleanPath) {
-		return nil, fmt.Errorf("output path %q needs to be local", name)
+	cleanPath, err := cleanScriptPath(suffix)
+	if err != nil {
+		return nil, fmt.Errorf("output path %q %w", name, err)
 	}
 	return &ControlledFile{
-		AbsPath:  filepath.Join(r.runPath, cleanPath),
+		AbsPath:  filepath.Join(r.runPath, filepath.FromSlash(cleanPath)),
 		Path:     cleanPath,
 		Location: FileResolverLocationSource,
 	}, nil
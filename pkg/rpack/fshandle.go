@@ -1,11 +1,16 @@
 package rpack
 
 import (
-	"log/slog"
+	"encoding/hex"
+	"hash"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 
 	"fmt"
+
+	"github.com/blang/rpack/pkg/rpack/util"
 )
 
 // FSHandle is returned by resolver and represents a file handle with a friendly name such as
@@ -19,10 +24,25 @@ type FSHandle interface {
 	FriendlyPath() string // Path including prefix
 	// IndirectTargetPath returns the indirect path to the target if it exists, otherwise ""
 	IndirectTargetPath() string
+	// AbsPath returns the absolute path the handle resolves to,
+	// for target files the path in the target directory.
+	AbsPath() string
 	Read() ([]byte, error)
+	// Open opens the file for streaming reads, the caller must close it.
+	Open() (io.ReadCloser, error)
 	Write([]byte) error
+	// Update replaces the written content with the result of fn.
+	// fn receives the current content, exists is false if the file was not written yet.
+	Update(fn func(content []byte, exists bool) ([]byte, error)) error
+	// Checksum returns the hex sha256 of the content written through the handle,
+	// ok is false if nothing was written.
+	Checksum() (sha string, ok bool)
 	Stat() (exists bool, dir bool, err error)
 	ReadDir() (files []FSHandle, dirs []FSHandle, err error)
+	// Remove removes the file, for target files the one written in this run.
+	Remove() error
+	// Rename moves the file to the location written by to, replacing the file there.
+	Rename(to FSHandle) error
 	Transfer(absPath string) error // Transfers a file to a target file location - used for later on relocating
 }
 
@@ -36,11 +56,16 @@ type FileBackedFSHandle struct {
 	resolver     string
 	// Contains the indirect path to the target (repo) if exists
 	indirectTargetPath string
+	// sha is the hex sha256 of the content last written, recorded while writing
+	sha string
+	// algorithm is the lockfile checksum algorithm sum is recorded with, none if empty
+	algorithm string
+	// sum is the hex checksum of the content last written with algorithm, recorded while writing
+	sum string
 }
 
 // NewFileBackedFSHandle creates a new file-backed filesystem handle.
 func NewFileBackedFSHandle(absPath, friendlyPath, resolver, indirectTargetPath string) *FileBackedFSHandle {
-	slog.Debug("New FileBackedFSHandle", "absPath", absPath, "friendlyPath", friendlyPath, "resolver", resolver, "indirectTargetPath", indirectTargetPath)
 	return &FileBackedFSHandle{
 		absPath:            absPath,
 		friendlyPath:       friendlyPath,
@@ -59,39 +84,121 @@ func (f *FileBackedFSHandle) FriendlyPath() string {
 	return f.friendlyPath
 }
 
+// AbsPath returns the resolved path on the filesystem.
+func (f *FileBackedFSHandle) AbsPath() string {
+	return f.absPath
+}
+
 func (f *FileBackedFSHandle) Read() ([]byte, error) {
-	content, err := os.ReadFile(f.absPath)
+	content, err := os.ReadFile(util.LongPath(f.absPath))
 	if err != nil {
 		return nil, fmt.Errorf("could not read %s: %w", f.friendlyPath, err)
 	}
 	return content, nil
 }
 
+// Open opens the file for streaming reads.
+func (f *FileBackedFSHandle) Open() (io.ReadCloser, error) {
+	file, err := os.Open(util.LongPath(f.absPath))
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", f.friendlyPath, err)
+	}
+	return file, nil
+}
+
 func (f *FileBackedFSHandle) Write(b []byte) error {
-	if err := os.MkdirAll(filepath.Dir(f.absPath), 0o755); err != nil { //nolint:gosec // intentional: standard directory permissions
+	if err := os.MkdirAll(util.LongPath(filepath.Dir(f.absPath)), 0o755); err != nil { //nolint:gosec // intentional: standard directory permissions
 		return fmt.Errorf("could not write %s: %w", f.friendlyPath, err)
 	}
-	if err := os.WriteFile(f.absPath, b, 0o644); err != nil { //nolint:gosec // intentional: standard file permissions for package manager output
+	if err := writeFileUnlinked(util.LongPath(f.absPath), b, generatedFilePerm); err != nil {
 		return fmt.Errorf("could not write %s: %w", f.friendlyPath, err)
 	}
+	f.sha = sha256Hex(b)
+	f.sum = ""
+	if f.algorithm != "" {
+		sum, err := checksumBytes(f.algorithm, b)
+		if err != nil {
+			return fmt.Errorf("could not write %s: %w", f.friendlyPath, err)
+		}
+		f.sum = sum
+	}
 	return nil
 }
 
+// writeFrom writes the content of r to the file, hashing it while writing.
+func (f *FileBackedFSHandle) writeFrom(r io.Reader) (sha string, err error) {
+	if err = os.MkdirAll(util.LongPath(filepath.Dir(f.absPath)), 0o755); err != nil { //nolint:gosec // intentional: standard directory permissions
+		return "", fmt.Errorf("could not write %s: %w", f.friendlyPath, err)
+	}
+	if err = removeIfExists(util.LongPath(f.absPath)); err != nil {
+		return "", fmt.Errorf("could not write %s: %w", f.friendlyPath, err)
+	}
+	file, err := os.OpenFile(util.LongPath(f.absPath), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, generatedFilePerm) //nolint:gosec // intentional: path resolved by the sandbox
+	if err != nil {
+		return "", fmt.Errorf("could not write %s: %w", f.friendlyPath, err)
+	}
+	var h hash.Hash
+	if f.algorithm != "" {
+		if h, err = newChecksumHash(f.algorithm); err != nil {
+			_ = file.Close()
+			return "", fmt.Errorf("could not write %s: %w", f.friendlyPath, err)
+		}
+		r = io.TeeReader(r, h)
+	}
+	sha, err = util.CopySha256(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not write %s: %w", f.friendlyPath, err)
+	}
+	f.sha, f.sum = sha, ""
+	if h != nil {
+		f.sum = hex.EncodeToString(h.Sum(nil))
+	}
+	return sha, nil
+}
+
+// Checksum returns the hex sha256 of the content last written through the handle.
+func (f *FileBackedFSHandle) Checksum() (string, bool) {
+	return f.sha, f.sha != ""
+}
+
+// algorithmChecksum returns the hex checksum of the content last written through the handle
+// with the lockfile checksum algorithm of the handle, ok is false if none was recorded.
+func (f *FileBackedFSHandle) algorithmChecksum() (sum string, ok bool) {
+	return f.sum, f.sum != ""
+}
+
+// Update reads the file, passes the content to fn and writes the result.
+func (f *FileBackedFSHandle) Update(fn func(content []byte, exists bool) ([]byte, error)) error {
+	content, err := os.ReadFile(util.LongPath(f.absPath))
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not read %s: %w", f.friendlyPath, err)
+	}
+	b, err := fn(content, exists)
+	if err != nil {
+		return fmt.Errorf("could not update %s: %w", f.friendlyPath, err)
+	}
+	return f.Write(b)
+}
+
 // Stat returns file existence and directory status.
-func (f *FileBackedFSHandle) Stat() (_dir, _exists bool, _err error) {
-	fileInfo, err := os.Stat(f.absPath)
+func (f *FileBackedFSHandle) Stat() (_exists, _dir bool, _err error) {
+	fileInfo, err := os.Stat(util.LongPath(f.absPath))
 	if os.IsNotExist(err) {
 		return false, false, nil
 	} else if err != nil {
 		return false, false, fmt.Errorf("error accessing file: %s: %w", f.friendlyPath, err)
 	}
 
-	return fileInfo.IsDir(), true, nil
+	return true, fileInfo.IsDir(), nil
 }
 
 // ReadDir returns directory entries.
 func (f *FileBackedFSHandle) ReadDir() (_files, _dirs []FSHandle, _err error) {
-	entries, err := os.ReadDir(f.absPath)
+	entries, err := os.ReadDir(util.LongPath(f.absPath))
 	if err != nil {
 		return nil, nil, fmt.Errorf("error readdir: %s: %w", f.friendlyPath, err)
 	}
@@ -99,9 +206,9 @@ func (f *FileBackedFSHandle) ReadDir() (_files, _dirs []FSHandle, _err error) {
 	var dirs []FSHandle
 	for _, e := range entries {
 		absPath := filepath.Join(f.absPath, e.Name())
-		slog.Debug("Friendly path of parent for readdir", "friendlyPath", f.friendlyPath)
-		friendlyPath := filepath.Join(f.friendlyPath, e.Name())
-		indirectTargetPath := filepath.Join(f.indirectTargetPath, e.Name())
+		// Friendly and target paths stay slash separated, see cleanScriptPath
+		friendlyPath := path.Join(f.friendlyPath, e.Name())
+		indirectTargetPath := path.Join(f.indirectTargetPath, e.Name())
 		newHandle := NewFileBackedFSHandle(absPath, friendlyPath, f.resolver, indirectTargetPath)
 		if e.IsDir() {
 			dirs = append(dirs, newHandle)
@@ -112,6 +219,63 @@ func (f *FileBackedFSHandle) ReadDir() (_files, _dirs []FSHandle, _err error) {
 	return files, dirs, nil
 }
 
+// Remove removes the file, directories are not removed.
+func (f *FileBackedFSHandle) Remove() error {
+	info, err := os.Stat(util.LongPath(f.absPath))
+	if err != nil {
+		return fmt.Errorf("could not remove %s: %w", f.friendlyPath, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("could not remove %s: is a directory", f.friendlyPath)
+	}
+	if err = os.Remove(util.LongPath(f.absPath)); err != nil {
+		return fmt.Errorf("could not remove %s: %w", f.friendlyPath, err)
+	}
+	f.sha, f.sum = "", ""
+	return nil
+}
+
+// Rename moves the file to the location to writes to, replacing the file there.
+// The checksum recorded while writing moves along.
+func (f *FileBackedFSHandle) Rename(to FSHandle) error {
+	dst, ok := writableHandle(to)
+	if !ok {
+		return fmt.Errorf("could not rename %s to %s: destination is read-only", f.friendlyPath, to.FriendlyPath())
+	}
+	info, err := os.Stat(util.LongPath(f.absPath))
+	if err != nil {
+		return fmt.Errorf("could not rename %s: %w", f.friendlyPath, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("could not rename %s: is a directory", f.friendlyPath)
+	}
+	if err = os.MkdirAll(util.LongPath(filepath.Dir(dst.absPath)), 0o755); err != nil { //nolint:gosec // intentional: standard directory permissions
+		return fmt.Errorf("could not rename %s to %s: %w", f.friendlyPath, dst.friendlyPath, err)
+	}
+	if err = os.Rename(util.LongPath(f.absPath), util.LongPath(dst.absPath)); err != nil {
+		return fmt.Errorf("could not rename %s to %s: %w", f.friendlyPath, dst.friendlyPath, err)
+	}
+	dst.sha, f.sha = f.sha, ""
+	dst.sum = ""
+	if dst.algorithm == f.algorithm {
+		dst.sum = f.sum
+	}
+	f.sum = ""
+	return nil
+}
+
+// writableHandle returns the file backed handle h writes through, false if h is read-only.
+func writableHandle(h FSHandle) (*FileBackedFSHandle, bool) {
+	switch h := h.(type) {
+	case *FileBackedFSHandle:
+		return h, true
+	case *targetFSHandle:
+		return writableHandle(h.FSHandle)
+	default:
+		return nil, false
+	}
+}
+
 // IndirectTargetPath returns the indirect target path for renaming.
 func (f *FileBackedFSHandle) IndirectTargetPath() string {
 	return f.indirectTargetPath
@@ -120,7 +284,7 @@ func (f *FileBackedFSHandle) IndirectTargetPath() string {
 // Transfer copies the file to the target path.
 // TODO: Might not be used since we implement renaming through IndirectTargetPath
 func (f *FileBackedFSHandle) Transfer(dest string) error {
-	err := os.Rename(f.absPath, dest)
+	err := os.Rename(util.LongPath(f.absPath), util.LongPath(dest))
 	if err != nil {
 		return fmt.Errorf("failed to transfer %s to %s: %w", f.friendlyPath, dest, err)
 	}
@@ -1,6 +1,9 @@
 package getsource
 
-import "testing"
+import (
+	"slices"
+	"testing"
+)
 
 func TestDecompressorMediaTypesConsistent(t *testing.T) {
 	// Every entry in decompressorMediaTypes must have a corresponding
@@ -27,7 +30,8 @@ func TestDecompressorMediaTypesConsistent(t *testing.T) {
 }
 
 func TestGettersList(t *testing.T) {
-	required := []string{"file", "git", "gcs", "s3"}
+	// gcs and s3 depend on build tags, see getters_gcs_test.go and getters_s3_test.go
+	required := []string{"file", "git"}
 	for _, k := range required {
 		if _, ok := Getters[k]; !ok {
 			t.Errorf("expected Getters to contain %q", k)
@@ -35,6 +39,18 @@ func TestGettersList(t *testing.T) {
 	}
 }
 
+func TestProtocols(t *testing.T) {
+	protocols := Protocols()
+	for _, k := range []string{"file", "git", "http", "https", "oci"} {
+		if !slices.Contains(protocols, k) {
+			t.Errorf("expected Protocols to contain %q", k)
+		}
+	}
+	if !slices.IsSorted(protocols) {
+		t.Errorf("expected sorted protocols: %v", protocols)
+	}
+}
+
 func TestDecompressorsList(t *testing.T) {
 	required := []string{"bz2", "gz", "xz", "zip", "tar.bz2", "tar.tbz2", "tar.gz", "tgz", "tar.xz", "txz"}
 	for _, k := range required {
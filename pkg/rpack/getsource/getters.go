@@ -1,13 +1,28 @@
 package getsource
 
-import getter "github.com/hashicorp/go-getter"
+import (
+	"slices"
+
+	getter "github.com/hashicorp/go-getter"
+)
 
 // Getters is the curated map of source getters.
 // The "http", "https", and "oci" schemes are configured dynamically
 // when creating a Fetcher, so they are not included here.
+// The "gcs" and "s3" getters are registered by getters_gcs.go and getters_s3.go,
+// unless left out with the rpack_nogcs and rpack_nos3 build tags.
 var Getters = map[string]getter.Getter{
 	"file": new(getter.FileGetter),
-	"gcs":  new(getter.GCSGetter),
 	"git":  new(getter.GitGetter),
-	"s3":   new(getter.S3Getter),
+}
+
+// Protocols returns the sorted names of all getters a Fetcher supports,
+// including the dynamically configured ones.
+func Protocols() []string {
+	protocols := []string{"http", "https", "oci"}
+	for name := range Getters {
+		protocols = append(protocols, name)
+	}
+	slices.Sort(protocols)
+	return protocols
 }
@@ -0,0 +1,12 @@
+//go:build !rpack_nogcs
+
+package getsource
+
+import (
+	getter "github.com/hashicorp/go-getter"
+)
+
+// init registers the Google Cloud Storage getter, left out of builds with the rpack_nogcs tag.
+func init() {
+	Getters["gcs"] = new(getter.GCSGetter)
+}
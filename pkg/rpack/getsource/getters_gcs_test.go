@@ -0,0 +1,17 @@
+//go:build !rpack_nogcs
+
+package getsource
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGettersGCS(t *testing.T) {
+	if _, ok := Getters["gcs"]; !ok {
+		t.Errorf("expected Getters to contain %q", "gcs")
+	}
+	if !slices.Contains(Protocols(), "gcs") {
+		t.Errorf("expected Protocols to contain %q", "gcs")
+	}
+}
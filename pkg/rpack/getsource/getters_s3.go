@@ -0,0 +1,12 @@
+//go:build !rpack_nos3
+
+package getsource
+
+import (
+	getter "github.com/hashicorp/go-getter"
+)
+
+// init registers the Amazon S3 getter, left out of builds with the rpack_nos3 tag.
+func init() {
+	Getters["s3"] = new(getter.S3Getter)
+}
@@ -0,0 +1,17 @@
+//go:build !rpack_nos3
+
+package getsource
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGettersS3(t *testing.T) {
+	if _, ok := Getters["s3"]; !ok {
+		t.Errorf("expected Getters to contain %q", "s3")
+	}
+	if !slices.Contains(Protocols(), "s3") {
+		t.Errorf("expected Protocols to contain %q", "s3")
+	}
+}
@@ -1,7 +1,9 @@
 package getsource
 
 import (
+	"net/url"
 	"path/filepath"
+	"strings"
 
 	getter "github.com/hashicorp/go-getter"
 )
@@ -26,3 +28,35 @@ func SplitSourceSubdir(result string) (packageAddr, subDir string) {
 	}
 	return packageAddr, subDir
 }
+
+// SourceProtocol returns the getter used for a normalized source address,
+// either the forced getter of getter::addr or the URL scheme.
+func SourceProtocol(normalized string) string {
+	if forced, _, ok := strings.Cut(normalized, "::"); ok && !strings.Contains(forced, "/") {
+		return forced
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme
+}
+
+// PinnedSource reports if a normalized source address always resolves to the same content:
+// a git commit hash as ref, an OCI digest or a checksum verified by the getter.
+func PinnedSource(normalized string) bool {
+	addr := normalized
+	if forced, rest, ok := strings.Cut(normalized, "::"); ok && !strings.Contains(forced, "/") {
+		addr = rest
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return false
+	}
+	query := u.Query()
+	if query.Get("checksum") != "" || query.Get("digest") != "" {
+		return true
+	}
+	ref := query.Get("ref")
+	return (len(ref) == 40 || len(ref) == 64) && strings.Trim(ref, "0123456789abcdef") == ""
+}
@@ -114,3 +114,35 @@ func TestSplitSourceSubdir_GitHubWithSubdir(t *testing.T) {
 	}
 	t.Logf("addr=%s sub=%s", addr, sub)
 }
+
+func TestSourceProtocol(t *testing.T) {
+	tests := map[string]string{
+		"git::https://github.com/user/repo?ref=v1.0.0": "git",
+		"s3::https://s3.amazonaws.com/bucket/def":      "s3",
+		"https://example.com/def.tar.gz":               "https",
+		"file:///tmp/def":                              "file",
+		"oci://registry.example.com/def:v1":            "oci",
+	}
+	for src, want := range tests {
+		if got := SourceProtocol(src); got != want {
+			t.Errorf("SourceProtocol(%q) = %q, expected %q", src, got, want)
+		}
+	}
+}
+
+func TestPinnedSource(t *testing.T) {
+	tests := map[string]bool{
+		"git::https://github.com/user/repo?ref=0123456789abcdef0123456789abcdef01234567": true,
+		"git::https://github.com/user/repo?ref=v1.0.0":                                   false,
+		"git::https://github.com/user/repo":                                              false,
+		"oci://registry.example.com/def?digest=sha256:abc":                               true,
+		"oci://registry.example.com/def?tag=v1":                                          false,
+		"https://example.com/def.tar.gz?checksum=sha256:abc":                             true,
+		"file:///tmp/def": false,
+	}
+	for src, want := range tests {
+		if got := PinnedSource(src); got != want {
+			t.Errorf("PinnedSource(%q) = %v, expected %v", src, got, want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package rpack
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// GitAttributesFile is the name of git's per directory attribute file.
+const GitAttributesFile = ".gitattributes"
+
+// eolPolicy is the line ending a file has in a git checkout.
+type eolPolicy int
+
+const (
+	// eolKeep leaves the file as it is, e.g. binary files
+	eolKeep eolPolicy = iota
+	eolLF
+	eolCRLF
+)
+
+// gitAttrRule is a line of a .gitattributes file.
+// Attribute values are "set", "unset", "unspecified" or the assigned value.
+type gitAttrRule struct {
+	pattern string
+	// anchored patterns match the path relative to the .gitattributes file, others the file name
+	anchored bool
+	attrs    map[string]string
+}
+
+// gitAttributes holds the rules of a single .gitattributes file.
+type gitAttributes struct {
+	rules []gitAttrRule
+}
+
+// parseGitAttributes parses the eol related attributes text, eol and binary.
+// Other attributes and macro definitions are ignored.
+func parseGitAttributes(r io.Reader) (*gitAttributes, error) {
+	ga := &gitAttributes{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			continue
+		}
+		pattern := fields[0]
+		if strings.HasSuffix(pattern, "/") {
+			// Attributes do not apply to directories
+			continue
+		}
+		// A leading slash anchors the pattern, like any other slash in the pattern
+		rule := gitAttrRule{
+			pattern:  strings.TrimPrefix(pattern, "/"),
+			anchored: strings.Contains(pattern, "/"),
+			attrs:    make(map[string]string),
+		}
+		for _, attr := range fields[1:] {
+			switch {
+			case attr == "binary":
+				rule.attrs["text"] = "unset"
+			case strings.HasPrefix(attr, "-"):
+				rule.attrs[attr[1:]] = "unset"
+			case strings.HasPrefix(attr, "!"):
+				rule.attrs[attr[1:]] = "unspecified"
+			default:
+				name, value, ok := strings.Cut(attr, "=")
+				if !ok {
+					value = "set"
+				}
+				rule.attrs[name] = value
+			}
+		}
+		ga.rules = append(ga.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ga, nil
+}
+
+// apply sets the attributes of name, relative to the directory of the file, in attrs.
+// Later lines override earlier ones.
+func (ga *gitAttributes) apply(name string, attrs map[string]string) {
+	name = filepath.ToSlash(name)
+	for _, rule := range ga.rules {
+		target := name
+		if !rule.anchored {
+			target = path.Base(name)
+		}
+		if !matchSegments(strings.Split(rule.pattern, "/"), strings.Split(target, "/")) {
+			continue
+		}
+		for k, v := range rule.attrs {
+			if v == "unspecified" {
+				delete(attrs, k)
+				continue
+			}
+			attrs[k] = v
+		}
+	}
+}
+
+// eolResolver decides the line endings of target files from the .gitattributes files
+// of the target repository and the core.autocrlf and core.eol git settings.
+type eolResolver struct {
+	ctx      context.Context
+	execPath string
+	// root is the top most directory whose .gitattributes file applies
+	root   string
+	files  map[string]*gitAttributes
+	gitCfg map[string]string
+	log    *slog.Logger
+}
+
+func newEOLResolver(ctx context.Context, log *slog.Logger, execPath string) *eolResolver {
+	return &eolResolver{
+		ctx:      ctx,
+		log:      log,
+		execPath: execPath,
+		root:     findRepoRoot(execPath),
+		files:    make(map[string]*gitAttributes),
+	}
+}
+
+// findRepoRoot returns the closest directory containing .git, dir itself if there is none.
+func findRepoRoot(dir string) string {
+	for d := dir; ; {
+		if exists, _ := util.FileExists(filepath.Join(d, ".git")); exists {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// attributes loads the .gitattributes file in dir, nil if there is none.
+func (r *eolResolver) attributes(dir string) (*gitAttributes, error) {
+	if ga, ok := r.files[dir]; ok {
+		return ga, nil
+	}
+	var ga *gitAttributes
+	f, err := os.Open(filepath.Join(dir, GitAttributesFile)) //nolint:gosec // path constructed from target directory
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		defer func() { _ = f.Close() }()
+		if ga, err = parseGitAttributes(f); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, GitAttributesFile), err)
+		}
+	}
+	r.files[dir] = ga
+	return ga, nil
+}
+
+// gitConfig returns a git setting of the target repository, empty if unset or git is unavailable.
+func (r *eolResolver) gitConfig(key string) string {
+	if r.gitCfg == nil {
+		r.gitCfg = make(map[string]string)
+		for _, k := range []string{"core.autocrlf", "core.eol"} {
+			v, err := runGit(r.ctx, r.execPath, "config", "--get", k)
+			if err != nil {
+				r.log.Debug("Git setting not available", "key", k, "error", err)
+			}
+			r.gitCfg[k] = strings.ToLower(v)
+		}
+	}
+	return r.gitCfg[key]
+}
+
+// checkoutEOL is the line ending git uses for text files without eol attribute.
+func (r *eolResolver) checkoutEOL() eolPolicy {
+	switch r.gitConfig("core.autocrlf") {
+	case "true":
+		return eolCRLF
+	case "input":
+		return eolLF
+	}
+	switch r.gitConfig("core.eol") {
+	case "crlf":
+		return eolCRLF
+	case "lf":
+		return eolLF
+	}
+	if runtime.GOOS == "windows" {
+		return eolCRLF
+	}
+	return eolLF
+}
+
+// policy returns the line ending of the target file relPath with the given content.
+func (r *eolResolver) policy(relPath string, content []byte) (eolPolicy, error) {
+	abs := filepath.Join(r.execPath, relPath)
+	rel, err := filepath.Rel(r.root, abs)
+	if err != nil {
+		return eolKeep, err
+	}
+	// Apply the files from the root down, deeper files take precedence
+	attrs := make(map[string]string)
+	dir := r.root
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		ga, err := r.attributes(dir)
+		if err != nil {
+			return eolKeep, err
+		}
+		if ga != nil {
+			ga.apply(filepath.Join(parts[i:]...), attrs)
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+
+	text, hasText := attrs["text"]
+	if text == "unset" {
+		return eolKeep, nil
+	}
+	if !hasText {
+		// Without text attribute core.autocrlf decides, like text=auto
+		switch r.gitConfig("core.autocrlf") {
+		case "true", "input":
+			text = "auto"
+		default:
+			if _, ok := attrs["eol"]; !ok {
+				return eolKeep, nil
+			}
+			// eol implies text
+			text = "set"
+		}
+	}
+	if text == "auto" && isBinary(content) {
+		return eolKeep, nil
+	}
+	switch attrs["eol"] {
+	case "lf":
+		return eolLF, nil
+	case "crlf":
+		return eolCRLF, nil
+	}
+	return r.checkoutEOL(), nil
+}
+
+// convertEOL converts the line endings of content to policy.
+func convertEOL(content []byte, policy eolPolicy) []byte {
+	if policy == eolKeep {
+		return content
+	}
+	lf := bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	if policy == eolLF {
+		return lf
+	}
+	return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n"))
+}
+
+// applyGitAttributes converts the line endings of the generated files in the run directories
+// to the ones a git checkout of the target has, so they do not show up as modified.
+// The checksums recorded while writing are updated for the converted files.
+func applyGitAttributes(ctx context.Context, log *slog.Logger, execPath string, runs []*packRun) error {
+	resolver := newEOLResolver(ctx, log, execPath)
+	var converted []string
+	for _, run := range runs {
+		visited := make(map[string]struct{})
+		for _, handle := range run.FS.TargetWriteHandles() {
+			relPath := handle.IndirectTargetPath()
+			if _, ok := visited[relPath]; ok {
+				continue
+			}
+			visited[relPath] = struct{}{}
+			if run.FS.binaryTarget(relPath) {
+				continue
+			}
+			absPath := filepath.Join(run.Instance.RunPath, relPath)
+			content, err := os.ReadFile(util.LongPath(absPath)) //nolint:gosec // path constructed from run directory
+			if err != nil {
+				return fmt.Errorf("failed to read generated file: %s: %w", relPath, err)
+			}
+			policy, err := resolver.policy(relPath, content)
+			if err != nil {
+				return fmt.Errorf("failed to resolve git attributes of: %s: %w", relPath, err)
+			}
+			out := convertEOL(content, policy)
+			if bytes.Equal(out, content) {
+				continue
+			}
+			info, err := os.Stat(util.LongPath(absPath))
+			if err != nil {
+				return err
+			}
+			if err = writeFileUnlinked(util.LongPath(absPath), out, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("failed to convert line endings of: %s: %w", relPath, err)
+			}
+			run.FS.setRewrittenChecksum(relPath, sha256Hex(out))
+			converted = append(converted, relPath)
+		}
+	}
+	if len(converted) > 0 {
+		log.Debug("Converted line endings according to .gitattributes", "files", converted)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package rpack
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestParseGitAttributes(t *testing.T) {
+	ga, err := parseGitAttributes(strings.NewReader(`# comment
+* text=auto
+*.sh text eol=lf
+/root.bat eol=crlf
+docs/** -text
+*.png binary
+vendor/ !text
+*.md !text
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want map[string]string
+	}{
+		{"a/b.txt", map[string]string{"text": "auto"}},
+		{"a/run.sh", map[string]string{"text": "set", "eol": "lf"}},
+		{"root.bat", map[string]string{"text": "auto", "eol": "crlf"}},
+		{"sub/root.bat", map[string]string{"text": "auto"}},
+		{"docs/x/y.txt", map[string]string{"text": "unset"}},
+		{"img/logo.png", map[string]string{"text": "unset"}},
+		{"README.md", map[string]string{}},
+	}
+	for _, tt := range tests {
+		attrs := make(map[string]string)
+		ga.apply(filepath.FromSlash(tt.name), attrs)
+		if len(attrs) != len(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, attrs)
+			continue
+		}
+		for k, v := range tt.want {
+			if attrs[k] != v {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, attrs)
+			}
+		}
+	}
+}
+
+func TestEOLResolverPolicy(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{".git", "app"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+	}
+	execPath := filepath.Join(root, "app")
+	files := map[string]string{
+		".gitattributes":     "* text=auto eol=lf\n*.bat eol=crlf\n*.bin -text\n",
+		"app/.gitattributes": "*.txt eol=crlf\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		autocrlf string
+		want     eolPolicy
+	}{
+		{"main.go", "a\r\n", "", eolLF},
+		{"run.bat", "a\n", "", eolCRLF},
+		{"notes.txt", "a\n", "", eolCRLF},
+		{"data.bin", "a\n", "", eolKeep},
+		{"image.dat", "a\x00\n", "", eolKeep},
+		{"sub/main.go", "a\r\n", "true", eolLF},
+	}
+	for _, tt := range tests {
+		r := newEOLResolver(t.Context(), slog.Default(), execPath)
+		r.gitCfg = map[string]string{"core.autocrlf": tt.autocrlf}
+		got, err := r.policy(filepath.FromSlash(tt.name), []byte(tt.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected policy %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestEOLResolverAutoCRLF(t *testing.T) {
+	execPath := t.TempDir()
+	r := newEOLResolver(t.Context(), slog.Default(), execPath)
+	for autocrlf, want := range map[string]eolPolicy{"true": eolCRLF, "input": eolLF, "false": eolKeep} {
+		r.gitCfg = map[string]string{"core.autocrlf": autocrlf}
+		if got, err := r.policy("file.txt", []byte("a\n")); err != nil || got != want {
+			t.Errorf("autocrlf=%s: expected policy %d, got %d: %v", autocrlf, want, got, err)
+		}
+	}
+	r.gitCfg = map[string]string{"core.autocrlf": "true"}
+	if got, _ := r.policy("file.bin", []byte("\x00\n")); got != eolKeep {
+		t.Errorf("Expected binary file to be kept, got %d", got)
+	}
+}
+
+func TestConvertEOL(t *testing.T) {
+	in := []byte("a\r\nb\nc")
+	if got := string(convertEOL(in, eolLF)); got != "a\nb\nc" {
+		t.Errorf("Unexpected LF conversion %q", got)
+	}
+	if got := string(convertEOL(in, eolCRLF)); got != "a\r\nb\r\nc" {
+		t.Errorf("Unexpected CRLF conversion %q", got)
+	}
+	if got := string(convertEOL(in, eolKeep)); got != string(in) {
+		t.Errorf("Unexpected conversion %q", got)
+	}
+}
+
+func TestRunGitAttributes(t *testing.T) {
+	script := `rpack.write("./win.txt", "a\nb\n")
+rpack.write("./unix.sh", "a\r\nb\r\n")
+rpack.write("./raw.txt", "x\r\ny\n")
+rpack.write_bytes("./bytes.txt", "a\nb\n")
+`
+	config, workDir := setupRunConfig(t, script, "gitattributes: true\n")
+	attrs := "*.txt text eol=crlf\n*.sh text eol=lf\nraw.txt -text\n"
+	if err := os.WriteFile(filepath.Join(workDir, ".gitattributes"), []byte(attrs), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"win.txt": "a\r\nb\r\n",
+		"unix.sh": "a\nb\n",
+		"raw.txt": "x\r\ny\n",
+		// Content written as bytes is kept exactly
+		"bytes.txt": "a\nb\n",
+	} {
+		b, err := os.ReadFile(filepath.Join(workDir, name)) //nolint:gosec // test file
+		if err != nil || string(b) != want {
+			t.Errorf("%s: expected %q, got %q: %v", name, want, b, err)
+		}
+	}
+
+	// The lockfile matches the converted files, a second run does not see modifications
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatalf("Expected converted files to match the lockfile: %v", err)
+	}
+}
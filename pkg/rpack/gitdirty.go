@@ -0,0 +1,104 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// Modes of the check for uncommitted changes of target files before the apply, see Executor.GitDirty.
+const (
+	// GitDirtyWarn logs the files with uncommitted changes that are overwritten or removed
+	GitDirtyWarn = "warn"
+	// GitDirtyFail refuses to apply if files with uncommitted changes would be overwritten or removed
+	GitDirtyFail = "fail"
+)
+
+// gitDirtyFiles returns the paths, relative to execPath and slash separated, whose files have changes
+// not committed to git, staged or not. Untracked files are not reported, the files a previous run
+// generated are often not committed yet. Targets outside of a git repository have no dirty files.
+func gitDirtyFiles(ctx context.Context, execPath string, paths []string) ([]string, error) {
+	if exists, _ := util.FileExists(filepath.Join(findRepoRoot(execPath), ".git")); !exists {
+		return nil, nil
+	}
+	prefix, err := runGit(ctx, execPath, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	// The status is not trimmed like runGit does, the first column of an entry may be a space
+	cmd := exec.CommandContext(ctx, "git", "status", "--porcelain=v1", "-z", "--untracked-files=no", "--", ".")
+	cmd.Dir = execPath
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var dirty []string
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		names := []string{entry[3:]}
+		// Renames and copies are followed by the original path
+		if (entry[0] == 'R' || entry[0] == 'C') && i+1 < len(entries) {
+			i++
+			names = append(names, entries[i])
+		}
+		for _, name := range names {
+			rel, ok := strings.CutPrefix(name, prefix)
+			if ok && slices.Contains(paths, rel) && !slices.Contains(dirty, rel) {
+				dirty = append(dirty, rel)
+			}
+		}
+	}
+	slices.Sort(dirty)
+	return dirty, nil
+}
+
+// ValidateGitDirtyMode fails if mode is not a mode of Executor.GitDirty, empty disables the check.
+func ValidateGitDirtyMode(mode string) error {
+	switch mode {
+	case "", GitDirtyWarn, GitDirtyFail:
+		return nil
+	default:
+		return fmt.Errorf("invalid git dirty mode %q, use %q or %q: %w", mode, GitDirtyWarn, GitDirtyFail, ErrValidation)
+	}
+}
+
+// checkGitDirty warns about or, with GitDirtyFail, refuses overwriting or removing the target files
+// in paths that have uncommitted changes in git. Force only warns. Without git the check is skipped.
+// If git fails, GitDirtyWarn warns and GitDirtyFail returns the error.
+func (e *Executor) checkGitDirty(ctx context.Context, execPath string, paths []string) error {
+	if e.GitDirty == "" {
+		return nil
+	}
+	if err := ValidateGitDirtyMode(e.GitDirty); err != nil {
+		return err
+	}
+	dirty, err := gitDirtyFiles(ctx, execPath, paths)
+	if err != nil {
+		if e.GitDirty == GitDirtyFail {
+			return fmt.Errorf("could not check target files for uncommitted changes: %w", err)
+		}
+		e.log().Warn("Could not check target files for uncommitted changes", "error", err)
+		return nil
+	}
+	if len(dirty) == 0 {
+		return nil
+	}
+	e.log().Warn("Files with uncommitted changes will be overwritten or removed", "files", dirty)
+	if e.GitDirty == GitDirtyFail && !e.Force {
+		return fmt.Errorf("files with uncommitted changes would be overwritten or removed, commit or stash them or use force flag to ignore: %s: %w",
+			strings.Join(dirty, ","), ErrGitDirty)
+	}
+	return nil
+}
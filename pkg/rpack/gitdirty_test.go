@@ -0,0 +1,79 @@
+package rpack
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestRunGitDirty(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"v1\\n\")\n", "")
+	repo := filepath.Dir(workDir)
+	script := filepath.Join(repo, "def", "script.lua")
+	setScript := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(script, []byte("local rpack = require(\"rpack.v1\")\nrpack.write(\"./out.txt\", \""+content+"\\n\")\n"), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		t.Helper()
+		if _, err := runGit(t.Context(), repo, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, GitDirty: GitDirtyFail, NoGitIgnore: true}); err != nil {
+		t.Fatalf("Expected untracked files not to be dirty: %v", err)
+	}
+	git("add", "-A")
+	git("commit", "-q", "-m", "generated")
+
+	setScript("v2")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, GitDirty: GitDirtyFail, NoGitIgnore: true}); err != nil {
+		t.Fatalf("Expected committed files not to be dirty: %v", err)
+	}
+
+	// The uncommitted output of the previous run is protected
+	setScript("v3")
+	_, err := Run(t.Context(), api.RunOptions{ConfigFile: config, GitDirty: GitDirtyFail, NoGitIgnore: true})
+	if !errors.Is(err, ErrGitDirty) {
+		t.Fatalf("Expected ErrGitDirty, got %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "v2\n" { //nolint:gosec // test file
+		t.Errorf("Expected the target untouched, got %q", b)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config, GitDirty: GitDirtyWarn, NoGitIgnore: true}); err != nil {
+		t.Fatalf("Expected warn mode to apply: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "v3\n" { //nolint:gosec // test file
+		t.Errorf("Expected the target applied, got %q", b)
+	}
+
+	// Invalid modes fail before anything runs, dry-runs included
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config, GitDirty: "strict", DryRun: true}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected an invalid mode to fail the dry-run, got %v", err)
+	}
+
+	// Git failing does not let the fail mode pass
+	setScript("v4")
+	if err = os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("broken"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config, GitDirty: GitDirtyFail, NoGitIgnore: true}); err == nil {
+		t.Error("Expected the fail mode to fail if git fails")
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "v3\n" { //nolint:gosec // test file
+		t.Errorf("Expected the target untouched, got %q", b)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config, GitDirty: GitDirtyWarn, NoGitIgnore: true}); err != nil {
+		t.Errorf("Expected the warn mode to apply if git fails: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package rpack
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// GitIgnoreFile is the name of git's per directory ignore file.
+const GitIgnoreFile = ".gitignore"
+
+// Markers of the block of the .gitignore file managed by rpack.
+const (
+	gitIgnoreBlockBegin = "# BEGIN rpack managed block"
+	gitIgnoreBlockEnd   = "# END rpack managed block"
+)
+
+// gitIgnoreEntries are the lines of the managed block, rpack internals relative to the target.
+var gitIgnoreEntries = []string{"/" + RPackCacheDir + "/"}
+
+// ensureGitIgnore makes sure the .gitignore file in execPath ignores the rpack internals,
+// using a marker block it updates on later runs. Entries the user already ignores are not repeated.
+// Targets outside of a git repository are left alone. It reports if the file was changed.
+func ensureGitIgnore(execPath string) (bool, error) {
+	if exists, _ := util.FileExists(filepath.Join(findRepoRoot(execPath), ".git")); !exists {
+		return false, nil
+	}
+	name := filepath.Join(execPath, GitIgnoreFile)
+	content, err := os.ReadFile(name) //nolint:gosec // path constructed from target directory
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	out := updateGitIgnore(content, gitIgnoreEntries)
+	if bytes.Equal(out, content) {
+		return false, nil
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(name); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(name, out, mode); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// updateGitIgnore replaces the managed block of content with entries that are not ignored
+// by other lines, appending the block if there is none. The block is removed if it is empty.
+func updateGitIgnore(content []byte, entries []string) []byte {
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+	var before, after []string
+	inBlock, hasBlock := false, false
+	for _, line := range lines {
+		switch {
+		case strings.TrimSpace(line) == gitIgnoreBlockBegin:
+			inBlock, hasBlock = true, true
+		case strings.TrimSpace(line) == gitIgnoreBlockEnd && inBlock:
+			inBlock = false
+		case inBlock:
+		case hasBlock:
+			after = append(after, line)
+		default:
+			before = append(before, line)
+		}
+	}
+
+	var block []string
+	for _, entry := range entries {
+		if !gitIgnoreListed(before, entry) && !gitIgnoreListed(after, entry) {
+			block = append(block, entry)
+		}
+	}
+
+	res := slices.Clone(before)
+	if len(block) > 0 {
+		if len(res) > 0 && !hasBlock && strings.TrimSpace(res[len(res)-1]) != "" {
+			res = append(res, "")
+		}
+		res = append(res, gitIgnoreBlockBegin)
+		res = append(res, block...)
+		res = append(res, gitIgnoreBlockEnd)
+	}
+	res = append(res, after...)
+	if len(res) == 0 {
+		return nil
+	}
+	out := strings.Join(res, "\n") + "\n"
+	if bytes.Contains(content, []byte("\r\n")) {
+		out = strings.ReplaceAll(out, "\n", "\r\n")
+	}
+	if out == string(content) {
+		return content
+	}
+	return []byte(out)
+}
+
+// gitIgnoreListed reports if one of lines ignores the directory entry, with or without slashes.
+func gitIgnoreListed(lines []string, entry string) bool {
+	want := strings.Trim(entry, "/")
+	for _, line := range lines {
+		if strings.Trim(strings.TrimSpace(line), "/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestUpdateGitIgnore(t *testing.T) {
+	block := gitIgnoreBlockBegin + "\n/.rpack.d/\n" + gitIgnoreBlockEnd + "\n"
+	tests := []struct {
+		name, in, want string
+	}{
+		{"empty", "", block},
+		{"append", "node_modules/\n", "node_modules/\n\n" + block},
+		{"no trailing newline", "bin", "bin\n\n" + block},
+		{"up to date", "a\n\n" + block + "b\n", "a\n\n" + block + "b\n"},
+		{"replace block", "a\n" + gitIgnoreBlockBegin + "\n/old/\n" + gitIgnoreBlockEnd + "\nb\n", "a\n" + block + "b\n"},
+		{"already ignored", ".rpack.d\n", ".rpack.d\n"},
+		{"remove obsolete block", ".rpack.d/\n" + block, ".rpack.d/\n"},
+		{"crlf", "bin\r\n", "bin\r\n\r\n" + gitIgnoreBlockBegin + "\r\n/.rpack.d/\r\n" + gitIgnoreBlockEnd + "\r\n"},
+	}
+	for _, tt := range tests {
+		if got := string(updateGitIgnore([]byte(tt.in), gitIgnoreEntries)); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRunGitIgnore(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"hello\\n\")\n", "")
+	gitignore := filepath.Join(workDir, GitIgnoreFile)
+
+	// Outside of a git repository the target is left alone
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(gitignore); !os.IsNotExist(err) {
+		t.Fatalf("Expected no .gitignore outside of a repository, got %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(workDir, ".git"), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, NoGitIgnore: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(gitignore); !os.IsNotExist(err) {
+		t.Fatalf("Expected no .gitignore with NoGitIgnore, got %v", err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(gitignore); err != nil || string(b) != gitIgnoreBlockBegin+"\n/.rpack.d/\n"+gitIgnoreBlockEnd+"\n" { //nolint:gosec // test file
+		t.Errorf("Expected managed block in .gitignore, got %q: %v", b, err)
+	}
+}
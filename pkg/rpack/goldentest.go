@@ -0,0 +1,174 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Files of a golden test directory.
+const (
+	// GoldenTestFilename holds the values and inputs of a golden test
+	GoldenTestFilename = "test.yaml"
+	// GoldenTestDir holds the expected output files of a golden test
+	GoldenTestDir = "golden"
+)
+
+// GoldenTest is the test.yaml of a golden test, it runs the definition like rpack run --def.
+type GoldenTest struct {
+	// Values passed to the definition
+	Values map[string]any `json:"values"`
+	// Inputs map input names to fixture paths relative to the test directory
+	Inputs map[string]string `json:"inputs"`
+}
+
+// GoldenMismatch is an output file differing from its golden file.
+type GoldenMismatch struct {
+	// Path relative to the output directory
+	Path string
+	// Diff is the unified diff from the golden file to the output
+	Diff string
+}
+
+// LoadGoldenTest loads the test.yaml of a golden test.
+func LoadGoldenTest(name string) (*GoldenTest, error) {
+	return Loader{}.LoadGoldenTest(name)
+}
+
+// LoadGoldenTest is LoadGoldenTest decoding with the options of l.
+func (l Loader) LoadGoldenTest(name string) (*GoldenTest, error) {
+	b, err := os.ReadFile(name) //nolint:gosec // intentional: path comes from test discovery
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %s: %w", name, err)
+	}
+	var t GoldenTest
+	if err = l.unmarshalYAML(b, &t); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml in file: %s: %w: %w", name, ErrValidation, annotateYAMLError(name, err))
+	}
+	return &t, nil
+}
+
+// RunGoldenTest runs the definition in defDir with the values and inputs of the golden test in testDir
+// and compares the output with the files in its golden directory.
+// With update the golden directory is replaced by the output and no mismatches are reported.
+func (e *Executor) RunGoldenTest(ctx context.Context, defDir, testDir string, update bool) ([]*GoldenMismatch, error) {
+	test, err := e.loader().LoadGoldenTest(filepath.Join(testDir, GoldenTestFilename))
+	if err != nil {
+		return nil, err
+	}
+	inputs := make(map[string]string, len(test.Inputs))
+	for name, p := range test.Inputs {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(testDir, filepath.FromSlash(p))
+		}
+		inputs[name] = p
+	}
+
+	tmpDir, err := os.MkdirTemp("", "rpack-golden-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create output directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	outDir := filepath.Join(tmpDir, "out")
+
+	run := *e
+	run.DryRun = false
+	run.OutputDir = outDir
+	run.Force = false
+	if err = run.ExecRPackDirect(ctx, defDir, test.Values, inputs); err != nil {
+		return nil, err
+	}
+	// meta.json describes the run, it is not an output of the definition
+	if err = os.Remove(filepath.Join(outDir, "meta.json")); err != nil {
+		return nil, fmt.Errorf("could not remove meta.json: %w", err)
+	}
+
+	goldenDir := filepath.Join(testDir, GoldenTestDir)
+	if update {
+		if err = os.RemoveAll(goldenDir); err != nil {
+			return nil, fmt.Errorf("could not remove golden directory: %w", err)
+		}
+		if err = os.MkdirAll(goldenDir, 0o755); err != nil { //nolint:gosec // standard permissions
+			return nil, fmt.Errorf("could not create golden directory: %w", err)
+		}
+		if err = copyDir(outDir, goldenDir); err != nil {
+			return nil, fmt.Errorf("failed to update golden directory: %w", err)
+		}
+		return nil, nil
+	}
+	return compareGoldenDir(goldenDir, outDir)
+}
+
+// compareGoldenDir compares the files of outDir with the files of goldenDir, sorted by path.
+// A missing golden directory is treated as empty.
+func compareGoldenDir(goldenDir, outDir string) ([]*GoldenMismatch, error) {
+	golden, err := listGoldenFiles(goldenDir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := listGoldenFiles(outDir)
+	if err != nil {
+		return nil, err
+	}
+	paths := slices.Concat(golden, out)
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+
+	var mismatches []*GoldenMismatch
+	for _, p := range paths {
+		want, wantExists, err := readTargetFile(filepath.Join(goldenDir, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read golden file: %s: %w", p, err)
+		}
+		got, gotExists, err := readTargetFile(filepath.Join(outDir, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output file: %s: %w", p, err)
+		}
+		if wantExists && gotExists && bytes.Equal(want, got) {
+			continue
+		}
+		oldName, newName := "golden/"+p, "output/"+p
+		if !wantExists {
+			oldName = "/dev/null"
+		}
+		if !gotExists {
+			newName = "/dev/null"
+		}
+		diff := fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+		if !isBinary(want) && !isBinary(got) {
+			diff = UnifiedDiff(oldName, newName, want, got)
+		}
+		mismatches = append(mismatches, &GoldenMismatch{Path: p, Diff: diff})
+	}
+	return mismatches, nil
+}
+
+// listGoldenFiles lists the files below dir as slash separated relative paths, nil if dir does not exist.
+func listGoldenFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not list files of %s: %w", dir, err)
+	}
+	return files, nil
+}
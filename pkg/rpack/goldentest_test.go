@@ -0,0 +1,70 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunGoldenTest(t *testing.T) {
+	defDir := t.TempDir()
+	files := map[string]string{
+		"rpack.yaml": "\"@schema_version\": \"v1\"\nname: \"golden\"\ninputs:\n  - name: names\n    type: file\n",
+		"script.lua": "local rpack = require(\"rpack.v1\")\n" +
+			"rpack.write(\"out/greeting.txt\", \"hello \" .. rpack.values().name .. \"\\n\")\n" +
+			"rpack.copy(\"map:names\", \"names.txt\")\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(defDir, name), []byte(content), 0o644); err != nil { //nolint:gosec // test files
+			t.Fatal(err)
+		}
+	}
+	testDir := filepath.Join(defDir, "tests", "basic")
+	if err := os.MkdirAll(filepath.Join(testDir, "fixtures"), 0o755); err != nil { //nolint:gosec // test directory
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, "fixtures", "names.txt"), []byte("a\nb\n"), 0o644); err != nil { //nolint:gosec // test files
+		t.Fatal(err)
+	}
+	testYAML := "values:\n  name: world\ninputs:\n  names: fixtures/names.txt\n"
+	if err := os.WriteFile(filepath.Join(testDir, GoldenTestFilename), []byte(testYAML), 0o644); err != nil { //nolint:gosec // test files
+		t.Fatal(err)
+	}
+
+	// Without golden files every output file is a mismatch
+	e := &Executor{}
+	mismatches, err := e.RunGoldenTest(t.Context(), defDir, testDir, false)
+	if err != nil {
+		t.Fatalf("RunGoldenTest failed: %v", err)
+	}
+	if len(mismatches) != 2 || mismatches[0].Path != "names.txt" || mismatches[1].Path != "out/greeting.txt" {
+		t.Fatalf("expected mismatches for both files, got %+v", mismatches)
+	}
+
+	if _, err = e.RunGoldenTest(t.Context(), defDir, testDir, true); err != nil {
+		t.Fatalf("RunGoldenTest update failed: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(testDir, GoldenTestDir, "out", "greeting.txt"))
+	if err != nil || string(b) != "hello world\n" {
+		t.Fatalf("unexpected golden file: %q, %v", b, err)
+	}
+	if _, err = os.Stat(filepath.Join(testDir, GoldenTestDir, "meta.json")); !os.IsNotExist(err) {
+		t.Fatalf("meta.json must not be a golden file: %v", err)
+	}
+	if mismatches, err = e.RunGoldenTest(t.Context(), defDir, testDir, false); err != nil || len(mismatches) != 0 {
+		t.Fatalf("expected no mismatches after update, got %+v, %v", mismatches, err)
+	}
+
+	// Changed output is reported as diff
+	if err = os.WriteFile(filepath.Join(testDir, GoldenTestDir, "out", "greeting.txt"), []byte("hello there\n"), 0o644); err != nil { //nolint:gosec // test files
+		t.Fatal(err)
+	}
+	mismatches, err = e.RunGoldenTest(t.Context(), defDir, testDir, false)
+	if err != nil || len(mismatches) != 1 {
+		t.Fatalf("expected one mismatch, got %+v, %v", mismatches, err)
+	}
+	if !strings.Contains(mismatches[0].Diff, "-hello there\n+hello world\n") {
+		t.Errorf("unexpected diff:\n%s", mismatches[0].Diff)
+	}
+}
@@ -0,0 +1,210 @@
+package rpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blang/rpack/pkg/api"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// RPackCacheDirHistory is the directory below RPackCacheDir the run history is stored in,
+// one JSON lines file per config.
+const RPackCacheDirHistory = "history"
+
+// historyMaxEntries is the number of runs kept in the history of a config, older runs are dropped.
+const historyMaxEntries = 200
+
+// historyMaxErrorLen is the maximum length of the error message of a failed run in the history.
+const historyMaxErrorLen = 300
+
+// HistoryEntry is the compact summary of a run against the target, failed runs included.
+// Unlike run reports it is recorded for every run, so it shows when a change was introduced.
+type HistoryEntry struct {
+	Time       time.Time `json:"time"`
+	DurationMs int64     `json:"duration_ms"`
+	Success    bool      `json:"success"`
+	// Error of a failed run, secrets are redacted
+	Error string         `json:"error,omitempty"`
+	Packs []*HistoryPack `json:"packs,omitempty"`
+	// Added, Changed and Removed count the target files of the apply
+	Added   int `json:"added"`
+	Changed int `json:"changed"`
+	Removed int `json:"removed"`
+}
+
+// HistoryPack records which definition a pack ran.
+type HistoryPack struct {
+	// Name of the pack, empty for single source configs
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source"`
+	// Checksum over all files of the fetched definition
+	SourceDigest string `json:"source_digest"`
+}
+
+// HistoryFile returns the history file of a config below execPath.
+func HistoryFile(execPath, configName string) string {
+	return filepath.Join(execPath, RPackCacheDir, RPackCacheDirHistory, configName+".jsonl")
+}
+
+// recordPacks records the definitions of the loaded packs, the digests of unreadable sources are left empty.
+func (h *HistoryEntry) recordPacks(instances []*RPackInstance) {
+	for _, pi := range instances {
+		digest, err := util.Sha256Dir(pi.SourcePath)
+		if err != nil {
+			digest = ""
+		}
+		h.Packs = append(h.Packs, &HistoryPack{Name: pi.Pack.Name, Source: stripSourceCredentials(pi.Pack.Source), SourceDigest: digest})
+	}
+}
+
+// finish records the outcome of the run.
+func (h *HistoryEntry) finish(err error) {
+	h.DurationMs = time.Since(h.Time).Milliseconds()
+	h.Success = err == nil
+	if err != nil {
+		msg := RedactSecrets(err.Error())
+		if len(msg) > historyMaxErrorLen {
+			// Cut on a rune boundary, the message stays valid UTF-8
+			cut := historyMaxErrorLen
+			for cut > 0 && !utf8.RuneStart(msg[cut]) {
+				cut--
+			}
+			msg = msg[:cut] + "..."
+		}
+		h.Error = msg
+	}
+}
+
+// appendHistory appends entry to the history file name, dropping the oldest runs beyond historyMaxEntries.
+func appendHistory(name string, entry *HistoryEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0o755); err != nil { //nolint:gosec // standard permissions
+		return fmt.Errorf("could not create history dir: %w", err)
+	}
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644) //nolint:gosec // standard permissions for state files
+	if err != nil {
+		return fmt.Errorf("could not open history: %w", err)
+	}
+	_, err = f.Write(append(b, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write history: %w", err)
+	}
+	return trimHistory(name)
+}
+
+// trimHistory drops the oldest lines of the history file name beyond historyMaxEntries.
+func trimHistory(name string) error {
+	b, err := os.ReadFile(name) //nolint:gosec // path below .rpack.d
+	if err != nil {
+		return err
+	}
+	lines := bytes.SplitAfter(bytes.TrimSuffix(b, []byte("\n")), []byte("\n"))
+	if len(lines) <= historyMaxEntries {
+		return nil
+	}
+	kept := bytes.Join(lines[len(lines)-historyMaxEntries:], nil)
+	return writeFileAtomic(name, append(bytes.TrimSuffix(kept, []byte("\n")), '\n'), 0o644)
+}
+
+// writeFileAtomic writes b to a temp file next to name and renames it over name.
+func writeFileAtomic(name string, b []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// LoadHistory reads the history of a config below execPath, oldest run first.
+// A config without runs has an empty history.
+func LoadHistory(execPath, configName string) ([]*HistoryEntry, error) {
+	f, err := os.Open(HistoryFile(execPath, configName)) //nolint:gosec // path below .rpack.d
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return readHistory(f)
+}
+
+// readHistory parses history entries, one JSON object per line.
+func readHistory(r io.Reader) ([]*HistoryEntry, error) {
+	var entries []*HistoryEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("could not parse history line %d: %w", line, err)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, scanner.Err()
+}
+
+// HistoryConfigs returns the names of the configs with a history below execPath, sorted.
+func HistoryConfigs(execPath string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(execPath, RPackCacheDir, RPackCacheDirHistory, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = strings.TrimSuffix(filepath.Base(m), ".jsonl")
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// HistoryConfigName returns the name the history of the config file is stored under, e.g. app for app.rpack.yaml.
+func HistoryConfigName(configFile string) string {
+	return strings.TrimSuffix(filepath.Base(configFile), RPackFileSuffix)
+}
+
+// recordHistory appends the outcome of a run of ci to its history.
+// The history is informational, failing to write it does not fail the run.
+func (e *Executor) recordHistory(ci *RPackConfigInstance, entry *HistoryEntry, res *api.RunResult, err error) {
+	if res != nil {
+		entry.Added, entry.Removed = len(res.Added), len(res.Removed)
+	}
+	entry.finish(err)
+	execPath := ci.ConfigPath
+	if e.OverrideExecPath != "" {
+		execPath = e.OverrideExecPath
+	}
+	if histErr := appendHistory(HistoryFile(execPath, runReportConfigName(ci)), entry); histErr != nil {
+		e.log().Warn("Failed to record run history", "error", histErr)
+	}
+}
@@ -0,0 +1,96 @@
+package rpack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestRunHistory(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./a.txt\", \"a\\n\")\nrpack.write(\"./b.txt\", \"b\\n\")\n", "")
+	script := filepath.Join(filepath.Dir(workDir), "def", "script.lua")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, []byte("local rpack = require(\"rpack.v1\")\nrpack.write(\"./a.txt\", \"changed\\n\")\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, []byte("error(\"broken\")\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err == nil {
+		t.Fatal("Expected the run to fail")
+	}
+
+	entries, err := LoadHistory(workDir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 runs without the dry-run, got %d", len(entries))
+	}
+	for i, want := range []HistoryEntry{
+		{Success: true, Added: 2},
+		{Success: true, Changed: 1, Removed: 1},
+		{Success: false},
+	} {
+		got := entries[i]
+		if got.Success != want.Success || got.Added != want.Added || got.Changed != want.Changed || got.Removed != want.Removed {
+			t.Errorf("Run %d: expected %+v, got %+v", i, want, *got)
+		}
+		if len(got.Packs) != 1 || len(got.Packs[0].SourceDigest) != 64 {
+			t.Errorf("Run %d: expected the source digest, got %+v", i, got.Packs)
+		}
+	}
+	if entries[0].Packs[0].SourceDigest == entries[1].Packs[0].SourceDigest {
+		t.Error("Expected the changed definition to have another digest")
+	}
+	if !strings.Contains(entries[2].Error, "broken") {
+		t.Errorf("Expected the error recorded, got %q", entries[2].Error)
+	}
+	if configs, err := HistoryConfigs(workDir); err != nil || len(configs) != 1 || configs[0] != HistoryConfigName(config) {
+		t.Errorf("Expected history of app, got %v, %v", configs, err)
+	}
+}
+
+func TestAppendHistoryTrims(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.jsonl")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range historyMaxEntries + 5 {
+		if err := appendHistory(name, &HistoryEntry{Time: start.Add(time.Duration(i) * time.Minute), Success: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(name) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	entries, err := readHistory(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != historyMaxEntries || !entries[0].Time.Equal(start.Add(5*time.Minute)) {
+		t.Fatalf("Expected the latest %d runs, got %d starting at %s", historyMaxEntries, len(entries), entries[0].Time)
+	}
+}
+
+func TestHistoryErrorTruncated(t *testing.T) {
+	entry := &HistoryEntry{Time: time.Now()}
+	entry.finish(errors.New(strings.Repeat("a", historyMaxErrorLen-1) + "ü and more"))
+	if !utf8.ValidString(entry.Error) || entry.Error != strings.Repeat("a", historyMaxErrorLen-1)+"..." {
+		t.Errorf("Expected the error cut before the multi-byte rune, got %q", entry.Error[historyMaxErrorLen-5:])
+	}
+}
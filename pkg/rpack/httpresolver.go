@@ -0,0 +1,207 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of a single fetch by the HTTP resolver.
+const (
+	httpFetchTimeout = 30 * time.Second
+	httpFetchMaxSize = 10 << 20
+)
+
+// httpFetcher fetches allowed URLs once per run, so repeated reads see the same content.
+type httpFetcher struct {
+	allowed []string
+	client  *http.Client
+
+	mu        sync.Mutex
+	responses map[string][]byte
+}
+
+// newHTTPFetcher creates a fetcher for the URLs allowed by the definition.
+func newHTTPFetcher(allowed []string) *httpFetcher {
+	f := &httpFetcher{allowed: allowed, responses: make(map[string][]byte)}
+	f.client = &http.Client{
+		// Redirects must stay within the allowed URLs
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !f.isAllowed(req.URL.String()) {
+				return fmt.Errorf("redirect to %s is not allowed by permissions.http", req.URL)
+			}
+			return nil
+		},
+	}
+	return f
+}
+
+// isAllowed reports if rawURL is listed, or below an entry ending with a slash.
+// URLs are compared by scheme, host and path. Paths with dot segments are never allowed,
+// the server would resolve https://host/allowed/../secret outside of the allowed path.
+func (f *httpFetcher) isAllowed(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User != nil || u.Opaque != "" || hasDotSegment(u.Path) {
+		return false
+	}
+	for _, entry := range f.allowed {
+		allowed, err := url.Parse(entry)
+		if err != nil || !strings.EqualFold(u.Scheme, allowed.Scheme) || !strings.EqualFold(u.Host, allowed.Host) {
+			continue
+		}
+		if strings.HasSuffix(allowed.Path, "/") && allowed.RawQuery == "" {
+			if strings.HasPrefix(u.Path, allowed.Path) {
+				return true
+			}
+		} else if u.Path == allowed.Path && u.RawQuery == allowed.RawQuery {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDotSegment reports if the unescaped URL path p contains a . or .. segment,
+// backslashes count as separators since some servers treat them as such.
+func hasDotSegment(p string) bool {
+	for _, seg := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == "." || seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch returns the body of a successful GET of rawURL.
+func (f *httpFetcher) fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if b, ok := f.responses[rawURL]; ok {
+		return b, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, httpFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to fetch %s: %s", rawURL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, httpFetchMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	if len(b) > httpFetchMaxSize {
+		return nil, fmt.Errorf("failed to fetch %s: response exceeds %d bytes", rawURL, httpFetchMaxSize)
+	}
+	f.responses[rawURL] = b
+	return b, nil
+}
+
+// HTTPFSResolver resolves read-only handles of http and https URLs.
+type HTTPFSResolver struct {
+	// ctx is the context of the script run, the handles pass it to the fetches
+	// since the FS interface has no context
+	ctx     context.Context
+	name    string
+	fetcher *httpFetcher
+}
+
+// Check HTTPFSResolver satisfies FSResolver interface
+var _ = FSResolver(&HTTPFSResolver{})
+
+// newHTTPFSResolver creates a resolver fetching the URLs allowed by fetcher within ctx.
+func newHTTPFSResolver(ctx context.Context, name string, fetcher *httpFetcher) *HTTPFSResolver {
+	return &HTTPFSResolver{ctx: ctx, name: name, fetcher: fetcher}
+}
+
+// Resolve resolves names starting with http:// or https://, URLs not declared by the definition are an error.
+func (r *HTTPFSResolver) Resolve(name string) (FSHandle, bool, error) {
+	if !strings.HasPrefix(name, "http://") && !strings.HasPrefix(name, "https://") {
+		return nil, false, nil
+	}
+	if !r.fetcher.isAllowed(name) {
+		return nil, true, accessDenied("not allowed to fetch %s, declare it in permissions.http of the definition", name)
+	}
+	return &httpFSHandle{ctx: r.ctx, url: name, resolver: r.name, fetcher: r.fetcher}, true, nil
+}
+
+// errHTTPReadOnly is returned for modifications of URLs.
+var errHTTPReadOnly = errors.New("URLs are read-only")
+
+// httpFSHandle is a read-only handle of a URL.
+type httpFSHandle struct {
+	ctx      context.Context
+	url      string
+	resolver string
+	fetcher  *httpFetcher
+}
+
+// Check httpFSHandle satisfies FSHandle interface
+var _ = FSHandle(&httpFSHandle{})
+
+func (h *httpFSHandle) Resolver() string           { return h.resolver }
+func (h *httpFSHandle) FriendlyPath() string       { return h.url }
+func (h *httpFSHandle) IndirectTargetPath() string { return "" }
+func (h *httpFSHandle) AbsPath() string            { return "" }
+
+func (h *httpFSHandle) Read() ([]byte, error) {
+	return h.fetcher.fetch(h.ctx, h.url)
+}
+
+func (h *httpFSHandle) Open() (io.ReadCloser, error) {
+	b, err := h.Read()
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (h *httpFSHandle) Write([]byte) error {
+	return errHTTPReadOnly
+}
+
+func (h *httpFSHandle) Update(func([]byte, bool) ([]byte, error)) error {
+	return errHTTPReadOnly
+}
+
+func (h *httpFSHandle) Checksum() (string, bool) { return "", false }
+
+// Stat fetches the URL, it exists if the fetch succeeds.
+func (h *httpFSHandle) Stat() (exists bool, dir bool, err error) {
+	if _, err := h.Read(); err != nil {
+		return false, false, nil //nolint:nilerr // intentional: failed fetches are reported as missing
+	}
+	return true, false, nil
+}
+
+func (h *httpFSHandle) ReadDir() (files []FSHandle, dirs []FSHandle, err error) {
+	return nil, nil, fmt.Errorf("%s is not a directory", h.url)
+}
+
+func (h *httpFSHandle) Remove() error {
+	return errHTTPReadOnly
+}
+
+func (h *httpFSHandle) Rename(FSHandle) error {
+	return errHTTPReadOnly
+}
+
+func (h *httpFSHandle) Transfer(string) error {
+	return errHTTPReadOnly
+}
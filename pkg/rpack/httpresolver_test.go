@@ -0,0 +1,83 @@
+package rpack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestHTTPFetcherAllowed(t *testing.T) {
+	f := newHTTPFetcher([]string{"https://example.com/schemas/", "https://example.com/one.json"})
+	for u, want := range map[string]bool{
+		"https://example.com/schemas/a.json":        true,
+		"https://example.com/one.json":              true,
+		"https://example.com/one.json.bak":          false,
+		"https://example.com/schemas":               false,
+		"http://example.com/schemas/a.json":         false,
+		"https://example.com.evil/schemas/":         false,
+		"https://EXAMPLE.com/schemas/a.json":        true,
+		"https://example.com/schemas/../secret":     false,
+		"https://example.com/schemas/%2e%2e/secret": false,
+		"https://example.com/schemas/..%5csecret":   false,
+		"https://example.com/schemas/./a.json":      false,
+		"https://example.com@evil.com/schemas/":     false,
+		"https://user@example.com/schemas/a.json":   false,
+		"https://example.com/one.json?x=1":          false,
+		"https://example.com/schemas/a.json?v=2":    true,
+	} {
+		if got := f.isAllowed(u); got != want {
+			t.Errorf("%s: expected allowed %v, got %v", u, want, got)
+		}
+	}
+}
+
+func TestRunHTTPResolver(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/data/schema.json":
+			_, _ = w.Write([]byte(`{"type":"object"}`))
+		case "/data/escape":
+			http.Redirect(w, r, "/private", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	script := `local schema = rpack.read("` + srv.URL + `/data/schema.json")
+assert(schema == rpack.read("` + srv.URL + `/data/schema.json"))
+rpack.write("./schema.json", schema)
+assert(not pcall(rpack.read, "` + srv.URL + `/private"))
+assert(not pcall(rpack.read, "` + srv.URL + `/data/escape"))
+assert(not pcall(rpack.write, "` + srv.URL + `/data/schema.json", "x"))
+`
+	config, workDir := setupRunConfig(t, script, "")
+	defFile := filepath.Join(filepath.Dir(workDir), "def", "rpack.yaml")
+	def := "\"@schema_version\": \"v1\"\nname: \"app\"\npermissions:\n  write_target: true\n  http:\n    - \"" + srv.URL + "/data/\"\n"
+	if err := os.WriteFile(defFile, []byte(def), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(workDir, "schema.json")); err != nil || string(b) != `{"type":"object"}` { //nolint:gosec // test file
+		t.Errorf("Expected fetched schema, got %q: %v", b, err)
+	}
+	// The schema is fetched once, the redirect once, the private URL never
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+
+	// Without permission URLs can not be fetched
+	config, _ = setupRunConfig(t, "rpack.read(\""+srv.URL+"/data/schema.json\")\n", "")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true}); err == nil || !strings.Contains(err.Error(), "permissions.http") {
+		t.Errorf("Expected undeclared URL to fail, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package rpack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// rerunFunc executes the script of a pack again into runDir and tempDir.
+type rerunFunc func(ctx context.Context, runDir, tempDir string) (*RPackFS, error)
+
+// targetChecksums returns the checksums of the files fs wrote to the target, relative to runDir.
+// Checksums recorded while writing are used, the other files are hashed.
+func targetChecksums(fs *RPackFS, runDir string) (map[string]string, error) {
+	sums := fs.TargetWriteChecksums()
+	for _, handle := range fs.TargetWriteHandles() {
+		relPath := handle.IndirectTargetPath()
+		if _, ok := sums[relPath]; ok {
+			continue
+		}
+		sha, err := util.Sha256File(util.LongPath(filepath.Join(runDir, relPath)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate checksum of: %s: %w", relPath, err)
+		}
+		sums[relPath] = sha
+	}
+	return sums, nil
+}
+
+// verifyIdempotent runs the script a second time with rerun and fails with ErrNotIdempotent
+// if the files written to the target differ from the ones of the first run.
+// This catches impure behavior the read/write checks can not see, e.g. timestamps or random values.
+func verifyIdempotent(ctx context.Context, log *slog.Logger, first *RPackFS, firstRunDir string, rerun rerunFunc) error {
+	runDir, err := os.MkdirTemp("", "rpack-idempotent-run-*")
+	if err != nil {
+		return fmt.Errorf("could not create run directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(runDir) }()
+	tempDir, err := os.MkdirTemp("", "rpack-idempotent-tmp-*")
+	if err != nil {
+		return fmt.Errorf("could not create temp directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	log.Debug("Running script again to verify idempotency")
+	second, err := rerun(ctx, runDir, tempDir)
+	if err != nil {
+		return fmt.Errorf("second run to verify idempotency failed: %w", err)
+	}
+
+	want, err := targetChecksums(first, firstRunDir)
+	if err != nil {
+		return err
+	}
+	got, err := targetChecksums(second, runDir)
+	if err != nil {
+		return err
+	}
+	var diffs []string
+	for path, sha := range want {
+		gotSha, ok := got[path]
+		switch {
+		case !ok:
+			diffs = append(diffs, path+" (only written by the first run)")
+		case gotSha != sha:
+			diffs = append(diffs, path+" (content differs)")
+		}
+	}
+	for path := range got {
+		if _, ok := want[path]; !ok {
+			diffs = append(diffs, path+" (only written by the second run)")
+		}
+	}
+	if len(diffs) > 0 {
+		sort.Strings(diffs)
+		return fmt.Errorf("%w: the second run produced different files: %s", ErrNotIdempotent, strings.Join(diffs, ", "))
+	}
+	return nil
+}
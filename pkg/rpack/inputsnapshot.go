@@ -0,0 +1,85 @@
+package rpack
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// inputSnapshot records the checksums of mapped input files when the script reads them,
+// so inputs modified by another process before the apply are detected.
+// Implements FSAccessHook.
+type inputSnapshot struct {
+	// files maps the absolute path of a read input file to its checksum at read time
+	files map[string]*inputDigest
+}
+
+// inputDigest is the checksum of an input file at read time.
+type inputDigest struct {
+	friendlyPath string
+	sha          string
+}
+
+// Check inputSnapshot satisfies FSAccessHook interface
+var _ = FSAccessHook(&inputSnapshot{})
+
+func newInputSnapshot() *inputSnapshot {
+	return &inputSnapshot{files: make(map[string]*inputDigest)}
+}
+
+// Read records the checksum of an input file before its first read.
+func (s *inputSnapshot) Read(h FSHandle) error {
+	absPath := h.AbsPath()
+	if (h.Resolver() != MapResolver && h.Resolver() != ExtraResolver) || absPath == "" {
+		return nil
+	}
+	if _, ok := s.files[absPath]; ok {
+		return nil
+	}
+	sha, err := util.Sha256File(util.LongPath(absPath))
+	if err != nil {
+		// Errors are reported by the read itself
+		return nil //nolint:nilerr // intentional: not an access violation
+	}
+	s.files[absPath] = &inputDigest{friendlyPath: h.FriendlyPath(), sha: sha}
+	return nil
+}
+
+func (s *inputSnapshot) Write(FSHandle) error   { return nil }
+func (s *inputSnapshot) ReadDir(FSHandle) error { return nil }
+func (s *inputSnapshot) Stat(FSHandle) error    { return nil }
+func (s *inputSnapshot) Remove(FSHandle) error  { return nil }
+
+// changed returns the friendly paths of the input files whose content differs from the one
+// read by the script or that were removed since, sorted.
+func (s *inputSnapshot) changed() []string {
+	var changed []string
+	for absPath, d := range s.files {
+		sha, err := util.Sha256File(util.LongPath(absPath))
+		if err != nil || sha != d.sha {
+			changed = append(changed, d.friendlyPath)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// checkInputsUnchanged verifies the input files read by the scripts were not modified during the run.
+// Changed inputs fail the run with ErrInputChanged, dry-runs and forced runs only warn.
+func (e *Executor) checkInputsUnchanged(fss ...*RPackFS) error {
+	var changed []string
+	for _, fs := range fss {
+		changed = append(changed, fs.ChangedInputs()...)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	changedStr := strings.Join(slices.Compact(slices.Sorted(slices.Values(changed))), ",")
+	if e.DryRun || e.Force {
+		e.log().Warn("Inputs changed during run, the result may be inconsistent", "inputs", changedStr)
+		return nil
+	}
+	return fmt.Errorf("inputs changed during run, run again or use force flag to ignore: %s: %w", changedStr, ErrInputChanged)
+}
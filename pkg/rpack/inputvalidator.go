@@ -1,19 +1,29 @@
 package rpack
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // ValidateRPackInputs validates the inputs for an rpack configuration.
 // Accepts a
 // RPack Instance inputs: RPackInstance.ConfigInstance(RPackConfigInstance).Config(RPackConfig).Config(RPackConfigConfig).Inputs : map[string]string
 // []*RPackDefInput: from RPackDef.Inputs
 // Before this can happen, the RPackInstanceInputs need to point to actual absolute paths
+// All problems are returned joined.
 func ValidateRPackInputs(resolvedInputs []*RPackResolvedInput, defInputs []*RPackDefInput) error {
+	return errors.Join(validateRPackInputs(resolvedInputs, defInputs)...)
+}
+
+// validateRPackInputs implements ValidateRPackInputs, returning all problems found.
+func validateRPackInputs(resolvedInputs []*RPackResolvedInput, defInputs []*RPackDefInput) []error {
+	var errs []error
 	// Check User Inputs names are unique
 	{
 		visitedNames := make(map[string]struct{})
 		for _, in := range resolvedInputs {
 			if _, ok := visitedNames[in.Name]; ok {
-				return fmt.Errorf("resolved input %s already exists", in.Name)
+				errs = append(errs, fmt.Errorf("resolved input %s already exists", in.Name))
 			}
 			visitedNames[in.Name] = struct{}{}
 		}
@@ -24,12 +34,29 @@ func ValidateRPackInputs(resolvedInputs []*RPackResolvedInput, defInputs []*RPac
 		visitedNames := make(map[string]struct{})
 		for _, in := range defInputs {
 			if _, ok := visitedNames[in.Name]; ok {
-				return fmt.Errorf("rpackdef input %s already exists", in.Name)
+				errs = append(errs, fmt.Errorf("rpackdef input %s already exists", in.Name))
 			}
 			visitedNames[in.Name] = struct{}{}
 		}
 	}
 
+	// Check required Inputs are mapped
+	for _, defIn := range defInputs {
+		if !defIn.Required {
+			continue
+		}
+		found := false
+		for _, in := range resolvedInputs {
+			if in.Name == defIn.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("required input %s is not mapped: %w", defIn.Name, ErrInputValidation))
+		}
+	}
+
 	// Check every resolved Input matches a defInput
 	for _, in := range resolvedInputs {
 		var matchDefInput *RPackDefInput
@@ -40,17 +67,19 @@ func ValidateRPackInputs(resolvedInputs []*RPackResolvedInput, defInputs []*RPac
 			}
 		}
 		if matchDefInput == nil {
-			return fmt.Errorf("no definition found for user input %s: %w", in.Name, ErrInputValidation)
+			errs = append(errs, fmt.Errorf("no definition found for user input %s: %w", in.Name, ErrInputValidation))
+			continue
 		}
 		// TODO: Refactor for proper type check
 		// Maybe we can use a type already existing in stdlib
-		if matchDefInput.Type == RPackDefInputTypeFile && in.Type != RPackInputTypeFile {
-			return fmt.Errorf("definition for user input %s requires type file, but found directory: %w", in.Name, ErrInputValidation)
+		// Globs are collections of files
+		if matchDefInput.Type == RPackDefInputTypeFile && in.Type != RPackInputTypeFile && in.Type != RPackInputTypeGlob {
+			errs = append(errs, fmt.Errorf("definition for user input %s requires type file, but found directory: %w", in.Name, ErrInputValidation))
 		}
 		if matchDefInput.Type == RPackDefInputTypeDirectory && in.Type != RPackInputTypeDirectory {
-			return fmt.Errorf("definition for user input %s requires type directory, but found file: %w", in.Name, ErrInputValidation)
+			errs = append(errs, fmt.Errorf("definition for user input %s requires type directory, but found %s: %w", in.Name, in.Type, ErrInputValidation))
 		}
 	}
 
-	return nil
+	return errs
 }
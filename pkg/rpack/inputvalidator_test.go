@@ -140,6 +140,29 @@ func TestValidateRPackInputs(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name:     "required input missing",
+			resolved: []*RPackResolvedInput{},
+			def: []*RPackDefInput{
+				{
+					Name:     "input1",
+					Type:     RPackDefInputTypeFile,
+					Required: true,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name:     "optional input missing",
+			resolved: []*RPackResolvedInput{},
+			def: []*RPackDefInput{
+				{
+					Name: "input1",
+					Type: RPackDefInputTypeFile,
+				},
+			},
+			expectError: false,
+		},
 	}
 
 	for _, tc := range tests {
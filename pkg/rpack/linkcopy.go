@@ -0,0 +1,154 @@
+package rpack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// generatedFilePerm is the permission of files written by scripts.
+const generatedFilePerm = 0o644
+
+// errReflinkUnsupported is returned by reflinkFile on platforms without copy-on-write clones.
+var errReflinkUnsupported = errors.New("reflinks are not supported on this platform")
+
+// handleLinker is implemented by handles that can take the content of another file-backed handle
+// without copying the bytes.
+type handleLinker interface {
+	// linkFrom links or clones the content of src, linked is false if the content must be copied.
+	// sha is the hex sha256 of the content if linked.
+	linkFrom(src FSHandle) (sha string, linked bool, err error)
+}
+
+// handleStreamWriter is implemented by handles that can write content streamed from a reader,
+// hashing it on the way.
+type handleStreamWriter interface {
+	// writeFrom writes the content of r and returns its hex sha256
+	writeFrom(r io.Reader) (string, error)
+}
+
+// copyHandle copies the content of src to dst, linking it if dst supports it.
+// Otherwise the content is streamed and hashed in one pass if dst supports it.
+// It returns the hex sha256 of the content.
+func copyHandle(src, dst FSHandle) (string, error) {
+	if l, ok := dst.(handleLinker); ok {
+		sha, linked, err := l.linkFrom(src)
+		if err != nil || linked {
+			return sha, err
+		}
+	}
+	if w, ok := dst.(handleStreamWriter); ok {
+		r, err := src.Open()
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = r.Close() }()
+		return w.writeFrom(r)
+	}
+	b, err := src.Read()
+	if err != nil {
+		return "", err
+	}
+	if err = dst.Write(b); err != nil {
+		return "", err
+	}
+	return sha256Hex(b), nil
+}
+
+// linkFrom gives the generated file the content of src without copying the bytes:
+// if the existing target file has the same content, it is hardlinked into the run directory,
+// so the apply finds it unchanged. Otherwise src is cloned with a reflink if the filesystem
+// supports copy-on-write. Linked files are never written in place, see writeFileUnlinked.
+// The target file is compared outside of the access hooks, the script does not see its content.
+func (h *targetFSHandle) linkFrom(src FSHandle) (string, bool, error) {
+	srcPath := src.AbsPath()
+	if srcPath == "" {
+		return "", false, nil
+	}
+	srcInfo, err := os.Stat(util.LongPath(srcPath))
+	if err != nil || !srcInfo.Mode().IsRegular() {
+		// Errors are reported by the regular copy
+		return "", false, nil //nolint:nilerr // intentional: fall back to copying
+	}
+	runPath := h.FSHandle.AbsPath()
+	if err = os.MkdirAll(util.LongPath(filepath.Dir(runPath)), 0o755); err != nil { //nolint:gosec // standard permissions
+		return "", false, fmt.Errorf("could not write %s: %w", h.FriendlyPath(), err)
+	}
+	if err = removeIfExists(runPath); err != nil {
+		return "", false, fmt.Errorf("could not write %s: %w", h.FriendlyPath(), err)
+	}
+
+	srcSha, err := util.Sha256File(util.LongPath(srcPath))
+	if err != nil {
+		return "", false, nil //nolint:nilerr // intentional: fall back to copying
+	}
+	targetPath := h.source.AbsPath()
+	targetInfo, err := os.Stat(util.LongPath(targetPath))
+	if err == nil && targetInfo.Mode().IsRegular() && targetInfo.Size() == srcInfo.Size() && targetInfo.Mode().Perm() == generatedFilePerm {
+		if targetSha, shaErr := util.Sha256File(util.LongPath(targetPath)); shaErr == nil && targetSha == srcSha {
+			linkErr := os.Link(util.LongPath(targetPath), util.LongPath(runPath))
+			if linkErr == nil {
+				h.log.Debug("Hardlinked unchanged target file", "file", h.FriendlyPath())
+				return srcSha, true, nil
+			}
+			h.log.Debug("Could not hardlink target file", "file", h.FriendlyPath(), "error", linkErr)
+		}
+	}
+	if err = reflinkFile(util.LongPath(srcPath), util.LongPath(runPath)); err != nil {
+		if !errors.Is(err, errReflinkUnsupported) {
+			h.log.Debug("Could not reflink file, copying", "file", h.FriendlyPath(), "error", err)
+		}
+		return "", false, nil
+	}
+	if err = os.Chmod(util.LongPath(runPath), generatedFilePerm); err != nil {
+		return "", false, fmt.Errorf("could not write %s: %w", h.FriendlyPath(), err)
+	}
+	h.log.Debug("Reflinked file", "file", h.FriendlyPath())
+	h.sha = srcSha
+	return srcSha, true, nil
+}
+
+// writeFrom streams r to the generated file in the run directory.
+func (h *targetFSHandle) writeFrom(r io.Reader) (string, error) {
+	w, ok := h.FSHandle.(handleStreamWriter)
+	if !ok {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		if err = h.FSHandle.Write(b); err != nil {
+			return "", err
+		}
+		return sha256Hex(b), nil
+	}
+	return w.writeFrom(r)
+}
+
+// writeFileUnlinked writes b to name like os.WriteFile, replacing the file instead of writing in place,
+// so a hardlinked target file is never modified through the run directory.
+func writeFileUnlinked(name string, b []byte, perm os.FileMode) error {
+	if err := removeIfExists(name); err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, perm)
+}
+
+// removeIfExists removes the file name, a missing file is not an error.
+func removeIfExists(name string) error {
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// sha256Hex returns the hex sha256 of b, like the checksums of the lockfile.
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
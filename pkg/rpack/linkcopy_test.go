@@ -0,0 +1,66 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBaseFSCopyLinksUnchangedTarget(t *testing.T) {
+	srcDir, runDir, targetDir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFiles := func(dir string, files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil { //nolint:gosec // test files
+				t.Fatal(err)
+			}
+		}
+	}
+	writeFiles(srcDir, map[string]string{"asset.bin": "large asset", "other.bin": "new asset"})
+	writeFiles(targetDir, map[string]string{"asset.bin": "large asset", "other.bin": "old asset"})
+	fs := &BaseFS{Resolvers: []FSResolver{
+		NewFileBackedFSResolver("src", "src:", srcDir),
+		NewTargetFSResolver(TargetResolver, "", runDir, targetDir),
+	}}
+
+	sha, err := fs.Copy("src:asset.bin", "asset.bin")
+	if err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if sha != sha256Hex([]byte("large asset")) {
+		t.Errorf("unexpected sha: %s", sha)
+	}
+	runInfo, err := os.Stat(filepath.Join(runDir, "asset.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetInfo, err := os.Stat(filepath.Join(targetDir, "asset.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(runInfo, targetInfo) {
+		t.Errorf("expected unchanged target file to be hardlinked")
+	}
+
+	// Later writes replace the linked file instead of modifying the target
+	if err = fs.Write("asset.bin", []byte("changed")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(targetDir, "asset.bin")); string(b) != "large asset" { //nolint:gosec // test files
+		t.Errorf("target file modified through link: %q", b)
+	}
+
+	// Changed content is not linked to the target
+	if _, err = fs.Copy("src:other.bin", "other.bin"); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "other.bin")) //nolint:gosec // test files
+	if err != nil || string(b) != "new asset" {
+		t.Fatalf("unexpected copy: %q, %v", b, err)
+	}
+	runInfo, _ = os.Stat(filepath.Join(runDir, "other.bin"))
+	targetInfo, _ = os.Stat(filepath.Join(targetDir, "other.bin"))
+	if os.SameFile(runInfo, targetInfo) {
+		t.Errorf("changed file must not be linked to the target")
+	}
+}
@@ -0,0 +1,245 @@
+package rpack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// LintSeverity is the severity of a lint issue.
+type LintSeverity string
+
+// Lint issue severities.
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// LintIssue is a problem found in a definition.
+type LintIssue struct {
+	Severity LintSeverity
+	// File of the definition the issue is in, relative to the definition directory
+	File string
+	// Line of the issue, 0 if unknown
+	Line    int
+	Message string
+}
+
+// String renders the issue as file:line: severity: message.
+func (i *LintIssue) String() string {
+	loc := i.File
+	if i.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", i.File, i.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, i.Severity, i.Message)
+}
+
+// LintRPackDef statically checks the definition in defDir without executing it:
+// rpack.yaml is validated, the config schema compiled and the scripts parsed for syntax errors
+// and reads of inputs and extras the definition does not declare. Missing descriptions are warnings.
+// It continues after errors to report as many issues as possible.
+func LintRPackDef(defDir string) []*LintIssue {
+	var issues []*LintIssue
+	addIssue := func(sev LintSeverity, file string, line int, format string, args ...any) {
+		issues = append(issues, &LintIssue{Severity: sev, File: file, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	defPath := filepath.Join(defDir, RPackDefDefaultFilename)
+	def, err := LoadRPackDef(defPath)
+	if err != nil {
+		addIssue(LintError, RPackDefDefaultFilename, 0, "%s", err)
+	} else if err = def.ValidateSchema(); err != nil {
+		addIssue(LintError, RPackDefDefaultFilename, 0, "%s", annotateYAMLError(defPath, err))
+	}
+	if def != nil {
+		if def.Description == "" {
+			addIssue(LintWarning, RPackDefDefaultFilename, 0, "definition has no description")
+		}
+		for _, in := range def.Inputs {
+			if in.Description == "" {
+				addIssue(LintWarning, RPackDefDefaultFilename, 0, "input %q has no description", in.Name)
+			}
+		}
+		for _, extra := range def.Extra {
+			if extra.Description == "" {
+				addIssue(LintWarning, RPackDefDefaultFilename, 0, "extra %q has no description", extra.Name)
+			}
+		}
+	}
+
+	if _, err = loadRPackDefSchema(defDir); err != nil {
+		addIssue(LintError, lintSchemaFile(defDir), 0, "%s", err)
+	}
+
+	// script.lua is optional if the definition declares entry scripts
+	scripts := []string{RPackDefScriptFilename}
+	if def != nil && len(def.Scripts) > 0 {
+		if _, err = os.Stat(filepath.Join(defDir, RPackDefScriptFilename)); err != nil {
+			scripts = nil
+		}
+		for _, sc := range def.Scripts {
+			if sc.Description == "" {
+				addIssue(LintWarning, RPackDefDefaultFilename, 0, "script %q has no description", sc.Name)
+			}
+			scripts = append(scripts, sc.File)
+		}
+	}
+	for _, file := range scripts {
+		lintScript(addIssue, defDir, file, def)
+	}
+	return issues
+}
+
+// lintScript parses the script file for syntax errors and reads of inputs and extras the definition does not declare.
+func lintScript(addIssue func(sev LintSeverity, file string, line int, format string, args ...any), defDir, file string, def *RPackDef) {
+	script, err := os.ReadFile(filepath.Join(defDir, filepath.FromSlash(file))) //nolint:gosec // path comes from rpack definition
+	if err != nil {
+		addIssue(LintError, file, 0, "could not read script: %s", err)
+		return
+	}
+	chunk, err := parse.Parse(bytes.NewReader(script), file)
+	if err != nil {
+		line, msg := 0, strings.TrimSpace(err.Error())
+		var parseErr *parse.Error
+		if errors.As(err, &parseErr) {
+			line, msg = max(parseErr.Pos.Line, 0), parseErr.Message
+			if parseErr.Token != "" {
+				msg += fmt.Sprintf(" near '%s'", parseErr.Token)
+			}
+		}
+		addIssue(LintError, file, line, "%s", msg)
+		return
+	}
+	if def == nil {
+		return
+	}
+	declared := make(map[string]struct{})
+	for _, in := range def.Inputs {
+		declared[in.Name] = struct{}{}
+	}
+	for _, ref := range scriptInputRefs(chunk) {
+		if _, ok := declared[ref.name]; !ok {
+			addIssue(LintError, file, ref.line, "input %q is not declared in %s", ref.name, RPackDefDefaultFilename)
+		}
+	}
+	declaredExtras := make(map[string]struct{})
+	for _, extra := range def.Extra {
+		declaredExtras[extra.Name] = struct{}{}
+	}
+	for _, ref := range scriptExtraRefs(chunk) {
+		if _, ok := declaredExtras[ref.name]; !ok {
+			addIssue(LintError, file, ref.line, "extra %q is not declared in %s", ref.name, RPackDefDefaultFilename)
+		}
+	}
+}
+
+// lintSchemaFile returns the name of the config schema file issues are reported for.
+func lintSchemaFile(defDir string) string {
+	if _, err := os.Stat(filepath.Join(defDir, RPackDefJSONSchemaFilename)); err == nil {
+		return RPackDefJSONSchemaFilename
+	}
+	return RPackDefSchemaFilename
+}
+
+// scriptInputRef is a reference of a script to an input.
+type scriptInputRef struct {
+	name string
+	line int
+}
+
+// scriptInputRefs finds the inputs a script references by constant names:
+// paths like "map:name/file" and lookups like rpack.inputs().name or inputs()["name"].
+// Names built at runtime are not found.
+func scriptInputRefs(chunk []ast.Stmt) []scriptInputRef {
+	var refs []scriptInputRef
+	walkLuaAST(reflect.ValueOf(chunk), func(expr ast.Expr) {
+		switch e := expr.(type) {
+		case *ast.StringExpr:
+			name, ok := strings.CutPrefix(e.Value, MapFSResolverPrefix)
+			if !ok {
+				return
+			}
+			name, _, _ = strings.Cut(name, "/")
+			if name != "" {
+				refs = append(refs, scriptInputRef{name: name, line: e.Line()})
+			}
+		case *ast.AttrGetExpr:
+			call, ok := e.Object.(*ast.FuncCallExpr)
+			if !ok || !isInputsFunc(call) {
+				return
+			}
+			if key, ok := e.Key.(*ast.StringExpr); ok {
+				refs = append(refs, scriptInputRef{name: key.Value, line: e.Line()})
+			}
+		}
+	})
+	return refs
+}
+
+// scriptExtraRefs finds the extras a script references by constant paths like "extra:name/file".
+func scriptExtraRefs(chunk []ast.Stmt) []scriptInputRef {
+	var refs []scriptInputRef
+	walkLuaAST(reflect.ValueOf(chunk), func(expr ast.Expr) {
+		if e, ok := expr.(*ast.StringExpr); ok {
+			if name, ok := strings.CutPrefix(e.Value, ExtraFSResolverPrefix); ok {
+				if name, _, _ = strings.Cut(name, "/"); name != "" {
+					refs = append(refs, scriptInputRef{name: name, line: e.Line()})
+				}
+			}
+		}
+	})
+	return refs
+}
+
+// isInputsFunc reports if call calls a function named inputs, e.g. rpack.inputs() or rpack.data.inputs().
+func isInputsFunc(call *ast.FuncCallExpr) bool {
+	if call.Receiver != nil {
+		return call.Method == "inputs"
+	}
+	switch f := call.Func.(type) {
+	case *ast.AttrGetExpr:
+		key, ok := f.Key.(*ast.StringExpr)
+		return ok && key.Value == "inputs"
+	case *ast.IdentExpr:
+		return f.Value == "inputs"
+	}
+	return false
+}
+
+var luaExprType = reflect.TypeFor[ast.Expr]()
+
+// walkLuaAST calls fn for every expression below v.
+// The gopher-lua AST has no visitor, so the nodes are walked by reflection.
+func walkLuaAST(v reflect.Value, fn func(ast.Expr)) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if v.Type() == luaExprType {
+			fn(v.Interface().(ast.Expr)) //nolint:forcetypeassert // checked by the type comparison
+		}
+		walkLuaAST(v.Elem(), fn)
+	case reflect.Pointer:
+		if !v.IsNil() {
+			walkLuaAST(v.Elem(), fn)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			walkLuaAST(v.Index(i), fn)
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				walkLuaAST(v.Field(i), fn)
+			}
+		}
+	}
+}
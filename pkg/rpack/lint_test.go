@@ -0,0 +1,106 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLintRPackDef(t *testing.T) {
+	const described = "\"@schema_version\": \"v1\"\nname: \"mypack\"\ndescription: \"Test pack\"\n"
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "clean",
+			files: map[string]string{
+				"rpack.yaml":  described + "inputs:\n  - name: cfg\n    type: file\n    description: Config to merge\n",
+				"script.lua":  "local rpack = require(\"rpack.v1\")\nrpack.write(\"out.txt\", rpack.read(\"map:cfg\"))\n",
+				"schema.json": `{"type": "object"}`,
+			},
+		},
+		{
+			name: "missing descriptions",
+			files: map[string]string{
+				"rpack.yaml": "\"@schema_version\": \"v1\"\nname: \"mypack\"\ninputs:\n  - name: cfg\n    type: file\n",
+				"script.lua": "print(\"hello\")",
+			},
+			want: []string{
+				"rpack.yaml: warning: definition has no description",
+				`rpack.yaml: warning: input "cfg" has no description`,
+			},
+		},
+		{
+			name: "syntax error",
+			files: map[string]string{
+				"rpack.yaml": described,
+				"script.lua": "local x = 1\nlocal y = = x\n",
+			},
+			want: []string{"script.lua:2: error: syntax error near '='"},
+		},
+		{
+			name: "undeclared inputs",
+			files: map[string]string{
+				"rpack.yaml": described,
+				"script.lua": "local rpack = require(\"rpack.v1\")\n" +
+					"local a = rpack.read(\"map:tmpl/a.txt\")\n" +
+					"local b = rpack.inputs().other\n" +
+					"local c = rpack.data.inputs()[\"third\"]\n" +
+					"local d = rpack.read(\"map:\" .. b)\n",
+			},
+			want: []string{
+				`script.lua:2: error: input "tmpl" is not declared in rpack.yaml`,
+				`script.lua:3: error: input "other" is not declared in rpack.yaml`,
+				`script.lua:4: error: input "third" is not declared in rpack.yaml`,
+			},
+		},
+		{
+			name: "undeclared extras",
+			files: map[string]string{
+				"rpack.yaml": described + "extra:\n  - name: templates\n    type: dir\n",
+				"script.lua": "local rpack = require(\"rpack.v1\")\n" +
+					"local a = rpack.read(\"extra:templates/a.txt\")\n" +
+					"local b = rpack.read(\"extra:shared/b.txt\")\n",
+			},
+			want: []string{
+				`rpack.yaml: warning: extra "templates" has no description`,
+				`script.lua:3: error: extra "shared" is not declared in rpack.yaml`,
+			},
+		},
+		{
+			name: "invalid schema and missing script",
+			files: map[string]string{
+				"rpack.yaml":  described,
+				"schema.json": `{"type": 1}`,
+			},
+			want: []string{
+				"schema.json: error: ",
+				"script.lua: error: could not read script: ",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for fname, content := range tt.files {
+				_ = os.WriteFile(filepath.Join(dir, fname), []byte(content), 0o644) //nolint:gosec // test files
+			}
+			var got []string
+			for _, issue := range LintRPackDef(dir) {
+				got = append(got, issue.String())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d issues, got: %q", len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(got[i], want) {
+					t.Errorf("issue %d: expected prefix %q, got %q", i, want, got[i])
+				}
+			}
+		})
+	}
+}
@@ -2,12 +2,21 @@ package rpack
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"log/slog"
 
+	"github.com/samber/lo"
+
 	"github.com/blang/rpack/pkg/rpack/getsource"
 	"github.com/blang/rpack/pkg/rpack/util"
 )
@@ -21,6 +30,9 @@ type RPackInstance struct {
 
 	ConfigInstance *RPackConfigInstance
 
+	// Pack entry of the config this instance executes
+	Pack *RPackConfigPack
+
 	// Root path of cache instance for this rpack
 	CachePath string
 
@@ -30,6 +42,9 @@ type RPackInstance struct {
 	// RunPath is the directory target files are written to.
 	RunPath string
 
+	// RunDir contains RunPath and TempPath, it is unique to the run
+	RunDir string
+
 	// SourcePath containing the downloaded source
 	SourcePath string
 
@@ -46,6 +61,8 @@ type RPackInputType string
 const (
 	RPackInputTypeFile      RPackInputType = "file"
 	RPackInputTypeDirectory RPackInputType = "dir"
+	// RPackInputTypeGlob is a collection of the files matching a glob pattern
+	RPackInputTypeGlob RPackInputType = "glob"
 )
 
 // RPackResolvedInput represents a resolved input with its value.
@@ -57,16 +74,33 @@ type RPackResolvedInput struct {
 	// Cleaned up user path, is relative and local
 	UserPath string
 
+	// ResolvedPath is the absolute path, the directory the matches are relative to for globs
 	ResolvedPath string
 	Type         RPackInputType
+
+	// Matches are the sorted, slash separated paths of the files matched by a glob, relative to ResolvedPath
+	Matches []string
 }
 
 // ResolveRPackInputs resolves the user provided inputs in the context of an execution path
 // to actual files and directories on disk.
 // It checks if the type specified by the RPackDef is matching against the supplied type.
 func ResolveRPackInputs(configInputs map[string]string, execPath string) ([]*RPackResolvedInput, error) {
+	return resolveRPackInputs(configInputs, execPath, slog.Default())
+}
+
+// resolveRPackInputs resolves inputs like ResolveRPackInputs, warnings go to log.
+func resolveRPackInputs(configInputs map[string]string, execPath string, log *slog.Logger) ([]*RPackResolvedInput, error) {
 	var resolvedInputs []*RPackResolvedInput
 	for name, userPath := range configInputs {
+		if isGlobPattern(userPath) {
+			in, err := resolveRPackGlobInput(name, userPath, execPath, log)
+			if err != nil {
+				return nil, err
+			}
+			resolvedInputs = append(resolvedInputs, in)
+			continue
+		}
 		cleanUserPath := filepath.Clean(userPath)
 		// Check path boundaries
 		if filepath.IsAbs(cleanUserPath) {
@@ -105,11 +139,44 @@ const (
 	RPackCacheDirTemp   = "tmp"
 )
 
-// LoadRPack loads all required data of a RPack to be executed.
+// LoadRPack loads all required data of a single-source RPack to be executed.
 func LoadRPack(ci *RPackConfigInstance, execPath string) (*RPackInstance, error) {
+	return LoadRPackPack(ci, ci.Config.PackList()[0], execPath)
+}
+
+// cachedDefDir returns the directory the definition of pack is fetched to below execPath.
+func cachedDefDir(execPath string, pack *RPackConfigPack) (string, error) {
+	_, subDir, err := extractPackageAddrSubDir(pack.Source)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(execPath, RPackCacheDir, util.Sha256String(pack.Source), RPackCacheDirSource, subDir), nil
+}
+
+// LoadRPackPack loads all required data of a pack of the config to be executed.
+// The run and temp directories are unique to the instance, RemoveRunDir removes them.
+func LoadRPackPack(ci *RPackConfigInstance, pack *RPackConfigPack, execPath string) (*RPackInstance, error) {
+	return loadRPackPack(context.Background(), ci, pack, execPath, &packLoadOptions{runID: newRunID(), log: slog.Default()})
+}
+
+// packLoadOptions configure loadRPackPack.
+type packLoadOptions struct {
+	// source the definition is copied from instead of fetching it, optional.
+	// Like a fetched source, the subdirectory of the source address applies to it
+	source fs.FS
+	// runID names the run and temp directories of the run
+	runID string
+	// defCache stores remote definitions shared across targets, optional
+	defCache *defCache
+	log      *slog.Logger
+}
+
+// loadRPackPack loads a pack like LoadRPackPack, canceling ctx aborts fetching the source.
+func loadRPackPack(ctx context.Context, ci *RPackConfigInstance, pack *RPackConfigPack, execPath string, opts *packLoadOptions) (*RPackInstance, error) {
+	log := opts.log
 	// Setup cache path
-	packCachePath := filepath.Join(execPath, RPackCacheDir, util.Sha256String(ci.Config.Source))
-	err := os.MkdirAll(packCachePath, 0o755) //nolint:gosec // intentional: standard directory permissions
+	packCachePath := filepath.Join(execPath, RPackCacheDir, util.Sha256String(pack.Source))
+	err := os.MkdirAll(util.LongPath(packCachePath), 0o755) //nolint:gosec // intentional: standard directory permissions
 	if err != nil {
 		return nil, fmt.Errorf("could not setup cache path %s: %w", packCachePath, err)
 	}
@@ -118,51 +185,69 @@ func LoadRPack(ci *RPackConfigInstance, execPath string) (*RPackInstance, error)
 	packSourcePath := filepath.Join(packCachePath, RPackCacheDirSource)
 	// Do not create last part of path, since the fetcher is required to create it,
 	// since it creates symlinks for local references
-	err = os.MkdirAll(filepath.Dir(packSourcePath), 0o755) //nolint:gosec // intentional: standard directory permissions
+	err = os.MkdirAll(util.LongPath(filepath.Dir(packSourcePath)), 0o755) //nolint:gosec // intentional: standard directory permissions
 	if err != nil {
 		return nil, fmt.Errorf("could not setup source path %s: %w", packSourcePath, err)
 	}
 
-	// Setup run path
-	shaConfigPath := util.Sha256String(ci.ConfigPath)
-	packRunPath := filepath.Join(packCachePath, shaConfigPath, RPackCacheDirRun)
-	// Cleanup RunPath first
-	if _, err = os.Stat(packRunPath); err == nil {
-		err = os.RemoveAll(packRunPath)
-		if err != nil {
-			return nil, fmt.Errorf("could not cleanup run path: %s: %w", packRunPath, err)
-		}
+	// Setup run path, unique per pack of a config and per run,
+	// so concurrent runs of the same config do not share their generated files
+	runKey := ci.ConfigPath
+	if pack.Name != "" {
+		runKey += "#" + pack.Name
 	}
-	err = os.MkdirAll(packRunPath, 0o755) //nolint:gosec // intentional: standard directory permissions
+	shaConfigPath := util.Sha256String(runKey)
+	packRunDir := filepath.Join(packCachePath, shaConfigPath, opts.runID)
+	// Cleanup leftovers of an earlier run with the same id first
+	if err = os.RemoveAll(util.LongPath(packRunDir)); err != nil {
+		return nil, fmt.Errorf("could not cleanup run path: %s: %w", packRunDir, err)
+	}
+	packRunPath := filepath.Join(packRunDir, RPackCacheDirRun)
+	err = os.MkdirAll(util.LongPath(packRunPath), 0o755) //nolint:gosec // intentional: standard directory permissions
 	if err != nil {
 		return nil, fmt.Errorf("could not setup run path %s: %w", packRunPath, err)
 	}
 
 	// Setup tmp path
-	packTempPath := filepath.Join(packCachePath, shaConfigPath, RPackCacheDirTemp)
-	// Cleanup TempPath first
-	if _, err = os.Stat(packTempPath); err == nil {
-		err = os.RemoveAll(packTempPath)
-		if err != nil {
-			return nil, fmt.Errorf("could not cleanup temp path: %s: %w", packTempPath, err)
-		}
-	}
-	err = os.MkdirAll(packTempPath, 0o755) //nolint:gosec // intentional: standard directory permissions
+	packTempPath := filepath.Join(packRunDir, RPackCacheDirTemp)
+	err = os.MkdirAll(util.LongPath(packTempPath), 0o755) //nolint:gosec // intentional: standard directory permissions
 	if err != nil {
 		return nil, fmt.Errorf("could not setup temp path %s: %w", packTempPath, err)
 	}
 
-	packageAddr, subDir, err := extractPackageAddrSubDir(ci.Config.Source)
+	packageAddr, subDir, err := extractPackageAddrSubDir(pack.Source)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract package addr and subdir from source path: %s: %w", ci.Config.Source, err)
+		return nil, fmt.Errorf("failed to extract package addr and subdir from source path: %s: %w", pack.Source, err)
 	}
+	log.Debug("Detect source", "addr", stripSourceCredentials(packageAddr), "subdir", subDir)
 
-	slog.Debug("Load RPackDef", "source", packSourcePath, "dest", ci.Config.Source)
+	log.Debug("Load RPackDef", "source", packSourcePath, "dest", pack.Source)
 	// Load RPackDef into source folder
-	fetcher := getsource.DefaultFetcher()
-	err = fetcher.Fetch(context.Background(), packSourcePath, packageAddr)
-	if err != nil {
-		return nil, fmt.Errorf("could not get source %q: %w", ci.Config.Source, err)
+	if opts.source != nil {
+		if err = copySourceFS(opts.source, packSourcePath); err != nil {
+			return nil, fmt.Errorf("could not get source %q: %w: %w", pack.Source, ErrSourceFetch, err)
+		}
+	} else {
+		if err = checkSourceFeature(packageAddr); err != nil {
+			return nil, fmt.Errorf("could not get source %q: %w: %w", pack.Source, ErrSourceFetch, err)
+		}
+		// A link to the shared definition cache is replaced, fetching must never update the shared copy
+		if info, statErr := os.Lstat(util.LongPath(packSourcePath)); statErr == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err = os.Remove(util.LongPath(packSourcePath)); err != nil {
+				return nil, fmt.Errorf("could not cleanup source path %s: %w", packSourcePath, err)
+			}
+		}
+		if opts.defCache.cacheable(packageAddr) {
+			if err = os.RemoveAll(util.LongPath(packSourcePath)); err != nil {
+				return nil, fmt.Errorf("could not cleanup source path %s: %w", packSourcePath, err)
+			}
+			err = opts.defCache.load(ctx, packageAddr, packSourcePath)
+		} else {
+			err = getsource.DefaultFetcher().Fetch(ctx, packSourcePath, packageAddr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not get source %q: %w: %w", pack.Source, ErrSourceFetch, err)
+		}
 	}
 
 	packSourcePath = filepath.Join(packSourcePath, subDir)
@@ -170,29 +255,123 @@ func LoadRPack(ci *RPackConfigInstance, execPath string) (*RPackInstance, error)
 	// TODO: Should we load the RPackDef here too?
 
 	// Resolve user specified inputs
-	resolvedInputs, err := ResolveRPackInputs(ci.Config.Config.Inputs, execPath)
+	resolvedInputs, err := resolveRPackInputs(pack.ConfigOrEmpty().Inputs, execPath, log)
 	if err != nil {
 		return nil, fmt.Errorf("could not resolve user inputs: %w", err)
 	}
 
 	return &RPackInstance{
 		ConfigInstance: ci,
+		Pack:           pack,
 		ExecPath:       execPath,
 		CachePath:      packCachePath,
 		TempPath:       packTempPath,
 		RunPath:        packRunPath,
+		RunDir:         packRunDir,
 		SourcePath:     packSourcePath,
 		ResolvedInputs: resolvedInputs,
 	}, nil
 }
 
+// isGlobPattern reports if the user path of an input contains glob meta characters.
+func isGlobPattern(userPath string) bool {
+	return strings.ContainsAny(userPath, "*?[")
+}
+
+// globBase returns the leading segments of the slash separated pattern without meta characters,
+// the directory all matches are in.
+func globBase(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	n := 0
+	for n < len(segments)-1 && !isGlobPattern(segments[n]) {
+		n++
+	}
+	return path.Join(segments[:n]...)
+}
+
+// resolveRPackGlobInput resolves an input mapped to a glob pattern to the files it matches.
+// A ** segment matches any number of directories, .git and .rpack.d directories are skipped.
+func resolveRPackGlobInput(name, userPath, execPath string, log *slog.Logger) (*RPackResolvedInput, error) {
+	pattern := path.Clean(filepath.ToSlash(userPath))
+	if !filepath.IsLocal(filepath.FromSlash(pattern)) {
+		return nil, fmt.Errorf("user path %s=%s is not local", name, userPath)
+	}
+	segments := strings.Split(pattern, "/")
+	for _, segment := range segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("user path %s=%s is no valid glob pattern: %w", name, userPath, err)
+		}
+	}
+	base := globBase(pattern)
+	baseDir := filepath.Join(execPath, filepath.FromSlash(base))
+	var matches []string
+	err := filepath.WalkDir(baseDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == baseDir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != baseDir && (d.Name() == ".git" || d.Name() == RPackCacheDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(execPath, p)
+		if err != nil {
+			return err
+		}
+		if matchSegments(segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			rel, err = filepath.Rel(baseDir, p)
+			if err != nil {
+				return err
+			}
+			matches = append(matches, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve user path %s=%s: %w", name, userPath, err)
+	}
+	if len(matches) == 0 {
+		log.Warn("Input glob matches no files", "input", name, "pattern", pattern)
+	}
+	sort.Strings(matches)
+	return &RPackResolvedInput{
+		Name:         name,
+		UserPath:     pattern,
+		ResolvedPath: baseDir,
+		Type:         RPackInputTypeGlob,
+		Matches:      matches,
+	}, nil
+}
+
+// resolveRPackDefaultInputs adds the defaults of optional inputs the user did not map to resolvedInputs.
+// Defaults whose path does not exist in execPath are skipped, the input stays missing.
+func resolveRPackDefaultInputs(resolvedInputs []*RPackResolvedInput, defInputs []*RPackDefInput, execPath string, log *slog.Logger) ([]*RPackResolvedInput, error) {
+	for _, defIn := range defInputs {
+		if defIn.Default == "" || lo.ContainsBy(resolvedInputs, func(in *RPackResolvedInput) bool { return in.Name == defIn.Name }) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(execPath, filepath.FromSlash(defIn.Default))); errors.Is(err, os.ErrNotExist) {
+			log.Debug("Default of optional input does not exist, skipping", "input", defIn.Name, "path", defIn.Default)
+			continue
+		}
+		defaults, err := resolveRPackInputs(map[string]string{defIn.Name: filepath.FromSlash(defIn.Default)}, execPath, log)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve default of input %s: %w", defIn.Name, err)
+		}
+		resolvedInputs = append(resolvedInputs, defaults...)
+	}
+	return resolvedInputs, nil
+}
+
 func extractPackageAddrSubDir(src string) (pkgDir, subDir string, err error) {
 	result, err := getsource.NormalizeSource(src)
 	if err != nil {
 		return "", "", fmt.Errorf("source detection failed: %w", err)
 	}
-	slog.Debug("Detect source", "result", result)
-
 	packageAddr, subDir := getsource.SplitSourceSubdir(result)
 	return packageAddr, subDir, nil
 }
@@ -202,6 +381,8 @@ const (
 	RPackDefDefaultFilename = "rpack.yaml"
 	RPackDefSchemaFilename  = "schema.cue"
 	RPackDefScriptFilename  = "script.lua"
+	// RPackDefJSONSchemaFilename is the JSON Schema alternative to schema.cue
+	RPackDefJSONSchemaFilename = "schema.json"
 )
 
 // RPackDefInstance contains a prepared execution environment
@@ -215,6 +396,22 @@ type RPackDefInstance struct {
 	ScriptPath      string
 }
 
+// SelectScript selects the entry script to execute by its name, script.lua if name is empty.
+func (i *RPackDefInstance) SelectScript(name string) error {
+	file, err := i.Def.ScriptFile(name)
+	if err != nil {
+		return err
+	}
+	i.ScriptPath = filepath.Join(i.Source, filepath.FromSlash(file))
+	if _, err = os.Stat(i.ScriptPath); err != nil {
+		if len(i.Def.Scripts) > 0 && errors.Is(err, os.ErrNotExist) && name == "" {
+			return fmt.Errorf("definition %s has no %s, select one of its scripts with script in the config or --script: %w", i.Def.Name, RPackDefScriptFilename, ErrValidation)
+		}
+		return fmt.Errorf("could not access script file: %s: %w", i.ScriptPath, err)
+	}
+	return nil
+}
+
 // ValidateConfig validates the values and inputs of a RPack against the schema of a RPackDef.
 func (i *RPackDefInstance) ValidateConfig(c *RPackConfig) error {
 	if err := i.ConfigValidator.Validate(c.Config); err != nil {
@@ -223,61 +420,115 @@ func (i *RPackDefInstance) ValidateConfig(c *RPackConfig) error {
 	return nil
 }
 
+// ConfigValuesWithDefaults returns the values of the config with defaults
+// declared in the schema of the RPackDef filled in. The config is not modified.
+func (i *RPackDefInstance) ConfigValuesWithDefaults(c *RPackConfig) (map[string]any, error) {
+	values := c.Config.Values
+	defaulter, ok := i.ConfigValidator.(SchemaDefaulter)
+	if !ok {
+		return values, nil
+	}
+	defaults, err := defaulter.Defaults(c.Config)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve schema defaults: %w", err)
+	}
+	defaultValues, _ := defaults["values"].(map[string]any)
+	if len(defaultValues) == 0 {
+		return values, nil
+	}
+	return mergeDefaults(values, defaultValues), nil
+}
+
 // ValidateRPackDef validates an rpack definition directory.
 // It checks:
 // - rpack.yaml exists and conforms to the definition schema
-// - script.lua exists and is readable
-// - schema.cue (if present) is valid CUE syntax
+// - script.lua and the declared entry scripts exist
+// - schema.cue or schema.json (if present) is valid
 // Returns the parsed definition on success.
 func ValidateRPackDef(defDir string) (*RPackDef, error) {
+	return Loader{}.ValidateRPackDef(defDir)
+}
+
+// ValidateRPackDef is ValidateRPackDef decoding with the options of l.
+func (l Loader) ValidateRPackDef(defDir string) (*RPackDef, error) {
 	defPath := filepath.Join(defDir, RPackDefDefaultFilename)
-	def, err := LoadRPackDef(defPath)
+	def, err := l.LoadRPackDef(defPath)
 	if err != nil {
 		return nil, fmt.Errorf("could not load rpack definition file %s: %w", defPath, err)
 	}
 	if err := def.ValidateSchema(); err != nil {
-		return nil, fmt.Errorf("definition schema validation failed: %s: %w", defPath, err)
-	}
-	// Check optional schema.cue is parseable
-	schemaFile := filepath.Join(defDir, RPackDefSchemaFilename)
-	if _, statErr := os.Stat(schemaFile); statErr == nil {
-		b, readErr := os.ReadFile(schemaFile) //nolint:gosec // intentional: path comes from user config
-		if readErr != nil {
-			return nil, fmt.Errorf("failed to open schema file: %s: %w", schemaFile, readErr)
-		}
-		if _, cueErr := NewCueValidator(b, RPackDefSchemaName); cueErr != nil {
-			return nil, fmt.Errorf("could not create validation context from path %s in schema file %s: %w", RPackDefSchemaName, schemaFile, cueErr)
-		}
+		return nil, fmt.Errorf("definition schema validation failed: %s: %w: %w", defPath, ErrValidation, annotateYAMLError(defPath, err))
 	}
-	// Check script exists
+	// Check optional schema file is parseable
+	if _, err := loadRPackDefSchema(defDir); err != nil {
+		return nil, err
+	}
+	// Check scripts exist, script.lua is optional if the definition declares entry scripts
 	scriptPath := filepath.Join(defDir, RPackDefScriptFilename)
-	if _, statErr := os.Stat(scriptPath); statErr != nil {
+	if _, statErr := os.Stat(scriptPath); statErr != nil && (len(def.Scripts) == 0 || !errors.Is(statErr, os.ErrNotExist)) {
 		return nil, fmt.Errorf("could not access script file: %s: %w", scriptPath, statErr)
 	}
+	for _, script := range def.Scripts {
+		scriptPath = filepath.Join(defDir, filepath.FromSlash(script.File))
+		if _, statErr := os.Stat(scriptPath); statErr != nil {
+			return nil, fmt.Errorf("could not access file of script %s: %s: %w", script.Name, scriptPath, statErr)
+		}
+	}
 	return def, nil
 }
 
+// loadRPackDefSchema sets up the validator for the optional config schema of a RPackDef.
+// The implementation is selected by file presence: schema.cue uses CUE, schema.json uses JSON Schema.
+// Defining both is an error, without a schema file the EmptyValidator is returned.
+func loadRPackDefSchema(defDir string) (SchemaValidator, error) {
+	cueFile := filepath.Join(defDir, RPackDefSchemaFilename)
+	jsonFile := filepath.Join(defDir, RPackDefJSONSchemaFilename)
+	_, cueErr := os.Stat(cueFile)
+	_, jsonErr := os.Stat(jsonFile)
+	switch {
+	case cueErr == nil && jsonErr == nil:
+		return nil, fmt.Errorf("only one of %s and %s is allowed in %s", RPackDefSchemaFilename, RPackDefJSONSchemaFilename, defDir)
+	case cueErr == nil:
+		b, err := os.ReadFile(cueFile) //nolint:gosec // intentional: path comes from user config
+		if err != nil {
+			return nil, fmt.Errorf("failed to open schema file: %s: %w", cueFile, err)
+		}
+		vc, err := NewCueValidator(b, RPackDefSchemaName)
+		if err != nil {
+			return nil, fmt.Errorf("could not create validation context from path %s in schema file %s: %w", RPackDefSchemaName, cueFile, err)
+		}
+		return vc, nil
+	case jsonErr == nil:
+		b, err := os.ReadFile(jsonFile) //nolint:gosec // intentional: path comes from user config
+		if err != nil {
+			return nil, fmt.Errorf("failed to open schema file: %s: %w", jsonFile, err)
+		}
+		vc, err := NewJSONSchemaValidator(b)
+		if err != nil {
+			return nil, fmt.Errorf("could not compile JSON schema file %s: %w", jsonFile, err)
+		}
+		return vc, nil
+	default:
+		return &EmptyValidator{}, nil
+	}
+}
+
 // SetupRPackDefInstance loads the RPackDef from the given source path
 // and sets up the RPackDefInstance for validation and execution.
 func SetupRPackDefInstance(source string) (*RPackDefInstance, error) {
-	def, err := ValidateRPackDef(source)
+	return Loader{}.SetupRPackDefInstance(source)
+}
+
+// SetupRPackDefInstance is SetupRPackDefInstance decoding with the options of l.
+func (l Loader) SetupRPackDefInstance(source string) (*RPackDefInstance, error) {
+	def, err := l.ValidateRPackDef(source)
 	if err != nil {
 		return nil, err
 	}
 
-	var vc SchemaValidator
-	schemaFile := filepath.Join(source, RPackDefSchemaFilename)
-	if _, statErr := os.Stat(schemaFile); statErr == nil {
-		b, readErr := os.ReadFile(schemaFile) //nolint:gosec // intentional: path comes from user config
-		if readErr != nil {
-			return nil, fmt.Errorf("failed to open schema file: %s: %w", schemaFile, readErr)
-		}
-		vc, readErr = NewCueValidator(b, RPackDefSchemaName)
-		if readErr != nil {
-			return nil, fmt.Errorf("could not create validation context from path %s in schema file %s: %w", RPackDefSchemaName, schemaFile, readErr)
-		}
-	} else {
-		vc = &EmptyValidator{}
+	vc, err := loadRPackDefSchema(source)
+	if err != nil {
+		return nil, err
 	}
 
 	scriptPath := filepath.Join(source, RPackDefScriptFilename)
@@ -288,3 +539,54 @@ func SetupRPackDefInstance(source string) (*RPackDefInstance, error) {
 		ScriptPath:      scriptPath,
 	}, nil
 }
+
+// RemoveRunDir removes the run and temp directories of the instance.
+func (pi *RPackInstance) RemoveRunDir() error {
+	if pi.RunDir == "" {
+		return nil
+	}
+	return os.RemoveAll(util.LongPath(pi.RunDir))
+}
+
+// removeStaleRunDirs removes the run and temp directories below execPath left by runs that crashed,
+// and those of rpack versions that did not name them per run. It must only be called while holding
+// the run lock of execPath, other runs on the target would lose their directories otherwise.
+func removeStaleRunDirs(execPath string) error {
+	cacheDir := filepath.Join(execPath, RPackCacheDir)
+	sources, err := os.ReadDir(util.LongPath(cacheDir))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var errs []error
+	// Run directories are named <sha of source>/<sha of config and pack>/<run id>
+	for _, source := range sources {
+		if !source.IsDir() || !isSha256Hex(source.Name()) {
+			continue
+		}
+		configs, err := os.ReadDir(util.LongPath(filepath.Join(cacheDir, source.Name())))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, config := range configs {
+			if config.IsDir() && isSha256Hex(config.Name()) {
+				errs = append(errs, os.RemoveAll(util.LongPath(filepath.Join(cacheDir, source.Name(), config.Name()))))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isSha256Hex reports if s is a hex encoded sha256 checksum, like the names of the cache directories.
+func isSha256Hex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == 2*sha256.Size
+}
+
+// copySourceFS replaces the directory dst with the content of fsys, e.g. a definition embedded into a tool.
+func copySourceFS(fsys fs.FS, dst string) error {
+	if err := os.RemoveAll(util.LongPath(dst)); err != nil {
+		return err
+	}
+	return os.CopyFS(util.LongPath(dst), fsys)
+}
@@ -176,3 +176,53 @@ func TestResolveRPackInputs(t *testing.T) {
 		}
 	})
 }
+
+func TestResolveRPackGlobInput(t *testing.T) {
+	execPath := t.TempDir()
+	for _, name := range []string{
+		"services/b/config.yaml",
+		"services/a/config.yaml",
+		"services/a/other.yaml",
+		"services/a/nested/config.yaml",
+		"services/.rpack.d/x/config.yaml",
+		"top.yaml",
+	} {
+		p := filepath.Join(execPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		base    string
+		want    []string
+	}{
+		{"services/*/config.yaml", "services", []string{"a/config.yaml", "b/config.yaml"}},
+		{"services/**/config.yaml", "services", []string{"a/config.yaml", "a/nested/config.yaml", "b/config.yaml"}},
+		{"*.yaml", "", []string{"top.yaml"}},
+		{"missing/*.yaml", "missing", nil},
+	}
+	for _, tt := range tests {
+		resolved, err := ResolveRPackInputs(map[string]string{"services": tt.pattern}, execPath)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.pattern, err)
+		}
+		in := resolved[0]
+		if in.Type != RPackInputTypeGlob || in.UserPath != tt.pattern || in.ResolvedPath != filepath.Join(execPath, filepath.FromSlash(tt.base)) {
+			t.Errorf("%s: unexpected resolved input %+v", tt.pattern, in)
+		}
+		if !reflect.DeepEqual(in.Matches, tt.want) {
+			t.Errorf("%s: expected matches %v, got %v", tt.pattern, tt.want, in.Matches)
+		}
+	}
+
+	for _, pattern := range []string{"../*.yaml", "services/[.yaml"} {
+		if _, err := ResolveRPackInputs(map[string]string{"services": pattern}, execPath); err == nil {
+			t.Errorf("%s: expected error", pattern)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package rpack
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaFileErrorType is the name of the metatable of file errors raised to scripts.
+const luaFileErrorType = "rpack.file_error"
+
+// Kinds of file errors, see fileErrorKind.
+const (
+	fileErrorNotFound    = "not_found"
+	fileErrorDenied      = "denied"
+	fileErrorInvalidPath = "invalid_path"
+	fileErrorExists      = "exists"
+	fileErrorIO          = "io"
+)
+
+// fileErrorKind classifies the cause of a failed file operation for scripts.
+func fileErrorKind(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fileErrorNotFound
+	case errors.Is(err, errAccessDenied), errors.Is(err, fs.ErrPermission), errors.Is(err, ErrWriteLimit):
+		return fileErrorDenied
+	case errors.Is(err, errPathNotRelative), errors.Is(err, errPathNotLocal), errors.Is(err, errPathColon):
+		return fileErrorInvalidPath
+	case errors.Is(err, fs.ErrExist):
+		return fileErrorExists
+	default:
+		return fileErrorIO
+	}
+}
+
+// raiseFileError raises the failure of the file operation op on path as error table instead of a
+// "bad argument" message, so scripts can tell a missing optional file from other failures:
+//
+//	local ok, err = pcall(rpack.read, "map:optional.yaml")
+//	if not ok and err.kind == "not_found" then ... end
+//
+// The table has the fields op, path, kind, cause and message, tostring returns the message.
+// Errors not caught by the script fail the run with the message, see luaErrorMessage.
+func raiseFileError(L *lua.LState, op, path string, err error) {
+	msg := fmt.Sprintf("%s: failed to %s %s: %s", luaCallSite(L), op, path, err)
+	tbl := L.NewTable()
+	tbl.RawSetString("op", lua.LString(op))
+	tbl.RawSetString("path", lua.LString(path))
+	tbl.RawSetString("kind", lua.LString(fileErrorKind(err)))
+	tbl.RawSetString("cause", lua.LString(err.Error()))
+	tbl.RawSetString("message", lua.LString(msg))
+	L.SetMetatable(tbl, fileErrorMetatable(L))
+	L.Error(tbl, 1)
+}
+
+// fileErrorMetatable returns the metatable of file errors, created on first use.
+func fileErrorMetatable(L *lua.LState) lua.LValue {
+	if mt, ok := L.GetTypeMetatable(luaFileErrorType).(*lua.LTable); ok {
+		return mt
+	}
+	mt := L.NewTypeMetatable(luaFileErrorType)
+	L.SetField(mt, "__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(L.CheckTable(1).RawGetString("message"))
+		return 1
+	}))
+	return mt
+}
+
+// luaErrorMessage replaces an error table raised by raiseFileError and not caught by the script
+// with its message, gopher-lua would report it as "table: 0x...".
+func luaErrorMessage(L *lua.LState, err error) error {
+	var apiErr *lua.ApiError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	tbl, ok := apiErr.Object.(*lua.LTable)
+	if !ok || L.GetMetatable(tbl) != L.GetTypeMetatable(luaFileErrorType) {
+		return err
+	}
+	apiErr.Object = tbl.RawGetString("message")
+	return err
+}
@@ -0,0 +1,40 @@
+package rpack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLuaFileError(t *testing.T) {
+	defDir, runDir, tempDir, execDir := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	fs := NewRPackFS(true, defDir, runDir, tempDir, execDir, nil, nil)
+	script := `
+		local rpack = require("rpack.v1")
+		local function kind(fn, ...)
+			local ok, err = pcall(fn, ...)
+			assert(not ok, "expected failure")
+			assert(type(err) == "table", "expected error table, got " .. tostring(err))
+			return err.kind, err
+		end
+		local k, err = kind(rpack.read, "rpack:missing.yaml")
+		assert(k == "not_found", k)
+		assert(err.op == "read" and err.path == "rpack:missing.yaml", err.op .. " " .. err.path)
+		assert(err.cause ~= "")
+		assert(tostring(err) == err.message)
+		assert(err.message:find("^script.lua:4: failed to read rpack:missing.yaml: "), err.message)
+		assert(kind(rpack.write, "rpack:out.txt", "x") == "denied")
+		assert(kind(rpack.write_lines, "../out.txt", {"x"}) == "invalid_path")
+		assert(kind(rpack.read_dir, "rpack:missing", false) == "not_found")
+		assert(kind(rpack.lines_iter, "rpack:missing.txt") == "not_found")
+		-- Argument errors are no file errors
+		assert(type(select(2, pcall(rpack.read))) == "string")
+		rpack.read("rpack:missing.txt")
+	`
+	_, err := ExecuteLuaWithOptions(t.Context(), script, fs, nil, LuaOptions{})
+	if err == nil {
+		t.Fatal("Expected uncaught file error to fail the script")
+	}
+	if !strings.Contains(err.Error(), "script.lua:21: failed to read rpack:missing.txt: ") || strings.Contains(err.Error(), "table: 0x") {
+		t.Errorf("Expected message of the uncaught file error, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package rpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// binarySniffLen is the number of leading bytes is_binary and content_type inspect, like git does.
+const binarySniffLen = 8000
+
+// binaryWriter is implemented by filesystems keeping target files written as bytes exactly.
+type binaryWriter interface {
+	WriteBinary(name string, b []byte) error
+}
+
+// checkBytes returns the bytes of argument n, a string or a list of byte values.
+func checkBytes(L *lua.LState, n int) []byte {
+	switch v := L.Get(n).(type) {
+	case lua.LString:
+		return []byte(v)
+	case *lua.LTable:
+		b := make([]byte, 0, v.Len())
+		for i := 1; i <= v.Len(); i++ {
+			num, ok := v.RawGetInt(i).(lua.LNumber)
+			if !ok || num < 0 || num > 255 || num != lua.LNumber(int(num)) {
+				L.ArgError(n, fmt.Sprintf("byte %d is no number from 0 to 255", i))
+				return nil
+			}
+			b = append(b, byte(num))
+		}
+		return b
+	default:
+		L.ArgError(n, "string or list of bytes expected, got "+L.Get(n).Type().String())
+		return nil
+	}
+}
+
+// luaReadBytes reads the raw content of a file, optionally a range of it.
+// Options: offset, the number of bytes to skip, and length, the maximum number of bytes to read.
+func (a *RPackAPI) luaReadBytes(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	opts := L.OptTable(2, L.NewTable())
+	offset := optByteCount(L, opts, "offset", 0)
+	length := optByteCount(L, opts, "length", -1)
+	rc, err := a.fs.Open(friendly)
+	if err != nil {
+		raiseFileError(L, "read", friendly, err)
+		return 0
+	}
+	defer func() { _ = rc.Close() }()
+	if _, err = io.CopyN(io.Discard, rc, offset); err != nil && !errors.Is(err, io.EOF) {
+		raiseFileError(L, "read", friendly, err)
+		return 0
+	}
+	var r io.Reader = rc
+	if length >= 0 {
+		r = io.LimitReader(rc, length)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		raiseFileError(L, "read", friendly, err)
+		return 0
+	}
+	L.Push(lua.LString(b))
+	return 1
+}
+
+// optByteCount returns the non-negative number of bytes of the option key, def if it is not set.
+func optByteCount(L *lua.LState, opts *lua.LTable, key string, def int64) int64 {
+	v := opts.RawGetString(key)
+	if v == lua.LNil {
+		return def
+	}
+	n, ok := v.(lua.LNumber)
+	if !ok || n < 0 {
+		L.ArgError(2, key+" must be a number of bytes")
+		return def
+	}
+	return int64(n)
+}
+
+// luaWriteBytes writes a string or a list of byte values exactly as given.
+func (a *RPackAPI) luaWriteBytes(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	content := checkBytes(L, 2)
+	write := a.fs.Write
+	if w, ok := a.fs.(binaryWriter); ok {
+		write = w.WriteBinary
+	}
+	if err := write(friendly, content); err != nil {
+		raiseFileError(L, "write", friendly, err)
+		return 0
+	}
+	a.writes.record(L, friendly, content)
+	return 0
+}
+
+// sniffFile reads the leading bytes of a file to detect its type.
+func (a *RPackAPI) sniffFile(L *lua.LState, friendly string) []byte {
+	rc, err := a.fs.Open(friendly)
+	if err != nil {
+		raiseFileError(L, "read", friendly, err)
+		return nil
+	}
+	defer func() { _ = rc.Close() }()
+	b, err := io.ReadAll(io.LimitReader(rc, binarySniffLen))
+	if err != nil {
+		raiseFileError(L, "read", friendly, err)
+		return nil
+	}
+	return b
+}
+
+// luaIsBinary reports if a file looks binary, it contains a NUL byte within its first 8000 bytes.
+func (a *RPackAPI) luaIsBinary(L *lua.LState) int {
+	b := a.sniffFile(L, L.CheckString(1))
+	L.Push(lua.LBool(isBinary(b)))
+	return 1
+}
+
+// luaContentType returns the MIME type of a file detected from its content, e.g. image/png.
+func (a *RPackAPI) luaContentType(L *lua.LState) int {
+	b := a.sniffFile(L, L.CheckString(1))
+	L.Push(lua.LString(http.DetectContentType(b)))
+	return 1
+}
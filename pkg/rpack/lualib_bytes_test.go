@@ -0,0 +1,44 @@
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestRPackAPIBytes(t *testing.T) {
+	fs := NewInMemoryFS()
+	_ = fs.Write("image.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	_ = fs.Write("text.txt", []byte("hello\n"))
+	api := NewRPackAPI(fs)
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	mod := L.NewTable()
+	for name, fn := range api.Funcs() {
+		L.SetField(mod, name, L.NewFunction(fn))
+	}
+	L.SetGlobal("rpack", mod)
+	script := `
+		local png = rpack.read_bytes("image.png")
+		assert(#png == 16 and png:byte(1) == 0x89 and png:byte(9) == 0)
+		assert(rpack.read_bytes("image.png", {offset = 1, length = 3}) == "PNG")
+		assert(rpack.read_bytes("image.png", {offset = 100}) == "")
+		assert(not pcall(rpack.read_bytes, "image.png", {length = -1}))
+
+		rpack.write_bytes("copy.png", png)
+		assert(rpack.read_bytes("copy.png") == png)
+		rpack.write_bytes("list.bin", {0, 1, 255})
+		assert(rpack.read_bytes("list.bin") == "\0\1\255")
+		assert(not pcall(rpack.write_bytes, "bad.bin", {256}))
+		assert(not pcall(rpack.write_bytes, "bad.bin", {1.5}))
+
+		assert(rpack.is_binary("image.png"))
+		assert(not rpack.is_binary("text.txt"))
+		assert(rpack.content_type("image.png") == "image/png")
+		assert(rpack.content_type("text.txt") == "text/plain; charset=utf-8")
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
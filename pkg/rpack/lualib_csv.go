@@ -0,0 +1,259 @@
+package rpack
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// csvOptions controls how CSV documents are read and written.
+type csvOptions struct {
+	// Delimiter between fields
+	Delimiter rune
+	// Header reports if the first record names the columns
+	Header bool
+	// Columns fixes the column order when writing, optional
+	Columns []string
+	// Comment starts lines that are ignored when reading, 0 disables comments
+	Comment rune
+	// LazyQuotes allows quotes in unquoted fields when reading
+	LazyQuotes bool
+	// CRLF ends records with \r\n when writing
+	CRLF bool
+}
+
+func defaultCSVOptions() *csvOptions {
+	return &csvOptions{
+		Delimiter: ',',
+		Header:    true,
+	}
+}
+
+// csvOptionsFromTable reads optional settings from a Lua options table.
+func csvOptionsFromTable(tbl *lua.LTable) (*csvOptions, error) {
+	opts := defaultCSVOptions()
+	if tbl == nil {
+		return opts, nil
+	}
+	singleRune := func(name string) (rune, error) {
+		v, ok := tbl.RawGetString(name).(lua.LString)
+		if !ok {
+			return 0, nil
+		}
+		r, size := utf8.DecodeRuneInString(string(v))
+		if size == 0 || size != len(v) {
+			return 0, fmt.Errorf("option %s must be a single character, got %q", name, string(v))
+		}
+		return r, nil
+	}
+	delimiter, err := singleRune("delimiter")
+	if err != nil {
+		return nil, err
+	}
+	if delimiter != 0 {
+		opts.Delimiter = delimiter
+	}
+	if opts.Comment, err = singleRune("comment"); err != nil {
+		return nil, err
+	}
+	if v, ok := tbl.RawGetString("header").(lua.LBool); ok {
+		opts.Header = bool(v)
+	}
+	if v, ok := tbl.RawGetString("lazy_quotes").(lua.LBool); ok {
+		opts.LazyQuotes = bool(v)
+	}
+	if v, ok := tbl.RawGetString("crlf").(lua.LBool); ok {
+		opts.CRLF = bool(v)
+	}
+	if cols, ok := tbl.RawGetString("columns").(*lua.LTable); ok {
+		for i := 1; i <= cols.Len(); i++ {
+			opts.Columns = append(opts.Columns, lua.LVAsString(cols.RawGetInt(i)))
+		}
+	}
+	return opts, nil
+}
+
+// csvColumnsField is the metatable field of parsed rows that holds the header
+// order, so to_csv writes the columns in their original order.
+const csvColumnsField = "__columns"
+
+// parseCSV parses a CSV document. With header the records are returned as
+// maps keyed by column name together with the header, otherwise as lists of fields.
+func parseCSV(s string, opts *csvOptions) ([]any, []string, error) {
+	r := csv.NewReader(strings.NewReader(strings.TrimPrefix(s, "\ufeff")))
+	r.Comma = opts.Delimiter
+	r.Comment = opts.Comment
+	r.LazyQuotes = opts.LazyQuotes
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	rows := make([]any, 0, len(records))
+	if !opts.Header {
+		for _, rec := range records {
+			rows = append(rows, rec)
+		}
+		return rows, nil, nil
+	}
+	if len(records) == 0 {
+		return rows, nil, nil
+	}
+	header := records[0]
+	seen := make(map[string]struct{}, len(header))
+	for i, name := range header {
+		if name == "" {
+			return nil, nil, fmt.Errorf("column %d has an empty header", i+1)
+		}
+		if _, ok := seen[name]; ok {
+			return nil, nil, fmt.Errorf("duplicate column %q in header", name)
+		}
+		seen[name] = struct{}{}
+	}
+	for _, rec := range records[1:] {
+		row := make(map[string]any, len(header))
+		for i, name := range header {
+			row[name] = rec[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, header, nil
+}
+
+// csvCell converts a Lua value to a CSV field.
+func csvCell(v lua.LValue) (string, error) {
+	switch v.Type() {
+	case lua.LTNil:
+		return "", nil
+	case lua.LTString, lua.LTNumber, lua.LTBool:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("field must be a string, number or boolean, got %s", v.Type())
+	}
+}
+
+// writeCSV encodes a list of rows. Rows are either lists of fields or tables
+// keyed by column name. Without columns option the header order of rows parsed by
+// from_csv is kept, any other columns of keyed rows follow sorted.
+//
+//nolint:gocognit // intentional: handles list and keyed rows
+func writeCSV(rows *lua.LTable, opts *csvOptions) (string, error) {
+	var records [][]string
+	columns := opts.Columns
+	keyed := false
+	if columns == nil {
+		names := make(map[string]struct{})
+		if mt, ok := rows.Metatable.(*lua.LTable); ok {
+			if header, ok := mt.RawGetString(csvColumnsField).(*lua.LTable); ok {
+				for i := 1; i <= header.Len(); i++ {
+					name := lua.LVAsString(header.RawGetInt(i))
+					names[name] = struct{}{}
+					columns = append(columns, name)
+				}
+			}
+		}
+		var rest []string
+		for i := 1; i <= rows.Len(); i++ {
+			row, ok := rows.RawGetInt(i).(*lua.LTable)
+			if !ok || row.Len() > 0 {
+				continue
+			}
+			row.ForEach(func(k, _ lua.LValue) {
+				if _, ok := names[k.String()]; !ok {
+					names[k.String()] = struct{}{}
+					rest = append(rest, k.String())
+				}
+			})
+		}
+		sort.Strings(rest)
+		columns = append(columns, rest...)
+	}
+	for i := 1; i <= rows.Len(); i++ {
+		row, ok := rows.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			return "", fmt.Errorf("row %d must be a table", i)
+		}
+		var rec []string
+		if row.Len() > 0 {
+			for j := 1; j <= row.Len(); j++ {
+				cell, err := csvCell(row.RawGetInt(j))
+				if err != nil {
+					return "", fmt.Errorf("row %d column %d: %w", i, j, err)
+				}
+				rec = append(rec, cell)
+			}
+		} else {
+			keyed = true
+			for _, name := range columns {
+				cell, err := csvCell(row.RawGetString(name))
+				if err != nil {
+					return "", fmt.Errorf("row %d column %q: %w", i, name, err)
+				}
+				rec = append(rec, cell)
+			}
+		}
+		records = append(records, rec)
+	}
+	if opts.Header && len(columns) > 0 && (keyed || opts.Columns != nil) {
+		records = append([][]string{columns}, records...)
+	}
+
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	w.Comma = opts.Delimiter
+	w.UseCRLF = opts.CRLF
+	if err := w.WriteAll(records); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// luaFromCSV parses a CSV string into a list of rows and returns the header columns
+// as second value. Accepts an optional options table (delimiter, header, comment, lazy_quotes).
+func luaFromCSV(L *lua.LState) int {
+	input := L.CheckString(1)
+	opts, err := csvOptionsFromTable(L.OptTable(2, nil))
+	if err != nil {
+		L.ArgError(2, err.Error())
+		return 0
+	}
+	rows, header, err := parseCSV(input, opts)
+	if err != nil {
+		L.ArgError(1, fmt.Errorf("failed to unmarshal csv: %w", err).Error())
+		return 0
+	}
+	tbl := goToLValue(L, rows)
+	if header == nil {
+		L.Push(tbl)
+		L.Push(lua.LNil)
+		return 2
+	}
+	columns := goToLValue(L, header)
+	mt := L.NewTable()
+	mt.RawSetString(csvColumnsField, columns)
+	L.SetMetatable(tbl, mt)
+	L.Push(tbl)
+	L.Push(columns)
+	return 2
+}
+
+// luaToCSV serializes a list of rows into a CSV string.
+// Accepts an optional options table (delimiter, header, columns, crlf).
+func luaToCSV(L *lua.LState) int {
+	rows := L.CheckTable(1)
+	opts, err := csvOptionsFromTable(L.OptTable(2, nil))
+	if err != nil {
+		L.ArgError(2, err.Error())
+		return 0
+	}
+	s, err := writeCSV(rows, opts)
+	if err != nil {
+		L.ArgError(1, fmt.Errorf("failed to marshal csv: %w", err).Error())
+		return 0
+	}
+	L.Push(lua.LString(s))
+	return 1
+}
@@ -0,0 +1,99 @@
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestRPackAPIFromCSV(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("from_csv", L.NewFunction(luaFromCSV))
+	script := `
+		local rows = from_csv("\239\187\191host,port,note\nweb1,8080,\"a, b\"\nweb2,8081,\"say \"\"hi\"\"\"\n")
+		assert(#rows == 2, #rows)
+		assert(rows[1].host == "web1", rows[1].host)
+		assert(rows[1].note == "a, b")
+		assert(rows[2].note == 'say "hi"', rows[2].note)
+
+		local raw = from_csv("# inventory\na;b\nc;d\n", {delimiter = ";", header = false, comment = "#"})
+		assert(#raw == 2)
+		assert(raw[1][1] == "a" and raw[1][2] == "b")
+		assert(raw[2][2] == "d")
+
+		local empty = from_csv("")
+		assert(#empty == 0)
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestRPackAPIFromCSVInvalid(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("from_csv", L.NewFunction(luaFromCSV))
+	for _, script := range []string{
+		`from_csv("a,a\n1,2\n")`,
+		`from_csv("a,,c\n1,2,3\n")`,
+		`from_csv("a,b\n1\n")`,
+		`from_csv("a\n", {delimiter = ";;"})`,
+	} {
+		if err := L.DoString(script); err == nil {
+			t.Errorf("Expected error for script %q", script)
+		}
+	}
+}
+
+func TestRPackAPIToCSV(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("to_csv", L.NewFunction(luaToCSV))
+	script := `
+		local s = to_csv({{name = "web1", port = 8080, tls = true}, {name = "a, b", port = "007"}})
+		assert(s == "name,port,tls\nweb1,8080,true\n\"a, b\",007,\n", s)
+
+		s = to_csv({{name = "web1", port = 8080}}, {columns = {"port", "name"}, delimiter = ";", crlf = true})
+		assert(s == "port;name\r\n8080;web1\r\n", s)
+
+		s = to_csv({{name = "web1"}}, {header = false})
+		assert(s == "web1\n", s)
+
+		s = to_csv({{"a", 1.5}, {"b", 2}})
+		assert(s == "a,1.5\nb,2\n", s)
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+	if err := L.DoString(`to_csv({{name = {}}})`); err == nil {
+		t.Error("Expected error for nested table")
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("from_csv", L.NewFunction(luaFromCSV))
+	L.SetGlobal("to_csv", L.NewFunction(luaToCSV))
+	script := `
+		local doc = "a,b\n\"line\nbreak\",x\n"
+		local s = to_csv(from_csv(doc))
+		assert(s == doc, s)
+
+		doc = "zone,host,port\neu,web1,80\n"
+		local rows, header = from_csv(doc)
+		assert(table.concat(header, ",") == "zone,host,port")
+		assert(to_csv(rows) == doc, to_csv(rows))
+		rows[1].extra = "x"
+		s = to_csv(rows)
+		assert(s == "zone,host,port,extra\neu,web1,80,x\n", s)
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
@@ -0,0 +1,71 @@
+package rpack
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func RegisterBase64(name string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tabmod := L.RegisterModule(name, base64Funcs)
+		L.Push(tabmod)
+		return 1
+	}
+}
+
+func RegisterHex(name string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tabmod := L.RegisterModule(name, hexFuncs)
+		L.Push(tabmod)
+		return 1
+	}
+}
+
+var base64Funcs = map[string]lua.LGFunction{
+	"encode":     luaEncodeFunc(base64.StdEncoding.EncodeToString),
+	"decode":     luaBase64Decode(base64.StdEncoding),
+	"url_encode": luaEncodeFunc(base64.URLEncoding.EncodeToString),
+	"url_decode": luaBase64Decode(base64.URLEncoding),
+}
+
+var hexFuncs = map[string]lua.LGFunction{
+	"encode": luaEncodeFunc(hex.EncodeToString),
+	"decode": luaHexDecode,
+}
+
+// luaEncodeFunc returns a Lua function encoding the bytes of its string argument.
+func luaEncodeFunc(encode func([]byte) string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.Push(lua.LString(encode([]byte(L.CheckString(1)))))
+		return 1
+	}
+}
+
+// luaBase64Decode returns a Lua function decoding its string argument with enc.
+// Whitespace is ignored, e.g. the line breaks of PEM blocks, and the padding is optional.
+func luaBase64Decode(enc *base64.Encoding) lua.LGFunction {
+	return func(L *lua.LState) int {
+		s := strings.Join(strings.Fields(L.CheckString(1)), "")
+		b, err := enc.WithPadding(base64.NoPadding).DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			L.ArgError(1, fmt.Sprintf("invalid base64: %s", err))
+			return 0
+		}
+		L.Push(lua.LString(b))
+		return 1
+	}
+}
+
+func luaHexDecode(L *lua.LState) int {
+	b, err := hex.DecodeString(strings.TrimSpace(L.CheckString(1)))
+	if err != nil {
+		L.ArgError(1, fmt.Sprintf("invalid hex: %s", err))
+		return 0
+	}
+	L.Push(lua.LString(b))
+	return 1
+}
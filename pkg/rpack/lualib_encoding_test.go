@@ -0,0 +1,33 @@
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestEncoding(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.PreloadModule("base64", RegisterBase64("base64"))
+	L.PreloadModule("hex", RegisterHex("hex"))
+	script := `
+		local base64 = require("base64")
+		local hex = require("hex")
+		assert(base64.encode("hello") == "aGVsbG8=")
+		assert(base64.decode("aGVsbG8=") == "hello")
+		assert(base64.decode("aGVs\n bG8") == "hello", "whitespace and padding are optional")
+		assert(base64.url_encode("\255\254") == "__4=")
+		assert(base64.url_decode("__4") == "\255\254")
+		assert(base64.decode(base64.encode("a\0b")) == "a\0b", "binary content must be kept")
+		assert(not pcall(base64.decode, "a$b"))
+
+		assert(hex.encode("\1\171") == "01ab")
+		assert(hex.decode("01AB") == "\1\171")
+		assert(not pcall(hex.decode, "abc"))
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
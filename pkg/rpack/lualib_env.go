@@ -0,0 +1,159 @@
+package rpack
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// SourceDateEpochEnv is the environment variable of reproducible builds holding the timestamp
+// as Unix seconds, it pins the clock of scripts unless a timestamp is given.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// LuaEnv is the environment scripts see through the env module. Only what the definition
+// declares in its permissions is exposed, the zero value exposes nothing but the clock.
+type LuaEnv struct {
+	// Declared lists the environment variables the definition declares, reading others fails the script
+	Declared []string
+	// Vars holds the values of the declared variables, unset variables are left out
+	Vars map[string]string
+	// Hostname is the name of the host, reading it fails the script if empty
+	Hostname string
+	// Now is the time of env.now() and env.date(), the current time if zero
+	Now time.Time
+	// Reproducible denies the host name, it differs between machines
+	Reproducible bool
+}
+
+// NewLuaEnv returns the environment of a definition with perms at the time now.
+// Declared variables and the host name are read from the process.
+func NewLuaEnv(perms *RPackDefPermissions, now time.Time) *LuaEnv {
+	env := &LuaEnv{Declared: perms.Env, Vars: make(map[string]string), Now: now}
+	for _, name := range perms.Env {
+		if v, ok := os.LookupEnv(name); ok {
+			env.Vars[name] = v
+		}
+	}
+	if perms.Hostname {
+		env.Hostname, _ = os.Hostname()
+	}
+	return env
+}
+
+// ParseTimestamp parses a timestamp pinning the clock of scripts, either RFC 3339 or Unix seconds.
+func ParseTimestamp(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q, use RFC 3339 or Unix seconds", s)
+	}
+	return t.UTC(), nil
+}
+
+// RegisterEnv registers the env module exposing env.
+func RegisterEnv(name string, env *LuaEnv) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tabmod := L.RegisterModule(name, map[string]lua.LGFunction{
+			"get":      env.luaGet,
+			"hostname": env.luaHostname,
+			"now":      env.luaNow,
+			"date":     env.luaDate,
+		})
+		L.Push(tabmod)
+		return 1
+	}
+}
+
+// now returns the time of the script, truncated to seconds.
+func (env *LuaEnv) now() time.Time {
+	if env.Now.IsZero() {
+		return time.Now().UTC().Truncate(time.Second)
+	}
+	return env.Now.UTC().Truncate(time.Second)
+}
+
+// luaGet returns the value of a declared environment variable or the optional default if it is unset.
+func (env *LuaEnv) luaGet(L *lua.LState) int {
+	name := L.CheckString(1)
+	if !slices.Contains(env.Declared, name) {
+		L.ArgError(1, fmt.Sprintf("environment variable %q is not declared in permissions.env", name))
+		return 0
+	}
+	if v, ok := env.Vars[name]; ok {
+		L.Push(lua.LString(v))
+	} else {
+		L.Push(L.Get(2))
+	}
+	return 1
+}
+
+func (env *LuaEnv) luaHostname(L *lua.LState) int {
+	if env.Reproducible {
+		L.RaiseError("the host name is not available in reproducible mode")
+		return 0
+	}
+	if env.Hostname == "" {
+		L.RaiseError("the host name is not available, declare permissions.hostname")
+		return 0
+	}
+	L.Push(lua.LString(env.Hostname))
+	return 1
+}
+
+// luaNow returns the Unix seconds of the script time.
+func (env *LuaEnv) luaNow(L *lua.LState) int {
+	L.Push(lua.LNumber(env.now().Unix()))
+	return 1
+}
+
+// luaDate formats the script time in UTC with an optional Go layout, RFC 3339 by default.
+func (env *LuaEnv) luaDate(L *lua.LState) int {
+	layout := L.OptString(1, time.RFC3339)
+	L.Push(lua.LString(env.now().Format(layout)))
+	return 1
+}
+
+// reproducibleSeed seeds math.random in reproducible mode.
+const reproducibleSeed = 1
+
+// seedMathRandom replaces math.random and math.randomseed with a generator seeded with seed.
+// The functions of gopher-lua use the global generator of Go, which can not be seeded.
+func seedMathRandom(L *lua.LState, seed int64) {
+	mathMod, ok := L.GetGlobal(lua.MathLibName).(*lua.LTable)
+	if !ok {
+		return
+	}
+	rng := rand.New(rand.NewPCG(uint64(seed), 0)) //nolint:gosec // intentional: deterministic numbers, not for security
+	L.SetField(mathMod, "randomseed", L.NewFunction(func(L *lua.LState) int {
+		rng = rand.New(rand.NewPCG(uint64(L.CheckInt64(1)), 0)) //nolint:gosec // intentional: deterministic numbers, not for security
+		return 0
+	}))
+	L.SetField(mathMod, "random", L.NewFunction(func(L *lua.LState) int {
+		switch L.GetTop() {
+		case 0:
+			L.Push(lua.LNumber(rng.Float64()))
+		case 1:
+			n := L.CheckInt(1)
+			if n < 1 {
+				L.ArgError(1, "interval is empty")
+				return 0
+			}
+			L.Push(lua.LNumber(rng.IntN(n) + 1))
+		default:
+			low, high := L.CheckInt(1), L.CheckInt(2)
+			if low > high {
+				L.ArgError(2, "interval is empty")
+				return 0
+			}
+			L.Push(lua.LNumber(low + rng.IntN(high-low+1)))
+		}
+		return 1
+	}))
+}
@@ -0,0 +1,110 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestEnv(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	env := &LuaEnv{
+		Declared: []string{"CI", "UNSET"},
+		Vars:     map[string]string{"CI": "true", "HOME": "/root"},
+		Now:      time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+	}
+	L.PreloadModule("env", RegisterEnv("env", env))
+	script := `
+		local env = require("env")
+		assert(env.get("CI") == "true")
+		assert(env.get("UNSET") == nil)
+		assert(env.get("UNSET", "default") == "default")
+		assert(not pcall(env.get, "HOME"), "undeclared variables must not be readable")
+		assert(not pcall(env.hostname), "the host name must not be readable without permission")
+		assert(env.now() == 1704164645)
+		assert(env.date() == "2024-01-02T03:04:05Z")
+		assert(env.date("2006-01-02") == "2024-01-02")
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, s := range []string{"1704164645", "2024-01-02T03:04:05Z", "2024-01-02T04:04:05+01:00"} {
+		got, err := ParseTimestamp(s)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseTimestamp(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseTimestamp("yesterday"); err == nil {
+		t.Error("Expected invalid timestamp to fail")
+	}
+}
+
+func TestRunEnvPermissions(t *testing.T) {
+	t.Setenv("RPACK_TEST_ENV", "from-env")
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", env.get(\"RPACK_TEST_ENV\") .. \" \" .. env.date())\n", "")
+	def := filepath.Join(filepath.Dir(workDir), "def", "rpack.yaml")
+	content := "\"@schema_version\": \"v1\"\nname: \"app\"\npermissions:\n  write_target: true\n  env: [RPACK_TEST_ENV]\n"
+	if err := os.WriteFile(def, []byte(content), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, Timestamp: time.Unix(0, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "from-env 1970-01-01T00:00:00Z" { //nolint:gosec // test file
+		t.Errorf("Unexpected output: %q", b)
+	}
+
+	// Definitions without permissions see no environment variables
+	if err := os.WriteFile(def, []byte("\"@schema_version\": \"v1\"\nname: \"app\"\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err == nil {
+		t.Error("Expected reading an undeclared variable to fail the run")
+	}
+}
+
+func TestLuaReproducible(t *testing.T) {
+	script := `
+		local rpack = require("rpack.v1")
+		local out = {}
+		for _ = 1, 3 do
+			table.insert(out, tostring(math.random(1000)))
+		end
+		table.insert(out, tostring(env.now()))
+		table.insert(out, rpack.template("{{ now.Year }}", {}))
+		table.insert(out, rpack.to_json(rpack.from_json('{"b": 1, "a": {"d": 2, "c": 3}}')))
+		assert(not pcall(env.hostname), "the host name must not be available")
+		rpack.write("./out.txt", table.concat(out, "\n"))
+	`
+	var outputs []string
+	for range 3 {
+		fs := NewInMemoryFS()
+		env := (&Executor{Reproducible: true}).luaEnv(&RPackDefPermissions{Hostname: true})
+		if _, err := ExecuteLuaWithOptions(t.Context(), script, fs, nil, LuaOptions{Env: env, Reproducible: true}); err != nil {
+			t.Fatal(err)
+		}
+		b, err := fs.Read("./out.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, string(b))
+	}
+	if outputs[0] != outputs[1] || outputs[1] != outputs[2] {
+		t.Fatalf("Expected identical output of reproducible runs, got %q", outputs)
+	}
+	if !strings.Contains(outputs[0], "\n0\n1970\n") {
+		t.Errorf("Expected clock pinned to the Unix epoch, got %q", outputs[0])
+	}
+}
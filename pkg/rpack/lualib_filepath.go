@@ -1,12 +1,13 @@
 package rpack
 
 import (
-	"path/filepath"
-	"strings"
+	"path"
 
 	lua "github.com/yuin/gopher-lua"
 )
 
+// RegisterFilepath registers the filepath module. Its functions work on slash separated paths
+// on all platforms and accept backslashes as separators, so scripts produce the same paths on Windows.
 func RegisterFilepath(name string) lua.LGFunction {
 	return func(L *lua.LState) int {
 		tabmod := L.RegisterModule(name, filepathFuncs)
@@ -28,43 +29,44 @@ var filepathFuncs = map[string]lua.LGFunction{
 }
 
 func luaFilepathBase(L *lua.LState) int {
-	path := L.CheckString(1)
-	base := filepath.Base(path)
+	p := L.CheckString(1)
+	base := path.Base(toScriptSlash(p))
 	L.Push(lua.LString(base))
 	return 1
 }
 
 func luaFilepathClean(L *lua.LState) int {
-	path := L.CheckString(1)
-	ret := filepath.Clean(path)
+	p := L.CheckString(1)
+	ret := path.Clean(toScriptSlash(p))
 	L.Push(lua.LString(ret))
 	return 1
 }
 
 func luaFilepathDir(L *lua.LState) int {
-	path := L.CheckString(1)
-	ret := filepath.Dir(path)
+	p := L.CheckString(1)
+	ret := path.Dir(toScriptSlash(p))
 	L.Push(lua.LString(ret))
 	return 1
 }
 
 func luaFilepathExt(L *lua.LState) int {
-	path := L.CheckString(1)
-	ret := filepath.Ext(path)
+	p := L.CheckString(1)
+	ret := path.Ext(toScriptSlash(p))
 	L.Push(lua.LString(ret))
 	return 1
 }
 
 func luaFilepathIsAbs(L *lua.LState) int {
-	path := L.CheckString(1)
-	ret := filepath.IsAbs(path)
+	p := L.CheckString(1)
+	ret := hasVolumeName(p) || path.IsAbs(toScriptSlash(p))
 	L.Push(lua.LBool(ret))
 	return 1
 }
 
 func luaFilepathIsLocal(L *lua.LState) int {
-	path := L.CheckString(1)
-	ret := filepath.IsLocal(path)
+	p := L.CheckString(1)
+	_, err := cleanScriptPath(p)
+	ret := err == nil
 	L.Push(lua.LBool(ret))
 	return 1
 }
@@ -78,28 +80,30 @@ func luaFilepathJoin(L *lua.LState) int {
 	for i := 3; i <= argNum; i++ {
 		args = append(args, L.CheckString(i))
 	}
-	ret := filepath.Join(args...)
+	for i := range args {
+		args[i] = toScriptSlash(args[i])
+	}
+	ret := path.Join(args...)
 	L.Push(lua.LString(ret))
 	return 1
 }
 
 func luaFilepathSplit(L *lua.LState) int {
-	path := L.CheckString(1)
-	dir, file := filepath.Split(path)
+	p := L.CheckString(1)
+	dir, file := path.Split(toScriptSlash(p))
 	L.Push(lua.LString(dir))
 	L.Push(lua.LString(file))
 	return 2
 }
 
 func luaFilepathLocation(L *lua.LState) int {
-	path := L.CheckString(1)
-	before, after, found := strings.Cut(path, ":")
+	p := L.CheckString(1)
+	prefix, rest, found := splitPrefix(p)
 	if found {
-		L.Push(lua.LString(before))
-		L.Push(lua.LString(after))
+		L.Push(lua.LString(prefix))
 	} else {
 		L.Push(lua.LString("target"))
-		L.Push(lua.LString(before))
 	}
+	L.Push(lua.LString(rest))
 	return 2
 }
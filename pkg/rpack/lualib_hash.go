@@ -0,0 +1,39 @@
+package rpack
+
+import (
+	"crypto/md5"  //nolint:gosec // intentional: md5 digests for cache busting, not for security
+	"crypto/sha1" //nolint:gosec // intentional: sha1 digests for compatibility, not for security
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func RegisterHash(name string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tabmod := L.RegisterModule(name, hashFuncs)
+		L.Push(tabmod)
+		return 1
+	}
+}
+
+var hashFuncs = map[string]lua.LGFunction{
+	"sha256": luaHashFunc(sha256.New),
+	"sha512": luaHashFunc(sha512.New),
+	"sha1":   luaHashFunc(sha1.New),
+	"md5":    luaHashFunc(md5.New),
+	"crc32":  luaHashFunc(func() hash.Hash { return crc32.NewIEEE() }),
+}
+
+// luaHashFunc returns a Lua function returning the lower case hex digest of its string argument.
+func luaHashFunc(newHash func() hash.Hash) lua.LGFunction {
+	return func(L *lua.LState) int {
+		h := newHash()
+		_, _ = h.Write([]byte(L.CheckString(1)))
+		L.Push(lua.LString(hex.EncodeToString(h.Sum(nil))))
+		return 1
+	}
+}
@@ -0,0 +1,28 @@
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestHash(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.PreloadModule("hash", RegisterHash("hash"))
+	script := `
+		local hash = require("hash")
+		assert(hash.sha256("") == "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+		assert(hash.sha256("hello") == "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+		assert(#hash.sha512("hello") == 128)
+		assert(hash.sha1("hello") == "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d")
+		assert(hash.md5("hello") == "5d41402abc4b2a76b9719d911017c592")
+		assert(hash.crc32("hello") == "3610a686")
+		assert(hash.md5("a\0b") ~= hash.md5("a"), "binary content must be hashed completely")
+		assert(not pcall(hash.sha256))
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !rpack_nojq
+
+package rpack
+
+import (
+	"fmt"
+
+	"github.com/itchyny/gojq"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func init() {
+	registerFeature(FeatureJQ)
+}
+
+// luaJQ executes a gojq (https://github.com/itchyny/gojq) query
+// on the provided data.
+func luaJQ(L *lua.LState) int {
+	queryStr := L.CheckString(1)
+	val := L.CheckTable(2)
+	goVal, err := luaTableToGo(val)
+	if err != nil {
+		L.ArgError(2, err.Error())
+		return 0
+	}
+
+	query, err := gojq.Parse(queryStr)
+	if err != nil {
+		L.ArgError(1, fmt.Errorf("failed to parse query: %w", err).Error())
+		return 0
+	}
+	iter := query.Run(goVal)
+	var res []any
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			if err, ok := err.(*gojq.HaltError); ok && err.Value() == nil {
+				break
+			}
+			L.ArgError(2, fmt.Errorf("error executing query: %w", err).Error())
+			return 0
+		}
+		res = append(res, v)
+	}
+	L.Push(goToLValue(L, res))
+	return 1
+}
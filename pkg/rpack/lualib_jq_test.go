@@ -0,0 +1,25 @@
+//go:build !rpack_nojq
+
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestRPackJQ(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("fn", L.NewFunction(luaJQ))
+	script := `
+		local data = {users={"alice","bob"}}
+		local query = ".users[1]"
+        local result = fn(query, data)
+		assert(result[1] == "bob")
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build rpack_nojq
+
+package rpack
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaJQ raises an error in builds with the rpack_nojq tag.
+func luaJQ(L *lua.LState) int {
+	L.RaiseError("rpack.jq is not available: %s", featureDisabledError(FeatureJQ))
+	return 0
+}
@@ -0,0 +1,274 @@
+package rpack
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// propertiesOptions controls how properties files are written.
+type propertiesOptions struct {
+	// Separator between key and value
+	Separator string
+	// ASCII escapes non-ASCII characters as \uXXXX, as expected by
+	// java.util.Properties.load(InputStream) which reads ISO-8859-1.
+	ASCII bool
+}
+
+func defaultPropertiesOptions() *propertiesOptions {
+	return &propertiesOptions{
+		Separator: "=",
+		ASCII:     true,
+	}
+}
+
+// propertiesOptionsFromTable reads optional settings from a Lua options table.
+func propertiesOptionsFromTable(tbl *lua.LTable) *propertiesOptions {
+	opts := defaultPropertiesOptions()
+	if tbl == nil {
+		return opts
+	}
+	if v, ok := tbl.RawGetString("separator").(lua.LString); ok {
+		opts.Separator = string(v)
+	}
+	if v, ok := tbl.RawGetString("ascii").(lua.LBool); ok {
+		opts.ASCII = bool(v)
+	}
+	return opts
+}
+
+// propertiesLogicalLines joins continuation lines and drops blank and comment lines.
+// Leading whitespace of continuation lines is discarded.
+func propertiesLogicalLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	s = strings.TrimPrefix(s, "\uFEFF")
+
+	var lines []string
+	var cur strings.Builder
+	continued := false
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimLeft(line, " \t\f")
+		if !continued && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		// An odd number of trailing backslashes continues the line
+		n := len(line) - len(strings.TrimRight(line, `\`))
+		if n%2 == 1 {
+			cur.WriteString(line[:len(line)-1])
+			continued = true
+			continue
+		}
+		cur.WriteString(line)
+		lines = append(lines, cur.String())
+		cur.Reset()
+		continued = false
+	}
+	if continued {
+		lines = append(lines, cur.String())
+	}
+	return lines
+}
+
+// unescapeProperties resolves backslash escapes of a key or value.
+func unescapeProperties(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("malformed \\uxxxx encoding")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\uxxxx encoding: %s", s[i-1:i+5])
+			}
+			i += 4
+			// Combine UTF-16 surrogate pairs
+			if r >= 0xD800 && r < 0xDC00 && i+7 <= len(s) && s[i+1:i+3] == `\u` {
+				lo, err := strconv.ParseUint(s[i+3:i+7], 16, 32)
+				if err == nil && lo >= 0xDC00 && lo < 0xE000 {
+					r = 0x10000 + (r-0xD800)<<10 + (lo - 0xDC00)
+					i += 6
+				}
+			}
+			sb.WriteRune(rune(r))
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// parseProperties parses the content of a properties file.
+// Later keys overwrite earlier ones, like java.util.Properties.
+func parseProperties(s string) (map[string]any, error) {
+	res := make(map[string]any)
+	for _, line := range propertiesLogicalLines(s) {
+		// The key ends at the first unescaped separator or whitespace
+		end := len(line)
+		for i := 0; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+				continue
+			}
+			if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+				end = i
+				break
+			}
+		}
+		rest := strings.TrimLeft(line[end:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+		key, err := unescapeProperties(line[:end])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", line[:end], err)
+		}
+		val, err := unescapeProperties(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of key %q: %w", key, err)
+		}
+		res[key] = val
+	}
+	return res, nil
+}
+
+// escapeProperties escapes a key or value for a properties file.
+// Keys additionally escape whitespace and separators, values only
+// escape leading whitespace.
+func escapeProperties(s string, isKey bool, opts *propertiesOptions) string {
+	var sb strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case ' ':
+			if isKey || i == 0 {
+				sb.WriteByte('\\')
+			}
+			sb.WriteByte(' ')
+		default:
+			switch {
+			case r < 0x20 || (opts.ASCII && r > 0x7e):
+				writeUnicodeEscape(&sb, r)
+			default:
+				sb.WriteRune(r)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// writeUnicodeEscape writes r as \uXXXX, using a surrogate pair outside the BMP.
+func writeUnicodeEscape(sb *strings.Builder, r rune) {
+	if r == utf8.RuneError || r <= 0xFFFF {
+		fmt.Fprintf(sb, `\u%04X`, r)
+		return
+	}
+	r -= 0x10000
+	fmt.Fprintf(sb, `\u%04X\u%04X`, 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+}
+
+// writeProperties encodes a flat map as properties file in sorted key order.
+func writeProperties(data any, opts *propertiesOptions) (string, error) {
+	m, ok := data.(map[string]any)
+	if !ok {
+		if l, isList := data.([]any); !isList || len(l) > 0 {
+			return "", fmt.Errorf("expected table with string keys")
+		}
+		m = map[string]any{}
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		var val string
+		switch v := m[k].(type) {
+		case string:
+			val = v
+		case bool:
+			val = strconv.FormatBool(v)
+		case int:
+			val = strconv.Itoa(v)
+		case int64:
+			val = strconv.FormatInt(v, 10)
+		case float64:
+			val = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return "", fmt.Errorf("value of key %q must be a string, number or boolean", k)
+		}
+		sb.WriteString(escapeProperties(k, true, opts))
+		sb.WriteString(opts.Separator)
+		sb.WriteString(escapeProperties(val, false, opts))
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// luaFromProperties parses a properties string into a flat table of strings.
+func luaFromProperties(L *lua.LState) int {
+	input := L.CheckString(1)
+	data, err := parseProperties(input)
+	if err != nil {
+		L.ArgError(1, fmt.Errorf("failed to unmarshal properties: %w", err).Error())
+		return 0
+	}
+	L.Push(goToLValue(L, data))
+	return 1
+}
+
+// luaToProperties serializes a flat table into a properties string.
+// Accepts an optional options table (separator, ascii).
+func luaToProperties(L *lua.LState) int {
+	val := L.CheckTable(1)
+	opts := propertiesOptionsFromTable(L.OptTable(2, nil))
+	data, err := luaTableToGo(val)
+	if err != nil {
+		L.ArgError(1, err.Error())
+		return 0
+	}
+	s, err := writeProperties(data, opts)
+	if err != nil {
+		L.ArgError(1, fmt.Errorf("failed to marshal properties: %w", err).Error())
+		return 0
+	}
+	L.Push(lua.LString(s))
+	return 1
+}
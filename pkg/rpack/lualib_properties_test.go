@@ -0,0 +1,99 @@
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestRPackAPIFromProperties(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("from_properties", L.NewFunction(luaFromProperties))
+	script := `
+		local p = from_properties([[
+# comment
+! also a comment
+server.port=8080
+spring.application.name : my-service
+logging.level   DEBUG
+path=C:\\tmp\\dir
+multi=first, \
+      second
+key\ with\ spaces=value
+key\=eq=x
+unicode=gr\u00FC\u00DFe
+emoji=\uD83D\uDE00
+empty=
+  indented = yes
+]])
+		assert(p["server.port"] == "8080", p["server.port"])
+		assert(p["spring.application.name"] == "my-service")
+		assert(p["logging.level"] == "DEBUG")
+		assert(p["path"] == "C:\\tmp\\dir")
+		assert(p["multi"] == "first, second")
+		assert(p["key with spaces"] == "value")
+		assert(p["key=eq"] == "x")
+		assert(p["unicode"] == "grüße")
+		assert(p["emoji"] == "😀")
+		assert(p["empty"] == "")
+		assert(p["indented"] == "yes")
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestRPackAPIFromPropertiesInvalid(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("from_properties", L.NewFunction(luaFromProperties))
+	for _, doc := range []string{`a=\u12`, `a=\uZZZZ`} {
+		L.SetGlobal("doc", lua.LString(doc))
+		if err := L.DoString(`from_properties(doc)`); err == nil {
+			t.Errorf("Expected error for document %q", doc)
+		}
+	}
+}
+
+func TestRPackAPIToProperties(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("to_properties", L.NewFunction(luaToProperties))
+	L.SetGlobal("from_properties", L.NewFunction(luaFromProperties))
+	script := `
+		local data = {
+			["server.port"] = 8080,
+			["b.enabled"] = true,
+			["a key"] = " leading space",
+			["c"] = "x=y:z #!",
+			["d"] = "line1\nline2",
+			["e"] = "grüße",
+		}
+		local s = to_properties(data)
+		local expected = "a\\ key=\\ leading space\n" ..
+			"b.enabled=true\n" ..
+			"c=x\\=y\\:z \\#\\!\n" ..
+			"d=line1\\nline2\n" ..
+			"e=gr\\u00FC\\u00DFe\n" ..
+			"server.port=8080\n"
+		assert(s == expected, s)
+
+		local back = from_properties(s)
+		assert(back["a key"] == " leading space")
+		assert(back["c"] == "x=y:z #!")
+		assert(back["d"] == "line1\nline2")
+		assert(back["e"] == "grüße")
+
+		assert(to_properties({e = "grüße"}, {separator = " = ", ascii = false}) == "e = grüße\n")
+		assert(to_properties({}) == "")
+		assert(not pcall(to_properties, {a = {b = "c"}}))
+		assert(not pcall(to_properties, {"a", "b"}))
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
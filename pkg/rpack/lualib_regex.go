@@ -0,0 +1,187 @@
+package rpack
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func RegisterRegex(name string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tabmod := L.RegisterModule(name, regexFuncs)
+		L.Push(tabmod)
+		return 1
+	}
+}
+
+var regexFuncs = map[string]lua.LGFunction{
+	"match":       luaRegexMatch,
+	"find":        luaRegexFind,
+	"find_all":    luaRegexFindAll,
+	"capture":     luaRegexCapture,
+	"capture_all": luaRegexCaptureAll,
+	"replace":     luaRegexReplace,
+	"split":       luaRegexSplit,
+	"quote":       luaRegexQuote,
+}
+
+// regexCacheSize limits the number of compiled patterns kept by regexCache.
+const regexCacheSize = 256
+
+// regexCache holds compiled patterns, scripts tend to use the same patterns in loops.
+// It is emptied when full, patterns built from data would otherwise grow it without bound.
+var regexCache = struct {
+	sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{patterns: make(map[string]*regexp.Regexp)}
+
+// checkRegex compiles the pattern at argument n or raises an argument error.
+func checkRegex(L *lua.LState, n int) *regexp.Regexp {
+	pattern := L.CheckString(n)
+	regexCache.Lock()
+	defer regexCache.Unlock()
+	if re, ok := regexCache.patterns[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		L.ArgError(n, fmt.Sprintf("invalid regex: %s", err))
+		return nil
+	}
+	if len(regexCache.patterns) >= regexCacheSize {
+		clear(regexCache.patterns)
+	}
+	regexCache.patterns[pattern] = re
+	return re
+}
+
+// captureTable builds a table of a match from submatch indices.
+// Index 0 holds the whole match, 1..n the capture groups and named
+// groups are additionally available by name. Unmatched groups are empty strings.
+func captureTable(L *lua.LState, re *regexp.Regexp, s string, loc []int) *lua.LTable {
+	tbl := L.NewTable()
+	names := re.SubexpNames()
+	for i := 0; i*2 < len(loc); i++ {
+		val := ""
+		if loc[2*i] >= 0 {
+			val = s[loc[2*i]:loc[2*i+1]]
+		}
+		tbl.RawSetInt(i, lua.LString(val))
+		if names[i] != "" {
+			tbl.RawSetString(names[i], lua.LString(val))
+		}
+	}
+	return tbl
+}
+
+func luaRegexMatch(L *lua.LState) int {
+	re := checkRegex(L, 1)
+	s := L.CheckString(2)
+	L.Push(lua.LBool(re.MatchString(s)))
+	return 1
+}
+
+func luaRegexFind(L *lua.LState) int {
+	re := checkRegex(L, 1)
+	s := L.CheckString(2)
+	loc := re.FindStringIndex(s)
+	if loc == nil {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(lua.LString(s[loc[0]:loc[1]]))
+	return 1
+}
+
+func luaRegexFindAll(L *lua.LState) int {
+	re := checkRegex(L, 1)
+	s := L.CheckString(2)
+	n := L.OptInt(3, -1)
+	tbl := L.NewTable()
+	for _, m := range re.FindAllString(s, n) {
+		tbl.Append(lua.LString(m))
+	}
+	L.Push(tbl)
+	return 1
+}
+
+func luaRegexCapture(L *lua.LState) int {
+	re := checkRegex(L, 1)
+	s := L.CheckString(2)
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(captureTable(L, re, s, loc))
+	return 1
+}
+
+func luaRegexCaptureAll(L *lua.LState) int {
+	re := checkRegex(L, 1)
+	s := L.CheckString(2)
+	n := L.OptInt(3, -1)
+	tbl := L.NewTable()
+	for _, loc := range re.FindAllStringSubmatchIndex(s, n) {
+		tbl.Append(captureTable(L, re, s, loc))
+	}
+	L.Push(tbl)
+	return 1
+}
+
+// luaRegexReplace replaces all matches. The replacement is either a string
+// with $1 / ${name} expansion or a function receiving the capture table
+// and returning the replacement string.
+func luaRegexReplace(L *lua.LState) int {
+	re := checkRegex(L, 1)
+	s := L.CheckString(2)
+	switch repl := L.Get(3).(type) {
+	case lua.LString:
+		L.Push(lua.LString(re.ReplaceAllString(s, string(repl))))
+	case *lua.LFunction:
+		var sb strings.Builder
+		last := 0
+		for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+			sb.WriteString(s[last:loc[0]])
+			L.Push(repl)
+			L.Push(captureTable(L, re, s, loc))
+			L.Call(1, 1)
+			ret := L.Get(-1)
+			L.Pop(1)
+			str, ok := ret.(lua.LString)
+			if !ok {
+				L.ArgError(3, fmt.Sprintf("replacement function must return a string, got %s", ret.Type()))
+				return 0
+			}
+			sb.WriteString(string(str))
+			last = loc[1]
+		}
+		sb.WriteString(s[last:])
+		L.Push(lua.LString(sb.String()))
+	default:
+		L.ArgError(3, "string or function expected")
+		return 0
+	}
+	return 1
+}
+
+func luaRegexSplit(L *lua.LState) int {
+	re := checkRegex(L, 1)
+	s := L.CheckString(2)
+	n := L.OptInt(3, -1)
+	tbl := L.NewTable()
+	for _, part := range re.Split(s, n) {
+		tbl.Append(lua.LString(part))
+	}
+	L.Push(tbl)
+	return 1
+}
+
+func luaRegexQuote(L *lua.LState) int {
+	s := L.CheckString(1)
+	L.Push(lua.LString(regexp.QuoteMeta(s)))
+	return 1
+}
@@ -0,0 +1,109 @@
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestRegexMatchFind(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("match", L.NewFunction(luaRegexMatch))
+	L.SetGlobal("find", L.NewFunction(luaRegexFind))
+	L.SetGlobal("find_all", L.NewFunction(luaRegexFindAll))
+	script := `
+		assert(match("^v[0-9]+$", "v12") == true)
+		assert(match("^v[0-9]+$", "v12a") == false)
+		assert(find("[0-9]+", "port 8080 and 9090") == "8080")
+		assert(find("[0-9]+", "none") == nil)
+		local all = find_all("[0-9]+", "port 8080 and 9090")
+		assert(#all == 2 and all[1] == "8080" and all[2] == "9090")
+		assert(#find_all("[0-9]+", "1 2 3", 2) == 2)
+		assert(#find_all("x", "abc") == 0)
+		assert(not pcall(match, "(", "x"))
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestRegexCapture(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("capture", L.NewFunction(luaRegexCapture))
+	L.SetGlobal("capture_all", L.NewFunction(luaRegexCaptureAll))
+	script := `
+		local c = capture("(?P<key>\\w+)=(\\w*)(;)?", "name=value")
+		assert(c[0] == "name=value")
+		assert(c[1] == "name" and c.key == "name")
+		assert(c[2] == "value")
+		assert(c[3] == "")
+		assert(capture("x(y)", "abc") == nil)
+
+		local all = capture_all("(\\w+)=(\\w+)", "a=1, b=2")
+		assert(#all == 2)
+		assert(all[2][1] == "b" and all[2][2] == "2")
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestRegexReplace(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("replace", L.NewFunction(luaRegexReplace))
+	script := `
+		assert(replace("(\\w+)@(\\w+)", "bob@example alice@test", "$2:$1") == "example:bob test:alice")
+		assert(replace("(?P<k>\\w+)=", "a=1", "${k}: ") == "a: 1")
+		assert(replace("^", "line", "> ") == "> line")
+		local r = replace("[0-9]+", "a1b22c333", function(m) return tostring(#m[0]) end)
+		assert(r == "a1b2c3", r)
+		assert(not pcall(replace, "a", "a", function() return 1 end))
+		assert(not pcall(replace, "a", "a", {}))
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestRegexSplitQuote(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("split", L.NewFunction(luaRegexSplit))
+	L.SetGlobal("quote", L.NewFunction(luaRegexQuote))
+	script := `
+		local parts = split("\\s*,\\s*", "a , b,c")
+		assert(#parts == 3 and parts[1] == "a" and parts[2] == "b" and parts[3] == "c")
+		assert(#split(",", "a,b,c", 2) == 2)
+		assert(quote("a.b*c") == "a\\.b\\*c")
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestRegexCacheBounded(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("match", L.NewFunction(luaRegexMatch))
+	script := `
+		for i = 1, 1000 do
+			assert(match("^id" .. i .. "$", "id" .. i))
+		end
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+	regexCache.Lock()
+	defer regexCache.Unlock()
+	if n := len(regexCache.patterns); n > regexCacheSize {
+		t.Errorf("Expected at most %d cached patterns, got %d", regexCacheSize, n)
+	}
+}
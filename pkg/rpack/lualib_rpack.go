@@ -1,49 +1,128 @@
 package rpack
 
 import (
+	"bufio"
 	"bytes"
+	"cmp"
 	"encoding/json"
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"strings"
 	"text/template"
+	"text/template/parse"
+	"time"
 
 	"fmt"
 
-	"github.com/itchyny/gojq"
 	lua "github.com/yuin/gopher-lua"
-	"sigs.k8s.io/yaml"
 )
 
 type LuaAPIFS interface {
 	Write(name string, b []byte) error
+	Append(name string, b []byte) error
+	Patch(name string, diff string) error
 	Read(name string) ([]byte, error)
+	Open(name string) (io.ReadCloser, error)
 	Stat(name string) (exists bool, dir bool, err error)
 	ReadDir(name string) (_files []string, _dirs []string, _err error)
 	ReadDirAll(name string) (_files []string, _dirs []string, _err error)
+	Remove(name string) error
+	Rename(from, to string) error
 }
 
 type RPackAPI struct {
 	fs LuaAPIFS
+	// readers opened by lines_iter which are not yet exhausted
+	readers map[io.Closer]struct{}
+	// annotations reported by rpack.warn and rpack.annotate
+	annotations []*Annotation
+	// writes records target files written to detect multi-writes
+	writes *writeTracker
+	// lintTemplates makes template fail on missing data and warn about unused data
+	lintTemplates bool
+	// templateDefaults are the template options of the definition, optional
+	templateDefaults *RPackDefTemplate
+	// now is the clock of templates, the pinned time of the env module, time.Now if nil
+	now func() time.Time
+}
+
+// Annotation is a non-fatal finding reported by a script.
+type Annotation struct {
+	// Pack reporting the annotation, only set for multi-pack configs
+	Pack string `json:"pack,omitempty"`
+	// Path of the file in the target the annotation refers to, empty for warnings
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
 }
 
 func NewRPackAPI(fs LuaAPIFS) *RPackAPI {
 
 	return &RPackAPI{
-		fs: fs,
+		fs:      fs,
+		readers: make(map[io.Closer]struct{}),
+		writes:  newWriteTracker(fs),
+	}
+}
+
+// Annotations returns the warnings and annotations reported so far.
+func (a *RPackAPI) Annotations() []*Annotation {
+	return a.annotations
+}
+
+// MultiWrites returns the target files written more than once with different content so far.
+func (a *RPackAPI) MultiWrites() []*MultiWrite {
+	return a.writes.multiWrites()
+}
+
+// Close closes readers of iterators that were not fully consumed.
+func (a *RPackAPI) Close() {
+	for r := range a.readers {
+		_ = r.Close()
 	}
+	clear(a.readers)
 }
 
 func (a *RPackAPI) Funcs() map[string]lua.LGFunction {
-	return map[string]lua.LGFunction{
-		"copy":      a.luaCopy,
-		"from_json": luaFromJSON,
-		"to_json":   luaToJSON,
-		"from_yaml": luaFromYAML,
-		"to_yaml":   luaToYAML,
-		"write":     a.luaWrite,
-		"read":      a.luaRead,
-		"read_dir":  a.luaReadDir,
-		"template":  luaTemplate,
-		"jq":        luaJQ,
+	funcs := map[string]lua.LGFunction{
+		"copy":            a.luaCopy,
+		"from_json":       luaFromJSON,
+		"to_json":         luaToJSON,
+		"from_yaml":       luaFromYAML,
+		"to_yaml":         luaToYAML,
+		"from_xml":        luaFromXML,
+		"to_xml":          luaToXML,
+		"from_properties": luaFromProperties,
+		"to_properties":   luaToProperties,
+		"from_csv":        luaFromCSV,
+		"to_csv":          luaToCSV,
+		"write":           a.luaWrite,
+		"write_json":      a.luaWriteJSON,
+		"write_yaml":      a.luaWriteYAML,
+		"append":          a.luaAppend,
+		"patch":           a.luaPatch,
+		"remove":          a.luaRemove,
+		"rename":          a.luaRename,
+		"managed_block":   a.luaManagedBlock,
+		"read":            a.luaRead,
+		"read_bytes":      a.luaReadBytes,
+		"write_bytes":     a.luaWriteBytes,
+		"is_binary":       a.luaIsBinary,
+		"content_type":    a.luaContentType,
+		"read_dir":        a.luaReadDir,
+		"exists":          a.luaExists,
+		"is_dir":          a.luaIsDir,
+		"lines_iter":      a.luaLinesIter,
+		"detect_encoding": a.luaDetectEncoding,
+		"warn":            a.luaWarn,
+		"annotate":        a.luaAnnotate,
+		"template":        a.luaTemplate,
+		"jq":              luaJQ,
+	}
+	for name, attr := range tracedLuaFuncs {
+		funcs[name] = traceLuaFunc(name, attr, funcs[name])
 	}
+	return funcs
 }
 
 func (a *RPackAPI) RegisterFunc(name string) lua.LGFunction {
@@ -57,25 +136,118 @@ func (a *RPackAPI) RegisterFunc(name string) lua.LGFunction {
 func (a *RPackAPI) luaCopy(L *lua.LState) int {
 	in := L.CheckString(1)
 	out := L.CheckString(2)
+	if c, ok := a.fs.(fileCopier); ok {
+		sha, err := c.Copy(in, out)
+		if err != nil {
+			raiseFileError(L, "copy", in+" to "+out, err)
+			return 0
+		}
+		a.writes.recordSha(L, out, sha)
+		return 0
+	}
 	b, err := a.fs.Read(in)
 	if err != nil {
-		L.ArgError(1, err.Error())
+		raiseFileError(L, "read", in, err)
 		return 0
 	}
 	err = a.fs.Write(out, b)
 	if err != nil {
-		L.ArgError(2, err.Error())
+		raiseFileError(L, "write", out, err)
+		return 0
+	}
+	a.writes.record(L, out, b)
+	return 0
+}
+
+// fileCopier is implemented by filesystems copying files without reading them into the script.
+type fileCopier interface {
+	Copy(src, dst string) (sha string, err error)
+}
+
+// luaWarn records a warning shown in the run summary.
+func (a *RPackAPI) luaWarn(L *lua.LState) int {
+	msg := L.CheckString(1)
+	a.annotations = append(a.annotations, &Annotation{Message: msg})
+	return 0
+}
+
+// luaAnnotate records a finding about a file of the target shown in the run summary.
+func (a *RPackAPI) luaAnnotate(L *lua.LState) int {
+	path := strings.TrimPrefix(L.CheckString(1), "./")
+	msg := L.CheckString(2)
+	if path == "" {
+		L.ArgError(1, "path must not be empty")
 		return 0
 	}
+	a.annotations = append(a.annotations, &Annotation{Path: path, Message: msg})
 	return 0
 }
 
 func (a *RPackAPI) luaWrite(L *lua.LState) int {
 	friendly := L.CheckString(1)
 	content := L.CheckString(2)
-	err := a.fs.Write(friendly, []byte(content))
-	if err != nil {
-		L.ArgError(1, err.Error())
+	return a.writeFile(L, friendly, []byte(content))
+}
+
+// luaAppend appends content to a file, creating it if needed.
+// For target files only content written during this run is extended.
+func (a *RPackAPI) luaAppend(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	content := L.CheckString(2)
+	if err := a.fs.Append(friendly, []byte(content)); err != nil {
+		raiseFileError(L, "append to", friendly, err)
+		return 0
+	}
+	return 0
+}
+
+// luaPatch applies a unified diff to a file written during this run.
+func (a *RPackAPI) luaPatch(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	diff := L.CheckString(2)
+	if err := a.fs.Patch(friendly, diff); err != nil {
+		raiseFileError(L, "patch", friendly, err)
+		return 0
+	}
+	return 0
+}
+
+// luaRemove removes a temp file or a target file written during this run.
+func (a *RPackAPI) luaRemove(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	if err := a.fs.Remove(friendly); err != nil {
+		raiseFileError(L, "remove", friendly, err)
+		return 0
+	}
+	a.writes.remove(friendly)
+	return 0
+}
+
+// luaRename moves a temp file or a target file written during this run, replacing the destination.
+func (a *RPackAPI) luaRename(L *lua.LState) int {
+	from := L.CheckString(1)
+	to := L.CheckString(2)
+	if err := a.fs.Rename(from, to); err != nil {
+		raiseFileError(L, "rename", from+" to "+to, err)
+		return 0
+	}
+	a.writes.rename(L, from, to)
+	return 0
+}
+
+// luaManagedBlock writes only the block delimited by BEGIN and END marker lines of a target file,
+// the rest of the file is kept as is.
+func (a *RPackAPI) luaManagedBlock(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	marker := L.CheckString(2)
+	content := L.CheckString(3)
+	w, ok := a.fs.(blockWriter)
+	if !ok {
+		L.RaiseError("managed blocks are not supported by this filesystem")
+		return 0
+	}
+	if err := w.WriteBlock(friendly, marker, content); err != nil {
+		raiseFileError(L, "write block to", friendly, err)
 		return 0
 	}
 	return 0
@@ -85,13 +257,114 @@ func (a *RPackAPI) luaRead(L *lua.LState) int {
 	friendly := L.CheckString(1)
 	b, err := a.fs.Read(friendly)
 	if err != nil {
-		L.ArgError(1, err.Error())
+		raiseFileError(L, "read", friendly, err)
 		return 0
 	}
 	L.Push(lua.LString(string(b)))
 	return 1
 }
 
+// luaLinesIter returns an iterator streaming the lines of a file without
+// reading it into memory at once. Line endings and a leading UTF-8 BOM are stripped.
+// The iterator returns the line and its line number, nil once the file is exhausted.
+func (a *RPackAPI) luaLinesIter(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	rc, err := a.fs.Open(friendly)
+	if err != nil {
+		raiseFileError(L, "read", friendly, err)
+		return 0
+	}
+	a.readers[rc] = struct{}{}
+	closeReader := func() {
+		if _, ok := a.readers[rc]; ok {
+			delete(a.readers, rc)
+			_ = rc.Close()
+		}
+	}
+	br := bufio.NewReader(rc)
+	lineNo := 0
+	iter := func(L *lua.LState) int {
+		if _, ok := a.readers[rc]; !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		line, readErr := br.ReadString('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			closeReader()
+			raiseFileError(L, "read", friendly, readErr)
+			return 0
+		}
+		if line == "" && readErr != nil {
+			closeReader()
+			L.Push(lua.LNil)
+			return 1
+		}
+		if lineNo == 0 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		lineNo++
+		line = strings.TrimSuffix(line, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		L.Push(lua.LString(line))
+		L.Push(lua.LNumber(lineNo))
+		return 2
+	}
+	L.Push(L.NewFunction(iter))
+	return 1
+}
+
+// luaDetectEncoding reports encoding, byte order mark and line endings of a file.
+func (a *RPackAPI) luaDetectEncoding(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	b, err := a.fs.Read(friendly)
+	if err != nil {
+		raiseFileError(L, "read", friendly, err)
+		return 0
+	}
+	report, err := detectTextEncoding(b)
+	if err != nil {
+		L.ArgError(1, fmt.Sprintf("failed to decode %s: %s", friendly, err))
+		return 0
+	}
+	counts := L.NewTable()
+	counts.RawSetString("lf", lua.LNumber(report.LF))
+	counts.RawSetString("crlf", lua.LNumber(report.CRLF))
+	counts.RawSetString("cr", lua.LNumber(report.CR))
+	ret := L.NewTable()
+	ret.RawSetString("encoding", lua.LString(report.Encoding))
+	ret.RawSetString("bom", lua.LBool(report.BOM))
+	ret.RawSetString("line_ending", lua.LString(report.LineEnding()))
+	ret.RawSetString("line_endings", counts)
+	ret.RawSetString("mixed", lua.LBool(report.Mixed()))
+	L.Push(ret)
+	return 1
+}
+
+// luaExists reports if a file or directory exists. Like reads it is subject to access control,
+// and checking an input the script also writes is a purity violation.
+func (a *RPackAPI) luaExists(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	exists, _, err := a.fs.Stat(friendly)
+	if err != nil {
+		raiseFileError(L, "stat", friendly, err)
+		return 0
+	}
+	L.Push(lua.LBool(exists))
+	return 1
+}
+
+// luaIsDir reports if a directory exists, see luaExists.
+func (a *RPackAPI) luaIsDir(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	exists, dir, err := a.fs.Stat(friendly)
+	if err != nil {
+		raiseFileError(L, "stat", friendly, err)
+		return 0
+	}
+	L.Push(lua.LBool(exists && dir))
+	return 1
+}
+
 func (a *RPackAPI) luaReadDir(L *lua.LState) int {
 	friendly := L.CheckString(1)
 	recursive := L.CheckBool(2)
@@ -104,7 +377,7 @@ func (a *RPackAPI) luaReadDir(L *lua.LState) int {
 		files, dirs, err = a.fs.ReadDir(friendly)
 	}
 	if err != nil {
-		L.ArgError(1, err.Error())
+		raiseFileError(L, "read directory", friendly, err)
 		return 0
 	}
 	L.Push(goToLValue(L, files))
@@ -126,7 +399,11 @@ func luaFromJSON(L *lua.LState) int {
 // luaToJSON marshals a Lua table as JSON and writes it out.
 func luaToJSON(L *lua.LState) int {
 	val := L.CheckTable(1)
-	goVal := luaTableToGo(val)
+	goVal, err := luaTableToGo(val)
+	if err != nil {
+		L.ArgError(1, err.Error())
+		return 0
+	}
 	jsonBytes, err := json.MarshalIndent(goVal, "", "  ")
 	if err != nil {
 		L.ArgError(1, fmt.Errorf("failed to marshal JSON: %w", err).Error())
@@ -136,85 +413,150 @@ func luaToJSON(L *lua.LState) int {
 	return 1
 }
 
-func luaFromYAML(L *lua.LState) int {
-	input := L.CheckString(1)
-	var data any
-	if err := yaml.Unmarshal([]byte(input), &data); err != nil {
-		L.ArgError(1, fmt.Errorf("failed to unmarshal YAML: %w", err).Error())
-		return 0
+// luaTemplate treats the given string as a text/template,
+// executes it with the provided Lua data (converted to a Go value), and returns the result.
+// It supports optional start and end delimiters or an options table.
+func luaTemplate(L *lua.LState) int {
+	return renderLuaTemplate(L, &templateOptions{}, nil)
+}
+
+// luaTemplate renders like the luaTemplate function with the template defaults of the definition.
+// If linting is enabled, fields missing from the data fail instead of rendering <no value>
+// and data keys never referenced are reported as warnings.
+func (a *RPackAPI) luaTemplate(L *lua.LState) int {
+	var onLint func(*templateLint)
+	if a.lintTemplates {
+		onLint = func(lint *templateLint) {
+			site := luaCallSite(L)
+			for _, key := range lint.Unused {
+				a.annotations = append(a.annotations, &Annotation{
+					Message: fmt.Sprintf("%s: template data key %q is never referenced", site, key),
+				})
+			}
+		}
 	}
-	L.Push(goToLValue(L, data))
-	return 1
+	defaults := templateOptionsFromDef(a.templateDefaults)
+	defaults.now = a.now
+	return renderLuaTemplate(L, defaults, onLint)
 }
 
-func luaToYAML(L *lua.LState) int {
-	val := L.CheckTable(1)
-	goVal := luaTableToGo(val)
-	jsonBytes, err := json.MarshalIndent(goVal, "", "  ")
+// templateOptions are the options of rpack.template.
+type templateOptions struct {
+	leftDelim  string
+	rightDelim string
+	// missingKey is one of the TemplateMissingKey values, empty for the default
+	missingKey string
+	// escape is one of the TemplateEscape values, empty for text
+	escape string
+	// now is the clock of the now function of templates, time.Now if nil
+	now func() time.Time
+}
+
+// templateOptionsFromDef returns the template defaults of a definition, def may be nil.
+func templateOptionsFromDef(def *RPackDefTemplate) *templateOptions {
+	if def == nil {
+		return &templateOptions{}
+	}
+	return &templateOptions{missingKey: def.MissingKey, escape: def.Escape}
+}
+
+// luaTemplateOptions reads the options of rpack.template following the data argument,
+// either an options table or the left and right delimiters.
+func luaTemplateOptions(L *lua.LState, defaults *templateOptions) (*templateOptions, error) {
+	opts := *defaults
+	tbl, ok := L.Get(3).(*lua.LTable)
+	if !ok {
+		opts.leftDelim = L.OptString(3, "")
+		opts.rightDelim = L.OptString(4, "")
+		return &opts, nil
+	}
+	str := func(name string, dst *string) {
+		if v, ok := tbl.RawGetString(name).(lua.LString); ok {
+			*dst = string(v)
+		}
+	}
+	str("left_delim", &opts.leftDelim)
+	str("right_delim", &opts.rightDelim)
+	str("missingkey", &opts.missingKey)
+	str("escape", &opts.escape)
+	switch opts.missingKey {
+	case "", TemplateMissingKeyDefault, TemplateMissingKeyZero, TemplateMissingKeyError:
+	default:
+		return nil, fmt.Errorf("option missingkey must be default, zero or error, got %q", opts.missingKey)
+	}
+	switch opts.escape {
+	case "", TemplateEscapeText, TemplateEscapeHTML:
+	default:
+		return nil, fmt.Errorf("option escape must be text or html, got %q", opts.escape)
+	}
+	return &opts, nil
+}
+
+// parsedTemplate is a template parsed by text/template or html/template.
+type parsedTemplate struct {
+	tree    *parse.Tree
+	execute func(w io.Writer, data any) error
+}
+
+// parse parses content with the options.
+func (o *templateOptions) parse(content string) (*parsedTemplate, error) {
+	missingKey := "missingkey=" + cmp.Or(o.missingKey, TemplateMissingKeyDefault)
+	now := o.now
+	if now == nil {
+		now = time.Now
+	}
+	funcs := map[string]any{"now": now}
+	// Delims falls back to the default delimiters for empty strings
+	if o.escape == TemplateEscapeHTML {
+		tmpl, err := htmltemplate.New("tpl").Delims(o.leftDelim, o.rightDelim).Funcs(funcs).Option(missingKey).Parse(content)
+		if err != nil {
+			return nil, err
+		}
+		return &parsedTemplate{tree: tmpl.Tree, execute: tmpl.Execute}, nil
+	}
+	tmpl, err := template.New("tpl").Delims(o.leftDelim, o.rightDelim).Funcs(funcs).Option(missingKey).Parse(content)
 	if err != nil {
-		L.ArgError(1, fmt.Errorf("failed to marshal YAML: %w", err).Error())
-		return 0
+		return nil, err
 	}
-	L.Push(lua.LString(string(jsonBytes)))
-	return 1
+	return &parsedTemplate{tree: tmpl.Tree, execute: tmpl.Execute}, nil
 }
 
-// luaTemplate treats the given string as a text/template,
-// executes it with the provided Lua data (converted to a Go value), and returns the result.
-// It supports optional start and end delimiters.
-func luaTemplate(L *lua.LState) int {
+// renderLuaTemplate implements the template function with the defaults, templates are linted if onLint is set.
+func renderLuaTemplate(L *lua.LState, defaults *templateOptions, onLint func(*templateLint)) int {
 	tplContent := L.CheckString(1)
 	dataTable := L.CheckTable(2)
-	data := luaTableToGo(dataTable)
-	// Optional delimiters as arguments 3 and 4.
-	leftDelim := L.OptString(3, "")
-	rightDelim := L.OptString(4, "")
-	tpl := template.New("tpl")
-	if leftDelim != "" && rightDelim != "" {
-		tpl = tpl.Delims(leftDelim, rightDelim)
-	}
-	tmpl, err := tpl.Parse(tplContent)
+	data, err := luaTableToGo(dataTable)
 	if err != nil {
-		L.ArgError(1, fmt.Errorf("failed to parse template: %w", err).Error())
+		L.ArgError(2, err.Error())
 		return 0
 	}
-	var buf bytes.Buffer
-	if err = tmpl.Execute(&buf, data); err != nil {
-		L.ArgError(2, fmt.Errorf("failed to execute template: %w", err).Error())
+	opts, err := luaTemplateOptions(L, defaults)
+	if err != nil {
+		L.ArgError(3, err.Error())
 		return 0
 	}
-	L.Push(lua.LString(buf.String()))
-	return 1
-}
-
-// luaJQ executes a gojq (https://github.com/itchyny/gojq) query
-// on the provided data.
-func luaJQ(L *lua.LState) int {
-	queryStr := L.CheckString(1)
-	val := L.CheckTable(2)
-	goVal := luaTableToGo(val)
-
-	query, err := gojq.Parse(queryStr)
+	if onLint != nil {
+		// Catches fields the static check cannot resolve, e.g. inside range
+		opts.missingKey = TemplateMissingKeyError
+	}
+	tmpl, err := opts.parse(tplContent)
 	if err != nil {
-		L.ArgError(1, fmt.Errorf("failed to parse query: %w", err).Error())
+		L.ArgError(1, fmt.Errorf("failed to parse template: %w", err).Error())
 		return 0
 	}
-	iter := query.Run(goVal)
-	var res []any
-	for {
-		v, ok := iter.Next()
-		if !ok {
-			break
-		}
-		if err, ok := v.(error); ok {
-			if err, ok := err.(*gojq.HaltError); ok && err.Value() == nil {
-				break
-			}
-			L.ArgError(2, fmt.Errorf("error executing query: %w", err).Error())
+	if onLint != nil {
+		lint := lintTemplate(tmpl.tree, data)
+		if err = lint.missingError(); err != nil {
+			L.ArgError(2, err.Error())
 			return 0
 		}
-		res = append(res, v)
+		onLint(lint)
 	}
-	L.Push(goToLValue(L, res))
+	var buf bytes.Buffer
+	if err = tmpl.execute(&buf, data); err != nil {
+		L.ArgError(2, fmt.Errorf("failed to execute template: %w", err).Error())
+		return 0
+	}
+	L.Push(lua.LString(buf.String()))
 	return 1
 }
@@ -1,6 +1,10 @@
 package rpack
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	lua "github.com/yuin/gopher-lua"
@@ -90,6 +94,28 @@ func TestRPackAPIWrite(t *testing.T) {
 	}
 }
 
+func TestRPackAPIAppendAndPatch(t *testing.T) {
+	fs := NewInMemoryFS()
+	api := NewRPackAPI(fs)
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("append", L.NewFunction(api.luaAppend))
+	L.SetGlobal("patch", L.NewFunction(api.luaPatch))
+	script := `
+		append("Makefile", "all:\n")
+		append("Makefile", "build:\n\tgo build\n")
+		patch("Makefile", "@@ -1,3 +1,4 @@\n all:\n build:\n-\tgo build\n+\tgo build ./...\n+\tgo vet ./...\n")
+		assert(not pcall(patch, "missing.txt", "@@ -1 +1 @@\n-a\n+b\n"))
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+	if got := string(fs.Tree["Makefile"].Content); got != "all:\nbuild:\n\tgo build ./...\n\tgo vet ./...\n" {
+		t.Errorf("Wrong content of file: %q", got)
+	}
+}
+
 func TestRPackAPIRead(t *testing.T) {
 	fs := NewInMemoryFS()
 	_ = fs.Write("target.txt", []byte("hello"))
@@ -107,6 +133,75 @@ func TestRPackAPIRead(t *testing.T) {
 	}
 }
 
+func TestRPackAPILinesIter(t *testing.T) {
+	fs := NewInMemoryFS()
+	_ = fs.Write("big.txt", []byte("\uFEFFfirst\r\nsecond\n\nlast"))
+	_ = fs.Write("empty.txt", []byte(""))
+	api := NewRPackAPI(fs)
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("fn", L.NewFunction(api.luaLinesIter))
+	script := `
+		local lines = {}
+		local last = 0
+		for line, n in fn("big.txt") do
+			table.insert(lines, line)
+			last = n
+		end
+		assert(#lines == 4)
+		assert(lines[1] == "first")
+		assert(lines[2] == "second")
+		assert(lines[3] == "")
+		assert(lines[4] == "last")
+		assert(last == 4)
+
+		for line in fn("empty.txt") do
+			error("expected no lines")
+		end
+
+		-- Stopping early leaves the reader open until the API is closed
+		local it = fn("big.txt")
+		assert(it() == "first")
+		assert(not pcall(fn, "missing.txt"))
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+	if len(api.readers) != 1 {
+		t.Errorf("Expected 1 open reader, got %d", len(api.readers))
+	}
+	api.Close()
+	if len(api.readers) != 0 {
+		t.Errorf("Expected readers to be closed, got %d", len(api.readers))
+	}
+}
+
+func TestRPackAPIWarnAndAnnotate(t *testing.T) {
+	api := NewRPackAPI(NewInMemoryFS())
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("warn", L.NewFunction(api.luaWarn))
+	L.SetGlobal("annotate", L.NewFunction(api.luaAnnotate))
+	script := `
+		warn("no owners file found")
+		annotate("./deploy/app.yaml", "replicas set manually")
+		assert(not pcall(annotate, "", "empty path"))
+		assert(not pcall(warn))
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+	expected := []*Annotation{
+		{Message: "no owners file found"},
+		{Path: "deploy/app.yaml", Message: "replicas set manually"},
+	}
+	if got := api.Annotations(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected annotations %v, got %v", expected, got)
+	}
+}
+
 func TestRPackAPIToAndFromYAML(t *testing.T) {
 	L := lua.NewState(lua.Options{SkipOpenLibs: false})
 	defer L.Close()
@@ -184,22 +279,36 @@ func TestRPackTemplateDelim(t *testing.T) {
 	}
 }
 
-func TestRPackJQ(t *testing.T) {
+func TestRPackTemplateOptions(t *testing.T) {
 	L := lua.NewState(lua.Options{SkipOpenLibs: false})
 	defer L.Close()
 	L.SetContext(t.Context())
-	L.SetGlobal("fn", L.NewFunction(luaJQ))
+	L.SetGlobal("fn", L.NewFunction(luaTemplate))
 	script := `
-		local data = {users={"alice","bob"}}
-		local query = ".users[1]"
-        local result = fn(query, data)
-		assert(result[1] == "bob")
+		assert(fn("{{.missing}}", {x=1}) == "<no value>")
+		assert(fn("{{.missing}}", {x=1}, {missingkey="zero"}) == "<no value>")
+		assert(not pcall(fn, "{{.missing}}", {x=1}, {missingkey="error"}))
+		assert(fn("<<.v>>", {v="<b>"}, {left_delim="<<", right_delim=">>"}) == "<b>")
+		assert(fn("<p>{{.v}}</p>", {v="<b>"}, {escape="html"}) == "<p>&lt;b&gt;</p>")
+		local ok, err = pcall(fn, "", {}, {escape="xml"})
+		assert(not ok and string.find(err, "option escape must be text or html"))
 	`
 	if err := L.DoString(script); err != nil {
 		t.Fatalf("Script failed: %s", err)
 	}
 }
 
+func TestRPackTemplateDefDefaults(t *testing.T) {
+	script := `local rpack = require("rpack.v1")
+assert(not pcall(rpack.template, "{{.missing}}", {x=1}))
+assert(rpack.template("{{.missing}}", {x=1}, {missingkey="default"}) == "<no value>")
+`
+	opts := LuaOptions{TemplateDefaults: &RPackDefTemplate{MissingKey: TemplateMissingKeyError}}
+	if _, err := ExecuteLuaWithOptions(t.Context(), script, NewInMemoryFS(), nil, opts); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
 func TestRPackAPICopy(t *testing.T) {
 	fs := NewInMemoryFS()
 	_ = fs.Write("source.txt", []byte("hello"))
@@ -221,3 +330,35 @@ func TestRPackAPICopy(t *testing.T) {
 		t.Errorf("Wrong content of file: %s", string(e.Content))
 	}
 }
+
+func TestRPackAPIExists(t *testing.T) {
+	defDir, execDir := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(defDir, "templates"), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join(defDir, "templates", "a.tmpl"), filepath.Join(execDir, "in.txt")} {
+		if err := os.WriteFile(name, []byte("x"), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	inputs := []*RPackResolvedInput{{Name: "in", Type: RPackInputTypeFile, ResolvedPath: filepath.Join(execDir, "in.txt"), UserPath: "in.txt"}}
+	fs := NewRPackFS(true, defDir, t.TempDir(), t.TempDir(), execDir, inputs, nil)
+	script := `
+		local rpack = require("rpack.v1")
+		assert(rpack.exists("rpack:templates/a.tmpl") and not rpack.is_dir("rpack:templates/a.tmpl"))
+		assert(rpack.exists("rpack:templates") and rpack.is_dir("rpack:templates"))
+		assert(not rpack.exists("rpack:missing.tmpl") and not rpack.is_dir("rpack:missing"))
+		local ok, err = pcall(rpack.exists, "./in.txt")
+		assert(not ok and err.kind == "denied", "target must not be checked without allow_target_read")
+		if rpack.exists("map:in") then
+			rpack.write("./in.txt", "y")
+		end
+	`
+	if err := ExecuteLuaWithData(t.Context(), script, fs, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Writing the input checked before is not idempotent
+	if err := fs.Check(); !errors.Is(err, ErrPurityViolation) {
+		t.Errorf("Expected ErrPurityViolation, got %v", err)
+	}
+}
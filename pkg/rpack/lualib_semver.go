@@ -0,0 +1,145 @@
+package rpack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// RegisterSemver registers the semver module for parsing, comparing and matching versions against ranges.
+func RegisterSemver(name string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tabmod := L.RegisterModule(name, semverFuncs)
+		L.Push(tabmod)
+		return 1
+	}
+}
+
+var semverFuncs = map[string]lua.LGFunction{
+	"parse":     luaSemverParse,
+	"valid":     luaSemverValid,
+	"compare":   luaSemverCompare,
+	"satisfies": luaSemverSatisfies,
+}
+
+// checkSemver parses the version at argument n or raises an argument error.
+// Versions are parsed tolerantly, a v prefix and missing minor or patch numbers are accepted.
+func checkSemver(L *lua.LState, n int) semver.Version {
+	v, err := semver.ParseTolerant(L.CheckString(n))
+	if err != nil {
+		L.ArgError(n, fmt.Sprintf("invalid version: %s", err))
+	}
+	return v
+}
+
+// semverRangeOperators are the characters a comparator of a range starts with.
+const semverRangeOperators = "<>=!^~"
+
+// parseSemverRange parses a range like ">=1.2.0 <2.0.0 || ^3.1". Besides the syntax of semver.ParseRange,
+// versions can be shortened or have a v prefix, ^ allows changes not modifying the left-most non-zero
+// number and ~ allows patch changes.
+func parseSemverRange(s string) (semver.Range, error) {
+	var parts []string
+	var op string
+	for _, field := range strings.Fields(s) {
+		if field == "||" {
+			parts = append(parts, field)
+			continue
+		}
+		// An operator separated from its version by spaces
+		if strings.Trim(field, semverRangeOperators) == "" {
+			op += field
+			continue
+		}
+		field, op = op+field, ""
+		expanded, err := expandSemverComparator(field)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expanded...)
+	}
+	if op != "" {
+		return nil, fmt.Errorf("operator %q without version", op)
+	}
+	return semver.ParseRange(strings.Join(parts, " "))
+}
+
+// expandSemverComparator normalizes the version of a comparator and expands ^ and ~ to the comparators of semver.ParseRange.
+// Like npm, the numbers left out of shortened versions may change: ^0 allows <1.0.0, ^0.0 <0.1.0 and ~1 <2.0.0.
+func expandSemverComparator(comparator string) ([]string, error) {
+	version := strings.TrimLeft(comparator, semverRangeOperators)
+	op := comparator[:len(comparator)-len(version)]
+	core := version
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		core = version[:i]
+	}
+	if strings.ContainsAny(core, "xX*") {
+		return []string{comparator}, nil
+	}
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version %q in %q: %w", version, comparator, err)
+	}
+	// Number of the given parts of the version, 1 for major only
+	parts := strings.Count(core, ".") + 1
+	lower := v
+	upper := semver.Version{Major: v.Major + 1}
+	switch op {
+	case "^":
+		if v.Major == 0 && (v.Minor > 0 || parts == 2) {
+			upper = semver.Version{Minor: v.Minor + 1}
+		} else if v.Major == 0 && parts > 2 {
+			upper = semver.Version{Minor: v.Minor, Patch: v.Patch + 1}
+		}
+	case "~":
+		if parts > 1 {
+			upper = semver.Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+	default:
+		return []string{op + v.String()}, nil
+	}
+	return []string{">=" + lower.String(), "<" + upper.String()}, nil
+}
+
+func luaSemverParse(L *lua.LState) int {
+	v := checkSemver(L, 1)
+	tbl := L.NewTable()
+	tbl.RawSetString("major", lua.LNumber(v.Major))
+	tbl.RawSetString("minor", lua.LNumber(v.Minor))
+	tbl.RawSetString("patch", lua.LNumber(v.Patch))
+	pre := make([]string, len(v.Pre))
+	for i, p := range v.Pre {
+		pre[i] = p.String()
+	}
+	tbl.RawSetString("prerelease", lua.LString(strings.Join(pre, ".")))
+	tbl.RawSetString("build", lua.LString(strings.Join(v.Build, ".")))
+	tbl.RawSetString("version", lua.LString(v.String()))
+	L.Push(tbl)
+	return 1
+}
+
+func luaSemverValid(L *lua.LState) int {
+	_, err := semver.ParseTolerant(L.CheckString(1))
+	L.Push(lua.LBool(err == nil))
+	return 1
+}
+
+func luaSemverCompare(L *lua.LState) int {
+	a := checkSemver(L, 1)
+	b := checkSemver(L, 2)
+	L.Push(lua.LNumber(a.Compare(b)))
+	return 1
+}
+
+func luaSemverSatisfies(L *lua.LState) int {
+	v := checkSemver(L, 1)
+	r, err := parseSemverRange(L.CheckString(2))
+	if err != nil {
+		L.ArgError(2, fmt.Sprintf("invalid range: %s", err))
+		return 0
+	}
+	L.Push(lua.LBool(r(v)))
+	return 1
+}
@@ -0,0 +1,49 @@
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestSemver(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.PreloadModule("semver", RegisterSemver("semver"))
+	script := `
+		local semver = require("semver")
+		local v = semver.parse("v1.21.3-rc.1+build.5")
+		assert(v.major == 1 and v.minor == 21 and v.patch == 3)
+		assert(v.prerelease == "rc.1" and v.build == "build.5")
+		assert(v.version == "1.21.3-rc.1+build.5")
+		assert(semver.parse("1.21").version == "1.21.0")
+		assert(semver.valid("1.2.3") and semver.valid("v2"))
+		assert(not semver.valid("latest"))
+		assert(not pcall(semver.parse, "latest"))
+
+		assert(semver.compare("1.2.3", "1.10.0") == -1)
+		assert(semver.compare("v1.2", "1.2.0") == 0)
+		assert(semver.compare("1.0.0", "1.0.0-rc.1") == 1)
+
+		assert(semver.satisfies("1.22.1", ">=1.21"))
+		assert(not semver.satisfies("1.20.9", ">= 1.21"))
+		assert(semver.satisfies("1.5.0", ">=1.0.0 <2.0.0 || >=3.0.0"))
+		assert(not semver.satisfies("2.1.0", ">=1.0.0 <2.0.0 || >=3.0.0"))
+		assert(semver.satisfies("1.9.0", "^1.2.3"))
+		assert(not semver.satisfies("2.0.0", "^1.2.3"))
+		assert(semver.satisfies("0.2.9", "^0.2.3") and not semver.satisfies("0.3.0", "^0.2.3"))
+		assert(semver.satisfies("0.0.3", "^0.0.3") and not semver.satisfies("0.0.4", "^0.0.3"))
+		assert(semver.satisfies("1.2.9", "~1.2.3") and not semver.satisfies("1.3.0", "~1.2.3"))
+		assert(semver.satisfies("0.9.9", "^0") and not semver.satisfies("1.0.0", "^0"))
+		assert(semver.satisfies("0.0.9", "^0.0") and not semver.satisfies("0.1.0", "^0.0"))
+		assert(semver.satisfies("1.9.0", "~1") and not semver.satisfies("2.0.0", "~1"))
+		assert(semver.satisfies("1.2.9", "~v1.2") and not semver.satisfies("1.3.0", "~1.2"))
+		assert(semver.satisfies("1.4.2", "1.x"))
+		assert(not pcall(semver.satisfies, "1.0.0", ">="))
+		assert(not pcall(semver.satisfies, "1.0.0", ">=latest"))
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
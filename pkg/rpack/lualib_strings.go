@@ -0,0 +1,255 @@
+package rpack
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func RegisterStrings(name string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tabmod := L.RegisterModule(name, stringsFuncs)
+		L.Push(tabmod)
+		return 1
+	}
+}
+
+var stringsFuncs = map[string]lua.LGFunction{
+	"split":       luaStringsSplit,
+	"join":        luaStringsJoin,
+	"fields":      luaStringsFields,
+	"lines":       luaStringsLines,
+	"cut":         luaStringsCut,
+	"trim":        luaStringsTrim,
+	"trim_left":   luaStringsTrimLeft,
+	"trim_right":  luaStringsTrimRight,
+	"trim_prefix": luaStringsTrimPrefix,
+	"trim_suffix": luaStringsTrimSuffix,
+	"has_prefix":  luaStringsHasPrefix,
+	"has_suffix":  luaStringsHasSuffix,
+	"contains":    luaStringsContains,
+	"index":       luaStringsIndex,
+	"count":       luaStringsCount,
+	"replace":     luaStringsReplace,
+	"upper":       luaStringsUpper,
+	"lower":       luaStringsLower,
+	"title":       luaStringsTitle,
+	"equal_fold":  luaStringsEqualFold,
+	"pad_left":    luaStringsPadLeft,
+	"pad_right":   luaStringsPadRight,
+	"len":         luaStringsLen,
+}
+
+// pushStrings pushes a list of strings as Lua table.
+func pushStrings(L *lua.LState, list []string) int {
+	tbl := L.CreateTable(len(list), 0)
+	for _, s := range list {
+		tbl.Append(lua.LString(s))
+	}
+	L.Push(tbl)
+	return 1
+}
+
+// luaStringsSplit splits around sep, at most n parts if n is given.
+func luaStringsSplit(L *lua.LState) int {
+	s := L.CheckString(1)
+	sep := L.CheckString(2)
+	n := L.OptInt(3, -1)
+	return pushStrings(L, strings.SplitN(s, sep, n))
+}
+
+func luaStringsJoin(L *lua.LState) int {
+	tbl := L.CheckTable(1)
+	sep := L.OptString(2, "")
+	parts := make([]string, 0, tbl.Len())
+	for i := 1; i <= tbl.Len(); i++ {
+		v := tbl.RawGetInt(i)
+		if v.Type() != lua.LTString && v.Type() != lua.LTNumber {
+			L.ArgError(1, fmt.Sprintf("element %d must be a string or number, got %s", i, v.Type()))
+			return 0
+		}
+		parts = append(parts, v.String())
+	}
+	L.Push(lua.LString(strings.Join(parts, sep)))
+	return 1
+}
+
+func luaStringsFields(L *lua.LState) int {
+	return pushStrings(L, strings.Fields(L.CheckString(1)))
+}
+
+// luaStringsLines splits into lines on \n and \r\n, a final line ending does not add an empty line.
+func luaStringsLines(L *lua.LState) int {
+	s := L.CheckString(1)
+	if s == "" {
+		return pushStrings(L, nil)
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return pushStrings(L, lines)
+}
+
+// luaStringsCut returns the text before and after the first sep and whether sep was found.
+func luaStringsCut(L *lua.LState) int {
+	before, after, found := strings.Cut(L.CheckString(1), L.CheckString(2))
+	L.Push(lua.LString(before))
+	L.Push(lua.LString(after))
+	L.Push(lua.LBool(found))
+	return 3
+}
+
+// luaStringsTrim removes leading and trailing characters in cutset, whitespace without cutset.
+func luaStringsTrim(L *lua.LState) int {
+	s := L.CheckString(1)
+	if L.GetTop() < 2 {
+		L.Push(lua.LString(strings.TrimSpace(s)))
+		return 1
+	}
+	L.Push(lua.LString(strings.Trim(s, L.CheckString(2))))
+	return 1
+}
+
+func luaStringsTrimLeft(L *lua.LState) int {
+	s := L.CheckString(1)
+	if L.GetTop() < 2 {
+		L.Push(lua.LString(strings.TrimLeftFunc(s, unicode.IsSpace)))
+		return 1
+	}
+	L.Push(lua.LString(strings.TrimLeft(s, L.CheckString(2))))
+	return 1
+}
+
+func luaStringsTrimRight(L *lua.LState) int {
+	s := L.CheckString(1)
+	if L.GetTop() < 2 {
+		L.Push(lua.LString(strings.TrimRightFunc(s, unicode.IsSpace)))
+		return 1
+	}
+	L.Push(lua.LString(strings.TrimRight(s, L.CheckString(2))))
+	return 1
+}
+
+func luaStringsTrimPrefix(L *lua.LState) int {
+	L.Push(lua.LString(strings.TrimPrefix(L.CheckString(1), L.CheckString(2))))
+	return 1
+}
+
+func luaStringsTrimSuffix(L *lua.LState) int {
+	L.Push(lua.LString(strings.TrimSuffix(L.CheckString(1), L.CheckString(2))))
+	return 1
+}
+
+func luaStringsHasPrefix(L *lua.LState) int {
+	L.Push(lua.LBool(strings.HasPrefix(L.CheckString(1), L.CheckString(2))))
+	return 1
+}
+
+func luaStringsHasSuffix(L *lua.LState) int {
+	L.Push(lua.LBool(strings.HasSuffix(L.CheckString(1), L.CheckString(2))))
+	return 1
+}
+
+func luaStringsContains(L *lua.LState) int {
+	L.Push(lua.LBool(strings.Contains(L.CheckString(1), L.CheckString(2))))
+	return 1
+}
+
+// luaStringsIndex returns the 1-based byte position of the first substr like string.find, or nil.
+func luaStringsIndex(L *lua.LState) int {
+	i := strings.Index(L.CheckString(1), L.CheckString(2))
+	if i < 0 {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(lua.LNumber(i + 1))
+	return 1
+}
+
+func luaStringsCount(L *lua.LState) int {
+	L.Push(lua.LNumber(strings.Count(L.CheckString(1), L.CheckString(2))))
+	return 1
+}
+
+// luaStringsReplace replaces old with new, the first n occurrences if n is given.
+func luaStringsReplace(L *lua.LState) int {
+	s := L.CheckString(1)
+	oldStr := L.CheckString(2)
+	newStr := L.CheckString(3)
+	n := L.OptInt(4, -1)
+	L.Push(lua.LString(strings.Replace(s, oldStr, newStr, n)))
+	return 1
+}
+
+func luaStringsUpper(L *lua.LState) int {
+	L.Push(lua.LString(strings.ToUpper(L.CheckString(1))))
+	return 1
+}
+
+func luaStringsLower(L *lua.LState) int {
+	L.Push(lua.LString(strings.ToLower(L.CheckString(1))))
+	return 1
+}
+
+// luaStringsTitle upper cases the first letter of each word, words are separated by whitespace,
+// '-' and '_'. The other letters are kept as they are.
+func luaStringsTitle(L *lua.LState) int {
+	s := L.CheckString(1)
+	var sb strings.Builder
+	sb.Grow(len(s))
+	start := true
+	for _, r := range s {
+		if start {
+			sb.WriteRune(unicode.ToTitle(r))
+		} else {
+			sb.WriteRune(r)
+		}
+		start = unicode.IsSpace(r) || r == '-' || r == '_'
+	}
+	L.Push(lua.LString(sb.String()))
+	return 1
+}
+
+func luaStringsEqualFold(L *lua.LState) int {
+	L.Push(lua.LBool(strings.EqualFold(L.CheckString(1), L.CheckString(2))))
+	return 1
+}
+
+// checkPad returns the padding to reach width characters, using the single character at argument 3.
+func checkPad(L *lua.LState, s string) string {
+	width := L.CheckInt(2)
+	pad := L.OptString(3, " ")
+	if utf8.RuneCountInString(pad) != 1 {
+		L.ArgError(3, "pad must be a single character")
+		return ""
+	}
+	n := width - utf8.RuneCountInString(s)
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat(pad, n)
+}
+
+// luaStringsPadLeft pads s on the left to width characters, with spaces by default.
+func luaStringsPadLeft(L *lua.LState) int {
+	s := L.CheckString(1)
+	L.Push(lua.LString(checkPad(L, s) + s))
+	return 1
+}
+
+// luaStringsPadRight pads s on the right to width characters, with spaces by default.
+func luaStringsPadRight(L *lua.LState) int {
+	s := L.CheckString(1)
+	L.Push(lua.LString(s + checkPad(L, s)))
+	return 1
+}
+
+// luaStringsLen returns the number of characters, unlike # which counts bytes.
+func luaStringsLen(L *lua.LState) int {
+	L.Push(lua.LNumber(utf8.RuneCountInString(L.CheckString(1))))
+	return 1
+}
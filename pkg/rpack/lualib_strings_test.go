@@ -0,0 +1,84 @@
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func runStringsScript(t *testing.T, script string) {
+	t.Helper()
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.PreloadModule("strings", RegisterStrings("strings"))
+	if err := L.DoString(`local strings = require("strings")` + "\n" + script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestStringsSplitJoin(t *testing.T) {
+	runStringsScript(t, `
+		local parts = strings.split("a,b,,c", ",")
+		assert(#parts == 4 and parts[3] == "" and parts[4] == "c")
+		assert(#strings.split("a,b,c", ",", 2) == 2)
+		assert(strings.join({"a", 1, "b"}, "-") == "a-1-b")
+		assert(strings.join({}) == "")
+		assert(not pcall(strings.join, {"a", {}}))
+		local f = strings.fields("  a \t b\nc  ")
+		assert(#f == 3 and f[1] == "a" and f[3] == "c")
+		local l = strings.lines("a\r\nb\n\nc\n")
+		assert(#l == 4 and l[1] == "a" and l[3] == "" and l[4] == "c")
+		assert(#strings.lines("") == 0)
+		local before, after, found = strings.cut("key=value=x", "=")
+		assert(before == "key" and after == "value=x" and found)
+		before, after, found = strings.cut("key", "=")
+		assert(before == "key" and after == "" and not found)
+	`)
+}
+
+func TestStringsTrim(t *testing.T) {
+	runStringsScript(t, `
+		assert(strings.trim("  a b \n") == "a b")
+		assert(strings.trim("--a--", "-") == "a")
+		assert(strings.trim_left("  a  ") == "a  ")
+		assert(strings.trim_right("  a  ") == "  a")
+		assert(strings.trim_left("xxa", "x") == "a")
+		assert(strings.trim_prefix("v1.2.3", "v") == "1.2.3")
+		assert(strings.trim_suffix("file.tar.gz", ".gz") == "file.tar")
+	`)
+}
+
+func TestStringsSearchReplace(t *testing.T) {
+	runStringsScript(t, `
+		assert(strings.has_prefix("rpack.yaml", "rpack"))
+		assert(strings.has_suffix("rpack.yaml", ".yaml"))
+		assert(strings.contains("a.b", "."))
+		assert(strings.index("hello", "l") == 3)
+		assert(strings.index("hello", "x") == nil)
+		assert(strings.count("cheese", "e") == 3)
+		assert(strings.replace("a.b.c", ".", "/") == "a/b/c")
+		assert(strings.replace("a.b.c", ".", "/", 1) == "a/b.c")
+		assert(strings.equal_fold("Go", "GO"))
+	`)
+}
+
+func TestStringsCase(t *testing.T) {
+	runStringsScript(t, `
+		assert(strings.upper("äb") == "ÄB")
+		assert(strings.lower("ÄB") == "äb")
+		assert(strings.title("hello wide-world_x") == "Hello Wide-World_X")
+		assert(strings.title("iPhone") == "IPhone")
+	`)
+}
+
+func TestStringsPad(t *testing.T) {
+	runStringsScript(t, `
+		assert(strings.pad_left("7", 3, "0") == "007")
+		assert(strings.pad_right("ab", 4) == "ab  ")
+		assert(strings.pad_left("äb", 3) == " äb")
+		assert(strings.pad_left("long", 2) == "long")
+		assert(not pcall(strings.pad_left, "a", 3, "ab"))
+		assert(strings.len("äb") == 2)
+	`)
+}
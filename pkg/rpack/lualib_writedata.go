@@ -0,0 +1,133 @@
+package rpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// jsonOptionsFromTable reads the options of JSON documents, an indent of 0 writes compact JSON.
+func jsonOptionsFromTable(tbl *lua.LTable) (*encodeOptions, error) {
+	return encodeOptionsFromTable(tbl, &encodeOptions{Indent: 2, SortKeys: true, TrailingNewline: true}, 0)
+}
+
+// luaWriteJSON writes a Lua table as JSON document to a file.
+// Accepts an optional options table (indent, sort_keys, trailing_newline).
+func (a *RPackAPI) luaWriteJSON(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	val := L.CheckTable(2)
+	opts, err := jsonOptionsFromTable(L.OptTable(3, nil))
+	if err != nil {
+		L.ArgError(3, err.Error())
+		return 0
+	}
+	goVal, err := luaTableToGo(val)
+	if err != nil {
+		L.ArgError(2, err.Error())
+		return 0
+	}
+	b, err := writeJSON(goVal, val, opts)
+	if err != nil {
+		L.ArgError(2, fmt.Errorf("failed to marshal JSON: %w", err).Error())
+		return 0
+	}
+	return a.writeFile(L, friendly, b)
+}
+
+// luaWriteYAML writes a Lua table as YAML document to a file.
+// Accepts an optional options table (indent, sort_keys, trailing_newline).
+func (a *RPackAPI) luaWriteYAML(L *lua.LState) int {
+	friendly := L.CheckString(1)
+	b, ok := encodeLuaYAML(L, 2, 3)
+	if !ok {
+		return 0
+	}
+	return a.writeFile(L, friendly, b)
+}
+
+// writeFile writes content to a file and records the write like rpack.write does.
+func (a *RPackAPI) writeFile(L *lua.LState, friendly string, content []byte) int {
+	if err := a.fs.Write(friendly, content); err != nil {
+		raiseFileError(L, "write", friendly, err)
+		return 0
+	}
+	a.writes.record(L, friendly, content)
+	return 0
+}
+
+// writeJSON encodes data, the conversion of the Lua value lv, as JSON document.
+// lv provides the order of keys the table was built with if keys are not sorted.
+func writeJSON(data any, lv lua.LValue, opts *encodeOptions) ([]byte, error) {
+	var compact bytes.Buffer
+	if err := writeJSONValue(&compact, data, lv, opts.SortKeys); err != nil {
+		return nil, err
+	}
+	out := compact
+	if opts.Indent > 0 {
+		out = bytes.Buffer{}
+		if err := json.Indent(&out, compact.Bytes(), "", strings.Repeat(" ", opts.Indent)); err != nil {
+			return nil, err
+		}
+	}
+	if opts.TrailingNewline {
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// writeJSONValue writes data, the conversion of the Lua value lv, as compact JSON to buf, see writeJSON.
+func writeJSONValue(buf *bytes.Buffer, data any, lv lua.LValue, sortKeys bool) error {
+	tbl, _ := lv.(*lua.LTable)
+	switch v := data.(type) {
+	case []any:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONValue(buf, item, tbl.RawGetInt(i+1), sortKeys); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]any:
+		// The keys as set in the table, converted like luaTableToGo does
+		var keys []string
+		lvalues := make(map[string]lua.LValue, len(v))
+		for _, key := range luaTableKeys(tbl) {
+			name := key.String()
+			keys = append(keys, name)
+			lvalues[name] = tbl.RawGet(key)
+		}
+		if sortKeys {
+			slices.Sort(keys)
+		}
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			b, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			buf.Write(b)
+			buf.WriteByte(':')
+			if err = writeJSONValue(buf, v[key], lvalues[key], sortKeys); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRPackAPIWriteData(t *testing.T) {
+	script := `
+		local rpack = require("rpack.v1")
+		local t = {}
+		t.name = "app"
+		t.ports = {80, 443}
+		t.labels = {tier = "web", app = "<shop>"}
+		rpack.write_json("./sorted.json", t)
+		rpack.write_json("./ordered.json", t, {sort_keys = false, indent = 4, trailing_newline = false})
+		rpack.write_json("./compact.json", t, {indent = 0})
+		rpack.write_yaml("./app.yaml", t)
+		rpack.write_yaml("./ordered.yaml", t, {sort_keys = false, trailing_newline = false})
+		-- Writing the same document again is no conflicting write
+		rpack.write("./sorted.json", rpack.to_json(t) .. "\n")
+		rpack.write("./app.yaml", rpack.to_yaml(t))
+		rpack.write_json("./conflict.json", {a = 1})
+		rpack.write_yaml("./conflict.json", {a = 1})
+	`
+	defDir, runDir, tempDir, execDir := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	fs := NewRPackFS(true, defDir, runDir, tempDir, execDir, nil, nil)
+	res, err := ExecuteLuaWithOptions(t.Context(), script, fs, nil, LuaOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"sorted.json":  "{\n  \"labels\": {\n    \"app\": \"\\u003cshop\\u003e\",\n    \"tier\": \"web\"\n  },\n  \"name\": \"app\",\n  \"ports\": [\n    80,\n    443\n  ]\n}\n",
+		"compact.json": "{\"labels\":{\"app\":\"\\u003cshop\\u003e\",\"tier\":\"web\"},\"name\":\"app\",\"ports\":[80,443]}\n",
+		"app.yaml":     "labels:\n  app: <shop>\n  tier: web\nname: app\nports:\n  - 80\n  - 443\n",
+		"ordered.yaml": "name: app\nports:\n  - 80\n  - 443\nlabels:\n  tier: web\n  app: <shop>",
+	}
+	for name, content := range want {
+		if b, err := os.ReadFile(filepath.Join(runDir, name)); err != nil || string(b) != content { //nolint:gosec // test file
+			t.Errorf("Unexpected %s: %q, %v\nwant: %q", name, b, err, content)
+		}
+	}
+	// Keys of nested tables keep their order too
+	b, err := os.ReadFile(filepath.Join(runDir, "ordered.json")) //nolint:gosec // test file
+	if err != nil || string(b) != "{\n    \"name\": \"app\",\n    \"ports\": [\n        80,\n        443\n    ],\n    \"labels\": {\n        \"tier\": \"web\",\n        \"app\": \"\\u003cshop\\u003e\"\n    }\n}" {
+		t.Errorf("Unexpected ordered.json: %q, %v", b, err)
+	}
+	if len(res.MultiWrites) != 1 || res.MultiWrites[0].Path != "conflict.json" {
+		t.Errorf("Expected only conflict.json written with different content, got %+v", res.MultiWrites)
+	}
+}
@@ -0,0 +1,364 @@
+package rpack
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// xmlOptions controls the mapping between XML documents and tables.
+// Elements are represented as tables keyed by child element name,
+// attributes are stored with AttrPrefix prepended and character data
+// of mixed elements is stored under TextKey.
+type xmlOptions struct {
+	AttrPrefix string
+	TextKey    string
+	Indent     string
+	Header     bool
+}
+
+func defaultXMLOptions() *xmlOptions {
+	return &xmlOptions{
+		AttrPrefix: "@",
+		TextKey:    "#text",
+		Indent:     "  ",
+		Header:     true,
+	}
+}
+
+// xmlOptionsFromTable reads optional settings from a Lua options table.
+// A numeric indent must be a non-negative integer.
+func xmlOptionsFromTable(tbl *lua.LTable) (*xmlOptions, error) {
+	opts := defaultXMLOptions()
+	if tbl == nil {
+		return opts, nil
+	}
+	if v, ok := tbl.RawGetString("attr_prefix").(lua.LString); ok {
+		opts.AttrPrefix = string(v)
+	}
+	if v, ok := tbl.RawGetString("text_key").(lua.LString); ok {
+		opts.TextKey = string(v)
+	}
+	switch v := tbl.RawGetString("indent").(type) {
+	case lua.LString:
+		opts.Indent = string(v)
+	case lua.LNumber:
+		if v < 0 || float64(v) != math.Trunc(float64(v)) {
+			return nil, fmt.Errorf("option indent must be a string or a non-negative integer, got %v", v)
+		}
+		opts.Indent = strings.Repeat(" ", int(v))
+	}
+	if v, ok := tbl.RawGetString("header").(lua.LBool); ok {
+		opts.Header = bool(v)
+	}
+	return opts, nil
+}
+
+// xmlNode is an intermediate representation of a parsed XML element.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// xmlName returns the raw, prefixed name of an element or attribute.
+func xmlName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+// parseXML parses a document into a map keyed by the root element name.
+func parseXML(b []byte, opts *xmlOptions) (map[string]any, error) {
+	// RawToken keeps namespace prefixes as written, so documents round-trip.
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: xmlName(t.Name), attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root != nil {
+				return nil, fmt.Errorf("multiple root elements")
+			} else {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1].name != xmlName(t.Name) {
+				return nil, fmt.Errorf("unexpected end element %s", xmlName(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no root element found")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("element %s not closed", stack[len(stack)-1].name)
+	}
+	return map[string]any{root.name: xmlNodeToGo(root, opts)}, nil
+}
+
+// xmlNodeToGo converts an element into a string for simple elements or a map otherwise.
+// Repeated child elements are collected into a list.
+func xmlNodeToGo(n *xmlNode, opts *xmlOptions) any {
+	text := strings.TrimSpace(n.text.String())
+	if len(n.attrs) == 0 && len(n.children) == 0 {
+		return text
+	}
+	m := make(map[string]any)
+	for _, attr := range n.attrs {
+		m[opts.AttrPrefix+xmlName(attr.Name)] = attr.Value
+	}
+	for _, child := range n.children {
+		val := xmlNodeToGo(child, opts)
+		switch existing := m[child.name].(type) {
+		case nil:
+			m[child.name] = val
+		case []any:
+			m[child.name] = append(existing, val)
+		default:
+			m[child.name] = []any{existing, val}
+		}
+	}
+	if text != "" {
+		m[opts.TextKey] = text
+	}
+	return m
+}
+
+// xmlScalar formats a scalar Go value as XML character data.
+func xmlScalar(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// xmlNameStartRanges are the characters a name starts with, see NameStartChar of XML 1.0.
+var xmlNameStartRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: ':', Hi: ':', Stride: 1},
+		{Lo: 'A', Hi: 'Z', Stride: 1},
+		{Lo: '_', Hi: '_', Stride: 1},
+		{Lo: 'a', Hi: 'z', Stride: 1},
+		{Lo: 0xC0, Hi: 0xD6, Stride: 1},
+		{Lo: 0xD8, Hi: 0xF6, Stride: 1},
+		{Lo: 0xF8, Hi: 0x2FF, Stride: 1},
+		{Lo: 0x370, Hi: 0x37D, Stride: 1},
+		{Lo: 0x37F, Hi: 0x1FFF, Stride: 1},
+		{Lo: 0x200C, Hi: 0x200D, Stride: 1},
+		{Lo: 0x2070, Hi: 0x218F, Stride: 1},
+		{Lo: 0x2C00, Hi: 0x2FEF, Stride: 1},
+		{Lo: 0x3001, Hi: 0xD7FF, Stride: 1},
+		{Lo: 0xF900, Hi: 0xFDCF, Stride: 1},
+		{Lo: 0xFDF0, Hi: 0xFFFD, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x10000, Hi: 0xEFFFF, Stride: 1},
+	},
+}
+
+// xmlNameRanges are the characters following the first one of a name, see NameChar of XML 1.0.
+var xmlNameRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: '-', Hi: '.', Stride: 1},
+		{Lo: '0', Hi: '9', Stride: 1},
+		{Lo: 0xB7, Hi: 0xB7, Stride: 1},
+		{Lo: 0x300, Hi: 0x36F, Stride: 1},
+		{Lo: 0x203F, Hi: 0x2040, Stride: 1},
+	},
+}
+
+// validXMLName fails if name is not an XML name, so invalid keys do not produce malformed documents.
+func validXMLName(kind, name string) error {
+	for i, r := range name {
+		if unicode.Is(xmlNameStartRanges, r) || i > 0 && unicode.Is(xmlNameRanges, r) {
+			continue
+		}
+		return fmt.Errorf("invalid %s name %q", kind, name)
+	}
+	if name == "" {
+		return fmt.Errorf("empty %s name", kind)
+	}
+	return nil
+}
+
+// writeXML encodes a map with a single root key as XML document.
+func writeXML(data any, opts *xmlOptions) ([]byte, error) {
+	m, ok := data.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, fmt.Errorf("expected table with exactly one root element")
+	}
+	var buf bytes.Buffer
+	if opts.Header {
+		buf.WriteString(xml.Header)
+	}
+	for name, val := range m {
+		if _, isList := val.([]any); isList {
+			return nil, fmt.Errorf("root element %s can not be a list", name)
+		}
+		if err := writeXMLElement(&buf, name, val, opts, 0); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeXMLElement writes a single element, attributes and children are written
+// in sorted key order so the output is stable.
+//
+//nolint:gocognit // intentional: recursive encoder
+func writeXMLElement(buf *bytes.Buffer, name string, val any, opts *xmlOptions, depth int) error {
+	// Lists expand to repeated elements of the same name
+	if list, ok := val.([]any); ok {
+		for _, item := range list {
+			if err := writeXMLElement(buf, name, item, opts, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := validXMLName("element", name); err != nil {
+		return err
+	}
+	indent := strings.Repeat(opts.Indent, depth)
+	buf.WriteString(indent + "<" + name)
+
+	m, isMap := val.(map[string]any)
+	if !isMap {
+		text := xmlScalar(val)
+		if text == "" {
+			buf.WriteString("/>\n")
+			return nil
+		}
+		buf.WriteString(">")
+		if err := xml.EscapeText(buf, []byte(text)); err != nil {
+			return err
+		}
+		buf.WriteString("</" + name + ">\n")
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var children []string
+	text := ""
+	for _, k := range keys {
+		switch {
+		case opts.AttrPrefix != "" && strings.HasPrefix(k, opts.AttrPrefix):
+			attr := strings.TrimPrefix(k, opts.AttrPrefix)
+			if err := validXMLName("attribute", attr); err != nil {
+				return err
+			}
+			buf.WriteString(" " + attr + `="`)
+			if err := xml.EscapeText(buf, []byte(xmlScalar(m[k]))); err != nil {
+				return err
+			}
+			buf.WriteString(`"`)
+		case k == opts.TextKey:
+			text = xmlScalar(m[k])
+		default:
+			children = append(children, k)
+		}
+	}
+
+	if len(children) == 0 && text == "" {
+		buf.WriteString("/>\n")
+		return nil
+	}
+	buf.WriteString(">")
+	if text != "" {
+		if err := xml.EscapeText(buf, []byte(text)); err != nil {
+			return err
+		}
+	}
+	if len(children) > 0 {
+		buf.WriteString("\n")
+		for _, k := range children {
+			if err := writeXMLElement(buf, k, m[k], opts, depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(indent)
+	}
+	buf.WriteString("</" + name + ">\n")
+	return nil
+}
+
+// luaFromXML parses an XML string into a table.
+// Accepts an optional options table (attr_prefix, text_key).
+func luaFromXML(L *lua.LState) int {
+	input := L.CheckString(1)
+	opts, err := xmlOptionsFromTable(L.OptTable(2, nil))
+	if err != nil {
+		L.ArgError(2, err.Error())
+		return 0
+	}
+	data, err := parseXML([]byte(input), opts)
+	if err != nil {
+		L.ArgError(1, fmt.Errorf("failed to unmarshal XML: %w", err).Error())
+		return 0
+	}
+	L.Push(goToLValue(L, data))
+	return 1
+}
+
+// luaToXML serializes a table with a single root key into an XML string.
+// Accepts an optional options table (attr_prefix, text_key, indent, header).
+func luaToXML(L *lua.LState) int {
+	val := L.CheckTable(1)
+	opts, err := xmlOptionsFromTable(L.OptTable(2, nil))
+	if err != nil {
+		L.ArgError(2, err.Error())
+		return 0
+	}
+	data, err := luaTableToGo(val)
+	if err != nil {
+		L.ArgError(1, err.Error())
+		return 0
+	}
+	b, err := writeXML(data, opts)
+	if err != nil {
+		L.ArgError(1, fmt.Errorf("failed to marshal XML: %w", err).Error())
+		return 0
+	}
+	L.Push(lua.LString(string(b)))
+	return 1
+}
@@ -0,0 +1,144 @@
+package rpack
+
+import (
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestRPackAPIFromXML(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("from_xml", L.NewFunction(luaFromXML))
+	script := `
+		local t = from_xml([[<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <modelVersion>4.0.0</modelVersion>
+  <dependencies>
+    <dependency><artifactId>a</artifactId></dependency>
+    <dependency><artifactId>b</artifactId></dependency>
+  </dependencies>
+  <name lang="en">My &amp; Project</name>
+  <empty/>
+</project>]])
+		local p = t.project
+		assert(p["@xmlns"] == "http://maven.apache.org/POM/4.0.0")
+		assert(p["@xmlns:xsi"] == "http://www.w3.org/2001/XMLSchema-instance")
+		assert(p.modelVersion == "4.0.0")
+		assert(#p.dependencies.dependency == 2)
+		assert(p.dependencies.dependency[2].artifactId == "b")
+		assert(p.name["@lang"] == "en")
+		assert(p.name["#text"] == "My & Project")
+		assert(p.empty == "")
+
+		local c = from_xml([[<a id="1">text</a>]], {attr_prefix = "-", text_key = "_"})
+		assert(c.a["-id"] == "1")
+		assert(c.a["_"] == "text")
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestRPackAPIFromXMLInvalid(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("from_xml", L.NewFunction(luaFromXML))
+	for _, doc := range []string{"", "<a>", "<a></b>", "<a/><b/>"} {
+		L.SetGlobal("doc", lua.LString(doc))
+		if err := L.DoString(`from_xml(doc)`); err == nil {
+			t.Errorf("Expected error for document %q", doc)
+		}
+	}
+}
+
+func TestRPackAPIToXML(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("to_xml", L.NewFunction(luaToXML))
+	L.SetGlobal("from_xml", L.NewFunction(luaFromXML))
+	script := `
+		local t = {
+			project = {
+				["@xmlns"] = "http://maven.apache.org/POM/4.0.0",
+				modelVersion = "4.0.0",
+				dependencies = {
+					dependency = {
+						{ artifactId = "a" },
+						{ artifactId = "b", scope = "test" },
+					},
+				},
+				name = { ["@lang"] = "en", ["#text"] = "My & Project" },
+				empty = "",
+			},
+		}
+		local str = to_xml(t)
+		local expected = [[<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <dependencies>
+    <dependency>
+      <artifactId>a</artifactId>
+    </dependency>
+    <dependency>
+      <artifactId>b</artifactId>
+      <scope>test</scope>
+    </dependency>
+  </dependencies>
+  <empty/>
+  <modelVersion>4.0.0</modelVersion>
+  <name lang="en">My &amp; Project</name>
+</project>
+]]
+		assert(str == expected, str)
+
+		local roundtrip = from_xml(str)
+		assert(roundtrip.project.dependencies.dependency[2].scope == "test")
+
+		local noHeader = to_xml({ a = { b = "c" } }, { header = false, indent = 4 })
+		assert(noHeader == "<a>\n    <b>c</b>\n</a>\n", noHeader)
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
+
+func TestRPackAPIToXMLInvalid(t *testing.T) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: false})
+	defer L.Close()
+	L.SetContext(t.Context())
+	L.SetGlobal("to_xml", L.NewFunction(luaToXML))
+	for _, script := range []string{
+		`to_xml({ a = "1", b = "2" })`,
+		`to_xml({ a = { "1", "2" } })`,
+	} {
+		if err := L.DoString(script); err == nil {
+			t.Errorf("Expected error for %s", script)
+		}
+	}
+	for _, script := range []string{
+		`to_xml({ a = "1" }, { indent = -1 })`,
+		`to_xml({ a = "1" }, { indent = 1.5 })`,
+	} {
+		if err := L.DoString(script); err == nil || !strings.Contains(err.Error(), "option indent must be") {
+			t.Errorf("Expected indent error for %s, got %v", script, err)
+		}
+	}
+	for script, want := range map[string]string{
+		`to_xml({ a = { ["b c"] = "x" } })`:      `invalid element name "b c"`,
+		`to_xml({ ["1a"] = "x" })`:               `invalid element name "1a"`,
+		`to_xml({ a = { ["@"] = "x" } })`:        `empty attribute name`,
+		`to_xml({ a = { ["@x y"] = "x" } })`:     `invalid attribute name "x y"`,
+		`to_xml({ a = { ["ns:b-1.c"] = "x" } })`: ``,
+	} {
+		err := L.DoString(script)
+		if want == "" && err != nil {
+			t.Errorf("Expected valid names for %s, got %v", script, err)
+		} else if want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("Expected %q for %s, got %v", want, script, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package rpack
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	lua "github.com/yuin/gopher-lua"
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// encodeOptions configure to_yaml, write_json and write_yaml.
+type encodeOptions struct {
+	// Indent is the number of spaces per nesting level
+	Indent int
+	// SortKeys writes the keys of objects in sorted order instead of the order they were set in the table
+	SortKeys bool
+	// TrailingNewline ends the document with a newline
+	TrailingNewline bool
+}
+
+// encodeOptionsFromTable reads optional settings from a Lua options table into the defaults opts.
+// indent must be between minIndent and 9.
+func encodeOptionsFromTable(tbl *lua.LTable, opts *encodeOptions, minIndent int) (*encodeOptions, error) {
+	if tbl == nil {
+		return opts, nil
+	}
+	if v, ok := tbl.RawGetString("indent").(lua.LNumber); ok {
+		opts.Indent = int(v)
+		if opts.Indent < minIndent || opts.Indent > 9 {
+			return nil, fmt.Errorf("option indent must be between %d and 9, got %d", minIndent, opts.Indent)
+		}
+	}
+	if v, ok := tbl.RawGetString("sort_keys").(lua.LBool); ok {
+		opts.SortKeys = bool(v)
+	}
+	if v, ok := tbl.RawGetString("trailing_newline").(lua.LBool); ok {
+		opts.TrailingNewline = bool(v)
+	}
+	return opts, nil
+}
+
+// yamlOptionsFromTable reads the options of YAML documents, the encoder supports an indent of 2 to 9.
+func yamlOptionsFromTable(tbl *lua.LTable) (*encodeOptions, error) {
+	return encodeOptionsFromTable(tbl, &encodeOptions{Indent: 2, SortKeys: true, TrailingNewline: true}, 2)
+}
+
+func luaFromYAML(L *lua.LState) int {
+	input := L.CheckString(1)
+	var data any
+	if err := yaml.Unmarshal([]byte(input), &data); err != nil {
+		L.ArgError(1, fmt.Errorf("failed to unmarshal YAML: %w", err).Error())
+		return 0
+	}
+	L.Push(goToLValue(L, data))
+	return 1
+}
+
+// luaToYAML serializes a Lua table as YAML document.
+// Accepts an optional options table (indent, sort_keys, trailing_newline).
+func luaToYAML(L *lua.LState) int {
+	b, ok := encodeLuaYAML(L, 1, 2)
+	if !ok {
+		return 0
+	}
+	L.Push(lua.LString(string(b)))
+	return 1
+}
+
+// encodeLuaYAML encodes the table argument at tblArg with the options argument at optsArg as YAML document.
+// It raises an argument error and returns false on failure.
+func encodeLuaYAML(L *lua.LState, tblArg, optsArg int) ([]byte, bool) {
+	val := L.CheckTable(tblArg)
+	opts, err := yamlOptionsFromTable(L.OptTable(optsArg, nil))
+	if err != nil {
+		L.ArgError(optsArg, err.Error())
+		return nil, false
+	}
+	goVal, err := luaTableToGo(val)
+	if err != nil {
+		L.ArgError(tblArg, err.Error())
+		return nil, false
+	}
+	b, err := writeYAML(goVal, val, opts)
+	if err != nil {
+		L.ArgError(tblArg, fmt.Errorf("failed to marshal YAML: %w", err).Error())
+		return nil, false
+	}
+	return b, true
+}
+
+// writeYAML encodes data, the conversion of the Lua value lv, as YAML document.
+// lv provides the order of keys the table was built with if keys are not sorted.
+func writeYAML(data any, lv lua.LValue, opts *encodeOptions) ([]byte, error) {
+	node, err := yamlNode(data, lv, opts.SortKeys)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(opts.Indent)
+	if err = enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err = enc.Close(); err != nil {
+		return nil, err
+	}
+	if !opts.TrailingNewline {
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlNode builds the YAML node of data, the conversion of the Lua value lv, see writeYAML.
+func yamlNode(data any, lv lua.LValue, sortKeys bool) (*yamlv3.Node, error) {
+	tbl, _ := lv.(*lua.LTable)
+	switch v := data.(type) {
+	case []any:
+		node := &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+		for i, item := range v {
+			child, err := yamlNode(item, tbl.RawGetInt(i+1), sortKeys)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case map[string]any:
+		node := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+		// The keys as set in the table, converted like luaTableToGo does
+		var keys []string
+		lvalues := make(map[string]lua.LValue, len(v))
+		for _, key := range luaTableKeys(tbl) {
+			name := key.String()
+			keys = append(keys, name)
+			lvalues[name] = tbl.RawGet(key)
+		}
+		if sortKeys {
+			slices.Sort(keys)
+		}
+		for _, key := range keys {
+			child, err := yamlNode(v[key], lvalues[key], sortKeys)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}, child)
+		}
+		return node, nil
+	default:
+		node := &yamlv3.Node{}
+		if err := node.Encode(v); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+}
@@ -0,0 +1,98 @@
+package rpack
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestRPackAPIToYAML(t *testing.T) {
+	tcs := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{
+			name: "sorted",
+			script: `return to_yaml({
+				name = "app", replicas = 3, ratio = 0.5, enabled = true,
+				version = "1.0", id = "007", flag = "yes", empty = {},
+				ports = {80, 443}, labels = {tier = "web", app = "shop"},
+				script = "echo a\necho b\n",
+			})`,
+			want: `empty: {}
+enabled: true
+flag: "yes"
+id: "007"
+labels:
+  app: shop
+  tier: web
+name: app
+ports:
+  - 80
+  - 443
+ratio: 0.5
+replicas: 3
+script: |
+  echo a
+  echo b
+version: "1.0"
+`,
+		},
+		{
+			name: "insertion order and indent",
+			script: `local t = {}
+				t.name = "app"
+				t.spec = {}
+				t.spec.image = "nginx"
+				t.spec.args = {"-g", "daemon off;"}
+				t.kind = "Pod"
+				return to_yaml(t, {sort_keys = false, indent = 4})`,
+			want: `name: app
+spec:
+    image: nginx
+    args:
+        - -g
+        - daemon off;
+kind: Pod
+`,
+		},
+		{
+			name:   "list of objects",
+			script: `return to_yaml({{name = "a", port = 1}, {name = "b"}})`,
+			want: `- name: a
+  port: 1
+- name: b
+`,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			L := lua.NewState()
+			defer L.Close()
+			L.SetGlobal("to_yaml", L.NewFunction(luaToYAML))
+			if err := L.DoString(tc.script); err != nil {
+				t.Fatal(err)
+			}
+			if got := L.CheckString(-1); got != tc.want {
+				t.Errorf("Unexpected YAML:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRPackAPIToYAMLRoundTrip(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	L.SetGlobal("to_yaml", L.NewFunction(luaToYAML))
+	L.SetGlobal("from_yaml", L.NewFunction(luaFromYAML))
+	script := `
+		local doc = "a:\n  b:\n    - 1\n    - x: \"true\"\nc: 1.5\n"
+		assert(to_yaml(from_yaml(doc)) == doc, to_yaml(from_yaml(doc)))
+		assert(not pcall(to_yaml, {}, {indent = 1}), "indent below 2 must fail")
+		assert(not pcall(to_yaml, {f = print}), "functions must fail")
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+}
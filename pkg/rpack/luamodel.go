@@ -1,10 +1,16 @@
 package rpack
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
-	"strconv"
+	"math"
+	"math/big"
+	"os"
+	"slices"
 	"strings"
 
 	"log/slog"
@@ -24,7 +30,11 @@ type Resolver interface {
 type LuaModel struct {
 	L         *lua.LState
 	fs        FS
+	api       *RPackAPI
+	env       *LuaEnv
 	extValues map[string]any // External values to expose (keys come from developer)
+	// Logger receives the output of print, slog.Default() if nil
+	Logger *slog.Logger
 }
 
 // NewLuaModel creates a new LuaModel instance with a new Lua state,
@@ -33,7 +43,11 @@ type LuaModel struct {
 //
 // TODO: Provide an error function to lua code
 func NewLuaModel(ctx context.Context, fs FS, initialData map[string]any) (*LuaModel, error) {
-	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs: true,
+		// Keep the Go stack of panics in API functions for crash reports
+		IncludeGoStackTrace: true,
+	})
 	L.SetContext(ctx)
 	if err := openLibs(L); err != nil {
 		L.Close()
@@ -47,14 +61,27 @@ func NewLuaModel(ctx context.Context, fs FS, initialData map[string]any) (*LuaMo
 	lm := &LuaModel{
 		L:         L,
 		fs:        fs,
+		env:       &LuaEnv{},
 		extValues: initialData,
 	}
-	lm.preloadRpackModule()
+	// The env module exposes nothing but the clock until the options set the environment
+	if err := L.CallByParam(lua.P{Fn: L.NewFunction(RegisterEnv("env", lm.env)), Protect: true}, lua.LString("env")); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("failed to set up env: %w", err)
+	}
+	if err := lm.preloadRpackModule(); err != nil {
+		L.Close()
+		return nil, err
+	}
 
-	if err := sandbox(L); err != nil {
+	if err := sandbox(L, lm.luaPrint); err != nil {
 		L.Close()
 		return nil, fmt.Errorf("could not sandbox lua state: %w", err)
 	}
+	// Modules of the definition are loaded after the preloaded ones
+	if loaders, ok := L.GetField(L.Get(lua.RegistryIndex), "_LOADERS").(*lua.LTable); ok {
+		L.RawSetInt(loaders, 2, L.NewFunction(lm.loLoaderDefinition))
+	}
 	return lm, nil
 }
 
@@ -63,11 +90,24 @@ func (lm *LuaModel) Close() {
 	if lm.L != nil {
 		lm.L.Close()
 	}
+	if lm.api != nil {
+		lm.api.Close()
+	}
 }
 
 // Exec executes the given Lua script.
 func (lm *LuaModel) Exec(script string) error {
-	return lm.L.DoString(script)
+	return luaErrorMessage(lm.L, lm.L.DoString(script))
+}
+
+// execChunk executes the script under the chunk name, which errors and call sites refer to.
+func (lm *LuaModel) execChunk(script, name string) error {
+	fn, err := lm.L.Load(strings.NewReader(script), name)
+	if err != nil {
+		return luaErrorMessage(lm.L, err)
+	}
+	lm.L.Push(fn)
+	return luaErrorMessage(lm.L, lm.L.PCall(0, lua.MultRet, nil))
 }
 
 // openLibs opens a standard set of Lua libraries.
@@ -83,6 +123,12 @@ func openLibs(L *lua.LState) error {
 		{lua.MathLibName, lua.OpenMath},
 		{lua.DebugLibName, lua.OpenDebug},
 		{"filepath", RegisterFilepath("filepath")},
+		{"regex", RegisterRegex("regex")},
+		{"strings", RegisterStrings("strings")},
+		{"hash", RegisterHash("hash")},
+		{"semver", RegisterSemver("semver")},
+		{"base64", RegisterBase64("base64")},
+		{"hex", RegisterHex("hex")},
 	}
 	for _, lib := range libs {
 		if err := L.CallByParam(lua.P{
@@ -95,19 +141,25 @@ func openLibs(L *lua.LState) error {
 	}
 	return nil
 }
-func luaPrint(L *lua.LState) int {
+
+// luaPrint logs the arguments of print as script output.
+func (lm *LuaModel) luaPrint(L *lua.LState) int {
 	top := L.GetTop()
 	var logStrs []string
 	for i := 1; i <= top; i++ {
 		logStrs = append(logStrs, L.ToStringMeta(L.Get(i)).String())
 	}
-	slog.Info(fmt.Sprintf("Script: %s", strings.Join(logStrs, " ")))
+	log := lm.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	log.Info(fmt.Sprintf("Script: %s", strings.Join(logStrs, " ")))
 	return 0
 }
 
-// sandbox applies sandboxing rules to the lua environment
-func sandbox(L *lua.LState) error {
-	L.SetGlobal("print", L.NewFunction(luaPrint))
+// sandbox applies sandboxing rules to the lua environment, print logs through the given function
+func sandbox(L *lua.LState, printFn lua.LGFunction) error {
+	L.SetGlobal("print", L.NewFunction(printFn))
 	L.SetGlobal("loadfile", lua.LNil)
 	L.SetGlobal("dofile", lua.LNil)
 
@@ -139,16 +191,53 @@ func loLoaderPreload(L *lua.LState) int {
 	return 1
 }
 
+// loLoaderDefinition loads modules from the definition directory through the rpack: resolver, read-only
+// and recorded like any other file access. require("lib.helpers") and require("lib/helpers") load
+// lib/helpers.lua or lib/helpers/init.lua.
+func (lm *LuaModel) loLoaderDefinition(L *lua.LState) int {
+	name := L.CheckString(1)
+	base, err := cleanScriptPath(strings.ReplaceAll(name, ".", "/"))
+	if err != nil {
+		L.Push(lua.LString(fmt.Sprintf("invalid module name '%s': %s", name, err)))
+		return 1
+	}
+	var tried []string
+	for _, file := range []string{base + ".lua", base + "/init.lua"} {
+		friendly := RPackResolver + ":" + file
+		content, err := lm.fs.Read(friendly)
+		if errors.Is(err, os.ErrNotExist) {
+			tried = append(tried, fmt.Sprintf("no file '%s'", friendly))
+			continue
+		}
+		if err != nil {
+			raiseFileError(L, "read", friendly, err)
+			return 0
+		}
+		fn, err := L.Load(bytes.NewReader(content), file)
+		if err != nil {
+			L.RaiseError("failed to load module '%s': %s", name, err)
+			return 0
+		}
+		L.Push(fn)
+		return 1
+	}
+	L.Push(lua.LString(strings.Join(tried, "\n\t")))
+	return 1
+}
+
+// RPackDataField is the field of the rpack module holding the external data.
+const RPackDataField = "data"
+
 // preloadRpackModule preloads the module under "rpack.v1" so that scripts can
 // load it via: local rpack = require("rpack.v1")
-func (lm *LuaModel) preloadRpackModule() {
+// External data is exposed as functions in rpack.data and, for compatibility,
+// directly on the module. It fails if a key collides with a function of the module.
+func (lm *LuaModel) preloadRpackModule() error {
 	functions := map[string]lua.LGFunction{
 		// "copy": lm.luaCopy,
 		// "read_dir": lm.luaReadDir,
 		// "read_yaml":  lm.luaReadYAML,
-		// "write_yaml": lm.luaWriteYAML,
 		// "from_json":   lm.luaFromJSON,
-		// "write_json":  lm.luaWriteJSON,
 		"read_lines":  lm.luaReadLines,
 		"write_lines": lm.luaWriteLines,
 		// "read":        lm.luaReadString,
@@ -157,56 +246,70 @@ func (lm *LuaModel) preloadRpackModule() {
 		// "jq": lm.luaJQ,
 	}
 	rpackAPI := NewRPackAPI(lm.fs)
+	lm.api = rpackAPI
 	rpackAPIFuncs := rpackAPI.Funcs()
 	maps.Copy(functions, rpackAPIFuncs)
+	extKeys := slices.Sorted(maps.Keys(lm.extValues))
+	for _, key := range extKeys {
+		if _, ok := functions[key]; ok || key == RPackDataField {
+			return fmt.Errorf("external data key %q collides with rpack.%s of the rpack.v1 module", key, key)
+		}
+	}
 	loader := func(L *lua.LState) int {
 		mod := L.NewTable()
 		// Set built-in functions.
-		for name, fun := range functions {
-			L.SetField(mod, name, L.NewFunction(fun))
+		for _, name := range slices.Sorted(maps.Keys(functions)) {
+			L.SetField(mod, name, L.NewFunction(functions[name]))
 		}
 		// Register external data functions automatically.
 		// For each key in extValues, add a function that when called returns the conversion of the Go value.
-		for key := range lm.extValues {
+		data := L.NewTable()
+		for _, key := range extKeys {
 			// Capture the key using a local variable.
 			k := key
-			L.SetField(mod, k, L.NewFunction(func(L *lua.LState) int {
+			fn := L.NewFunction(func(L *lua.LState) int {
 				L.Push(goToLValue(L, lm.extValues[k]))
 				return 1
-			}))
+			})
+			L.SetField(data, k, fn)
+			// v1 alias, collisions were rejected above
+			L.SetField(mod, k, fn)
 		}
+		L.SetField(mod, RPackDataField, data)
 		L.Push(mod)
 		return 1
 	}
 	lm.L.PreloadModule("rpack.v1", loader)
+	return nil
 }
 
 // luaReadLines reads a file returning a table with lines, separator, and finalNewline.
+// Content with BOM or in UTF-16/UTF-32 is decoded to UTF-8 first, lines are split
+// on any line ending and the most common one is reported as separator.
 func (lm *LuaModel) luaReadLines(L *lua.LState) int {
 	friendly := L.CheckString(1)
 	contentBytes, err := lm.fs.Read(friendly)
 	if err != nil {
-		L.ArgError(1, err.Error())
+		raiseFileError(L, "read", friendly, err)
 		return 0
 	}
-	content := string(contentBytes)
-	sep := "\n"
-	if strings.Contains(content, "\r\n") {
-		sep = "\r\n"
-	}
-	finalNewline := strings.HasSuffix(content, sep)
-	linesArr := strings.Split(content, sep)
-	if finalNewline && len(linesArr) > 0 && linesArr[len(linesArr)-1] == "" {
-		linesArr = linesArr[:len(linesArr)-1]
+	content, report, err := decodeText(contentBytes)
+	if err != nil {
+		L.ArgError(1, fmt.Sprintf("failed to decode %s: %s", friendly, err))
+		return 0
 	}
+	linesArr, finalNewline := splitTextLines(content)
 	linesTable := L.NewTable()
 	for i, line := range linesArr {
 		linesTable.RawSetInt(i+1, lua.LString(line))
 	}
 	ret := L.NewTable()
 	ret.RawSetString("lines", linesTable)
-	ret.RawSetString("separator", lua.LString(sep))
+	ret.RawSetString("separator", lua.LString(report.Separator()))
 	ret.RawSetString("finalNewline", lua.LBool(finalNewline))
+	ret.RawSetString("mixedLineEndings", lua.LBool(report.Mixed()))
+	ret.RawSetString("encoding", lua.LString(report.Encoding))
+	ret.RawSetString("bom", lua.LBool(report.BOM))
 	L.Push(ret)
 	return 1
 }
@@ -229,13 +332,23 @@ func (lm *LuaModel) luaWriteLines(L *lua.LState) int {
 	}
 	err := lm.fs.Write(friendly, []byte(content))
 	if err != nil {
-		L.ArgError(1, err.Error())
+		raiseFileError(L, "write", friendly, err)
 		return 0
 	}
+	lm.api.writes.record(L, friendly, []byte(content))
 
 	return 0
 }
 
+// luaInputTable is the table returned by rpack.inputs(). It is the list of mapped input names
+// and additionally maps each name to the path to read it from, missing inputs are nil.
+// Glob inputs map to the list of paths of their files.
+type luaInputTable struct {
+	names []string
+	// globs holds the matches of glob inputs by name
+	globs map[string][]string
+}
+
 // goToLValue converts a Go type into a Lua value.
 // TODO: Potential problem with typed slices
 func goToLValue(L *lua.LState, val any) lua.LValue {
@@ -246,10 +359,34 @@ func goToLValue(L *lua.LState, val any) lua.LValue {
 		return lua.LBool(v)
 	case int:
 		return lua.LNumber(v)
+	case int8:
+		return lua.LNumber(v)
+	case int16:
+		return lua.LNumber(v)
+	case int32:
+		return lua.LNumber(v)
 	case int64:
 		return lua.LNumber(v)
+	case uint:
+		return lua.LNumber(v)
+	case uint8:
+		return lua.LNumber(v)
+	case uint16:
+		return lua.LNumber(v)
+	case uint32:
+		return lua.LNumber(v)
+	case uint64:
+		return lua.LNumber(v)
+	case float32:
+		return lua.LNumber(v)
 	case float64:
 		return lua.LNumber(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return lua.LNumber(f)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return lua.LNumber(f)
 	case string:
 		return lua.LString(v)
 	case []any:
@@ -266,8 +403,25 @@ func goToLValue(L *lua.LState, val any) lua.LValue {
 		return tbl
 	case map[string]any:
 		tbl := L.NewTable()
-		for key, item := range v {
-			tbl.RawSetString(key, goToLValue(L, item))
+		// Lua tables iterate in insertion order, sorted keys make pairs() deterministic
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			tbl.RawSetString(key, goToLValue(L, v[key]))
+		}
+		return tbl
+	case luaInputTable:
+		tbl := L.NewTable()
+		for i, name := range v.names {
+			tbl.RawSetInt(i+1, lua.LString(name))
+			matches, isGlob := v.globs[name]
+			if !isGlob {
+				tbl.RawSetString(name, lua.LString(MapFSResolverPrefix+name))
+				continue
+			}
+			files := L.NewTable()
+			for j, match := range matches {
+				files.RawSetInt(j+1, lua.LString(MapFSResolverPrefix+name+"/"+match))
+			}
+			tbl.RawSetString(name, files)
 		}
 		return tbl
 	default:
@@ -275,55 +429,180 @@ func goToLValue(L *lua.LState, val any) lua.LValue {
 	}
 }
 
-// luaTableToGo converts a Lua table into a Go native type.
-func luaTableToGo(tbl *lua.LTable) any {
-	var arr []any
+// luaTableToGo converts a Lua table into a Go native type, see convertLuaTable.
+func luaTableToGo(tbl *lua.LTable) (any, error) {
+	return convertLuaTable(tbl, "", make(map[*lua.LTable]struct{}))
+}
+
+// convertLuaTable converts tbl found at path into a Go native type.
+// Tables with exactly the keys 1..n are arrays and converted to []any in the order of their keys,
+// all other tables, including sparse arrays, are converted to map[string]any with numbers as string keys.
+// Empty tables are converted to empty maps. Keys of other types, values without Go equivalent like
+// functions and tables containing themselves are errors naming the path of the value.
+func convertLuaTable(tbl *lua.LTable, path string, visiting map[*lua.LTable]struct{}) (any, error) {
+	if _, ok := visiting[tbl]; ok {
+		return nil, fmt.Errorf("%s: table contains itself", luaPathName(path))
+	}
+	visiting[tbl] = struct{}{}
+	defer delete(visiting, tbl)
+
+	keys := luaTableKeys(tbl)
+	count, maxIndex := len(keys), 0
 	isArray := true
-	tbl.ForEach(func(key lua.LValue, value lua.LValue) {
-		if key.Type() != lua.LTNumber {
+	for _, key := range keys {
+		n, ok := key.(lua.LNumber)
+		if !ok || n != lua.LNumber(int(n)) || n < 1 {
 			isArray = false
-		} else {
-			arr = append(arr, lValueToGo(value))
+			break
 		}
-	})
-	if isArray {
-		return arr
+		maxIndex = max(maxIndex, int(n))
 	}
-	m := make(map[string]any)
-	tbl.ForEach(func(key lua.LValue, value lua.LValue) {
-		m[key.String()] = lValueToGo(value)
-	})
-	return m
+	if isArray && count > 0 && maxIndex == count {
+		arr := make([]any, count)
+		for i := range arr {
+			v, err := convertLuaValue(tbl.RawGetInt(i+1), fmt.Sprintf("%s[%d]", path, i+1), visiting)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = v
+		}
+		return arr, nil
+	}
+
+	m := make(map[string]any, count)
+	for _, key := range keys {
+		var name string
+		switch k := key.(type) {
+		case lua.LString:
+			name = string(k)
+		case lua.LNumber:
+			name = k.String()
+		default:
+			return nil, fmt.Errorf("%s: unsupported %s key, only string and number keys can be converted", luaPathName(path), key.Type())
+		}
+		if _, ok := m[name]; ok {
+			return nil, fmt.Errorf("%s: key %q is given as string and number", luaPathName(path), name)
+		}
+		v, err := convertLuaValue(tbl.RawGet(key), path+"."+name, visiting)
+		if err != nil {
+			return nil, err
+		}
+		m[name] = v
+	}
+	return m, nil
 }
 
-// lValueToGo converts a Lua value into a Go native type.
-func lValueToGo(val lua.LValue) any {
+// luaTableKeys returns the keys of tbl like pairs: the array part in order, then the other keys
+// in the order they were set. Unlike LTable.ForEach the order is the same on every run.
+func luaTableKeys(tbl *lua.LTable) []lua.LValue {
+	var keys []lua.LValue
+	for key, _ := tbl.Next(lua.LNil); key != lua.LNil; key, _ = tbl.Next(key) {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// luaPathName returns the name of a value at path in errors of convertLuaTable.
+func luaPathName(path string) string {
+	if path == "" {
+		return "table"
+	}
+	return "table" + path
+}
+
+// convertLuaValue converts val found at path, see convertLuaTable.
+func convertLuaValue(val lua.LValue, path string, visiting map[*lua.LTable]struct{}) (any, error) {
 	switch v := val.(type) {
+	case *lua.LNilType:
+		return nil, nil
 	case lua.LBool:
-		return bool(v)
+		return bool(v), nil
 	case lua.LNumber:
-		return float64(v)
+		return luaNumberToGo(v), nil
 	case lua.LString:
-		if i, err := strconv.Atoi(string(v)); err == nil {
-			return i
-		}
-		return string(v)
+		// Strings stay strings, "007" and "1.0" are no numbers
+		return string(v), nil
 	case *lua.LTable:
-		return luaTableToGo(v)
+		return convertLuaTable(v, path, visiting)
 	default:
-		return v.String()
+		return nil, fmt.Errorf("%s: %s values can not be converted", luaPathName(path), val.Type())
 	}
 }
 
-// ExecuteLuaWithData creates a LuaModel passing in external data, runs the script, and returns the LuaResult.
-func ExecuteLuaWithData(ctx context.Context, script string, fs FS, data map[string]any) error {
+// maxExactInt is the largest integer a float64, the number type of Lua, represents exactly.
+const maxExactInt = 1 << 53
+
+// luaNumberToGo converts a Lua number to int64 if it is an integer float64 represents exactly,
+// so integers are written as 1 and not as 1.0 or 1e+06 by the serializers, and to float64 otherwise.
+func luaNumberToGo(n lua.LNumber) any {
+	f := float64(n)
+	if f == math.Trunc(f) && math.Abs(f) <= maxExactInt {
+		return int64(f)
+	}
+	return f
+}
+
+// LuaResult holds the findings reported by a script.
+type LuaResult struct {
+	Annotations []*Annotation
+	// MultiWrites are the target files written more than once with different content
+	MultiWrites []*MultiWrite
+}
+
+// LuaOptions configure the execution of a script.
+type LuaOptions struct {
+	// LintTemplates makes rpack.template fail on fields missing from the data
+	// and warn about data keys the template never references
+	LintTemplates bool
+	// TemplateDefaults are the defaults of rpack.template, optional
+	TemplateDefaults *RPackDefTemplate
+	// Logger receives the output of print, optional
+	Logger *slog.Logger
+	// Env is the environment of the env module, optional
+	Env *LuaEnv
+	// Reproducible seeds math.random with a fixed seed, so scripts using it produce the same output on every run
+	Reproducible bool
+	// ScriptName is the file name errors refer to, script.lua if empty
+	ScriptName string
+}
+
+// ExecuteLua creates a LuaModel passing in external data, runs the script, and returns the LuaResult.
+// On script errors the result contains the findings reported up to the failure.
+func ExecuteLua(ctx context.Context, script string, fs FS, data map[string]any) (*LuaResult, error) {
+	return ExecuteLuaWithOptions(ctx, script, fs, data, LuaOptions{})
+}
+
+// ExecuteLuaWithOptions is ExecuteLua with options.
+func ExecuteLuaWithOptions(ctx context.Context, script string, fs FS, data map[string]any, opts LuaOptions) (*LuaResult, error) {
 	lm, err := NewLuaModel(ctx, fs, data)
 	if err != nil {
-		return fmt.Errorf("failed to initialize Lua environment: %w", err)
+		return nil, fmt.Errorf("failed to initialize Lua environment: %w", err)
 	}
 	defer lm.Close()
-	if err = lm.Exec(script); err != nil {
-		return fmt.Errorf("failed to execute script: %w", err)
+	lm.api.lintTemplates = opts.LintTemplates
+	lm.api.templateDefaults = opts.TemplateDefaults
+	lm.Logger = opts.Logger
+	if opts.Env != nil {
+		*lm.env = *opts.Env
 	}
-	return nil
+	lm.api.now = lm.env.now
+	if opts.Reproducible {
+		seedMathRandom(lm.L, reproducibleSeed)
+	}
+	if opts.ScriptName != "" {
+		err = lm.execChunk(script, opts.ScriptName)
+	} else {
+		err = lm.Exec(script)
+	}
+	result := &LuaResult{Annotations: lm.api.Annotations(), MultiWrites: lm.api.MultiWrites()}
+	if err != nil {
+		return result, fmt.Errorf("failed to execute script: %w", err)
+	}
+	return result, nil
+}
+
+// ExecuteLuaWithData creates a LuaModel passing in external data and runs the script.
+func ExecuteLuaWithData(ctx context.Context, script string, fs FS, data map[string]any) error {
+	_, err := ExecuteLua(ctx, script, fs, data)
+	return err
 }
@@ -3,8 +3,11 @@ package rpack
 
 import (
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 
+	lua "github.com/yuin/gopher-lua"
 	"sigs.k8s.io/yaml"
 )
 
@@ -191,6 +194,52 @@ func TestLuaExternalData(t *testing.T) {
 	}
 }
 
+func TestLuaExternalDataNamespace(t *testing.T) {
+	script := `
+        local rpack = require("rpack.v1")
+        assert(rpack.data.config().user == "alice")
+        assert(rpack.data.config == rpack.config, "v1 alias must be the same function")
+        assert(rpack.data.missing == nil)
+    `
+	data := map[string]any{"config": map[string]any{"user": "alice"}}
+	if err := ExecuteLuaWithData(t.Context(), script, NewInMemoryFS(), data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"write", "template", "data"} {
+		err := ExecuteLuaWithData(t.Context(), "", NewInMemoryFS(), map[string]any{key: 1})
+		if err == nil || !strings.Contains(err.Error(), "collides with rpack."+key) {
+			t.Errorf("Expected collision of key %q to fail, got %v", key, err)
+		}
+	}
+}
+
+func TestLuaExternalDataOrder(t *testing.T) {
+	script := `
+        local rpack = require("rpack.v1")
+        local keys, data = {}, {}
+        for k in pairs(rpack.data.config()) do
+            table.insert(keys, k)
+        end
+        for k in pairs(rpack.data) do
+            table.insert(data, k)
+        end
+        assert(table.concat(keys, ",") == "a,b,c,d,e", table.concat(keys, ","))
+        assert(table.concat(data, ",") == "config,inputs,values", table.concat(data, ","))
+    `
+	data := map[string]any{
+		"values": 1,
+		"inputs": 2,
+		"config": map[string]any{"e": 1, "c": 2, "a": 3, "d": 4, "b": 5},
+	}
+	// Go randomizes map iteration, repeat to catch unordered conversion
+	for range 10 {
+		if err := ExecuteLuaWithData(t.Context(), script, NewInMemoryFS(), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestLuaSandbox(t *testing.T) {
 	fs := NewInMemoryFS()
 	script := `
@@ -201,3 +250,118 @@ func TestLuaSandbox(t *testing.T) {
 		t.Fatalf("ExecuteLua error: %s", err)
 	}
 }
+
+func TestLuaRequireDefinitionModule(t *testing.T) {
+	fs := NewInMemoryFS()
+	for name, content := range map[string]string{
+		"rpack:lib/helpers.lua":   "local M = {}\nfunction M.greet(n) return \"hello \" .. n end\nreturn M\n",
+		"rpack:lib/util/init.lua": "return {answer = 42}\n",
+		"rpack:lib/broken.lua":    "local x = \n",
+	} {
+		if err := fs.Write(name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script := `
+		local rpack = require("rpack.v1")
+		local helpers = require("lib/helpers")
+		local util = require("lib.util")
+		assert(require("lib/helpers") == helpers, "modules are loaded once")
+		rpack.write("out.txt", helpers.greet("world") .. " " .. util.answer)
+	`
+	if err := ExecuteLuaWithData(t.Context(), script, fs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := fs.Read("out.txt"); string(b) != "hello world 42" {
+		t.Errorf("Unexpected output %q", b)
+	}
+
+	for script, want := range map[string]string{
+		`require("lib.missing")`: "no file 'rpack:lib/missing.lua'",
+		`require("../secret")`:   "invalid module name '../secret'",
+		`require("lib.broken")`:  "lib/broken.lua",
+	} {
+		if err := ExecuteLuaWithData(t.Context(), script, fs, nil); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %s to fail with %q, got %v", script, want, err)
+		}
+	}
+}
+
+func TestExecuteLuaAnnotations(t *testing.T) {
+	script := `
+		local rpack = require("rpack.v1")
+		rpack.warn("first")
+		rpack.annotate("out.txt", "second")
+		error("boom")
+	`
+	res, err := ExecuteLua(t.Context(), script, NewInMemoryFS(), nil)
+	if err == nil {
+		t.Fatalf("Expected script error")
+	}
+	if res == nil || len(res.Annotations) != 2 || res.Annotations[1].Path != "out.txt" {
+		t.Errorf("Expected annotations reported before the error, got %v", res)
+	}
+}
+
+func TestLuaTableToGo(t *testing.T) {
+	tcs := []struct {
+		name   string
+		script string
+		want   any
+		err    string
+	}{
+		{name: "array", script: `return {"a", "b", "c"}`, want: []any{"a", "b", "c"}},
+		{name: "array assigned in reverse", script: `local t = {}; t[3] = "c"; t[2] = "b"; t[1] = "a"; return t`, want: []any{"a", "b", "c"}},
+		{name: "empty", script: `return {}`, want: map[string]any{}},
+		{name: "sparse", script: `return {[1] = "a", [3] = "c"}`, want: map[string]any{"1": "a", "3": "c"}},
+		{name: "mixed", script: `return {"a", key = true}`, want: map[string]any{"1": "a", "key": true}},
+		{name: "nested", script: `return {list = {{x = 1.5}}}`, want: map[string]any{"list": []any{map[string]any{"x": 1.5}}}},
+		{name: "numbers", script: `return {1, -2, 1.5, 2^53, 2^60}`, want: []any{int64(1), int64(-2), 1.5, int64(1 << 53), float64(1 << 60)}},
+		{name: "numeric strings", script: `return {"007", "1.0", "12"}`, want: []any{"007", "1.0", "12"}},
+		{name: "function", script: `return {a = {b = print}}`, err: "table.a.b: function values can not be converted"},
+		{name: "table key", script: `return {[{}] = 1}`, err: "table: unsupported table key"},
+		{name: "duplicate key", script: `return {[1] = "a", ["1"] = "b", x = 1}`, err: `key "1" is given as string and number`},
+		{name: "cycle", script: `local t = {}; t.self = t; return t`, err: "table.self: table contains itself"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			L := lua.NewState()
+			defer L.Close()
+			if err := L.DoString(tc.script); err != nil {
+				t.Fatal(err)
+			}
+			got, err := luaTableToGo(L.CheckTable(-1))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("luaTableToGo() = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLuaToJSONNumbers(t *testing.T) {
+	fs := NewInMemoryFS()
+	script := `
+		local rpack = require("rpack.v1")
+		rpack.write("./out.json", rpack.to_json({port = 8080, ratio = 0.5, big = 1e6, version = "1.0", id = "007"}))
+	`
+	if err := ExecuteLuaWithData(t.Context(), script, fs, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.Read("./out.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"big\": 1000000,\n  \"id\": \"007\",\n  \"port\": 8080,\n  \"ratio\": 0.5,\n  \"version\": \"1.0\"\n}"
+	if string(b) != want {
+		t.Errorf("Unexpected JSON:\n%s", b)
+	}
+}
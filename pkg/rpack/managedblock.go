@@ -0,0 +1,210 @@
+package rpack
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blang/rpack/pkg/lockfile"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// blockWriter is implemented by filesystems that write managed blocks, see RPackFS.WriteBlock.
+type blockWriter interface {
+	WriteBlock(name, marker, content string) error
+}
+
+// blockComments are the comment delimiters of marker lines by file extension, "#" for all others.
+var blockComments = map[string][2]string{
+	".c": {"//", ""}, ".h": {"//", ""}, ".cc": {"//", ""}, ".cpp": {"//", ""}, ".cs": {"//", ""},
+	".go": {"//", ""}, ".java": {"//", ""}, ".js": {"//", ""}, ".jsx": {"//", ""}, ".kt": {"//", ""},
+	".rs": {"//", ""}, ".scala": {"//", ""}, ".swift": {"//", ""}, ".ts": {"//", ""}, ".tsx": {"//", ""},
+	".lua": {"--", ""}, ".sql": {"--", ""}, ".hs": {"--", ""},
+	".ini": {";", ""},
+	".css": {"/*", " */"}, ".scss": {"//", ""},
+	".html": {"<!--", " -->"}, ".xml": {"<!--", " -->"}, ".md": {"<!--", " -->"}, ".svg": {"<!--", " -->"},
+}
+
+// validBlockMarker checks the name of a managed block, it is a single word.
+func validBlockMarker(marker string) error {
+	if marker == "" || strings.ContainsFunc(marker, func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' }) {
+		return fmt.Errorf("invalid managed block marker %q, it must be a single word", marker)
+	}
+	return nil
+}
+
+// blockMarkerLine reports if line is the begin or end marker line of a managed block.
+func blockMarkerLine(line string) bool {
+	fields := strings.Fields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if (fields[i] == lockfile.BlockBegin || fields[i] == lockfile.BlockEnd) && fields[i+1] == "rpack" {
+			return true
+		}
+	}
+	return false
+}
+
+// formatManagedBlock returns the managed block named marker of the target file relPath holding content,
+// delimited by marker lines commented in the syntax of the file. Content must not contain marker lines,
+// the block would end early or capture other blocks.
+func formatManagedBlock(relPath, marker, content string) (string, error) {
+	for line := range strings.Lines(content) {
+		if blockMarkerLine(line) {
+			return "", fmt.Errorf("content of managed block %q contains a block marker line: %q", marker, strings.TrimRight(line, "\r\n"))
+		}
+	}
+	comment, ok := blockComments[strings.ToLower(path.Ext(relPath))]
+	if !ok {
+		comment = [2]string{"#", ""}
+	}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s rpack %s%s\n", comment[0], lockfile.BlockBegin, marker, comment[1])
+	b.WriteString(content)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "%s %s rpack %s%s\n", comment[0], lockfile.BlockEnd, marker, comment[1])
+	return b.String(), nil
+}
+
+// replaceManagedBlock replaces the managed block named marker of content with block, see formatManagedBlock,
+// or removes it if block is empty. A missing block is appended, separated by an empty line.
+// The line endings of content are kept.
+func replaceManagedBlock(content []byte, marker, block string) []byte {
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	start, end := -1, -1
+	for i, line := range lines {
+		if start < 0 && lockfile.IsBlockMarker(line, lockfile.BlockBegin, marker) {
+			start = i
+		} else if start >= 0 && lockfile.IsBlockMarker(line, lockfile.BlockEnd, marker) {
+			end = i
+			break
+		}
+	}
+
+	var out string
+	if end >= 0 {
+		out = strings.Join(lines[:start], "") + block + strings.Join(lines[end+1:], "")
+	} else if block != "" {
+		out = text
+		if out != "" && !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		if out != "" && !strings.HasSuffix(out, "\n\n") {
+			out += "\n"
+		}
+		out += block
+	} else {
+		return content
+	}
+	if bytes.Contains(content, []byte("\r\n")) {
+		out = strings.ReplaceAll(out, "\n", "\r\n")
+	}
+	if out == string(content) {
+		return content
+	}
+	return []byte(out)
+}
+
+// stripManagedBlocks removes the managed blocks named markers from content.
+func stripManagedBlocks(content []byte, markers []string) []byte {
+	for _, marker := range markers {
+		content = replaceManagedBlock(content, marker, "")
+	}
+	return content
+}
+
+// WriteBlock writes content as the managed block named marker of the target file name.
+// The run directory only holds the blocks of the file, they are put into the existing
+// target file after the script, see applyManagedBlocks.
+func (fs *RPackFS) WriteBlock(name, marker, content string) error {
+	if err := validBlockMarker(marker); err != nil {
+		return err
+	}
+	relPath, ok := fs.TargetPath(name)
+	if !ok {
+		return fmt.Errorf("managed blocks can only be written to target files: %s", name)
+	}
+	block, err := formatManagedBlock(relPath, marker, content)
+	if err != nil {
+		return err
+	}
+	markers := fs.blocks[relPath]
+	if !slices.Contains(markers, marker) {
+		markers = append(slices.Clone(markers), marker)
+	}
+	err = fs.update(name, func(old []byte, _ bool) ([]byte, error) {
+		if !bytes.Equal(old, lockfile.ExtractBlocks(old, fs.blocks[relPath])) {
+			return nil, fmt.Errorf("file is written with other functions, use only managed_block")
+		}
+		var out strings.Builder
+		for _, m := range markers {
+			if m == marker {
+				out.WriteString(block)
+			} else {
+				out.Write(lockfile.ExtractBlocks(old, []string{m}))
+			}
+		}
+		return []byte(out.String()), nil
+	})
+	if err != nil {
+		return err
+	}
+	if fs.blocks == nil {
+		fs.blocks = make(map[string][]string)
+	}
+	fs.blocks[relPath] = markers
+	return nil
+}
+
+// ManagedBlocks returns the markers of the managed blocks written to target files, keyed by their relative path.
+func (fs *RPackFS) ManagedBlocks() map[string][]string {
+	return fs.blocks
+}
+
+// applyManagedBlocks puts the managed blocks of the generated files into the current content
+// of their target files, keeping the rest of the files as is.
+// The target files are read outside of the access hooks, the scripts do not see their content.
+func applyManagedBlocks(log *slog.Logger, execPath string, runs []*packRun) error {
+	for _, run := range runs {
+		for relPath, markers := range run.FS.ManagedBlocks() {
+			absPath := filepath.Join(run.Instance.RunPath, relPath)
+			generated, err := os.ReadFile(util.LongPath(absPath)) //nolint:gosec // path constructed from run directory
+			if err != nil {
+				return fmt.Errorf("failed to read generated file: %s: %w", relPath, err)
+			}
+			blocks := lockfile.ExtractBlocks(generated, markers)
+			if !bytes.Equal(blocks, bytes.ReplaceAll(generated, []byte("\r\n"), []byte("\n"))) {
+				return fmt.Errorf("target file %s is written with managed_block and other functions, use only managed_block: %w", relPath, ErrLuaExecution)
+			}
+			targetPath := filepath.Join(execPath, relPath)
+			content, exists, err := readTargetFile(targetPath)
+			if err != nil {
+				return fmt.Errorf("failed to read target file: %s: %w", relPath, err)
+			}
+			perm := os.FileMode(generatedFilePerm)
+			if info, statErr := os.Stat(util.LongPath(targetPath)); exists && statErr == nil {
+				perm = info.Mode().Perm()
+			}
+			for _, marker := range markers {
+				content = replaceManagedBlock(content, marker, string(lockfile.ExtractBlocks(generated, []string{marker})))
+			}
+			if err = writeFileUnlinked(util.LongPath(absPath), content, perm); err != nil {
+				return fmt.Errorf("failed to write managed blocks of: %s: %w", relPath, err)
+			}
+			run.FS.setRewrittenChecksum(relPath, sha256Hex(content))
+			log.Debug("Updated managed blocks", "file", relPath, "blocks", markers)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package rpack
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestReplaceManagedBlock(t *testing.T) {
+	tcs := []struct {
+		name, path, content, body, want string
+	}{
+		{name: "new file", path: "Makefile", body: "lint:\n", want: "# BEGIN rpack lint\nlint:\n# END rpack lint\n"},
+		{name: "append", path: "Makefile", content: "build:", body: "lint:\n",
+			want: "build:\n\n# BEGIN rpack lint\nlint:\n# END rpack lint\n"},
+		{name: "replace", path: "main.go", content: "package main\n// BEGIN rpack lint\nold\n// END rpack lint\nfunc main() {}\n", body: "new",
+			want: "package main\n// BEGIN rpack lint\nnew\n// END rpack lint\nfunc main() {}\n"},
+		{name: "other marker", path: "a.cfg", content: "# BEGIN rpack linter\nx\n# END rpack linter\n", body: "y\n",
+			want: "# BEGIN rpack linter\nx\n# END rpack linter\n\n# BEGIN rpack lint\ny\n# END rpack lint\n"},
+		{name: "crlf", path: "README.md", content: "a\r\n<!-- BEGIN rpack lint -->\r\nold\r\n<!-- END rpack lint -->\r\n", body: "new\n",
+			want: "a\r\n<!-- BEGIN rpack lint -->\r\nnew\r\n<!-- END rpack lint -->\r\n"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			block, err := formatManagedBlock(tc.path, "lint", tc.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := replaceManagedBlock([]byte(tc.content), "lint", block)
+			if string(got) != tc.want {
+				t.Errorf("replaceManagedBlock() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+	for _, body := range []string{"a\n# END rpack lint\nb\n", "// BEGIN rpack other\n"} {
+		if _, err := formatManagedBlock("Makefile", "lint", body); err == nil {
+			t.Errorf("Expected error for block content with marker line %q", body)
+		}
+	}
+	if got := stripManagedBlocks([]byte("a\n# BEGIN rpack lint\nx\n# END rpack lint\nb\n"), []string{"lint"}); string(got) != "a\nb\n" {
+		t.Errorf("stripManagedBlocks() = %q", got)
+	}
+}
+
+func TestRunManagedBlock(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.managed_block(\"./Makefile\", \"lint\", \"lint:\\n\\tgolangci-lint run\\n\")\n", "")
+	makefile := filepath.Join(workDir, "Makefile")
+	if err := os.WriteFile(makefile, []byte("build:\n\tgo build\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	// The existing file is not overwritten, only the block is added
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	want := "build:\n\tgo build\n\n# BEGIN rpack lint\nlint:\n\tgolangci-lint run\n# END rpack lint\n"
+	if b, _ := os.ReadFile(makefile); string(b) != want { //nolint:gosec // test file
+		t.Fatalf("Unexpected Makefile:\n%s", b)
+	}
+	lock, err := Loader{}.loadRPackLockFile(filepath.Join(workDir, "app"+RPackLockFileSuffix))
+	if err != nil || len(lock.Files) != 1 || len(lock.Files[0].Blocks) != 1 || lock.Files[0].Blocks[0] != "lint" {
+		t.Fatalf("Expected lockfile entry with block, got %+v, %v", lock, err)
+	}
+
+	// Hand edits outside of the block are kept and no modification
+	want = "build:\n\tgo build -v\n\n# BEGIN rpack lint\nlint:\n\tgolangci-lint run\n# END rpack lint\ntest:\n\tgo test\n"
+	if err = os.WriteFile(makefile, []byte(want), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(makefile); string(b) != want { //nolint:gosec // test file
+		t.Fatalf("Unexpected Makefile after hand edits:\n%s", b)
+	}
+
+	// Edits inside of the block are
+	if err = os.WriteFile(makefile, []byte("# BEGIN rpack lint\nmine\n# END rpack lint\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config}); !errors.Is(err, ErrLockModified) {
+		t.Fatalf("Expected ErrLockModified, got %v", err)
+	}
+	if err = os.WriteFile(makefile, []byte(want), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	// Blocks no longer written are removed, the rest of the file is kept
+	script := filepath.Join(filepath.Dir(workDir), "def", "script.lua")
+	if err = os.WriteFile(script, []byte("local rpack = require(\"rpack.v1\")\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err = Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(makefile); string(b) != "build:\n\tgo build -v\n\ntest:\n\tgo test\n" { //nolint:gosec // test file
+		t.Errorf("Unexpected Makefile after removing the block:\n%q", b)
+	}
+}
+
+func TestExecRPackDirectManagedBlock(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.managed_block(\"./notes.txt\", \"gen\", \"generated\\n\")\n", "")
+	defDir := filepath.Join(filepath.Dir(filepath.Dir(config)), "def")
+	notes := filepath.Join(workDir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("first\nsecond\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	want := "first\nsecond\n\n# BEGIN rpack gen\ngenerated\n# END rpack gen\n"
+
+	// The output directory gets the merged file, the target is unchanged
+	outDir := filepath.Join(t.TempDir(), "out")
+	e := &Executor{OverrideExecPath: workDir, OutputDir: outDir, Logger: slog.New(slog.DiscardHandler)}
+	if err := e.ExecRPackDirect(t.Context(), defDir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(outDir, "notes.txt")); string(b) != want { //nolint:gosec // test file
+		t.Errorf("Unexpected notes.txt in the output directory:\n%s", b)
+	}
+
+	// The user content of the target is kept
+	e = &Executor{OverrideExecPath: workDir, Logger: slog.New(slog.DiscardHandler)}
+	if err := e.ExecRPackDirect(t.Context(), defDir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(notes); string(b) != want { //nolint:gosec // test file
+		t.Errorf("Unexpected notes.txt:\n%s", b)
+	}
+}
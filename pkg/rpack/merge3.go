@@ -0,0 +1,94 @@
+package rpack
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflict markers written by Merge3, like the ones of git.
+const (
+	mergeMarkerLocal     = "<<<<<<< local\n"
+	mergeMarkerSeparator = "=======\n"
+	mergeMarkerGenerated = ">>>>>>> generated\n"
+)
+
+// Merge3 merges the changes from base to local and from base to generated line by line, like diff3.
+// Regions changed differently on both sides are written with conflict markers,
+// it returns the merged content and the number of conflicts.
+func Merge3(base, local, generated []byte) (merged []byte, conflicts int) {
+	baseLines := splitLines(string(base))
+	localLines := splitLines(string(local))
+	genLines := splitLines(string(generated))
+	localAt := matchBaseLines(baseLines, localLines)
+	genAt := matchBaseLines(baseLines, genLines)
+
+	var out strings.Builder
+	writeLines := func(lines []string) {
+		for _, l := range lines {
+			out.WriteString(l)
+		}
+	}
+	// writeMarkedLines ensures the marker following lines starts on a new line
+	writeMarkedLines := func(lines []string) {
+		writeLines(lines)
+		if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+			out.WriteString("\n")
+		}
+	}
+
+	i, li, gi := 0, 0, 0
+	for {
+		// Copy the lines unchanged on both sides
+		for i < len(baseLines) && localAt[i] == li && genAt[i] == gi {
+			out.WriteString(baseLines[i])
+			i, li, gi = i+1, li+1, gi+1
+		}
+		// The changed region ends at the next base line kept on both sides
+		next := i
+		for next < len(baseLines) && (localAt[next] < 0 || genAt[next] < 0) {
+			next++
+		}
+		localEnd, genEnd := len(localLines), len(genLines)
+		if next < len(baseLines) {
+			localEnd, genEnd = localAt[next], genAt[next]
+		}
+		baseChunk, localChunk, genChunk := baseLines[i:next], localLines[li:localEnd], genLines[gi:genEnd]
+		switch {
+		case slices.Equal(localChunk, baseChunk):
+			writeLines(genChunk)
+		case slices.Equal(genChunk, baseChunk), slices.Equal(localChunk, genChunk):
+			writeLines(localChunk)
+		default:
+			conflicts++
+			out.WriteString(mergeMarkerLocal)
+			writeMarkedLines(localChunk)
+			out.WriteString(mergeMarkerSeparator)
+			writeMarkedLines(genChunk)
+			out.WriteString(mergeMarkerGenerated)
+		}
+		if next >= len(baseLines) {
+			break
+		}
+		i, li, gi = next, localEnd, genEnd
+	}
+	return []byte(out.String()), conflicts
+}
+
+// matchBaseLines returns the index in other of every line of base kept by the diff from base to other, -1 if deleted.
+func matchBaseLines(base, other []string) []int {
+	at := make([]int, len(base))
+	i, j := 0, 0
+	for _, op := range DiffLines(base, other) {
+		switch op.Kind {
+		case DiffOpEqual:
+			at[i] = j
+			i, j = i+1, j+1
+		case DiffOpDelete:
+			at[i] = -1
+			i++
+		case DiffOpInsert:
+			j++
+		}
+	}
+	return at
+}
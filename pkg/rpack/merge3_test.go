@@ -0,0 +1,37 @@
+package rpack
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	tcs := []struct {
+		name, base, local, generated, want string
+		conflicts                          int
+	}{
+		{name: "unchanged", base: "a\nb\n", local: "a\nb\n", generated: "a\nb\n", want: "a\nb\n"},
+		{name: "generated only", base: "a\nb\n", local: "a\nb\n", generated: "a\nB\n", want: "a\nB\n"},
+		{name: "local only", base: "a\nb\n", local: "a\nlocal\nb\n", generated: "a\nb\n", want: "a\nlocal\nb\n"},
+		{
+			name: "both in different regions", base: "a\nb\nc\nd\ne\n",
+			local: "A\nb\nc\nd\ne\n", generated: "a\nb\nc\nd\nE\n", want: "A\nb\nc\nd\nE\n",
+		},
+		{name: "same change", base: "a\nb\n", local: "a\nx\n", generated: "a\nx\n", want: "a\nx\n"},
+		{
+			name: "conflict", base: "a\nb\nc\n", local: "a\nlocal\nc\n", generated: "a\ngen\nc\n",
+			want: "a\n<<<<<<< local\nlocal\n=======\ngen\n>>>>>>> generated\nc\n", conflicts: 1,
+		},
+		{
+			name: "conflict without final newline", base: "a\nb", local: "a\nl", generated: "a\ng",
+			want: "a\n<<<<<<< local\nl\n=======\ng\n>>>>>>> generated\n", conflicts: 1,
+		},
+		{name: "appended on both sides", base: "a\n", local: "a\nl\n", generated: "a\ng\n", want: "a\n<<<<<<< local\nl\n=======\ng\n>>>>>>> generated\n", conflicts: 1},
+		{name: "empty base", base: "", local: "", generated: "new\n", want: "new\n"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, conflicts := Merge3([]byte(tc.base), []byte(tc.local), []byte(tc.generated))
+			if string(got) != tc.want || conflicts != tc.conflicts {
+				t.Errorf("Expected %q with %d conflicts, got %q with %d", tc.want, tc.conflicts, got, conflicts)
+			}
+		})
+	}
+}
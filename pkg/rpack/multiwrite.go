@@ -0,0 +1,161 @@
+package rpack
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// MultiWrite is a target file a script wrote more than once with different content.
+// Only the last write lands, the content of earlier writes is lost.
+type MultiWrite struct {
+	// Path of the file relative to the target
+	Path string
+	// Sites are the script locations of all writes in order, e.g. script.lua:12
+	Sites []string
+}
+
+// message describes the multi-write for annotations and errors.
+func (m *MultiWrite) message() string {
+	return fmt.Sprintf("written %d times with different content, the last write wins: %s", len(m.Sites), strings.Join(m.Sites, ", "))
+}
+
+// multiWriteError returns an ErrConflictingWrites listing all multi-writes, nil if there are none.
+func multiWriteError(multiWrites []*MultiWrite) error {
+	if len(multiWrites) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(multiWrites))
+	for _, m := range multiWrites {
+		errs = append(errs, fmt.Errorf("%s %s", m.Path, m.message()))
+	}
+	return fmt.Errorf("%w: %w", ErrConflictingWrites, errors.Join(errs...))
+}
+
+// targetPathResolver is implemented by filesystems that know which target file a name refers to.
+type targetPathResolver interface {
+	// TargetPath returns the path relative to the target, false if name is not a target file
+	TargetPath(name string) (string, bool)
+}
+
+// writeTracker records whole file writes of a script to the target to detect multi-writes.
+type writeTracker struct {
+	fs    targetPathResolver
+	files map[string]*trackedWrite
+	// order of the first write of each file, for stable reports
+	order []string
+}
+
+// trackedWrite is the state of a target file written by the script.
+type trackedWrite struct {
+	sum      string
+	sites    []string
+	differed bool
+}
+
+// newWriteTracker creates a tracker for fs, it does not track anything if fs has no target.
+func newWriteTracker(fs LuaAPIFS) *writeTracker {
+	resolver, _ := fs.(targetPathResolver)
+	return &writeTracker{fs: resolver, files: make(map[string]*trackedWrite)}
+}
+
+// record tracks a write of content to name by the Lua function calling into Go.
+func (t *writeTracker) record(L *lua.LState, name string, content []byte) {
+	if t.fs == nil {
+		return
+	}
+	t.recordSha(L, name, sha256Hex(content))
+}
+
+// recordSha tracks a write of content with the hex sha256 sum to name.
+func (t *writeTracker) recordSha(L *lua.LState, name string, sum string) {
+	if t.fs == nil {
+		return
+	}
+	target, ok := t.fs.TargetPath(name)
+	if !ok {
+		return
+	}
+	site := luaCallSite(L)
+	w, ok := t.files[target]
+	if !ok {
+		t.files[target] = &trackedWrite{sum: sum, sites: []string{site}}
+		t.order = append(t.order, target)
+		return
+	}
+	w.sites = append(w.sites, site)
+	if w.sum != sum {
+		w.differed = true
+		w.sum = sum
+	}
+}
+
+// remove forgets the writes of a removed file, writing it again is no multi-write.
+func (t *writeTracker) remove(name string) {
+	if t.fs == nil {
+		return
+	}
+	if target, ok := t.fs.TargetPath(name); ok {
+		t.forget(target)
+	}
+}
+
+// rename moves the tracked content of from to to, replacing the writes of to.
+func (t *writeTracker) rename(L *lua.LState, from, to string) {
+	if t.fs == nil {
+		return
+	}
+	src, ok := t.fs.TargetPath(from)
+	if !ok {
+		t.remove(to)
+		return
+	}
+	w := t.files[src]
+	t.forget(src)
+	t.remove(to)
+	if w != nil {
+		t.recordSha(L, to, w.sum)
+	}
+}
+
+// forget drops the tracked writes of the target path.
+func (t *writeTracker) forget(target string) {
+	delete(t.files, target)
+	t.order = slices.DeleteFunc(t.order, func(p string) bool { return p == target })
+}
+
+// multiWrites returns the files written more than once with different content.
+func (t *writeTracker) multiWrites() []*MultiWrite {
+	var res []*MultiWrite
+	for _, target := range t.order {
+		if w := t.files[target]; w.differed {
+			res = append(res, &MultiWrite{Path: target, Sites: w.sites})
+		}
+	}
+	return res
+}
+
+// luaCallSite returns the location in the script calling the current Go function.
+// Go functions in between, such as pcall, are skipped.
+func luaCallSite(L *lua.LState) string {
+	for level := 1; ; level++ {
+		dbg, ok := L.GetStack(level)
+		if !ok {
+			return "unknown"
+		}
+		if _, err := L.GetInfo("Sl", dbg, lua.LNil); err != nil {
+			return "unknown"
+		}
+		if dbg.What == "G" {
+			continue
+		}
+		source := dbg.Source
+		if source == "<string>" {
+			source = RPackDefScriptFilename
+		}
+		return fmt.Sprintf("%s:%d", source, dbg.CurrentLine)
+	}
+}
@@ -0,0 +1,139 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultNotifyTimeout limits a single notification without timeout.
+const DefaultNotifyTimeout = 10 * time.Second
+
+// notifyTimeout returns the parsed timeout of the notifications of the config.
+func (n *RPackConfigNotify) notifyTimeout() (time.Duration, error) {
+	if n == nil || n.Timeout == "" {
+		return DefaultNotifyTimeout, nil
+	}
+	d, err := time.ParseDuration(n.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid notify timeout %q: %w", n.Timeout, ErrValidation)
+	}
+	return d, nil
+}
+
+// validate checks the webhook and timeout of the notifications of the config.
+func (n *RPackConfigNotify) validate() error {
+	u, err := url.Parse(n.Webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid notify webhook %q, an http or https URL is required: %w", stripURLCredentials(n.Webhook), ErrValidation)
+	}
+	_, err = n.notifyTimeout()
+	return err
+}
+
+// checkNotifyWebhook checks that the host of the webhook of the config is allowed.
+// Hosts are allowed with or without port.
+func checkNotifyWebhook(cfg *RPackConfigNotify, allow []string) error {
+	if cfg == nil {
+		return nil
+	}
+	u, err := url.Parse(cfg.Webhook)
+	if err != nil {
+		return fmt.Errorf("invalid notify webhook %q: %w", stripURLCredentials(cfg.Webhook), ErrValidation)
+	}
+	for _, host := range allow {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q of the notify webhook is not allowed, allow it with --allow-notify %s", u.Host, u.Hostname())
+}
+
+// notifyClient posts the run reports. Redirects are not followed, they could send the
+// report to hosts not allowed by --allow-notify.
+var notifyClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// notifyApply sends the report of an apply to the webhook of the config, the webhooks of the executor
+// and on stdin to the notify command of the executor. All notifications are attempted,
+// their failures are returned joined.
+func (e *Executor) notifyApply(ctx context.Context, cfg *RPackConfigNotify, report *RunReport) error {
+	webhooks := e.NotifyWebhooks
+	if cfg != nil {
+		webhooks = append([]string{cfg.Webhook}, webhooks...)
+	}
+	if len(webhooks) == 0 && len(e.NotifyCommand) == 0 {
+		return nil
+	}
+	timeout, err := cfg.notifyTimeout()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run report: %w", err)
+	}
+	var errs []error
+	for _, webhook := range webhooks {
+		if err = postWebhook(ctx, webhook, body, timeout); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		e.log().Debug("Sent run report to webhook", "url", stripURLCredentials(webhook))
+	}
+	if len(e.NotifyCommand) > 0 {
+		if err = runNotifyCommand(ctx, e.NotifyCommand, body, timeout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postWebhook posts the JSON body to webhook, any status but 2xx is an error, including redirects.
+func postWebhook(ctx context.Context, webhook string, body []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook %s: %w", stripURLCredentials(webhook), err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		// The error of the client contains the URL
+		return fmt.Errorf("failed to post run report to webhook %s: %w", stripURLCredentials(webhook), errors.Unwrap(err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, httpFetchMaxSize))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to post run report to webhook %s: %s", stripURLCredentials(webhook), resp.Status)
+	}
+	return nil
+}
+
+// runNotifyCommand runs the command without a shell, passing the JSON body on stdin.
+func runNotifyCommand(ctx context.Context, command []string, body []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...) //nolint:gosec // intentional: command given on the command line
+	cmd.WaitDelay = commandWaitDelay
+	cmd.Stdin = bytes.NewReader(body)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("notify command %s failed: %w\n%s", command[0], err, tailLines(out.String(), verifyOutputLines))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package rpack
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// TestNotifyHelperProcess is run as notify command by the tests below.
+func TestNotifyHelperProcess(_ *testing.T) {
+	out := os.Getenv("RPACK_NOTIFY_HELPER_OUT")
+	if out == "" {
+		return
+	}
+	b, _ := io.ReadAll(os.Stdin)
+	_ = os.WriteFile(out, b, 0o644) //nolint:gosec // test file
+	os.Exit(0)
+}
+
+func TestRunNotify(t *testing.T) {
+	var reports []*RunReport
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var report RunReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reports = append(reports, &report)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"hello\\n\")\n", "notify:\n  webhook: \""+srv.URL+"/config\"\n")
+	cmdOut := filepath.Join(t.TempDir(), "report.json")
+	t.Setenv("RPACK_NOTIFY_HELPER_OUT", cmdOut)
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 0 {
+		t.Fatalf("Expected no notifications on dry-run, got %d", len(reports))
+	}
+
+	// The webhook of the config needs to be allowed
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err == nil || !strings.Contains(err.Error(), "--allow-notify") {
+		t.Fatalf("Expected the webhook to require --allow-notify, got %v", err)
+	}
+	if len(reports) != 0 {
+		t.Fatalf("Expected no notifications without --allow-notify, got %d", len(reports))
+	}
+
+	// A failing webhook is not a failure of the run
+	_, err := Run(t.Context(), api.RunOptions{
+		ConfigFile:     config,
+		AllowNotify:    []string{strings.TrimPrefix(srv.URL, "http://")},
+		NotifyWebhooks: []string{srv.URL + "/broken"},
+		NotifyCommand:  []string{os.Args[0], "-test.run=^TestNotifyHelperProcess$"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("Expected the config and option webhooks notified, got %d", len(reports))
+	}
+	if reports[0].ID == "" || len(reports[0].Packs) != 1 || len(reports[0].Packs[0].Outputs) != 1 || reports[0].Packs[0].Outputs[0].Path != "out.txt" {
+		t.Fatalf("Expected the run report posted, got %+v", reports[0])
+	}
+	b, err := os.ReadFile(cmdOut) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report RunReport
+	if err = json.Unmarshal(b, &report); err != nil || report.ID != reports[0].ID {
+		t.Fatalf("Expected the run report on stdin of the command, got %q, %v", b, err)
+	}
+	if _, err = os.Stat(filepath.Join(workDir, "out.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateNotify(t *testing.T) {
+	for _, tc := range []struct {
+		notify *RPackConfigNotify
+		valid  bool
+	}{
+		{notify: &RPackConfigNotify{Webhook: "https://hooks.example.com/rpack", Timeout: "5s"}, valid: true},
+		{notify: &RPackConfigNotify{Webhook: "https://"}},
+		{notify: &RPackConfigNotify{Webhook: "ftp://hooks.example.com"}},
+		{notify: &RPackConfigNotify{Webhook: "https://hooks.example.com", Timeout: "0s"}},
+	} {
+		if err := tc.notify.validate(); (err == nil) != tc.valid {
+			t.Errorf("validate(%+v) = %v, want valid %v", tc.notify, err, tc.valid)
+		}
+	}
+	notify := &RPackConfigNotify{Webhook: "https://Hooks.example.com:8443/rpack"}
+	if err := checkNotifyWebhook(notify, []string{"hooks.example.com"}); err != nil {
+		t.Errorf("Expected the host to be allowed without port, got %v", err)
+	}
+	if err := checkNotifyWebhook(notify, []string{"hooks.example.com:443", "example.com"}); err == nil {
+		t.Error("Expected other hosts and ports not to allow the webhook")
+	}
+}
+
+func TestRunNotifyCommandTimeout(t *testing.T) {
+	t.Setenv("RPACK_VERIFY_HELPER", "orphan")
+	start := time.Now()
+	if err := runNotifyCommand(t.Context(), []string{os.Args[0], "-test.run=^TestVerifyHelperProcess$"}, []byte("{}"), 100*time.Millisecond); err == nil {
+		t.Fatal("Expected the command to be killed")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Expected the timeout to be enforced, took %s", d)
+	}
+}
+
+func TestPostWebhookRedirect(t *testing.T) {
+	var redirected bool
+	other := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		redirected = true
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	if err := postWebhook(t.Context(), srv.URL, []byte("{}"), time.Second); err == nil || !strings.Contains(err.Error(), "307") {
+		t.Errorf("Expected the redirect to fail the webhook, got %v", err)
+	}
+	if redirected {
+		t.Error("Expected the run report not to be posted to the redirect target")
+	}
+}
@@ -0,0 +1,71 @@
+package rpack
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OrderRPackConfigPacks returns the packs in execution order.
+// Dependencies are executed before the packs depending on them, otherwise
+// the declaration order is kept so the result is deterministic.
+// It fails on duplicate names, unknown dependencies and dependency cycles.
+func OrderRPackConfigPacks(packs []*RPackConfigPack) ([]*RPackConfigPack, error) {
+	byName := make(map[string]*RPackConfigPack, len(packs))
+	for _, p := range packs {
+		if _, ok := byName[p.Name]; ok {
+			return nil, fmt.Errorf("pack %q declared multiple times", p.Name)
+		}
+		byName[p.Name] = p
+	}
+
+	// Number of unresolved dependencies per pack
+	pending := make(map[string]int, len(packs))
+	// Reverse edges: dependency -> packs depending on it
+	dependents := make(map[string][]string, len(packs))
+	for _, p := range packs {
+		seen := make(map[string]struct{})
+		for _, dep := range p.DependsOn {
+			if dep == p.Name {
+				return nil, fmt.Errorf("pack %q depends on itself", p.Name)
+			}
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("pack %q depends on unknown pack %q", p.Name, dep)
+			}
+			if _, ok := seen[dep]; ok {
+				continue
+			}
+			seen[dep] = struct{}{}
+			pending[p.Name]++
+			dependents[dep] = append(dependents[dep], p.Name)
+		}
+	}
+
+	ordered := make([]*RPackConfigPack, 0, len(packs))
+	done := make(map[string]struct{}, len(packs))
+	for len(ordered) < len(packs) {
+		progress := false
+		// Pick the first ready pack in declaration order on every pass
+		for _, p := range packs {
+			if _, ok := done[p.Name]; ok || pending[p.Name] > 0 {
+				continue
+			}
+			ordered = append(ordered, p)
+			done[p.Name] = struct{}{}
+			for _, dependent := range dependents[p.Name] {
+				pending[dependent]--
+			}
+			progress = true
+			break
+		}
+		if !progress {
+			var cyclic []string
+			for _, p := range packs {
+				if _, ok := done[p.Name]; !ok {
+					cyclic = append(cyclic, p.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between packs: %s", strings.Join(cyclic, ","))
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,140 @@
+package rpack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderRPackConfigPacks(t *testing.T) {
+	pack := func(name string, deps ...string) *RPackConfigPack {
+		return &RPackConfigPack{Name: name, Source: "./" + name, DependsOn: deps}
+	}
+	names := func(packs []*RPackConfigPack) []string {
+		var res []string
+		for _, p := range packs {
+			res = append(res, p.Name)
+		}
+		return res
+	}
+
+	tcs := []struct {
+		name     string
+		packs    []*RPackConfigPack
+		expected []string
+		valid    bool
+	}{
+		{
+			name:     "no dependencies keeps declaration order",
+			packs:    []*RPackConfigPack{pack("b"), pack("a"), pack("c")},
+			expected: []string{"b", "a", "c"},
+			valid:    true,
+		},
+		{
+			name:     "dependency runs first",
+			packs:    []*RPackConfigPack{pack("app", "base"), pack("base")},
+			expected: []string{"base", "app"},
+			valid:    true,
+		},
+		{
+			name:     "diamond",
+			packs:    []*RPackConfigPack{pack("d", "b", "c"), pack("c", "a"), pack("b", "a"), pack("a")},
+			expected: []string{"a", "c", "b", "d"},
+			valid:    true,
+		},
+		{
+			name:     "duplicate dependency",
+			packs:    []*RPackConfigPack{pack("b", "a", "a"), pack("a")},
+			expected: []string{"a", "b"},
+			valid:    true,
+		},
+		{
+			name:  "duplicate name",
+			packs: []*RPackConfigPack{pack("a"), pack("a")},
+		},
+		{
+			name:  "unknown dependency",
+			packs: []*RPackConfigPack{pack("a", "missing")},
+		},
+		{
+			name:  "self dependency",
+			packs: []*RPackConfigPack{pack("a", "a")},
+		},
+		{
+			name:  "cycle",
+			packs: []*RPackConfigPack{pack("a", "c"), pack("b", "a"), pack("c", "b")},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ordered, err := OrderRPackConfigPacks(tc.packs)
+			if !tc.valid {
+				if err == nil {
+					t.Fatalf("Expected error, got order %v", names(ordered))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if got := names(ordered); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected order %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRPackConfigValidatePacks(t *testing.T) {
+	tcs := []struct {
+		name   string
+		config *RPackConfig
+		valid  bool
+	}{
+		{
+			name:   "single source",
+			config: &RPackConfig{SchemaVersion: "v1", Source: "./def"},
+			valid:  true,
+		},
+		{
+			name: "packs",
+			config: &RPackConfig{SchemaVersion: "v1", Packs: []*RPackConfigPack{
+				{Name: "base", Source: "./base"},
+				{Name: "app", Source: "./app", DependsOn: []string{"base"}, Config: &RPackConfigConfig{
+					Values: map[string]any{"key": "value"},
+				}},
+			}},
+			valid: true,
+		},
+		{
+			name:   "neither source nor packs",
+			config: &RPackConfig{SchemaVersion: "v1"},
+		},
+		{
+			name: "source and packs",
+			config: &RPackConfig{SchemaVersion: "v1", Source: "./def", Packs: []*RPackConfigPack{
+				{Name: "base", Source: "./base"},
+			}},
+		},
+		{
+			name: "pack without name",
+			config: &RPackConfig{SchemaVersion: "v1", Packs: []*RPackConfigPack{
+				{Source: "./base"},
+			}},
+		},
+		{
+			name: "pack with unknown dependency",
+			config: &RPackConfig{SchemaVersion: "v1", Packs: []*RPackConfigPack{
+				{Name: "app", Source: "./app", DependsOn: []string{"base"}},
+			}},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("Expected valid config, got: %s", err)
+			} else if !tc.valid && err == nil {
+				t.Errorf("Expected invalid config")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package rpack
+
+import (
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// packMeta describes where a pack comes from, scripts read it with rpack.meta().
+type packMeta struct {
+	// source of the definition, empty in --def mode
+	source string
+	// config is the config file relative to the target, empty in --def mode
+	config string
+}
+
+// newPackMeta returns the meta data of a pack of source executed for the config file ci in execPath.
+func newPackMeta(ci *RPackConfigInstance, source, execPath string) packMeta {
+	meta := packMeta{source: source}
+	if rel, err := filepath.Rel(execPath, ci.ConfigFile); err == nil {
+		meta.config = filepath.ToSlash(rel)
+	}
+	return meta
+}
+
+// table returns the value of rpack.meta() for the named pack executing def.
+// The version falls back to the ref of the source, e.g. v1.2.0 of ?ref=v1.2.0.
+func (m packMeta) table(pack string, def *RPackDef) map[string]any {
+	version := def.Version
+	if version == "" {
+		version = sourceRef(m.source)
+	}
+	return map[string]any{
+		"name":    def.Name,
+		"version": version,
+		"pack":    pack,
+		"source":  stripSourceCredentials(m.source),
+		"config":  m.config,
+	}
+}
+
+// sourceRef returns the ref query parameter of a source address, empty if there is none.
+func sourceRef(source string) string {
+	_, query, ok := strings.Cut(source, "?")
+	if !ok {
+		return ""
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return ""
+	}
+	return values.Get("ref")
+}
+
+// stripSourceCredentials removes user and password and all query parameters but ref of a source address,
+// generated files and records must not contain them.
+func stripSourceCredentials(source string) string {
+	return stripURLCredentials(source, "ref")
+}
+
+// stripURLCredentials removes the user info, the fragment and all query parameters except keep of an address,
+// they often hold tokens like the sshkey of git sources. Forced getters like git:: and subdirectories are kept.
+func stripURLCredentials(addr string, keep ...string) string {
+	addr, _, _ = strings.Cut(addr, "#")
+	addr, query, hasQuery := strings.Cut(addr, "?")
+	if scheme, rest, ok := strings.Cut(addr, "://"); ok {
+		end := strings.IndexByte(rest, '/')
+		if end < 0 {
+			end = len(rest)
+		}
+		if at := strings.LastIndex(rest[:end], "@"); at >= 0 {
+			addr = scheme + "://" + rest[at+1:]
+		}
+	}
+	if !hasQuery {
+		return addr
+	}
+	var kept []string
+	for param := range strings.SplitSeq(query, "&") {
+		key, _, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(key); err == nil && slices.Contains(keep, key) {
+			kept = append(kept, param)
+		}
+	}
+	if len(kept) == 0 {
+		return addr
+	}
+	return addr + "?" + strings.Join(kept, "&")
+}
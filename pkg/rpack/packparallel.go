@@ -0,0 +1,149 @@
+package rpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// packExec is the outcome of executing the script of a pack.
+type packExec struct {
+	run *packRun
+	// fs is the filesystem of the script, also set if it failed, nil if the script did not run
+	fs      *RPackFS
+	timings packReportTimings
+	err     error
+	// canceled is set if the pack failed because another pack failed first
+	canceled bool
+}
+
+// execPacks executes the packs with execPack and returns the outcomes in the order of packs,
+// packs that were not executed have no outcome. Up to e.Parallel packs run at once, a pack starts
+// once the packs it depends on are done. The first failure cancels the running packs and no
+// further pack is started. Packs write to their own run directories, conflicting target writes
+// are detected after all packs are done, see packWriteConflicts.
+func (e *Executor) execPacks(ctx context.Context, packs []*RPackConfigPack, execPack func(ctx context.Context, e *Executor, i int) *packExec) []*packExec {
+	results := make([]*packExec, len(packs))
+	if e.Parallel <= 1 || len(packs) < 2 {
+		for i := range packs {
+			results[i] = execPack(ctx, e, i)
+			if results[i].err != nil {
+				break
+			}
+		}
+		return results
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	par := e.synchronized()
+	index := make(map[string]int, len(packs))
+	done := make([]chan struct{}, len(packs))
+	for i, pack := range packs {
+		index[pack.Name] = i
+		done[i] = make(chan struct{})
+	}
+	slots := make(chan struct{}, e.Parallel)
+	var mu sync.Mutex
+	failed := false
+	var wg sync.WaitGroup
+	for i, pack := range packs {
+		wg.Go(func() {
+			defer close(done[i])
+			for _, dep := range pack.DependsOn {
+				<-done[index[dep]]
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+			if ctx.Err() != nil {
+				return
+			}
+			res := execPack(ctx, par, i)
+			mu.Lock()
+			defer mu.Unlock()
+			if res.err != nil {
+				res.canceled = failed
+				failed = true
+				cancel()
+			}
+			results[i] = res
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// packExecError returns the error of the first pack in order that failed on its own, nil if all succeeded.
+func packExecError(results []*packExec) (int, error) {
+	for i, res := range results {
+		if res != nil && res.err != nil && !res.canceled {
+			return i, res.err
+		}
+	}
+	return -1, nil
+}
+
+// synchronized returns a copy of the executor whose progress reporter and file access hook
+// are never called concurrently, for executing packs in parallel.
+func (e *Executor) synchronized() *Executor {
+	par := *e
+	var mu sync.Mutex
+	if e.Progress != nil {
+		par.Progress = &syncProgressReporter{mu: &mu, reporter: e.Progress}
+	}
+	if fn := e.FileAccess; fn != nil {
+		par.FileAccess = func(access *api.FileAccess) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(access)
+		}
+	}
+	return &par
+}
+
+// syncProgressReporter serializes the events of packs executed in parallel.
+type syncProgressReporter struct {
+	mu       *sync.Mutex
+	reporter ProgressReporter
+}
+
+// Progress passes ev on while holding the lock.
+func (r *syncProgressReporter) Progress(ev ProgressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reporter.Progress(ev)
+}
+
+// packWriteConflicts fails if packs write the same target file, listing all such files.
+// It runs after all packs are executed and before anything is applied to the target.
+func packWriteConflicts(runs []*packRun) error {
+	writers := make(map[string][]string)
+	for _, run := range runs {
+		seen := make(map[string]struct{})
+		for _, handle := range run.FS.TargetWriteHandles() {
+			relPath := handle.IndirectTargetPath()
+			if _, ok := seen[relPath]; ok {
+				continue
+			}
+			seen[relPath] = struct{}{}
+			writers[relPath] = append(writers[relPath], fmt.Sprintf("%q", run.Instance.Pack.Name))
+		}
+	}
+	var errs []error
+	for _, relPath := range slices.Sorted(maps.Keys(writers)) {
+		if packs := writers[relPath]; len(packs) > 1 {
+			errs = append(errs, fmt.Errorf("target file %s is written by packs %s", relPath, strings.Join(packs, ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// setupPacksConfig writes a definition per script and a config with a pack for each, packs depend on deps.
+func setupPacksConfig(t *testing.T, scripts map[string]string, deps map[string]string) (config, dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	content := "\"@schema_version\": \"v1\"\npacks:\n"
+	for _, name := range []string{"base", "app", "docs"} {
+		script, ok := scripts[name]
+		if !ok {
+			continue
+		}
+		defDir := filepath.Join(dir, name)
+		if err := os.MkdirAll(defDir, 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		for file, c := range map[string]string{
+			"rpack.yaml": "\"@schema_version\": \"v1\"\nname: \"" + name + "\"\n",
+			"script.lua": "local rpack = require(\"rpack.v1\")\n" + script,
+		} {
+			if err := os.WriteFile(filepath.Join(defDir, file), []byte(c), 0o644); err != nil { //nolint:gosec // test file
+				t.Fatal(err)
+			}
+		}
+		content += "  - name: " + name + "\n    source: \"" + filepath.ToSlash(defDir) + "\"\n"
+		if dep, ok := deps[name]; ok {
+			content += "    depends_on: [" + dep + "]\n"
+		}
+	}
+	config = filepath.Join(dir, "app.rpack.yaml")
+	if err := os.WriteFile(config, []byte(content), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	return config, dir
+}
+
+func TestRunParallelPacks(t *testing.T) {
+	config, dir := setupPacksConfig(t, map[string]string{
+		"base": `rpack.write("./base.txt", "base\n")`,
+		"app":  `rpack.write("./app.txt", "app\n")`,
+		"docs": `rpack.write("./docs.txt", "docs\n")`,
+	}, map[string]string{"app": "base"})
+	var events int
+	res, err := Run(t.Context(), api.RunOptions{ConfigFile: config, Parallel: 3, Hooks: &api.RunHooks{
+		// Not synchronized, the hooks are never called concurrently
+		Progress: func(*api.ProgressEvent) { events++ },
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(res.Files, ",") != "app.txt,base.txt,docs.txt" || events == 0 {
+		t.Fatalf("Expected the files of all packs, got %v after %d events", res.Files, events)
+	}
+	for _, name := range res.Files {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s applied: %v", name, err)
+		}
+	}
+}
+
+func TestRunParallelPacksConflict(t *testing.T) {
+	config, dir := setupPacksConfig(t, map[string]string{
+		"base": `rpack.write("./shared.txt", "base\n") rpack.write("./base.txt", "base\n")`,
+		"app":  `rpack.write("./shared.txt", "app\n") rpack.write("./other.txt", "app\n")`,
+		"docs": `rpack.write("./other.txt", "docs\n")`,
+	}, nil)
+	_, err := Run(t.Context(), api.RunOptions{ConfigFile: config, Parallel: 2})
+	if err == nil || !strings.Contains(err.Error(), `other.txt is written by packs "app", "docs"`) || !strings.Contains(err.Error(), `shared.txt is written by packs "base", "app"`) {
+		t.Fatalf("Expected all conflicting files reported, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "base.txt")); !os.IsNotExist(err) {
+		t.Error("Expected nothing applied on conflicts")
+	}
+}
+
+func TestRunParallelPacksFailure(t *testing.T) {
+	config, _ := setupPacksConfig(t, map[string]string{
+		"base": `rpack.write("./base.txt", "base\n")`,
+		"app":  `rpack.write("./app.txt", "app\n")`,
+		"docs": `error("docs failed")`,
+	}, map[string]string{"app": "base"})
+	_, err := Run(t.Context(), api.RunOptions{ConfigFile: config, Parallel: 2})
+	if err == nil || !strings.Contains(err.Error(), "docs failed") {
+		t.Fatalf("Expected the error of the failed pack, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package rpack
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// patchHunk is a parsed hunk of a unified diff.
+type patchHunk struct {
+	// oldStart is the 1-based line the hunk applies to
+	oldStart int
+	// oldLines are the context and removed lines expected in the content
+	oldLines []string
+	// newLines are the context and added lines replacing oldLines
+	newLines []string
+}
+
+var patchHunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parseUnifiedDiff parses the hunks of a unified diff.
+// File headers and git extended headers before the first hunk are ignored.
+//
+//nolint:gocognit,gocyclo // intentional: line based parser
+func parseUnifiedDiff(diff string) ([]*patchHunk, error) {
+	var hunks []*patchHunk
+	var cur *patchHunk
+	var oldCount, newCount, wantOld, wantNew int
+	// last points to the slices the previous line was added to, for "\ No newline at end of file"
+	var last []*[]string
+
+	finish := func() error {
+		if cur == nil {
+			return nil
+		}
+		if oldCount != wantOld || newCount != wantNew {
+			return fmt.Errorf("malformed hunk %d: expected %d old and %d new lines, got %d and %d", len(hunks), wantOld, wantNew, oldCount, newCount)
+		}
+		cur = nil
+		return nil
+	}
+
+	for line := range strings.Lines(diff) {
+		if cur == nil || (oldCount == wantOld && newCount == wantNew) {
+			if m := patchHunkHeader.FindStringSubmatch(line); m != nil {
+				if err := finish(); err != nil {
+					return nil, err
+				}
+				cur = &patchHunk{}
+				cur.oldStart, _ = strconv.Atoi(m[1])
+				wantOld, wantNew = 1, 1
+				if m[2] != "" {
+					wantOld, _ = strconv.Atoi(m[2])
+				}
+				if m[4] != "" {
+					wantNew, _ = strconv.Atoi(m[4])
+				}
+				oldCount, newCount = 0, 0
+				last = nil
+				hunks = append(hunks, cur)
+				continue
+			}
+			if cur == nil || !strings.HasPrefix(line, `\`) {
+				// Headers, trailing garbage or the next file
+				if err := finish(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		body := line
+		if len(line) > 0 {
+			body = line[1:]
+		}
+		switch {
+		case line == "\n" || line == "\r\n":
+			// Editors strip the space of empty context lines
+			cur.oldLines = append(cur.oldLines, line)
+			cur.newLines = append(cur.newLines, line)
+			oldCount++
+			newCount++
+			last = []*[]string{&cur.oldLines, &cur.newLines}
+		case line[0] == ' ':
+			cur.oldLines = append(cur.oldLines, body)
+			cur.newLines = append(cur.newLines, body)
+			oldCount++
+			newCount++
+			last = []*[]string{&cur.oldLines, &cur.newLines}
+		case line[0] == '-':
+			cur.oldLines = append(cur.oldLines, body)
+			oldCount++
+			last = []*[]string{&cur.oldLines}
+		case line[0] == '+':
+			cur.newLines = append(cur.newLines, body)
+			newCount++
+			last = []*[]string{&cur.newLines}
+		case line[0] == '\\':
+			for _, lines := range last {
+				l := *lines
+				l[len(l)-1] = strings.TrimSuffix(strings.TrimSuffix(l[len(l)-1], "\n"), "\r")
+			}
+		default:
+			return nil, fmt.Errorf("malformed hunk %d: unexpected line %q", len(hunks), strings.TrimRight(line, "\r\n"))
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("diff contains no hunks")
+	}
+	return hunks, nil
+}
+
+// ApplyUnifiedDiff applies a unified diff to content.
+// Hunks whose context moved are searched for nearby, like patch does with offsets,
+// but context lines must match exactly.
+func ApplyUnifiedDiff(content []byte, diff string) ([]byte, error) {
+	hunks, err := parseUnifiedDiff(diff)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(string(content))
+	var out []string
+	pos := 0
+	for i, h := range hunks {
+		expected := h.oldStart - 1
+		if len(h.oldLines) == 0 {
+			// Pure additions name the line they follow
+			expected = h.oldStart
+		}
+		at, ok := findHunk(lines, h.oldLines, pos, expected)
+		if !ok {
+			return nil, fmt.Errorf("hunk %d does not apply at line %d", i+1, h.oldStart)
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, h.newLines...)
+		pos = at + len(h.oldLines)
+	}
+	out = append(out, lines[pos:]...)
+	return []byte(strings.Join(out, "")), nil
+}
+
+// findHunk returns the index of old in lines at or after from,
+// preferring the position closest to expected.
+func findHunk(lines, old []string, from, expected int) (int, bool) {
+	last := len(lines) - len(old)
+	matches := func(at int) bool {
+		if at < from || at > last {
+			return false
+		}
+		for j, l := range old {
+			if lines[at+j] != l {
+				return false
+			}
+		}
+		return true
+	}
+	for offset := 0; expected-offset >= from || expected+offset <= last; offset++ {
+		if matches(expected + offset) {
+			return expected + offset, true
+		}
+		if offset > 0 && matches(expected-offset) {
+			return expected - offset, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,45 @@
+package rpack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	oldContent := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	newContent := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk"
+	diff := UnifiedDiff("a/x", "b/x", []byte(oldContent), []byte(newContent))
+
+	got, err := ApplyUnifiedDiff([]byte(oldContent), diff)
+	if err != nil {
+		t.Fatalf("ApplyUnifiedDiff failed: %s", err)
+	}
+	if string(got) != newContent {
+		t.Errorf("Expected %q, got %q", newContent, got)
+	}
+
+	// Context moved by two lines
+	got, err = ApplyUnifiedDiff([]byte("x\ny\n"+oldContent), diff)
+	if err != nil {
+		t.Fatalf("ApplyUnifiedDiff with offset failed: %s", err)
+	}
+	if string(got) != "x\ny\n"+newContent {
+		t.Errorf("Unexpected content with offset: %q", got)
+	}
+
+	if _, err = ApplyUnifiedDiff([]byte(strings.Replace(oldContent, "c", "C", 1)), diff); err == nil || !strings.Contains(err.Error(), "hunk 1 does not apply") {
+		t.Errorf("Expected error for mismatching context, got %v", err)
+	}
+	if _, err = ApplyUnifiedDiff([]byte(oldContent), "not a diff"); err == nil {
+		t.Errorf("Expected error for diff without hunks")
+	}
+	if _, err = ApplyUnifiedDiff([]byte(oldContent), "@@ -1,2 +1,2 @@\n a\n-b\n"); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("Expected error for truncated hunk, got %v", err)
+	}
+
+	// Additions to an empty file
+	got, err = ApplyUnifiedDiff(nil, "--- /dev/null\n+++ b/x\n@@ -0,0 +1,2 @@\n+one\n+two\n")
+	if err != nil || string(got) != "one\ntwo\n" {
+		t.Errorf("Unexpected result for addition: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,132 @@
+package rpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// PlanAction describes what an apply would do with a target file.
+type PlanAction string
+
+// Plan action constants.
+const (
+	PlanActionAdd       PlanAction = "add"
+	PlanActionModify    PlanAction = "modify"
+	PlanActionUnchanged PlanAction = "unchanged"
+	PlanActionRemove    PlanAction = "remove"
+)
+
+// PlanCurrentSchemaVersion is the schema version of the plan format.
+const PlanCurrentSchemaVersion = "v1"
+
+// Plan is a machine-readable description of the changes
+// a future apply would perform on the target.
+type Plan struct {
+	SchemaVersion string      `json:"@schema_version"`
+	Files         []*PlanFile `json:"files"`
+	// Warnings and annotations reported by the scripts
+	Annotations []*Annotation `json:"annotations,omitempty"`
+	// Protected lists paths the packs wrote or would remove that are protected by the config
+	Protected []string `json:"protected,omitempty"`
+}
+
+// PlanFile is a single planned change of a target file.
+type PlanFile struct {
+	// Path relative to the target directory
+	Path string `json:"path"`
+	// Pack that writes the file, only set for multi-pack configs
+	Pack   string     `json:"pack,omitempty"`
+	Action PlanAction `json:"action"`
+	// Managed reports if the existing file is tracked by the lockfile
+	Managed bool `json:"managed"`
+	// Checksum of the existing target file, empty if it does not exist
+	OldSha string `json:"old_sha,omitempty"`
+	// Checksum of the generated file, empty for removals
+	NewSha string `json:"new_sha,omitempty"`
+	// Binary files are not diffed
+	Binary bool `json:"binary,omitempty"`
+	// FormattingOnly marks unchanged files whose content differs
+	// only in ways ignored by the diff options
+	FormattingOnly bool `json:"formatting_only,omitempty"`
+	// Unified diff from the existing to the generated content
+	Diff string `json:"diff,omitempty"`
+}
+
+// Changed reports if applying the plan modifies the target.
+func (p *Plan) Changed() bool {
+	for _, f := range p.Files {
+		if f.Action != PlanActionUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteFile writes the plan as JSON to the given path.
+func (p *Plan) WriteFile(name string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	if err := os.WriteFile(name, append(b, '\n'), 0o644); err != nil { //nolint:gosec // standard permissions for plan output
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// isBinary reports if content looks like binary data.
+func isBinary(b []byte) bool {
+	return bytes.IndexByte(b, 0) >= 0
+}
+
+// readTargetFile reads an existing target file, exists is false if it does not exist.
+func readTargetFile(name string) (content []byte, exists bool, err error) {
+	b, err := os.ReadFile(name) //nolint:gosec // path constructed from exec path and lockfile entry
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+// BuildPlan compares the generated files against the current target in execPath.
+// Files tracked by oldLock that are no longer generated are planned for removal.
+// Files differing only in ways ignored by opts are planned as unchanged.
+func BuildPlan(execPath string, files []*packTargetFile, oldLock *RPackLockFile, opts DiffOptions) (*Plan, error) {
+	diffs, err := collectDiffFiles(execPath, files, oldLock, opts)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{
+		SchemaVersion: PlanCurrentSchemaVersion,
+		Files:         []*PlanFile{},
+	}
+	for _, d := range diffs {
+		pf := &PlanFile{
+			Path:    d.Path,
+			Pack:    d.Pack,
+			Action:  d.Action,
+			Managed: d.Managed,
+			Binary:  d.Binary(),
+
+			FormattingOnly: d.FormattingOnly,
+		}
+		if d.Action != PlanActionAdd {
+			pf.OldSha = util.Sha256String(string(d.Old))
+		}
+		if d.Action != PlanActionRemove {
+			pf.NewSha = util.Sha256String(string(d.New))
+		}
+		if !pf.Binary && d.Action != PlanActionUnchanged {
+			pf.Diff = d.UnifiedDiff()
+		}
+		plan.Files = append(plan.Files, pf)
+	}
+	return plan, nil
+}
@@ -0,0 +1,108 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildPlan(t *testing.T) {
+	execPath := t.TempDir()
+	runPath := t.TempDir()
+
+	writeFile := func(base, name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(base, name), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+	writeFile(execPath, "same.txt", "same\n")
+	writeFile(execPath, "changed.txt", "old\n")
+	writeFile(execPath, "stale.txt", "stale\n")
+	writeFile(runPath, "same.txt", "same\n")
+	writeFile(runPath, "changed.txt", "new\n")
+	writeFile(runPath, "added.txt", "added\n")
+
+	var files []*packTargetFile
+	for _, name := range []string{"same.txt", "changed.txt", "added.txt"} {
+		files = append(files, &packTargetFile{
+			ControlledFile: &ControlledFile{Path: name, AbsPath: filepath.Join(runPath, name)},
+			Sha:            "sha-" + name,
+		})
+	}
+	oldLock := NewRPackLockFile()
+	oldLock.AddFile("changed.txt", "")
+	oldLock.AddFile("stale.txt", "")
+	oldLock.AddFile("gone.txt", "")
+
+	plan, err := BuildPlan(execPath, files, oldLock, DiffOptions{})
+	if err != nil {
+		t.Fatalf("BuildPlan failed: %s", err)
+	}
+	if !plan.Changed() {
+		t.Errorf("Expected plan to report changes")
+	}
+
+	expected := map[string]PlanAction{
+		"added.txt":   PlanActionAdd,
+		"changed.txt": PlanActionModify,
+		"same.txt":    PlanActionUnchanged,
+		"stale.txt":   PlanActionRemove,
+	}
+	if len(plan.Files) != len(expected) {
+		t.Fatalf("Expected %d planned files, got %d", len(expected), len(plan.Files))
+	}
+	for i, f := range plan.Files {
+		if i > 0 && plan.Files[i-1].Path > f.Path {
+			t.Errorf("Plan files not sorted: %s before %s", plan.Files[i-1].Path, f.Path)
+		}
+		if expected[f.Path] != f.Action {
+			t.Errorf("Expected action %s for %s, got %s", expected[f.Path], f.Path, f.Action)
+		}
+		switch f.Path {
+		case "changed.txt":
+			if !f.Managed || f.OldSha == "" || f.Diff == "" {
+				t.Errorf("Expected managed file with old sha and diff: %+v", f)
+			}
+		case "same.txt":
+			if f.Managed || f.Diff != "" {
+				t.Errorf("Expected unmanaged file without diff: %+v", f)
+			}
+		case "stale.txt":
+			if f.NewSha != "" || f.Diff == "" {
+				t.Errorf("Expected removal with diff: %+v", f)
+			}
+		}
+	}
+}
+
+func TestBuildPlanSemantic(t *testing.T) {
+	execPath := t.TempDir()
+	runPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(execPath, "cfg.json"), []byte("{\"a\": 1, \"b\": 2}\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(runPath, "cfg.json"), []byte("{\n  \"b\": 2,\n  \"a\": 1\n}\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	files := []*packTargetFile{{ControlledFile: &ControlledFile{Path: "cfg.json", AbsPath: filepath.Join(runPath, "cfg.json")}}}
+
+	plan, err := BuildPlan(execPath, files, NewRPackLockFile(), DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Files[0].Action != PlanActionModify {
+		t.Errorf("Expected textual modification, got %s", plan.Files[0].Action)
+	}
+
+	plan, err = BuildPlan(execPath, files, NewRPackLockFile(), DiffOptions{Semantic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := plan.Files[0]; f.Action != PlanActionUnchanged || !f.FormattingOnly || f.Diff != "" || f.OldSha == f.NewSha {
+		t.Errorf("Expected formatting only change: %+v", f)
+	}
+	if plan.Changed() {
+		t.Errorf("Expected plan without changes")
+	}
+}
@@ -0,0 +1,163 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blang/rpack/pkg/api"
+	"github.com/blang/rpack/pkg/lockfile"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// DefaultPostApplyTimeout limits the run time of a post-apply command without timeout.
+const DefaultPostApplyTimeout = 10 * time.Minute
+
+// name returns the name of the command, the command line if none is set.
+func (c *RPackConfigPostApply) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return strings.Join(c.Command, " ")
+}
+
+// timeout returns the parsed timeout of the command.
+func (c *RPackConfigPostApply) timeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return DefaultPostApplyTimeout, nil
+	}
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q of post-apply command %q: %w", c.Timeout, c.name(), ErrValidation)
+	}
+	return d, nil
+}
+
+// checkPostApplyCommands checks that the programs of all commands are allowed and their timeouts valid.
+func checkPostApplyCommands(cmds []*RPackConfigPostApply, allow []string) error {
+	for _, c := range cmds {
+		if len(c.Command) == 0 {
+			return fmt.Errorf("post-apply command %q has no program: %w", c.name(), ErrValidation)
+		}
+		if !slices.Contains(allow, c.Command[0]) {
+			return fmt.Errorf("program %q of post-apply command %q is not allowed, allow it with --allow-post-apply %s", c.Command[0], c.name(), c.Command[0])
+		}
+		if _, err := c.timeout(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPostApplyCommands runs the commands in dir one after another and stops at the first failure.
+// The results of all commands run are returned, including the failed one.
+func runPostApplyCommands(ctx context.Context, log *slog.Logger, cmds []*RPackConfigPostApply, dir string) ([]*api.CommandResult, error) {
+	var results []*api.CommandResult
+	for _, c := range cmds {
+		timeout, err := c.timeout()
+		if err != nil {
+			return results, err
+		}
+		log.Info("Running post-apply command", "name", c.name())
+		start := time.Now()
+		cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(cmdCtx, c.Command[0], c.Command[1:]...) //nolint:gosec // intentional: allowlisted command from config
+		cmd.Dir = dir
+		cmd.WaitDelay = commandWaitDelay
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		err = cmd.Run()
+		timedOut := errors.Is(cmdCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		res := &api.CommandResult{Name: c.name(), Output: out.String(), DurationMs: time.Since(start).Milliseconds()}
+		results = append(results, res)
+		log.Info("Post-apply command finished", "name", res.Name, "duration", time.Since(start), "output", res.Output)
+		if timedOut {
+			res.Error = fmt.Sprintf("timed out after %s", timeout)
+			return results, fmt.Errorf("post-apply command failed: %s: %s, the apply is kept", c.name(), res.Error)
+		}
+		if err != nil {
+			res.Error = err.Error()
+			return results, fmt.Errorf("post-apply command failed: %s: %w, the apply is kept\n%s", c.name(), err, tailLines(res.Output, verifyOutputLines))
+		}
+	}
+	return results, nil
+}
+
+// appliedChecksums returns the checksums of the files of the lockfile entries below dir,
+// calculated like the entries with their algorithm and managed blocks. Missing files are left out.
+func (f *RPackLockFile) appliedChecksums(dir string) (map[string]string, error) {
+	sums := make(map[string]string, len(f.Files))
+	for _, file := range f.Files {
+		algorithm := file.Algorithm
+		if algorithm == "" {
+			algorithm = lockfile.SHA256
+		}
+		name := util.LongPath(filepath.Join(dir, file.Path))
+		var sum string
+		var err error
+		if len(file.Blocks) > 0 {
+			sum, err = lockfile.ChecksumBlocks(algorithm, name, file.Blocks)
+		} else {
+			sum, err = lockfile.ChecksumWith(algorithm, name)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate checksum of: %s: %w", file.Path, err)
+		}
+		sums[file.Path] = sum
+	}
+	return sums, nil
+}
+
+// recordChanged updates the checksums of the entries whose files changed since before was taken,
+// so files rewritten by post-apply commands are not reported as modified outside of rpack.
+// Merged files in generated keep the checksum of their generated content. It returns the updated paths.
+func (f *RPackLockFile) recordChanged(dir string, before map[string]string, generated map[string][]byte) ([]string, error) {
+	after, err := f.appliedChecksums(dir)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for _, file := range f.Files {
+		sum, exists := after[file.Path]
+		if _, merged := generated[file.Path]; !exists || merged || sum == before[file.Path] {
+			continue
+		}
+		file.Sha = sum
+		changed = append(changed, file.Path)
+	}
+	return changed, nil
+}
+
+// runPostApply runs the post-apply commands in execPath and adds their results to res.
+// Files the commands change are recorded in the lockfile, which is written again.
+func (e *Executor) runPostApply(ctx context.Context, cmds []*RPackConfigPostApply, execPath, lockFilePath string, lock *RPackLockFile, generated map[string][]byte, res *api.RunResult) error {
+	before, err := lock.appliedChecksums(execPath)
+	if err != nil {
+		return err
+	}
+	res.PostApply, err = runPostApplyCommands(ctx, e.log(), cmds, execPath)
+	changed, recordErr := lock.recordChanged(execPath, before, generated)
+	if recordErr != nil {
+		return errors.Join(err, recordErr)
+	}
+	if len(changed) > 0 {
+		e.log().Info("Post-apply commands changed managed files", "files", changed)
+		if writeErr := lock.WriteFile(lockFilePath); writeErr != nil {
+			return errors.Join(err, fmt.Errorf("could not write lockfile to %s: %w", lockFilePath, writeErr))
+		}
+	}
+	return err
+}
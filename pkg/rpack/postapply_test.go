@@ -0,0 +1,85 @@
+package rpack
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// TestPostApplyHelperProcess is run as post-apply command by the tests below.
+func TestPostApplyHelperProcess(_ *testing.T) {
+	switch os.Getenv("RPACK_POST_APPLY_HELPER") {
+	case "format":
+		b, _ := os.ReadFile("out.txt")
+		_ = os.WriteFile("out.txt", []byte(strings.ToUpper(string(b))), 0o644) //nolint:gosec // test file
+		_, _ = os.Stdout.WriteString("formatted out.txt\n")
+		os.Exit(0)
+	case "fail":
+		_, _ = os.Stderr.WriteString("formatter crashed\n")
+		os.Exit(1)
+	}
+}
+
+func TestRunPostApply(t *testing.T) {
+	t.Setenv("RPACK_POST_APPLY_HELPER", "format")
+	helper := filepath.ToSlash(os.Args[0])
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"new\\n\")\n",
+		"post_apply:\n  - name: fmt\n    command: [\""+helper+"\", \"-test.run=^TestPostApplyHelperProcess$\"]\n")
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err == nil || !strings.Contains(err.Error(), "--allow-post-apply") {
+		t.Fatalf("Expected not allowed program to fail, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "out.txt")); !os.IsNotExist(err) {
+		t.Fatal("Expected nothing to be applied")
+	}
+
+	res, err := Run(t.Context(), api.RunOptions{ConfigFile: config, AllowPostApply: []string{helper}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.PostApply) != 1 || res.PostApply[0].Name != "fmt" || !strings.Contains(res.PostApply[0].Output, "formatted out.txt") {
+		t.Fatalf("Expected the output of the command in the result, got %+v", res.PostApply)
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "NEW\n" { //nolint:gosec // test file
+		t.Fatalf("Expected the command to run in the target, got %q", b)
+	}
+	// The lockfile records the formatted file, it is not modified outside of rpack
+	ci, err := LoadRPackConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if integrity, err := ci.LockFile.CheckIntegrity(workDir); err != nil || len(integrity.Modified) > 0 {
+		t.Fatalf("Expected the lockfile to match the formatted file, got %+v, %v", integrity, err)
+	}
+
+	// A failure keeps the apply and is reported with the output, --no-post-apply skips the commands
+	t.Setenv("RPACK_POST_APPLY_HELPER", "fail")
+	res, err = Run(t.Context(), api.RunOptions{ConfigFile: config, AllowPostApply: []string{helper}})
+	if err == nil || !strings.Contains(err.Error(), "formatter crashed") || len(res.PostApply) != 1 || res.PostApply[0].Error == "" {
+		t.Fatalf("Expected the failed command reported, got %+v, %v", res, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "new\n" { //nolint:gosec // test file
+		t.Errorf("Expected the apply to be kept, got %q", b)
+	}
+	if res, err = Run(t.Context(), api.RunOptions{ConfigFile: config, NoPostApply: true}); err != nil || len(res.PostApply) != 0 {
+		t.Fatalf("Expected --no-post-apply to skip the commands, got %+v, %v", res, err)
+	}
+}
+
+func TestRunPostApplyCommandsTimeout(t *testing.T) {
+	t.Setenv("RPACK_VERIFY_HELPER", "orphan")
+	cmds := []*RPackConfigPostApply{{Name: "orphan", Command: []string{os.Args[0], "-test.run=^TestVerifyHelperProcess$"}, Timeout: "100ms"}}
+	start := time.Now()
+	_, err := runPostApplyCommands(t.Context(), slog.New(slog.DiscardHandler), cmds, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected timeout, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Expected the timeout to be enforced, took %s", d)
+	}
+}
@@ -0,0 +1,152 @@
+package rpack
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Preview collects the files of a dry-run and serves them over HTTP with a file browser
+// and a diff view against the target. Use it as DiffRenderer of a dry-run, then serve it.
+//
+//	/            lists all files with their planned action
+//	/files/<p>   serves the generated content of p, relative links between files work
+//	/diff/<p>    shows the diff of p against the target
+type Preview struct {
+	mu    sync.RWMutex
+	files []*DiffFile
+}
+
+// Check Preview satisfies DiffRenderer and http.Handler interfaces
+var (
+	_ = DiffRenderer(&Preview{})
+	_ = http.Handler(&Preview{})
+)
+
+// Render records the file for the preview, nothing is written to w.
+func (p *Preview) Render(_ context.Context, _ io.Writer, f *DiffFile) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files = append(p.files, f)
+	return nil
+}
+
+// rendersUnchanged makes the dry-run pass unchanged files, they are browsable as well.
+func (p *Preview) rendersUnchanged() bool {
+	return true
+}
+
+// file returns the recorded file with the path relative to the target, nil if there is none.
+func (p *Preview) file(name string) *DiffFile {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	idx := slices.IndexFunc(p.files, func(f *DiffFile) bool { return f.Path == name })
+	if idx < 0 {
+		return nil
+	}
+	return p.files[idx]
+}
+
+func (p *Preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		p.serveIndex(w)
+	case strings.HasPrefix(r.URL.Path, "/files/"):
+		f := p.file(strings.TrimPrefix(r.URL.Path, "/files/"))
+		if f == nil || f.Action == PlanActionRemove {
+			http.NotFound(w, r)
+			return
+		}
+		contentType := mime.TypeByExtension(path.Ext(f.Path))
+		if contentType == "" {
+			contentType = http.DetectContentType(f.New)
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(f.New)
+	case strings.HasPrefix(r.URL.Path, "/diff/"):
+		f := p.file(strings.TrimPrefix(r.URL.Path, "/diff/"))
+		if f == nil {
+			http.NotFound(w, r)
+			return
+		}
+		p.serveDiff(w, f)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var previewIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>rpack preview</title>` + previewStyle + `</head>
+<body><h1>rpack preview</h1>
+<table>
+<tr><th>File</th><th>Pack</th><th>Action</th><th></th></tr>
+{{- range .}}
+<tr><td>{{if ne .Action "remove"}}<a href="/files/{{.Path}}">{{.Path}}</a>{{else}}{{.Path}}{{end}}</td><td>{{.Pack}}</td><td class="{{.Action}}">{{.Action}}{{if .FormattingOnly}} (formatting){{end}}</td><td><a href="/diff/{{.Path}}">diff</a></td></tr>
+{{- end}}
+</table>
+</body></html>
+`))
+
+var previewDiffTemplate = template.Must(template.New("diff").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Path}} - rpack preview</title>` + previewStyle + `</head>
+<body><p><a href="/">All files</a></p><h1>{{.Path}}</h1>
+{{- if .Binary}}<p>Binary files differ</p>
+{{- else if not .Lines}}<p>No changes</p>
+{{- else}}<pre>
+{{- range .Lines}}<span class="{{.Class}}">{{.Text}}</span>
+{{end}}</pre>{{end}}
+</body></html>
+`))
+
+const previewStyle = `<style>
+body { font-family: sans-serif; margin: 2em; }
+td, th { padding: 0.2em 1em; text-align: left; }
+pre { background: #f6f8fa; padding: 1em; }
+.add, .added { color: #1a7f37; } .remove, .removed { color: #cf222e; } .modify, .hunk { color: #0969da; }
+</style>`
+
+// previewDiffLine is a line of a unified diff with its CSS class.
+type previewDiffLine struct {
+	Class string
+	Text  string
+}
+
+func (p *Preview) serveIndex(w http.ResponseWriter) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = previewIndexTemplate.Execute(w, p.files)
+}
+
+func (p *Preview) serveDiff(w http.ResponseWriter, f *DiffFile) {
+	var lines []previewDiffLine
+	if !f.Binary() {
+		for _, line := range strings.Split(strings.TrimSuffix(f.UnifiedDiff(), "\n"), "\n") {
+			class := ""
+			switch {
+			case line == "":
+				continue
+			case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			case strings.HasPrefix(line, "@@"):
+				class = "hunk"
+			case strings.HasPrefix(line, "+"):
+				class = "added"
+			case strings.HasPrefix(line, "-"):
+				class = "removed"
+			}
+			lines = append(lines, previewDiffLine{Class: class, Text: line})
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = previewDiffTemplate.Execute(w, struct {
+		Path   string
+		Binary bool
+		Lines  []previewDiffLine
+	}{f.Path, f.Binary(), lines})
+}
@@ -0,0 +1,66 @@
+package rpack
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	script := `rpack.write("./index.html", "<a href=\"docs/a.md\">a</a>")
+rpack.write("./docs/a.md", "new\n")
+rpack.write("./same.txt", "same\n")
+`
+	config, workDir := setupRunConfig(t, script, "")
+	for name, content := range map[string]string{"docs/a.md": "old\n", "same.txt": "same\n"} {
+		p := filepath.Join(workDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+
+	preview := &Preview{}
+	e := &Executor{DryRun: true, DiffRenderer: preview, Force: true}
+	if err := e.ExecRPack(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(preview)
+	defer srv.Close()
+
+	get := func(p string) (int, string, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + p) //nolint:noctx // test server
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(b)
+	}
+
+	_, _, index := get("/")
+	for _, want := range []string{`href="/files/index.html"`, `href="/diff/docs/a.md"`, "same.txt", ">add<", ">modify<", ">unchanged<"} {
+		if !strings.Contains(index, want) {
+			t.Errorf("Expected index to contain %s, got %s", want, index)
+		}
+	}
+	if code, contentType, body := get("/files/index.html"); code != http.StatusOK || !strings.HasPrefix(contentType, "text/html") || !strings.Contains(body, "docs/a.md") {
+		t.Errorf("Expected generated HTML, got %d %s %s", code, contentType, body)
+	}
+	if _, _, body := get("/diff/docs/a.md"); !strings.Contains(body, `<span class="removed">-old</span>`) || !strings.Contains(body, `<span class="added">&#43;new</span>`) {
+		t.Errorf("Expected diff view, got %s", body)
+	}
+	if _, _, body := get("/diff/same.txt"); !strings.Contains(body, "No changes") {
+		t.Errorf("Expected unchanged file, got %s", body)
+	}
+	if code, _, _ := get("/files/missing.txt"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing file, got %d", code)
+	}
+}
@@ -0,0 +1,69 @@
+package rpack
+
+// ProgressPhase names a phase of a run reported to a ProgressReporter.
+type ProgressPhase string
+
+// Phases reported to a ProgressReporter, in the order of a run.
+const (
+	// ProgressPhaseFetch fetches the definition of a pack, Total is 1
+	ProgressPhaseFetch ProgressPhase = "fetch"
+	// ProgressPhaseExec runs the script of a pack, Current counts writes to the target, Total is unknown
+	ProgressPhaseExec ProgressPhase = "exec"
+	// ProgressPhaseChecksum calculates the checksums of the generated files
+	ProgressPhaseChecksum ProgressPhase = "checksum"
+	// ProgressPhaseTransfer moves the generated files to the target
+	ProgressPhaseTransfer ProgressPhase = "transfer"
+)
+
+// ProgressEvent reports the progress of a phase.
+type ProgressEvent struct {
+	Phase ProgressPhase
+	// Pack is the name of the pack, empty for single source configs and phases covering all packs
+	Pack string
+	// Current is the number of processed items
+	Current int
+	// Total is the number of items, 0 if unknown
+	Total int
+	// Item is the source or file being processed, optional
+	Item string
+	// Done is set on the last event of a phase
+	Done bool
+}
+
+// ProgressReporter receives the progress of a run, e.g. to render a progress bar.
+// Events are sent from the goroutine executing the run, or the ones executing packs in parallel,
+// but never concurrently. Implementations need to return quickly and throttle rendering themselves.
+type ProgressReporter interface {
+	Progress(ev ProgressEvent)
+}
+
+// reportProgress sends ev to r, r may be nil.
+func reportProgress(r ProgressReporter, ev ProgressEvent) {
+	if r != nil {
+		r.Progress(ev)
+	}
+}
+
+// progressFSHook reports target writes of a script as progress of the exec phase.
+type progressFSHook struct {
+	reporter ProgressReporter
+	pack     string
+	writes   int
+}
+
+// Check progressFSHook satisfies FSAccessHook interface
+var _ = FSAccessHook(&progressFSHook{})
+
+func (p *progressFSHook) Read(FSHandle) error    { return nil }
+func (p *progressFSHook) ReadDir(FSHandle) error { return nil }
+func (p *progressFSHook) Stat(FSHandle) error    { return nil }
+func (p *progressFSHook) Remove(FSHandle) error  { return nil }
+
+// Write reports writes to the target.
+func (p *progressFSHook) Write(h FSHandle) error {
+	if h.Resolver() == TargetResolver {
+		p.writes++
+		p.reporter.Progress(ProgressEvent{Phase: ProgressPhaseExec, Pack: p.pack, Current: p.writes, Item: h.FriendlyPath()})
+	}
+	return nil
+}
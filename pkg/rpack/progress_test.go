@@ -0,0 +1,50 @@
+package rpack
+
+import (
+	"reflect"
+	"testing"
+)
+
+// progressRecorder records the done events of a run.
+type progressRecorder struct {
+	done   []ProgressEvent
+	events int
+}
+
+func (r *progressRecorder) Progress(ev ProgressEvent) {
+	r.events++
+	if ev.Done {
+		ev.Item = ""
+		r.done = append(r.done, ev)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	script := `for i = 1, 3 do
+	rpack.write("./out" .. i .. ".txt", "content")
+end
+rpack.write("./out1.txt", "again")
+`
+	config, _ := setupRunConfig(t, script, "")
+	ci, err := LoadRPackConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &progressRecorder{}
+	e := &Executor{Progress: r}
+	if err = e.ExecRPackConfig(t.Context(), ci); err != nil {
+		t.Fatal(err)
+	}
+	expected := []ProgressEvent{
+		{Phase: ProgressPhaseFetch, Current: 1, Total: 1, Done: true},
+		{Phase: ProgressPhaseExec, Current: 4, Total: 4, Done: true},
+		{Phase: ProgressPhaseChecksum, Current: 3, Total: 3, Done: true},
+		{Phase: ProgressPhaseTransfer, Current: 3, Total: 3, Done: true},
+	}
+	if !reflect.DeepEqual(r.done, expected) {
+		t.Errorf("Expected done events %+v, got %+v", expected, r.done)
+	}
+	if r.events <= len(expected) {
+		t.Errorf("Expected intermediate events, got %d events", r.events)
+	}
+}
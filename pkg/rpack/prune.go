@@ -0,0 +1,111 @@
+package rpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blang/rpack/pkg/api"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// Prune executes the rpack config like a dry-run and removes the target files tracked by the lockfile
+// that the packs no longer generate, e.g. after files were dropped from a definition.
+// No generated file is written, the lockfile only loses the pruned files.
+// With DryRun the files are only reported. It returns the pruned paths, sorted.
+func (e *Executor) Prune(ctx context.Context, name string) ([]string, error) {
+	ci, err := e.loader().LoadRPackConfig(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not load rpack config: %s: %w", name, err)
+	}
+	run := *e
+	run.prune = true
+	run.OutputDir = ""
+	res, err := run.runConfig(ctx, ci)
+	if err != nil {
+		return nil, err
+	}
+	return res.Removed, nil
+}
+
+// pruneFiles removes the files of oldLock missing from the generated files and drops them from
+// the lockfile of ci, see Prune. Removed files modified outside of rpack need Force.
+func (e *Executor) pruneFiles(ci *RPackConfigInstance, execPath string, files []*packTargetFile, oldLock *RPackLockFile, res *api.RunResult) (*api.RunResult, error) {
+	generated := NewRPackLockFile()
+	for _, f := range files {
+		generated.AddPackFile(f.Pack, f.Path, f.Sha)
+	}
+	pruned := generated.Changes(oldLock).Removed
+	slices.Sort(pruned)
+	res.Removed = pruned
+	if len(pruned) == 0 {
+		e.log().Info("No files to prune")
+		return res, nil
+	}
+
+	integrity, err := oldLock.CheckIntegrity(execPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check lockfile integrity: %w", err)
+	}
+	var modified []string
+	for _, p := range integrity.Modified {
+		if slices.Contains(pruned, p) {
+			modified = append(modified, p)
+		}
+	}
+	if len(modified) > 0 {
+		modFilesStr := strings.Join(modified, ",")
+		e.log().Warn("Some files to prune were modified outside of rpack", "files", modFilesStr)
+		if !e.Force {
+			return nil, fmt.Errorf("some files to prune were modified outside of rpack, use force flag to ignore: %s: %w", modFilesStr, ErrLockModified)
+		}
+	}
+	if e.DryRun {
+		e.log().Info("Files no longer generated, would prune", "files", pruned)
+		return res, nil
+	}
+
+	tx, err := newApplyTransaction(execPath, e.log())
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pruned {
+		exists, err := util.FileExists(util.LongPath(filepath.Join(execPath, p)))
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("could not check file to prune: %s: %w", p, err), tx.rollback())
+		}
+		if !exists {
+			e.log().Warn("File to prune does no longer exist, ignoring", "file", p)
+			continue
+		}
+		if blocks := ci.LockFile.fileBlocks(p); len(blocks) > 0 {
+			err = tx.removeBlocks(p, blocks)
+		} else {
+			err = tx.remove(p)
+		}
+		if err != nil {
+			return nil, errors.Join(err, tx.rollback())
+		}
+	}
+
+	lock := &RPackLockFile{SchemaVersion: ci.LockFile.SchemaVersion, Files: []*RPackLockFileFile{}}
+	for _, f := range ci.LockFile.Files {
+		if !slices.Contains(pruned, f.Path) {
+			lock.Files = append(lock.Files, f)
+		}
+	}
+	if err = lock.WriteFile(ci.LockFilePath); err != nil {
+		return nil, errors.Join(fmt.Errorf("could not write lockfile to %s: %w", ci.LockFilePath, err), tx.rollback())
+	}
+	if err = tx.commit(); err != nil {
+		e.log().Warn("Failed to remove backups of the prune", "error", err)
+	}
+	if err = newBaselineStore(execPath).store(e.log(), ci.ConfigFile, lock, execPath, nil); err != nil {
+		e.log().Warn("Failed to remove baselines", "error", err)
+	}
+	e.log().Info("Pruned files no longer generated", "files", pruned)
+	return res, nil
+}
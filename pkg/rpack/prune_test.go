@@ -0,0 +1,60 @@
+package rpack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestPrune(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./a.txt\", \"a\\n\")\nrpack.write(\"./b.txt\", \"b\\n\")\nrpack.write(\"./c.txt\", \"c\\n\")\n", "")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	// The slimmed definition changes a.txt and drops b.txt and c.txt
+	script := filepath.Join(filepath.Dir(workDir), "def", "script.lua")
+	if err := os.WriteFile(script, []byte("local rpack = require(\"rpack.v1\")\nrpack.write(\"./a.txt\", \"changed\\n\")\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "c.txt"), []byte("mine\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	e := &Executor{DryRun: true, Force: true}
+	pruned, err := e.Prune(t.Context(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pruned, []string{"b.txt", "c.txt"}) {
+		t.Errorf("Expected b.txt and c.txt to be pruned, got %v", pruned)
+	}
+	if _, err = os.Stat(filepath.Join(workDir, "b.txt")); err != nil {
+		t.Errorf("Dry-run must not remove files: %v", err)
+	}
+
+	if _, err = (&Executor{}).Prune(t.Context(), config); !errors.Is(err, ErrLockModified) {
+		t.Fatalf("Expected ErrLockModified for modified c.txt, got %v", err)
+	}
+	if pruned, err = (&Executor{Force: true}).Prune(t.Context(), config); err != nil || len(pruned) != 2 {
+		t.Fatalf("Expected forced prune, got %v, %v", pruned, err)
+	}
+	for _, name := range []string{"b.txt", "c.txt"} {
+		if _, err = os.Stat(filepath.Join(workDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed: %v", name, err)
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "a.txt")); string(b) != "a\n" { //nolint:gosec // test file
+		t.Errorf("Prune must not write generated files, got %q", b)
+	}
+	lock, err := Loader{}.loadRPackLockFile(filepath.Join(workDir, "app"+RPackLockFileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Files) != 1 || lock.Files[0].Path != "a.txt" || lock.Files[0].Sha != sha256Hex([]byte("a\n")) {
+		t.Errorf("Expected only the unchanged a.txt entry, got %+v", lock.Files)
+	}
+}
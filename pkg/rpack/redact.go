@@ -0,0 +1,64 @@
+package rpack
+
+import (
+	"strings"
+)
+
+// RedactedValue replaces sensitive values when values are exported.
+const RedactedValue = "[REDACTED]"
+
+// sensitiveKeyWords are parts of value names that suggest a secret.
+var sensitiveKeyWords = []string{"password", "passwd", "secret", "token", "credential", "apikey", "api_key", "private_key"}
+
+// isSensitiveKey reports if the name of a value suggests it holds a secret.
+func isSensitiveKey(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range sensitiveKeyWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactValues returns a copy of values with sensitive entries replaced by RedactedValue.
+// An entry is sensitive if its dot separated path or one of its parents is listed
+// in sensitive, or if its name suggests a secret like password or token.
+// Entries of lists share the path of the list.
+func RedactValues(values map[string]any, sensitive []string) map[string]any {
+	if values == nil {
+		return nil
+	}
+	listed := make(map[string]struct{}, len(sensitive))
+	for _, p := range sensitive {
+		listed[p] = struct{}{}
+	}
+	return redactValue(values, "", listed).(map[string]any)
+}
+
+func redactValue(v any, path string, listed map[string]struct{}) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			if _, ok := listed[childPath]; ok || isSensitiveKey(k) {
+				out[k] = RedactedValue
+				continue
+			}
+			out[k] = redactValue(child, childPath, listed)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = redactValue(child, path, listed)
+		}
+		return out
+	default:
+		return v
+	}
+}
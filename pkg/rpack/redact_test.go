@@ -0,0 +1,43 @@
+package rpack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactValues(t *testing.T) {
+	values := map[string]any{
+		"name": "app",
+		"db": map[string]any{
+			"host":     "localhost",
+			"Password": "hunter2",
+		},
+		"conn": map[string]any{"url": "postgres://u:p@h"},
+		"users": []any{
+			map[string]any{"name": "a", "api_token": "t"},
+		},
+		"dsn": "secret-dsn",
+	}
+	got := RedactValues(values, []string{"conn", "dsn"})
+	want := map[string]any{
+		"name": "app",
+		"db": map[string]any{
+			"host":     "localhost",
+			"Password": RedactedValue,
+		},
+		"conn": RedactedValue,
+		"users": []any{
+			map[string]any{"name": "a", "api_token": RedactedValue},
+		},
+		"dsn": RedactedValue,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RedactValues() = %v, want %v", got, want)
+	}
+	if values["db"].(map[string]any)["Password"] != "hunter2" {
+		t.Error("RedactValues modified its input")
+	}
+	if RedactValues(nil, nil) != nil {
+		t.Error("Expected nil for nil values")
+	}
+}
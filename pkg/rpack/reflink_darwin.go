@@ -0,0 +1,18 @@
+//go:build darwin
+
+package rpack
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile clones src to the new file dst with clonefile, supported by APFS.
+func reflinkFile(src, dst string) error {
+	err := unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EXDEV) {
+		return errReflinkUnsupported
+	}
+	return err
+}
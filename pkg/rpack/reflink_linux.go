@@ -0,0 +1,34 @@
+//go:build linux
+
+package rpack
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile clones src to the new file dst with the FICLONE ioctl, supported by e.g. btrfs and XFS.
+func reflinkFile(src, dst string) (err error) {
+	in, err := os.Open(src) //nolint:gosec // path comes from a resolved handle
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, generatedFilePerm) //nolint:gosec // path comes from a resolved handle
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlFileClone(int(out.Fd()), int(in.Fd()))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOTTY) {
+			return errReflinkUnsupported
+		}
+	}
+	return err
+}
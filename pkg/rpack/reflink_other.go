@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package rpack
+
+// reflinkFile is not supported on this platform, files are copied.
+func reflinkFile(_, _ string) error {
+	return errReflinkUnsupported
+}
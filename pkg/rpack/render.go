@@ -0,0 +1,69 @@
+package rpack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// fileRenderer records a single file of a dry-run, see Executor.RenderFile.
+type fileRenderer struct {
+	path  string
+	file  *DiffFile
+	paths []string
+}
+
+// Check fileRenderer satisfies DiffRenderer interface
+var _ = DiffRenderer(&fileRenderer{})
+
+// Render records f if it is the selected file, nothing is written to w.
+func (r *fileRenderer) Render(_ context.Context, _ io.Writer, f *DiffFile) error {
+	if f.Action != PlanActionRemove {
+		r.paths = append(r.paths, f.Path)
+	}
+	if f.Path == r.path {
+		r.file = f
+	}
+	return nil
+}
+
+// rendersUnchanged makes the dry-run pass unchanged files, they can be selected as well.
+func (r *fileRenderer) rendersUnchanged() bool {
+	return true
+}
+
+// RenderFile executes the config as dry-run and returns the generated content of the file name,
+// relative to the working directory or absolute. The target is not modified.
+func (e *Executor) RenderFile(ctx context.Context, configFile, name string) ([]byte, error) {
+	ci, err := e.loader().LoadRPackConfig(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load rpack config: %s: %w", configFile, err)
+	}
+	execPath := ci.ConfigPath
+	if e.OverrideExecPath != "" {
+		execPath = e.OverrideExecPath
+	}
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not construct absolute path for %s: %w", name, err)
+	}
+	rel, err := filepath.Rel(execPath, absName)
+	if err != nil || !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("%s is outside of the target directory %s", name, execPath)
+	}
+
+	r := &fileRenderer{path: filepath.ToSlash(rel)}
+	run := *e
+	run.DryRun = true
+	run.DiffRenderer = r
+	run.PlanFile = ""
+	if _, err = run.runConfig(ctx, ci); err != nil {
+		return nil, err
+	}
+	if r.file == nil || r.file.Action == PlanActionRemove {
+		return nil, fmt.Errorf("%s is not generated by %s, generated files: %s", r.path, configFile, strings.Join(r.paths, ", "))
+	}
+	return r.file.New, nil
+}
@@ -0,0 +1,35 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderFile(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./docs/a.md\", \"generated\\n\")\nrpack.write(\"./b.txt\", \"b\\n\")\n", "")
+	if err := os.WriteFile(filepath.Join(workDir, "b.txt"), []byte("local\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	content, err := (&Executor{}).RenderFile(t.Context(), config, filepath.Join(workDir, "docs", "a.md"))
+	if err != nil || string(content) != "generated\n" {
+		t.Fatalf("Expected the generated content, got %q, %v", content, err)
+	}
+	// Existing files are rendered as well and left untouched
+	t.Chdir(workDir)
+	if content, err = (&Executor{}).RenderFile(t.Context(), config, "b.txt"); err != nil || string(content) != "b\n" {
+		t.Fatalf("Expected the generated content, got %q, %v", content, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "b.txt")); string(b) != "local\n" { //nolint:gosec // test file
+		t.Errorf("Expected the target to be untouched, got %q", b)
+	}
+
+	if _, err = (&Executor{}).RenderFile(t.Context(), config, "missing.txt"); err == nil || !strings.Contains(err.Error(), "b.txt, docs/a.md") {
+		t.Errorf("Expected an error listing the generated files, got %v", err)
+	}
+	if _, err = (&Executor{}).RenderFile(t.Context(), config, "../outside.txt"); err == nil {
+		t.Error("Expected a path outside of the target to fail")
+	}
+}
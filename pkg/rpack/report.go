@@ -0,0 +1,445 @@
+package rpack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blang/rpack/pkg/api"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// RunReportCurrentSchemaVersion is the schema version of run reports.
+const RunReportCurrentSchemaVersion = "v1"
+
+// RPackCacheDirReports is the directory below RPackCacheDir reports are stored in,
+// one subdirectory per config.
+const RPackCacheDirReports = "reports"
+
+// runReportTimeFormat is used for run ids, it sorts lexically in chronological order.
+const runReportTimeFormat = "20060102T150405.000Z"
+
+// RunReport is a normalized record of an apply. It only contains digests
+// so it can be stored and compared without leaking values or file contents.
+type RunReport struct {
+	SchemaVersion string           `json:"@schema_version"`
+	ID            string           `json:"id"`
+	Config        string           `json:"config"`
+	StartedAt     time.Time        `json:"started_at"`
+	DurationMs    int64            `json:"duration_ms"`
+	Packs         []*RunReportPack `json:"packs"`
+	// Timings are the durations of the phases of the run, see api.RunResult.Timings
+	Timings []*api.PhaseTiming `json:"timings,omitempty"`
+}
+
+// RunReportPack is the part of a run report describing a single pack.
+type RunReportPack struct {
+	// Name of the pack, empty for single source configs
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source"`
+	// Checksum over all files of the fetched definition
+	SourceDigest string `json:"source_digest"`
+	// Checksum of the canonical JSON encoding of the values
+	ValuesDigest string             `json:"values_digest"`
+	Inputs       []*RunReportInput  `json:"inputs"`
+	Outputs      []*RunReportOutput `json:"outputs"`
+	LoadMs       int64              `json:"load_ms"`
+	ExecMs       int64              `json:"exec_ms"`
+}
+
+// RunReportInput is the digest of a user supplied input.
+type RunReportInput struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+}
+
+// RunReportOutput is the digest of a file written to the target.
+type RunReportOutput struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+}
+
+// packReportTimings records how long loading and executing a pack took.
+type packReportTimings struct {
+	Load time.Duration
+	Exec time.Duration
+}
+
+// globInputDigest returns a digest over the paths and contents of the files matched by a glob input.
+func globInputDigest(in *RPackResolvedInput) (string, error) {
+	var sb strings.Builder
+	for _, match := range in.Matches {
+		digest, err := util.Sha256File(filepath.Join(in.ResolvedPath, filepath.FromSlash(match)))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(match + "\x00" + digest + "\n")
+	}
+	return util.Sha256String(sb.String()), nil
+}
+
+// valuesDigest returns a checksum of the canonical JSON encoding of values.
+// encoding/json sorts map keys, so equal values produce equal digests.
+func valuesDigest(values map[string]any) (string, error) {
+	if values == nil {
+		values = map[string]any{}
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return util.Sha256String(string(b)), nil
+}
+
+// newRunReportPack records digests of the definition, values, inputs and outputs of a pack run.
+func newRunReportPack(run *packRun, files []*packTargetFile, timings packReportTimings) (*RunReportPack, error) {
+	pi := run.Instance
+	rp := &RunReportPack{
+		Name:    pi.Pack.Name,
+		Source:  pi.Pack.Source,
+		Inputs:  []*RunReportInput{},
+		Outputs: []*RunReportOutput{},
+		LoadMs:  timings.Load.Milliseconds(),
+		ExecMs:  timings.Exec.Milliseconds(),
+	}
+	var err error
+	if rp.SourceDigest, err = util.Sha256Dir(pi.SourcePath); err != nil {
+		return nil, fmt.Errorf("could not compute digest of source: %w", err)
+	}
+	if rp.ValuesDigest, err = valuesDigest(pi.Pack.ConfigOrEmpty().Values); err != nil {
+		return nil, fmt.Errorf("could not compute digest of values: %w", err)
+	}
+	for _, in := range pi.ResolvedInputs {
+		var digest string
+		switch in.Type {
+		case RPackInputTypeDirectory:
+			digest, err = util.Sha256Dir(in.ResolvedPath)
+		case RPackInputTypeGlob:
+			digest, err = globInputDigest(in)
+		default:
+			digest, err = util.Sha256File(in.ResolvedPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not compute digest of input %s: %w", in.Name, err)
+		}
+		rp.Inputs = append(rp.Inputs, &RunReportInput{Name: in.Name, Path: in.UserPath, Digest: digest})
+	}
+	sort.Slice(rp.Inputs, func(i, j int) bool { return rp.Inputs[i].Name < rp.Inputs[j].Name })
+	for _, f := range files {
+		if f.Pack != pi.Pack.Name {
+			continue
+		}
+		rp.Outputs = append(rp.Outputs, &RunReportOutput{Path: f.Path, Digest: f.Sha})
+	}
+	sort.Slice(rp.Outputs, func(i, j int) bool { return rp.Outputs[i].Path < rp.Outputs[j].Path })
+	return rp, nil
+}
+
+// RunReportDir returns the directory reports of a config are stored in.
+func RunReportDir(execPath, configName string) string {
+	return filepath.Join(execPath, RPackCacheDir, RPackCacheDirReports, configName)
+}
+
+// runReportConfigName derives the config name from the lockfile path, e.g. app for app.rpack.yaml.
+func runReportConfigName(ci *RPackConfigInstance) string {
+	return strings.TrimSuffix(filepath.Base(ci.LockFilePath), RPackLockFileSuffix)
+}
+
+// WriteFile stores the report as JSON below dir, named by its id.
+func (r *RunReport) WriteFile(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec // standard permissions
+		return "", fmt.Errorf("could not create report dir %s: %w", dir, err)
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal run report: %w", err)
+	}
+	name := filepath.Join(dir, r.ID+".json")
+	if err := os.WriteFile(name, append(b, '\n'), 0o644); err != nil { //nolint:gosec // standard permissions for report output
+		return "", fmt.Errorf("failed to write run report: %w", err)
+	}
+	return name, nil
+}
+
+// LoadRunReport reads a run report from a file.
+func LoadRunReport(name string) (*RunReport, error) {
+	b, err := os.ReadFile(name) //nolint:gosec // intentional: path comes from user
+	if err != nil {
+		return nil, err
+	}
+	var r RunReport
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("could not parse run report %s: %w", name, err)
+	}
+	if r.SchemaVersion != RunReportCurrentSchemaVersion {
+		return nil, fmt.Errorf("unsupported run report schema version %q: %s", r.SchemaVersion, name)
+	}
+	return &r, nil
+}
+
+// ListRunReports returns the paths of all reports stored below execPath, oldest first.
+func ListRunReports(execPath string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(execPath, RPackCacheDir, RPackCacheDirReports, "*", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return filepath.Base(matches[i]) < filepath.Base(matches[j])
+	})
+	return matches, nil
+}
+
+// FindRunReport resolves ref to a report: either a path to a report file
+// or a unique prefix of a run id stored below execPath.
+func FindRunReport(execPath, ref string) (*RunReport, error) {
+	if _, err := os.Stat(ref); err == nil {
+		return LoadRunReport(ref)
+	}
+	reports, err := ListRunReports(execPath)
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, r := range reports {
+		if strings.HasPrefix(filepath.Base(r), ref) {
+			found = append(found, r)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no run report found for %q", ref)
+	case 1:
+		return LoadRunReport(found[0])
+	default:
+		return nil, fmt.Errorf("run %q is ambiguous, matches %d reports", ref, len(found))
+	}
+}
+
+// RunReportDiff explains the differences between two run reports.
+type RunReportDiff struct {
+	Old *RunReport
+	New *RunReport
+	// Packs only present in one of the runs
+	AddedPacks   []string
+	RemovedPacks []string
+	Packs        []*RunReportPackDiff
+}
+
+// RunReportPackDiff explains the differences of a pack between two runs.
+type RunReportPackDiff struct {
+	Name           string
+	OldSource      string
+	NewSource      string
+	SourceChanged  bool
+	ValuesChanged  bool
+	InputsAdded    []string
+	InputsRemoved  []string
+	InputsChanged  []string
+	OutputsAdded   []string
+	OutputsRemoved []string
+	OutputsChanged []string
+	Old            *RunReportPack
+	New            *RunReportPack
+}
+
+// Changed reports if anything but timings differs.
+func (d *RunReportPackDiff) Changed() bool {
+	return d.OldSource != d.NewSource || d.SourceChanged || d.ValuesChanged ||
+		len(d.InputsAdded)+len(d.InputsRemoved)+len(d.InputsChanged) > 0 ||
+		len(d.OutputsAdded)+len(d.OutputsRemoved)+len(d.OutputsChanged) > 0
+}
+
+// Changed reports if the runs differ in anything but timings.
+func (d *RunReportDiff) Changed() bool {
+	if len(d.AddedPacks)+len(d.RemovedPacks) > 0 {
+		return true
+	}
+	for _, p := range d.Packs {
+		if p.Changed() {
+			return true
+		}
+	}
+	return false
+}
+
+// diffDigests compares two name to digest maps.
+func diffDigests(old, cur map[string]string) (added, removed, changed []string) {
+	for k, v := range cur {
+		o, ok := old[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case o != v:
+			changed = append(changed, k)
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// DiffRunReports compares two runs, packs are matched by name.
+func DiffRunReports(old, cur *RunReport) *RunReportDiff {
+	d := &RunReportDiff{Old: old, New: cur}
+	oldPacks := make(map[string]*RunReportPack)
+	for _, p := range old.Packs {
+		oldPacks[p.Name] = p
+	}
+	curPacks := make(map[string]struct{})
+	for _, p := range cur.Packs {
+		curPacks[p.Name] = struct{}{}
+		op, ok := oldPacks[p.Name]
+		if !ok {
+			d.AddedPacks = append(d.AddedPacks, p.Name)
+			continue
+		}
+		pd := &RunReportPackDiff{
+			Name:          p.Name,
+			OldSource:     op.Source,
+			NewSource:     p.Source,
+			SourceChanged: op.SourceDigest != p.SourceDigest,
+			ValuesChanged: op.ValuesDigest != p.ValuesDigest,
+			Old:           op,
+			New:           p,
+		}
+		oldIn, curIn := make(map[string]string), make(map[string]string)
+		for _, in := range op.Inputs {
+			oldIn[in.Name] = in.Path + "\x00" + in.Digest
+		}
+		for _, in := range p.Inputs {
+			curIn[in.Name] = in.Path + "\x00" + in.Digest
+		}
+		pd.InputsAdded, pd.InputsRemoved, pd.InputsChanged = diffDigests(oldIn, curIn)
+		oldOut, curOut := make(map[string]string), make(map[string]string)
+		for _, out := range op.Outputs {
+			oldOut[out.Path] = out.Digest
+		}
+		for _, out := range p.Outputs {
+			curOut[out.Path] = out.Digest
+		}
+		pd.OutputsAdded, pd.OutputsRemoved, pd.OutputsChanged = diffDigests(oldOut, curOut)
+		d.Packs = append(d.Packs, pd)
+	}
+	for _, p := range old.Packs {
+		if _, ok := curPacks[p.Name]; !ok {
+			d.RemovedPacks = append(d.RemovedPacks, p.Name)
+		}
+	}
+	return d
+}
+
+// packLabel returns a printable pack name.
+func packLabel(name string) string {
+	if name == "" {
+		return "(default)"
+	}
+	return name
+}
+
+// Format writes a human readable explanation of the differences.
+//
+//nolint:gocognit,gocyclo // intentional: report formatting
+func (d *RunReportDiff) Format(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Run %s (%s)\n", d.Old.ID, d.Old.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "Run %s (%s)\n\n", d.New.ID, d.New.StartedAt.Format(time.RFC3339))
+	if !d.Changed() {
+		sb.WriteString("No differences besides timings.\n")
+	}
+	for _, name := range d.AddedPacks {
+		fmt.Fprintf(&sb, "pack %s: added\n", packLabel(name))
+	}
+	for _, name := range d.RemovedPacks {
+		fmt.Fprintf(&sb, "pack %s: removed\n", packLabel(name))
+	}
+	for _, p := range d.Packs {
+		if !p.Changed() {
+			continue
+		}
+		fmt.Fprintf(&sb, "pack %s:\n", packLabel(p.Name))
+		if p.OldSource != p.NewSource {
+			fmt.Fprintf(&sb, "  source changed: %s -> %s\n", p.OldSource, p.NewSource)
+		}
+		if p.SourceChanged {
+			fmt.Fprintf(&sb, "  definition changed: %s -> %s\n", shortDigest(p.Old.SourceDigest), shortDigest(p.New.SourceDigest))
+		}
+		if p.ValuesChanged {
+			sb.WriteString("  values changed\n")
+		}
+		for _, in := range p.InputsAdded {
+			fmt.Fprintf(&sb, "  input %s added\n", in)
+		}
+		for _, in := range p.InputsRemoved {
+			fmt.Fprintf(&sb, "  input %s removed\n", in)
+		}
+		for _, in := range p.InputsChanged {
+			fmt.Fprintf(&sb, "  input %s changed\n", in)
+		}
+		outputs := len(p.OutputsAdded) + len(p.OutputsRemoved) + len(p.OutputsChanged)
+		if outputs > 0 {
+			fmt.Fprintf(&sb, "  outputs: %d added, %d removed, %d modified\n", len(p.OutputsAdded), len(p.OutputsRemoved), len(p.OutputsChanged))
+			for _, f := range p.OutputsAdded {
+				fmt.Fprintf(&sb, "    A %s\n", f)
+			}
+			for _, f := range p.OutputsRemoved {
+				fmt.Fprintf(&sb, "    D %s\n", f)
+			}
+			for _, f := range p.OutputsChanged {
+				fmt.Fprintf(&sb, "    M %s\n", f)
+			}
+		}
+		if outputs > 0 && p.OldSource == p.NewSource && !p.SourceChanged && !p.ValuesChanged && len(p.InputsAdded)+len(p.InputsRemoved)+len(p.InputsChanged) == 0 {
+			sb.WriteString("  outputs changed without changes to definition, values or inputs\n")
+		}
+	}
+	fmt.Fprintf(&sb, "\nduration: %dms -> %dms\n", d.Old.DurationMs, d.New.DurationMs)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// shortDigest abbreviates a digest for display.
+func shortDigest(s string) string {
+	if len(s) > 12 {
+		return s[:12]
+	}
+	return s
+}
+
+// writeRunReport builds and persists the report of a successful apply.
+// The report is returned if it was built, even if it could not be written.
+func writeRunReport(ci *RPackConfigInstance, execPath string, startedAt time.Time, runs []*packRun, files []*packTargetFile, timings []packReportTimings, phases []*api.PhaseTiming) (*RunReport, error) {
+	report := &RunReport{
+		SchemaVersion: RunReportCurrentSchemaVersion,
+		ID:            startedAt.UTC().Format(runReportTimeFormat),
+		Config:        runReportConfigName(ci),
+		StartedAt:     startedAt.UTC(),
+		DurationMs:    time.Since(startedAt).Milliseconds(),
+		Packs:         []*RunReportPack{},
+		Timings:       phases,
+	}
+	for i, run := range runs {
+		rp, err := newRunReportPack(run, files, timings[i])
+		if err != nil {
+			return nil, packErr(run.Instance.Pack, err)
+		}
+		report.Packs = append(report.Packs, rp)
+	}
+	dir := RunReportDir(execPath, report.Config)
+	if _, err := os.Stat(filepath.Join(dir, report.ID+".json")); err == nil {
+		return report, fmt.Errorf("run report already exists: %s", report.ID)
+	}
+	_, err := report.WriteFile(dir)
+	return report, err
+}
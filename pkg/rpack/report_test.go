@@ -0,0 +1,143 @@
+package rpack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRunReport(id string, packs ...*RunReportPack) *RunReport {
+	return &RunReport{
+		SchemaVersion: RunReportCurrentSchemaVersion,
+		ID:            id,
+		Config:        "app",
+		StartedAt:     time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Packs:         packs,
+	}
+}
+
+func testRunReportPack(name, values string, inputs map[string]string, outputs map[string]string) *RunReportPack {
+	p := &RunReportPack{Name: name, Source: "../def", SourceDigest: "src", ValuesDigest: values}
+	for n, d := range inputs {
+		p.Inputs = append(p.Inputs, &RunReportInput{Name: n, Path: "./" + n, Digest: d})
+	}
+	for path, d := range outputs {
+		p.Outputs = append(p.Outputs, &RunReportOutput{Path: path, Digest: d})
+	}
+	return p
+}
+
+func TestDiffRunReports(t *testing.T) {
+	old := testRunReport("a",
+		testRunReportPack("svc", "v1", map[string]string{"users": "u1", "gone": "g"}, map[string]string{"a.txt": "1", "b.txt": "2"}),
+		testRunReportPack("removed", "v1", nil, nil),
+	)
+	cur := testRunReport("b",
+		testRunReportPack("svc", "v2", map[string]string{"users": "u2", "new": "n"}, map[string]string{"a.txt": "1", "b.txt": "3", "c.txt": "4"}),
+		testRunReportPack("added", "v1", nil, nil),
+	)
+	d := DiffRunReports(old, cur)
+	if !d.Changed() {
+		t.Fatalf("Expected changes")
+	}
+	if !reflect.DeepEqual(d.AddedPacks, []string{"added"}) || !reflect.DeepEqual(d.RemovedPacks, []string{"removed"}) {
+		t.Errorf("Unexpected pack changes: added %v, removed %v", d.AddedPacks, d.RemovedPacks)
+	}
+	if len(d.Packs) != 1 {
+		t.Fatalf("Expected one compared pack, got %d", len(d.Packs))
+	}
+	p := d.Packs[0]
+	if p.SourceChanged || !p.ValuesChanged {
+		t.Errorf("Expected only values to change, got source %t values %t", p.SourceChanged, p.ValuesChanged)
+	}
+	if !reflect.DeepEqual(p.InputsAdded, []string{"new"}) || !reflect.DeepEqual(p.InputsRemoved, []string{"gone"}) || !reflect.DeepEqual(p.InputsChanged, []string{"users"}) {
+		t.Errorf("Unexpected input changes: %v %v %v", p.InputsAdded, p.InputsRemoved, p.InputsChanged)
+	}
+	if !reflect.DeepEqual(p.OutputsAdded, []string{"c.txt"}) || len(p.OutputsRemoved) != 0 || !reflect.DeepEqual(p.OutputsChanged, []string{"b.txt"}) {
+		t.Errorf("Unexpected output changes: %v %v %v", p.OutputsAdded, p.OutputsRemoved, p.OutputsChanged)
+	}
+
+	var sb strings.Builder
+	if err := d.Format(&sb); err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	for _, want := range []string{"pack added: added", "pack removed: removed", "values changed", "input users changed", "outputs: 1 added, 0 removed, 1 modified", "M b.txt"} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestDiffRunReportsUnexplainedOutputs(t *testing.T) {
+	old := testRunReport("a", testRunReportPack("", "v1", nil, map[string]string{"a.txt": "1"}))
+	cur := testRunReport("b", testRunReportPack("", "v1", nil, map[string]string{"a.txt": "2"}))
+	var sb strings.Builder
+	if err := DiffRunReports(old, cur).Format(&sb); err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	if !strings.Contains(sb.String(), "pack (default):") || !strings.Contains(sb.String(), "without changes to definition, values or inputs") {
+		t.Errorf("Expected unexplained output change, got:\n%s", sb.String())
+	}
+
+	sb.Reset()
+	d := DiffRunReports(old, old)
+	if d.Changed() {
+		t.Errorf("Expected no changes")
+	}
+	if err := d.Format(&sb); err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	if !strings.Contains(sb.String(), "No differences besides timings.") {
+		t.Errorf("Expected no differences, got:\n%s", sb.String())
+	}
+}
+
+func TestFindRunReport(t *testing.T) {
+	dir := t.TempDir()
+	reportDir := RunReportDir(dir, "app")
+	var first string
+	for _, id := range []string{"20250102T030405.000Z", "20250102T030406.000Z", "20250103T000000.000Z"} {
+		name, err := testRunReport(id).WriteFile(reportDir)
+		if err != nil {
+			t.Fatalf("WriteFile failed: %s", err)
+		}
+		if first == "" {
+			first = name
+		}
+	}
+	list, err := ListRunReports(dir)
+	if err != nil || len(list) != 3 || list[0] != first {
+		t.Fatalf("Unexpected report list %v: %v", list, err)
+	}
+
+	r, err := FindRunReport(dir, "20250103")
+	if err != nil || r.ID != "20250103T000000.000Z" {
+		t.Errorf("Expected report by prefix, got %v: %v", r, err)
+	}
+	r, err = FindRunReport(dir, first)
+	if err != nil || r.ID != "20250102T030405.000Z" {
+		t.Errorf("Expected report by path, got %v: %v", r, err)
+	}
+	if _, err := FindRunReport(dir, "20250102"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected ambiguous error, got %v", err)
+	}
+	if _, err := FindRunReport(dir, "2024"); err == nil {
+		t.Errorf("Expected error for unknown run")
+	}
+}
+
+func TestValuesDigest(t *testing.T) {
+	a, err := valuesDigest(map[string]any{"a": 1, "b": map[string]any{"x": true, "y": "z"}})
+	if err != nil {
+		t.Fatalf("valuesDigest failed: %s", err)
+	}
+	b, _ := valuesDigest(map[string]any{"b": map[string]any{"y": "z", "x": true}, "a": 1})
+	if a != b {
+		t.Errorf("Expected equal digests for equal values")
+	}
+	empty, _ := valuesDigest(nil)
+	if e, _ := valuesDigest(map[string]any{}); e != empty {
+		t.Errorf("Expected nil and empty values to have the same digest")
+	}
+}
@@ -2,22 +2,159 @@ package rpack
 
 import (
 	_ "embed"
-	"path/filepath"
+	"path"
 
 	"fmt"
 
 	"github.com/samber/lo"
 
-	"github.com/blang/rpack/pkg/rpack/util"
+	"github.com/blang/rpack/pkg/lockfile"
 )
 
 // RPackConfig is the configuration to use a rpack file
 //
 //nolint:revive // intentional: RPack prefix is the domain convention
 type RPackConfig struct {
-	Config        *RPackConfigConfig `json:"config"`
+	Config        *RPackConfigConfig `json:"config,omitempty"`
 	SchemaVersion string             `json:"@schema_version"`
-	Source        string             `json:"source"`
+	Source        string             `json:"source,omitempty"`
+
+	// Script selects the entry script of the single source declared by its definition, script.lua if empty.
+	Script string `json:"script,omitempty"`
+
+	// Packs declares multiple packs executed from a single config file.
+	// Mutually exclusive with Source and Config.
+	Packs []*RPackConfigPack `json:"packs,omitempty"`
+
+	// SemanticUnchanged lists target path patterns of JSON and YAML files that are kept
+	// as they are if they parse to the same structure as the generated content.
+	SemanticUnchanged []string `json:"semantic_unchanged,omitempty"`
+
+	// Protected lists target path patterns rpack never overwrites or removes,
+	// not even with force. ** matches any number of directories.
+	Protected []string `json:"protected,omitempty"`
+
+	// GitAttributes converts the line endings of generated text files to the ones declared
+	// by the .gitattributes files of the target repository and its core.autocrlf setting.
+	GitAttributes bool `json:"gitattributes,omitempty"`
+
+	// ChecksumAlgorithm is the algorithm of the lockfile checksums, see lockfile.LookupAlgorithm.
+	// Defaults to sha256, entries written with another algorithm are migrated on the next run.
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+
+	// Verify lists commands run in the target directory after the apply.
+	// If one fails, the apply is rolled back.
+	Verify []*RPackConfigVerify `json:"verify,omitempty"`
+
+	// PostApply lists commands run in the target directory after a successful apply, e.g. formatters.
+	// Changes they make to managed files are recorded in the lockfile, a failure keeps the apply.
+	PostApply []*RPackConfigPostApply `json:"post_apply,omitempty"`
+
+	// Notify sends the run report of every apply to a webhook.
+	Notify *RPackConfigNotify `json:"notify,omitempty"`
+
+	// Secrets declares credentials scripts of all packs can read with the secret: prefix.
+	// Their values are redacted in logs.
+	Secrets map[string]*RPackConfigSecret `json:"secrets,omitempty"`
+
+	// Extra maps names to read-only directories and files outside the target, e.g. a shared templates
+	// checkout. Paths are absolute, relative to the config or start with ~/ for the home directory.
+	// Packs read the extras their definition declares with the extra: prefix.
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// RPackConfigSecret is the source of a secret, either an environment variable or a key of a SOPS encrypted file.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackConfigSecret struct {
+	// Env is the name of the environment variable holding the secret
+	Env string `json:"env,omitempty"`
+
+	// SOPS is the path of a SOPS encrypted file relative to the config, decrypted with the sops binary
+	SOPS string `json:"sops,omitempty"`
+
+	// Key is the dot separated path of the secret in the SOPS file
+	Key string `json:"key,omitempty"`
+}
+
+// RPackConfigVerify is a command verifying the applied files, e.g. that generated code compiles.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackConfigVerify struct {
+	// Name describes the command in logs and errors, defaults to the command line
+	Name string `json:"name,omitempty"`
+
+	// Command is the program and its arguments, it is not run by a shell
+	Command []string `json:"command"`
+
+	// Timeout is a Go duration, defaults to DefaultVerifyTimeout
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// RPackConfigPostApply is a command run after a successful apply, e.g. go mod tidy.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackConfigPostApply struct {
+	// Name describes the command in logs and errors, defaults to the command line
+	Name string `json:"name,omitempty"`
+
+	// Command is the program and its arguments, it is not run by a shell
+	Command []string `json:"command"`
+
+	// Timeout is a Go duration, defaults to DefaultPostApplyTimeout
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// RPackConfigNotify configures the notifications sent after an apply.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackConfigNotify struct {
+	// Webhook is an http or https URL the JSON run report is posted to
+	Webhook string `json:"webhook"`
+
+	// Timeout is a Go duration, defaults to DefaultNotifyTimeout
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// RPackConfigPack is a single pack entry of a multi-pack config.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackConfigPack struct {
+	// Name identifies the pack inside the config, required for multi-pack configs.
+	Name string `json:"name"`
+
+	// Source of the rpack definition
+	Source string `json:"source"`
+
+	// Config holds values and inputs of the pack
+	Config *RPackConfigConfig `json:"config,omitempty"`
+
+	// DependsOn lists names of packs that need to be executed before this pack.
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// Script selects the entry script declared by the definition, script.lua if empty.
+	Script string `json:"script,omitempty"`
+}
+
+// ConfigOrEmpty returns the pack config, or an empty config if none is set.
+func (p *RPackConfigPack) ConfigOrEmpty() *RPackConfigConfig {
+	if p.Config == nil {
+		return &RPackConfigConfig{}
+	}
+	return p.Config
+}
+
+// PackList returns the packs declared by the config.
+// A classic single-source config is returned as one unnamed pack.
+func (c *RPackConfig) PackList() []*RPackConfigPack {
+	if len(c.Packs) > 0 {
+		return c.Packs
+	}
+	return []*RPackConfigPack{{
+		Source: c.Source,
+		Config: c.Config,
+		Script: c.Script,
+	}}
 }
 
 // RPackConfigConfig bundles Values and Input declaration
@@ -38,6 +175,34 @@ func (c *RPackConfig) Validate() error {
 	if err != nil {
 		return fmt.Errorf("validating rpack against schema failed: %w", err)
 	}
+	if len(c.Packs) > 0 {
+		if c.Source != "" || c.Config != nil || c.Script != "" {
+			return fmt.Errorf("packs can not be combined with top-level source, config or script")
+		}
+		if _, err := OrderRPackConfigPacks(c.Packs); err != nil {
+			return fmt.Errorf("invalid packs: %w", err)
+		}
+	} else if c.Source == "" {
+		return fmt.Errorf("either source or packs is required")
+	}
+	for _, pattern := range c.SemanticUnchanged {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("semantic_unchanged: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range c.Protected {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("protected: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if _, err := lockfile.LookupAlgorithm(c.ChecksumAlgorithm); err != nil {
+		return fmt.Errorf("checksum_algorithm: %w", err)
+	}
+	if c.Notify != nil {
+		if err := c.Notify.validate(); err != nil {
+			return fmt.Errorf("notify: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -46,13 +211,18 @@ func (c *RPackConfig) Validate() error {
 //go:embed schema.cue
 var RPackSchema string
 
+// RPackJSONSchema holds the JSON Schema equivalent of RPackSchema for builds without CUE.
+//
+//go:embed schema.json
+var RPackJSONSchema string
+
 // CUE schema internal names.
 const (
 	RPackInternalSchemaName = "#Schema"
 )
 
-// RPackSchemaValidator is the precompiled CUE schema validator.
-var RPackSchemaValidator = lo.Must(NewCueValidator([]byte(RPackSchema), RPackInternalSchemaName))
+// RPackSchemaValidator is the precompiled schema validator for rpack configuration.
+var RPackSchemaValidator = lo.Must(newBuiltinSchemaValidator([]byte(RPackSchema), []byte(RPackJSONSchema), RPackInternalSchemaName))
 
 // RPackConfigInstance is the internal representation of a RPackConfig.
 //
@@ -62,6 +232,9 @@ type RPackConfigInstance struct {
 	// Path of the config
 	ConfigPath string
 
+	// Absolute path of the config file
+	ConfigFile string
+
 	// The RPackConfig
 	Config *RPackConfig
 
@@ -110,16 +283,39 @@ type RPackLockFileFile struct {
 	Path string `json:"path"`
 	// Sha of the path, so we can check if we will remove a modified file
 	Sha string `json:"sha"`
+	// Pack that wrote the file, only set for multi-pack configs
+	Pack string `json:"pack,omitempty"`
+	// Algorithm of Sha, empty for sha256
+	Algorithm string `json:"algorithm,omitempty"`
+	// Blocks are the markers of the managed blocks of a file only partly managed by rpack,
+	// see rpack.managed_block. Sha is the checksum of the blocks then.
+	Blocks []string `json:"blocks,omitempty"`
 }
 
 // AddFile adds a file entry to the lock file.
 func (f *RPackLockFile) AddFile(path, sha string) {
+	f.AddPackFile("", path, sha)
+}
+
+// AddPackFile adds a file entry written by the named pack to the lock file.
+func (f *RPackLockFile) AddPackFile(pack, path, sha string) {
 	f.Files = append(f.Files, &RPackLockFileFile{
 		Path: path,
 		Sha:  sha,
+		Pack: pack,
 	})
 }
 
+// fileBlocks returns the markers of the managed blocks of the entry with path, nil for fully managed files.
+func (f *RPackLockFile) fileBlocks(path string) []string {
+	for _, file := range f.Files {
+		if file.Path == path {
+			return file.Blocks
+		}
+	}
+	return nil
+}
+
 // RPackLockFileIntegrity represents integrity check results for a lock file.
 //
 //nolint:revive // intentional: RPack prefix is the domain convention
@@ -130,23 +326,11 @@ type RPackLockFileIntegrity struct {
 
 // CheckIntegrity checks if managed files are still valid
 func (f *RPackLockFile) CheckIntegrity(path string) (*RPackLockFileIntegrity, error) {
-	res := &RPackLockFileIntegrity{}
-	cleanBase := filepath.Clean(path)
-	for _, file := range f.Files {
-		filePath := filepath.Join(cleanBase, file.Path)
-		if err := util.CheckFileExists(filePath); err != nil {
-			res.Removed = append(res.Removed, file.Path)
-			continue
-		}
-		chsum, err := util.Sha256File(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("could not calculate checksum for %s: %s: %w", file.Path, filePath, err)
-		}
-		if file.Sha != chsum {
-			res.Modified = append(res.Modified, file.Path)
-		}
+	report, err := lockfile.CheckIntegrity(f.API(), path)
+	if err != nil {
+		return nil, err
 	}
-	return res, nil
+	return &RPackLockFileIntegrity{Modified: report.Modified, Removed: report.Removed}, nil
 }
 
 // RPackLockFileChanges represents changes detected in a lock file.
@@ -2,6 +2,10 @@ package rpack
 
 import (
 	_ "embed"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"fmt"
 
@@ -13,6 +17,11 @@ import (
 //go:embed def_schema.cue
 var RPackDefSchema string
 
+// RPackDefJSONSchema holds the JSON Schema equivalent of RPackDefSchema for builds without CUE.
+//
+//go:embed def_schema.json
+var RPackDefJSONSchema string
+
 // CUE schema internal names.
 const (
 	RPackDefSchemaName         = "#Schema"
@@ -28,8 +37,19 @@ type RPackDef struct {
 	// Name of definition, required
 	Name string `json:"name"`
 
-	// ScriptFile to execute: default: script.lua
-	// ScriptFile string     `json:"script_file"`
+	// Description tells users what the definition generates, optional
+	Description string `json:"description,omitempty"`
+
+	// Version of the definition, e.g. 1.4.0, optional. Scripts read it with rpack.meta().
+	Version string `json:"version,omitempty"`
+
+	// Scripts declares named entry scripts besides script.lua, e.g. apply.lua and migrate.lua.
+	// The config or the command line selects the one to run, script.lua runs if none is selected.
+	Scripts []*RPackDefScript `json:"scripts,omitempty"`
+
+	// Dependencies are definitions executed before this one, e.g. base packs.
+	// Their outputs are applied like the outputs of any pack and readable with the dep:<name>/ prefix.
+	Dependencies []*RPackDefDependency `json:"dependencies,omitempty"`
 
 	// ConfigSchemaFile: default: schema.cue
 
@@ -37,10 +57,174 @@ type RPackDef struct {
 	// definition that are mapped by the user.
 	// Those paths are excluded from write operations.
 	Inputs []*RPackDefInput `json:"inputs"`
+
+	// Extra declares read-only directories and files outside the target the config maps by name,
+	// e.g. shared company templates. Scripts read them with the extra:<name> prefix.
+	Extra []*RPackDefExtra `json:"extra,omitempty"`
+
+	// AllowTargetRead lists target paths the script may read, stat and list,
+	// e.g. to merge into an existing Makefile. Entries are slash separated
+	// paths relative to the target and may contain glob patterns matched like
+	// DiffOptions.SemanticPaths, ** matches any number of directories.
+	// Reads always see the target as it was before the run.
+	AllowTargetRead []string `json:"allow_target_read,omitempty"`
+
+	// SensitiveValues lists dot separated paths of values holding secrets,
+	// e.g. db.password. They are redacted wherever rpack exports values.
+	SensitiveValues []string `json:"sensitive_values,omitempty"`
+
+	// Permissions declares the capabilities of the script, the script gets exactly those.
+	// Without permissions the script may read inputs, write the target and read AllowTargetRead.
+	Permissions *RPackDefPermissions `json:"permissions,omitempty"`
+
+	// Template sets the defaults of rpack.template, scripts can override them per call
+	Template *RPackDefTemplate `json:"template,omitempty"`
+}
+
+// RPackDefScript is a named entry script of a definition.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackDefScript struct {
+	// Name selects the script in configs and on the command line
+	Name string `json:"name"`
+
+	// File is the slash separated path of the script relative to the definition
+	File string `json:"file"`
+
+	// Description tells users what the script does, optional
+	Description string `json:"description,omitempty"`
+}
+
+// RPackDefDependency is a definition another definition builds on.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackDefDependency struct {
+	// Name of the pack executing the dependency, scripts read its outputs with dep:<name>/
+	Name string `json:"name"`
+
+	// Source of the definition. Relative sources (./ or ../) are relative to the declaring definition
+	Source string `json:"source"`
+
+	// Values passed to the dependency, optional
+	Values map[string]any `json:"values,omitempty"`
+
+	// Script selects the entry script of the dependency, optional
+	Script string `json:"script,omitempty"`
+}
+
+// ScriptFile returns the slash separated path of the entry script name, script.lua if name is empty.
+// The path is checked like the paths of scripts, so a definition not validated by ValidateSchema
+// can not select a file outside of its directory either.
+func (def *RPackDef) ScriptFile(name string) (string, error) {
+	if name == "" {
+		return RPackDefScriptFilename, nil
+	}
+	for _, s := range def.Scripts {
+		if s.Name == name {
+			file, err := cleanScriptPath(s.File)
+			if err != nil {
+				return "", fmt.Errorf("file %q of script %s %w: %w", s.File, s.Name, err, ErrValidation)
+			}
+			return file, nil
+		}
+	}
+	names := make([]string, 0, len(def.Scripts))
+	for _, s := range def.Scripts {
+		names = append(names, s.Name)
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("script %q is not declared, definition %s only has %s: %w", name, def.Name, RPackDefScriptFilename, ErrValidation)
+	}
+	return "", fmt.Errorf("script %q is not declared by definition %s, available: %s: %w", name, def.Name, strings.Join(names, ", "), ErrValidation)
+}
+
+// Values of the template options of a definition and rpack.template.
+const (
+	TemplateMissingKeyDefault = "default"
+	TemplateMissingKeyZero    = "zero"
+	TemplateMissingKeyError   = "error"
+	TemplateEscapeText        = "text"
+	TemplateEscapeHTML        = "html"
+)
+
+// RPackDefTemplate sets the defaults of rpack.template.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackDefTemplate struct {
+	// MissingKey is the behavior for fields missing from the data:
+	// default renders <no value>, zero renders the zero value, error fails the script.
+	// Defaults to default, error is recommended for new definitions.
+	MissingKey string `json:"missingkey,omitempty"`
+
+	// Escape selects the template package: text renders as is, html escapes
+	// values contextually like html/template. Defaults to text.
+	Escape string `json:"escape,omitempty"`
+}
+
+// RPackDefPermissions declares the capabilities a definition needs, anything not declared is denied.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackDefPermissions struct {
+	// ReadInputs allows reading the inputs and extras mapped by the user
+	ReadInputs bool `json:"read_inputs,omitempty"`
+
+	// WriteTarget allows writing files to the target
+	WriteTarget bool `json:"write_target,omitempty"`
+
+	// TargetReadPaths lists target paths the script may read, stat and list, like AllowTargetRead
+	TargetReadPaths []string `json:"target_read_paths,omitempty"`
+
+	// HTTP lists URLs the script may fetch read-only. An entry ending with a slash
+	// allows all URLs below it, other entries allow exactly that URL.
+	HTTP []string `json:"http,omitempty"`
+
+	// Env lists the environment variables the script may read with the env module
+	Env []string `json:"env,omitempty"`
+
+	// Hostname allows the script to read the host name with the env module
+	Hostname bool `json:"hostname,omitempty"`
+}
+
+// EffectivePermissions returns the capabilities the script gets.
+// Definitions without permissions get the capabilities of the default sandbox.
+func (def *RPackDef) EffectivePermissions() *RPackDefPermissions {
+	if def.Permissions == nil {
+		return &RPackDefPermissions{ReadInputs: true, WriteTarget: true, TargetReadPaths: def.AllowTargetRead}
+	}
+	return def.Permissions
+}
+
+// HTTPAllowed returns the URLs the definition may fetch.
+func (def *RPackDef) HTTPAllowed() []string {
+	return def.EffectivePermissions().HTTP
+}
+
+// Describe lists the capabilities for review, one per line.
+func (p *RPackDefPermissions) Describe() []string {
+	var lines []string
+	if p.ReadInputs {
+		lines = append(lines, "read mapped inputs")
+	}
+	if p.WriteTarget {
+		lines = append(lines, "write files to the target")
+	}
+	if len(p.TargetReadPaths) > 0 {
+		lines = append(lines, "read target paths: "+strings.Join(p.TargetReadPaths, ", "))
+	}
+	if len(p.HTTP) > 0 {
+		lines = append(lines, "fetch URLs: "+strings.Join(p.HTTP, ", "))
+	}
+	if len(p.Env) > 0 {
+		lines = append(lines, "read environment variables: "+strings.Join(p.Env, ", "))
+	}
+	if p.Hostname {
+		lines = append(lines, "read the host name")
+	}
+	return lines
 }
 
-// RPackDefSchemaValidator is the precompiled CUE schema validator for rpack definitions.
-var RPackDefSchemaValidator = lo.Must(NewCueValidator([]byte(RPackDefSchema), RPackDefInternalSchemaName))
+// RPackDefSchemaValidator is the precompiled schema validator for rpack definitions.
+var RPackDefSchemaValidator = lo.Must(newBuiltinSchemaValidator([]byte(RPackDefSchema), []byte(RPackDefJSONSchema), RPackDefInternalSchemaName))
 
 // ValidateSchema validates the rpack definition against the CUE schema.
 func (def *RPackDef) ValidateSchema() error {
@@ -48,6 +232,66 @@ func (def *RPackDef) ValidateSchema() error {
 	if err != nil {
 		return fmt.Errorf("validating rpack definition failed: %w", err)
 	}
+	if def.Permissions != nil {
+		if len(def.AllowTargetRead) > 0 {
+			return fmt.Errorf("validating rpack definition failed: allow_target_read can not be combined with permissions, use permissions.target_read_paths")
+		}
+		if len(def.Inputs) > 0 && !def.Permissions.ReadInputs {
+			return fmt.Errorf("validating rpack definition failed: inputs need permissions.read_inputs")
+		}
+		if len(def.Extra) > 0 && !def.Permissions.ReadInputs {
+			return fmt.Errorf("validating rpack definition failed: extra needs permissions.read_inputs")
+		}
+	}
+	for _, pattern := range def.EffectivePermissions().TargetReadPaths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("validating rpack definition failed: target read paths: invalid pattern %q: %w", pattern, err)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(pattern)) {
+			return fmt.Errorf("validating rpack definition failed: target read paths: path %q needs to be local", pattern)
+		}
+	}
+	for _, allowed := range def.HTTPAllowed() {
+		u, err := url.Parse(allowed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("validating rpack definition failed: permissions: http: %q needs to be an absolute http or https URL", allowed)
+		}
+	}
+	scriptNames := make(map[string]struct{}, len(def.Scripts))
+	for _, s := range def.Scripts {
+		if _, ok := scriptNames[s.Name]; ok {
+			return fmt.Errorf("validating rpack definition failed: scripts: duplicate script %s", s.Name)
+		}
+		scriptNames[s.Name] = struct{}{}
+		if _, err := cleanScriptPath(s.File); err != nil {
+			return fmt.Errorf("validating rpack definition failed: scripts: file %q of script %s %w", s.File, s.Name, err)
+		}
+	}
+	depNames := make(map[string]struct{}, len(def.Dependencies))
+	for _, dep := range def.Dependencies {
+		if _, ok := depNames[dep.Name]; ok {
+			return fmt.Errorf("validating rpack definition failed: dependencies: duplicate dependency %s", dep.Name)
+		}
+		depNames[dep.Name] = struct{}{}
+	}
+	extraNames := make(map[string]struct{}, len(def.Extra))
+	for _, extra := range def.Extra {
+		if _, ok := extraNames[extra.Name]; ok {
+			return fmt.Errorf("validating rpack definition failed: extra: duplicate extra %s", extra.Name)
+		}
+		extraNames[extra.Name] = struct{}{}
+	}
+	for _, in := range def.Inputs {
+		if in.Default == "" {
+			continue
+		}
+		if in.Required {
+			return fmt.Errorf("validating rpack definition failed: inputs: required input %s can not have a default", in.Name)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(in.Default)) {
+			return fmt.Errorf("validating rpack definition failed: inputs: default %q of input %s needs to be local", in.Default, in.Name)
+		}
+	}
 	return nil
 }
 
@@ -67,6 +311,32 @@ type RPackDefInput struct {
 	// Name to reference path in script
 	Name string `json:"name"`
 
-	// // If the input is required
-	// Required bool `json:"required"`
+	// Description tells users what to map to the input, optional
+	Description string `json:"description,omitempty"`
+
+	// Required inputs need to be mapped by the user.
+	// Optional inputs may be missing and are not exposed to the script then.
+	Required bool `json:"required,omitempty"`
+
+	// Default is the target relative path used for an optional input the user does not map.
+	// It is skipped if the path does not exist.
+	Default string `json:"default,omitempty"`
+}
+
+// RPackDefExtra is a read-only directory or file outside the target the definition expects the config to map.
+//
+//nolint:revive // intentional: RPack prefix is the domain convention
+type RPackDefExtra struct {
+	// Type: dir or file
+	Type string `json:"type"`
+
+	// Name the config maps the path to, scripts read it with extra:<name>
+	Name string `json:"name"`
+
+	// Description tells users what to map, optional
+	Description string `json:"description,omitempty"`
+
+	// Required extras need to be mapped by the config.
+	// Optional extras may be missing and are not exposed to the script then.
+	Required bool `json:"required,omitempty"`
 }
@@ -1,6 +1,11 @@
 package rpack
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestRPackDefValidateSchema(t *testing.T) {
 	tcs := []struct {
@@ -57,6 +62,131 @@ func TestRPackDefValidateSchema(t *testing.T) {
 			},
 			valid: false,
 		},
+		{ // With target reads
+			def: &RPackDef{
+				SchemaVersion:   "v1",
+				Name:            "name",
+				AllowTargetRead: []string{"Makefile", "config/*.yaml"},
+			},
+			valid: true,
+		},
+		{ // With target read outside of target
+			def: &RPackDef{
+				SchemaVersion:   "v1",
+				Name:            "name",
+				AllowTargetRead: []string{"../Makefile"},
+			},
+			valid: false,
+		},
+		{ // With invalid target read pattern
+			def: &RPackDef{
+				SchemaVersion:   "v1",
+				Name:            "name",
+				AllowTargetRead: []string{"config/[.yaml"},
+			},
+			valid: false,
+		},
+		{ // With required and optional inputs
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Inputs: []*RPackDefInput{
+					{Name: "a", Type: "file", Required: true},
+					{Name: "b", Type: "dir", Default: "conf"},
+				},
+			},
+			valid: true,
+		},
+		{ // With default of required input
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Inputs:        []*RPackDefInput{{Name: "a", Type: "file", Required: true, Default: "a.txt"}},
+			},
+			valid: false,
+		},
+		{ // With default outside of target
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Inputs:        []*RPackDefInput{{Name: "a", Type: "file", Default: "../a.txt"}},
+			},
+			valid: false,
+		},
+		{ // With http permissions
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Permissions:   &RPackDefPermissions{HTTP: []string{"https://example.com/schemas/"}},
+			},
+			valid: true,
+		},
+		{ // With permissions and allow_target_read
+			def: &RPackDef{
+				SchemaVersion:   "v1",
+				Name:            "name",
+				AllowTargetRead: []string{"Makefile"},
+				Permissions:     &RPackDefPermissions{WriteTarget: true},
+			},
+			valid: false,
+		},
+		{ // With inputs but without read_inputs
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Inputs:        []*RPackDefInput{{Name: "a", Type: "file"}},
+				Permissions:   &RPackDefPermissions{WriteTarget: true},
+			},
+			valid: false,
+		},
+		{ // With invalid target read path
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Permissions:   &RPackDefPermissions{TargetReadPaths: []string{"../Makefile"}},
+			},
+			valid: false,
+		},
+		{ // With http permission without host
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Permissions:   &RPackDefPermissions{HTTP: []string{"https:///schemas"}},
+			},
+			valid: false,
+		},
+		{ // With template defaults
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Template:      &RPackDefTemplate{MissingKey: TemplateMissingKeyError, Escape: TemplateEscapeHTML},
+			},
+			valid: true,
+		},
+		{ // With entry script outside of the definition
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Scripts:       []*RPackDefScript{{Name: "apply", File: "../../x.lua"}},
+			},
+			valid: false,
+		},
+		{ // With duplicate entry scripts
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Scripts:       []*RPackDefScript{{Name: "apply", File: "apply.lua"}, {Name: "apply", File: "other.lua"}},
+			},
+			valid: false,
+		},
+		{ // With unknown missingkey behavior
+			def: &RPackDef{
+				SchemaVersion: "v1",
+				Name:          "name",
+				Template:      &RPackDefTemplate{MissingKey: "ignore"},
+			},
+			valid: false,
+		},
 	}
 
 	for i, tc := range tcs {
@@ -72,3 +202,23 @@ func TestRPackDefValidateSchema(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadRPackDefStrict(t *testing.T) {
+	name := filepath.Join(t.TempDir(), RPackDefDefaultFilename)
+	if err := os.WriteFile(name, []byte("\"@schema_version\": \"v1\"\nname: app\nallow_taget_read: [Makefile]\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := LoadRPackDef(name); err == nil || !strings.Contains(err.Error(), "allow_taget_read") {
+		t.Errorf("Expected unknown field to fail, got %v", err)
+	}
+}
+
+func TestRPackDefScriptFile(t *testing.T) {
+	def := &RPackDef{Name: "name", Scripts: []*RPackDefScript{{Name: "apply", File: "scripts/./apply.lua"}, {Name: "escape", File: "../../x.lua"}}}
+	if file, err := def.ScriptFile("apply"); err != nil || file != "scripts/apply.lua" {
+		t.Errorf("Expected clean script path, got %q, %v", file, err)
+	}
+	if _, err := def.ScriptFile("escape"); err == nil {
+		t.Error("Expected script outside of the definition to fail")
+	}
+}
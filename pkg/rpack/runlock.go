@@ -0,0 +1,82 @@
+package rpack
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// RunLockFile is the lock file in the cache directory serializing runs on the same target.
+const RunLockFile = "run.lock"
+
+// errLocked is returned by tryLockFile if another process holds the lock.
+var errLocked = errors.New("locked by another process")
+
+// runLockPollInterval is the interval to retry acquiring a lock held by another run.
+const runLockPollInterval = 100 * time.Millisecond
+
+// runLock is an exclusive lock on the cache directory of a target, held by one run at a time.
+// Runs in other processes wait for it, fetching sources and applying to the target never overlap.
+type runLock struct {
+	file *os.File
+}
+
+// acquireRunLock locks the cache directory in execPath, waiting until another run releases it
+// or ctx is canceled. The lock is released by the operating system if the process dies.
+func acquireRunLock(ctx context.Context, log *slog.Logger, execPath string) (*runLock, error) {
+	cacheDir := filepath.Join(execPath, RPackCacheDir)
+	if err := os.MkdirAll(util.LongPath(cacheDir), 0o755); err != nil { //nolint:gosec // standard permissions
+		return nil, fmt.Errorf("could not create cache directory: %s: %w", cacheDir, err)
+	}
+	name := filepath.Join(cacheDir, RunLockFile)
+	f, err := os.OpenFile(util.LongPath(name), os.O_RDWR|os.O_CREATE, 0o644) //nolint:gosec // standard permissions
+	if err != nil {
+		return nil, fmt.Errorf("could not open run lock: %s: %w", name, err)
+	}
+	waiting := false
+	for {
+		err = tryLockFile(f)
+		if err == nil {
+			return &runLock{file: f}, nil
+		}
+		if !errors.Is(err, errLocked) {
+			_ = f.Close()
+			return nil, fmt.Errorf("could not acquire run lock: %s: %w", name, err)
+		}
+		if !waiting {
+			log.Info("Waiting for another rpack run to finish", "lock", name)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, fmt.Errorf("waiting for run lock: %s: %w", name, ctx.Err())
+		case <-time.After(runLockPollInterval):
+		}
+	}
+}
+
+// release releases the lock, it may be called on a nil or released lock.
+func (l *runLock) release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	err := errors.Join(unlockFile(l.file), l.file.Close())
+	l.file = nil
+	return err
+}
+
+// newRunID returns an identifier unique to a run, naming its run and temp directories.
+func newRunID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%d-%s", os.Getpid(), hex.EncodeToString(b))
+}
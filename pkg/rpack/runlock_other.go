@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package rpack
+
+import "os"
+
+// tryLockFile does not lock on platforms without file locks, runs are not serialized.
+func tryLockFile(*os.File) error {
+	return nil
+}
+
+// unlockFile releases the lock on f.
+func unlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,124 @@
+package rpack
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blang/rpack/pkg/api"
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+func TestRunLock(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := acquireRunLock(t.Context(), slog.Default(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 3*runLockPollInterval)
+	defer cancel()
+	if _, err = acquireRunLock(ctx, slog.Default(), dir); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected to wait for the lock until the deadline, got %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		second, err := acquireRunLock(t.Context(), slog.Default(), dir)
+		if err == nil {
+			err = second.release()
+		}
+		acquired <- err
+	}()
+	time.Sleep(2 * runLockPollInterval)
+	if err = lock.release(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-acquired; err != nil {
+		t.Fatalf("Expected lock after release, got %v", err)
+	}
+	if err = lock.release(); err != nil {
+		t.Errorf("Releasing twice must not fail: %v", err)
+	}
+}
+
+func TestRunConcurrent(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"hello\\n\")\nrpack.write(\"temp:scratch.txt\", \"x\")\n", "")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Go(func() {
+			_, errs[i] = Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: i%2 == 0})
+		})
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Run %d failed: %v", i, err)
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join(workDir, "out.txt")); string(b) != "hello\n" { //nolint:gosec // test file
+		t.Errorf("Unexpected content %q", b)
+	}
+
+	// Run and temp directories are removed after the run
+	runDirs, err := filepath.Glob(filepath.Join(workDir, RPackCacheDir, "*", "*", "*", RPackCacheDirRun))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runDirs) != 0 {
+		t.Errorf("Expected run directories to be removed, got %v", runDirs)
+	}
+}
+
+func TestRunDryRunHoldsLock(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"hello\\n\")\n", "")
+	lock, err := acquireRunLock(t.Context(), slog.Default(), workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lock.release() }()
+	ctx, cancel := context.WithTimeout(t.Context(), 3*runLockPollInterval)
+	defer cancel()
+	if _, err = Run(ctx, api.RunOptions{ConfigFile: config, DryRun: true}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the dry-run to wait for the lock, got %v", err)
+	}
+}
+
+func TestRunRemovesStaleRunDirs(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"hello\\n\")\n", "")
+	sha := util.Sha256String("stale")
+	stale := []string{
+		// Crashed run
+		filepath.Join(workDir, RPackCacheDir, sha, sha, "123-abcdef01", RPackCacheDirRun),
+		// Run directory of rpack versions not naming them per run
+		filepath.Join(workDir, RPackCacheDir, sha, sha, RPackCacheDirTemp),
+	}
+	kept := filepath.Join(workDir, RPackCacheDir, sha, RPackCacheDirSource, "script.lua")
+	for _, dir := range append(stale, filepath.Dir(kept)) {
+		if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(kept, nil, 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range stale {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("Expected stale directory %s to be removed, got %v", dir, err)
+		}
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("Expected sources to be kept, got %v", err)
+	}
+}
@@ -1,12 +1,51 @@
+// Keep schema.json in sync, it is used by builds without CUE.
+
 import "strings"
 
 #Schema: {
 	"@schema_version"!: "v1"
-	source!:            string & strings.MinRunes(1)
+	source?:            string & strings.MinRunes(1)
 	config?:            #Config
+	script?:            #ScriptName
+	packs?: [...#Pack]
+	semantic_unchanged?: [...string & strings.MinRunes(1)]
+	protected?: [...string & strings.MinRunes(1)]
+	gitattributes?: bool
+	checksum_algorithm?: string & strings.MinRunes(1)
+	verify?: [...#Command]
+	post_apply?: [...#Command]
+	notify?: {
+		webhook!: string & =~"^https?://"
+		timeout?: #Duration
+	}
+	secrets?: [=~"^[a-zA-Z0-9-_.]+$"]: #Secret
+	extra?: [=~"^[a-zA-Z0-9-_.]{1,64}$"]: string & strings.MinRunes(1)
 }
 
 #Config: {
 	inputs?: [string]: string
 	values?: _
 }
+
+#Command: {
+	name?: string
+	command!: [string & strings.MinRunes(1), ...string]
+	timeout?: #Duration
+}
+
+#ScriptName: string & =~"^[a-zA-Z0-9-_]{1,64}$"
+
+#Duration: string & =~"^([0-9]+(\\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$"
+
+#Secret: {env!: string & strings.MinRunes(1)} | {
+	sops!: string & strings.MinRunes(1)
+	key!:  string & strings.MinRunes(1)
+}
+
+#Pack: {
+	name!:   string & =~"^[a-zA-Z0-9-_]{1,64}$"
+	source!: string & strings.MinRunes(1)
+	config?: #Config
+	depends_on?: [...string]
+	script?: #ScriptName
+}
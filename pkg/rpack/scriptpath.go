@@ -0,0 +1,75 @@
+package rpack
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Errors of cleanScriptPath, wrapped as `path "name" <error>`.
+var (
+	errPathNotRelative = errors.New("needs to be relative")
+	errPathNotLocal    = errors.New("needs to be local")
+	errPathColon       = errors.New("must not contain ':', it is neither a known prefix nor allowed in file names")
+)
+
+// windowsReservedNames are the device names Windows reserves in every directory, with any extension.
+var windowsReservedNames = map[string]struct{}{
+	"CON": {}, "PRN": {}, "AUX": {}, "NUL": {}, "CONIN$": {}, "CONOUT$": {},
+	"COM1": {}, "COM2": {}, "COM3": {}, "COM4": {}, "COM5": {}, "COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+	"LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {}, "LPT5": {}, "LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+}
+
+// splitPrefix splits a friendly name such as rpack:dir/file into its resolver prefix and path.
+// A single letter before the colon is a drive letter (C:\dir) and no prefix.
+func splitPrefix(name string) (prefix, rest string, found bool) {
+	prefix, rest, found = strings.Cut(name, ":")
+	if !found || len(prefix) < 2 || strings.ContainsAny(prefix, `/\`) {
+		return "", name, false
+	}
+	return prefix, rest, true
+}
+
+// hasVolumeName reports if p starts with a Windows volume name, a drive letter such as C: or a UNC share.
+func hasVolumeName(p string) bool {
+	if len(p) >= 2 && p[1] == ':' && ('a' <= p[0]|0x20 && p[0]|0x20 <= 'z') {
+		return true
+	}
+	return strings.HasPrefix(p, `\\`) || strings.HasPrefix(p, "//")
+}
+
+// toScriptSlash converts the separators of a path given by a script to slashes,
+// scripts may use backslashes on all platforms.
+func toScriptSlash(p string) string {
+	return strings.ReplaceAll(p, `\`, "/")
+}
+
+// cleanScriptPath returns the clean slash separated form of a path given by a script relative to
+// the base of a resolver. Paths are checked the same way on all platforms, so a definition behaves the same
+// on Linux and Windows: absolute paths including volume names, paths leaving the base, colons,
+// e.g. of unknown prefixes or NTFS alternate data streams, and the device names reserved by Windows are rejected.
+// Convert the result with filepath.FromSlash to access the file.
+func cleanScriptPath(p string) (string, error) {
+	if hasVolumeName(p) {
+		return "", errPathNotRelative
+	}
+	p = toScriptSlash(p)
+	if path.IsAbs(p) {
+		return "", errPathNotRelative
+	}
+	if strings.Contains(p, ":") {
+		return "", errPathColon
+	}
+	clean := path.Clean(p)
+	if !filepath.IsLocal(filepath.FromSlash(clean)) {
+		return "", errPathNotLocal
+	}
+	for elem := range strings.SplitSeq(clean, "/") {
+		base, _, _ := strings.Cut(elem, ".")
+		if _, ok := windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))]; ok {
+			return "", errPathNotLocal
+		}
+	}
+	return clean, nil
+}
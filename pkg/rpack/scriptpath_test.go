@@ -0,0 +1,89 @@
+package rpack
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+func TestCleanScriptPath(t *testing.T) {
+	tcs := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{path: "./dir/file.txt", want: "dir/file.txt"},
+		{path: `dir\sub\file.txt`, want: "dir/sub/file.txt"},
+		{path: `.\dir\..\file.txt`, want: "file.txt"},
+		{path: "null.txt", want: "null.txt"},
+		{path: "/etc/passwd", err: errPathNotRelative},
+		{path: `\dir\file`, err: errPathNotRelative},
+		{path: `C:\dir\file`, err: errPathNotRelative},
+		{path: "c:/dir/file", err: errPathNotRelative},
+		{path: "C:file", err: errPathNotRelative},
+		{path: `\\server\share\file`, err: errPathNotRelative},
+		{path: "//server/share/file", err: errPathNotRelative},
+		{path: `..\file`, err: errPathNotLocal},
+		{path: "dir/../../file", err: errPathNotLocal},
+		{path: "file.txt:stream", err: errPathColon},
+		{path: "unknown:file", err: errPathColon},
+		{path: "NUL", err: errPathNotLocal},
+		{path: "dir/com1.txt", err: errPathNotLocal},
+		{path: "Aux ", err: errPathNotLocal},
+	}
+	for _, tc := range tcs {
+		got, err := cleanScriptPath(tc.path)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("cleanScriptPath(%q) error = %v, want %v", tc.path, err, tc.err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("cleanScriptPath(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestSplitPrefix(t *testing.T) {
+	tcs := []struct {
+		name, prefix, rest string
+		found              bool
+	}{
+		{name: "map:input/file", prefix: "map", rest: "input/file", found: true},
+		{name: "rpack:templates", prefix: "rpack", rest: "templates", found: true},
+		{name: "./dir/file", rest: "./dir/file"},
+		{name: `C:\dir\file`, rest: `C:\dir\file`},
+		{name: "d:file", rest: "d:file"},
+		{name: `dir\file:stream`, rest: `dir\file:stream`},
+	}
+	for _, tc := range tcs {
+		prefix, rest, found := splitPrefix(tc.name)
+		if prefix != tc.prefix || rest != tc.rest || found != tc.found {
+			t.Errorf("splitPrefix(%q) = %q, %q, %v, want %q, %q, %v", tc.name, prefix, rest, found, tc.prefix, tc.rest, tc.found)
+		}
+	}
+}
+
+func TestRPackFSWindowsPaths(t *testing.T) {
+	defDir, runDir, tempDir, execDir := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	fs := NewRPackFS(true, defDir, runDir, tempDir, execDir, nil, nil)
+
+	// Backslashes are separators, target paths are slash separated on all platforms
+	if err := fs.Write(`.\sub\file.txt`, []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := util.FileExists(filepath.Join(runDir, "sub", "file.txt")); err != nil || !exists {
+		t.Fatalf("Expected file written below the run directory, got %v, %v", exists, err)
+	}
+	if rel, ok := fs.TargetPath(`sub\file.txt`); !ok || rel != "sub/file.txt" {
+		t.Errorf("Expected slash separated target path, got %q, %v", rel, ok)
+	}
+
+	// Drive letters are no prefixes and absolute paths, unknown prefixes are rejected
+	for _, name := range []string{`C:\Windows\file.txt`, "C:/file.txt", `\\server\share\file.txt`, "unknown:file.txt", "file.txt:stream", "CON"} {
+		if err := fs.Write(name, []byte("content")); err == nil {
+			t.Errorf("Expected write to %q to fail", name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SecretFSResolverPrefix is the prefix for reading secrets declared by the config.
+const SecretFSResolverPrefix = "secret:"
+
+// secretStore reveals the secrets declared by a config on first read.
+// Decrypted SOPS files are cached for the run, revealed values are redacted in logs.
+type secretStore struct {
+	// dir is the directory SOPS file paths are relative to
+	dir     string
+	secrets map[string]*RPackConfigSecret
+
+	mu sync.Mutex
+	// docs holds the decrypted SOPS files by path
+	docs map[string]map[string]any
+}
+
+// newSecretStore creates a store for the secrets of a config in dir, nil if there are none.
+func newSecretStore(dir string, secrets map[string]*RPackConfigSecret) *secretStore {
+	if len(secrets) == 0 {
+		return nil
+	}
+	return &secretStore{dir: dir, secrets: secrets, docs: make(map[string]map[string]any)}
+}
+
+// source returns the absolute path of the SOPS file of the secret name, empty for environment variables.
+func (s *secretStore) source(name string) string {
+	secret := s.secrets[name]
+	if secret == nil || secret.SOPS == "" {
+		return ""
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(secret.SOPS))
+}
+
+// value reveals the secret name, SOPS files are decrypted within ctx.
+func (s *secretStore) value(ctx context.Context, name string) ([]byte, error) {
+	secret, ok := s.secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("secret %q is not declared by the config", name)
+	}
+	var v string
+	if secret.Env != "" {
+		env, ok := os.LookupEnv(secret.Env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s of secret %q is not set", secret.Env, name)
+		}
+		v = env
+	} else {
+		doc, err := s.decrypt(ctx, s.source(name))
+		if err != nil {
+			return nil, fmt.Errorf("could not decrypt secret %q: %w", name, err)
+		}
+		if v, err = lookupSecretKey(doc, secret.Key); err != nil {
+			return nil, fmt.Errorf("secret %q: %w", name, err)
+		}
+	}
+	registerSecret(v)
+	return []byte(v), nil
+}
+
+// decrypt decrypts the SOPS file path once, using the sops binary.
+func (s *secretStore) decrypt(ctx context.Context, path string) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if doc, ok := s.docs[path]; ok {
+		return doc, nil
+	}
+	cmd := exec.CommandContext(ctx, "sops", "--decrypt", "--output-type", "json", path) //nolint:gosec // intentional: file declared by the config
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sops --decrypt %s: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return nil, fmt.Errorf("could not parse decrypted %s: %w", path, err)
+	}
+	s.docs[path] = doc
+	return doc, nil
+}
+
+// lookupSecretKey returns the scalar at the dot separated key of a decrypted document.
+func lookupSecretKey(doc map[string]any, key string) (string, error) {
+	var cur any = doc
+	for _, part := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("key %s not found", key)
+		}
+		if cur, ok = m[part]; !ok {
+			return "", fmt.Errorf("key %s not found", key)
+		}
+	}
+	switch v := cur.(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("key %s is not a scalar", key)
+	}
+}
+
+// SecretFSResolver resolves read-only handles of the secrets declared by the config.
+type SecretFSResolver struct {
+	// ctx is the context of the script run, the handles pass it to the decryption
+	ctx    context.Context
+	name   string
+	prefix string
+	store  *secretStore
+}
+
+// Check SecretFSResolver satisfies FSResolver interface
+var _ = FSResolver(&SecretFSResolver{})
+
+// newSecretFSResolver creates a resolver for the secrets of store, revealed within ctx.
+func newSecretFSResolver(ctx context.Context, name, prefix string, store *secretStore) *SecretFSResolver {
+	return &SecretFSResolver{ctx: ctx, name: name, prefix: prefix, store: store}
+}
+
+// Resolve resolves the name of a declared secret.
+func (r *SecretFSResolver) Resolve(name string) (FSHandle, bool, error) {
+	secret, found := strings.CutPrefix(name, r.prefix)
+	if !found {
+		return nil, false, nil
+	}
+	if _, ok := r.store.secrets[secret]; !ok {
+		return nil, true, fmt.Errorf("secret %q is not declared by the config", secret)
+	}
+	return &secretFSHandle{ctx: r.ctx, name: secret, resolver: r.name, friendlyPath: r.prefix + secret, store: r.store}, true, nil
+}
+
+// errSecretReadOnly is returned for modifications of secrets.
+var errSecretReadOnly = errors.New("secrets are read-only")
+
+// secretFSHandle is a read-only handle of a secret.
+type secretFSHandle struct {
+	ctx          context.Context
+	name         string
+	resolver     string
+	friendlyPath string
+	store        *secretStore
+}
+
+// Check secretFSHandle satisfies FSHandle interface
+var _ = FSHandle(&secretFSHandle{})
+
+func (h *secretFSHandle) Resolver() string           { return h.resolver }
+func (h *secretFSHandle) FriendlyPath() string       { return h.friendlyPath }
+func (h *secretFSHandle) IndirectTargetPath() string { return "" }
+
+// AbsPath returns the SOPS file of the secret, empty for environment variables.
+func (h *secretFSHandle) AbsPath() string { return h.store.source(h.name) }
+
+func (h *secretFSHandle) Read() ([]byte, error) {
+	return h.store.value(h.ctx, h.name)
+}
+
+func (h *secretFSHandle) Open() (io.ReadCloser, error) {
+	b, err := h.Read()
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (h *secretFSHandle) Write([]byte) error {
+	return errSecretReadOnly
+}
+
+func (h *secretFSHandle) Update(func([]byte, bool) ([]byte, error)) error {
+	return errSecretReadOnly
+}
+
+func (h *secretFSHandle) Checksum() (string, bool) { return "", false }
+
+// Stat reports declared secrets as existing files without revealing them.
+func (h *secretFSHandle) Stat() (exists bool, dir bool, err error) {
+	return true, false, nil
+}
+
+func (h *secretFSHandle) ReadDir() (files []FSHandle, dirs []FSHandle, err error) {
+	return nil, nil, fmt.Errorf("%s is not a directory", h.friendlyPath)
+}
+
+func (h *secretFSHandle) Remove() error {
+	return errSecretReadOnly
+}
+
+func (h *secretFSHandle) Rename(FSHandle) error {
+	return errSecretReadOnly
+}
+
+func (h *secretFSHandle) Transfer(string) error {
+	return errSecretReadOnly
+}
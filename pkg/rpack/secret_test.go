@@ -0,0 +1,110 @@
+package rpack
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestLookupSecretKey(t *testing.T) {
+	doc := map[string]any{"db": map[string]any{"password": "hunter2", "port": float64(5432), "opts": []any{}}}
+	if v, err := lookupSecretKey(doc, "db.password"); err != nil || v != "hunter2" {
+		t.Errorf("Expected hunter2, got %q: %v", v, err)
+	}
+	if v, err := lookupSecretKey(doc, "db.port"); err != nil || v != "5432" {
+		t.Errorf("Expected 5432, got %q: %v", v, err)
+	}
+	for _, key := range []string{"db.user", "db.password.x", "db.opts", "db"} {
+		if _, err := lookupSecretKey(doc, key); err == nil {
+			t.Errorf("Expected key %s to fail", key)
+		}
+	}
+}
+
+func TestRedactingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewRedactingHandler(slog.NewTextHandler(&buf, nil)))
+	registerSecret("s3cr3t-value")
+	logger.With("token", "s3cr3t-value").Info("read s3cr3t-value", "error", errors.New("bad s3cr3t-value"), slog.Group("g", "v", "s3cr3t-value"))
+	if out := buf.String(); strings.Contains(out, "s3cr3t") || strings.Count(out, RedactedValue) != 4 {
+		t.Errorf("Expected secret to be redacted, got %s", out)
+	}
+}
+
+func TestRedactDiffFile(t *testing.T) {
+	registerSecret("diff-s3cr3t")
+	d := &DiffFile{Path: "a.txt", Action: PlanActionAdd, New: []byte("token=diff-s3cr3t\n")}
+	redacted := redactDiffFile(d)
+	if redacted.Old != nil || string(redacted.New) != "token="+RedactedValue+"\n" {
+		t.Errorf("Expected secret to be redacted, got %q, %q", redacted.Old, redacted.New)
+	}
+	if string(d.New) != "token=diff-s3cr3t\n" {
+		t.Errorf("Expected the diff file to be left unchanged, got %q", d.New)
+	}
+}
+
+func TestRunSecrets(t *testing.T) {
+	t.Setenv("RPACK_TEST_SECRET", "env-s3cr3t")
+	script := `local s = rpack.read("secret:db_password")
+rpack.write("./creds.txt", "password=" .. s .. "\n")
+assert(not pcall(rpack.write, "secret:db_password", "x"))
+assert(not pcall(rpack.read, "secret:unknown"))
+print("password is " .. s)
+`
+	config, workDir := setupRunConfig(t, script, "secrets:\n  db_password:\n    env: RPACK_TEST_SECRET\n")
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(NewRedactingHandler(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	audit := filepath.Join(t.TempDir(), "audit.json")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(workDir, "creds.txt")); err != nil || string(b) != "password=env-s3cr3t\n" { //nolint:gosec // test file
+		t.Errorf("Expected secret in generated file, got %q: %v", b, err)
+	}
+	if strings.Contains(logs.String(), "env-s3cr3t") || !strings.Contains(logs.String(), "password is "+RedactedValue) {
+		t.Errorf("Expected secret to be redacted in logs, got %s", logs.String())
+	}
+
+	// Diffs of files modified outside of rpack show the baseline with the secret redacted
+	if err := os.WriteFile(filepath.Join(workDir, "creds.txt"), []byte("changed\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	var diff bytes.Buffer
+	c := &Checker{DiffOutput: &diff}
+	if err := c.CheckIntegrity(t.Context(), config); !errors.Is(err, ErrLockModified) {
+		t.Fatalf("Expected ErrLockModified, got %v", err)
+	}
+	if strings.Contains(diff.String(), "env-s3cr3t") || !strings.Contains(diff.String(), "-password="+RedactedValue) {
+		t.Errorf("Expected secret to be redacted in diff, got %s", diff.String())
+	}
+
+	e := &Executor{AuditLog: audit, DryRun: true}
+	if err := e.ExecRPack(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(audit); err != nil || !strings.Contains(string(b), `"secret:db_password"`) { //nolint:gosec // test file
+		t.Errorf("Expected secret read in audit log, got %s: %v", b, err)
+	}
+
+	t.Setenv("RPACK_TEST_SECRET", "")
+	os.Unsetenv("RPACK_TEST_SECRET") //nolint:errcheck // restored by t.Setenv
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true}); err == nil || !strings.Contains(err.Error(), "RPACK_TEST_SECRET") {
+		t.Errorf("Expected missing environment variable to fail, got %v", err)
+	}
+}
+
+func TestRunSecretsSchema(t *testing.T) {
+	config, _ := setupRunConfig(t, "", "secrets:\n  bad:\n    env: A\n    sops: s.enc.yaml\n")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, DryRun: true}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected secret with env and sops to be invalid, got %v", err)
+	}
+}
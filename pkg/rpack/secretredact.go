@@ -0,0 +1,107 @@
+package rpack
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// revealedSecrets holds the secret values read by scripts, they are redacted in logs.
+var revealedSecrets struct {
+	sync.RWMutex
+	// values sorted longest first, so overlapping secrets are fully redacted
+	values []string
+}
+
+// registerSecret adds v to the values redacted in logs.
+func registerSecret(v string) {
+	if v == "" {
+		return
+	}
+	revealedSecrets.Lock()
+	defer revealedSecrets.Unlock()
+	if slices.Contains(revealedSecrets.values, v) {
+		return
+	}
+	revealedSecrets.values = append(revealedSecrets.values, v)
+	slices.SortStableFunc(revealedSecrets.values, func(a, b string) int {
+		return cmp.Compare(len(b), len(a))
+	})
+}
+
+// RedactSecrets replaces the values of secrets read so far in s by RedactedValue.
+func RedactSecrets(s string) string {
+	revealedSecrets.RLock()
+	defer revealedSecrets.RUnlock()
+	for _, v := range revealedSecrets.values {
+		s = strings.ReplaceAll(s, v, RedactedValue)
+	}
+	return s
+}
+
+// hasRevealedSecrets reports if any secret was read.
+func hasRevealedSecrets() bool {
+	revealedSecrets.RLock()
+	defer revealedSecrets.RUnlock()
+	return len(revealedSecrets.values) > 0
+}
+
+// redactingHandler redacts secret values in the message and attributes of log records.
+type redactingHandler struct {
+	slog.Handler
+}
+
+// NewRedactingHandler wraps h to redact the values of secrets read by scripts from all records.
+func NewRedactingHandler(h slog.Handler) slog.Handler {
+	return &redactingHandler{Handler: h}
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !hasRevealedSecrets() {
+		return h.Handler.Handle(ctx, r)
+	}
+	out := slog.NewRecord(r.Time, r.Level, RedactSecrets(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &redactingHandler{Handler: h.Handler.WithAttrs(redacted)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// redactAttr redacts secrets in the value of a, values that are not strings are redacted in their formatted form.
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactSecrets(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, ga := range group {
+			redacted[i] = redactAttr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		s := fmt.Sprint(v.Any())
+		if redacted := RedactSecrets(s); redacted != s {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	return a
+}
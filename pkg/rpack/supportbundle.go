@@ -0,0 +1,293 @@
+package rpack
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// supportBundleRoot is the directory all files of a support bundle are stored in.
+const supportBundleRoot = "rpack-support"
+
+// supportBundleMaxFileSize limits the size of definition files included in a support bundle.
+const supportBundleMaxFileSize = 1 << 20
+
+// supportBundleCrashReports is the number of most recent crash reports included.
+const supportBundleCrashReports = 5
+
+// SupportBundleOptions configures the contents of a support bundle.
+type SupportBundleOptions struct {
+	// ConfigFile to collect the bundle for
+	ConfigFile string
+	// Output is the path of the .tar.gz file to write
+	Output string
+	// Version of rpack recorded in the summary
+	Version string
+	// Reports is the number of most recent run reports to include
+	Reports int
+	// Lenient ignores unknown fields in the config, definitions and lockfile instead of failing
+	Lenient bool
+}
+
+// supportBundle collects the files of a support bundle in memory.
+type supportBundle struct {
+	files  map[string][]byte
+	notes  []string
+	loader Loader
+}
+
+func (b *supportBundle) add(name string, content []byte) {
+	b.files[path.Join(supportBundleRoot, name)] = content
+}
+
+func (b *supportBundle) note(format string, args ...any) {
+	b.notes = append(b.notes, fmt.Sprintf(format, args...))
+}
+
+// WriteSupportBundle collects the sanitized config, the definitions, the lockfile,
+// recent run reports, the run history, doctor results and crash reports of a config into a .tar.gz file
+// for attaching to issues. Values are redacted, see RedactValues, inputs are not included.
+// It returns the names of the files in the bundle.
+func WriteSupportBundle(ctx context.Context, opts SupportBundleOptions) ([]string, error) {
+	if opts.Reports < 0 {
+		return nil, fmt.Errorf("number of run reports must not be negative: %d: %w", opts.Reports, ErrValidation)
+	}
+	loader := Loader{Lenient: opts.Lenient}
+	ci, err := loader.LoadRPackConfig(opts.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load rpack config: %s: %w", opts.ConfigFile, err)
+	}
+	b := &supportBundle{files: make(map[string][]byte), loader: loader}
+
+	sanitized, err := b.addDefinitions(ci)
+	if err != nil {
+		return nil, err
+	}
+	config, err := yaml.Marshal(sanitized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sanitized config: %w", err)
+	}
+	b.add(filepath.Base(ci.ConfigFile), config)
+
+	if lock, err := os.ReadFile(ci.LockFilePath); err == nil { //nolint:gosec // lockfile next to the config
+		b.add(filepath.Base(ci.LockFilePath), lock)
+	} else {
+		b.note("no lockfile")
+	}
+
+	if err = b.addRunReports(ci, opts.Reports); err != nil {
+		return nil, err
+	}
+	// The history is the log of the runs, secrets are redacted from its errors when recorded
+	if history, err := os.ReadFile(HistoryFile(ci.ConfigPath, runReportConfigName(ci))); err == nil { //nolint:gosec // path is below the cache directory
+		b.add("history.jsonl", history)
+	} else {
+		b.note("no run history")
+	}
+	b.addCrashReports()
+
+	var doctor strings.Builder
+	for _, c := range RunDoctor(ctx, DoctorOptions{Dir: ci.ConfigPath, ConfigFile: ci.ConfigFile, Lenient: opts.Lenient}) {
+		fmt.Fprintln(&doctor, c)
+	}
+	b.add("doctor.txt", []byte(doctor.String()))
+
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(b.files)) {
+		names = append(names, strings.TrimPrefix(name, supportBundleRoot+"/"))
+	}
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "rpack support bundle\n\n")
+	fmt.Fprintf(&summary, "created:  %s\n", time.Now().UTC().Format(time.RFC3339))
+	version := opts.Version
+	if version == "" {
+		version = "-"
+	}
+	fmt.Fprintf(&summary, "version:  %s\n", version)
+	fmt.Fprintf(&summary, "go:       %s\n", runtime.Version())
+	fmt.Fprintf(&summary, "platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&summary, "config:   %s\n", filepath.Base(ci.ConfigFile))
+	fmt.Fprintf(&summary, "\nfiles:\n")
+	for _, name := range names {
+		fmt.Fprintf(&summary, "  %s\n", name)
+	}
+	if len(b.notes) > 0 {
+		fmt.Fprintf(&summary, "\nnotes:\n")
+		for _, n := range b.notes {
+			fmt.Fprintf(&summary, "  %s\n", n)
+		}
+	}
+	b.add("summary.txt", []byte(summary.String()))
+	names = append([]string{"summary.txt"}, names...)
+
+	if err = b.write(opts.Output); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// addDefinitions adds the fetched definition of each pack and returns
+// a copy of the config with the values redacted using the sensitive values of the definitions.
+func (b *supportBundle) addDefinitions(ci *RPackConfigInstance) (*RPackConfig, error) {
+	sanitized := *ci.Config
+	sanitized.Config = nil
+	sanitized.Packs = nil
+	for _, pack := range ci.Config.PackList() {
+		label := pack.Name
+		if label == "" {
+			label = "default"
+		}
+		var sensitive []string
+		defDir, err := cachedDefDir(ci.ConfigPath, pack)
+		if err == nil {
+			defDir, err = filepath.EvalSymlinks(defDir)
+		}
+		if err != nil {
+			b.note("definition of %s is not fetched, run rpack first: %s", label, pack.Source)
+		} else {
+			if def, defErr := b.loader.LoadRPackDef(filepath.Join(defDir, RPackDefDefaultFilename)); defErr == nil {
+				sensitive = def.SensitiveValues
+			}
+			if err = b.addDir(defDir, path.Join("definitions", label)); err != nil {
+				return nil, fmt.Errorf("failed to add definition of %s: %w", label, err)
+			}
+		}
+
+		p := *pack
+		if pack.Config != nil {
+			p.Config = &RPackConfigConfig{
+				Inputs: pack.Config.Inputs,
+				Values: RedactValues(pack.Config.Values, sensitive),
+			}
+		}
+		if len(ci.Config.Packs) == 0 {
+			sanitized.Config = p.Config
+		} else {
+			sanitized.Packs = append(sanitized.Packs, &p)
+		}
+	}
+	return &sanitized, nil
+}
+
+// addDir adds the regular files below dir, skipping tests, VCS metadata and large files.
+func (b *supportBundle) addDir(dir, prefix string) error {
+	return filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == "tests" || d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > supportBundleMaxFileSize {
+			b.note("skipped %s/%s, larger than %d bytes", prefix, rel, supportBundleMaxFileSize)
+			return nil
+		}
+		content, err := os.ReadFile(name) //nolint:gosec // path is below the definition directory
+		if err != nil {
+			return err
+		}
+		b.add(path.Join(prefix, rel), content)
+		return nil
+	})
+}
+
+// addRunReports adds the most recent run reports of the config.
+func (b *supportBundle) addRunReports(ci *RPackConfigInstance, n int) error {
+	matches, err := filepath.Glob(filepath.Join(RunReportDir(ci.ConfigPath, runReportConfigName(ci)), "*.json"))
+	if err != nil {
+		return err
+	}
+	// Ids sort chronologically
+	slices.Sort(matches)
+	if len(matches) > n {
+		matches = matches[len(matches)-n:]
+	}
+	for _, name := range matches {
+		content, err := os.ReadFile(name) //nolint:gosec // path is below the cache directory
+		if err != nil {
+			return fmt.Errorf("failed to read run report: %w", err)
+		}
+		b.add(path.Join("reports", filepath.Base(name)), content)
+	}
+	if len(matches) == 0 {
+		b.note("no run reports")
+	}
+	return nil
+}
+
+// addCrashReports adds the most recent crash reports, they are not specific to the config.
+func (b *supportBundle) addCrashReports() {
+	matches, _ := filepath.Glob(filepath.Join(CrashReportDir(), "crash-*.txt"))
+	slices.Sort(matches)
+	if len(matches) > supportBundleCrashReports {
+		matches = matches[len(matches)-supportBundleCrashReports:]
+	}
+	for _, name := range matches {
+		if content, err := os.ReadFile(name); err == nil { //nolint:gosec // path is below the crash report directory
+			b.add(path.Join("crash", filepath.Base(name)), content)
+		}
+	}
+}
+
+// write stores the bundle as a .tar.gz file.
+func (b *supportBundle) write(output string) (err error) {
+	if err = os.MkdirAll(filepath.Dir(output), 0o755); err != nil { //nolint:gosec // standard permissions
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+	f, err := os.Create(output) //nolint:gosec // intentional: path comes from user
+	if err != nil {
+		return fmt.Errorf("could not create support bundle: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("could not write support bundle: %w", closeErr)
+		}
+	}()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	for _, name := range slices.Sorted(maps.Keys(b.files)) {
+		content := b.files[name]
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: now, Typeflag: tar.TypeReg}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("could not write support bundle: %w", err)
+		}
+		if _, err = tw.Write(content); err != nil {
+			return fmt.Errorf("could not write support bundle: %w", err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("could not write support bundle: %w", err)
+	}
+	if err = gw.Close(); err != nil {
+		return fmt.Errorf("could not write support bundle: %w", err)
+	}
+	return nil
+}
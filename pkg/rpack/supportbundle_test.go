@@ -0,0 +1,128 @@
+package rpack
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSupportBundle(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir := t.TempDir()
+	config := filepath.Join(dir, "app.rpack.yaml")
+	if err := os.WriteFile(config, []byte(`"@schema_version": "v1"
+source: "./def"
+config:
+  values:
+    host: localhost
+    db_password: hunter2
+    conn: "postgres://u:p@h"
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defDir, err := cachedDefDir(dir, &RPackConfigPack{Source: "./def"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Join(defDir, "tests"), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		RPackDefDefaultFilename:   "\"@schema_version\": \"v1\"\nname: app\nsensitive_values: [conn]\n",
+		"script.lua":              "-- script\n",
+		"tests/fixture/input.txt": "fixture",
+	} {
+		if err = os.MkdirAll(filepath.Dir(filepath.Join(defDir, name)), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(defDir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	names, err := WriteSupportBundle(t.Context(), SupportBundleOptions{ConfigFile: config, Output: output, Version: "v1.0.0", Reports: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 || names[0] != "summary.txt" {
+		t.Errorf("Expected summary first, got %v", names)
+	}
+
+	files := readTarGz(t, output)
+	for _, name := range []string{"summary.txt", "app.rpack.yaml", "doctor.txt", "definitions/default/rpack.yaml", "definitions/default/script.lua"} {
+		if _, ok := files["rpack-support/"+name]; !ok {
+			t.Errorf("Missing %s in bundle", name)
+		}
+	}
+	if _, ok := files["rpack-support/definitions/default/tests/fixture/input.txt"]; ok {
+		t.Error("Expected definition tests to be skipped")
+	}
+	sanitized := files["rpack-support/app.rpack.yaml"]
+	for _, secret := range []string{"hunter2", "postgres://"} {
+		if strings.Contains(sanitized, secret) {
+			t.Errorf("Sanitized config contains %q:\n%s", secret, sanitized)
+		}
+	}
+	if !strings.Contains(sanitized, "localhost") {
+		t.Errorf("Expected non sensitive values to be kept:\n%s", sanitized)
+	}
+	summary := files["rpack-support/summary.txt"]
+	if !strings.Contains(summary, "v1.0.0") || !strings.Contains(summary, "no lockfile") || !strings.Contains(summary, "no run history") {
+		t.Errorf("Unexpected summary:\n%s", summary)
+	}
+
+	// The run history is the log of the runs
+	history := HistoryFile(dir, "app")
+	if err = os.MkdirAll(filepath.Dir(history), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(history, []byte("{\"error\":\"failed\"}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = WriteSupportBundle(t.Context(), SupportBundleOptions{ConfigFile: config, Output: output, Reports: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if files = readTarGz(t, output); files["rpack-support/history.jsonl"] != "{\"error\":\"failed\"}\n" {
+		t.Errorf("Expected the run history in the bundle, got %q", files["rpack-support/history.jsonl"])
+	}
+
+	if _, err = WriteSupportBundle(t.Context(), SupportBundleOptions{ConfigFile: config, Output: output, Reports: -1}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected a negative number of reports to be rejected, got %v", err)
+	}
+}
+
+func readTarGz(t *testing.T, name string) map[string]string {
+	t.Helper()
+	f, err := os.Open(name) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(b)
+	}
+	return files
+}
@@ -0,0 +1,146 @@
+package rpack
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template/parse"
+)
+
+// templateRefs are the data fields a template references relative to the data passed to it.
+type templateRefs struct {
+	// fields are chains of keys, e.g. [a b] for {{.a.b}} or {{$.a.b}}
+	fields [][]string
+	// wholeData is set if the template passes the data itself on, e.g. {{template "x" .}},
+	// every key may be used then
+	wholeData bool
+}
+
+// collectTemplateRefs walks the parse tree of a template.
+// Fields inside range and with blocks are relative to another value and not collected,
+// references through $ are.
+func collectTemplateRefs(tree *parse.Tree) *templateRefs {
+	refs := &templateRefs{}
+	if tree != nil {
+		refs.walk(tree.Root, true)
+	}
+	return refs
+}
+
+func (r *templateRefs) walk(node parse.Node, atRoot bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			r.walk(c, atRoot)
+		}
+	case *parse.ActionNode:
+		r.walkPipe(n.Pipe, atRoot)
+	case *parse.IfNode:
+		r.walkPipe(n.Pipe, atRoot)
+		r.walk(n.List, atRoot)
+		r.walk(n.ElseList, atRoot)
+	case *parse.RangeNode:
+		r.walkPipe(n.Pipe, atRoot)
+		r.walk(n.List, false)
+		r.walk(n.ElseList, atRoot)
+	case *parse.WithNode:
+		r.walkPipe(n.Pipe, atRoot)
+		r.walk(n.List, false)
+		r.walk(n.ElseList, atRoot)
+	case *parse.TemplateNode:
+		r.walkPipe(n.Pipe, atRoot)
+	}
+}
+
+func (r *templateRefs) walkPipe(pipe *parse.PipeNode, atRoot bool) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			r.walkArg(arg, atRoot)
+		}
+	}
+}
+
+func (r *templateRefs) walkArg(arg parse.Node, atRoot bool) {
+	switch n := arg.(type) {
+	case *parse.FieldNode:
+		if atRoot {
+			r.fields = append(r.fields, n.Ident)
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			if len(n.Ident) > 1 {
+				r.fields = append(r.fields, n.Ident[1:])
+			} else {
+				r.wholeData = true
+			}
+		}
+	case *parse.DotNode:
+		if atRoot {
+			r.wholeData = true
+		}
+	case *parse.ChainNode:
+		r.walkArg(n.Node, atRoot)
+	case *parse.PipeNode:
+		r.walkPipe(n, atRoot)
+	}
+}
+
+// templateLint is the result of linting a template against its data.
+type templateLint struct {
+	// Missing are the referenced fields absent from the data, e.g. ".a.b"
+	Missing []string
+	// Unused are the top-level keys of the data never referenced
+	Unused []string
+}
+
+// lintTemplate reports the fields the template references but data lacks, and the keys of data
+// it never references. Only maps are checked, other values are left to the execution.
+func lintTemplate(tree *parse.Tree, data any) *templateLint {
+	refs := collectTemplateRefs(tree)
+	res := &templateLint{}
+	root, ok := data.(map[string]any)
+	if !ok {
+		return res
+	}
+
+	referenced := make(map[string]struct{})
+	for _, field := range refs.fields {
+		referenced[field[0]] = struct{}{}
+		var cur any = root
+		for i, key := range field {
+			m, ok := cur.(map[string]any)
+			if !ok {
+				break
+			}
+			if cur, ok = m[key]; !ok {
+				res.Missing = append(res.Missing, "."+strings.Join(field[:i+1], "."))
+				break
+			}
+		}
+	}
+	res.Missing = slices.Compact(slices.Sorted(slices.Values(res.Missing)))
+
+	if !refs.wholeData {
+		for key := range root {
+			if _, ok := referenced[key]; !ok {
+				res.Unused = append(res.Unused, key)
+			}
+		}
+		slices.Sort(res.Unused)
+	}
+	return res
+}
+
+// missingError returns an error naming the missing fields, nil if there are none.
+func (l *templateLint) missingError() error {
+	if len(l.Missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("template references fields missing from data: %s", strings.Join(l.Missing, ", "))
+}
@@ -0,0 +1,97 @@
+package rpack
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestLintTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		data    any
+		missing []string
+		unused  []string
+	}{
+		{
+			name: "all used",
+			tmpl: "{{.name}} {{.user.email}}",
+			data: map[string]any{"name": "a", "user": map[string]any{"email": "b"}},
+		},
+		{
+			name:    "typo",
+			tmpl:    "{{.nmae}} {{.user.emial}}",
+			data:    map[string]any{"name": "a", "user": map[string]any{"email": "b"}},
+			missing: []string{".nmae", ".user.emial"},
+			unused:  []string{"name"},
+		},
+		{
+			name: "range body is relative",
+			tmpl: "{{range .items}}{{.id}} {{$.prefix}}{{end}}",
+			data: map[string]any{"items": []any{}, "prefix": "p"},
+		},
+		{
+			name:    "conditions and else",
+			tmpl:    "{{if .enabled}}{{.on}}{{else}}{{.off}}{{end}}",
+			data:    map[string]any{"enabled": true, "on": "x", "extra": 1},
+			missing: []string{".off"},
+			unused:  []string{"extra"},
+		},
+		{
+			name: "whole data passed on",
+			tmpl: `{{define "x"}}{{.a}}{{end}}{{template "x" .}}`,
+			data: map[string]any{"a": 1, "b": 2},
+		},
+		{
+			name: "arguments of functions",
+			tmpl: `{{printf "%s-%s" .a (print .b)}}`,
+			data: map[string]any{"a": 1, "b": 2},
+		},
+		{
+			name: "list data is not checked",
+			tmpl: "{{index . 0}}",
+			data: []any{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := template.Must(template.New("tpl").Parse(tt.tmpl))
+			res := lintTemplate(tmpl.Tree, tt.data)
+			if !slices.Equal(res.Missing, tt.missing) {
+				t.Errorf("missing: got %v, want %v", res.Missing, tt.missing)
+			}
+			if !slices.Equal(res.Unused, tt.unused) {
+				t.Errorf("unused: got %v, want %v", res.Unused, tt.unused)
+			}
+		})
+	}
+}
+
+func TestExecuteLuaLintTemplates(t *testing.T) {
+	script := `local rpack = require("rpack.v1")
+rpack.write("out.txt", rpack.template("{{.name}}", {name = "a", unused = "b"}))
+`
+	res, err := ExecuteLuaWithOptions(t.Context(), script, NewInMemoryFS(), nil, LuaOptions{LintTemplates: true})
+	if err != nil {
+		t.Fatalf("Script failed: %s", err)
+	}
+	if len(res.Annotations) != 1 || res.Annotations[0].Message != `script.lua:2: template data key "unused" is never referenced` {
+		t.Fatalf("unexpected annotations: %+v", res.Annotations)
+	}
+
+	script = `local rpack = require("rpack.v1")
+rpack.template("{{.nmae}}", {name = "a"})
+`
+	_, err = ExecuteLuaWithOptions(t.Context(), script, NewInMemoryFS(), nil, LuaOptions{LintTemplates: true})
+	if err == nil || !strings.Contains(err.Error(), "template references fields missing from data: .nmae") {
+		t.Fatalf("expected missing field error, got %v", err)
+	}
+
+	// Without linting the typo renders <no value>
+	res, err = ExecuteLua(t.Context(), script, NewInMemoryFS(), nil)
+	if err != nil || len(res.Annotations) != 0 {
+		t.Fatalf("expected no findings without linting, got %v, %+v", err, res.Annotations)
+	}
+}
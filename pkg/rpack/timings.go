@@ -0,0 +1,59 @@
+package rpack
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// Phases of a run measured in api.RunResult.Timings.
+const (
+	// TimingPhaseFetch fetches and loads the definition of a pack
+	TimingPhaseFetch = "fetch"
+	// TimingPhaseValidate validates the config, values and inputs of all packs
+	TimingPhaseValidate = "validate"
+	// TimingPhaseExec runs the script of a pack
+	TimingPhaseExec = "exec"
+	// TimingPhaseChecksum calculates the checksums of the generated files
+	TimingPhaseChecksum = "checksum"
+	// TimingPhaseApply moves the generated files to the target, removes deprecated files,
+	// runs the verify commands and writes the lockfile
+	TimingPhaseApply = "apply"
+)
+
+// runTimings records the durations of the phases of a run, packs executed in parallel record concurrently.
+// A nil runTimings records nothing.
+type runTimings struct {
+	mu     sync.Mutex
+	phases []*api.PhaseTiming
+}
+
+// record adds the duration of phase of pack, d is rounded to milliseconds.
+func (t *runTimings) record(phase, pack string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, &api.PhaseTiming{Phase: phase, Pack: pack, DurationMs: d.Round(time.Millisecond).Milliseconds()})
+}
+
+// list returns the recorded timings in the order the phases finished.
+func (t *runTimings) list() []*api.PhaseTiming {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.phases)
+}
+
+// log writes the recorded timings to the debug log, one record per phase.
+func (t *runTimings) log(log *slog.Logger) {
+	for _, p := range t.list() {
+		log.Debug("Phase timing", "phase", p.Phase, "pack", p.Pack, "duration_ms", p.DurationMs)
+	}
+}
@@ -0,0 +1,53 @@
+package rpack
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestRunTimings(t *testing.T) {
+	config, _ := setupRunConfig(t, "rpack.write(\"./out.txt\", \"hello\\n\")\n", "")
+	for _, tc := range []struct {
+		name   string
+		opts   api.RunOptions
+		phases []string
+	}{
+		{
+			name:   "dry-run",
+			opts:   api.RunOptions{ConfigFile: config, DryRun: true},
+			phases: []string{TimingPhaseFetch, TimingPhaseValidate, TimingPhaseExec, TimingPhaseChecksum},
+		},
+		{
+			name:   "apply",
+			opts:   api.RunOptions{ConfigFile: config},
+			phases: []string{TimingPhaseFetch, TimingPhaseValidate, TimingPhaseExec, TimingPhaseChecksum, TimingPhaseApply},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := Run(t.Context(), tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var phases []string
+			for _, p := range res.Timings {
+				if p.DurationMs < 0 {
+					t.Errorf("Expected a duration for %s, got %d", p.Phase, p.DurationMs)
+				}
+				phases = append(phases, p.Phase)
+			}
+			if !slices.Equal(phases, tc.phases) {
+				t.Fatalf("Expected phases %v, got %v", tc.phases, phases)
+			}
+		})
+	}
+}
+
+func TestRunTimingsNil(t *testing.T) {
+	var timings *runTimings
+	timings.record(TimingPhaseExec, "", 0)
+	if got := timings.list(); got != nil {
+		t.Errorf("Expected no timings, got %v", got)
+	}
+}
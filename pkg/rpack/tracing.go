@@ -0,0 +1,90 @@
+package rpack
+
+import (
+	"context"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation scope of the OpenTelemetry spans of rpack.
+const TracerName = "github.com/blang/rpack"
+
+// tracer creates the spans of runs, their phases and the Lua host functions with the global tracer provider.
+// Nothing is recorded unless the application installs a provider, see otel.SetTracerProvider.
+var tracer = otel.Tracer(TracerName)
+
+// startPhase starts the span of a phase of a run. The returned function ends it, records the duration
+// in the timings of the run and returns it. Calling it again has no effect and returns the same duration.
+func (e *Executor) startPhase(ctx context.Context, phase, pack string) (context.Context, func() time.Duration) {
+	start := time.Now()
+	var attrs []attribute.KeyValue
+	if pack != "" {
+		attrs = append(attrs, attribute.String("rpack.pack", pack))
+	}
+	ctx, span := tracer.Start(ctx, "rpack."+phase, trace.WithAttributes(attrs...))
+	var d time.Duration
+	ended := false
+	return ctx, func() time.Duration {
+		if !ended {
+			ended = true
+			d = time.Since(start)
+			e.timings.record(phase, pack, d)
+			span.End()
+		}
+		return d
+	}
+}
+
+// endSpan ends span and marks it failed if err is set, secrets are redacted from the error.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, RedactSecrets(err.Error()))
+	}
+	span.End()
+}
+
+// tracedLuaFuncs are the functions of the rpack module called within a span each.
+// The first argument, the path or jq query, is recorded as attribute.
+var tracedLuaFuncs = map[string]string{
+	"read":        "rpack.path",
+	"read_bytes":  "rpack.path",
+	"write":       "rpack.path",
+	"write_bytes": "rpack.path",
+	"write_json":  "rpack.path",
+	"write_yaml":  "rpack.path",
+	"append":      "rpack.path",
+	"patch":       "rpack.path",
+	"copy":        "rpack.path",
+	"template":    "",
+	"jq":          "rpack.jq.query",
+}
+
+// traceLuaFunc wraps the Lua host function name in a span, if the script runs within a recorded span.
+// Errors raised by fn mark the span failed.
+func traceLuaFunc(name, attr string, fn lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		ctx := L.Context()
+		if ctx == nil || !trace.SpanFromContext(ctx).IsRecording() {
+			return fn(L)
+		}
+		_, span := tracer.Start(ctx, "lua.rpack."+name)
+		if s, ok := L.Get(1).(lua.LString); ok && attr != "" {
+			span.SetAttributes(attribute.String(attr, string(s)))
+		}
+		failed := true
+		defer func() {
+			if failed {
+				span.SetStatus(codes.Error, "lua error")
+			}
+			span.End()
+		}()
+		n := fn(L)
+		failed = false
+		return n
+	}
+}
@@ -0,0 +1,49 @@
+package rpack
+
+import (
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestRunTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	config, _ := setupRunConfig(t, "rpack.write(\"./out.txt\", rpack.template(\"{{ .name }}\", {name = \"x\"}))\npcall(rpack.read, \"map:missing\")\n", "")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	for _, name := range []string{"rpack.run", "rpack.fetch", "rpack.validate", "rpack.exec", "rpack.checksum", "rpack.apply", "lua.rpack.write", "lua.rpack.template", "lua.rpack.read"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("Expected span %s, got %v", name, spans)
+		}
+	}
+	run, exec, write, read := spans["rpack.run"], spans["rpack.exec"], spans["lua.rpack.write"], spans["lua.rpack.read"]
+	if run == nil || exec == nil || write == nil || read == nil {
+		t.FailNow()
+	}
+	if exec.Parent().SpanID() != run.SpanContext().SpanID() || write.Parent().SpanID() != exec.SpanContext().SpanID() {
+		t.Error("Expected the Lua calls within the exec span within the run span")
+	}
+	if !slices.Contains(write.Attributes(), attribute.String("rpack.path", "./out.txt")) {
+		t.Errorf("Expected the path of the write, got %v", write.Attributes())
+	}
+	if read.Status().Code != codes.Error {
+		t.Errorf("Expected the failed read marked, got %v", read.Status())
+	}
+}
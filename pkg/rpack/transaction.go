@@ -0,0 +1,160 @@
+package rpack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/blang/rpack/pkg/rpack/util"
+)
+
+// applyTransaction records the changes of an apply to the target, so they can be rolled back.
+// Replaced and removed files are moved to a backup directory in the cache directory of the
+// target, which is on the same filesystem, so moving is cheap.
+type applyTransaction struct {
+	execPath  string
+	backupDir string
+	// touched lists target paths changed by the transaction, in order
+	touched []string
+	// backedUp holds the touched paths whose previous content is in the backup directory
+	backedUp map[string]struct{}
+	// dirs lists directories created by the transaction, in order
+	dirs []string
+	log  *slog.Logger
+}
+
+func newApplyTransaction(execPath string, log *slog.Logger) (*applyTransaction, error) {
+	cacheDir := filepath.Join(execPath, RPackCacheDir)
+	if err := os.MkdirAll(util.LongPath(cacheDir), 0o755); err != nil { //nolint:gosec // standard permissions
+		return nil, fmt.Errorf("could not create cache directory: %s: %w", cacheDir, err)
+	}
+	backupDir, err := os.MkdirTemp(util.LongPath(cacheDir), "backup-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create backup directory: %w", err)
+	}
+	return &applyTransaction{execPath: execPath, backupDir: backupDir, backedUp: make(map[string]struct{}), log: log}, nil
+}
+
+// mkdirAll creates dir and its parents, remembering the directories that did not exist.
+func (t *applyTransaction) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(util.LongPath(d)); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := os.MkdirAll(util.LongPath(dir), 0o755); err != nil { //nolint:gosec // standard permissions
+		return err
+	}
+	slices.Reverse(missing)
+	t.dirs = append(t.dirs, missing...)
+	return nil
+}
+
+// backup moves the target file rel to the backup directory if it exists.
+// rel is only recorded as touched once nothing is left to back up, so a rollback
+// never removes a file whose previous content is not in the backup directory.
+func (t *applyTransaction) backup(rel string) error {
+	target := util.LongPath(filepath.Join(t.execPath, rel))
+	if _, err := os.Lstat(target); os.IsNotExist(err) {
+		t.touched = append(t.touched, rel)
+		return nil
+	}
+	backup := filepath.Join(t.backupDir, rel)
+	if err := os.MkdirAll(filepath.Dir(backup), 0o755); err != nil { //nolint:gosec // standard permissions
+		return err
+	}
+	if err := os.Rename(target, backup); err != nil {
+		return err
+	}
+	t.touched = append(t.touched, rel)
+	t.backedUp[rel] = struct{}{}
+	return nil
+}
+
+// put moves the generated file src to the target path rel.
+func (t *applyTransaction) put(src, rel string) error {
+	targetFile := filepath.Join(t.execPath, rel)
+	if err := t.mkdirAll(filepath.Dir(targetFile)); err != nil {
+		return fmt.Errorf("failed to create dirs for: %s: %w", targetFile, err)
+	}
+	if err := t.backup(rel); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", rel, err)
+	}
+	if err := os.Rename(util.LongPath(src), util.LongPath(targetFile)); err != nil {
+		return fmt.Errorf("failed to move file %s to exec path %s: %w", rel, t.execPath, err)
+	}
+	return nil
+}
+
+// remove removes the target file rel.
+func (t *applyTransaction) remove(rel string) error {
+	if err := t.backup(rel); err != nil {
+		return fmt.Errorf("could not remove deprecated file: %s: %w", rel, err)
+	}
+	return nil
+}
+
+// removeBlocks removes the managed blocks named markers from the target file rel,
+// the file is removed if nothing else remains.
+func (t *applyTransaction) removeBlocks(rel string, markers []string) error {
+	target := util.LongPath(filepath.Join(t.execPath, rel))
+	content, err := os.ReadFile(target) //nolint:gosec // path constructed from exec path
+	if err != nil {
+		return fmt.Errorf("could not remove managed blocks of: %s: %w", rel, err)
+	}
+	stripped := stripManagedBlocks(content, markers)
+	if len(bytes.TrimSpace(stripped)) == 0 {
+		return t.remove(rel)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("could not remove managed blocks of: %s: %w", rel, err)
+	}
+	src := filepath.Join(t.backupDir, ".blocks-"+filepath.Base(rel))
+	if err = os.WriteFile(src, stripped, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("could not remove managed blocks of: %s: %w", rel, err)
+	}
+	return t.put(src, rel)
+}
+
+// rollback restores the target as it was before the transaction.
+func (t *applyTransaction) rollback() error {
+	var errs []error
+	for i := len(t.touched) - 1; i >= 0; i-- {
+		rel := t.touched[i]
+		target := util.LongPath(filepath.Join(t.execPath, rel))
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+			continue
+		}
+		if _, ok := t.backedUp[rel]; ok {
+			if err := os.Rename(filepath.Join(t.backupDir, rel), target); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			delete(t.backedUp, rel)
+		}
+	}
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		if err := os.Remove(util.LongPath(t.dirs[i])); err != nil && !os.IsNotExist(err) {
+			t.log.Debug("Could not remove directory created by the apply", "dir", t.dirs[i], "error", err)
+		}
+	}
+	if len(errs) > 0 {
+		// Keep the backups that could not be restored
+		return fmt.Errorf("rollback failed, backups are kept in %s: %w", t.backupDir, errors.Join(errs...))
+	}
+	t.log.Info("Rolled back the apply", "files", len(t.touched))
+	return os.RemoveAll(t.backupDir)
+}
+
+// commit removes the backups.
+func (t *applyTransaction) commit() error {
+	return os.RemoveAll(t.backupDir)
+}
@@ -0,0 +1,46 @@
+package rpack
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyTransactionFailedBackup(t *testing.T) {
+	execPath := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(execPath, "dir"), 0o755); err != nil { //nolint:gosec // test dir
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": "old a\n", "dir/b.txt": "old b\n"} {
+		if err := os.WriteFile(filepath.Join(execPath, filepath.FromSlash(name)), []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+	}
+	tx, err := newApplyTransaction(execPath, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "a.txt")
+	if err = os.WriteFile(src, []byte("new a\n"), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if err = tx.put(src, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// A file in place of the backup directory of dir/ makes the backup of dir/b.txt fail
+	if err = os.WriteFile(filepath.Join(tx.backupDir, "dir"), nil, 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if err = tx.remove("dir/b.txt"); err == nil {
+		t.Fatal("Expected the backup to fail")
+	}
+	if err = tx.rollback(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"a.txt": "old a\n", "dir/b.txt": "old b\n"} {
+		if b, err := os.ReadFile(filepath.Join(execPath, filepath.FromSlash(name))); err != nil || string(b) != want { //nolint:gosec // test file
+			t.Errorf("Expected %s restored to %q, got %q, %v", name, want, b, err)
+		}
+	}
+}
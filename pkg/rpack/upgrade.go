@@ -0,0 +1,275 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// UpgradeOptions configures the search for newer source versions.
+type UpgradeOptions struct {
+	// Pack limits the upgrade to a pack of a multi-pack config, optional
+	Pack string
+
+	// Prerelease allows upgrades to prerelease tags like v2.0.0-rc.1
+	Prerelease bool
+}
+
+// SourceUpgrade is a newer tag available for the source of a pack.
+type SourceUpgrade struct {
+	// Pack name, empty for single source configs
+	Pack      string
+	OldSource string
+	NewSource string
+	OldRef    string
+	NewRef    string
+}
+
+// canonicalSemver returns the tag as semver with v prefix, or empty if it is none.
+func canonicalSemver(tag string) string {
+	v := tag
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if !semver.IsValid(v) {
+		return ""
+	}
+	return v
+}
+
+// latestTag returns the highest semver tag greater than current.
+// Tags keep the prefix style of current, e.g. tags without v are ignored for v1.0.0.
+func latestTag(current string, tags []string, prerelease bool) (string, bool) {
+	cur := canonicalSemver(current)
+	if cur == "" {
+		return "", false
+	}
+	hasV := strings.HasPrefix(current, "v")
+	best, bestVer := "", cur
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, "v") != hasV {
+			continue
+		}
+		v := canonicalSemver(tag)
+		if v == "" || semver.Build(v) != "" {
+			continue
+		}
+		if semver.Prerelease(v) != "" && !prerelease {
+			continue
+		}
+		if semver.Compare(v, bestVer) > 0 {
+			best, bestVer = tag, v
+		}
+	}
+	return best, best != ""
+}
+
+// listRemoteTags returns the tag names of a git repository.
+func listRemoteTags(ctx context.Context, repo string) ([]string, error) {
+	out, err := runGit(ctx, "", "ls-remote", "--tags", "--refs", repo)
+	if err != nil {
+		return nil, fmt.Errorf("could not list tags of %s: %w", repo, err)
+	}
+	var tags []string
+	for line := range strings.Lines(out) {
+		_, ref, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok {
+			continue
+		}
+		if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// replaceSourceRef replaces the ref query parameter of a source address.
+func replaceSourceRef(src, oldRef, newRef string) (string, error) {
+	re := regexp.MustCompile(`([?&]ref=)` + regexp.QuoteMeta(url.QueryEscape(oldRef)) + `(&|$)`)
+	if !re.MatchString(src) {
+		return "", fmt.Errorf("ref %q not found in source %q", oldRef, src)
+	}
+	return re.ReplaceAllString(src, "${1}"+strings.ReplaceAll(url.QueryEscape(newRef), "$", "$$")+"${2}"), nil
+}
+
+// FindSourceUpgrades queries the remotes of git sources pinned to a semver tag for newer tags.
+// Sources without git ref or with a ref that is not a semver tag are skipped.
+func FindSourceUpgrades(ctx context.Context, ci *RPackConfigInstance, opts UpgradeOptions) ([]*SourceUpgrade, error) {
+	found := false
+	var upgrades []*SourceUpgrade
+	tagsByRepo := make(map[string][]string)
+	for _, pack := range ci.Config.PackList() {
+		if opts.Pack != "" && pack.Name != opts.Pack {
+			continue
+		}
+		found = true
+		src, err := parseGitSource(pack.Source)
+		if err != nil || src.Ref == "" || canonicalSemver(src.Ref) == "" {
+			continue
+		}
+		tags, ok := tagsByRepo[src.Repo]
+		if !ok {
+			if tags, err = listRemoteTags(ctx, src.Repo); err != nil {
+				return nil, packErr(pack, err)
+			}
+			tagsByRepo[src.Repo] = tags
+		}
+		tag, ok := latestTag(src.Ref, tags, opts.Prerelease)
+		if !ok {
+			continue
+		}
+		newSource, err := replaceSourceRef(pack.Source, src.Ref, tag)
+		if err != nil {
+			return nil, packErr(pack, err)
+		}
+		upgrades = append(upgrades, &SourceUpgrade{
+			Pack:      pack.Name,
+			OldSource: pack.Source,
+			NewSource: newSource,
+			OldRef:    src.Ref,
+			NewRef:    tag,
+		})
+	}
+	if opts.Pack != "" && !found {
+		return nil, fmt.Errorf("pack %q not found in config", opts.Pack)
+	}
+	return upgrades, nil
+}
+
+// UpgradedConfig returns a copy of the config instance with the upgraded sources.
+func UpgradedConfig(ci *RPackConfigInstance, upgrades []*SourceUpgrade) *RPackConfigInstance {
+	config := *ci.Config
+	upgraded := *ci
+	upgraded.Config = &config
+	newSource := func(name, src string) string {
+		for _, u := range upgrades {
+			if u.Pack == name && u.OldSource == src {
+				return u.NewSource
+			}
+		}
+		return src
+	}
+	if len(config.Packs) == 0 {
+		config.Source = newSource("", config.Source)
+		return &upgraded
+	}
+	config.Packs = make([]*RPackConfigPack, len(ci.Config.Packs))
+	for i, p := range ci.Config.Packs {
+		pack := *p
+		pack.Source = newSource(pack.Name, pack.Source)
+		config.Packs[i] = &pack
+	}
+	return &upgraded
+}
+
+// WriteSourceUpgrades rewrites the source pins in the config file.
+// Only the source scalars of the upgraded packs are replaced in the text to preserve comments and formatting.
+func WriteSourceUpgrades(ci *RPackConfigInstance, upgrades []*SourceUpgrade) error {
+	b, err := os.ReadFile(ci.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+	var root yaml.Node
+	if err = yaml.Unmarshal(b, &root); err != nil {
+		return fmt.Errorf("could not parse config: %s: %w", ci.ConfigFile, err)
+	}
+	type edit struct {
+		start, end int
+		source     string
+	}
+	edits := make([]edit, 0, len(upgrades))
+	for _, u := range upgrades {
+		n := yamlSourceNode(&root, u.Pack)
+		if n == nil || n.Kind != yaml.ScalarNode || n.Value != u.OldSource {
+			return fmt.Errorf("could not locate source %q in %s", u.OldSource, ci.ConfigFile)
+		}
+		start := yamlOffset(b, n.Line, n.Column)
+		if n.Style == yaml.DoubleQuotedStyle || n.Style == yaml.SingleQuotedStyle {
+			start++
+		}
+		end := start + len(u.OldSource)
+		// Scalars with escapes or folded over lines are not edited
+		if start < 0 || end > len(b) || string(b[start:end]) != u.OldSource {
+			return fmt.Errorf("could not locate source %q in %s", u.OldSource, ci.ConfigFile)
+		}
+		edits = append(edits, edit{start: start, end: end, source: u.NewSource})
+	}
+	// Edit from the end so the offsets of earlier edits stay valid
+	slices.SortFunc(edits, func(a, b edit) int { return b.start - a.start })
+	for _, e := range edits {
+		b = slices.Concat(b[:e.start], []byte(e.source), b[e.end:])
+	}
+	info, err := os.Stat(ci.ConfigFile)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(ci.ConfigFile, b, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("could not write config: %w", err)
+	}
+	return nil
+}
+
+// yamlSourceNode returns the value node of the source of pack in the config document root,
+// the top-level source for the empty pack name. It returns nil if there is none.
+func yamlSourceNode(root *yaml.Node, pack string) *yaml.Node {
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	if pack == "" {
+		return yamlMappingValue(n, "source")
+	}
+	packs := yamlMappingValue(n, "packs")
+	if packs == nil || packs.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, p := range packs.Content {
+		if name := yamlMappingValue(p, "name"); name != nil && name.Value == pack {
+			return yamlMappingValue(p, "source")
+		}
+	}
+	return nil
+}
+
+// yamlMappingValue returns the value of key in the mapping node n, nil if n is no mapping or lacks key.
+func yamlMappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlOffset returns the byte offset of the 1-based line and column of a YAML node in b, -1 if out of range.
+// Columns count characters.
+func yamlOffset(b []byte, line, col int) int {
+	off := 0
+	for range line - 1 {
+		i := bytes.IndexByte(b[off:], '\n')
+		if i < 0 {
+			return -1
+		}
+		off += i + 1
+	}
+	for range col - 1 {
+		if off >= len(b) || b[off] == '\n' {
+			return -1
+		}
+		_, size := utf8.DecodeRune(b[off:])
+		off += size
+	}
+	return off
+}
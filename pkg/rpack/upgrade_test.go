@@ -0,0 +1,139 @@
+package rpack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLatestTag(t *testing.T) {
+	tags := []string{"v1.0.0", "v1.1.0", "v1.2.0+meta", "v2.0.0-rc.1", "1.5.0", "latest"}
+	tests := []struct {
+		current    string
+		prerelease bool
+		want       string
+		ok         bool
+	}{
+		{"v1.0.0", false, "v1.1.0", true},
+		{"v1.0.0", true, "v2.0.0-rc.1", true},
+		{"v1.1.0", false, "", false},
+		{"1.0.0", false, "1.5.0", true},
+		{"main", false, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := latestTag(tt.current, tags, tt.prerelease)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("latestTag(%q, pre=%t) = %q, %t, expected %q, %t", tt.current, tt.prerelease, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReplaceSourceRef(t *testing.T) {
+	got, err := replaceSourceRef("git::https://example.com/def.git//sub?ref=v1.0.0&depth=1", "v1.0.0", "v1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "git::https://example.com/def.git//sub?ref=v1.2.0&depth=1" {
+		t.Errorf("Unexpected source: %s", got)
+	}
+	if _, err = replaceSourceRef("git::https://example.com/def.git?ref=v1.0.0.1", "v1.0.0", "v1.2.0"); err == nil {
+		t.Errorf("Expected error for partial ref match")
+	}
+}
+
+func TestFindSourceUpgrades(t *testing.T) {
+	repo, _ := setupBisectRepo(t, []string{"a", "b", "c"})
+	for _, tag := range []string{"v1.0.0", "v1.1.0", "v2.0.0-rc.1"} {
+		if _, err := runGit(t.Context(), repo, "tag", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := "git::file://" + filepath.ToSlash(repo) + "//def"
+	config := filepath.Join(t.TempDir(), "app.rpack.yaml")
+	content := "\"@schema_version\": \"v1\"\npacks:\n" +
+		"  # pinned\n" +
+		"  - name: pinned\n    source: \"" + source + "?ref=v1.0.0\"\n" +
+		"  - name: latest\n    source: \"" + source + "?ref=v1.1.0\"\n" +
+		"  - name: branch\n    source: \"" + source + "?ref=main\"\n"
+	if err := os.WriteFile(config, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ci, err := LoadRPackConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upgrades, err := FindSourceUpgrades(t.Context(), ci, UpgradeOptions{})
+	if err != nil {
+		t.Fatalf("FindSourceUpgrades failed: %s", err)
+	}
+	if len(upgrades) != 1 || upgrades[0].Pack != "pinned" || upgrades[0].NewRef != "v1.1.0" {
+		t.Fatalf("Unexpected upgrades: %+v", upgrades)
+	}
+	pre, err := FindSourceUpgrades(t.Context(), ci, UpgradeOptions{Pack: "latest", Prerelease: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pre) != 1 || pre[0].NewRef != "v2.0.0-rc.1" {
+		t.Errorf("Expected prerelease upgrade: %+v", pre)
+	}
+	if _, err = FindSourceUpgrades(t.Context(), ci, UpgradeOptions{Pack: "missing"}); err == nil {
+		t.Errorf("Expected error for unknown pack")
+	}
+
+	upgraded := UpgradedConfig(ci, upgrades)
+	if upgraded.Config.Packs[0].Source != source+"?ref=v1.1.0" || ci.Config.Packs[0].Source != source+"?ref=v1.0.0" {
+		t.Errorf("Expected upgraded copy without modifying original")
+	}
+
+	if err = WriteSourceUpgrades(ci, upgrades); err != nil {
+		t.Fatalf("WriteSourceUpgrades failed: %s", err)
+	}
+	b, err := os.ReadFile(config) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(content, "?ref=v1.0.0", "?ref=v1.1.0", 1)
+	if string(b) != expected {
+		t.Errorf("Unexpected config:\n%s", b)
+	}
+}
+
+func TestWriteSourceUpgrades(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "app.rpack.yaml")
+	content := "\"@schema_version\": \"v1\"\npacks:\n" +
+		"  - name: a # source: git::https://example.com/repo?ref=v1.0.0\n    source: git::https://example.com/repo?ref=v1.0.0\n" +
+		"  - name: b\n    source: 'git::https://example.com/repo?ref=v1.0.0'\n" +
+		"  - name: c\n    source: \"git::https://example.com/repo?ref=v1.0.0\"\n"
+	if err := os.WriteFile(config, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ci, err := LoadRPackConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Packs sharing the old source are only rewritten if they are upgraded
+	upgrades := []*SourceUpgrade{
+		{Pack: "a", OldSource: "git::https://example.com/repo?ref=v1.0.0", NewSource: "git::https://example.com/repo?ref=v1.1.0"},
+		{Pack: "c", OldSource: "git::https://example.com/repo?ref=v1.0.0", NewSource: "git::https://example.com/repo?ref=v1.1.0"},
+	}
+	if err = WriteSourceUpgrades(ci, upgrades); err != nil {
+		t.Fatalf("WriteSourceUpgrades failed: %s", err)
+	}
+	b, err := os.ReadFile(config) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "\"@schema_version\": \"v1\"\npacks:\n" +
+		"  - name: a # source: git::https://example.com/repo?ref=v1.0.0\n    source: git::https://example.com/repo?ref=v1.1.0\n" +
+		"  - name: b\n    source: 'git::https://example.com/repo?ref=v1.0.0'\n" +
+		"  - name: c\n    source: \"git::https://example.com/repo?ref=v1.1.0\"\n"
+	if string(b) != expected {
+		t.Errorf("Unexpected config:\n%s", b)
+	}
+
+	if err = WriteSourceUpgrades(ci, []*SourceUpgrade{{Pack: "missing", OldSource: "x", NewSource: "y"}}); err == nil {
+		t.Error("Expected error for unknown pack")
+	}
+}
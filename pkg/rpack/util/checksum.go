@@ -5,8 +5,12 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sync"
 )
 
 // Sha256String returns the SHA-256 hash of a string.
@@ -31,16 +35,80 @@ func Sha256File(name string) (sha string, err error) {
 			err = err2
 		}
 	}()
+	return Sha256Reader(file)
+}
 
-	// Create a new SHA256 hash.
-	hasher := sha256.New()
+// Sha256Reader calculates the hex-encoded SHA256 checksum of everything read from r.
+func Sha256Reader(r io.Reader) (string, error) {
+	return CopySha256(io.Discard, r)
+}
 
-	// Copy the file contents into the hasher. This approach is efficient and
-	// automatically uses an internal buffer.
-	if _, err := io.Copy(hasher, file); err != nil {
+// CopySha256 copies src to dst like io.Copy and returns the hex-encoded SHA256 checksum of the
+// copied bytes, so content is hashed while it is written instead of reading it again afterwards.
+// The copy buffer and the hash are pooled, checksumming thousands of files does not allocate for each.
+func CopySha256(dst io.Writer, src io.Reader) (string, error) {
+	h, _ := hashPool.Get().(hash.Hash)
+	defer func() {
+		h.Reset()
+		hashPool.Put(h)
+	}()
+	if _, err := CopyBuffer(io.MultiWriter(dst, h), src); err != nil {
 		return "", err
 	}
+	var sum [sha256.Size]byte
+	return hex.EncodeToString(h.Sum(sum[:0])), nil
+}
+
+// CopyBuffer is io.Copy with a pooled buffer.
+// The buffer is always used, io.WriterTo and io.ReaderFrom of src and dst would allocate their own.
+func CopyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	buf, _ := bufPool.Get().(*[]byte)
+	defer bufPool.Put(buf)
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// copyBufferSize is the size of pooled copy buffers, larger than the 32KiB of io.Copy
+// to need fewer syscalls for large files.
+const copyBufferSize = 128 << 10
+
+var (
+	bufPool = sync.Pool{New: func() any {
+		b := make([]byte, copyBufferSize)
+		return &b
+	}}
+	hashPool = sync.Pool{New: func() any { return sha256.New() }}
+)
 
-	// Return the hex-encoded checksum string.
+// Sha256Dir calculates a SHA256 checksum over all regular files in dir.
+// The checksum covers the relative paths and contents, so renames are detected too.
+// Symlinks to directories are not followed, dir itself may be a symlink.
+func Sha256Dir(dir string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	hasher := sha256.New()
+	// WalkDir visits entries in lexical order, which makes the checksum deterministic
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		sum, err := Sha256File(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hasher, "%s\x00%s\n", filepath.ToSlash(rel), sum)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
 	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
@@ -1,10 +1,12 @@
 package util
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 )
 
@@ -62,3 +64,92 @@ func TestSha256File(t *testing.T) {
 		}
 	})
 }
+
+func TestSha256Dir(t *testing.T) {
+	write := func(dir, name, content string) {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { //nolint:gosec // test dir
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	a := t.TempDir()
+	b := t.TempDir()
+	for _, dir := range []string{a, b} {
+		write(dir, "one.txt", "1")
+		write(dir, "sub/two.txt", "2")
+	}
+	sumA, err := Sha256Dir(a)
+	if err != nil {
+		t.Fatalf("Sha256Dir returned error: %v", err)
+	}
+	sumB, err := Sha256Dir(b)
+	if err != nil {
+		t.Fatalf("Sha256Dir returned error: %v", err)
+	}
+	if sumA != sumB {
+		t.Errorf("Expected equal checksums for equal trees, got %s and %s", sumA, sumB)
+	}
+
+	// Renaming a file changes the checksum
+	if err := os.Rename(filepath.Join(b, "one.txt"), filepath.Join(b, "uno.txt")); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	sumB, err = Sha256Dir(b)
+	if err != nil {
+		t.Fatalf("Sha256Dir returned error: %v", err)
+	}
+	if sumA == sumB {
+		t.Errorf("Expected checksum to change after rename")
+	}
+
+	if _, err := Sha256Dir(filepath.Join(a, "missing")); err == nil {
+		t.Errorf("Expected error for missing dir")
+	}
+}
+
+func TestCopySha256(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 50000)
+	var dst bytes.Buffer
+	sha, err := CopySha256(&dst, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(content)
+	if sha != hex.EncodeToString(want[:]) {
+		t.Errorf("Checksum mismatch. Expected: %x, got: %s", want, sha)
+	}
+	if !bytes.Equal(dst.Bytes(), content) {
+		t.Errorf("Copied content differs")
+	}
+}
+
+func TestSha256FileAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates on every access")
+	}
+	// Buffers and hashes are pooled, hashing a large file allocates only for the file and the result
+	content := bytes.Repeat([]byte("0123456789"), 50000)
+	name := filepath.Join(t.TempDir(), "large.bin")
+	if err := os.WriteFile(name, content, 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	if _, err := Sha256File(name); err != nil {
+		t.Fatal(err)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	const runs = 20
+	for range runs {
+		if _, err := Sha256File(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	if perRun := (after.TotalAlloc - before.TotalAlloc) / runs; perRun > copyBufferSize/8 {
+		t.Errorf("Expected pooled buffers, got %d bytes allocated per checksum", perRun)
+	}
+}
@@ -0,0 +1,28 @@
+package util
+
+import (
+	"strings"
+)
+
+// Prefixes of Windows paths that bypass the MAX_PATH limit.
+const (
+	extendedLengthPrefix    = `\\?\`
+	extendedLengthUNCPrefix = `\\?\UNC\`
+	devicePrefix            = `\\.\`
+)
+
+// extendedLengthPath converts a clean absolute Windows path to its extended-length form,
+// e.g. C:\dir to \\?\C:\dir and \\server\share\dir to \\?\UNC\server\share\dir.
+// Paths in extended-length or device form are returned unchanged.
+// Extended-length paths are not normalized by Windows, so slashes are converted to backslashes.
+func extendedLengthPath(p string) string {
+	p = strings.ReplaceAll(p, "/", `\`)
+	switch {
+	case strings.HasPrefix(p, extendedLengthPrefix), strings.HasPrefix(p, devicePrefix):
+		return p
+	case strings.HasPrefix(p, `\\`):
+		return extendedLengthUNCPrefix + p[2:]
+	default:
+		return extendedLengthPrefix + p
+	}
+}
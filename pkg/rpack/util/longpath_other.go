@@ -0,0 +1,8 @@
+//go:build !windows
+
+package util
+
+// LongPath returns p unchanged, only Windows limits the length of paths to MAX_PATH.
+func LongPath(p string) string {
+	return p
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExtendedLengthPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`C:\repo\deep\file.txt`, `\\?\C:\repo\deep\file.txt`},
+		{`C:/repo/deep/file.txt`, `\\?\C:\repo\deep\file.txt`},
+		{`\\server\share\repo\file.txt`, `\\?\UNC\server\share\repo\file.txt`},
+		{`\\?\C:\repo\file.txt`, `\\?\C:\repo\file.txt`},
+		{`\\?\UNC\server\share\file.txt`, `\\?\UNC\server\share\file.txt`},
+		{`\\.\pipe\name`, `\\.\pipe\name`},
+	}
+	for _, tt := range tests {
+		if got := extendedLengthPath(tt.path); got != tt.want {
+			t.Errorf("extendedLengthPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLongPath(t *testing.T) {
+	short := "dir/file.txt"
+	if got := LongPath(short); got != short {
+		t.Errorf("Expected short path to be unchanged, got %q", got)
+	}
+	long := strings.Repeat("d/", 150) + "file.txt"
+	got := LongPath(long)
+	if runtime.GOOS != "windows" {
+		if got != long {
+			t.Errorf("Expected paths to be unchanged on %s, got %q", runtime.GOOS, got)
+		}
+		return
+	}
+	if !strings.HasPrefix(got, extendedLengthPrefix) || strings.Contains(got, "/") || !strings.HasSuffix(got, `\file.txt`) {
+		t.Errorf("Expected absolute extended-length path, got %q", got)
+	}
+	if LongPath(got) != got {
+		t.Error("Expected extended-length path to be unchanged")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package util
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// longPathThreshold is the length from which paths are converted. CreateDirectory
+// limits paths to MAX_PATH minus room for an 8.3 file name.
+const longPathThreshold = 248
+
+// LongPath returns p in extended-length form if its absolute path exceeds
+// the Windows MAX_PATH limit, so deep target and cache layouts can be written
+// without enabling long path support system wide. Shorter paths are returned unchanged.
+// The result is only meant for os calls, messages should show p.
+func LongPath(p string) string {
+	if strings.HasPrefix(p, extendedLengthPrefix) || strings.HasPrefix(p, devicePrefix) {
+		return p
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil || len(abs) < longPathThreshold {
+		return p
+	}
+	return extendedLengthPath(abs)
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package util
+
+// raceEnabled reports if the tests run with the race detector.
+const raceEnabled = true
@@ -1,10 +1,11 @@
 package rpack
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 
-	"cuelang.org/go/cue"
-	"cuelang.org/go/cue/cuecontext"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
 // SchemaValidator validates data against a schema.
@@ -12,6 +13,13 @@ type SchemaValidator interface {
 	Validate(x any) error
 }
 
+// SchemaDefaulter resolves defaults declared by a schema for data.
+type SchemaDefaulter interface {
+	// Defaults returns the concrete values of the schema unified with x,
+	// including default values for fields missing in x.
+	Defaults(x any) (map[string]any, error)
+}
+
 // EmptyValidator provides no validation
 type EmptyValidator struct{}
 
@@ -20,29 +28,144 @@ func (c *EmptyValidator) Validate(x any) error {
 	return nil
 }
 
-// CueValidator validates data using CUE schemas.
-type CueValidator struct {
-	Schema  cue.Value
-	Context *cue.Context
+// Defaults returns no defaults for the empty validator.
+func (c *EmptyValidator) Defaults(x any) (map[string]any, error) {
+	return map[string]any{}, nil
+}
+
+// mergeDefaults returns a copy of values with defaults filled in for missing keys.
+// Nested maps are merged recursively, values always take precedence.
+func mergeDefaults(values map[string]any, defaults map[string]any) map[string]any {
+	res := make(map[string]any, len(values))
+	for k, v := range defaults {
+		res[k] = v
+	}
+	for k, v := range values {
+		vm, isMap := v.(map[string]any)
+		dm, isDefaultMap := defaults[k].(map[string]any)
+		if isMap && isDefaultMap {
+			res[k] = mergeDefaults(vm, dm)
+			continue
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// JSONSchemaValidator validates data using a JSON Schema.
+type JSONSchemaValidator struct {
+	Schema *jsonschema.Schema
+}
+
+// jsonSchemaResource is the resource name the schema is compiled under.
+const jsonSchemaResource = "schema.json"
+
+// NewJSONSchemaValidator creates a new SchemaValidator from a JSON Schema document.
+// Drafts 4 to 2020-12 are supported, the draft is selected by $schema and defaults to 2020-12.
+func NewJSONSchemaValidator(schemaBytes []byte) (*JSONSchemaValidator, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaBytes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(jsonSchemaResource, doc); err != nil {
+		return nil, err
+	}
+	schema, err := c.Compile(jsonSchemaResource)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSchemaValidator{Schema: schema}, nil
+}
+
+// toJSONValue converts data into the generic JSON representation used by the validator.
+func toJSONValue(x any) (any, error) {
+	b, err := json.Marshal(x)
+	if err != nil {
+		return nil, err
+	}
+	return jsonschema.UnmarshalJSON(bytes.NewReader(b))
 }
 
-// NewCueValidator creates a new SchemaValidator using a cuelang schema and path to validate against.
-func NewCueValidator(schemaBytes []byte, path string) (*CueValidator, error) {
-	ctx := cuecontext.New()
-	schema := ctx.CompileBytes(schemaBytes).LookupPath(cue.ParsePath(path))
-	if !schema.Exists() {
-		return nil, fmt.Errorf("cue Schema %s does not exist", path)
+// Validate checks data against the JSON Schema.
+func (v *JSONSchemaValidator) Validate(x any) error {
+	doc, err := toJSONValue(x)
+	if err != nil {
+		return fmt.Errorf("could not convert data to JSON: %w", err)
 	}
+	return v.Schema.Validate(doc)
+}
 
-	return &CueValidator{
-		Schema:  schema,
-		Context: ctx,
-	}, nil
+// Defaults returns the `default` annotations of object properties missing in x.
+// Nested objects are only descended into if they are present in x or have a default.
+func (v *JSONSchemaValidator) Defaults(x any) (map[string]any, error) {
+	doc, err := toJSONValue(x)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert data to JSON: %w", err)
+	}
+	m, _ := jsonSchemaDefaults(v.Schema, doc).(map[string]any)
+	if m == nil {
+		m = map[string]any{}
+	}
+	return m, nil
 }
 
-// Validate checks data against the CUE schema.
-func (c *CueValidator) Validate(x any) error {
-	asCue := c.Context.Encode(x)
-	unified := c.Schema.Unify(asCue)
-	return unified.Validate()
+// jsonSchemaDefaults returns a copy of doc with defaults of the schema filled in.
+func jsonSchemaDefaults(s *jsonschema.Schema, doc any) any {
+	if s == nil {
+		return doc
+	}
+	// Follow references, e.g. to schemas declared in $defs, sibling keywords take precedence
+	def := s
+	for def.Default == nil && def.Ref != nil {
+		def = def.Ref
+	}
+	if doc == nil && def.Default != nil {
+		doc = jsonNumberToGo(*def.Default)
+	}
+	props := s
+	for len(props.Properties) == 0 && props.Ref != nil {
+		props = props.Ref
+	}
+	obj, ok := doc.(map[string]any)
+	if !ok || len(props.Properties) == 0 {
+		return jsonNumberToGo(doc)
+	}
+	res := make(map[string]any, len(obj))
+	for k, val := range obj {
+		res[k] = jsonNumberToGo(val)
+	}
+	for name, prop := range props.Properties {
+		if filled := jsonSchemaDefaults(prop, obj[name]); filled != nil {
+			res[name] = filled
+		}
+	}
+	return res
+}
+
+// jsonNumberToGo converts json.Number values produced by the validator
+// into int64 or float64, recursively.
+func jsonNumberToGo(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]any:
+		res := make(map[string]any, len(val))
+		for k, item := range val {
+			res[k] = jsonNumberToGo(item)
+		}
+		return res
+	case []any:
+		res := make([]any, len(val))
+		for i, item := range val {
+			res[i] = jsonNumberToGo(item)
+		}
+		return res
+	default:
+		return v
+	}
 }
@@ -0,0 +1,155 @@
+//go:build !rpack_nocue
+
+package rpack
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+)
+
+func init() {
+	registerFeature(FeatureCUE)
+}
+
+// CueValidator validates data using CUE schemas.
+type CueValidator struct {
+	Schema  cue.Value
+	Context *cue.Context
+}
+
+// NewCueValidator creates a new SchemaValidator using a cuelang schema and path to validate against.
+func NewCueValidator(schemaBytes []byte, path string) (*CueValidator, error) {
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(schemaBytes).LookupPath(cue.ParsePath(path))
+	if !schema.Exists() {
+		return nil, fmt.Errorf("cue Schema %s does not exist", path)
+	}
+
+	return &CueValidator{
+		Schema:  schema,
+		Context: ctx,
+	}, nil
+}
+
+// Validate checks data against the CUE schema.
+func (c *CueValidator) Validate(x any) error {
+	asCue := c.Context.Encode(x)
+	unified := c.Schema.Unify(asCue)
+	return unified.Validate()
+}
+
+// Defaults unifies data with the CUE schema and returns all concrete fields.
+// Regular fields with a default (e.g. `port: *8080 | int`) are filled in,
+// optional fields and fields without a concrete value are left out.
+func (c *CueValidator) Defaults(x any) (map[string]any, error) {
+	unified := c.Schema.Unify(c.Context.Encode(x))
+	if err := unified.Err(); err != nil {
+		return nil, err
+	}
+	res, ok := cueConcrete(unified)
+	if !ok {
+		return map[string]any{}, nil
+	}
+	m, ok := res.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected schema to describe a struct")
+	}
+	return m, nil
+}
+
+// cueConcrete converts the concrete parts of a CUE value into Go values,
+// resolving defaults. Returns false if the value is not concrete.
+//
+//nolint:gocognit,gocyclo // intentional: type switch over CUE kinds
+func cueConcrete(v cue.Value) (any, bool) {
+	v, _ = v.Default()
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		iter, err := v.Fields()
+		if err != nil {
+			return nil, false
+		}
+		m := make(map[string]any)
+		for iter.Next() {
+			if val, ok := cueConcrete(iter.Value()); ok {
+				m[iter.Selector().Unquoted()] = val
+			}
+		}
+		return m, true
+	case cue.ListKind:
+		iter, err := v.List()
+		if err != nil {
+			return nil, false
+		}
+		var l []any
+		for iter.Next() {
+			val, ok := cueConcrete(iter.Value())
+			if !ok {
+				return nil, false
+			}
+			l = append(l, val)
+		}
+		return l, true
+	}
+	if !v.IsConcrete() {
+		return nil, false
+	}
+	switch v.Kind() {
+	case cue.NullKind:
+		return nil, true
+	case cue.BoolKind:
+		b, err := v.Bool()
+		return b, err == nil
+	case cue.IntKind:
+		i, err := v.Int64()
+		return i, err == nil
+	case cue.FloatKind:
+		f, err := v.Float64()
+		return f, err == nil
+	case cue.StringKind:
+		s, err := v.String()
+		return s, err == nil
+	default:
+		return nil, false
+	}
+}
+
+// newBuiltinSchemaValidator creates the validator of an internal schema from its CUE source.
+func newBuiltinSchemaValidator(cueSchema, _ []byte, path string) (SchemaValidator, error) {
+	return NewCueValidator(cueSchema, path)
+}
+
+// cueErrorPath returns the path of the first CUE error, nil if err is no CUE error.
+// Leading definitions of the schema, e.g. #Schema, are not part of the data and removed.
+func cueErrorPath(err error) []string {
+	for _, d := range cueValidationDetails(err) {
+		if len(d.path) > 0 {
+			return d.path
+		}
+	}
+	return nil
+}
+
+// cueValidationDetails returns the individual errors of a CUE validation without the
+// leading definitions of their paths, nil if err is not a CUE error.
+func cueValidationDetails(err error) []validationDetail {
+	var cueErr cueerrors.Error
+	if !errors.As(err, &cueErr) {
+		return nil
+	}
+	var details []validationDetail
+	for _, e := range cueerrors.Errors(err) {
+		p := e.Path()
+		for len(p) > 0 && strings.HasPrefix(p[0], "#") {
+			p = p[1:]
+		}
+		format, args := e.Msg()
+		details = append(details, validationDetail{path: p, err: fmt.Errorf(format, args...)})
+	}
+	return details
+}
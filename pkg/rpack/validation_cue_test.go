@@ -0,0 +1,124 @@
+//go:build !rpack_nocue
+
+package rpack
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCueValidator(t *testing.T) {
+	const schema = `#Schema: { field!: string & "right-choice"  }`
+	v, err := NewCueValidator([]byte(schema), "#Schema")
+	if err != nil {
+		t.Fatalf("Failed setting up validation: %s", err)
+	}
+	// Valid
+	err = v.Validate(struct {
+		Field string `json:"field"`
+	}{
+		Field: "right-choice",
+	})
+	if err != nil {
+		t.Fatalf("Validation failed: %s", err)
+	}
+
+	// Invalid
+	err = v.Validate(struct {
+		Field string `json:"field"`
+	}{
+		Field: "wrong-choice",
+	})
+	if err == nil {
+		t.Fatalf("Validation should have failed for `wrong-choice`")
+	}
+}
+
+func TestCueValidatorDefaults(t *testing.T) {
+	const schema = `
+#Schema: {
+	values: #Values
+	inputs: [string]: string
+}
+#Values: {
+	name!:   string
+	port:    *8080 | int
+	debug:   *false | bool
+	ratio:   *0.5 | number
+	tags:    *["a", "b"] | [...string]
+	owner?:  *"nobody" | string
+	server: {
+		host:     *"localhost" | string
+		timeout?: int
+	}
+}
+`
+	v, err := NewCueValidator([]byte(schema), "#Schema")
+	if err != nil {
+		t.Fatalf("Failed setting up validation: %s", err)
+	}
+	defaults, err := v.Defaults(&RPackConfigConfig{
+		Values: map[string]any{"port": 9090, "server": map[string]any{"timeout": 5}},
+		Inputs: map[string]string{},
+	})
+	if err != nil {
+		t.Fatalf("Resolving defaults failed: %s", err)
+	}
+	expected := map[string]any{
+		"port":  int64(9090),
+		"debug": false,
+		"ratio": 0.5,
+		"tags":  []any{"a", "b"},
+		"server": map[string]any{
+			"host":    "localhost",
+			"timeout": int64(5),
+		},
+	}
+	if got := defaults["values"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected defaults %v, got %v", expected, got)
+	}
+
+	if _, err := v.Defaults(&RPackConfigConfig{Values: map[string]any{"port": "wrong"}}); err == nil {
+		t.Errorf("Expected error for conflicting value")
+	}
+}
+
+// TestBuiltinJSONSchemas checks that the JSON Schema equivalents of the internal
+// CUE schemas used by builds without CUE accept and reject the same documents.
+func TestBuiltinJSONSchemas(t *testing.T) {
+	configJSON, err := NewJSONSchemaValidator([]byte(RPackJSONSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defJSON, err := NewJSONSchemaValidator([]byte(RPackDefJSONSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		cue   SchemaValidator
+		json  SchemaValidator
+		doc   any
+		valid bool
+	}{
+		{"config source", RPackSchemaValidator, configJSON, &RPackConfig{SchemaVersion: "v1", Source: "./def", Config: &RPackConfigConfig{Values: map[string]any{"a": 1}}}, true},
+		{"config packs", RPackSchemaValidator, configJSON, &RPackConfig{SchemaVersion: "v1", Packs: []*RPackConfigPack{{Name: "a", Source: "./a", DependsOn: []string{"b"}}}, Protected: []string{"README.md"}}, true},
+		{"config schema version", RPackSchemaValidator, configJSON, &RPackConfig{SchemaVersion: "v2", Source: "./def"}, false},
+		{"config pack name", RPackSchemaValidator, configJSON, &RPackConfig{SchemaVersion: "v1", Packs: []*RPackConfigPack{{Name: "a b", Source: "./a"}}}, false},
+		{"config unknown field", RPackSchemaValidator, configJSON, map[string]any{"@schema_version": "v1", "source": "./def", "sauce": "x"}, false},
+		{"config empty pattern", RPackSchemaValidator, configJSON, &RPackConfig{SchemaVersion: "v1", Source: "./def", SemanticUnchanged: []string{""}}, false},
+		{"def", RPackDefSchemaValidator, defJSON, &RPackDef{SchemaVersion: "v1", Name: "app", Inputs: []*RPackDefInput{{Type: "dir", Name: "src.d"}}}, true},
+		{"def input type", RPackDefSchemaValidator, defJSON, &RPackDef{SchemaVersion: "v1", Name: "app", Inputs: []*RPackDefInput{{Type: "link", Name: "src"}}}, false},
+		{"def name", RPackDefSchemaValidator, defJSON, &RPackDef{SchemaVersion: "v1", Name: ""}, false},
+		{"def empty sensitive value", RPackDefSchemaValidator, defJSON, &RPackDef{SchemaVersion: "v1", Name: "app", SensitiveValues: []string{""}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cueErr := tt.cue.Validate(tt.doc)
+			jsonErr := tt.json.Validate(tt.doc)
+			if (cueErr == nil) != tt.valid || (jsonErr == nil) != tt.valid {
+				t.Errorf("Expected valid=%v, got CUE error %v and JSON Schema error %v", tt.valid, cueErr, jsonErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+//go:build rpack_nocue
+
+package rpack
+
+import (
+	"fmt"
+)
+
+// CueValidator is not available in builds with the rpack_nocue tag.
+type CueValidator struct{}
+
+// NewCueValidator fails in builds with the rpack_nocue tag, definitions need to use schema.json instead.
+func NewCueValidator(_ []byte, _ string) (*CueValidator, error) {
+	return nil, fmt.Errorf("CUE schemas are not supported, use %s: %w", RPackDefJSONSchemaFilename, featureDisabledError(FeatureCUE))
+}
+
+// Validate is never called, NewCueValidator always fails.
+func (c *CueValidator) Validate(_ any) error {
+	return featureDisabledError(FeatureCUE)
+}
+
+// Defaults is never called, NewCueValidator always fails.
+func (c *CueValidator) Defaults(_ any) (map[string]any, error) {
+	return nil, featureDisabledError(FeatureCUE)
+}
+
+// newBuiltinSchemaValidator creates the validator of an internal schema from its JSON Schema equivalent.
+func newBuiltinSchemaValidator(_, jsonSchema []byte, _ string) (SchemaValidator, error) {
+	return NewJSONSchemaValidator(jsonSchema)
+}
+
+// cueErrorPath returns nil, builds without CUE have no CUE errors.
+func cueErrorPath(error) []string {
+	return nil
+}
+
+// cueValidationDetails returns nil, builds without CUE have no CUE errors.
+func cueValidationDetails(error) []validationDetail {
+	return nil
+}
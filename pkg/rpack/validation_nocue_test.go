@@ -0,0 +1,17 @@
+//go:build rpack_nocue
+
+package rpack
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCueValidatorDisabled(t *testing.T) {
+	if _, err := NewCueValidator([]byte(`#Schema: {}`), "#Schema"); !errors.Is(err, ErrFeatureDisabled) {
+		t.Errorf("Expected ErrFeatureDisabled, got %v", err)
+	}
+	if err := RPackSchemaValidator.Validate(&RPackConfig{SchemaVersion: "v2", Source: "./def"}); err == nil {
+		t.Error("Expected the JSON Schema of the config to reject schema version v2")
+	}
+}
@@ -3,37 +3,12 @@ package rpack
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 )
 
-func TestCueValidator(t *testing.T) {
-	const schema = `#Schema: { field!: string & "right-choice"  }`
-	v, err := NewCueValidator([]byte(schema), "#Schema")
-	if err != nil {
-		t.Fatalf("Failed setting up validation: %s", err)
-	}
-	// Valid
-	err = v.Validate(struct {
-		Field string `json:"field"`
-	}{
-		Field: "right-choice",
-	})
-	if err != nil {
-		t.Fatalf("Validation failed: %s", err)
-	}
-
-	// Invalid
-	err = v.Validate(struct {
-		Field string `json:"field"`
-	}{
-		Field: "wrong-choice",
-	})
-	if err == nil {
-		t.Fatalf("Validation should have failed for `wrong-choice`")
-	}
-}
-
 func TestEmptyValidator(t *testing.T) {
 	v := &EmptyValidator{}
 	err := v.Validate(nil)
@@ -101,11 +76,44 @@ func TestValidateRPackDef(t *testing.T) {
 				"schema.cue": "not valid cue {{{{{",
 			},
 		},
+		{
+			name:    "valid with json schema",
+			wantErr: false,
+			files: map[string]string{
+				"rpack.yaml":  "\"@schema_version\": \"v1\"\nname: \"mypack\"\n",
+				"script.lua":  "print(\"hello\")",
+				"schema.json": `{"type": "object", "properties": {"values": {"type": "object"}}}`,
+			},
+		},
+		{
+			name:    "invalid json schema",
+			wantErr: true,
+			errMsg:  "JSON schema",
+			files: map[string]string{
+				"rpack.yaml":  "\"@schema_version\": \"v1\"\nname: \"mypack\"\n",
+				"script.lua":  "print(\"hello\")",
+				"schema.json": `{"type": 12}`,
+			},
+		},
+		{
+			name:    "both schema files",
+			wantErr: true,
+			errMsg:  "only one of",
+			files: map[string]string{
+				"rpack.yaml":  "\"@schema_version\": \"v1\"\nname: \"mypack\"\n",
+				"script.lua":  "print(\"hello\")",
+				"schema.cue":  "#Schema: {\n    test: string\n}",
+				"schema.json": `{"type": "object"}`,
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			dir := t.TempDir()
+			if _, ok := tt.files["schema.cue"]; ok && !slices.Contains(Features(), FeatureCUE) {
+				t.Skip("CUE is not included in this build")
+			}
 			for fname, content := range tt.files {
 				_ = os.WriteFile(filepath.Join(dir, fname), []byte(content), 0o644) //nolint:gosec // test files
 			}
@@ -122,3 +130,92 @@ func TestValidateRPackDef(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeDefaults(t *testing.T) {
+	values := map[string]any{
+		"port":   float64(9090),
+		"server": map[string]any{"timeout": float64(5)},
+		"list":   []any{"x"},
+	}
+	defaults := map[string]any{
+		"port":   int64(8080),
+		"debug":  false,
+		"server": map[string]any{"host": "localhost", "timeout": int64(1)},
+		"list":   []any{"a", "b"},
+	}
+	expected := map[string]any{
+		"port":   float64(9090),
+		"debug":  false,
+		"server": map[string]any{"host": "localhost", "timeout": float64(5)},
+		"list":   []any{"x"},
+	}
+	if got := mergeDefaults(values, defaults); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if _, ok := values["debug"]; ok {
+		t.Errorf("mergeDefaults must not modify values")
+	}
+}
+
+func TestJSONSchemaValidator(t *testing.T) {
+	const schema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"values": {
+			"type": "object",
+			"required": ["name"],
+			"properties": {
+				"name": {"type": "string"},
+				"port": {"type": "integer", "default": 8080},
+				"ratio": {"type": "number", "default": 0.5},
+				"server": {"$ref": "#/$defs/server", "default": {}},
+				"tls": {"type": "object", "properties": {"enabled": {"default": false}}}
+			},
+			"additionalProperties": false
+		},
+		"inputs": {"type": "object", "additionalProperties": {"type": "string"}}
+	},
+	"$defs": {
+		"server": {
+			"type": "object",
+			"properties": {"host": {"type": "string", "default": "localhost"}}
+		}
+	}
+}`
+	v, err := NewJSONSchemaValidator([]byte(schema))
+	if err != nil {
+		t.Fatalf("Failed setting up validation: %s", err)
+	}
+
+	valid := &RPackConfigConfig{
+		Values: map[string]any{"name": "svc", "port": float64(9090)},
+		Inputs: map[string]string{"in": "in"},
+	}
+	if err := v.Validate(valid); err != nil {
+		t.Fatalf("Validation failed: %s", err)
+	}
+	for _, values := range []map[string]any{
+		{"port": 1},
+		{"name": "svc", "port": "wrong"},
+		{"name": "svc", "unknown": true},
+	} {
+		if err := v.Validate(&RPackConfigConfig{Values: values}); err == nil {
+			t.Errorf("Validation should have failed for %v", values)
+		}
+	}
+
+	defaults, err := v.Defaults(valid)
+	if err != nil {
+		t.Fatalf("Resolving defaults failed: %s", err)
+	}
+	expected := map[string]any{
+		"name":   "svc",
+		"port":   int64(9090),
+		"ratio":  0.5,
+		"server": map[string]any{"host": "localhost"},
+	}
+	if got := defaults["values"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected defaults %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,150 @@
+package rpack
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Validation steps reported by a ValidationIssue.
+const (
+	// ValidationStepConfig validates the config file against its schema
+	ValidationStepConfig = "config"
+	// ValidationStepDefinition validates the rpack.yaml and schema file of a definition
+	ValidationStepDefinition = "definition"
+	// ValidationStepInputs validates the inputs of a pack against the definition
+	ValidationStepInputs = "inputs"
+	// ValidationStepValues validates the values of a pack against the schema of the definition
+	ValidationStepValues = "values"
+)
+
+// ValidationIssue is a single problem found by a validation step.
+type ValidationIssue struct {
+	Step string
+	// Pack is the name of the pack, empty for single source configs and config issues
+	Pack string
+	// Path is the location of the invalid field, empty if unknown
+	Path []string
+	// Err describes the issue, it is a *YAMLError if the position in the config file is known
+	Err error
+}
+
+func (i *ValidationIssue) Error() string {
+	var sb strings.Builder
+	sb.WriteString(i.Step)
+	if i.Pack != "" {
+		fmt.Fprintf(&sb, " of pack %s", i.Pack)
+	}
+	if len(i.Path) > 0 {
+		fmt.Fprintf(&sb, " at %s", strings.Join(i.Path, "."))
+	}
+	fmt.Fprintf(&sb, ": %v", i.Err)
+	return sb.String()
+}
+
+func (i *ValidationIssue) Unwrap() error {
+	return i.Err
+}
+
+// ValidationReport collects the issues of all validation steps, so they can be fixed in one pass.
+// It matches ErrValidation, and ErrSchemaValidation or ErrInputValidation for issues of the values and inputs.
+type ValidationReport struct {
+	Issues []*ValidationIssue
+}
+
+// add splits err into its individual issues, schema validation errors report one issue per invalid field
+// sorted by path.
+func (r *ValidationReport) add(step, pack string, err error) {
+	if err == nil {
+		return
+	}
+	details := splitValidationError(err)
+	slices.SortStableFunc(details, func(a, b validationDetail) int {
+		return slices.Compare(a.path, b.path)
+	})
+	for _, detail := range details {
+		r.Issues = append(r.Issues, &ValidationIssue{Step: step, Pack: pack, Path: detail.path, Err: detail.err})
+	}
+}
+
+// locate annotates the issues starting at index from with their position in the YAML file name,
+// the issue paths are relative to prefix in the document.
+func (r *ValidationReport) locate(name string, prefix []string, from int) {
+	for _, issue := range r.Issues[from:] {
+		if len(issue.Path) == 0 {
+			continue
+		}
+		issue.Err = annotateYAMLPath(name, append(append([]string{}, prefix...), issue.Path...), issue.Err)
+	}
+}
+
+// err returns the report as error, nil if there are no issues.
+func (r *ValidationReport) err() error {
+	if len(r.Issues) == 0 {
+		return nil
+	}
+	return r
+}
+
+func (r *ValidationReport) Error() string {
+	if len(r.Issues) == 1 {
+		return fmt.Sprintf("%v: %v", ErrValidation, r.Issues[0])
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v with %d issues:", ErrValidation, len(r.Issues))
+	for _, issue := range r.Issues {
+		sb.WriteString("\n  - ")
+		sb.WriteString(strings.ReplaceAll(issue.Error(), "\n", "\n    "))
+	}
+	return sb.String()
+}
+
+// Unwrap returns the issues and the sentinel errors of their steps.
+func (r *ValidationReport) Unwrap() []error {
+	errs := []error{ErrValidation}
+	for _, issue := range r.Issues {
+		switch issue.Step {
+		case ValidationStepValues:
+			errs = append(errs, ErrSchemaValidation)
+		case ValidationStepInputs:
+			errs = append(errs, ErrInputValidation)
+		}
+		errs = append(errs, issue)
+	}
+	return errs
+}
+
+// validationDetail is a single error of a validation with the location of the invalid field.
+type validationDetail struct {
+	path []string
+	err  error
+}
+
+// splitValidationError returns the individual errors of a JSON Schema or CUE validation,
+// other errors are returned as they are.
+func splitValidationError(err error) []validationDetail {
+	var jsErr *jsonschema.ValidationError
+	if errors.As(err, &jsErr) {
+		var details []validationDetail
+		for _, unit := range jsErr.BasicOutput().Errors {
+			if unit.Error == nil {
+				continue
+			}
+			var path []string
+			if loc := strings.Trim(unit.InstanceLocation, "/"); loc != "" {
+				path = strings.Split(loc, "/")
+			}
+			details = append(details, validationDetail{path: path, err: errors.New(unit.Error.String())})
+		}
+		if len(details) > 0 {
+			return details
+		}
+	}
+	if details := cueValidationDetails(err); len(details) > 0 {
+		return details
+	}
+	return []validationDetail{{path: validationErrorPath(err), err: err}}
+}
@@ -0,0 +1,98 @@
+package rpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultVerifyTimeout limits the run time of a verify command without timeout.
+const DefaultVerifyTimeout = 10 * time.Minute
+
+// commandWaitDelay bounds waiting for the output of a command killed on its timeout,
+// a child process keeping stdout open must not delay the timeout.
+const commandWaitDelay = time.Second
+
+// verifyOutputLines is the number of output lines of a failed verify command included in the error.
+const verifyOutputLines = 20
+
+// name returns the name of the command, the command line if none is set.
+func (v *RPackConfigVerify) name() string {
+	if v.Name != "" {
+		return v.Name
+	}
+	return strings.Join(v.Command, " ")
+}
+
+// timeout returns the parsed timeout of the command.
+func (v *RPackConfigVerify) timeout() (time.Duration, error) {
+	if v.Timeout == "" {
+		return DefaultVerifyTimeout, nil
+	}
+	d, err := time.ParseDuration(v.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q of verify command %q: %w", v.Timeout, v.name(), ErrValidation)
+	}
+	return d, nil
+}
+
+// checkVerifyCommands checks that the programs of all commands are allowed and their timeouts valid.
+func checkVerifyCommands(cmds []*RPackConfigVerify, allow []string) error {
+	for _, v := range cmds {
+		if len(v.Command) == 0 {
+			return fmt.Errorf("verify command %q has no program: %w", v.name(), ErrValidation)
+		}
+		if !slices.Contains(allow, v.Command[0]) {
+			return fmt.Errorf("program %q of verify command %q is not allowed, allow it with --allow-verify %s", v.Command[0], v.name(), v.Command[0])
+		}
+		if _, err := v.timeout(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runVerifyCommands runs the commands in dir one after another and stops at the first failure.
+func runVerifyCommands(ctx context.Context, log *slog.Logger, cmds []*RPackConfigVerify, dir string) error {
+	for _, v := range cmds {
+		timeout, err := v.timeout()
+		if err != nil {
+			return err
+		}
+		log.Info("Running verify command", "name", v.name())
+		start := time.Now()
+		cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(cmdCtx, v.Command[0], v.Command[1:]...) //nolint:gosec // intentional: allowlisted command from config
+		cmd.Dir = dir
+		cmd.WaitDelay = commandWaitDelay
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		err = cmd.Run()
+		timedOut := errors.Is(cmdCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		log.Debug("Verify command finished", "name", v.name(), "duration", time.Since(start), "output", out.String())
+		if timedOut {
+			return fmt.Errorf("%w: %s: timed out after %s", ErrVerifyFailed, v.name(), timeout)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w\n%s", ErrVerifyFailed, v.name(), err, tailLines(out.String(), verifyOutputLines))
+		}
+	}
+	return nil
+}
+
+// tailLines returns the last n lines of s.
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
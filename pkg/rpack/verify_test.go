@@ -0,0 +1,117 @@
+package rpack
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+// TestVerifyHelperProcess is run as verify command by the tests below.
+func TestVerifyHelperProcess(_ *testing.T) {
+	switch os.Getenv("RPACK_VERIFY_HELPER") {
+	case "fail":
+		_, _ = os.Stderr.WriteString("generated code is broken\n")
+		os.Exit(1)
+	case "sleep":
+		time.Sleep(10 * time.Second)
+		os.Exit(0)
+	case "orphan":
+		// The child inherits stdout and outlives the killed helper
+		child := exec.Command(os.Args[0], "-test.run=^TestVerifyHelperProcess$") //nolint:gosec // test binary
+		child.Env = append(os.Environ(), "RPACK_VERIFY_HELPER=sleep")
+		child.Stdout = os.Stdout
+		_ = child.Start()
+		time.Sleep(10 * time.Second)
+		os.Exit(0)
+	case "ok":
+		os.Exit(0)
+	}
+}
+
+// verifyConfig returns a config snippet running the test binary as helper process.
+func verifyConfig(t *testing.T, mode, timeout string) string {
+	t.Helper()
+	t.Setenv("RPACK_VERIFY_HELPER", mode)
+	s := "verify:\n  - name: helper\n    command: [\"" + filepath.ToSlash(os.Args[0]) + "\", \"-test.run=^TestVerifyHelperProcess$\"]\n"
+	if timeout != "" {
+		s += "    timeout: " + timeout + "\n"
+	}
+	return s
+}
+
+func TestRunVerify(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./out.txt\", \"new\\n\")\n", verifyConfig(t, "ok", ""))
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err == nil || !strings.Contains(err.Error(), "--allow-verify") {
+		t.Fatalf("Expected not allowed program to fail, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "out.txt")); !os.IsNotExist(err) {
+		t.Fatal("Expected nothing to be applied")
+	}
+
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, AllowVerify: []string{filepath.ToSlash(os.Args[0])}}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(workDir, "out.txt")); err != nil || string(b) != "new\n" { //nolint:gosec // test file
+		t.Fatalf("Expected out.txt to be applied, got %q: %v", b, err)
+	}
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config, NoVerify: true}); err != nil {
+		t.Fatalf("Expected --no-verify to skip the allowlist, got %v", err)
+	}
+}
+
+func TestRunVerifyRollback(t *testing.T) {
+	config, workDir := setupRunConfig(t, "rpack.write(\"./keep.txt\", \"v1\\n\")\nrpack.write(\"./old.txt\", \"old\\n\")\n", "")
+	if _, err := Run(t.Context(), api.RunOptions{ConfigFile: config}); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := os.ReadFile(filepath.Join(workDir, "app.rpack.lock.yaml")) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new version modifies keep.txt, removes old.txt and adds new/file.txt
+	script := "local rpack = require(\"rpack.v1\")\nrpack.write(\"./keep.txt\", \"v2\\n\")\nrpack.write(\"./new/file.txt\", \"new\\n\")\n"
+	if err = os.WriteFile(filepath.Join(filepath.Dir(workDir), "def", "script.lua"), []byte(script), 0o644); err != nil { //nolint:gosec // test file
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		mode, timeout, want string
+	}{
+		{"fail", "", "generated code is broken"},
+		{"sleep", "100ms", "timed out"},
+		{"orphan", "100ms", "timed out"},
+	} {
+		start := time.Now()
+		content, _ := os.ReadFile(config) //nolint:gosec // test file
+		withVerify := strings.SplitN(string(content), "verify:", 2)[0] + verifyConfig(t, tc.mode, tc.timeout)
+		if err = os.WriteFile(config, []byte(withVerify), 0o644); err != nil { //nolint:gosec // test file
+			t.Fatal(err)
+		}
+		_, err = Run(t.Context(), api.RunOptions{ConfigFile: config, AllowVerify: []string{filepath.ToSlash(os.Args[0])}})
+		if !errors.Is(err, ErrVerifyFailed) || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected verify failure containing %q, got %v", tc.mode, tc.want, err)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("%s: expected the timeout to be enforced, took %s", tc.mode, d)
+		}
+		for name, want := range map[string]string{"keep.txt": "v1\n", "old.txt": "old\n", "app.rpack.lock.yaml": string(lock)} {
+			if b, err := os.ReadFile(filepath.Join(workDir, name)); err != nil || string(b) != want { //nolint:gosec // test file
+				t.Errorf("%s: expected %s to be restored, got %q: %v", tc.mode, name, b, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(workDir, "new")); !os.IsNotExist(err) {
+			t.Errorf("%s: expected created directory to be removed, got %v", tc.mode, err)
+		}
+		entries, _ := filepath.Glob(filepath.Join(workDir, RPackCacheDir, "backup-*"))
+		if len(entries) != 0 {
+			t.Errorf("%s: expected backups to be removed, got %v", tc.mode, entries)
+		}
+	}
+}
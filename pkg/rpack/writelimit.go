@@ -0,0 +1,189 @@
+package rpack
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FSSizeHook is implemented by access hooks that track the size of written files, see WriteLimitFSHook.
+// BaseFS calls it after the access hooks allowed the operation.
+type FSSizeHook interface {
+	// WriteSize is called before the content of h is replaced by size bytes, an error denies the write
+	WriteSize(h FSHandle, size int64) error
+	// Removed is called after h was removed
+	Removed(h FSHandle)
+	// Renamed is called after src was moved to dst
+	Renamed(src, dst FSHandle)
+}
+
+// WriteLimitFSHook limits the size of the files a script writes, so a script writing in an endless loop
+// fails instead of filling the disk. Temp and target files count, the total is the size of all files
+// the script wrote and did not remove, rewriting a file replaces its size.
+type WriteLimitFSHook struct {
+	// MaxFileSize is the maximum size of a single file in bytes, 0 for no limit
+	MaxFileSize int64
+	// MaxTotalSize is the maximum size of all written files in bytes, 0 for no limit
+	MaxTotalSize int64
+
+	sizes    map[string]int64
+	total    int64
+	exceeded error
+}
+
+// Check WriteLimitFSHook satisfies FSAccessHook and FSSizeHook interfaces
+var (
+	_ = FSAccessHook(&WriteLimitFSHook{})
+	_ = FSSizeHook(&WriteLimitFSHook{})
+)
+
+func (h *WriteLimitFSHook) Read(FSHandle) error    { return nil }
+func (h *WriteLimitFSHook) Write(FSHandle) error   { return nil }
+func (h *WriteLimitFSHook) ReadDir(FSHandle) error { return nil }
+func (h *WriteLimitFSHook) Stat(FSHandle) error    { return nil }
+func (h *WriteLimitFSHook) Remove(FSHandle) error  { return nil }
+
+// WriteSize denies writes exceeding the size limits.
+func (h *WriteLimitFSHook) WriteSize(handle FSHandle, size int64) error {
+	if h.MaxFileSize > 0 && size > h.MaxFileSize {
+		return h.deny(fmt.Sprintf("writing %s to %s exceeds the file size limit of %s", FormatByteSize(size), handle.FriendlyPath(), FormatByteSize(h.MaxFileSize)))
+	}
+	key := handle.FriendlyPath()
+	total := h.total - h.sizes[key] + size
+	if h.MaxTotalSize > 0 && total > h.MaxTotalSize {
+		return h.deny(fmt.Sprintf("writing %s to %s exceeds the total write size limit of %s", FormatByteSize(size), handle.FriendlyPath(), FormatByteSize(h.MaxTotalSize)))
+	}
+	if h.sizes == nil {
+		h.sizes = make(map[string]int64)
+	}
+	h.sizes[key] = size
+	h.total = total
+	return nil
+}
+
+// deny returns an ErrWriteLimit with msg and remembers the first one.
+func (h *WriteLimitFSHook) deny(msg string) error {
+	err := &markedError{msg: msg, mark: ErrWriteLimit}
+	if h.exceeded == nil {
+		h.exceeded = err
+	}
+	return err
+}
+
+// Exceeded returns the first denied write, nil if the script stayed within the limits.
+// The run fails with it even if the script caught the error.
+func (h *WriteLimitFSHook) Exceeded() error {
+	return h.exceeded
+}
+
+// scriptError returns the error of a script run with the hook, ErrWriteLimit if a write was denied.
+// A script catching the denial with pcall fails anyway instead of carrying on with a partial result.
+func (h *WriteLimitFSHook) scriptError(err error) error {
+	switch {
+	case h.exceeded == nil:
+		return err
+	case err == nil:
+		return h.exceeded
+	default:
+		return &writeLimitError{err: err}
+	}
+}
+
+// writeLimitError is the error of a script failing on a denied write, it keeps the position in the script.
+type writeLimitError struct {
+	err error
+}
+
+func (e *writeLimitError) Error() string        { return e.err.Error() }
+func (e *writeLimitError) Unwrap() error        { return e.err }
+func (e *writeLimitError) Is(target error) bool { return target == ErrWriteLimit }
+
+// Removed forgets the size of a removed file.
+func (h *WriteLimitFSHook) Removed(handle FSHandle) {
+	key := handle.FriendlyPath()
+	h.total -= h.sizes[key]
+	delete(h.sizes, key)
+}
+
+// Renamed moves the size of src to dst, replacing the size of dst.
+func (h *WriteLimitFSHook) Renamed(src, dst FSHandle) {
+	size, ok := h.sizes[src.FriendlyPath()]
+	h.Removed(dst)
+	if ok {
+		delete(h.sizes, src.FriendlyPath())
+		h.sizes[dst.FriendlyPath()] = size
+	}
+}
+
+// writeSize calls the size hooks before the content of h is replaced by size bytes.
+func (fs *BaseFS) writeSize(h FSHandle, size int64) error {
+	for _, hook := range fs.Hooks {
+		if s, ok := hook.(FSSizeHook); ok {
+			if err := s.WriteSize(h, size); err != nil {
+				fs.denied(FSAccessTypeWrite, h, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasSizeHooks reports if a hook tracks the size of written files.
+func (fs *BaseFS) hasSizeHooks() bool {
+	for _, hook := range fs.Hooks {
+		if _, ok := hook.(FSSizeHook); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// copySize returns the size of the file src, for size hooks checking a copy before it is written.
+func copySize(src FSHandle) (int64, error) {
+	if info, err := os.Stat(src.AbsPath()); err == nil && info.Mode().IsRegular() {
+		return info.Size(), nil
+	}
+	b, err := src.Read()
+	return int64(len(b)), err
+}
+
+// byteSizeUnits are the units of ParseByteSize and FormatByteSize, longest suffix first.
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"GB", 1e9},
+	{"MB", 1e6},
+	{"KB", 1e3},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size in bytes with an optional unit, e.g. 1048576, 100MiB or 2GB.
+func ParseByteSize(s string) (int64, error) {
+	num, mult := strings.TrimSpace(s), int64(1)
+	for _, unit := range byteSizeUnits {
+		if trimmed, ok := strings.CutSuffix(num, unit.suffix); ok {
+			num, mult = strings.TrimSpace(trimmed), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/mult {
+		return 0, fmt.Errorf("invalid size %q, use bytes or a unit like 100MiB", s)
+	}
+	return n * mult, nil
+}
+
+// FormatByteSize formats a size in bytes with the largest binary unit it is a multiple of, e.g. 100MiB or 1500 bytes.
+func FormatByteSize(n int64) string {
+	for _, unit := range byteSizeUnits[:3] {
+		if n >= unit.size && n%unit.size == 0 {
+			return strconv.FormatInt(n/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + " bytes"
+}
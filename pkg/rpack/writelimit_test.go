@@ -0,0 +1,100 @@
+package rpack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blang/rpack/pkg/api"
+)
+
+func TestRunWriteLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		opts    api.RunOptions
+		wantErr string
+	}{
+		{
+			name:    "file size",
+			script:  "rpack.write(\"./big.txt\", string.rep(\"x\", 2048))\n",
+			opts:    api.RunOptions{MaxFileSize: 1024},
+			wantErr: "exceeds the file size limit of 1KiB",
+		},
+		{
+			name:    "append loop",
+			script:  "for i = 1, 100 do rpack.append(\"temp:log.txt\", string.rep(\"x\", 100)) end\n",
+			opts:    api.RunOptions{MaxFileSize: 1024},
+			wantErr: "exceeds the file size limit of 1KiB",
+		},
+		{
+			name:    "total size",
+			script:  "for i = 1, 100 do rpack.write(\"./f\" .. i .. \".txt\", string.rep(\"x\", 100)) end\n",
+			opts:    api.RunOptions{MaxTotalSize: 1024},
+			wantErr: "exceeds the total write size limit of 1KiB",
+		},
+		{
+			name:    "caught by the script",
+			script:  "pcall(rpack.write, \"./big.txt\", string.rep(\"x\", 2048))\nrpack.write(\"./small.txt\", \"x\")\n",
+			opts:    api.RunOptions{MaxFileSize: 1024},
+			wantErr: "exceeds the file size limit of 1KiB",
+		},
+		{
+			name:   "rewrites and removals free their size",
+			script: "for i = 1, 100 do rpack.write(\"./same.txt\", string.rep(\"x\", 100)) end\nfor i = 1, 20 do rpack.write(\"temp:t\" .. i, string.rep(\"x\", 500))\nrpack.remove(\"temp:t\" .. i) end\n",
+			opts:   api.RunOptions{MaxTotalSize: 1024},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config, workDir := setupRunConfig(t, tc.script, "")
+			tc.opts.ConfigFile = config
+			_, err := Run(t.Context(), tc.opts)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrWriteLimit) || !errors.Is(err, ErrLuaExecution) {
+				t.Fatalf("Expected ErrWriteLimit, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Expected %q in %v", tc.wantErr, err)
+			}
+			if _, err := os.Stat(filepath.Join(workDir, "small.txt")); !os.IsNotExist(err) {
+				t.Fatalf("Expected nothing applied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"0":      0,
+		"1500":   1500,
+		"10KB":   10_000,
+		"10 KiB": 10 << 10,
+		"100MiB": 100 << 20,
+		"2GB":    2_000_000_000,
+		"1GiB":   1 << 30,
+		" 512B ": 512,
+	} {
+		got, err := ParseByteSize(s)
+		if err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, expected %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "MiB", "-1", "1.5GiB", "10TB", "99999999999GiB"} {
+		if _, err := ParseByteSize(s); err == nil {
+			t.Errorf("Expected ParseByteSize(%q) to fail", s)
+		}
+	}
+	for n, want := range map[int64]string{1500: "1500 bytes", 2048: "2KiB", 100 << 20: "100MiB", 1 << 30: "1GiB"} {
+		if got := FormatByteSize(n); got != want {
+			t.Errorf("FormatByteSize(%d) = %q, expected %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package rpack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLError is a decode or validation error of a YAML file with the position of the offending node.
+type YAMLError struct {
+	File string
+	// Line and Column are 1-based, Column is 0 if unknown
+	Line   int
+	Column int
+	// Snippet is the offending line of the file with a marker below the column
+	Snippet string
+	Err     error
+}
+
+func (e *YAMLError) Error() string {
+	pos := fmt.Sprintf("line %d", e.Line)
+	if e.Column > 0 {
+		pos += fmt.Sprintf(", column %d", e.Column)
+	}
+	return fmt.Sprintf("%s: %v\n%s", pos, e.Err, e.Snippet)
+}
+
+func (e *YAMLError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	yamlLineRegex         = regexp.MustCompile(`yaml: line (\d+)`)
+	yamlUnknownFieldRegex = regexp.MustCompile(`unknown field "([^"]+)"`)
+)
+
+// annotateYAMLError adds the position of the node err refers to in the YAML file name.
+// It understands syntax errors, unknown fields and schema validation errors,
+// other errors and errors without a known position are returned as they are.
+func annotateYAMLError(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	b, readErr := os.ReadFile(name) //nolint:gosec // intentional: file that failed to load
+	if readErr != nil {
+		return err
+	}
+	line, col := yamlErrorPosition(b, err)
+	if line == 0 {
+		return err
+	}
+	return &YAMLError{File: name, Line: line, Column: col, Snippet: yamlSnippet(b, line, col), Err: err}
+}
+
+// annotateYAMLPath adds the position of the node at path in the YAML file name to err.
+// Without a known position err is returned as it is.
+func annotateYAMLPath(name string, path []string, err error) error {
+	b, readErr := os.ReadFile(name) //nolint:gosec // intentional: file that failed to validate
+	if readErr != nil {
+		return err
+	}
+	var root yaml.Node
+	if yaml.Unmarshal(b, &root) != nil {
+		return err
+	}
+	n := findYAMLPath(&root, path)
+	if n == nil || n.Line == 0 {
+		return err
+	}
+	return &YAMLError{File: name, Line: n.Line, Column: n.Column, Snippet: yamlSnippet(b, n.Line, n.Column), Err: err}
+}
+
+// yamlErrorPosition returns the position err refers to in the YAML document b, 0 if unknown.
+func yamlErrorPosition(b []byte, err error) (line, col int) {
+	// Syntax errors carry the line only
+	if m := yamlLineRegex.FindStringSubmatch(err.Error()); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		return line, 0
+	}
+	var root yaml.Node
+	if yaml.Unmarshal(b, &root) != nil {
+		return 0, 0
+	}
+	if m := yamlUnknownFieldRegex.FindStringSubmatch(err.Error()); m != nil {
+		if n := findYAMLKey(&root, m[1]); n != nil {
+			return n.Line, n.Column
+		}
+	}
+	if path := validationErrorPath(err); path != nil {
+		if n := findYAMLPath(&root, path); n != nil {
+			return n.Line, n.Column
+		}
+	}
+	return 0, 0
+}
+
+// validationErrorPath returns the location of the first error of a schema validation, nil if unknown.
+func validationErrorPath(err error) []string {
+	var jsErr *jsonschema.ValidationError
+	if errors.As(err, &jsErr) {
+		// The most specific location is found in the leaf causes
+		for len(jsErr.Causes) > 0 {
+			jsErr = jsErr.Causes[0]
+		}
+		return jsErr.InstanceLocation
+	}
+	return cueErrorPath(err)
+}
+
+// findYAMLKey returns the first mapping key named key in document order.
+func findYAMLKey(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i]
+			}
+			if found := findYAMLKey(n.Content[i+1], key); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	for _, c := range n.Content {
+		if found := findYAMLKey(c, key); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findYAMLPath returns the key node of the deepest existing element of path,
+// e.g. the parent of a missing required field.
+func findYAMLPath(root *yaml.Node, path []string) *yaml.Node {
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	pos := n
+	for _, elem := range path {
+		var next, key *yaml.Node
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == elem {
+					key, next = n.Content[i], n.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(elem); err == nil && i >= 0 && i < len(n.Content) {
+				key, next = n.Content[i], n.Content[i]
+			}
+		}
+		if next == nil {
+			break
+		}
+		n, pos = next, key
+	}
+	return pos
+}
+
+// yamlSnippet returns line of b with its number and a marker below col.
+func yamlSnippet(b []byte, line, col int) string {
+	lines := strings.Split(string(b), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	prefix := fmt.Sprintf("%4d | ", line)
+	s := prefix + strings.TrimRight(lines[line-1], "\r")
+	if col > 0 {
+		s += "\n" + strings.Repeat(" ", len(prefix)-2) + "| " + strings.Repeat(" ", col-1) + "^"
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package rpack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestAnnotateYAMLError(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		line, col int
+		snippet   string
+	}{
+		{
+			name:    "unknown field",
+			content: "\"@schema_version\": \"v1\"\nsource: \"x\"\nconfig:\n  vaules:\n    a: 1\n",
+			line:    4, col: 3,
+			snippet: "   4 |   vaules:\n     |   ^",
+		},
+		{
+			name:    "schema violation",
+			content: "\"@schema_version\": \"v1\"\npacks:\n  - name: \"a b\"\n    source: x\n",
+			line:    3, col: 5,
+			snippet: "   3 |   - name: \"a b\"\n     |     ^",
+		},
+		{
+			name:    "syntax error",
+			content: "\"@schema_version\": \"v1\"\nsource: [x\n",
+			line:    2,
+			snippet: "   2 | source: [x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "app.rpack.yaml")
+			if err := os.WriteFile(name, []byte(tt.content), 0o644); err != nil { //nolint:gosec // test file
+				t.Fatal(err)
+			}
+			_, err := LoadRPackConfig(name)
+			var yamlErr *YAMLError
+			if !errors.As(err, &yamlErr) {
+				t.Fatalf("Expected YAMLError, got %v", err)
+			}
+			if yamlErr.File != name || yamlErr.Line != tt.line || yamlErr.Column != tt.col {
+				t.Errorf("Expected %d:%d, got %s:%d:%d", tt.line, tt.col, yamlErr.File, yamlErr.Line, yamlErr.Column)
+			}
+			if yamlErr.Snippet != tt.snippet {
+				t.Errorf("Unexpected snippet:\n%s\nwant:\n%s", yamlErr.Snippet, tt.snippet)
+			}
+			if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), tt.snippet) {
+				t.Errorf("Expected validation error with snippet, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFindYAMLPath(t *testing.T) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte("a:\n  b:\n    - x\n    - y\n"), &root); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path      []string
+		line, col int
+	}{
+		{[]string{"a", "b", "1"}, 4, 7},
+		// The deepest existing element is reported for missing elements
+		{[]string{"a", "missing"}, 1, 1},
+		{[]string{"a", "b", "5"}, 2, 3},
+		{nil, 1, 1},
+	} {
+		n := findYAMLPath(&root, tc.path)
+		if n.Line != tc.line || n.Column != tc.col {
+			t.Errorf("%v: expected %d:%d, got %d:%d", tc.path, tc.line, tc.col, n.Line, n.Column)
+		}
+	}
+}